@@ -13,9 +13,16 @@ const (
 	// LineRuneMode specifies a line number and rune position within that line (both 0-indexed).
 	// The newline character is considered the last character of its line.
 	LineRuneMode
+
+	// EOFMode specifies the end of the document, wherever it is when the
+	// address is used. A decoration placed at it is anchored there: it
+	// takes GravityRight (whatever Gravity the entry asks for), so
+	// appends slide it along and truncations pull it back - it stays at
+	// EOF through every edit.
+	EOFMode
 )
 
-// AbsoluteAddress specifies a position using one of three addressing modes.
+// AbsoluteAddress specifies a position using one of its addressing modes.
 type AbsoluteAddress struct {
 	Mode AddressMode
 
@@ -48,6 +55,11 @@ func RuneAddress(pos int64) AbsoluteAddress {
 	}
 }
 
+// EOFAddress creates an AbsoluteAddress for the end of the document.
+func EOFAddress() AbsoluteAddress {
+	return AbsoluteAddress{Mode: EOFMode}
+}
+
 // LineAddress creates an AbsoluteAddress in line:rune mode.
 func LineAddress(line, runeInLine int64) AbsoluteAddress {
 	return AbsoluteAddress{
@@ -73,20 +85,61 @@ type LineStart struct {
 //   - Len + 1  : attach before the newline following the insert point
 //   - > Len + 1: attach after the newline following the insert point
 type RelativeDecoration struct {
-	Key      string
-	Position int64
+	Key       string
+	Position  int64
+	Gravity   Gravity
+	Namespace string // optional; see decoration_namespace.go
 }
 
 // DecorationEntry represents a decoration with its absolute position.
 type DecorationEntry struct {
-	Key     string
-	Address *AbsoluteAddress // nil to delete the decoration
+	Key       string
+	Address   *AbsoluteAddress // nil to delete the decoration
+	Gravity   Gravity          // which way the mark goes on an insert at it
+	Namespace string           // optional; see decoration_namespace.go
 }
 
 // Decoration represents a decoration stored within a node.
 type Decoration struct {
 	Key      string
 	Position int64 // relative byte offset within the node
+	Gravity  Gravity
+}
+
+// Gravity decides what happens to a decoration when content is
+// inserted EXACTLY at its position (anywhere else the answer is fixed:
+// marks before the insert stay, marks after it shift). It applies to
+// inserts, to the landing point of overwrites, moves and copies, and
+// survives deletion (a mark collapsed to the deletion point keeps its
+// gravity) and relocation (marks moved or copied with their content).
+type Gravity uint8
+
+const (
+	// GravityDefault lets each edit decide: an insert with insertBefore
+	// slides the mark past the new content, one without leaves it at
+	// its address (the first byte of the new content).
+	GravityDefault Gravity = iota
+
+	// GravityLeft keeps the mark at its address whatever the edit
+	// asks: inserted content lands after it (the mark sticks to what
+	// precedes it, like an Emacs marker or a selection's start).
+	GravityLeft
+
+	// GravityRight always slides the mark past inserted content (it
+	// sticks to what follows it, like a selection's end).
+	GravityRight
+)
+
+// slides reports whether a mark with this gravity, sitting exactly at
+// an insert point, moves past the inserted content.
+func (g Gravity) slides(insertBefore bool) bool {
+	switch g {
+	case GravityLeft:
+		return false
+	case GravityRight:
+		return true
+	}
+	return insertBefore
 }
 
 // ValidDecorationKey reports whether key is a legal decoration
@@ -115,7 +168,7 @@ func ValidDecorationKey(key string) bool {
 // an edit begins - never mid-mutation.
 func validateRelativeDecorations(decs []RelativeDecoration) error {
 	for _, d := range decs {
-		if !ValidDecorationKey(d.Key) {
+		if !ValidDecorationKey(d.Key) || (d.Namespace != "" && !ValidDecorationKey(d.Namespace)) {
 			return ErrInvalidDecorationKey
 		}
 	}
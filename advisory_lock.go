@@ -0,0 +1,178 @@
+package garland
+
+// advisory_lock.go - opt-in OS advisory locking of the source file.
+//
+// The emacs lock protocol (emacs_lock.go) is a convention carried in a
+// sidecar file, honored by tools that know it. FileOptions.AdvisoryLock
+// asks the OPERATING SYSTEM instead: an exclusive advisory lock (flock
+// on unix, LockFileEx on Windows) on the source file for as long as the
+// Garland has it open, so a second garland-based editor - or any tool
+// that takes the same lock - is told the file is in use rather than
+// silently racing on Save.
+//
+//   - The lock is taken at Open on a dedicated handle and released at
+//     Close. In-place saves rewrite the same file, so the lock stays
+//     valid across them; switching the source to another file
+//     (SaveAs adoption, RebaseOnFile) moves the lock with it.
+//   - Opening never fails because someone else holds the lock - viewing
+//     is harmless. The state is recorded (AdvisoryLockStatus reports
+//     AdvisoryLockBusy) and the app decides whether to warn.
+//   - Saving over the source DOES refuse while another holder has it:
+//     the save retries the lock first and fails with ErrFileLocked if it
+//     is still taken. RetryAdvisoryLock polls without saving.
+//   - Locking goes through the filesystem hook: a FileSystemInterface
+//     that also implements FileLocker participates (the local
+//     filesystem does); one that does not, or a platform without the
+//     primitive, yields AdvisoryLockUnsupported and saves proceed
+//     unguarded, as they would without the option.
+
+// FileLocker is an optional FileSystemInterface extension for advisory
+// locking. LockFile takes an exclusive lock on an open handle without
+// blocking, returning ErrFileLocked when another holder has it (or
+// ErrNotSupported); UnlockFile releases it.
+type FileLocker interface {
+	LockFile(handle FileHandle) error
+	UnlockFile(handle FileHandle) error
+}
+
+// AdvisoryLockStatus reports the state of FileOptions.AdvisoryLock.
+type AdvisoryLockStatus int
+
+const (
+	// AdvisoryLockOff: the option is not enabled (or there is no
+	// source file).
+	AdvisoryLockOff AdvisoryLockStatus = iota
+
+	// AdvisoryLockHeld: this Garland holds the lock.
+	AdvisoryLockHeld
+
+	// AdvisoryLockBusy: another holder has the lock; saving over the
+	// source is refused until it is released.
+	AdvisoryLockBusy
+
+	// AdvisoryLockUnsupported: the filesystem or platform cannot lock;
+	// saves are not guarded.
+	AdvisoryLockUnsupported
+)
+
+// advisoryLockState tracks the lock for one garland.
+type advisoryLockState struct {
+	fs     FileSystemInterface
+	path   string
+	handle FileHandle // open while the lock is held
+	status AdvisoryLockStatus
+}
+
+func (fs *localFileSystem) LockFile(handle FileHandle) error {
+	h, ok := handle.(*localFileHandle)
+	if !ok {
+		return ErrFileNotOpen
+	}
+	return lockLocalFile(h.file)
+}
+
+func (fs *localFileSystem) UnlockFile(handle FileHandle) error {
+	h, ok := handle.(*localFileHandle)
+	if !ok {
+		return ErrFileNotOpen
+	}
+	return unlockLocalFile(h.file)
+}
+
+// initAdvisoryLockLocked enables the lock for the current source and
+// makes the first attempt. Caller must hold the write lock (or own the
+// unpublished garland).
+func (g *Garland) initAdvisoryLockLocked() {
+	fs := g.sourceFS
+	if fs == nil {
+		fs = g.lib.defaultFS
+	}
+	g.advisory = &advisoryLockState{fs: fs, path: g.sourcePath}
+	g.tryAdvisoryLockLocked()
+}
+
+// tryAdvisoryLockLocked attempts to take the lock if it is not held.
+func (g *Garland) tryAdvisoryLockLocked() {
+	al := g.advisory
+	if al == nil || al.status == AdvisoryLockHeld || al.status == AdvisoryLockUnsupported {
+		return
+	}
+	locker, ok := al.fs.(FileLocker)
+	if !ok {
+		al.status = AdvisoryLockUnsupported
+		return
+	}
+	h, err := al.fs.Open(al.path, OpenModeRead)
+	if err != nil {
+		al.status = AdvisoryLockBusy // cannot even open: treat as not ours
+		return
+	}
+	switch err := locker.LockFile(h); err {
+	case nil:
+		al.handle = h
+		al.status = AdvisoryLockHeld
+		return
+	case ErrNotSupported:
+		al.status = AdvisoryLockUnsupported
+	default:
+		al.status = AdvisoryLockBusy
+	}
+	al.fs.Close(h)
+}
+
+// releaseAdvisoryLockLocked drops the lock (Close, or a source switch).
+func (g *Garland) releaseAdvisoryLockLocked() {
+	al := g.advisory
+	if al == nil || al.handle == nil {
+		return
+	}
+	if locker, ok := al.fs.(FileLocker); ok {
+		locker.UnlockFile(al.handle)
+	}
+	al.fs.Close(al.handle)
+	al.handle = nil
+	al.status = AdvisoryLockOff
+}
+
+// retargetAdvisoryLockLocked moves the lock to a new source file.
+func (g *Garland) retargetAdvisoryLockLocked(fs FileSystemInterface, path string) {
+	if g.advisory == nil {
+		return
+	}
+	g.releaseAdvisoryLockLocked()
+	g.advisory = &advisoryLockState{fs: fs, path: path}
+	g.tryAdvisoryLockLocked()
+}
+
+// checkAdvisoryLockLocked guards a save over the source: it retries
+// the lock and refuses while another holder has it.
+func (g *Garland) checkAdvisoryLockLocked() error {
+	g.tryAdvisoryLockLocked()
+	if g.advisory != nil && g.advisory.status == AdvisoryLockBusy {
+		return ErrFileLocked
+	}
+	return nil
+}
+
+// AdvisoryLockStatus reports whether this Garland holds the advisory
+// lock on its source (FileOptions.AdvisoryLock).
+func (g *Garland) AdvisoryLockStatus() AdvisoryLockStatus {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.advisory == nil {
+		return AdvisoryLockOff
+	}
+	return g.advisory.status
+}
+
+// RetryAdvisoryLock tries again to take a lock another holder had, and
+// returns the resulting status.
+func (g *Garland) RetryAdvisoryLock() AdvisoryLockStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.advisory == nil {
+		return AdvisoryLockOff
+	}
+	g.tryAdvisoryLockLocked()
+	return g.advisory.status
+}
@@ -0,0 +1,49 @@
+//go:build unix || windows
+
+package garland
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdvisoryLockGuardsSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	if err := os.WriteFile(path, []byte("shared file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lib, _ := Init(LibraryOptions{})
+
+	first, err := lib.Open(FileOptions{FilePath: path, AdvisoryLock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := first.AdvisoryLockStatus(); st != AdvisoryLockHeld {
+		t.Fatalf("first: status %v, want held", st)
+	}
+
+	second, err := lib.Open(FileOptions{FilePath: path, AdvisoryLock: true})
+	if err != nil {
+		t.Fatalf("a locked file must still open: %v", err)
+	}
+	defer second.Close()
+	if st := second.AdvisoryLockStatus(); st != AdvisoryLockBusy {
+		t.Fatalf("second: status %v, want busy", st)
+	}
+	second.NewCursor().InsertString("second: ", nil, true)
+	if _, err := second.Save(); err != ErrFileLocked {
+		t.Fatalf("Save over a locked source: err = %v, want ErrFileLocked", err)
+	}
+
+	first.Close()
+	if st := second.RetryAdvisoryLock(); st != AdvisoryLockHeld {
+		t.Fatalf("after release: status %v, want held", st)
+	}
+	if _, err := second.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second: shared file\n" {
+		t.Errorf("file = %q", data)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package garland
+
+import "os"
+
+// lockLocalFile reports ErrNotSupported on platforms without an
+// advisory lock primitive (wasm, plan9); AdvisoryLock then degrades to
+// AdvisoryLockUnsupported.
+func lockLocalFile(f *os.File) error {
+	return ErrNotSupported
+}
+
+// unlockLocalFile is the no-op counterpart of lockLocalFile.
+func unlockLocalFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package garland
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockLocalFile takes a non-blocking exclusive flock on f. flock locks
+// belong to the open file description, so a second open of the same
+// file - in this process or another - is refused while it is held.
+func lockLocalFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrFileLocked
+	}
+	return err
+}
+
+// unlockLocalFile releases a lock taken by lockLocalFile.
+func unlockLocalFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
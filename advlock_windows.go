@@ -0,0 +1,48 @@
+//go:build windows
+
+package garland
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// lockLocalFile takes a non-blocking exclusive LockFileEx lock on the
+// first byte range of f (the whole addressable range), which other
+// handles - in this process or another - cannot take while it is held.
+func lockLocalFile(f *os.File) error {
+	var ol syscall.Overlapped
+	r1, _, err := procLockFileEx.Call(f.Fd(),
+		lockfileExclusiveLock|lockfileFailImmediately, 0,
+		0xffffffff, 0xffffffff, uintptr(unsafe.Pointer(&ol)))
+	if r1 != 0 {
+		return nil
+	}
+	if err == errorLockViolation {
+		return ErrFileLocked
+	}
+	return err
+}
+
+// unlockLocalFile releases a lock taken by lockLocalFile.
+func unlockLocalFile(f *os.File) error {
+	var ol syscall.Overlapped
+	r1, _, err := procUnlockFileEx.Call(f.Fd(), 0,
+		0xffffffff, 0xffffffff, uintptr(unsafe.Pointer(&ol)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
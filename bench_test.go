@@ -1,11 +1,13 @@
 package garland
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"os"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 // Benchmarks for the editing hot paths, focused on the "huge file, lots
@@ -34,7 +36,8 @@ func openBench(b *testing.B, size int) (*Garland, *Cursor) {
 }
 
 // benchTyping simulates a typing burst: one-character inserts at an
-// advancing cursor, all in one spot of the document.
+// advancing cursor, all in one spot of the document. After the first
+// keystroke each one appends to the streak's own leaf (typing_leaf.go).
 func benchTyping(b *testing.B, size int) {
 	g, c := openBench(b, size)
 	if err := c.SeekByte(int64(size / 2)); err != nil {
@@ -55,6 +58,26 @@ func BenchmarkTyping1MB(b *testing.B)   { benchTyping(b, 1<<20) }
 func BenchmarkTyping10MB(b *testing.B)  { benchTyping(b, 10<<20) }
 func BenchmarkTyping100MB(b *testing.B) { benchTyping(b, 100<<20) }
 
+// benchSequentialReads: a cursor reading the document 16 bytes at a
+// time, as a scanner or a terminal paging through it would. Mostly
+// served from the cursor's leaf hint (leaf_hint.go).
+func benchSequentialReads(b *testing.B, size int) {
+	_, c := openBench(b, size)
+	b.SetBytes(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if c.BytePos()+16 > int64(size) {
+			c.SeekByte(0)
+		}
+		if _, err := c.ReadBytes(16); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSequentialReads10MB(b *testing.B) { benchSequentialReads(b, 10<<20) }
+
 // benchScatteredEdits: one-character inserts at random positions -
 // worst case for locality.
 func benchScatteredEdits(b *testing.B, size int) {
@@ -153,3 +176,101 @@ func TestEditScaling(t *testing.T) {
 }
 
 func nowNano() int64 { return time.Now().UnixNano() }
+
+// benchParallelReads: goroutines reading random 4KB windows of one
+// resident document. Resident reads share the lock (sharedread.go), so
+// ns/op should fall as -cpu rises, e.g.
+//
+//	go test -bench ParallelReads -cpu 1,2,4,8
+func benchParallelReads(b *testing.B, size int) {
+	g, _ := openBench(b, size)
+	b.SetBytes(4096)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			// readBytesAt directly: a cursor seek per read would make
+			// this a benchmark of position bookkeeping.
+			if _, err := g.readBytesAt(rng.Int63n(int64(size-4096)), 4096); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkParallelReads10MB(b *testing.B) { benchParallelReads(b, 10<<20) }
+
+// BenchmarkParallelSearch: goroutines each counting a needle over a 1MB
+// document; searches scan under the shared lock too.
+func BenchmarkParallelSearch1MB(b *testing.B) {
+	g, _ := openBench(b, 1<<20)
+	b.SetBytes(1 << 20)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		c := g.NewEphemeralCursor()
+		for pb.Next() {
+			if _, err := c.CountString("lazy dog", SearchOptions{CaseSensitive: true}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// Counting kernels (count_kernels.go) against the loops they replaced,
+// over 1MB: ASCII text, and text with a non-ASCII rune on every line.
+// The 1GB workload is this times a thousand, e.g.
+//
+//	go test -bench 'Count(Runes|Newlines|Leaf)' -run XXX
+func countingDoc(nonASCII bool) []byte {
+	doc := []byte(makeDoc(1 << 20))
+	if nonASCII {
+		doc = bytes.ReplaceAll(doc, []byte("fox"), []byte("fö"))
+	}
+	return doc
+}
+
+var countSink int64
+
+func benchCount(b *testing.B, nonASCII bool, count func([]byte) int64) {
+	doc := countingDoc(nonASCII)
+	b.SetBytes(int64(len(doc)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		countSink += count(doc)
+	}
+}
+
+func naiveRunes(data []byte) int64 { return int64(len([]rune(string(data)))) }
+
+func naiveNewlines(data []byte) int64 {
+	n := int64(0)
+	for _, c := range data {
+		if c == '\n' {
+			n++
+		}
+	}
+	return n
+}
+
+func utf8Runes(data []byte) int64 { return int64(utf8.RuneCount(data)) }
+
+func BenchmarkCountRunesNaive(b *testing.B)       { benchCount(b, false, naiveRunes) }
+func BenchmarkCountRunesUTF8(b *testing.B)        { benchCount(b, false, utf8Runes) }
+func BenchmarkCountRunesKernel(b *testing.B)      { benchCount(b, false, countRunes) }
+func BenchmarkCountRunesUTF8Mixed(b *testing.B)   { benchCount(b, true, utf8Runes) }
+func BenchmarkCountRunesKernelMixed(b *testing.B) { benchCount(b, true, countRunes) }
+func BenchmarkCountNewlinesNaive(b *testing.B)    { benchCount(b, false, naiveNewlines) }
+func BenchmarkCountNewlinesKernel(b *testing.B)   { benchCount(b, false, countNewlines) }
+
+// BenchmarkCountLeaf: indexing 128KB leaves, the per-leaf cost of
+// opening a file eagerly.
+func BenchmarkCountLeaf(b *testing.B) {
+	doc := countingDoc(false)[:128<<10]
+	b.SetBytes(int64(len(doc)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		snap := &NodeSnapshot{data: doc}
+		snap.indexCounts()
+		countSink += snap.runeCount
+	}
+}
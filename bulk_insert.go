@@ -0,0 +1,308 @@
+package garland
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// bulk_insert.go - streaming bulk insertion for generators and importers.
+//
+// DESIGN: InsertBytes is built for edits. Handed one giant []byte it
+// counts the whole slice's runes and lines up front, then lands it in
+// a single oversized leaf; a caller feeding it in pieces instead gets a
+// revision (and an undo step) per piece. InsertFromReader and
+// AppendBulk ingest an io.Reader the way the initial load does:
+//
+//   - The reader is consumed in leaf-sized chunks (targetLeafSize, split
+//     on rune boundaries) BEFORE the lock is taken, so a slow producer
+//     never stalls readers of the document. Each chunk becomes its own
+//     leaf, and its rune and line counts are the leaf's own index -
+//     computed once per chunk, summed for the totals.
+//   - The chunks are paired into a balanced subtree that is spliced in
+//     at the insertion point: one mutation, one revision (or part of
+//     the enclosing transaction), never a coalescing run.
+//   - All or nothing: a read error inserts nothing.
+//
+// Insertion semantics otherwise match InsertBytes: insertBefore decides
+// which side of the new content marks and other cursors at the point
+// land on, and the inserting cursor ends after it.
+
+// InsertFromReader reads r to EOF and inserts everything it produced at
+// the cursor position as one revision, in leaf-sized pieces. Returns
+// the number of bytes inserted. If insertBefore is true, insertion
+// occurs before any existing cursors/decorations at this position;
+// otherwise after. The cursor advances to the end of the inserted
+// content. On a read error nothing is inserted.
+func (c *Cursor) InsertFromReader(r io.Reader, insertBefore bool) (int64, ChangeResult, error) {
+	if c.detached() {
+		return 0, ChangeResult{}, ErrCursorNotFound
+	}
+	pad, _ := c.virtualPad(nil)
+	leaves, n, err := c.garland.readBulkLeaves(io.MultiReader(bytes.NewReader([]byte(pad)), r))
+	if err != nil {
+		return 0, ChangeResult{}, err
+	}
+	var pos int64
+	at := func() int64 { pos = c.bytePos; return pos } // under the lock, after the reading
+	result, err := c.garland.insertLeavesAt(c, at, leaves, n, insertBefore)
+	if err != nil {
+		return 0, result, err
+	}
+	c.SeekByte(pos + n)
+	return n, result, nil
+}
+
+// AppendBulk reads r to EOF and appends everything it produced to the
+// end of the document as one revision, as InsertFromReader does. It
+// waits for a streaming load to finish first, so the end is the real
+// end. Cursors and marks at the end stay before the appended content.
+func (g *Garland) AppendBulk(r io.Reader) (int64, ChangeResult, error) {
+	if err := eofIsFine(g.waitForBytePosition(context.Background(), math.MaxInt64, -1)); err != nil {
+		return 0, ChangeResult{}, err
+	}
+	leaves, n, err := g.readBulkLeaves(r)
+	if err != nil {
+		return 0, ChangeResult{}, err
+	}
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+	c.SetMode(CursorModeProcess)
+	result, err := g.insertLeavesAt(c, func() int64 { return g.totalBytes }, leaves, n, false)
+	if err != nil {
+		return 0, result, err
+	}
+	return n, result, nil
+}
+
+// readBulkLeaves reads r to EOF into leaf snapshots of at most
+// targetLeafSize bytes each (a chunk ending inside a UTF-8 sequence
+// carries it over to the next), returning them and their total size.
+// Called without the lock.
+func (g *Garland) readBulkLeaves(r io.Reader) ([]*NodeSnapshot, int64, error) {
+	size := max(g.targetLeafSize, utf8.UTFMax)
+	var leaves []*NodeSnapshot
+	var total int64
+	var carry []byte
+	for {
+		buf := make([]byte, size)
+		k := copy(buf, carry)
+		m, err := io.ReadFull(r, buf[k:])
+		buf = buf[:k+m]
+		done := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !done {
+			return nil, 0, err
+		}
+		carry = nil
+		if !done {
+			if tail := incompleteRuneTail(buf); tail < len(buf) {
+				carry = append(carry, buf[len(buf)-tail:]...)
+				buf = buf[: len(buf)-tail : len(buf)-tail]
+			}
+		}
+		if len(buf) > 0 {
+			leaves = append(leaves, createLeafSnapshot(buf, nil, -1))
+			total += int64(len(buf))
+		}
+		if done {
+			return leaves, total, nil
+		}
+	}
+}
+
+// incompleteRuneTail returns how many trailing bytes of b begin a UTF-8
+// sequence that b does not finish.
+func incompleteRuneTail(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return 0
+			}
+			return len(b) - i
+		}
+	}
+	return 0
+}
+
+// insertLeavesAt splices leaves (n bytes in all) into the tree at the
+// position at returns under the lock, as one mutation.
+func (g *Garland) insertLeavesAt(c *Cursor, at func() int64, leaves []*NodeSnapshot, n int64, insertBefore bool) (ChangeResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c.removed.Load() {
+		return ChangeResult{}, ErrCursorNotFound // removed while the op waited for the lock
+	}
+	if len(leaves) == 0 {
+		return ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}, nil
+	}
+
+	pos := at()
+	if pos < 0 || pos > g.totalBytes {
+		return ChangeResult{}, ErrInvalidPosition
+	}
+	if err := c.editableLocked(pos, pos); err != nil {
+		return ChangeResult{}, err
+	}
+	if g.recorder != nil {
+		data := make([]byte, 0, n)
+		for _, leaf := range leaves {
+			data = append(data, leaf.data...)
+		}
+		defer g.noteOpLocked(ReplayRecord{Op: replayInsert, Pos: pos, Data: data, Before: insertBefore})()
+	}
+
+	if g.transaction == nil {
+		g.recordCursorPositionsInHistory()
+	}
+
+	rootSnap := g.root.snapshotAt(g.currentFork, g.currentRevision)
+	if rootSnap == nil {
+		return ChangeResult{}, ErrInvalidPosition
+	}
+	newRootID, err := g.insertLeavesInternal(g.root, rootSnap, pos, 0, leaves, n, insertBefore)
+	if err != nil {
+		return ChangeResult{}, err
+	}
+	g.root = g.nodeRegistry[newRootID]
+
+	var insertedRunes, insertedLines int64
+	for _, leaf := range leaves {
+		insertedRunes += leaf.runeCount
+		insertedLines += leaf.lineCount
+	}
+	g.totalBytes += n
+	g.totalRunes += insertedRunes
+	g.totalLines += insertedLines
+
+	for _, cursor := range g.cursors {
+		if cursor != c && cursor.bytePos >= pos {
+			cursor.adjustForMutation(pos, n, insertedRunes, insertedLines, insertBefore)
+		}
+	}
+	g.shiftEphemeralLocked(pos, 0, n, insertBefore)
+	if g.journal != nil {
+		data := make([][]byte, len(leaves))
+		for i, leaf := range leaves {
+			data[i] = leaf.data
+		}
+		g.journalSpliceLocked(pos, 0, data...)
+	}
+
+	return g.recordMutation(), nil
+}
+
+// insertLeavesInternal navigates to the insertion point as
+// insertInternal does and rebuilds the path with the leaves spliced in.
+func (g *Garland) insertLeavesInternal(node *Node, snap *NodeSnapshot, insertPos, offset int64, leaves []*NodeSnapshot, n int64, insertBefore bool) (NodeID, error) {
+	if snap.isLeaf {
+		if err := g.ensureLeafDataResident(node, snap); err != nil {
+			return 0, err
+		}
+		return g.spliceLeavesIntoLeaf(snap, insertPos-offset, offset, leaves, n, insertBefore)
+	}
+
+	leftNode := g.nodeRegistry[snap.leftID]
+	if leftNode == nil {
+		return 0, ErrInvalidPosition
+	}
+	leftSnap := leftNode.snapshotAt(g.currentFork, g.currentRevision)
+	if leftSnap == nil {
+		return 0, ErrInvalidPosition
+	}
+	leftEnd := offset + leftSnap.byteCount
+
+	if insertPos < leftEnd || (insertPos == leftEnd && insertBefore && !g.leftGravityAtStart(snap.rightID)) {
+		newLeftID, err := g.insertLeavesInternal(leftNode, leftSnap, insertPos, offset, leaves, n, insertBefore)
+		if err != nil {
+			return 0, err
+		}
+		return g.concatenate(newLeftID, snap.rightID)
+	}
+
+	rightNode := g.nodeRegistry[snap.rightID]
+	if rightNode == nil {
+		return 0, ErrInvalidPosition
+	}
+	rightSnap := rightNode.snapshotAt(g.currentFork, g.currentRevision)
+	if rightSnap == nil {
+		return 0, ErrInvalidPosition
+	}
+	newRightID, err := g.insertLeavesInternal(rightNode, rightSnap, insertPos, leftEnd, leaves, n, insertBefore)
+	if err != nil {
+		return 0, err
+	}
+	return g.concatenate(snap.leftID, newRightID)
+}
+
+// spliceLeavesIntoLeaf splits a leaf at localPos and joins the halves
+// around a balanced subtree of the new leaves. Boundary marks home into
+// the first new leaf at offset 0, as insertIntoLeaf homes them into its
+// middle leaf.
+func (g *Garland) spliceLeavesIntoLeaf(snap *NodeSnapshot, localPos, absoluteOffset int64, leaves []*NodeSnapshot, n int64, insertBefore bool) (NodeID, error) {
+	splitPos := min(max(localPos, 0), int64(len(snap.data)))
+	leftData := snap.data[:splitPos]
+	rightData := snap.data[splitPos:]
+	leftDecs, boundaryDecs, rightDecs := partitionDecorations(snap.decorations, splitPos, insertBefore)
+	if len(boundaryDecs) > 0 {
+		leaves[0] = createLeafSnapshot(leaves[0].data, boundaryDecs, -1)
+	}
+
+	var leftID, rightID NodeID
+	if len(leftData) > 0 || len(leftDecs) > 0 {
+		leftID = g.newLeafLocked(createLeafSnapshot(leftData, leftDecs, -1), absoluteOffset)
+	}
+	middleOffset := absoluteOffset + int64(len(leftData))
+	middleID, err := g.buildLeafSubtree(leaves, middleOffset)
+	if err != nil {
+		return 0, err
+	}
+	if len(rightData) > 0 || len(rightDecs) > 0 {
+		rightID = g.newLeafLocked(createLeafSnapshot(rightData, rightDecs, -1), middleOffset+n)
+	}
+
+	resultID := middleID
+	if leftID != 0 {
+		if resultID, err = g.concatenate(leftID, resultID); err != nil {
+			return 0, err
+		}
+	}
+	if rightID != 0 {
+		return g.concatenate(resultID, rightID)
+	}
+	return resultID, nil
+}
+
+// buildLeafSubtree pairs leaves into a balanced subtree of fresh nodes
+// at the current revision; offset is where the first leaf starts.
+func (g *Garland) buildLeafSubtree(leaves []*NodeSnapshot, offset int64) (NodeID, error) {
+	if len(leaves) == 1 {
+		return g.newLeafLocked(leaves[0], offset), nil
+	}
+	mid := len(leaves) / 2
+	leftID, err := g.buildLeafSubtree(leaves[:mid], offset)
+	if err != nil {
+		return 0, err
+	}
+	for _, leaf := range leaves[:mid] {
+		offset += leaf.byteCount
+	}
+	rightID, err := g.buildLeafSubtree(leaves[mid:], offset)
+	if err != nil {
+		return 0, err
+	}
+	return g.concatenate(leftID, rightID)
+}
+
+// newLeafLocked registers a leaf node holding snap at the current
+// revision and indexes its decorations at offset.
+func (g *Garland) newLeafLocked(snap *NodeSnapshot, offset int64) NodeID {
+	g.nextNodeID++
+	g.nodeManipulations++
+	node := newNode(g.nextNodeID, g)
+	g.nodeRegistry[node.id] = node
+	node.setSnapshot(g.currentFork, g.currentRevision, snap)
+	g.updateDecorationCacheForNode(node.id, offset, snap.decorations)
+	return node.id
+}
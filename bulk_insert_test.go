@@ -0,0 +1,139 @@
+package garland
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestInsertFromReader(t *testing.T) {
+	for _, before := range []bool{false, true} {
+		lib, _ := Init(LibraryOptions{})
+		g, _ := lib.Open(FileOptions{DataString: "0123456789abcdef", MaxLeafSize: 16})
+		at := ByteAddress(8)
+		g.Decorate([]DecorationEntry{
+			{Key: "default", Address: &at},
+			{Key: "left", Address: &at, Gravity: GravityLeft},
+			{Key: "right", Address: &at, Gravity: GravityRight},
+		})
+		other := g.NewCursor()
+		other.SeekByte(8)
+
+		// Multi-byte runes straddle the 8-byte chunks.
+		bulk := strings.Repeat("héllo wörld ✓\n", 50)
+		rev := g.CurrentRevision()
+		c := g.NewCursor()
+		c.SeekByte(8)
+		n, result, err := c.InsertFromReader(strings.NewReader(bulk), before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(bulk)) || result.Revision != rev+1 {
+			t.Errorf("insertBefore %v: inserted %d bytes at revision %d, want %d at %d", before, n, result.Revision, len(bulk), rev+1)
+		}
+		if got, want := readAll(t, g), "01234567"+bulk+"89abcdef"; got != want {
+			t.Fatalf("insertBefore %v: content %q", before, got)
+		}
+		if got := g.RuneCount().Value; got != int64(utf8.RuneCountInString(bulk))+16 {
+			t.Errorf("insertBefore %v: %d runes", before, got)
+		}
+		if got := g.LineCount().Value; got != 50 {
+			t.Errorf("insertBefore %v: %d lines", before, got)
+		}
+		if c.BytePos() != 8+n {
+			t.Errorf("insertBefore %v: cursor at %d, want %d", before, c.BytePos(), 8+n)
+		}
+
+		wantOther, wantDefault := int64(8), int64(8)
+		if before {
+			wantOther, wantDefault = 8+n, 8+n
+		}
+		if other.BytePos() != wantOther {
+			t.Errorf("insertBefore %v: other cursor at %d, want %d", before, other.BytePos(), wantOther)
+		}
+		for key, want := range map[string]int64{"default": wantDefault, "left": 8, "right": 8 + n} {
+			if got := decorationAt(t, g, key); got != want {
+				t.Errorf("insertBefore %v: %s at %d, want %d", before, key, got, want)
+			}
+		}
+		if v := g.CheckInvariants(); v != nil {
+			t.Errorf("insertBefore %v: %v", before, v)
+		}
+
+		// One revision: a single undo removes it all.
+		if err := g.UndoSeek(rev); err != nil {
+			t.Fatal(err)
+		}
+		if got := readAll(t, g); got != "0123456789abcdef" {
+			t.Errorf("insertBefore %v: after undo %q", before, got)
+		}
+		g.Close()
+	}
+}
+
+type failingReader struct{ n int }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("disk on fire")
+	}
+	k := min(len(p), r.n)
+	for i := range p[:k] {
+		p[i] = 'x'
+	}
+	r.n -= k
+	return k, nil
+}
+
+func TestInsertFromReaderError(t *testing.T) {
+	g, c := newTestGarland(t, "hello")
+	defer g.Close()
+	rev := g.CurrentRevision()
+	if _, _, err := c.InsertFromReader(&failingReader{n: 100000}, false); err == nil {
+		t.Fatal("read error not reported")
+	}
+	if got := readAll(t, g); got != "hello" || g.CurrentRevision() != rev {
+		t.Errorf("failed insert left %q at revision %d", got, g.CurrentRevision())
+	}
+}
+
+func TestAppendBulk(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "head\n", MaxLeafSize: 32})
+	defer g.Close()
+	c := g.NewCursor()
+	c.SeekByte(5)
+
+	var want strings.Builder
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < 1000; i++ {
+			line := strings.Repeat("z", i%40) + "\n"
+			want.WriteString(line)
+			pw.Write([]byte(line))
+		}
+		pw.Close()
+	}()
+	rev := g.CurrentRevision()
+	n, result, err := g.AppendBulk(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(want.Len()) || result.Revision != rev+1 {
+		t.Errorf("appended %d bytes at revision %d, want %d at %d", n, result.Revision, want.Len(), rev+1)
+	}
+	if got := readAll(t, g); got != "head\n"+want.String() {
+		t.Error("appended content differs")
+	}
+	if got := g.LineCount().Value; got != 1001 {
+		t.Errorf("%d lines, want 1001", got)
+	}
+	if c.BytePos() != 5 {
+		t.Errorf("cursor at the old end moved to %d", c.BytePos())
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Error(v)
+	}
+}
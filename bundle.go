@@ -0,0 +1,658 @@
+package garland
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"sort"
+	"time"
+)
+
+// bundle.go - a whole editing session in one archive.
+//
+// DESIGN: "send me your editing session" and durable persistence both
+// need more than the text: the undo history with its forks, the
+// decorations as they stood at each revision, the cursors. A bundle is
+// a tar stream of these members, in this order:
+//
+//	manifest.json   format, version, source path, fork table, current
+//	                fork/revision, and size + CRC-32 of the base and
+//	                current texts
+//	content         the base text (absent when the bundle references
+//	                the source file instead)
+//	history.jsonl   one revision per line, in the order import replays
+//	                them
+//	cursors.json    the registered cursors, as MarshalState documents
+//
+// The BASE is the oldest revision of fork 0 still held. Every other
+// revision is stored as the OT operation (ot.go) from the nearest held
+// revision before it in its lineage - earlier in its own fork, or back
+// through its branch point into the parent - so a revision costs what
+// its edit touched. A revision's decorations are stored only when they
+// differ from that predecessor's.
+//
+// ImportBundle opens the base and replays the history in order: fork
+// by fork in ID order (a parent is always older than its children),
+// each fork branched off its parent at its branch revision, each
+// revision applied as one transaction carrying its name. Fork IDs and
+// revision numbers therefore come out as they were. Then the pruning
+// watermarks and soft deletions are re-applied, the current fork and
+// revision restored, the cursors recreated, and the resulting text
+// checked against the manifest's CRC.
+//
+//   - Revisions the garland no longer held (pruned, or data of deleted
+//     forks nothing depended on) are replayed as empty placeholders to
+//     keep the numbering, and pruned or deleted again afterwards.
+//   - HasChanges is recomputed by the replay; cursor position history
+//     and undo-coalescing state are not carried.
+//   - ExportBundleReferencingSource leaves the base text out and records
+//     the source path instead. It is refused with ErrBundleSourceMismatch
+//     unless the file holds exactly the base text - true for a session
+//     whose history reaches back to the open - and ImportBundle checks
+//     the same before using it, opening the file as the new garland's
+//     source.
+//   - Export reads a consistent state under the lock, so it is refused
+//     during a transaction or a streaming load; the base text and the
+//     history are held in memory while the archive is written.
+
+// bundleFormat identifies a bundle manifest.
+const bundleFormat = "garland-bundle"
+
+// BundleVersion is the version ExportBundle writes and the newest
+// ImportBundle reads.
+const BundleVersion = 1
+
+// Bundle member names.
+const (
+	bundleManifest = "manifest.json"
+	bundleContent  = "content"
+	bundleHistory  = "history.jsonl"
+	bundleCursors  = "cursors.json"
+)
+
+// BundleManifest is the manifest.json member of a bundle.
+type BundleManifest struct {
+	Format          string       `json:"format"`
+	Version         int          `json:"version"`
+	Created         time.Time    `json:"created"`
+	SourcePath      string       `json:"sourcePath,omitempty"`
+	ReferenceSource bool         `json:"referenceSource,omitempty"` // base text is the file at SourcePath
+	BaseBytes       int64        `json:"baseBytes"`
+	BaseCRC         uint32       `json:"baseCRC"`
+	CurrentFork     ForkID       `json:"currentFork"`
+	CurrentRevision RevisionID   `json:"currentRevision"`
+	CurrentBytes    int64        `json:"currentBytes"`
+	CurrentCRC      uint32       `json:"currentCRC"`
+	Forks           []BundleFork `json:"forks"`
+}
+
+// BundleFork is one fork of a bundle's history.
+type BundleFork struct {
+	ID              ForkID     `json:"id"`
+	ParentFork      ForkID     `json:"parentFork"`
+	ParentRevision  RevisionID `json:"parentRevision"`
+	HighestRevision RevisionID `json:"highestRevision"`
+	PrunedUpTo      RevisionID `json:"prunedUpTo,omitempty"`
+	Deleted         bool       `json:"deleted,omitempty"`
+}
+
+// BundleRevision is one line of a bundle's history.
+type BundleRevision struct {
+	Fork        ForkID          `json:"fork"`
+	Revision    RevisionID      `json:"revision"`
+	Name        string          `json:"name,omitempty"`
+	Placeholder bool            `json:"placeholder,omitempty"` // no longer held when exported
+	Ops         *OTOperation    `json:"ops,omitempty"`
+	Decorations json.RawMessage `json:"decorations,omitempty"` // a DecorationDump
+}
+
+// bundleExport is everything ExportBundle gathers under the lock.
+type bundleExport struct {
+	manifest BundleManifest
+	base     []byte
+	history  []BundleRevision
+	cursors  []CursorState
+}
+
+// ExportBundle writes the whole session - text, history, decorations
+// and cursors - to w as a bundle.
+func (g *Garland) ExportBundle(w io.Writer) error {
+	ex, err := g.gatherBundle()
+	if err != nil {
+		return err
+	}
+	return writeBundle(w, ex)
+}
+
+// ExportBundleReferencingSource writes a bundle that refers to the
+// source file for its base text instead of carrying it. Returns
+// ErrNoDataSource without a source, ErrBundleSourceMismatch if the file
+// does not hold the base text.
+func (g *Garland) ExportBundleReferencingSource(w io.Writer) error {
+	g.mu.RLock()
+	path, fs := g.sourcePath, g.sourceFS
+	g.mu.RUnlock()
+	if path == "" {
+		return ErrNoDataSource
+	}
+	if fs == nil {
+		fs = g.lib.defaultFS
+	}
+	ex, err := g.gatherBundle()
+	if err != nil {
+		return err
+	}
+	n, crc, err := fileCRC(fs, path)
+	if err != nil {
+		return err
+	}
+	if n != ex.manifest.BaseBytes || crc != ex.manifest.BaseCRC {
+		return ErrBundleSourceMismatch
+	}
+	ex.manifest.ReferenceSource = true
+	ex.base = nil
+	return writeBundle(w, ex)
+}
+
+// fileCRC streams a file and returns its length and CRC-32.
+func fileCRC(fs FileSystemInterface, path string) (int64, uint32, error) {
+	handle, err := fs.Open(path, OpenModeRead)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fs.Close(handle)
+	if err := fs.SeekByte(handle, 0); err != nil {
+		return 0, 0, err
+	}
+	var n int64
+	crc := crc32.NewIEEE()
+	for {
+		data, err := fs.ReadBytes(handle, 128<<10)
+		crc.Write(data)
+		n += int64(len(data))
+		if err == io.EOF || fs.IsEOF(handle) {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(data) == 0 {
+			break
+		}
+	}
+	return n, crc.Sum32(), nil
+}
+
+// heldStateLocked returns revision rev of fork f as a tree state if the
+// garland still holds it. Caller must hold g.mu.
+func (g *Garland) heldStateLocked(f ForkID, rev RevisionID) (treeState, bool) {
+	info := g.revisionInfo[ForkRevision{f, rev}]
+	if info == nil {
+		return treeState{}, false
+	}
+	st := treeState{root: g.nodeRegistry[info.RootID], fork: f, rev: rev}
+	return st, st.rootSnap() != nil
+}
+
+// gatherBundle collects a consistent export under the lock.
+func (g *Garland) gatherBundle() (*bundleExport, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.transaction != nil {
+		return nil, ErrTransactionPending
+	}
+	if g.loader != nil && !g.loader.eofReached {
+		return nil, ErrNotReady
+	}
+
+	ex := &bundleExport{manifest: BundleManifest{
+		Format:          bundleFormat,
+		Version:         BundleVersion,
+		Created:         time.Now().UTC(),
+		SourcePath:      g.sourcePath,
+		CurrentFork:     g.currentFork,
+		CurrentRevision: g.currentRevision,
+	}}
+	for id := ForkID(0); id <= g.nextForkID; id++ {
+		f := g.forks[id]
+		if f == nil {
+			return nil, ErrInternal
+		}
+		ex.manifest.Forks = append(ex.manifest.Forks, BundleFork{
+			ID: f.ID, ParentFork: f.ParentFork, ParentRevision: f.ParentRevision,
+			HighestRevision: f.HighestRevision, PrunedUpTo: f.PrunedUpTo, Deleted: f.Deleted,
+		})
+	}
+
+	// The base: fork 0's oldest held revision.
+	root := g.forks[0]
+	base, baseRev, found := treeState{}, RevisionID(0), false
+	for rev := RevisionID(0); rev <= root.HighestRevision && !found; rev++ {
+		base, found = g.heldStateLocked(0, rev)
+		baseRev = rev
+	}
+	if !found {
+		return nil, ErrInternal
+	}
+	if err := g.withStateLocked(base, func() error {
+		var err error
+		ex.base, err = g.readThawingLocked(0, g.totalBytes)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	ex.manifest.BaseBytes = int64(len(ex.base))
+	ex.manifest.BaseCRC = crc32.ChecksumIEEE(ex.base)
+
+	// from finds the nearest held revision before (f, rev) in its
+	// lineage; the base stands in for anything older.
+	from := func(f ForkID, rev RevisionID) treeState {
+		for {
+			fi := g.forks[f]
+			switch {
+			case f != 0 && rev <= fi.ParentRevision+1:
+				f, rev = fi.ParentFork, fi.ParentRevision
+			case rev == 0 || (f == 0 && rev <= baseRev+1):
+				return base
+			default:
+				rev--
+			}
+			if f == 0 && rev <= baseRev {
+				return base
+			}
+			if st, ok := g.heldStateLocked(f, rev); ok {
+				return st
+			}
+		}
+	}
+
+	baseDecorations, err := g.decorationsAtLocked(base)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range ex.manifest.Forks {
+		first := f.ParentRevision + 1
+		if f.ID == 0 {
+			first = 1
+		}
+		for rev := first; rev <= f.HighestRevision; rev++ {
+			rec := BundleRevision{Fork: f.ID, Revision: rev}
+			st, held := g.heldStateLocked(f.ID, rev)
+			if f.ID == 0 && rev < baseRev || !held {
+				rec.Placeholder = true
+				ex.history = append(ex.history, rec)
+				continue
+			}
+			rec.Name = g.revisionInfo[ForkRevision{f.ID, rev}].Name
+			if f.ID == 0 && rev == baseRev {
+				// The base revision itself: no text change.
+				if rec.Decorations, err = bundleDecorations(baseDecorations, nil); err != nil {
+					return nil, err
+				}
+				ex.history = append(ex.history, rec)
+				continue
+			}
+			prev := from(f.ID, rev)
+			op, err := g.diffStatesLocked(prev, st)
+			if err != nil {
+				return nil, err
+			}
+			rec.Ops = &op
+			was, err := g.decorationsAtLocked(prev)
+			if err != nil {
+				return nil, err
+			}
+			now, err := g.decorationsAtLocked(st)
+			if err != nil {
+				return nil, err
+			}
+			if rec.Decorations, err = bundleDecorations(now, was); err != nil {
+				return nil, err
+			}
+			ex.history = append(ex.history, rec)
+		}
+	}
+	if baseRev == 0 {
+		// Revision 0 is the open itself: its decorations travel as the
+		// opening set (see importBundle), recorded on a leading line.
+		dump, err := bundleDecorations(baseDecorations, nil)
+		if err != nil {
+			return nil, err
+		}
+		ex.history = append([]BundleRevision{{Fork: 0, Revision: 0, Decorations: dump}}, ex.history...)
+	}
+
+	crc := crc32.NewIEEE()
+	for pos := int64(0); pos < g.totalBytes; pos += 128 << 10 {
+		data, err := g.readThawingLocked(pos, min(128<<10, g.totalBytes-pos))
+		if err != nil {
+			return nil, err
+		}
+		crc.Write(data)
+	}
+	ex.manifest.CurrentBytes = g.totalBytes
+	ex.manifest.CurrentCRC = crc.Sum32()
+
+	for _, c := range g.cursors {
+		ex.cursors = append(ex.cursors, c.stateLocked())
+	}
+	return ex, nil
+}
+
+// bundleDecorations renders now as a DecorationDump, or nil if it is
+// the same set as was (nil was: render unless empty).
+func bundleDecorations(now, was []DecorationEntry) (json.RawMessage, error) {
+	if sameDecorations(now, was) {
+		return nil, nil
+	}
+	data, err := marshalDecorationsJSON(now)
+	if err != nil {
+		return nil, err
+	}
+	return compactJSON(data)
+}
+
+// compactJSON strips insignificant whitespace, for one-line records.
+func compactJSON(data []byte) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sameDecorations reports whether two decoration sets are equal.
+func sameDecorations(a, b []DecorationEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]DecorationEntry(nil), a...), append([]DecorationEntry(nil), b...)
+	sort.Slice(a, func(i, j int) bool { return decorationLess(a[i], a[j]) })
+	sort.Slice(b, func(i, j int) bool { return decorationLess(b[i], b[j]) })
+	for i := range a {
+		if a[i].Key != b[i].Key || a[i].Namespace != b[i].Namespace ||
+			a[i].Address.Byte != b[i].Address.Byte || a[i].Gravity != b[i].Gravity {
+			return false
+		}
+	}
+	return true
+}
+
+// writeBundle writes the gathered export as a tar stream.
+func writeBundle(w io.Writer, ex *bundleExport) error {
+	tw := tar.NewWriter(w)
+	put := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: ex.manifest.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	manifest, err := json.MarshalIndent(ex.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := put(bundleManifest, manifest); err != nil {
+		return err
+	}
+	if !ex.manifest.ReferenceSource {
+		if err := put(bundleContent, ex.base); err != nil {
+			return err
+		}
+	}
+	var history bytes.Buffer
+	enc := json.NewEncoder(&history)
+	for _, rec := range ex.history {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	if err := put(bundleHistory, history.Bytes()); err != nil {
+		return err
+	}
+	cursors, err := json.MarshalIndent(ex.cursors, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := put(bundleCursors, cursors); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ImportBundle recreates a session from a bundle written by
+// ExportBundle. Returns ErrBundleFormat for a malformed bundle or one
+// from a newer version, ErrBundleSourceMismatch if a referenced source
+// file no longer holds the base text.
+func (lib *Library) ImportBundle(r io.Reader) (*Garland, error) {
+	tr := tar.NewReader(r)
+	next := func(name string) ([]byte, error) {
+		hdr, err := tr.Next()
+		if err != nil || hdr.Name != name {
+			return nil, ErrBundleFormat
+		}
+		return io.ReadAll(tr)
+	}
+
+	data, err := next(bundleManifest)
+	if err != nil {
+		return nil, err
+	}
+	var m BundleManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, ErrBundleFormat
+	}
+	if m.Format != bundleFormat || m.Version < 1 || m.Version > BundleVersion || len(m.Forks) == 0 {
+		return nil, ErrBundleFormat
+	}
+	for i, f := range m.Forks {
+		if f.ID != ForkID(i) || (i > 0 && f.ParentFork >= f.ID) {
+			return nil, ErrBundleFormat
+		}
+	}
+
+	var opts FileOptions
+	if m.ReferenceSource {
+		n, crc, err := fileCRC(lib.defaultFS, m.SourcePath)
+		if err != nil {
+			return nil, err
+		}
+		if n != m.BaseBytes || crc != m.BaseCRC {
+			return nil, ErrBundleSourceMismatch
+		}
+		opts.FilePath = m.SourcePath
+	} else {
+		base, err := next(bundleContent)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(base)) != m.BaseBytes || crc32.ChecksumIEEE(base) != m.BaseCRC {
+			return nil, ErrBundleFormat
+		}
+		opts.DataBytes = base
+	}
+
+	data, err = next(bundleHistory)
+	if err != nil {
+		return nil, err
+	}
+	var history []BundleRevision
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for sc.Scan() {
+		var rec BundleRevision
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, ErrBundleFormat
+		}
+		history = append(history, rec)
+	}
+	if len(history) > 0 && history[0].Fork == 0 && history[0].Revision == 0 {
+		if history[0].Decorations != nil {
+			if opts.Decorations, err = parseDecorationJSON(history[0].Decorations); err != nil {
+				return nil, err
+			}
+		}
+		history = history[1:]
+	}
+
+	data, err = next(bundleCursors)
+	if err != nil {
+		return nil, err
+	}
+	var cursors []json.RawMessage
+	if err := json.Unmarshal(data, &cursors); err != nil {
+		return nil, ErrBundleFormat
+	}
+
+	g, err := lib.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.replayBundle(m, history); err != nil {
+		g.Close()
+		return nil, err
+	}
+	for _, c := range cursors {
+		if _, _, err := g.RestoreCursor(c); err != nil {
+			g.Close()
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// replayBundle rebuilds the history of a freshly opened base, then
+// restores pruning, deletions and the current position.
+func (g *Garland) replayBundle(m BundleManifest, history []BundleRevision) error {
+	for _, f := range m.Forks {
+		if f.ID > 0 {
+			if err := g.ForkSeek(f.ParentFork); err != nil {
+				return err
+			}
+			if err := g.UndoSeek(f.ParentRevision); err != nil {
+				return err
+			}
+			g.mu.Lock()
+			ok := g.nextForkID+1 == f.ID
+			if ok {
+				g.createForkFromCurrent()
+			}
+			g.mu.Unlock()
+			if !ok {
+				return ErrBundleFormat
+			}
+		}
+		for len(history) > 0 && history[0].Fork == f.ID {
+			rec := history[0]
+			history = history[1:]
+			if rec.Revision != g.CurrentRevision()+1 {
+				return ErrBundleFormat
+			}
+			if err := g.replayBundleRevision(rec); err != nil {
+				return err
+			}
+		}
+	}
+	if len(history) > 0 {
+		return ErrBundleFormat // out of fork order, or an unknown fork
+	}
+
+	for _, f := range m.Forks {
+		if f.PrunedUpTo == 0 {
+			continue
+		}
+		if err := g.ForkSeek(f.ID); err != nil {
+			return err
+		}
+		if err := g.UndoSeek(f.HighestRevision); err != nil {
+			return err
+		}
+		if err := g.Prune(f.PrunedUpTo); err != nil {
+			return err
+		}
+	}
+	if err := g.ForkSeek(m.CurrentFork); err != nil {
+		return err
+	}
+	if err := g.UndoSeek(m.CurrentRevision); err != nil {
+		return err
+	}
+	for _, f := range m.Forks {
+		if f.Deleted {
+			if err := g.DeleteFork(f.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	crc := crc32.NewIEEE()
+	for pos := int64(0); pos < g.totalBytes; pos += 128 << 10 {
+		data, err := g.readThawingLocked(pos, min(128<<10, g.totalBytes-pos))
+		if err != nil {
+			return err
+		}
+		crc.Write(data)
+	}
+	if g.totalBytes != m.CurrentBytes || crc.Sum32() != m.CurrentCRC {
+		return ErrBundleFormat
+	}
+	return nil
+}
+
+// replayBundleRevision applies one history line as one revision.
+func (g *Garland) replayBundleRevision(rec BundleRevision) error {
+	var want []DecorationEntry
+	if rec.Decorations != nil {
+		var err error
+		if want, err = parseDecorationJSON(rec.Decorations); err != nil {
+			return err
+		}
+	}
+	if err := g.TransactionStart(rec.Name); err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		g.TransactionRollback()
+		return err
+	}
+	if rec.Ops != nil {
+		if _, err := g.ApplyOps(*rec.Ops, rec.Name); err != nil {
+			return fail(err)
+		}
+	}
+	if rec.Decorations != nil {
+		g.mu.Lock()
+		have, err := g.decorationsAtLocked(g.liveStateLocked())
+		g.mu.Unlock()
+		if err != nil {
+			return fail(err)
+		}
+		// Remove what is gone, then set the wanted set (a set is
+		// idempotent for marks already in place).
+		keep := make(map[string]bool, len(want))
+		for _, d := range want {
+			keep[namespacedKey(d.Namespace, d.Key)] = true
+		}
+		entries := append([]DecorationEntry(nil), want...)
+		for _, d := range have {
+			if !keep[namespacedKey(d.Namespace, d.Key)] {
+				entries = append(entries, DecorationEntry{Key: d.Key, Namespace: d.Namespace})
+			}
+		}
+		if len(entries) > 0 {
+			if _, err := g.Decorate(entries); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	_, err := g.TransactionCommit()
+	return err
+}
@@ -0,0 +1,115 @@
+package garland
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	g, c := openWithRevisions(t, []string{"one\n", "two\n", "three\n"}) // revs 1..3
+	c.SetName("main")
+	addr := ByteAddress(4)
+	if _, err := g.Decorate([]DecorationEntry{{Key: "mark", Address: &addr}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Branch fork 1 at revision 2, then prune fork 0 below revision 1.
+	if err := g.UndoSeek(2); err != nil {
+		t.Fatal(err)
+	}
+	c.SeekByte(0)
+	if _, err := c.InsertString("FORK\n", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	fork := g.CurrentFork()
+	if err := g.ForkSeek(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.UndoSeek(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Prune(1); err != nil {
+		t.Fatal(err)
+	}
+	c.SeekByte(7)
+
+	var buf bytes.Buffer
+	if err := g.ExportBundle(&buf); err != nil {
+		t.Fatal(err)
+	}
+	h, err := g.lib.ImportBundle(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if got, want := readAll(t, h), readAll(t, g); got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+	if h.CurrentFork() != 0 || h.CurrentRevision() != 4 {
+		t.Errorf("position = fork %d rev %d, want fork 0 rev 4", h.CurrentFork(), h.CurrentRevision())
+	}
+	if pos, err := h.GetDecorationPosition("mark"); err != nil || pos.Byte != 4 {
+		t.Errorf("mark = %v, %v; want byte 4", pos, err)
+	}
+	if hc, err := h.FindCursor("main"); err != nil || hc.BytePos() != 7 {
+		t.Errorf("cursor main = %v, %v; want at byte 7", hc, err)
+	}
+	if err := h.UndoSeek(0); err == nil {
+		t.Error("UndoSeek(0) should fail below the pruning watermark")
+	}
+
+	// The fork and the decoration history come back too.
+	if err := h.UndoSeek(3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.GetDecorationPosition("mark"); err == nil {
+		t.Error("mark should not exist before the revision that added it")
+	}
+	if err := h.ForkSeek(fork); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.UndoSeek(3); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, h); got != "FORK\nrev0 content\none\ntwo\n" {
+		t.Errorf("fork text = %q", got)
+	}
+}
+
+func TestBundleReferencingSource(t *testing.T) {
+	g, c := openSourceFile(t, "alpha\nbeta\n")
+	c.SeekByte(6)
+	if _, err := c.InsertString("BETA ", nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := g.ExportBundleReferencingSource(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	h, err := g.lib.ImportBundle(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, h); got != "alpha\nBETA beta\n" {
+		t.Errorf("text = %q", got)
+	}
+	h.Close()
+
+	// Once the file changes, the bundle no longer applies.
+	if err := os.WriteFile(g.sourcePath, []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.lib.ImportBundle(bytes.NewReader(data)); err != ErrBundleSourceMismatch {
+		t.Errorf("import after change: err = %v, want ErrBundleSourceMismatch", err)
+	}
+	if err := g.ExportBundleReferencingSource(&buf); err != ErrBundleSourceMismatch {
+		t.Errorf("export after change: err = %v, want ErrBundleSourceMismatch", err)
+	}
+	if _, err := g.lib.ImportBundle(bytes.NewReader([]byte("not a bundle"))); err != ErrBundleFormat {
+		t.Errorf("garbage: err = %v, want ErrBundleFormat", err)
+	}
+}
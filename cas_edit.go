@@ -0,0 +1,105 @@
+package garland
+
+import "sort"
+
+// cas_edit.go - compare-and-edit (optimistic concurrency).
+//
+// DESIGN: a formatter, a linter fix or an LSP code action is computed
+// against the document as it was when the tool read it - usually a
+// Snapshot - and applied later. If the user typed in between, the
+// tool's offsets point at the wrong bytes and applying them silently
+// clobbers the newer text. The tool cannot see this coming; the
+// document can.
+//
+// RULING: the edit carries the (fork, revision) it was computed
+// against, and it applies only if that is STILL the current version;
+// otherwise it fails with ErrStaleRevision and changes nothing, and
+// the tool recomputes against the new state (or gives up). The check
+// and the edit run on the edit queue's writer (editqueue.go), so no
+// queued edit can land between them. Any version move counts - an
+// edit, an undo, a fork switch - because any of them can invalidate
+// the offsets.
+//
+// ApplyTextEditsIf is the shape most tools produce: a set of
+// non-overlapping replacements, all in the coordinates of the expected
+// version. They are applied back to front, so no replacement shifts
+// another's offsets, and land as one revision.
+
+// TextEdit replaces bytes [Start, End) with Text. Start == End is a
+// pure insert; empty Text is a pure delete.
+type TextEdit struct {
+	Start int64
+	End   int64
+	Text  string
+}
+
+// CurrentVersion returns the current fork and revision - the value to
+// hand back as the expected version of a compare-and-edit.
+func (g *Garland) CurrentVersion() ChangeResult {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.currentVersion()
+}
+
+// currentVersion is CurrentVersion without locking.
+func (g *Garland) currentVersion() ChangeResult {
+	return ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}
+}
+
+// SubmitEditIf is SubmitEdit guarded by the expected version: if the
+// document is no longer at expected when the edit's turn comes, fn
+// does not run and the result carries ErrStaleRevision (and the
+// current version in Change).
+func (g *Garland) SubmitEditIf(expected ChangeResult, name string, fn EditFunc) <-chan EditResult {
+	return g.submitEdit(editRequest{name: name, fn: fn, expect: &expected})
+}
+
+// ApplyEditIf submits a guarded edit and waits for its result.
+func (g *Garland) ApplyEditIf(expected ChangeResult, name string, fn EditFunc) (ChangeResult, error) {
+	r := <-g.SubmitEditIf(expected, name, fn)
+	return r.Change, r.Err
+}
+
+// ApplyTextEditsIf applies edits, computed against the expected
+// version, as one revision named name - or fails with ErrStaleRevision
+// if the document has moved on. Edits must not overlap
+// (ErrOverlappingRanges); two inserts at the same offset apply in the
+// order given.
+func (g *Garland) ApplyTextEditsIf(expected ChangeResult, name string, edits []TextEdit) (ChangeResult, error) {
+	ordered := make([]TextEdit, len(edits))
+	copy(ordered, edits)
+	for _, e := range ordered {
+		if e.Start < 0 || e.End < e.Start {
+			return ChangeResult{}, ErrInvalidPosition
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Start < ordered[j].Start })
+	for i := 1; i < len(ordered); i++ {
+		if ordered[i].Start < ordered[i-1].End {
+			return ChangeResult{}, ErrOverlappingRanges
+		}
+	}
+
+	return g.ApplyEditIf(expected, name, func(g *Garland, c *Cursor) error {
+		// Back to front: each replacement leaves the offsets before it
+		// untouched. Same-offset inserts go in reverse so the first one
+		// given ends up first.
+		for i := len(ordered) - 1; i >= 0; i-- {
+			e := ordered[i]
+			if err := c.SeekByte(e.Start); err != nil {
+				return err
+			}
+			if e.End > e.Start {
+				if _, _, err := c.DeleteBytes(e.End-e.Start, false); err != nil {
+					return err
+				}
+			}
+			if e.Text != "" {
+				if _, err := c.InsertString(e.Text, nil, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,62 @@
+package garland
+
+import "testing"
+
+func TestApplyTextEditsIf(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "func  main( ){}\n"})
+	defer g.Close()
+
+	v, _ := g.Snapshot()
+	defer v.Release()
+
+	// A formatter's edits, all in the snapshot's coordinates.
+	edits := []TextEdit{
+		{Start: 4, End: 6, Text: " "},
+		{Start: 11, End: 12},
+		{Start: 13, End: 13, Text: " "},
+	}
+	change, err := g.ApplyTextEditsIf(v.Version(), "format", edits)
+	if err != nil {
+		t.Fatalf("ApplyTextEditsIf: %v", err)
+	}
+	if change.Revision != 1 {
+		t.Errorf("revision %d, want one revision for the batch", change.Revision)
+	}
+	if data, _ := g.NewCursor().ReadBytes(g.ByteCount().Value); string(data) != "func main() {}\n" {
+		t.Errorf("content = %q", data)
+	}
+
+	// The same edits against the now-stale snapshot change nothing.
+	_, err = g.ApplyTextEditsIf(v.Version(), "format", edits)
+	if err != ErrStaleRevision {
+		t.Fatalf("stale apply: err = %v, want ErrStaleRevision", err)
+	}
+	if g.CurrentRevision() != 1 {
+		t.Errorf("stale apply moved the revision to %d", g.CurrentRevision())
+	}
+
+	if _, err := g.ApplyTextEditsIf(g.CurrentVersion(), "bad", []TextEdit{{Start: 0, End: 4}, {Start: 2, End: 3}}); err != ErrOverlappingRanges {
+		t.Errorf("overlap: err = %v", err)
+	}
+}
+
+func TestApplyEditIfAfterUndo(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "abc"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.InsertString("x", nil, true)
+	seen := g.CurrentVersion()
+	g.UndoSeek(0)
+
+	ran := false
+	_, err := g.ApplyEditIf(seen, "late", func(*Garland, *Cursor) error {
+		ran = true
+		return nil
+	})
+	if err != ErrStaleRevision || ran {
+		t.Errorf("after undo: err = %v, ran = %v", err, ran)
+	}
+}
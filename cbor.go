@@ -0,0 +1,480 @@
+package garland
+
+import (
+	"encoding/binary"
+	"math"
+	"unicode/utf8"
+)
+
+// cbor.go - CBOR encodings of decoration batches and deltas.
+//
+// DESIGN: RPC and sync peers want the decoration batches and revision
+// deltas garland already produces in a standard, self-describing
+// binary form their own stacks can decode, rather than the compact
+// private delta format (delta.go) or the framing of cold-storage
+// blocks. CBOR (RFC 8949) fits without a dependency: the subset needed
+// - integers, strings, arrays, maps, null - is a few dozen lines here.
+//
+// SCHEMA. Every document is the self-describe tag 55799 around a map
+// with small integer keys:
+//
+//	decorations: {0: "garland-decorations", 1: version,
+//	              2: [ {0: key, 1: namespace?, 2: address / null,
+//	                    3: gravity?} ... ]}
+//	address:     [mode, fields...]  byte [0, b]; rune [1, r];
+//	             line/rune [2, line, rune]; EOF [3]
+//	delta:       {0: "garland-delta", 1: version, 2: fork,
+//	              3: fromRevision, 4: toRevision, 5: baseRunes,
+//	              6: targetRunes, 7: [step ...]}
+//	step:        unsigned n: retain n runes; negative -n: delete n
+//	             runes; text: insert it
+//
+// A null address deletes the decoration, as in DecorationEntry.
+//
+// VERSIONING. Key 1 is the schema version. A decoder refuses versions
+// newer than it knows and skips map keys it does not know, so later
+// versions can add fields without breaking older readers that only
+// need the existing ones; a change existing readers must not misread
+// bumps the version. Indefinite-length items and floats are not used
+// and are refused.
+
+// Schema names and versions of the CBOR documents.
+const (
+	decorationCBORSchema = "garland-decorations"
+	deltaCBORSchema      = "garland-delta"
+
+	// DecorationCBORVersion is the decoration schema version written.
+	DecorationCBORVersion = 1
+
+	// DeltaCBORVersion is the delta schema version written.
+	DeltaCBORVersion = 1
+)
+
+// cborSelfDescribe is the tag marking a CBOR document.
+const cborSelfDescribe = 55799
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// cborNull is the encoded null.
+const cborNull = 0xf6
+
+// cborMaxDepth bounds nesting when skipping unknown values.
+const cborMaxDepth = 32
+
+// cborEncoder appends CBOR items to buf.
+type cborEncoder struct {
+	buf []byte
+}
+
+func (e *cborEncoder) head(major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, m|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, m|26), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, m|27), n)
+	}
+}
+
+func (e *cborEncoder) int(v int64) {
+	if v < 0 {
+		e.head(cborNegint, uint64(-1-v))
+		return
+	}
+	e.head(cborUint, uint64(v))
+}
+
+func (e *cborEncoder) text(s string) {
+	e.head(cborText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// document opens a versioned schema document of n further map entries.
+func (e *cborEncoder) document(schema string, version, n int) {
+	e.head(cborTag, cborSelfDescribe)
+	e.head(cborMap, uint64(2+n))
+	e.int(0)
+	e.text(schema)
+	e.int(1)
+	e.int(int64(version))
+}
+
+// cborDecoder reads CBOR items from data. The first error sticks.
+type cborDecoder struct {
+	data []byte
+	pos  int
+	bad  bool
+}
+
+// head reads an item head. Indefinite lengths are refused.
+func (d *cborDecoder) head() (major byte, n uint64) {
+	if d.bad || d.pos >= len(d.data) {
+		d.bad = true
+		return 0, 0
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info := b>>5, b&0x1f
+	if info < 24 {
+		return major, uint64(info)
+	}
+	size := 0
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		d.bad = true
+		return 0, 0
+	}
+	if len(d.data)-d.pos < size {
+		d.bad = true
+		return 0, 0
+	}
+	for _, c := range d.data[d.pos : d.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.pos += size
+	return major, n
+}
+
+// peekNull consumes a null if one is next.
+func (d *cborDecoder) peekNull() bool {
+	if !d.bad && d.pos < len(d.data) && d.data[d.pos] == cborNull {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// int reads an integer.
+func (d *cborDecoder) int() int64 {
+	major, n := d.head()
+	if n > math.MaxInt64 {
+		d.bad = true
+	}
+	switch major {
+	case cborUint:
+		return int64(n)
+	case cborNegint:
+		return -1 - int64(n)
+	}
+	d.bad = true
+	return 0
+}
+
+// count reads a non-negative integer.
+func (d *cborDecoder) count() int64 {
+	v := d.int()
+	if v < 0 {
+		d.bad = true
+	}
+	return v
+}
+
+// text reads a UTF-8 text string.
+func (d *cborDecoder) text() string {
+	major, n := d.head()
+	if major != cborText || n > uint64(len(d.data)-d.pos) {
+		d.bad = true
+		return ""
+	}
+	s := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	if !utf8.Valid(s) {
+		d.bad = true
+	}
+	return string(s)
+}
+
+// container reads an array or map head and returns its entry count,
+// bounded by the bytes left (every entry takes at least one).
+func (d *cborDecoder) container(major byte) int {
+	m, n := d.head()
+	if m != major || n > uint64(len(d.data)-d.pos) {
+		d.bad = true
+		return 0
+	}
+	return int(n)
+}
+
+// skip consumes one item of any supported kind.
+func (d *cborDecoder) skip(depth int) {
+	if depth > cborMaxDepth {
+		d.bad = true
+		return
+	}
+	major, n := d.head()
+	switch major {
+	case cborUint, cborNegint:
+	case cborBytes, cborText:
+		if n > uint64(len(d.data)-d.pos) {
+			d.bad = true
+			return
+		}
+		d.pos += int(n)
+	case cborArray, cborMap:
+		if major == cborMap {
+			n *= 2
+		}
+		for ; n > 0 && !d.bad; n-- {
+			d.skip(depth + 1)
+		}
+	case cborTag:
+		d.skip(depth + 1)
+	case cborSimple:
+		if n > 23 { // floats and the rest
+			d.bad = true
+		}
+	}
+}
+
+// document reads a versioned schema document's header and returns its
+// version and the number of remaining map entries.
+func (d *cborDecoder) document(schema string, newest int) (version int64, n int) {
+	if major, tag := d.head(); major != cborTag || tag != cborSelfDescribe {
+		d.bad = true
+		return 0, 0
+	}
+	n = d.container(cborMap) - 2
+	if d.int() != 0 || d.text() != schema || d.int() != 1 {
+		d.bad = true
+	}
+	version = d.int()
+	if n < 0 || version < 1 || version > int64(newest) {
+		d.bad = true
+	}
+	return version, n
+}
+
+// done reports whether the whole input was one well-formed document.
+func (d *cborDecoder) done() bool {
+	return !d.bad && d.pos == len(d.data)
+}
+
+// EncodeDecorationsCBOR encodes a batch of decoration entries (nil
+// Address: a deletion) as a CBOR document.
+func EncodeDecorationsCBOR(entries []DecorationEntry) []byte {
+	e := &cborEncoder{}
+	e.document(decorationCBORSchema, DecorationCBORVersion, 1)
+	e.int(2)
+	e.head(cborArray, uint64(len(entries)))
+	for _, entry := range entries {
+		n := 2
+		if entry.Namespace != "" {
+			n++
+		}
+		if entry.Gravity != GravityDefault {
+			n++
+		}
+		e.head(cborMap, uint64(n))
+		e.int(0)
+		e.text(entry.Key)
+		if entry.Namespace != "" {
+			e.int(1)
+			e.text(entry.Namespace)
+		}
+		e.int(2)
+		if a := entry.Address; a == nil {
+			e.buf = append(e.buf, cborNull)
+		} else {
+			switch a.Mode {
+			case RuneMode:
+				e.head(cborArray, 2)
+				e.int(int64(a.Mode))
+				e.int(a.Rune)
+			case LineRuneMode:
+				e.head(cborArray, 3)
+				e.int(int64(a.Mode))
+				e.int(a.Line)
+				e.int(a.LineRune)
+			case EOFMode:
+				e.head(cborArray, 1)
+				e.int(int64(a.Mode))
+			default:
+				e.head(cborArray, 2)
+				e.int(int64(ByteMode))
+				e.int(a.Byte)
+			}
+		}
+		if entry.Gravity != GravityDefault {
+			e.int(3)
+			e.int(int64(entry.Gravity))
+		}
+	}
+	return e.buf
+}
+
+// DecodeDecorationsCBOR decodes a document from EncodeDecorationsCBOR.
+// Returns ErrDecorationFormat for a malformed or newer document,
+// ErrInvalidDecorationKey for an illegal key or namespace.
+func DecodeDecorationsCBOR(data []byte) ([]DecorationEntry, error) {
+	d := &cborDecoder{data: data}
+	_, n := d.document(decorationCBORSchema, DecorationCBORVersion)
+	var entries []DecorationEntry
+	for ; n > 0 && !d.bad; n-- {
+		if d.int() != 2 {
+			d.skip(0)
+			continue
+		}
+		count := d.container(cborArray)
+		entries = make([]DecorationEntry, 0, count)
+		for ; count > 0 && !d.bad; count-- {
+			entry, ok := d.decorationEntry()
+			if !ok {
+				return nil, ErrInvalidDecorationKey
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if !d.done() {
+		return nil, ErrDecorationFormat
+	}
+	return entries, nil
+}
+
+// decorationEntry reads one entry map; ok is false for an illegal key
+// or namespace (format errors set d.bad).
+func (d *cborDecoder) decorationEntry() (entry DecorationEntry, ok bool) {
+	haveAddress := false
+	for n := d.container(cborMap); n > 0 && !d.bad; n-- {
+		switch d.int() {
+		case 0:
+			entry.Key = d.text()
+		case 1:
+			entry.Namespace = d.text()
+		case 2:
+			haveAddress = true
+			if d.peekNull() {
+				continue
+			}
+			a, ok := d.address()
+			if !ok {
+				d.bad = true
+			}
+			entry.Address = &a
+		case 3:
+			g := d.int()
+			if g < int64(GravityDefault) || g > int64(GravityRight) {
+				d.bad = true
+			}
+			entry.Gravity = Gravity(g)
+		default:
+			d.skip(0)
+		}
+	}
+	if !haveAddress {
+		d.bad = true
+	}
+	if d.bad {
+		return entry, true // reported as a format error
+	}
+	return entry, ValidDecorationKey(entry.Key) && (entry.Namespace == "" || ValidDecorationKey(entry.Namespace))
+}
+
+// address reads an address array.
+func (d *cborDecoder) address() (AbsoluteAddress, bool) {
+	n := d.container(cborArray)
+	if n < 1 {
+		return AbsoluteAddress{}, false
+	}
+	a := AbsoluteAddress{Mode: AddressMode(d.int())}
+	switch {
+	case a.Mode == ByteMode && n == 2:
+		a.Byte = d.count()
+	case a.Mode == RuneMode && n == 2:
+		a.Rune = d.count()
+	case a.Mode == LineRuneMode && n == 3:
+		a.Line = d.count()
+		a.LineRune = d.count()
+	case a.Mode == EOFMode && n == 1:
+	default:
+		return a, false
+	}
+	return a, true
+}
+
+// EncodeDeltaCBOR encodes an operation as a CBOR delta document.
+func EncodeDeltaCBOR(hdr DeltaHeader, op OTOperation) []byte {
+	e := &cborEncoder{}
+	e.document(deltaCBORSchema, DeltaCBORVersion, 6)
+	for i, v := range []int64{int64(hdr.Fork), int64(hdr.FromRevision), int64(hdr.ToRevision), op.BaseLength, op.TargetLength} {
+		e.int(int64(i + 2))
+		e.int(v)
+	}
+	e.int(7)
+	e.head(cborArray, uint64(len(op.Ops)))
+	for _, o := range op.Ops {
+		switch o.Kind {
+		case OTInsert:
+			e.text(o.Text)
+		case OTDelete:
+			e.int(-o.Count)
+		default:
+			e.int(o.Count)
+		}
+	}
+	return e.buf
+}
+
+// DecodeDeltaCBOR decodes a document from EncodeDeltaCBOR. Returns
+// ErrCorruptDelta for a malformed or newer document, or one whose
+// steps do not add up to its lengths.
+func DecodeDeltaCBOR(data []byte) (DeltaHeader, OTOperation, error) {
+	var hdr DeltaHeader
+	var op OTOperation
+	var base, target int64 = -1, -1
+	d := &cborDecoder{data: data}
+	_, n := d.document(deltaCBORSchema, DeltaCBORVersion)
+	for ; n > 0 && !d.bad; n-- {
+		switch d.int() {
+		case 2:
+			hdr.Fork = ForkID(d.count())
+		case 3:
+			hdr.FromRevision = RevisionID(d.count())
+		case 4:
+			hdr.ToRevision = RevisionID(d.count())
+		case 5:
+			base = d.count()
+		case 6:
+			target = d.count()
+		case 7:
+			for steps := d.container(cborArray); steps > 0 && !d.bad; steps-- {
+				if d.pos < len(d.data) && d.data[d.pos]>>5 == cborText {
+					op.Insert(d.text())
+				} else if v := d.int(); v < 0 {
+					op.Delete(-v)
+				} else {
+					op.Retain(v)
+				}
+			}
+		default:
+			d.skip(0)
+		}
+	}
+	if !d.done() || op.BaseLength != base || op.TargetLength != target {
+		return DeltaHeader{}, OTOperation{}, ErrCorruptDelta
+	}
+	return hdr, op, nil
+}
@@ -0,0 +1,93 @@
+package garland
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecorationsCBORRoundTrip(t *testing.T) {
+	b, r, lr, eof := ByteAddress(300), RuneAddress(7), LineAddress(2, 1), EOFAddress()
+	entries := []DecorationEntry{
+		{Key: "bookmark", Address: &b},
+		{Key: "sel.start", Namespace: "lsp", Address: &r, Gravity: GravityLeft},
+		{Key: "cursor#2", Address: &lr, Gravity: GravityRight},
+		{Key: "tail", Address: &eof},
+		{Key: "gone"},
+	}
+	data := EncodeDecorationsCBOR(entries)
+	if !bytes.HasPrefix(data, []byte{0xd9, 0xd9, 0xf7}) {
+		t.Errorf("missing self-describe tag: % x", data[:3])
+	}
+	got, err := DecodeDecorationsCBOR(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("got %d entries, want %d", len(got), len(entries))
+	}
+	for i, want := range entries {
+		g := got[i]
+		if g.Key != want.Key || g.Namespace != want.Namespace || g.Gravity != want.Gravity ||
+			(g.Address == nil) != (want.Address == nil) || (g.Address != nil && *g.Address != *want.Address) {
+			t.Errorf("entry %d = %+v, want %+v", i, g, want)
+		}
+	}
+
+	// Truncation, trailing bytes and a newer version are all refused.
+	if _, err := DecodeDecorationsCBOR(data[:len(data)-1]); err != ErrDecorationFormat {
+		t.Errorf("truncated: err = %v", err)
+	}
+	if _, err := DecodeDecorationsCBOR(append(data[:len(data):len(data)], 0)); err != ErrDecorationFormat {
+		t.Errorf("trailing: err = %v", err)
+	}
+	newer := append([]byte(nil), data...)
+	newer[bytes.Index(newer, []byte(decorationCBORSchema))+len(decorationCBORSchema)+1] = DecorationCBORVersion + 1
+	if _, err := DecodeDecorationsCBOR(newer); err != ErrDecorationFormat {
+		t.Errorf("newer version: err = %v", err)
+	}
+	bad := []DecorationEntry{{Key: "no spaces", Address: &b}}
+	if _, err := DecodeDecorationsCBOR(EncodeDecorationsCBOR(bad)); err != ErrInvalidDecorationKey {
+		t.Errorf("bad key: err = %v", err)
+	}
+}
+
+func TestDeltaCBORRoundTrip(t *testing.T) {
+	g, c := openWithRevisions(t, []string{"one\n"})
+	c.SeekByte(0)
+	c.OverwriteBytes(4, []byte("REV0"))
+	op, err := g.OpsBetween(0, g.CurrentRevision())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := DeltaHeader{Fork: 0, FromRevision: 0, ToRevision: g.CurrentRevision()}
+	data := EncodeDeltaCBOR(hdr, op)
+
+	gotHdr, gotOp, err := DecodeDeltaCBOR(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotHdr != hdr {
+		t.Errorf("header = %+v, want %+v", gotHdr, hdr)
+	}
+	text, err := gotOp.ApplyToString("rev0 content\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := readAll(t, g); text != want {
+		t.Errorf("applied %q, want %q", text, want)
+	}
+
+	// An unknown key from a later writer is skipped.
+	e := &cborEncoder{buf: append([]byte(nil), data...)}
+	e.buf[3]++ // one more map entry (the map head follows the 3-byte tag)
+	e.int(99)
+	e.head(cborArray, 2)
+	e.text("future")
+	e.int(-5)
+	if _, _, err := DecodeDeltaCBOR(e.buf); err != nil {
+		t.Errorf("unknown key: %v", err)
+	}
+	if _, _, err := DecodeDeltaCBOR(data[:len(data)-2]); err != ErrCorruptDelta {
+		t.Errorf("truncated: err = %v", err)
+	}
+}
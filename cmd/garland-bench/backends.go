@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phroun/garland"
+)
+
+// backendNames are the cold storage backends -backends selects from:
+// the directory store (one file per block), the single-file pack, and
+// an in-memory store that sleeps -backend-latency per call, standing
+// in for network storage. There is no database backend: garland keeps
+// its cold storage dependency-free (see the RULING in coldpack.go), and
+// the pack is its single-file store.
+var backendNames = []string{"dir", "pack", "mem"}
+
+// benchBackends runs the chill and read benchmarks against each
+// selected backend, with write-behind off and, when -writeback is
+// positive, with a queue of that many blocks. The document is the
+// first -backend-size bytes of the test file loaded from memory, so
+// every chill goes to cold storage (a file source would chill to warm
+// storage instead).
+func benchBackends(cfg config, testFile, tmpDir string, run func(string, func() BenchResult)) {
+	data, err := readPrefix(testFile, cfg.backendSize)
+	if err != nil {
+		fmt.Fprintf(out, "  Failed to read test file: %v\n", err)
+		return
+	}
+	queues := []int{0}
+	if cfg.writeBack > 0 {
+		queues = append(queues, cfg.writeBack)
+	}
+	for _, backend := range cfg.backends {
+		for _, queue := range queues {
+			label := backend
+			if queue > 0 {
+				label += "+writeback"
+			}
+			opts := garland.LibraryOptions{ColdWriteBackQueue: queue}
+			dir := filepath.Join(tmpDir, "backend-"+strings.ReplaceAll(label, "+", "-"))
+			switch backend {
+			case "dir":
+				opts.ColdStoragePath = dir
+			case "pack":
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					fmt.Fprintf(out, "  Failed to create %s: %v\n", dir, err)
+					return
+				}
+				opts.ColdStorageFile = filepath.Join(dir, "cold.pack")
+			case "mem":
+				opts.ColdStorageBackend = newLatencyStore(cfg.backendLatency)
+			}
+			benchBackend(cfg, opts, data, label, run)
+		}
+	}
+}
+
+// benchBackend chills the whole document to one backend, then reads it
+// back at random positions.
+func benchBackend(cfg config, opts garland.LibraryOptions, data []byte, label string, run func(string, func() BenchResult)) {
+	lib, err := garland.Init(opts)
+	if err != nil {
+		fmt.Fprintf(out, "  %s: failed to init library: %v\n", label, err)
+		return
+	}
+	defer lib.Close()
+	g, err := lib.Open(garland.FileOptions{DataBytes: data, MaxLeafSize: cfg.leafSize})
+	if err != nil {
+		fmt.Fprintf(out, "  %s: failed to open: %v\n", label, err)
+		return
+	}
+	defer g.Close()
+
+	name := fmt.Sprintf("Backend %s: chill all", label)
+	run(name, func() BenchResult {
+		start := time.Now()
+		err := g.Chill(garland.ChillEverything)
+		queued := time.Since(start)
+		if err == nil {
+			err = lib.FlushColdWrites()
+		}
+		if err != nil {
+			return BenchResult{Name: name, Duration: time.Since(start), Extra: fmt.Sprintf("ERROR: %v", err)}
+		}
+		stats := g.MemoryUsage()
+		return BenchResult{
+			Name:     name,
+			Duration: time.Since(start),
+			Ops:      int(stats.Chills),
+			Extra:    fmt.Sprintf("%d MB cold; chill returned after %v", stats.ColdBytes/(1024*1024), queued.Round(time.Millisecond)),
+		}
+	})
+
+	name = fmt.Sprintf("Backend %s: cold reads", label)
+	run(name, func() BenchResult {
+		cursor := g.NewCursor()
+		defer g.RemoveCursor(cursor)
+		rng := rand.New(rand.NewPCG(7, 7))
+		size := g.ByteCount().Value
+		before := g.MemoryUsage().Thaws
+		n := cfg.reads * 4
+		latencies := make([]time.Duration, 0, n)
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			t := time.Now()
+			cursor.SeekByte(rng.Int64N(max(size, 1)))
+			cursor.ReadBytes(cfg.readSize)
+			latencies = append(latencies, time.Since(t))
+		}
+		duration := time.Since(start)
+		slices.Sort(latencies)
+		return BenchResult{
+			Name:     name,
+			Duration: duration,
+			Ops:      n,
+			Extra: fmt.Sprintf("p50 %v, p99 %v; %d thaws", percentile(latencies, 50),
+				percentile(latencies, 99), g.MemoryUsage().Thaws-before),
+		}
+	})
+}
+
+// readPrefix reads up to n bytes from the start of path.
+func readPrefix(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, n)
+	m, err := f.ReadAt(buf, 0)
+	if m > 0 {
+		err = nil
+	}
+	return buf[:m], err
+}
+
+// latencyStore is an in-memory garland.ColdStorageInterface whose every
+// call takes at least latency.
+type latencyStore struct {
+	latency time.Duration
+	mu      sync.Mutex
+	folders map[string]map[string][]byte
+}
+
+func newLatencyStore(latency time.Duration) *latencyStore {
+	return &latencyStore{latency: latency, folders: make(map[string]map[string][]byte)}
+}
+
+func (s *latencyStore) Set(folder, block string, data []byte) error {
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.folders[folder] == nil {
+		s.folders[folder] = make(map[string][]byte)
+	}
+	s.folders[folder][block] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *latencyStore) Get(folder, block string) ([]byte, error) {
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.folders[folder][block]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *latencyStore) Delete(folder, block string) error {
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.folders[folder], block)
+	return nil
+}
+
+func (s *latencyStore) DeleteFolder(folder string) error {
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.folders[folder]) > 0 {
+		return errors.New("folder not empty")
+	}
+	delete(s.folders, folder)
+	return nil
+}
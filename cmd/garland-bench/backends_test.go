@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyStore(t *testing.T) {
+	s := newLatencyStore(time.Millisecond)
+	start := time.Now()
+	if err := s.Set("f", "b", []byte("cold")); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < time.Millisecond {
+		t.Error("Set took less than the latency")
+	}
+	data, err := s.Get("f", "b")
+	if err != nil || string(data) != "cold" {
+		t.Fatalf("Get: %q, %v", data, err)
+	}
+	data[0] = 'C' // a copy: the stored block is unchanged
+	if again, _ := s.Get("f", "b"); string(again) != "cold" {
+		t.Errorf("stored block changed to %q", again)
+	}
+	if _, err := s.Get("f", "missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing block: %v", err)
+	}
+	if err := s.DeleteFolder("f"); err == nil {
+		t.Error("deleted a folder that still has blocks")
+	}
+	if err := s.Delete("f", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteFolder("f"); err != nil {
+		t.Errorf("empty folder: %v", err)
+	}
+}
+
+func TestReadPrefix(t *testing.T) {
+	cfg := smallConfig()
+	file := testFile(t, cfg)
+	if data, err := readPrefix(file, 100); err != nil || len(data) != 100 || !strings.HasPrefix(string(data), "00000001: ") {
+		t.Errorf("100 bytes: %d, %v", len(data), err)
+	}
+	// Asking for more than the file holds gives the whole file.
+	if data, err := readPrefix(file, cfg.fileSize*2); err != nil || int64(len(data)) != cfg.fileSize {
+		t.Errorf("past the end: %d bytes, %v", len(data), err)
+	}
+	if _, err := readPrefix(file+".missing", 10); err == nil {
+		t.Error("missing file read")
+	}
+}
+
+func TestBackends(t *testing.T) {
+	cfg := smallConfig()
+	cfg.backends, cfg.backendLatency = backendNames, 0
+	file := testFile(t, cfg)
+
+	var names []string
+	benchBackends(cfg, file, t.TempDir(), func(name string, fn func() BenchResult) {
+		r := fn()
+		names = append(names, name)
+		if strings.Contains(r.Extra, "ERROR") {
+			t.Errorf("%s: %s", name, r.Extra)
+		}
+		if r.Ops == 0 {
+			t.Errorf("%s: no ops (%s)", name, r.Extra)
+		}
+	})
+
+	// Each backend, with and without write-behind, chills then reads.
+	var want []string
+	for _, b := range backendNames {
+		for _, label := range []string{b, b + "+writeback"} {
+			want = append(want, "Backend "+label+": chill all", "Backend "+label+": cold reads")
+		}
+	}
+	if strings.Join(names, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ran:\n%s\nwant:\n%s", strings.Join(names, "\n"), strings.Join(want, "\n"))
+	}
+
+	// -writeback 0 skips the write-behind runs.
+	cfg.writeBack, cfg.backends = 0, []string{"mem"}
+	names = nil
+	benchBackends(cfg, file, t.TempDir(), func(name string, fn func() BenchResult) { names = append(names, name) })
+	if len(names) != 2 {
+		t.Errorf("-writeback 0 ran %v", names)
+	}
+}
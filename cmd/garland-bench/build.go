@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/phroun/garland"
+)
+
+// benchBuild measures building the initial tree over an in-memory
+// source: the test file, already read, opened from DataBytes on one
+// core and then on all of them (GOMAXPROCS). Memory-only, so nothing
+// is chilled and the open is the build.
+func benchBuild(lib *garland.Library, cfg config, testFile string, run func(string, func() BenchResult)) {
+	data, err := os.ReadFile(testFile)
+	if err != nil {
+		fmt.Fprintf(out, "  Failed to read test file: %v\n", err)
+		return
+	}
+	procs := runtime.GOMAXPROCS(0)
+	var serial, parallel time.Duration
+	run("Open in-memory source, 1 core", func() BenchResult {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+		r := benchOpenBytes(lib, cfg, data, "Open in-memory source, 1 core")
+		serial = r.Duration
+		return r
+	})
+	if procs == 1 {
+		fmt.Fprintf(out, "  %-40s %12s\n", "Parallel build", "skipped: GOMAXPROCS is 1")
+		return
+	}
+	name := fmt.Sprintf("Open in-memory source, %d cores", procs)
+	run(name, func() BenchResult {
+		r := benchOpenBytes(lib, cfg, data, name)
+		parallel = r.Duration
+		return r
+	})
+	if parallel > 0 {
+		fmt.Fprintf(out, "  %-40s %11.1fx\n", "Parallel build speedup", float64(serial)/float64(parallel))
+	}
+}
+
+// benchOpenBytes opens data as a memory-only garland and closes it.
+func benchOpenBytes(lib *garland.Library, cfg config, data []byte, name string) BenchResult {
+	start := time.Now()
+	g, err := lib.Open(garland.FileOptions{
+		DataBytes:    data,
+		LoadingStyle: garland.MemoryOnly,
+		MaxLeafSize:  cfg.leafSize,
+	})
+	if err != nil {
+		return BenchResult{Name: name, Extra: fmt.Sprintf("ERROR: %v", err)}
+	}
+	duration := time.Since(start)
+	lines := g.LineCount().Value
+	g.Close()
+	return BenchResult{
+		Name:     name,
+		Duration: duration,
+		Extra:    fmt.Sprintf("%d lines (%.0f MB/s)", lines, float64(len(data))/(1<<20)/duration.Seconds()),
+	}
+}
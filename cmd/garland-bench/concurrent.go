@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phroun/garland"
+)
+
+// benchConcurrent runs -readers goroutines, each seeking, reading and
+// searching in turn, for -concurrent-time: first alone, then alongside
+// one writer inserting and deleting. Comparing the two runs' reader
+// throughput and latency shows how much the writer holds the readers
+// up (the contention), and the writer's own throughput how much the
+// readers hold it up.
+func benchConcurrent(g *garland.Garland, cfg config, run func(string, func() BenchResult)) {
+	var alone concurrentRun
+	name := fmt.Sprintf("Concurrent readers (%d, no writer)", cfg.readers)
+	run(name, func() BenchResult {
+		alone = runConcurrent(g, cfg, false)
+		return BenchResult{
+			Name:     name,
+			Duration: alone.duration,
+			Ops:      len(alone.latencies),
+			Extra:    fmt.Sprintf("p50 %v, p99 %v", percentile(alone.latencies, 50), percentile(alone.latencies, 99)),
+		}
+	})
+
+	name = fmt.Sprintf("Concurrent readers (%d) + 1 writer", cfg.readers)
+	run(name, func() BenchResult {
+		mixed := runConcurrent(g, cfg, true)
+		change := 0.0
+		if rate := alone.readRate(); rate > 0 {
+			change = 100 * (mixed.readRate() - rate) / rate
+		}
+		return BenchResult{
+			Name:     name,
+			Duration: mixed.duration,
+			Ops:      len(mixed.latencies),
+			Extra: fmt.Sprintf("p50 %v, p99 %v; reads %+.1f%% vs no writer; writer %d ops (%.2f ops/sec)",
+				percentile(mixed.latencies, 50), percentile(mixed.latencies, 99), change,
+				mixed.writes, float64(mixed.writes)/mixed.duration.Seconds()),
+		}
+	})
+}
+
+// concurrentRun is what one runConcurrent measured.
+type concurrentRun struct {
+	duration  time.Duration
+	latencies []time.Duration // every reader operation's, sorted
+	writes    int64
+}
+
+// readRate is the readers' operations per second.
+func (r concurrentRun) readRate() float64 {
+	if r.duration <= 0 {
+		return 0
+	}
+	return float64(len(r.latencies)) / r.duration.Seconds()
+}
+
+// minReaderOps is how many operations each reader runs however the
+// scheduler treats it: a reader the writer starved still reports, so
+// a run never measures zero reads.
+const minReaderOps = 10
+
+// runConcurrent runs the readers, and the writer if asked, until
+// -concurrent-time has passed and each has done its minimum (readers
+// minReaderOps, the writer one insert and delete). The writer deletes
+// what it inserted, so the document keeps its size.
+func runConcurrent(g *garland.Garland, cfg config, writer bool) concurrentRun {
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var res concurrentRun
+	size := g.ByteCount().Value
+
+	for i := 0; i < cfg.readers; i++ {
+		wg.Add(1)
+		go func(seed uint64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(seed, 1))
+			cursor := g.NewCursor()
+			defer g.RemoveCursor(cursor)
+			var latencies []time.Duration
+			for op := 0; op < minReaderOps || !stop.Load(); op++ {
+				t := time.Now()
+				cursor.SeekByte(rng.Int64N(max(size, 1)))
+				switch op % 3 {
+				case 1:
+					cursor.ReadBytes(cfg.readSize)
+				case 2:
+					cursor.FindString(": ", garland.SearchOptions{CaseSensitive: true})
+				}
+				latencies = append(latencies, time.Since(t))
+			}
+			mu.Lock()
+			res.latencies = append(res.latencies, latencies...)
+			mu.Unlock()
+		}(uint64(i))
+	}
+
+	if writer {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(cfg.readers), 2))
+			cursor := g.NewCursor()
+			defer g.RemoveCursor(cursor)
+			text := make([]byte, cfg.smallSize)
+			for i := range text {
+				text[i] = 'w'
+			}
+			for first := true; first || !stop.Load(); first = false {
+				pos := rng.Int64N(max(size, 1))
+				cursor.SeekByte(pos)
+				cursor.InsertBytes(text, nil, true)
+				cursor.SeekByte(pos)
+				cursor.DeleteBytes(cfg.smallSize, false)
+				atomic.AddInt64(&res.writes, 2)
+			}
+		}()
+	}
+
+	start := time.Now()
+	time.Sleep(cfg.concurrentTime)
+	stop.Store(true)
+	wg.Wait()
+	res.duration = time.Since(start)
+	slices.Sort(res.latencies)
+	return res
+}
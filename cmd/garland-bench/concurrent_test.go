@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/phroun/garland"
+)
+
+func TestConcurrentRuns(t *testing.T) {
+	cfg := smallConfig()
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	data, err := os.ReadFile(testFile(t, cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := lib.Open(garland.FileOptions{DataBytes: data, MaxLeafSize: cfg.leafSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	alone := runConcurrent(g, cfg, false)
+	if alone.writes != 0 || len(alone.latencies) < cfg.readers*minReaderOps || alone.readRate() <= 0 {
+		t.Fatalf("readers alone: %d writes, %d reads", alone.writes, len(alone.latencies))
+	}
+	if alone.duration < cfg.concurrentTime {
+		t.Errorf("ran %v of %v", alone.duration, cfg.concurrentTime)
+	}
+	mixed := runConcurrent(g, cfg, true)
+	if mixed.writes == 0 || mixed.writes%2 != 0 || len(mixed.latencies) < cfg.readers*minReaderOps {
+		t.Errorf("with a writer: %d writes, %d reads", mixed.writes, len(mixed.latencies))
+	}
+	for i := 1; i < len(mixed.latencies); i++ {
+		if mixed.latencies[i] < mixed.latencies[i-1] {
+			t.Fatal("latencies not sorted")
+		}
+	}
+
+	// The writer deletes what it inserts, and every cursor is removed.
+	if n := g.ByteCount().Value; n != int64(len(data)) {
+		t.Errorf("document is %d bytes after the runs, want %d", n, len(data))
+	}
+	if n := len(g.CursorsInOrder()); n != 0 {
+		t.Errorf("%d cursors left behind", n)
+	}
+	if (concurrentRun{}).readRate() != 0 {
+		t.Error("an empty run has a read rate")
+	}
+}
+
+func TestConcurrentReport(t *testing.T) {
+	cfg := smallConfig()
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	g, err := lib.Open(garland.FileOptions{DataString: strings.Repeat("00000001: some text\n", 500)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	var results []BenchResult
+	benchConcurrent(g, cfg, func(name string, fn func() BenchResult) { results = append(results, fn()) })
+	if len(results) != 2 {
+		t.Fatalf("%d results", len(results))
+	}
+	// Throughput depends on the scheduler; the report's shape does not.
+	minOps := cfg.readers * minReaderOps
+	if r := results[0]; r.Name != "Concurrent readers (2, no writer)" || r.Ops < minOps {
+		t.Errorf("first: %+v", r)
+	}
+	if r := results[1]; r.Name != "Concurrent readers (2) + 1 writer" || r.Ops < minOps ||
+		!strings.Contains(r.Extra, "% vs no writer; writer ") {
+		t.Errorf("second: %+v", r)
+	}
+}
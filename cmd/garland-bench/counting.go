@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/phroun/garland"
+)
+
+// benchCounting measures the rune/line counting that opening a file
+// pays for: the test file opened with the index built while loading,
+// opened with it deferred, and the deferred index then built by the
+// first LineCount. The eager open less the deferred one is the cost of
+// the counting kernels over the whole file.
+func benchCounting(lib *garland.Library, cfg config, testFile string, run func(string, func() BenchResult)) {
+	var eager, deferred time.Duration
+	run("Open, counting while loading", func() BenchResult {
+		r := benchOpenCounting(lib, cfg, testFile, garland.CountEager, "Open, counting while loading")
+		eager = r.Duration
+		return r
+	})
+	run("Open, counting deferred", func() BenchResult {
+		r := benchOpenCounting(lib, cfg, testFile, garland.CountDeferred, "Open, counting deferred")
+		deferred = r.Duration
+		return r
+	})
+	if eager > deferred {
+		fmt.Fprintf(out, "  %-40s %12v  (%.0f MB/s)\n", "Counting share of the open", (eager - deferred).Round(time.Millisecond),
+			float64(cfg.fileSize)/(1<<20)/(eager-deferred).Seconds())
+	}
+}
+
+// benchOpenCounting opens the test file in mode and waits for it to
+// load. With deferred counting it then times the first LineCount,
+// which builds the index, and reports it in Extra.
+func benchOpenCounting(lib *garland.Library, cfg config, testFile string, mode garland.CountingMode, name string) BenchResult {
+	start := time.Now()
+	g, err := lib.Open(garland.FileOptions{
+		FilePath:     testFile,
+		LoadingStyle: garland.AllStorage,
+		MaxLeafSize:  cfg.leafSize,
+		Counting:     mode,
+	})
+	if err != nil {
+		return BenchResult{Name: name, Extra: fmt.Sprintf("ERROR: %v", err)}
+	}
+	defer g.Close()
+	for !g.ByteCount().Complete {
+		time.Sleep(10 * time.Millisecond)
+	}
+	duration := time.Since(start)
+	if mode != garland.CountDeferred {
+		return BenchResult{Name: name, Duration: duration, Extra: fmt.Sprintf("%d lines", g.LineCount().Value)}
+	}
+
+	start = time.Now()
+	lines := g.LineCount().Value
+	build := time.Since(start)
+	return BenchResult{
+		Name:     name,
+		Duration: duration,
+		Extra: fmt.Sprintf("%d lines counted on first use in %v (%.0f MB/s)", lines, build.Round(time.Millisecond),
+			float64(cfg.fileSize)/(1<<20)/build.Seconds()),
+	}
+}
@@ -1,25 +1,254 @@
 // garland-bench is a benchmark and stress test for the Garland library.
-// It creates a 1GB file and measures performance of common operations.
+// It creates a test file (1GB by default) and measures performance of
+// common operations.
+//
+// Flags size the workload, so results can be gathered across realistic
+// configurations and on CI-sized datasets: -size (the test file; sizes
+// take a K, M or G suffix), -leaf (MaxLeafSize), the size and count of
+// each edit kind (-small-size, -small-edits, ...), the repetitions of
+// the other operations (-seeks, -reads, ...), the main library's
+// -soft-limit and -hard-limit, and -groups, the benchmark groups to
+// run. The memory pressure and chill groups size their limits from
+// -size (a tenth and a fifth of it; a quarter and a half), as do the
+// scenarios of the pressure-suite group, which read and edit under
+// undersized limits (-pressure-ops operations each) and report latency
+// percentiles, chills, thaws and whether the pressure flag was raised.
+//
+// The concurrency group runs -readers goroutines seeking, reading and
+// searching, without and then with a writer, for -concurrent-time each,
+// reporting throughput and how much the writer slows the readers.
+//
+// The open group also opens the test file from memory (DataBytes) on
+// one core and on all of them, showing what building the initial tree
+// in parallel gains.
+//
+// The counting group opens the test file with its rune/line index
+// built while loading and with it deferred (see garland.CountDeferred),
+// then times building the deferred index, which isolates the cost of
+// counting the whole file.
+//
+// The backends group chills the first -backend-size bytes of the test
+// file to each of the -backends cold storage backends (dir, the
+// directory store; pack, the single-file pack; mem, an in-memory store
+// sleeping -backend-latency per call) and reads it back, each with and
+// without a -writeback queue, so backends and write-behind can be
+// compared.
+//
+// -format json or csv writes the results to stdout (progress goes to
+// stderr), and -baseline compares them with an earlier JSON report,
+// exiting 1 when a benchmark is more than -threshold percent slower.
 package main
 
 import (
 	"crypto/rand"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/phroun/garland"
 )
 
-const (
-	fileSize       = 1 << 30 // 1 GB
-	chunkSize      = 64 * 1024 * 1024
-	smallEditSize  = 100
-	mediumEditSize = 10 * 1024
-	largeEditSize  = 1024 * 1024
-)
+const chunkSize = 64 * 1024 * 1024
+
+// out receives progress and the text summary: stdout, or stderr when
+// -format writes the results to stdout as JSON or CSV.
+var out io.Writer = os.Stdout
+
+// benchGroups are the benchmark groups -groups selects from, in the
+// order they run.
+var benchGroups = []string{"pressure", "open", "counting", "cursor", "edit", "transaction", "search", "undo", "decoration", "concurrency", "memory", "pressure-suite", "backends"}
+
+// config is the workload the flags describe.
+type config struct {
+	fileSize       int64
+	leafSize       int64
+	softLimit      int64
+	hardLimit      int64
+	groups         map[string]bool
+	seeks          int // rounds over five positions
+	reads          int // rounds over four positions
+	readSize       int64
+	smallSize      int64
+	smallEdits     int
+	mediumSize     int64
+	mediumEdits    int
+	largeSize      int64
+	largeEdits     int
+	txCycles       int
+	searches       int // rounds over four patterns
+	undoRevs       int // revisions undone and redone ten times
+	decorations    int
+	pressureOps    int           // operations per memory pressure suite scenario
+	readers        int           // reader goroutines of the concurrency group
+	concurrentTime time.Duration // how long each concurrency run lasts
+	backends       []string      // cold storage backends of the backends group
+	backendSize    int64         // bytes chilled to each backend
+	backendLatency time.Duration // per-call latency of the mem backend
+	writeBack      int           // write-behind queue size (0: write-through only)
+	format         string        // text, json or csv
+	baseline       string        // -format json report to compare against
+	threshold      float64       // percent slower that counts as a regression
+}
+
+// sizeFlag is a byte count flag taking a K, M or G suffix.
+type sizeFlag struct{ n *int64 }
+
+func (f sizeFlag) String() string {
+	if f.n == nil || *f.n == 0 {
+		return ""
+	}
+	return formatSize(*f.n)
+}
+
+func (f sizeFlag) Set(s string) error {
+	n, err := parseSize(s)
+	if err != nil {
+		return err
+	}
+	*f.n = n
+	return nil
+}
+
+// parseSize parses a non-negative byte count with an optional K, M or
+// G suffix (powers of 1024), which may be followed by B.
+func parseSize(s string) (int64, error) {
+	if len(s) > 1 && strings.HasSuffix(strings.ToUpper(s), "B") {
+		s = s[:len(s)-1]
+	}
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(strings.ToUpper(s), "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(strings.ToUpper(s), "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(strings.ToUpper(s), "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// formatSize formats a byte count with the largest exact unit.
+func formatSize(n int64) string {
+	switch {
+	case n != 0 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", n>>30)
+	case n != 0 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n != 0 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// parseFlags reads the workload from the command line.
+func parseFlags() config {
+	cfg := config{
+		fileSize: 1 << 30, softLimit: 2 << 30, hardLimit: 4 << 30, readSize: 64 << 10,
+		smallSize: 100, mediumSize: 10 << 10, largeSize: 1 << 20, backendSize: 64 << 20,
+	}
+	flag.Var(sizeFlag{&cfg.fileSize}, "size", "test file `size`")
+	flag.Var(sizeFlag{&cfg.leafSize}, "leaf", "MaxLeafSize `size` (the library default when unset)")
+	flag.Var(sizeFlag{&cfg.softLimit}, "soft-limit", "memory soft limit (`size`) of the main benchmark library")
+	flag.Var(sizeFlag{&cfg.hardLimit}, "hard-limit", "memory hard limit (`size`) of the main benchmark library")
+	flag.IntVar(&cfg.seeks, "seeks", 1000, "seek rounds (5 seeks each)")
+	flag.IntVar(&cfg.reads, "reads", 100, "read rounds (4 reads each)")
+	flag.Var(sizeFlag{&cfg.readSize}, "read-size", "`size` of each read")
+	flag.Var(sizeFlag{&cfg.smallSize}, "small-size", "`size` of each small insert and delete")
+	flag.IntVar(&cfg.smallEdits, "small-edits", 1000, "small inserts, and small deletes")
+	flag.Var(sizeFlag{&cfg.mediumSize}, "medium-size", "`size` of each medium insert")
+	flag.IntVar(&cfg.mediumEdits, "medium-edits", 100, "medium inserts")
+	flag.Var(sizeFlag{&cfg.largeSize}, "large-size", "`size` of each large insert")
+	flag.IntVar(&cfg.largeEdits, "large-edits", 10, "large inserts")
+	flag.IntVar(&cfg.txCycles, "transactions", 100, "transaction cycles")
+	flag.IntVar(&cfg.searches, "searches", 25, "search rounds (4 patterns each)")
+	flag.IntVar(&cfg.undoRevs, "undo-revisions", 50, "revisions undone and redone")
+	flag.IntVar(&cfg.decorations, "decorations", 1000, "decorations added, queried and removed")
+	flag.StringVar(&cfg.format, "format", "text", "results `format`: text, json or csv (json and csv go to stdout, progress to stderr)")
+	flag.StringVar(&cfg.baseline, "baseline", "", "compare against the -format json report in `file`, exiting 1 on regressions")
+	flag.Float64Var(&cfg.threshold, "threshold", 10, "`percent` slower than the baseline that counts as a regression")
+	flag.IntVar(&cfg.pressureOps, "pressure-ops", 2000, "operations per memory pressure suite scenario")
+	flag.IntVar(&cfg.readers, "readers", 4, "reader goroutines in the concurrency benchmarks")
+	flag.DurationVar(&cfg.concurrentTime, "concurrent-time", 2*time.Second, "`duration` of each concurrency benchmark")
+	flag.Var(sizeFlag{&cfg.backendSize}, "backend-size", "`size` of the document chilled to each cold storage backend")
+	flag.DurationVar(&cfg.backendLatency, "backend-latency", time.Millisecond, "per-call `latency` of the mem cold storage backend")
+	flag.IntVar(&cfg.writeBack, "writeback", 64, "write-behind queue `blocks` for the backend write-back runs (0 skips them)")
+	backends := flag.String("backends", strings.Join(backendNames, ","), "comma-separated cold storage `backends`: "+strings.Join(backendNames, ", "))
+	groups := flag.String("groups", "all", "comma-separated benchmark `groups`: "+strings.Join(benchGroups, ", "))
+	flag.Parse()
+
+	if cfg.readers < 1 {
+		fmt.Fprintln(os.Stderr, "-readers must be positive")
+		os.Exit(2)
+	}
+	if cfg.fileSize < 1 {
+		fmt.Fprintln(os.Stderr, "-size must be positive")
+		os.Exit(2)
+	}
+	switch cfg.format {
+	case "text":
+	case "json", "csv":
+		out = os.Stderr
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q (have text, json, csv)\n", cfg.format)
+		os.Exit(2)
+	}
+	for _, name := range strings.Split(*backends, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(backendNames, name) {
+			fmt.Fprintf(os.Stderr, "unknown cold storage backend %q (have %s)\n", name, strings.Join(backendNames, ", "))
+			os.Exit(2)
+		}
+		cfg.backends = append(cfg.backends, name)
+	}
+	var err error
+	if cfg.groups, err = parseGroups(*groups); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return cfg
+}
+
+// parseGroups parses the -groups list: names from benchGroups, or
+// "all" for every group.
+func parseGroups(list string) (map[string]bool, error) {
+	groups := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		known := name == "all"
+		for _, g := range benchGroups {
+			if name == g || name == "all" {
+				groups[g] = true
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown benchmark group %q (have %s)", name, strings.Join(benchGroups, ", "))
+		}
+	}
+	return groups, nil
+}
+
+// wrap keeps an edit position inside a file of size bytes.
+func wrap(pos, size int64) int64 {
+	if size <= 0 {
+		return 0
+	}
+	return pos % size
+}
 
 type BenchResult struct {
 	Name     string
@@ -43,124 +272,94 @@ func (r BenchResult) String() string {
 }
 
 func main() {
-	fmt.Println("Garland Benchmark and Stress Test")
-	fmt.Println("==================================")
-	fmt.Printf("File size: %d MB\n", fileSize/(1024*1024))
-	fmt.Printf("Go version: %s\n", runtime.Version())
-	fmt.Printf("GOMAXPROCS: %d\n", runtime.GOMAXPROCS(0))
-	fmt.Println()
+	cfg := parseFlags()
+
+	fmt.Fprintln(out, "Garland Benchmark and Stress Test")
+	fmt.Fprintln(out, "==================================")
+	fmt.Fprintf(out, "File size: %s\n", formatSize(cfg.fileSize))
+	if cfg.leafSize > 0 {
+		fmt.Fprintf(out, "Leaf size: %s\n", formatSize(cfg.leafSize))
+	}
+	fmt.Fprintf(out, "Go version: %s\n", runtime.Version())
+	fmt.Fprintf(out, "GOMAXPROCS: %d\n", runtime.GOMAXPROCS(0))
+	fmt.Fprintln(out)
 
 	// Create temporary directory
 	tmpDir, err := os.MkdirTemp("", "garland-bench-*")
 	if err != nil {
-		fmt.Printf("Failed to create temp dir: %v\n", err)
+		fmt.Fprintf(out, "Failed to create temp dir: %v\n", err)
 		os.Exit(1)
 	}
 	defer os.RemoveAll(tmpDir)
 
-	testFile := filepath.Join(tmpDir, "test-1gb.txt")
+	testFile := filepath.Join(tmpDir, "test.txt")
 	coldStorage := filepath.Join(tmpDir, "cold")
 
 	var results []BenchResult
 
 	// Generate test file
-	fmt.Println("Generating 1GB test file...")
-	result := generateTestFile(testFile)
+	fmt.Fprintf(out, "Generating %s test file...\n", formatSize(cfg.fileSize))
+	result := generateTestFile(testFile, cfg.fileSize)
 	results = append(results, result)
-	fmt.Println(result)
-	fmt.Println()
+	fmt.Fprintln(out, result)
+	fmt.Fprintln(out)
 
 	// Helper to run and print each benchmark
 	runBench := func(name string, fn func() BenchResult) {
-		fmt.Printf("  %-40s ", name+"...")
+		fmt.Fprintf(out, "  %-40s ", name+"...")
 		result := fn()
-		fmt.Printf("%v\n", result.Duration.Round(time.Millisecond))
+		fmt.Fprintf(out, "%v\n", result.Duration.Round(time.Millisecond))
 		results = append(results, result)
 	}
 
 	// =======================================================================
 	// TEST 1: Memory pressure detection (no cold storage, low memory limit)
 	// =======================================================================
-	fmt.Println("Testing memory pressure detection (no cold storage)...")
-	fmt.Println()
-
-	libNoCold, err := garland.Init(garland.LibraryOptions{
-		// No ColdStoragePath - can't evict anywhere
-		MemorySoftLimit: 100 * 1024 * 1024, // 100 MB
-		MemoryHardLimit: 200 * 1024 * 1024, // 200 MB
-	})
-	if err != nil {
-		fmt.Printf("Failed to init library: %v\n", err)
-		os.Exit(1)
-	}
-
-	fmt.Println("  Opening 1GB file with 200MB limit and no cold storage...")
-	fmt.Println("  (This should trigger memory pressure)")
-	gPressure, err := libNoCold.Open(garland.FileOptions{
-		FilePath:     testFile,
-		LoadingStyle: garland.MemoryOnly,
-	})
-	if err != nil {
-		fmt.Printf("  Open error: %v\n", err)
-	} else {
-		// Wait a bit for loading to progress and hit the limit
-		for i := 0; i < 50; i++ {
-			time.Sleep(100 * time.Millisecond)
-			stats := gPressure.MemoryUsage()
-			if stats.UnderPressure {
-				fmt.Printf("  Memory pressure detected after loading %d MB\n", stats.MemoryBytes/(1024*1024))
-				break
-			}
-			if gPressure.ByteCount().Complete {
-				break
-			}
-		}
-
-		stats := gPressure.MemoryUsage()
-		fmt.Printf("  Final state: %d MB loaded, pressure=%v\n", stats.MemoryBytes/(1024*1024), stats.UnderPressure)
-
-		// Check the error helper
-		if err := libNoCold.CheckMemoryPressureError(); err != nil {
-			fmt.Printf("  CheckMemoryPressureError() returned: %v\n", err)
-		} else {
-			fmt.Println("  CheckMemoryPressureError() returned: nil (no pressure)")
-		}
-
-		gPressure.Close()
+	if cfg.groups["pressure"] {
+		benchPressure(cfg, testFile)
 	}
-	fmt.Println()
 
 	// =======================================================================
 	// TEST 2: Normal benchmarks with cold storage
 	// =======================================================================
-	fmt.Println("Running benchmarks with cold storage enabled...")
-	fmt.Println()
+	fmt.Fprintln(out, "Running benchmarks with cold storage enabled...")
+	fmt.Fprintln(out)
 
 	// Initialize library with generous memory for benchmark
 	lib, err := garland.Init(garland.LibraryOptions{
 		ColdStoragePath: coldStorage,
-		MemorySoftLimit: 2 * 1024 * 1024 * 1024, // 2 GB
-		MemoryHardLimit: 4 * 1024 * 1024 * 1024, // 4 GB
+		MemorySoftLimit: cfg.softLimit,
+		MemoryHardLimit: cfg.hardLimit,
 	})
 	if err != nil {
-		fmt.Printf("Failed to init library: %v\n", err)
+		fmt.Fprintf(out, "Failed to init library: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Open file benchmark
-	fmt.Println("File opening:")
-	runBench("Open file (all storage tiers)", func() BenchResult {
-		return benchOpenFile(lib, testFile, garland.AllStorage, "Open file (all storage tiers)")
-	})
+	if cfg.groups["open"] {
+		fmt.Fprintln(out, "File opening:")
+		runBench("Open file (all storage tiers)", func() BenchResult {
+			return benchOpenFile(lib, testFile, garland.AllStorage, cfg.leafSize, "Open file (all storage tiers)")
+		})
+		benchBuild(lib, cfg, testFile, runBench)
+	}
+
+	// Rune/line counting - eager against deferred
+	if cfg.groups["counting"] {
+		fmt.Fprintln(out, "\nRune/line counting:")
+		benchCounting(lib, cfg, testFile, runBench)
+	}
 
 	// Open file for remaining operations
-	fmt.Println("\nOpening file for operation benchmarks...")
+	fmt.Fprintln(out, "\nOpening file for operation benchmarks...")
 	g, err := lib.Open(garland.FileOptions{
 		FilePath:     testFile,
 		LoadingStyle: garland.AllStorage,
+		MaxLeafSize:  cfg.leafSize,
 	})
 	if err != nil {
-		fmt.Printf("Failed to open file: %v\n", err)
+		fmt.Fprintf(out, "Failed to open file: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -168,76 +367,159 @@ func main() {
 	for !g.ByteCount().Complete {
 		time.Sleep(100 * time.Millisecond)
 	}
-	fmt.Printf("File ready: %d bytes, %d lines\n\n", g.ByteCount().Value, g.LineCount().Value)
+	fmt.Fprintf(out, "File ready: %d bytes, %d lines\n\n", g.ByteCount().Value, g.LineCount().Value)
 
 	// Cursor operations
-	fmt.Println("Cursor operations:")
-	runBench("Seek operations (byte)", func() BenchResult { return benchSeekOperations(g) })
-	runBench("Read operations (64KB chunks)", func() BenchResult { return benchReadOperations(g) })
+	if cfg.groups["cursor"] {
+		fmt.Fprintln(out, "Cursor operations:")
+		runBench("Seek operations (byte)", func() BenchResult { return benchSeekOperations(g, cfg) })
+		name := fmt.Sprintf("Read operations (%s chunks)", formatSize(cfg.readSize))
+		runBench(name, func() BenchResult { return benchReadOperations(g, cfg, name) })
+	}
 
 	// Edit operations
-	fmt.Println("\nEdit operations:")
-	runBench("Small inserts (100 bytes x 1000)", func() BenchResult { return benchSmallInserts(g) })
-	runBench("Small deletes (100 bytes x 1000)", func() BenchResult { return benchSmallDeletes(g) })
-	runBench("Medium inserts (10KB x 100)", func() BenchResult { return benchMediumInserts(g) })
-	runBench("Large inserts (1MB x 10)", func() BenchResult { return benchLargeInserts(g) })
+	if cfg.groups["edit"] {
+		fmt.Fprintln(out, "\nEdit operations:")
+		name := fmt.Sprintf("Small inserts (%s x %d)", formatSize(cfg.smallSize), cfg.smallEdits)
+		runBench(name, func() BenchResult { return benchInserts(g, cfg.smallSize, cfg.smallEdits, 1000, 'x', name) })
+		name = fmt.Sprintf("Small deletes (%s x %d)", formatSize(cfg.smallSize), cfg.smallEdits)
+		runBench(name, func() BenchResult { return benchSmallDeletes(g, cfg, name) })
+		name = fmt.Sprintf("Medium inserts (%s x %d)", formatSize(cfg.mediumSize), cfg.mediumEdits)
+		runBench(name, func() BenchResult { return benchInserts(g, cfg.mediumSize, cfg.mediumEdits, 10000, 'y', name) })
+		name = fmt.Sprintf("Large inserts (%s x %d)", formatSize(cfg.largeSize), cfg.largeEdits)
+		runBench(name, func() BenchResult { return benchInserts(g, cfg.largeSize, cfg.largeEdits, 100000, 'z', name) })
+	}
 
 	// Transaction operations
-	fmt.Println("\nTransaction operations:")
-	runBench("Transaction cycles", func() BenchResult { return benchTransactions(g) })
+	if cfg.groups["transaction"] {
+		fmt.Fprintln(out, "\nTransaction operations:")
+		runBench("Transaction cycles", func() BenchResult { return benchTransactions(g, cfg) })
+	}
 
 	// Search operations
-	fmt.Println("\nSearch operations:")
-	runBench("Search (find first)", func() BenchResult { return benchSearch(g) })
-	runBench("Search all occurrences", func() BenchResult { return benchSearchAll(g) })
+	if cfg.groups["search"] {
+		fmt.Fprintln(out, "\nSearch operations:")
+		runBench("Search (find first)", func() BenchResult { return benchSearch(g, cfg) })
+		runBench("Search all occurrences", func() BenchResult { return benchSearchAll(g) })
+	}
 
 	// Undo operations
-	fmt.Println("\nUndo/redo operations:")
-	runBench("Undo/redo cycles", func() BenchResult { return benchUndoRedo(g) })
+	if cfg.groups["undo"] {
+		fmt.Fprintln(out, "\nUndo/redo operations:")
+		runBench("Undo/redo cycles", func() BenchResult { return benchUndoRedo(g, cfg) })
+	}
 
 	// Decoration operations
-	fmt.Println("\nDecoration operations:")
-	runBench("Decoration add/query/remove", func() BenchResult { return benchDecorations(g) })
+	if cfg.groups["decoration"] {
+		fmt.Fprintln(out, "\nDecoration operations:")
+		runBench("Decoration add/query/remove", func() BenchResult { return benchDecorations(g, cfg) })
+	}
 
-	// Memory management - use a separate library with lower limits
-	fmt.Println("\nMemory management:")
+	// Concurrent access
+	if cfg.groups["concurrency"] {
+		fmt.Fprintln(out, "\nConcurrent access:")
+		benchConcurrent(g, cfg, runBench)
+	}
 	g.Close()
 
-	// Re-init with lower memory to test chilling
-	lib2, _ := garland.Init(garland.LibraryOptions{
-		ColdStoragePath: coldStorage,
-		MemorySoftLimit: 256 * 1024 * 1024, // 256 MB
-		MemoryHardLimit: 512 * 1024 * 1024, // 512 MB
+	// Memory management - use a separate library with lower limits
+	if cfg.groups["memory"] {
+		fmt.Fprintln(out, "\nMemory management:")
+
+		// Re-init with lower memory to test chilling
+		lib2, _ := garland.Init(garland.LibraryOptions{
+			ColdStoragePath: coldStorage,
+			MemorySoftLimit: cfg.fileSize / 4,
+			MemoryHardLimit: cfg.fileSize / 2,
+		})
+		g2, _ := lib2.Open(garland.FileOptions{
+			FilePath:     testFile,
+			LoadingStyle: garland.AllStorage,
+			MaxLeafSize:  cfg.leafSize,
+		})
+		if g2 != nil {
+			for !g2.ByteCount().Complete {
+				time.Sleep(100 * time.Millisecond)
+			}
+			runBench("Chill unused data", func() BenchResult { return benchChill(g2) })
+			g2.Close()
+		}
+	}
+
+	// Memory pressure suite - reads and edits under undersized limits
+	if cfg.groups["pressure-suite"] {
+		fmt.Fprintln(out, "\nMemory pressure suite:")
+		benchPressureSuite(cfg, testFile, coldStorage, runBench)
+	}
+
+	// Cold storage backends - chill and thaw against each backend
+	if cfg.groups["backends"] {
+		fmt.Fprintln(out, "\nCold storage backends:")
+		benchBackends(cfg, testFile, tmpDir, runBench)
+	}
+
+	if code := summarize(cfg, results); code != 0 {
+		os.RemoveAll(tmpDir) // os.Exit skips the deferred cleanup
+		os.Exit(code)
+	}
+}
+
+// benchPressure opens the test file in a library without cold storage
+// whose limits are a tenth and a fifth of the file, which should
+// trigger memory pressure.
+func benchPressure(cfg config, testFile string) {
+	fmt.Fprintln(out, "Testing memory pressure detection (no cold storage)...")
+	fmt.Fprintln(out)
+
+	libNoCold, err := garland.Init(garland.LibraryOptions{
+		// No ColdStoragePath - can't evict anywhere
+		MemorySoftLimit: cfg.fileSize / 10,
+		MemoryHardLimit: cfg.fileSize / 5,
 	})
-	g2, _ := lib2.Open(garland.FileOptions{
+	if err != nil {
+		fmt.Fprintf(out, "Failed to init library: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(out, "  Opening %s file with %s limit and no cold storage...\n", formatSize(cfg.fileSize), formatSize(cfg.fileSize/5))
+	fmt.Fprintln(out, "  (This should trigger memory pressure)")
+	gPressure, err := libNoCold.Open(garland.FileOptions{
 		FilePath:     testFile,
-		LoadingStyle: garland.AllStorage,
+		LoadingStyle: garland.MemoryOnly,
+		MaxLeafSize:  cfg.leafSize,
 	})
-	if g2 != nil {
-		for !g2.ByteCount().Complete {
+	if err != nil {
+		fmt.Fprintf(out, "  Open error: %v\n", err)
+	} else {
+		// Wait a bit for loading to progress and hit the limit
+		for i := 0; i < 50; i++ {
 			time.Sleep(100 * time.Millisecond)
+			stats := gPressure.MemoryUsage()
+			if stats.UnderPressure {
+				fmt.Fprintf(out, "  Memory pressure detected after loading %d MB\n", stats.MemoryBytes/(1024*1024))
+				break
+			}
+			if gPressure.ByteCount().Complete {
+				break
+			}
 		}
-		runBench("Chill unused data", func() BenchResult { return benchChill(g2) })
-		g2.Close()
-	}
 
-	// Print summary
-	fmt.Println("\n" + "=")
-	fmt.Println("SUMMARY")
-	fmt.Println("=")
-	for _, r := range results {
-		fmt.Println(r)
-	}
+		stats := gPressure.MemoryUsage()
+		fmt.Fprintf(out, "  Final state: %d MB loaded, pressure=%v\n", stats.MemoryBytes/(1024*1024), stats.UnderPressure)
 
-	// Memory stats
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	fmt.Println()
-	fmt.Printf("Peak heap allocation: %d MB\n", m.HeapSys/(1024*1024))
-	fmt.Printf("Total allocations: %d MB\n", m.TotalAlloc/(1024*1024))
+		// Check the error helper
+		if err := libNoCold.CheckMemoryPressureError(); err != nil {
+			fmt.Fprintf(out, "  CheckMemoryPressureError() returned: %v\n", err)
+		} else {
+			fmt.Fprintln(out, "  CheckMemoryPressureError() returned: nil (no pressure)")
+		}
+
+		gPressure.Close()
+	}
+	fmt.Fprintln(out)
 }
 
-func generateTestFile(path string) BenchResult {
+func generateTestFile(path string, fileSize int64) BenchResult {
 	start := time.Now()
 
 	f, err := os.Create(path)
@@ -293,12 +575,13 @@ func generateTestFile(path string) BenchResult {
 	}
 }
 
-func benchOpenFile(lib *garland.Library, path string, style garland.LoadingStyle, name string) BenchResult {
+func benchOpenFile(lib *garland.Library, path string, style garland.LoadingStyle, leafSize int64, name string) BenchResult {
 	start := time.Now()
 
 	g, err := lib.Open(garland.FileOptions{
 		FilePath:     path,
 		LoadingStyle: style,
+		MaxLeafSize:  leafSize,
 	})
 	if err != nil {
 		return BenchResult{Name: name, Duration: 0, Extra: fmt.Sprintf("ERROR: %v", err)}
@@ -321,7 +604,7 @@ func benchOpenFile(lib *garland.Library, path string, style garland.LoadingStyle
 	}
 }
 
-func benchSeekOperations(g *garland.Garland) BenchResult {
+func benchSeekOperations(g *garland.Garland, cfg config) BenchResult {
 	cursor := g.NewCursor()
 	defer g.RemoveCursor(cursor)
 
@@ -331,7 +614,7 @@ func benchSeekOperations(g *garland.Garland) BenchResult {
 
 	// Random seeks across the file
 	positions := []int64{0, byteCount / 4, byteCount / 2, byteCount * 3 / 4, byteCount - 1}
-	for i := 0; i < 1000; i++ {
+	for i := 0; i < cfg.seeks; i++ {
 		for _, pos := range positions {
 			cursor.SeekByte(pos)
 			ops++
@@ -345,7 +628,7 @@ func benchSeekOperations(g *garland.Garland) BenchResult {
 	}
 }
 
-func benchReadOperations(g *garland.Garland) BenchResult {
+func benchReadOperations(g *garland.Garland, cfg config, name string) BenchResult {
 	cursor := g.NewCursor()
 	defer g.RemoveCursor(cursor)
 
@@ -356,10 +639,10 @@ func benchReadOperations(g *garland.Garland) BenchResult {
 
 	// Read chunks from various positions
 	positions := []int64{0, byteCount / 4, byteCount / 2, byteCount * 3 / 4}
-	for i := 0; i < 100; i++ {
+	for i := 0; i < cfg.reads; i++ {
 		for _, pos := range positions {
 			cursor.SeekByte(pos)
-			data, err := cursor.ReadBytes(64 * 1024) // 64KB reads
+			data, err := cursor.ReadBytes(cfg.readSize)
 			if err == nil {
 				bytesRead += int64(len(data))
 				ops++
@@ -368,31 +651,32 @@ func benchReadOperations(g *garland.Garland) BenchResult {
 	}
 
 	return BenchResult{
-		Name:     "Read operations (64KB chunks)",
+		Name:     name,
 		Duration: time.Since(start),
 		Ops:      ops,
 		Extra:    fmt.Sprintf("%d MB read", bytesRead/(1024*1024)),
 	}
 }
 
-func benchSmallInserts(g *garland.Garland) BenchResult {
+// benchInserts inserts count runs of size bytes of fill, stride bytes
+// apart (wrapping at the end of the file), in one transaction.
+func benchInserts(g *garland.Garland, size int64, count int, stride int64, fill byte, name string) BenchResult {
 	cursor := g.NewCursor()
 	defer g.RemoveCursor(cursor)
 
 	ops := 0
-	smallText := make([]byte, smallEditSize)
-	for i := range smallText {
-		smallText[i] = 'x'
+	text := make([]byte, size)
+	for i := range text {
+		text[i] = fill
 	}
 
 	start := time.Now()
 
-	// Insert small chunks at various positions
-	g.TransactionStart("small inserts")
-	for i := 0; i < 1000; i++ {
-		pos := int64(i * 1000)
-		cursor.SeekByte(pos)
-		cursor.InsertBytes(smallText, nil, true)
+	g.TransactionStart(name)
+	fileSize := g.ByteCount().Value
+	for i := 0; i < count; i++ {
+		cursor.SeekByte(wrap(int64(i)*stride, fileSize))
+		cursor.InsertBytes(text, nil, true)
 		ops++
 	}
 	g.TransactionCommit()
@@ -403,13 +687,13 @@ func benchSmallInserts(g *garland.Garland) BenchResult {
 	g.UndoSeek(g.CurrentRevision() - 1)
 
 	return BenchResult{
-		Name:     "Small inserts (100 bytes x 1000)",
+		Name:     name,
 		Duration: duration,
 		Ops:      ops,
 	}
 }
 
-func benchSmallDeletes(g *garland.Garland) BenchResult {
+func benchSmallDeletes(g *garland.Garland, cfg config, name string) BenchResult {
 	cursor := g.NewCursor()
 	defer g.RemoveCursor(cursor)
 
@@ -417,10 +701,10 @@ func benchSmallDeletes(g *garland.Garland) BenchResult {
 	start := time.Now()
 
 	g.TransactionStart("small deletes")
-	for i := 0; i < 1000; i++ {
-		pos := int64(i * 1000)
-		cursor.SeekByte(pos)
-		cursor.DeleteBytes(smallEditSize, false)
+	size := g.ByteCount().Value
+	for i := 0; i < cfg.smallEdits; i++ {
+		cursor.SeekByte(wrap(int64(i)*1000, size))
+		cursor.DeleteBytes(cfg.smallSize, false)
 		ops++
 	}
 	g.TransactionCommit()
@@ -431,79 +715,13 @@ func benchSmallDeletes(g *garland.Garland) BenchResult {
 	g.UndoSeek(g.CurrentRevision() - 1)
 
 	return BenchResult{
-		Name:     "Small deletes (100 bytes x 1000)",
-		Duration: duration,
-		Ops:      ops,
-	}
-}
-
-func benchMediumInserts(g *garland.Garland) BenchResult {
-	cursor := g.NewCursor()
-	defer g.RemoveCursor(cursor)
-
-	ops := 0
-	mediumText := make([]byte, mediumEditSize)
-	for i := range mediumText {
-		mediumText[i] = 'y'
-	}
-
-	start := time.Now()
-
-	g.TransactionStart("medium inserts")
-	for i := 0; i < 100; i++ {
-		pos := int64(i * 10000)
-		cursor.SeekByte(pos)
-		cursor.InsertBytes(mediumText, nil, true)
-		ops++
-	}
-	g.TransactionCommit()
-
-	duration := time.Since(start)
-
-	// Rollback to clean up
-	g.UndoSeek(g.CurrentRevision() - 1)
-
-	return BenchResult{
-		Name:     "Medium inserts (10KB x 100)",
-		Duration: duration,
-		Ops:      ops,
-	}
-}
-
-func benchLargeInserts(g *garland.Garland) BenchResult {
-	cursor := g.NewCursor()
-	defer g.RemoveCursor(cursor)
-
-	ops := 0
-	largeText := make([]byte, largeEditSize)
-	for i := range largeText {
-		largeText[i] = 'z'
-	}
-
-	start := time.Now()
-
-	g.TransactionStart("large inserts")
-	for i := 0; i < 10; i++ {
-		pos := int64(i * 100000)
-		cursor.SeekByte(pos)
-		cursor.InsertBytes(largeText, nil, true)
-		ops++
-	}
-	g.TransactionCommit()
-
-	duration := time.Since(start)
-
-	// Rollback to clean up
-	g.UndoSeek(g.CurrentRevision() - 1)
-
-	return BenchResult{
-		Name:     "Large inserts (1MB x 10)",
+		Name:     name,
 		Duration: duration,
 		Ops:      ops,
 	}
 }
 
-func benchTransactions(g *garland.Garland) BenchResult {
+func benchTransactions(g *garland.Garland, cfg config) BenchResult {
 	cursor := g.NewCursor()
 	defer g.RemoveCursor(cursor)
 
@@ -513,7 +731,7 @@ func benchTransactions(g *garland.Garland) BenchResult {
 
 	start := time.Now()
 
-	for i := 0; i < 100; i++ {
+	for i := 0; i < cfg.txCycles; i++ {
 		g.TransactionStart(fmt.Sprintf("tx-%d", i))
 		cursor.SeekByte(0)
 		cursor.InsertBytes(text, nil, true)
@@ -533,7 +751,7 @@ func benchTransactions(g *garland.Garland) BenchResult {
 	}
 }
 
-func benchSearch(g *garland.Garland) BenchResult {
+func benchSearch(g *garland.Garland, cfg config) BenchResult {
 	cursor := g.NewCursor()
 	defer g.RemoveCursor(cursor)
 
@@ -542,7 +760,7 @@ func benchSearch(g *garland.Garland) BenchResult {
 
 	// Search for line number patterns
 	patterns := []string{"00001000:", "00010000:", "00100000:", "01000000:"}
-	for i := 0; i < 25; i++ {
+	for i := 0; i < cfg.searches; i++ {
 		for _, pattern := range patterns {
 			cursor.SeekByte(0)
 			_, err := cursor.FindString(pattern, garland.SearchOptions{CaseSensitive: true})
@@ -583,7 +801,7 @@ func benchSearchAll(g *garland.Garland) BenchResult {
 	}
 }
 
-func benchUndoRedo(g *garland.Garland) BenchResult {
+func benchUndoRedo(g *garland.Garland, cfg config) BenchResult {
 	cursor := g.NewCursor()
 	defer g.RemoveCursor(cursor)
 
@@ -591,7 +809,7 @@ func benchUndoRedo(g *garland.Garland) BenchResult {
 	startRev := g.CurrentRevision()
 	text := []byte("undo test")
 
-	for i := 0; i < 50; i++ {
+	for i := 0; i < cfg.undoRevs; i++ {
 		g.TransactionStart("")
 		cursor.SeekByte(0)
 		cursor.InsertBytes(text, nil, true)
@@ -629,15 +847,16 @@ func benchUndoRedo(g *garland.Garland) BenchResult {
 	}
 }
 
-func benchDecorations(g *garland.Garland) BenchResult {
+func benchDecorations(g *garland.Garland, cfg config) BenchResult {
 	ops := 0
 	byteCount := g.ByteCount().Value
 
 	start := time.Now()
 
 	// Add decorations
-	for i := 0; i < 1000; i++ {
-		pos := int64(i) * (byteCount / 1000)
+	n := cfg.decorations
+	for i := 0; i < n; i++ {
+		pos := int64(i) * (byteCount / int64(max(n, 1)))
 		addr := garland.AbsoluteAddress{
 			Mode: garland.ByteMode,
 			Byte: pos,
@@ -650,7 +869,7 @@ func benchDecorations(g *garland.Garland) BenchResult {
 	}
 
 	// Query decorations
-	for i := 0; i < 1000; i++ {
+	for i := 0; i < n; i++ {
 		_, err := g.GetDecorationPosition(fmt.Sprintf("mark-%d", i))
 		if err == nil {
 			ops++
@@ -662,7 +881,7 @@ func benchDecorations(g *garland.Garland) BenchResult {
 	ops += len(decorations)
 
 	// Remove decorations
-	for i := 0; i < 1000; i++ {
+	for i := 0; i < n; i++ {
 		g.Decorate([]garland.DecorationEntry{{
 			Key:     fmt.Sprintf("mark-%d", i),
 			Address: nil, // nil to delete
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{
+		"0": 0, "100": 100, "4K": 4 << 10, "4kb": 4 << 10, "64M": 64 << 20,
+		"64MB": 64 << 20, "2G": 2 << 30, "2gB": 2 << 30, "1B": 1,
+	} {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "K", "-1", "1.5M", "12X", "M4"} {
+		if n, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) = %d, want an error", in, n)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		0: "0 bytes", 100: "100 bytes", 1536: "1536 bytes", 4 << 10: "4KB",
+		3 << 20: "3MB", 1 << 30: "1GB", 1025 << 10: "1025KB",
+	} {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+	// What formatSize writes, parseSize reads back.
+	for _, n := range []int64{4 << 10, 3 << 20, 1 << 30} {
+		if got, _ := parseSize(formatSize(n)); got != n {
+			t.Errorf("%d round-trips to %d", n, got)
+		}
+	}
+}
+
+func TestSizeFlag(t *testing.T) {
+	var n int64 = 1 << 20
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.Var(sizeFlag{&n}, "size", "")
+	if err := fs.Parse([]string{"-size", "16K"}); err != nil || n != 16<<10 {
+		t.Fatalf("-size 16K: %d, %v", n, err)
+	}
+	if s := fs.Lookup("size").Value.String(); s != "16KB" {
+		t.Errorf("String() = %q", s)
+	}
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse([]string{"-size", "lots"}); err == nil || n != 16<<10 {
+		t.Errorf("-size lots: %d, %v; want an error and no change", n, err)
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	all, err := parseGroups("all")
+	if err != nil || len(all) != len(benchGroups) {
+		t.Fatalf("all: %v, %v", all, err)
+	}
+	got, err := parseGroups(" edit,search , undo")
+	want := map[string]bool{"edit": true, "search": true, "undo": true}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("edit,search,undo: %v, %v", got, err)
+	}
+	if got, err := parseGroups("edit,all"); err != nil || len(got) != len(benchGroups) {
+		t.Errorf("edit,all: %v, %v", got, err)
+	}
+	for _, list := range []string{"edits", "edit,", ""} {
+		if _, err := parseGroups(list); err == nil {
+			t.Errorf("%q: want an error", list)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/phroun/garland"
+)
+
+// pressureScenario is a memory pressure suite configuration: limits as
+// fractions of the test file, so the same scenario undersizes them
+// whatever -size is.
+type pressureScenario struct {
+	name       string
+	softDiv    int64 // soft limit = file size / softDiv
+	hardDiv    int64 // hard limit = file size / hardDiv
+	editEach   int   // every editEach-th operation is an insert (0: reads only)
+	memoryOnly bool  // no cold or warm storage to evict to: pressure is expected
+}
+
+var pressureScenarios = []pressureScenario{
+	{"Pressure reads (1/8, 1/4)", 8, 4, 0, false},
+	{"Pressure mixed (1/8, 1/4)", 8, 4, 4, false},
+	{"Pressure mixed (1/64, 1/32)", 64, 32, 4, false},
+	{"Pressure mixed, memory only (1/8, 1/4)", 8, 4, 4, true},
+}
+
+// benchPressureSuite runs each scenario: reads of -read-size at random
+// positions, with a small insert every editEach operations, against a
+// library whose limits are too small for the file, while background
+// maintenance chills. Each result reports the latency percentiles,
+// the chills and thaws the run caused, and whether the pressure flag
+// was raised.
+func benchPressureSuite(cfg config, testFile, coldDir string, run func(string, func() BenchResult)) {
+	for i, sc := range pressureScenarios {
+		dir := filepath.Join(coldDir, fmt.Sprintf("pressure-%d", i))
+		run(sc.name, func() BenchResult { return benchPressureScenario(cfg, sc, testFile, dir) })
+	}
+}
+
+func benchPressureScenario(cfg config, sc pressureScenario, testFile, coldDir string) BenchResult {
+	name := sc.name
+	opts := garland.LibraryOptions{
+		ColdStoragePath:    coldDir,
+		MemorySoftLimit:    max(cfg.fileSize/sc.softDiv, 1),
+		MemoryHardLimit:    max(cfg.fileSize/sc.hardDiv, 1),
+		BackgroundInterval: 10 * time.Millisecond,
+	}
+	style := garland.AllStorage
+	if sc.memoryOnly {
+		opts.ColdStoragePath, style = "", garland.MemoryOnly
+	}
+	lib, err := garland.Init(opts)
+	if err != nil {
+		return BenchResult{Name: name, Extra: fmt.Sprintf("ERROR: %v", err)}
+	}
+	defer lib.Close()
+	g, err := lib.Open(garland.FileOptions{
+		FilePath:     testFile,
+		LoadingStyle: style,
+		MaxLeafSize:  cfg.leafSize,
+	})
+	if err != nil {
+		return BenchResult{Name: name, Extra: fmt.Sprintf("ERROR: %v", err)}
+	}
+	defer g.Close()
+	for !g.ByteCount().Complete {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cursor := g.NewCursor()
+	defer g.RemoveCursor(cursor)
+	edit := make([]byte, cfg.smallSize)
+	for i := range edit {
+		edit[i] = 'p'
+	}
+
+	rng := rand.New(rand.NewPCG(1, uint64(sc.softDiv)))
+	before := g.MemoryUsage()
+	pressure := false
+	latencies := make([]time.Duration, 0, cfg.pressureOps)
+	start := time.Now()
+	for i := 0; i < cfg.pressureOps; i++ {
+		pos := rng.Int64N(max(g.ByteCount().Value, 1))
+		t := time.Now()
+		cursor.SeekByte(pos)
+		if sc.editEach > 0 && i%sc.editEach == sc.editEach-1 {
+			cursor.InsertBytes(edit, nil, true)
+		} else {
+			cursor.ReadBytes(cfg.readSize)
+		}
+		latencies = append(latencies, time.Since(t))
+		if i%64 == 0 && lib.MemoryPressure() {
+			pressure = true
+		}
+	}
+	duration := time.Since(start)
+	after := g.MemoryUsage()
+	pressure = pressure || after.UnderPressure
+
+	slices.Sort(latencies)
+	chills := after.Chills + after.WarmEvictions - before.Chills - before.WarmEvictions
+	thaws := after.Thaws + after.WarmReads - before.Thaws - before.WarmReads
+	return BenchResult{
+		Name:     name,
+		Duration: duration,
+		Ops:      len(latencies),
+		Extra: fmt.Sprintf("p50 %v, p95 %v, p99 %v, max %v; %d chills, %d thaws; pressure=%v",
+			percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99),
+			percentile(latencies, 100), chills, thaws, pressure),
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)].Round(time.Microsecond)
+}
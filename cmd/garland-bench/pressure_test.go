@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	if percentile(nil, 50) != 0 {
+		t.Error("percentile of nothing")
+	}
+	var sorted []time.Duration
+	for i := 1; i <= 200; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[int]time.Duration{0: 1, 1: 2, 50: 100, 95: 190, 99: 198, 100: 200} {
+		if got := percentile(sorted, p); got != want*time.Millisecond {
+			t.Errorf("p%d = %v, want %vms", p, got, int64(want))
+		}
+	}
+	if got := percentile([]time.Duration{7 * time.Microsecond}, 99); got != 7*time.Microsecond {
+		t.Errorf("p99 of one = %v", got)
+	}
+}
+
+// smallConfig is a workload small enough for a test.
+func smallConfig() config {
+	return config{
+		fileSize: 256 << 10, leafSize: 4 << 10, readSize: 1 << 10, smallSize: 16, reads: 10,
+		pressureOps: 200, readers: 2, concurrentTime: 50 * time.Millisecond,
+		backendSize: 64 << 10, writeBack: 8,
+	}
+}
+
+// testFile generates a cfg.fileSize test file in a temporary directory.
+func testFile(t *testing.T, cfg config) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.txt")
+	if r := generateTestFile(path, cfg.fileSize); strings.HasPrefix(r.Extra, "ERROR") {
+		t.Fatal(r.Extra)
+	}
+	return path
+}
+
+func TestPressureSuite(t *testing.T) {
+	cfg := smallConfig()
+	file, cold := testFile(t, cfg), t.TempDir()
+
+	var results []BenchResult
+	benchPressureSuite(cfg, file, cold, func(name string, fn func() BenchResult) {
+		r := fn()
+		if r.Name != name {
+			t.Errorf("%s reported as %s", name, r.Name)
+		}
+		results = append(results, r)
+	})
+	if len(results) != len(pressureScenarios) {
+		t.Fatalf("%d results for %d scenarios", len(results), len(pressureScenarios))
+	}
+	for i, r := range results {
+		if strings.Contains(r.Extra, "ERROR") || r.Ops != cfg.pressureOps {
+			t.Errorf("%s: %d ops, %s", r.Name, r.Ops, r.Extra)
+		}
+		for _, field := range []string{"p50 ", "p99 ", " chills, ", " thaws; pressure="} {
+			if !strings.Contains(r.Extra, field) {
+				t.Errorf("%s: %q lacks %q", r.Name, r.Extra, field)
+			}
+		}
+		// With nowhere to evict to, limits a fraction of the file are
+		// pressure by definition.
+		if pressureScenarios[i].memoryOnly && !strings.HasSuffix(r.Extra, "pressure=true") {
+			t.Errorf("%s: memory-only run reports %q", r.Name, r.Extra)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// summarize writes the results in the -format chosen, followed by the
+// baseline comparison if there is one, and returns the exit code: 1
+// when a benchmark regressed (or output failed).
+func summarize(cfg config, results []BenchResult) int {
+	var err error
+	switch cfg.format {
+	case "json":
+		err = writeJSON(os.Stdout, cfg, results)
+	case "csv":
+		err = writeCSV(os.Stdout, results)
+	default:
+		fmt.Fprintln(out, "\n"+"=")
+		fmt.Fprintln(out, "SUMMARY")
+		fmt.Fprintln(out, "=")
+		for _, r := range results {
+			fmt.Fprintln(out, r)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write results: %v\n", err)
+		return 1
+	}
+
+	// Memory stats
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Peak heap allocation: %d MB\n", m.HeapSys/(1024*1024))
+	fmt.Fprintf(out, "Total allocations: %d MB\n", m.TotalAlloc/(1024*1024))
+
+	if cfg.baseline == "" {
+		return 0
+	}
+	baseline, err := loadBaseline(cfg.baseline)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read baseline: %v\n", err)
+		return 1
+	}
+	if compareBaseline(out, baseline, results, cfg.threshold) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// report is the -format json document, and what -baseline reads.
+type report struct {
+	GoVersion  string        `json:"goVersion"`
+	GOMAXPROCS int           `json:"gomaxprocs"`
+	FileSize   int64         `json:"fileSize"`
+	LeafSize   int64         `json:"leafSize,omitempty"`
+	Time       time.Time     `json:"time"`
+	Results    []BenchResult `json:"results"`
+}
+
+// opsPerSec is a result's throughput; 0 without ops.
+func (r BenchResult) opsPerSec() float64 {
+	if r.Ops == 0 || r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Duration.Seconds()
+}
+
+// MarshalJSON writes a result with its duration in nanoseconds and its
+// throughput.
+func (r BenchResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name      string  `json:"name"`
+		Duration  int64   `json:"durationNs"`
+		Ops       int     `json:"ops,omitempty"`
+		OpsPerSec float64 `json:"opsPerSec,omitempty"`
+		Extra     string  `json:"extra,omitempty"`
+	}{r.Name, int64(r.Duration), r.Ops, r.opsPerSec(), r.Extra})
+}
+
+// UnmarshalJSON reads a result MarshalJSON wrote.
+func (r *BenchResult) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Name     string `json:"name"`
+		Duration int64  `json:"durationNs"`
+		Ops      int    `json:"ops"`
+		Extra    string `json:"extra"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = BenchResult{Name: v.Name, Duration: time.Duration(v.Duration), Ops: v.Ops, Extra: v.Extra}
+	return nil
+}
+
+// writeJSON writes the results as one JSON report.
+func writeJSON(w io.Writer, cfg config, results []BenchResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report{
+		GoVersion:  runtime.Version(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		FileSize:   cfg.fileSize,
+		LeafSize:   cfg.leafSize,
+		Time:       time.Now().UTC(),
+		Results:    results,
+	})
+}
+
+// writeCSV writes the results as CSV, one row per benchmark.
+func writeCSV(w io.Writer, results []BenchResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "duration_ns", "ops", "ops_per_sec", "extra"})
+	for _, r := range results {
+		cw.Write([]string{
+			r.Name, strconv.FormatInt(int64(r.Duration), 10), strconv.Itoa(r.Ops),
+			strconv.FormatFloat(r.opsPerSec(), 'f', 2, 64), r.Extra,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// loadBaseline reads the results of a -format json report.
+func loadBaseline(path string) ([]BenchResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rep report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rep.Results, nil
+}
+
+// compareBaseline prints each benchmark's change in duration against
+// the baseline run of the same name, flagging those slower by more
+// than threshold percent, and returns how many were.
+func compareBaseline(w io.Writer, baseline, results []BenchResult, threshold float64) int {
+	before := make(map[string]BenchResult, len(baseline))
+	for _, r := range baseline {
+		before[r.Name] = r
+	}
+	fmt.Fprintln(w, "\nBASELINE COMPARISON")
+	fmt.Fprintf(w, "%-40s %12s %12s %9s\n", "", "baseline", "current", "change")
+	regressions := 0
+	for _, r := range results {
+		b, ok := before[r.Name]
+		if !ok || b.Duration <= 0 {
+			fmt.Fprintf(w, "%-40s %12s %12v\n", r.Name, "-", r.Duration.Round(time.Millisecond))
+			continue
+		}
+		change := 100 * (r.Duration.Seconds() - b.Duration.Seconds()) / b.Duration.Seconds()
+		flag := ""
+		if change > threshold {
+			flag = "  REGRESSION"
+			regressions++
+		}
+		fmt.Fprintf(w, "%-40s %12v %12v %+8.1f%%%s\n", r.Name, b.Duration.Round(time.Millisecond),
+			r.Duration.Round(time.Millisecond), change, flag)
+	}
+	if regressions > 0 {
+		fmt.Fprintf(w, "\n%d benchmark(s) regressed by more than %.1f%%\n", regressions, threshold)
+	}
+	return regressions
+}
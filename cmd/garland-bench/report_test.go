@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testResults = []BenchResult{
+	{Name: "Seek", Duration: 2 * time.Second, Ops: 1000, Extra: "warm"},
+	{Name: "Open", Duration: 150 * time.Millisecond},
+	{Name: "Read, chunked", Duration: time.Second, Ops: 40, Extra: `say "hi"`},
+}
+
+func TestJSONReportRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := config{fileSize: 1 << 20, leafSize: 4 << 10}
+	if err := writeJSON(&buf, cfg, testResults); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fields are the documented ones: durations in nanoseconds,
+	// throughput derived, empty ones left out.
+	var raw struct {
+		FileSize int64            `json:"fileSize"`
+		LeafSize int64            `json:"leafSize"`
+		Results  []map[string]any `json:"results"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.FileSize != 1<<20 || raw.LeafSize != 4<<10 || len(raw.Results) != 3 {
+		t.Fatalf("report: %+v", raw)
+	}
+	if r := raw.Results[0]; r["durationNs"] != float64(2e9) || r["opsPerSec"] != float64(500) {
+		t.Errorf("first result: %v", r)
+	}
+	if _, ok := raw.Results[1]["opsPerSec"]; ok {
+		t.Errorf("op-less result has a throughput: %v", raw.Results[1])
+	}
+
+	// What -format json writes, -baseline reads back.
+	path := filepath.Join(t.TempDir(), "base.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, testResults) {
+		t.Errorf("baseline read back as %+v", got)
+	}
+}
+
+func TestLoadBaselineErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := loadBaseline(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing baseline loaded")
+	}
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte("name,duration_ns\n"), 0o644)
+	if _, err := loadBaseline(bad); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("CSV as baseline: %v", err)
+	}
+}
+
+func TestCSVReport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, testResults); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "duration_ns", "ops", "ops_per_sec", "extra"},
+		{"Seek", "2000000000", "1000", "500.00", "warm"},
+		{"Open", "150000000", "0", "0.00", ""},
+		{"Read, chunked", "1000000000", "40", "40.00", `say "hi"`},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows:\n%q\nwant\n%q", rows, want)
+	}
+}
+
+func TestCompareBaseline(t *testing.T) {
+	current := []BenchResult{
+		{Name: "Seek", Duration: 2150 * time.Millisecond},  // +7.5%
+		{Name: "Open", Duration: 300 * time.Millisecond},   // +100%
+		{Name: "Read, chunked", Duration: time.Second / 2}, // faster
+		{Name: "New", Duration: time.Second},               // not in the baseline
+	}
+	var buf bytes.Buffer
+	if n := compareBaseline(&buf, testResults, current, 10); n != 1 {
+		t.Errorf("%d regressions at 10%%, want 1:\n%s", n, &buf)
+	}
+	text := buf.String()
+	for _, want := range []string{"+100.0%  REGRESSION", "-50.0%", "1 benchmark(s) regressed by more than 10.0%"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("comparison lacks %q:\n%s", want, text)
+		}
+	}
+	if n := compareBaseline(&bytes.Buffer{}, testResults, current, 5); n != 2 {
+		t.Errorf("%d regressions at 5%%, want 2", n)
+	}
+	if n := compareBaseline(&bytes.Buffer{}, testResults, current, 200); n != 0 {
+		t.Errorf("%d regressions at 200%%, want 0", n)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestMain runs main itself when the test binary is started as the
+// command under test (see repl).
+func TestMain(m *testing.M) {
+	if os.Getenv("GARLAND_REPL_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// repl runs garland-repl with args, feeding it script on stdin, and
+// returns its stdout.
+func repl(t *testing.T, script string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-rc", "", "-history", ""}, args...)...)
+	cmd.Env = append(os.Environ(), "GARLAND_REPL_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(script)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, stderr.String())
+	}
+	return stdout.String()
+}
+
+// reply is one JSON-mode response.
+type reply struct {
+	Status string `json:"status"`
+	Data   struct {
+		Output []string `json:"output"`
+		Text   string   `json:"text"`
+		State  *struct {
+			Bytes    int64 `json:"bytes"`
+			Revision int64 `json:"revision"`
+			Cursor   struct {
+				Name string `json:"name"`
+				Byte int64  `json:"byte"`
+			} `json:"cursor"`
+		} `json:"state"`
+	} `json:"data"`
+	Error string `json:"error"`
+}
+
+// replies decodes stdout as one JSON object per line: nothing else (no
+// banner, no prompt) may be on it.
+func replies(t *testing.T, stdout string) []reply {
+	t.Helper()
+	var rs []reply
+	sc := bufio.NewScanner(strings.NewReader(stdout))
+	for sc.Scan() {
+		var r reply
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("non-JSON line %q: %v", sc.Text(), err)
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func TestJSONMode(t *testing.T) {
+	script := "help\nnew \"hello world\"\nseek byte 6\nread string 5\nbogus\ninsert \"X\"\n"
+	rs := replies(t, repl(t, script, "--json"))
+	if len(rs) != 6 {
+		t.Fatalf("%d replies to 6 commands", len(rs))
+	}
+
+	// No garland open yet: no state.
+	if rs[0].Status != "ok" || rs[0].Data.State != nil || len(rs[0].Data.Output) == 0 {
+		t.Errorf("help: %+v", rs[0])
+	}
+	if s := rs[1].Data.State; rs[1].Status != "ok" || s == nil || s.Bytes != 11 || s.Cursor.Name != "default" {
+		t.Errorf("new: %+v", rs[1])
+	}
+	if s := rs[2].Data.State; s == nil || s.Cursor.Byte != 6 {
+		t.Errorf("seek: %+v", rs[2])
+	}
+	if rs[3].Data.Text != "world" || rs[3].Data.State.Cursor.Byte != 11 {
+		t.Errorf("read: %+v", rs[3])
+	}
+
+	// A failed command answers "error" with the message, in the output
+	// too, and the session goes on.
+	if rs[4].Status != "error" || !strings.Contains(rs[4].Error, "Unknown command: bogus") ||
+		len(rs[4].Data.Output) != 1 || rs[4].Data.Output[0] != rs[4].Error {
+		t.Errorf("bogus: %+v", rs[4])
+	}
+	if s := rs[5].Data.State; rs[5].Status != "ok" || rs[5].Error != "" || s.Bytes != 12 || s.Revision != 1 {
+		t.Errorf("insert: %+v", rs[5])
+	}
+}
+
+func TestPorcelainIsJSON(t *testing.T) {
+	script := "new \"abc\"\ndump\n"
+	if asJSON, porcelain := repl(t, script, "--json"), repl(t, script, "--porcelain"); asJSON != porcelain {
+		t.Errorf("--porcelain differs from --json:\n%s\n%s", porcelain, asJSON)
+	}
+	// Without either, the session is text.
+	if out := repl(t, script); strings.HasPrefix(out, "{") || !strings.Contains(out, "abc") {
+		t.Errorf("text mode:\n%s", out)
+	}
+}
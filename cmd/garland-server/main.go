@@ -0,0 +1,48 @@
+// garland-server exposes Garland as an editing engine over JSON-RPC 2.0,
+// for frontends not written in Go (editor extensions, TUIs in other
+// languages). It is package garlandrpc over a fresh Library; the
+// protocol and its methods are documented there.
+//
+// By default the server speaks on stdin/stdout, serving one session;
+// with -listen it accepts TCP connections, each its own session. A
+// session owns the documents it opens - they are addressed by the
+// integer handle "open" returns and closed when the session ends.
+//
+// An application that embeds garland serves its own live documents the
+// same way: garlandrpc.NewServer over its Library, Publish, then
+// ServeListener.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/phroun/garland"
+	"github.com/phroun/garland/garlandrpc"
+)
+
+func main() {
+	listen := flag.String("listen", "", "serve TCP connections on this address instead of stdin/stdout")
+	flag.Parse()
+
+	lib, err := garland.Init(garland.LibraryOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing library: %v\n", err)
+		os.Exit(1)
+	}
+	srv := garlandrpc.NewServer(lib)
+
+	if *listen == "" {
+		srv.Serve(os.Stdin, os.Stdout)
+		return
+	}
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listening: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "garland-server listening on %s\n", ln.Addr())
+	srv.ServeListener(ln)
+}
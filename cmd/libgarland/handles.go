@@ -0,0 +1,162 @@
+//go:build cgo && garland_capi
+
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/phroun/garland"
+)
+
+// The handle table and the error codes, kept free of C types so they
+// can be tested from Go.
+
+// Error codes (see the package comment).
+const (
+	errGeneric  = -1
+	errHandle   = -2
+	errArgument = -3
+)
+
+// errorCodes maps sentinel errors to codes -4, -5, ... in order. Only
+// ever append to it.
+var errorCodes = []error{
+	garland.ErrInvalidPosition,
+	garland.ErrNotReady,
+	garland.ErrDecorationNotFound,
+	garland.ErrInvalidDecorationKey,
+	garland.ErrForkNotFound,
+	garland.ErrRevisionNotFound,
+	garland.ErrTransactionPending,
+	garland.ErrNoTransaction,
+	garland.ErrCursorNotFound,
+	garland.ErrReadOnly,
+	garland.ErrNoDataSource,
+}
+
+// errCode returns the C code for err.
+func errCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	for i, e := range errorCodes {
+		if errors.Is(err, e) {
+			return -4 - i
+		}
+	}
+	return errGeneric
+}
+
+// errMessage returns the message garland_strerror gives for code.
+func errMessage(code int) string {
+	switch {
+	case code == 0:
+		return "success"
+	case code == errGeneric:
+		return "error"
+	case code == errHandle:
+		return "invalid handle"
+	case code == errArgument:
+		return "invalid argument"
+	case code <= -4 && -4-code < len(errorCodes):
+		return errorCodes[-4-code].Error()
+	}
+	return "unknown error code"
+}
+
+// handleTable names garlands and cursors by handle.
+type handleTable struct {
+	sync.Mutex
+	next     int64
+	garlands map[int64]*garland.Garland
+	cursors  map[int64]*cursorEntry
+}
+
+// cursorEntry is a cursor handle's target. Cursors are SyncCursors: C
+// callers may drive one handle from several threads, which a plain
+// Cursor does not survive (see garland.SyncCursor).
+type cursorEntry struct {
+	owner int64 // garland handle
+	c     *garland.SyncCursor
+}
+
+func newHandleTable() *handleTable {
+	return &handleTable{
+		garlands: make(map[int64]*garland.Garland),
+		cursors:  make(map[int64]*cursorEntry),
+	}
+}
+
+// registry is the process's handle table.
+var registry = newHandleTable()
+
+// addGarland gives g a handle.
+func (t *handleTable) addGarland(g *garland.Garland) int64 {
+	t.Lock()
+	defer t.Unlock()
+	t.next++
+	t.garlands[t.next] = g
+	return t.next
+}
+
+// garland returns the garland named by h, or nil.
+func (t *handleTable) garland(h int64) *garland.Garland {
+	t.Lock()
+	defer t.Unlock()
+	return t.garlands[h]
+}
+
+// removeGarland releases h and the handles of its cursors, returning
+// the garland (nil when h named none).
+func (t *handleTable) removeGarland(h int64) *garland.Garland {
+	t.Lock()
+	defer t.Unlock()
+	g := t.garlands[h]
+	delete(t.garlands, h)
+	for id, e := range t.cursors {
+		if e.owner == h {
+			delete(t.cursors, id)
+		}
+	}
+	return g
+}
+
+// addCursor creates a cursor on the garland named by h and gives it a
+// handle; 0 when h names no garland.
+func (t *handleTable) addCursor(h int64) int64 {
+	t.Lock()
+	defer t.Unlock()
+	g := t.garlands[h]
+	if g == nil {
+		return 0
+	}
+	t.next++
+	t.cursors[t.next] = &cursorEntry{owner: h, c: g.NewSyncCursor()}
+	return t.next
+}
+
+// cursor returns the cursor named by ch, or nil.
+func (t *handleTable) cursor(ch int64) *garland.SyncCursor {
+	t.Lock()
+	defer t.Unlock()
+	if e := t.cursors[ch]; e != nil {
+		return e.c
+	}
+	return nil
+}
+
+// removeCursor releases ch and removes the cursor from its garland,
+// returning a code.
+func (t *handleTable) removeCursor(ch int64) int {
+	t.Lock()
+	e := t.cursors[ch]
+	if e == nil {
+		t.Unlock()
+		return errHandle
+	}
+	delete(t.cursors, ch)
+	g := t.garlands[e.owner]
+	t.Unlock()
+	return errCode(e.c.Do(func(c *garland.Cursor) error { return g.RemoveCursor(c) }))
+}
@@ -0,0 +1,126 @@
+//go:build cgo && garland_capi
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/phroun/garland"
+)
+
+func openTest(t *testing.T, text string) *garland.Garland {
+	t.Helper()
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	g, err := lib.Open(garland.FileOptions{DataString: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestHandlesAllocateAndFree(t *testing.T) {
+	tab := newHandleTable()
+	g1, g2 := openTest(t, "one"), openTest(t, "two")
+	defer g1.Close()
+	defer g2.Close()
+
+	h1 := tab.addGarland(g1)
+	h2 := tab.addGarland(g2)
+	if h1 != 1 || h2 != 2 {
+		t.Fatalf("garland handles %d, %d; want 1, 2", h1, h2)
+	}
+	c1, c2 := tab.addCursor(h1), tab.addCursor(h2)
+	if c1 != 3 || c2 != 4 {
+		t.Fatalf("cursor handles %d, %d; want 3, 4", c1, c2)
+	}
+	if tab.addCursor(99) != 0 || tab.garland(0) != nil || tab.cursor(h1) != nil {
+		t.Error("a handle resolved to the wrong kind of object, or to nothing")
+	}
+	if n := len(g1.CursorsInOrder()); n != 1 {
+		t.Fatalf("garland has %d cursors, want 1", n)
+	}
+
+	// Freeing a cursor removes it from its garland; the handle is dead.
+	if got := tab.removeCursor(c1); got != 0 {
+		t.Fatalf("removeCursor = %d", got)
+	}
+	if n := len(g1.CursorsInOrder()); n != 0 {
+		t.Errorf("freed cursor still on the garland (%d cursors)", n)
+	}
+	if tab.cursor(c1) != nil || tab.removeCursor(c1) != errHandle {
+		t.Error("freed cursor handle still resolves")
+	}
+
+	// Closing a garland releases its cursors' handles, and no handle is
+	// ever handed out twice.
+	if tab.removeGarland(h2) != g2 || tab.garland(h2) != nil || tab.cursor(c2) != nil {
+		t.Error("removed garland or its cursor still resolves")
+	}
+	if tab.removeGarland(h2) != nil {
+		t.Error("second removal found a garland")
+	}
+	if h := tab.addGarland(g2); h != 5 {
+		t.Errorf("next handle %d, want 5 (handles are never reused)", h)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	if errCode(nil) != 0 || errMessage(0) != "success" {
+		t.Error("nil is not success")
+	}
+	// The codes are ABI: pin the ends of the table.
+	if errCode(garland.ErrInvalidPosition) != -4 || errCode(garland.ErrNoDataSource) != -14 {
+		t.Errorf("codes moved: %d, %d", errCode(garland.ErrInvalidPosition), errCode(garland.ErrNoDataSource))
+	}
+	for i, e := range errorCodes {
+		want := -4 - i
+		if got := errCode(e); got != want {
+			t.Errorf("%v: code %d, want %d", e, got, want)
+		}
+		if got := errCode(fmt.Errorf("op: %w", e)); got != want {
+			t.Errorf("wrapped %v: code %d, want %d", e, got, want)
+		}
+		if errMessage(want) != e.Error() {
+			t.Errorf("code %d: message %q", want, errMessage(want))
+		}
+	}
+	if errCode(fmt.Errorf("something else")) != errGeneric {
+		t.Error("an unknown error has a code of its own")
+	}
+	for code, msg := range map[int]string{errGeneric: "error", errHandle: "invalid handle", errArgument: "invalid argument",
+		-4 - len(errorCodes): "unknown error code", 1: "unknown error code"} {
+		if got := errMessage(code); got != msg {
+			t.Errorf("errMessage(%d) = %q, want %q", code, got, msg)
+		}
+	}
+}
+
+func TestCursorHandleSharedAcrossThreads(t *testing.T) {
+	tab := newHandleTable()
+	g := openTest(t, "$")
+	defer g.Close()
+	c := tab.cursor(tab.addCursor(tab.addGarland(g)))
+
+	// Writers on several threads type through one cursor handle; the
+	// SyncCursor keeps each insert-and-advance whole, so none is lost
+	// and the cursor ends past all of them.
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := c.InsertString("ab", nil, false); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := g.ByteCount().Value; n != 8*50*2+1 || c.BytePos() != n-1 {
+		t.Errorf("%d bytes, cursor at %d", n, c.BytePos())
+	}
+}
@@ -0,0 +1,359 @@
+//go:build cgo && garland_capi
+
+// libgarland is a C ABI façade over Garland, for embedding it in C,
+// Rust, Swift and other editors as a shared library:
+//
+//	go build -tags garland_capi -buildmode=c-shared -o libgarland.so ./cmd/libgarland
+//
+// The build also writes libgarland.h with the declarations below. The
+// handle table and error codes are tested with
+// go test -tags garland_capi ./cmd/libgarland.
+//
+// HANDLES. Garlands and cursors are named by int64 handles, never by
+// pointers: Go memory cannot be held by C. Handles count up from 1 in
+// one table and are never reused within a process, so a stale handle
+// fails with GARLAND_ERR_HANDLE instead of reaching another object;
+// 0 is never a valid handle. Closing a garland releases its cursors'
+// handles too.
+//
+// ERRORS. Functions returning int return 0 (or a count) on success and
+// a negative code on failure. The codes are stable: -1 is an error
+// without a code of its own, -2 a bad handle, -3 a bad argument, and
+// the rest name garland's sentinel errors in the fixed order of
+// errorCodes - new codes are only ever appended. garland_strerror
+// gives a code's message.
+//
+// MEMORY. Strings in are NUL-terminated UTF-8 (or pointer + length
+// where the text may hold NULs). Buffers and strings handed out are
+// allocated with malloc; release them with garland_free.
+//
+// THREADS. Calls are safe from any thread. Garland serializes edits
+// itself, and each cursor handle wraps a garland.SyncCursor, so one
+// cursor may be driven from several threads: every call on it runs
+// whole against the others.
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/phroun/garland"
+)
+
+// code returns the C code for err.
+func code(err error) C.int {
+	return C.int(errCode(err))
+}
+
+var (
+	libOnce sync.Once
+	lib     *garland.Library
+	libErr  error
+)
+
+// library returns the process-wide Library, created on first use.
+func library() (*garland.Library, error) {
+	libOnce.Do(func() { lib, libErr = garland.Init(garland.LibraryOptions{}) })
+	return lib, libErr
+}
+
+// goBytes copies length bytes at p (NULL with length 0 is empty).
+func goBytes(p *C.char, length C.int64_t) ([]byte, bool) {
+	if length < 0 || (p == nil && length > 0) {
+		return nil, false
+	}
+	if length == 0 {
+		return nil, true
+	}
+	return C.GoBytes(unsafe.Pointer(p), C.int(length)), true
+}
+
+// open registers a newly opened garland with a handle in *out.
+func open(opts garland.FileOptions, out *C.int64_t) C.int {
+	if out == nil {
+		return errArgument
+	}
+	l, err := library()
+	if err != nil {
+		return code(err)
+	}
+	g, err := l.Open(opts)
+	if err != nil {
+		return code(err)
+	}
+	*out = C.int64_t(registry.addGarland(g))
+	return 0
+}
+
+//export garland_open_file
+func garland_open_file(path *C.char, out *C.int64_t) C.int {
+	if path == nil {
+		return errArgument
+	}
+	return open(garland.FileOptions{FilePath: C.GoString(path)}, out)
+}
+
+//export garland_open_bytes
+func garland_open_bytes(data *C.char, length C.int64_t, out *C.int64_t) C.int {
+	b, ok := goBytes(data, length)
+	if !ok {
+		return errArgument
+	}
+	return open(garland.FileOptions{DataBytes: b}, out)
+}
+
+//export garland_close
+func garland_close(h C.int64_t) C.int {
+	g := registry.removeGarland(int64(h))
+	if g == nil {
+		return errHandle
+	}
+	return code(g.Close())
+}
+
+//export garland_save
+func garland_save(h C.int64_t) C.int {
+	g := registry.garland(int64(h))
+	if g == nil {
+		return errHandle
+	}
+	_, err := g.Save()
+	return code(err)
+}
+
+//export garland_byte_count
+func garland_byte_count(h C.int64_t) C.int64_t {
+	g := registry.garland(int64(h))
+	if g == nil {
+		return errHandle
+	}
+	return C.int64_t(g.ByteCount().Value)
+}
+
+//export garland_current_revision
+func garland_current_revision(h C.int64_t) C.int64_t {
+	g := registry.garland(int64(h))
+	if g == nil {
+		return errHandle
+	}
+	return C.int64_t(g.CurrentRevision())
+}
+
+//export garland_read
+func garland_read(h C.int64_t, start, length C.int64_t, out **C.char, outLen *C.int64_t) C.int {
+	g := registry.garland(int64(h))
+	if g == nil {
+		return errHandle
+	}
+	if out == nil || outLen == nil || length < 0 || start < 0 {
+		return errArgument
+	}
+	buf := make([]byte, min(int64(length), max(g.ByteCount().Value-int64(start), 0)))
+	n, err := g.ReadAt(buf, int64(start))
+	if err != nil && n < len(buf) {
+		return code(err)
+	}
+	*out = (*C.char)(C.CBytes(buf[:n]))
+	*outLen = C.int64_t(n)
+	return 0
+}
+
+//export garland_undo_seek
+func garland_undo_seek(h C.int64_t, revision C.int64_t) C.int {
+	g := registry.garland(int64(h))
+	if g == nil {
+		return errHandle
+	}
+	if revision < 0 {
+		return errArgument
+	}
+	return code(g.UndoSeek(garland.RevisionID(revision)))
+}
+
+//export garland_cursor_new
+func garland_cursor_new(h C.int64_t, out *C.int64_t) C.int {
+	if out == nil {
+		return errArgument
+	}
+	ch := registry.addCursor(int64(h))
+	if ch == 0 {
+		return errHandle
+	}
+	*out = C.int64_t(ch)
+	return 0
+}
+
+//export garland_cursor_free
+func garland_cursor_free(ch C.int64_t) C.int {
+	return C.int(registry.removeCursor(int64(ch)))
+}
+
+//export garland_cursor_seek
+func garland_cursor_seek(ch C.int64_t, pos C.int64_t) C.int {
+	c := registry.cursor(int64(ch))
+	if c == nil {
+		return errHandle
+	}
+	return code(c.SeekByte(int64(pos)))
+}
+
+//export garland_cursor_pos
+func garland_cursor_pos(ch C.int64_t) C.int64_t {
+	c := registry.cursor(int64(ch))
+	if c == nil {
+		return errHandle
+	}
+	return C.int64_t(c.BytePos())
+}
+
+//export garland_insert
+func garland_insert(ch C.int64_t, data *C.char, length C.int64_t) C.int {
+	c := registry.cursor(int64(ch))
+	if c == nil {
+		return errHandle
+	}
+	b, ok := goBytes(data, length)
+	if !ok {
+		return errArgument
+	}
+	_, err := c.InsertBytes(b, nil, false)
+	return code(err)
+}
+
+//export garland_delete
+func garland_delete(ch C.int64_t, length C.int64_t) C.int {
+	c := registry.cursor(int64(ch))
+	if c == nil {
+		return errHandle
+	}
+	_, _, err := c.DeleteBytes(int64(length), false)
+	return code(err)
+}
+
+//export garland_overwrite
+func garland_overwrite(ch C.int64_t, length C.int64_t, data *C.char, dataLen C.int64_t) C.int {
+	c := registry.cursor(int64(ch))
+	if c == nil {
+		return errHandle
+	}
+	b, ok := goBytes(data, dataLen)
+	if !ok || length < 0 {
+		return errArgument
+	}
+	return code(c.Do(func(c *garland.Cursor) error {
+		_, _, err := c.OverwriteBytes(int64(length), b)
+		return err
+	}))
+}
+
+// Search flags for garland_find.
+const (
+	findCaseInsensitive = 1 << iota
+	findWholeWord
+	findBackward
+	findRegex
+)
+
+// garland_find searches from the cursor without moving it. Returns 1
+// with the match in [*start, *end), 0 when there is none.
+//
+//export garland_find
+func garland_find(ch C.int64_t, pattern *C.char, flags C.int, start, end *C.int64_t) C.int {
+	c := registry.cursor(int64(ch))
+	if c == nil {
+		return errHandle
+	}
+	if pattern == nil || start == nil || end == nil {
+		return errArgument
+	}
+	p := C.GoString(pattern)
+	var m *garland.SearchResult
+	err := c.Do(func(c *garland.Cursor) (err error) {
+		if flags&findRegex != 0 {
+			m, err = c.FindRegex(p, garland.RegexOptions{
+				CaseInsensitive: flags&findCaseInsensitive != 0,
+				Backward:        flags&findBackward != 0,
+			})
+		} else {
+			m, err = c.FindString(p, garland.SearchOptions{
+				CaseSensitive: flags&findCaseInsensitive == 0,
+				WholeWord:     flags&findWholeWord != 0,
+				Backward:      flags&findBackward != 0,
+			})
+		}
+		return err
+	})
+	if err != nil {
+		return code(err)
+	}
+	if m == nil {
+		return 0
+	}
+	*start, *end = C.int64_t(m.ByteStart), C.int64_t(m.ByteEnd)
+	return 1
+}
+
+// garland_decorate sets decoration key (in namespace ns, NULL or "" for
+// none) at byte pos with gravity 0 default, 1 left, 2 right; a negative
+// pos deletes it.
+//
+//export garland_decorate
+func garland_decorate(h C.int64_t, key, ns *C.char, pos C.int64_t, gravity C.int) C.int {
+	g := registry.garland(int64(h))
+	if g == nil {
+		return errHandle
+	}
+	if key == nil || gravity < 0 || gravity > C.int(garland.GravityRight) {
+		return errArgument
+	}
+	entry := garland.DecorationEntry{Key: C.GoString(key), Gravity: garland.Gravity(gravity)}
+	if ns != nil {
+		entry.Namespace = C.GoString(ns)
+	}
+	if pos >= 0 {
+		addr := garland.ByteAddress(int64(pos))
+		entry.Address = &addr
+	}
+	_, err := g.Decorate([]garland.DecorationEntry{entry})
+	return code(err)
+}
+
+//export garland_decoration_pos
+func garland_decoration_pos(h C.int64_t, key, ns *C.char, out *C.int64_t) C.int {
+	g := registry.garland(int64(h))
+	if g == nil {
+		return errHandle
+	}
+	if key == nil || out == nil {
+		return errArgument
+	}
+	namespace := ""
+	if ns != nil {
+		namespace = C.GoString(ns)
+	}
+	addr, err := g.GetDecorationPositionIn(namespace, C.GoString(key))
+	if err != nil {
+		return code(err)
+	}
+	*out = C.int64_t(addr.Byte)
+	return 0
+}
+
+//export garland_strerror
+func garland_strerror(c C.int) *C.char {
+	msg := errMessage(int(c))
+	return C.CString(msg)
+}
+
+//export garland_free
+func garland_free(p unsafe.Pointer) {
+	C.free(p)
+}
+
+func main() {}
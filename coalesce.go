@@ -33,7 +33,8 @@ import "time"
 //
 // Runs end ("bake") at a HARD EDGE:
 //   - Bake() - the app forces one (menu action completed, focus lost,
-//     whatever policy it likes);
+//     whatever policy it likes); Checkpoint() does too, after flushing
+//     optimized regions;
 //   - AutoBakeTime - the new edit arrived more than this long after
 //     the previous one (0 disables time-based baking);
 //   - any non-continuation: a different kind (insert / delete /
@@ -103,6 +104,18 @@ type coalesceState struct {
 	// backspace ends exactly on it.
 	start, end int64
 	lastOp     time.Time
+
+	// now is the clock (nil: time.Now). Replay (replay.go) substitutes
+	// the recorded op times so time-based baking decides as it did.
+	now func() time.Time
+}
+
+// clock returns the current time for coalescing decisions.
+func (cs *coalesceState) clock() time.Time {
+	if cs.now != nil {
+		return cs.now()
+	}
+	return time.Now()
 }
 
 // coalescePending carries one mutation's coalescing decision from the
@@ -117,6 +130,7 @@ type coalescePending struct {
 	kind   coalesceKind
 	pos    int64
 	length int64
+	at     time.Time // when the op ran (coalesceState.clock)
 }
 
 // SetUndoCoalescing enables or disables undo coalescing and sets the
@@ -135,6 +149,7 @@ func (g *Garland) SetUndoCoalescing(enabled bool, autoBakeTime time.Duration) {
 	g.coalesce.enabled = enabled
 	g.coalesce.autoBake = autoBakeTime
 	g.coalesce.active = false
+	g.logOpLocked(ReplayRecord{Op: replayCoalescing, Enabled: enabled, Duration: autoBakeTime})
 }
 
 // UndoCoalescing reports the current coalescing configuration.
@@ -152,6 +167,7 @@ func (g *Garland) Bake() {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.coalesce.active = false
+	g.logOpLocked(ReplayRecord{Op: replayBake})
 }
 
 // coalesceDecideLocked decides whether the mutation about to run
@@ -166,10 +182,11 @@ func (g *Garland) coalesceDecideLocked(kind coalesceKind, pos, length int64) boo
 		return false
 	}
 
+	at := cs.clock()
 	amend := cs.active &&
 		cs.fork == g.currentFork && cs.rev == g.currentRevision &&
 		coalesceKindContinues(cs.kind, kind) && g.isAtHead() &&
-		(cs.autoBake <= 0 || time.Since(cs.lastOp) <= cs.autoBake)
+		(cs.autoBake <= 0 || at.Sub(cs.lastOp) <= cs.autoBake)
 	if amend {
 		switch kind {
 		case coalesceInsert:
@@ -209,6 +226,7 @@ func (g *Garland) coalesceDecideLocked(kind coalesceKind, pos, length int64) boo
 		kind:   kind,
 		pos:    pos,
 		length: length,
+		at:     at,
 	}
 	return amend
 }
@@ -232,7 +250,7 @@ func (g *Garland) coalesceStartRunLocked(pc coalescePending) {
 		// repeats there, a backspace ends there.
 		cs.start, cs.end = pc.pos, pc.pos
 	}
-	cs.lastOp = time.Now()
+	cs.lastOp = pc.at
 }
 
 // coalesceExtendRunLocked grows the run to cover an amending op.
@@ -260,5 +278,5 @@ func (g *Garland) coalesceExtendRunLocked(pc coalescePending) {
 	// an overwrite run it is an insert run, and a later overwrite bakes.
 	// (For same-kind runs this is a no-op.)
 	cs.kind = pc.kind
-	cs.lastOp = time.Now()
+	cs.lastOp = pc.at
 }
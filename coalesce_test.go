@@ -574,3 +574,24 @@ func TestCoalesceCursorRestore(t *testing.T) {
 		t.Fatalf("cursor at rev0 = %d, want pre-run 2", got)
 	}
 }
+
+// TestCheckpointBakesRun: Checkpoint ends the run like Bake, so typing
+// after it is a new revision.
+func TestCheckpointBakesRun(t *testing.T) {
+	g, c := coalesceFixture(t, "")
+
+	typeString(t, c, 0, "ab")
+	typeString(t, c, 2, "c")
+	if err := g.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if res := typeString(t, c, 3, "d"); res.Revision != 2 {
+		t.Fatalf("insert after Checkpoint: revision = %d, want 2", res.Revision)
+	}
+	if err := g.UndoSeek(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, g); got != "abc" {
+		t.Fatalf("revision 1 = %q, want %q", got, "abc")
+	}
+}
@@ -0,0 +1,493 @@
+package garland
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// coldpack.go - single-file cold storage backend.
+//
+// DESIGN: the directory backend (fsColdStorage) stores one file per
+// block, and a long session over a large file produces thousands of
+// tiny files - hostile to some filesystems (inode exhaustion, slow
+// directory scans, network shares). PackColdStorage keeps every block of
+// every folder in ONE append-only pack file on local disk, selectable
+// with LibraryOptions.ColdStorageFile.
+//
+// RULING: no embedded database. garland has no dependencies and cold
+// storage needs none of a database's features: blocks are written
+// whole, read whole, and never updated in place. An append-only log
+// with an in-memory index gives the same single-file property with
+// nothing to vendor.
+//
+// FORMAT: the file starts with packMagic, followed by records:
+//
+//	kind     1 byte   'S' (set) or 'D' (delete)
+//	folder   uvarint length + bytes
+//	block    uvarint length + bytes
+//	data     uvarint length + bytes   (set records only)
+//	crc      4 bytes  CRC-32 (IEEE) of everything above, kind included
+//
+// The index (folder -> block -> data extent) is rebuilt by scanning at
+// open. A later record for the same block supersedes an earlier one. A
+// torn tail - a crash mid-append, detected by a short last record or a
+// CRC mismatch in it - is truncated away at open: everything before it
+// was complete and is kept. A CRC mismatch in a record with more after
+// it is damage, not a crash: that record is skipped (its block is
+// lost, and dead until Compact) and the scan goes on, so one bad record
+// never costs the blocks written after it. A record whose framing is
+// unreadable mid-file cannot be skipped; the pack then fails to open
+// rather than be cut short.
+//
+// Space is reclaimed by Compact, which rewrites the live records to
+// "<path>.tmp" and renames it into place (so a crash mid-compaction
+// leaves the old pack intact).
+
+// packMagic identifies a pack file (and its format version).
+const packMagic = "GARLANDPACK1\n"
+
+// errColdPackHeader reports a file that is not a garland pack (records
+// past a valid header are never "corrupt" - a torn tail is truncated).
+var errColdPackHeader = errors.New("not a garland cold storage pack file")
+
+// errColdPackCorrupt reports a pack damaged before its tail.
+var errColdPackCorrupt = errors.New("corrupt garland cold storage pack file")
+
+// errColdPackChecksum reports a record whose CRC does not match.
+var errColdPackChecksum = errors.New("cold storage pack record checksum mismatch")
+
+// packExtent locates one block's data inside the pack file.
+type packExtent struct {
+	off int64
+	n   int64
+}
+
+// PackColdStorage is a ColdStorageInterface that keeps all blocks in a
+// single append-only file. Safe for concurrent use.
+type PackColdStorage struct {
+	path string
+
+	mu    sync.RWMutex
+	file  *os.File
+	size  int64                            // append offset
+	index map[string]map[string]packExtent // folder -> block -> extent
+	dead  int64                            // bytes held by superseded/deleted records
+}
+
+// OpenPackColdStorage opens (creating if needed) the pack file at path.
+// An existing pack is scanned to rebuild its index; a torn tail left by
+// a crash is truncated.
+func OpenPackColdStorage(path string) (*PackColdStorage, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	p := &PackColdStorage{path: path, file: f, index: make(map[string]map[string]packExtent)}
+	if err := p.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// load scans the file, rebuilding the index, skipping damaged records
+// and truncating a torn tail.
+func (p *PackColdStorage) load() error {
+	info, err := p.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := p.file.WriteAt([]byte(packMagic), 0); err != nil {
+			return err
+		}
+		p.size = int64(len(packMagic))
+		return nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(p.file, 0, info.Size()))
+	magic := make([]byte, len(packMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != packMagic {
+		return errColdPackHeader
+	}
+	off := int64(len(packMagic))
+	for {
+		rec, err := readPackRecord(r)
+		if err == errColdPackChecksum && off+rec.length < info.Size() {
+			// Damaged mid-file: skip the record, keep scanning. Its
+			// block (if the names survived) must not fall back to an
+			// older copy.
+			p.drop(rec.folder, rec.block)
+			p.dead += rec.length
+			off += rec.length
+			continue
+		}
+		if err == errColdPackHeader && !(rec.kind == 0 && zeroTail(r)) {
+			return fmt.Errorf("%w: bad record at offset %d", errColdPackCorrupt, off)
+		}
+		if err != nil {
+			break // clean EOF or torn tail: keep what came before
+		}
+		dataOff := off + rec.dataOffset
+		off += rec.length
+		switch rec.kind {
+		case 'S':
+			p.put(rec.folder, rec.block, packExtent{off: dataOff, n: int64(len(rec.data))})
+		case 'D':
+			p.drop(rec.folder, rec.block)
+			p.dead += rec.length
+		}
+	}
+	if off < info.Size() {
+		if err := p.file.Truncate(off); err != nil {
+			return err
+		}
+	}
+	p.size = off
+	return nil
+}
+
+// packRecord is one decoded record.
+type packRecord struct {
+	kind          byte
+	folder, block string
+	data          []byte
+	dataOffset    int64 // data's offset from the record start
+	length        int64 // total record length, CRC included
+}
+
+// readPackRecord decodes the next record. A short read is an io error
+// (the caller treats it as the end of the log); a CRC mismatch is
+// errColdPackChecksum, with the record's names and length filled in.
+func readPackRecord(r *bufio.Reader) (packRecord, error) {
+	var rec packRecord
+	crc := crc32.NewIEEE()
+	kind, err := r.ReadByte()
+	if err != nil {
+		return rec, err
+	}
+	if kind != 'S' && kind != 'D' {
+		rec.kind = kind
+		return rec, errColdPackHeader
+	}
+	crc.Write([]byte{kind})
+	n := int64(1)
+	field := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		var lenBuf [binary.MaxVarintLen64]byte
+		k := binary.PutUvarint(lenBuf[:], l)
+		crc.Write(lenBuf[:k])
+		n += int64(k)
+		b := make([]byte, l)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		crc.Write(b)
+		n += int64(l)
+		return b, nil
+	}
+	folder, err := field()
+	if err != nil {
+		return rec, err
+	}
+	block, err := field()
+	if err != nil {
+		return rec, err
+	}
+	rec.kind, rec.folder, rec.block = kind, string(folder), string(block)
+	if kind == 'S' {
+		before := n
+		if rec.data, err = field(); err != nil {
+			return rec, err
+		}
+		rec.dataOffset = before + int64(uvarintLen(uint64(len(rec.data))))
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return rec, err
+	}
+	rec.length = n + 4
+	if binary.LittleEndian.Uint32(sum[:]) != crc.Sum32() {
+		return rec, errColdPackChecksum
+	}
+	return rec, nil
+}
+
+// zeroTail reports whether the rest of r is zero bytes: space a crash
+// left allocated but unwritten, a torn tail like a short record.
+func zeroTail(r *bufio.Reader) bool {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err == io.EOF
+		}
+		if b != 0 {
+			return false
+		}
+	}
+}
+
+// uvarintLen is the encoded length of v.
+func uvarintLen(v uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], v)
+}
+
+// encodePackRecord builds a record; dataOffset is the data's offset from
+// the record start.
+func encodePackRecord(kind byte, folder, block string, data []byte) (rec []byte, dataOffset int64) {
+	rec = append(rec, kind)
+	rec = binary.AppendUvarint(rec, uint64(len(folder)))
+	rec = append(rec, folder...)
+	rec = binary.AppendUvarint(rec, uint64(len(block)))
+	rec = append(rec, block...)
+	if kind == 'S' {
+		rec = binary.AppendUvarint(rec, uint64(len(data)))
+		dataOffset = int64(len(rec))
+		rec = append(rec, data...)
+	}
+	return binary.LittleEndian.AppendUint32(rec, crc32.ChecksumIEEE(rec)), dataOffset
+}
+
+// put records an extent, counting any superseded record as dead space.
+// Caller must hold p.mu (or be load).
+func (p *PackColdStorage) put(folder, block string, ext packExtent) {
+	blocks := p.index[folder]
+	if blocks == nil {
+		blocks = make(map[string]packExtent)
+		p.index[folder] = blocks
+	}
+	if old, ok := blocks[block]; ok {
+		p.dead += old.n // approximate: the old record's payload
+	}
+	blocks[block] = ext
+}
+
+// drop removes a block from the index, counting its space as dead.
+func (p *PackColdStorage) drop(folder, block string) bool {
+	blocks := p.index[folder]
+	old, ok := blocks[block]
+	if !ok {
+		return false
+	}
+	p.dead += old.n
+	delete(blocks, block)
+	if len(blocks) == 0 {
+		delete(p.index, folder)
+	}
+	return true
+}
+
+// appendRecord writes a record at the end of the pack.
+// Caller must hold the write lock.
+func (p *PackColdStorage) appendRecord(rec []byte) (int64, error) {
+	if p.file == nil {
+		return 0, os.ErrClosed
+	}
+	off := p.size
+	if _, err := p.file.WriteAt(rec, off); err != nil {
+		// A partial append is a torn tail: cut it off now rather than
+		// leave it for the next open.
+		_ = p.file.Truncate(off)
+		return 0, err
+	}
+	p.size += int64(len(rec))
+	return off, nil
+}
+
+// Set stores data for a block within a folder.
+func (p *PackColdStorage) Set(folder, block string, data []byte) error {
+	rec, dataOffset := encodePackRecord('S', folder, block, data)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	off, err := p.appendRecord(rec)
+	if err != nil {
+		return err
+	}
+	p.put(folder, block, packExtent{off: off + dataOffset, n: int64(len(data))})
+	return nil
+}
+
+// Get retrieves data for a block within a folder. A missing block
+// reports an error wrapping os.ErrNotExist, as the directory backend
+// does.
+func (p *PackColdStorage) Get(folder, block string) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	ext, ok := p.index[folder][block]
+	if !ok {
+		return nil, &os.PathError{Op: "get", Path: folder + "/" + block, Err: os.ErrNotExist}
+	}
+	if p.file == nil {
+		return nil, os.ErrClosed
+	}
+	data := make([]byte, ext.n)
+	if _, err := p.file.ReadAt(data, ext.off); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Delete removes a block from a folder.
+func (p *PackColdStorage) Delete(folder, block string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.index[folder][block]; !ok {
+		return &os.PathError{Op: "delete", Path: folder + "/" + block, Err: os.ErrNotExist}
+	}
+	rec, _ := encodePackRecord('D', folder, block, nil)
+	if _, err := p.appendRecord(rec); err != nil {
+		return err
+	}
+	p.drop(folder, block)
+	p.dead += int64(len(rec))
+	return nil
+}
+
+// DeleteFolder removes an empty folder. Folders exist only while they
+// hold blocks, so this only reports whether the folder is empty.
+func (p *PackColdStorage) DeleteFolder(folder string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.index[folder]) > 0 {
+		return &os.PathError{Op: "deletefolder", Path: folder, Err: errors.New("folder not empty")}
+	}
+	return nil
+}
+
+// empty reports whether the pack holds no blocks.
+func (p *PackColdStorage) empty() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.index) == 0
+}
+
+// DeadBytes reports the space held by superseded and deleted records -
+// what Compact would reclaim.
+func (p *PackColdStorage) DeadBytes() int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.dead
+}
+
+// Compact rewrites the pack with only its live blocks, reclaiming the
+// space of superseded and deleted records. The new pack is written to
+// "<path>.tmp" and renamed into place.
+func (p *PackColdStorage) Compact() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return os.ErrClosed
+	}
+
+	tmpPath := p.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	if _, err := w.WriteString(packMagic); err != nil {
+		return fail(err)
+	}
+	off := int64(len(packMagic))
+	index := make(map[string]map[string]packExtent, len(p.index))
+	for folder, blocks := range p.index {
+		nb := make(map[string]packExtent, len(blocks))
+		for block, ext := range blocks {
+			data := make([]byte, ext.n)
+			if _, err := p.file.ReadAt(data, ext.off); err != nil {
+				return fail(err)
+			}
+			rec, dataOffset := encodePackRecord('S', folder, block, data)
+			if _, err := w.Write(rec); err != nil {
+				return fail(err)
+			}
+			nb[block] = packExtent{off: off + dataOffset, n: ext.n}
+			off += int64(len(rec))
+		}
+		index[folder] = nb
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, p.path); err != nil {
+		return fail(err)
+	}
+
+	p.file.Close()
+	p.file, p.index, p.size, p.dead = tmp, index, off, 0
+	return nil
+}
+
+// Close releases the pack file. Further operations fail.
+func (p *PackColdStorage) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return nil
+	}
+	err := p.file.Close()
+	p.file = nil
+	return err
+}
+
+// MigrateColdStorageDir copies every block of a directory cold store
+// (the ColdStoragePath layout: one subdirectory per folder, one file per
+// block) into dst. Stray "*.tmp" files - interrupted writes - are
+// skipped. The source directory is left untouched; remove it once the
+// migration is confirmed. Returns the number of blocks copied.
+func MigrateColdStorageDir(dir string, dst ColdStorageInterface) (int, error) {
+	folders, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	copied := 0
+	for _, fe := range folders {
+		if !fe.IsDir() {
+			continue
+		}
+		blocks, err := os.ReadDir(filepath.Join(dir, fe.Name()))
+		if err != nil {
+			return copied, err
+		}
+		for _, be := range blocks {
+			if be.IsDir() || strings.HasSuffix(be.Name(), ".tmp") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, fe.Name(), be.Name()))
+			if err != nil {
+				return copied, err
+			}
+			if err := dst.Set(fe.Name(), be.Name(), data); err != nil {
+				return copied, err
+			}
+			copied++
+		}
+	}
+	return copied, nil
+}
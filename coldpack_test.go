@@ -0,0 +1,171 @@
+package garland
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackColdStorageRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cold.pack")
+	p, err := OpenPackColdStorage(path)
+	if err != nil {
+		t.Fatalf("OpenPackColdStorage: %v", err)
+	}
+
+	p.Set("g1", "b1", []byte("first"))
+	p.Set("g1", "b2", []byte("second"))
+	p.Set("g1", "b1", []byte("replaced"))
+	p.Set("g2", "b1", []byte("other folder"))
+	if err := p.Delete("g1", "b2"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := p.DeleteFolder("g1"); err == nil {
+		t.Error("DeleteFolder on a non-empty folder should fail")
+	}
+	p.Close()
+
+	// Reopen: the index is rebuilt from the log.
+	p, err = OpenPackColdStorage(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer p.Close()
+	if d, _ := p.Get("g1", "b1"); string(d) != "replaced" {
+		t.Errorf("g1/b1 = %q, want %q", d, "replaced")
+	}
+	if d, _ := p.Get("g2", "b1"); string(d) != "other folder" {
+		t.Errorf("g2/b1 = %q", d)
+	}
+	if _, err := p.Get("g1", "b2"); !os.IsNotExist(err) {
+		t.Errorf("deleted block: err = %v, want not-exist", err)
+	}
+
+	// Compaction drops dead records and keeps live ones.
+	before, _ := os.Stat(path)
+	if err := p.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() || p.DeadBytes() != 0 {
+		t.Errorf("Compact: size %d -> %d, dead=%d", before.Size(), after.Size(), p.DeadBytes())
+	}
+	if d, _ := p.Get("g1", "b1"); string(d) != "replaced" {
+		t.Errorf("after Compact g1/b1 = %q", d)
+	}
+}
+
+func TestPackColdStorageTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cold.pack")
+	p, _ := OpenPackColdStorage(path)
+	p.Set("g", "good", []byte("intact"))
+	p.Set("g", "torn", []byte("this record gets cut short"))
+	p.Close()
+
+	info, _ := os.Stat(path)
+	os.Truncate(path, info.Size()-5)
+
+	p, err := OpenPackColdStorage(path)
+	if err != nil {
+		t.Fatalf("reopen after torn write: %v", err)
+	}
+	defer p.Close()
+	if d, _ := p.Get("g", "good"); string(d) != "intact" {
+		t.Errorf("good block = %q", d)
+	}
+	if _, err := p.Get("g", "torn"); err == nil {
+		t.Error("torn record should be discarded")
+	}
+
+	// Appends after recovery land after the truncated tail.
+	p.Set("g", "next", []byte("after recovery"))
+	if d, _ := p.Get("g", "next"); string(d) != "after recovery" {
+		t.Errorf("next block = %q", d)
+	}
+}
+
+func TestLibraryColdStorageFileWithMigration(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "legacy")
+	os.MkdirAll(filepath.Join(legacy, "folder"), 0755)
+	os.WriteFile(filepath.Join(legacy, "folder", "block"), []byte("migrated"), 0644)
+	os.WriteFile(filepath.Join(legacy, "folder", "partial.tmp"), []byte("junk"), 0644)
+
+	packPath := filepath.Join(dir, "cold.pack")
+	lib, err := Init(LibraryOptions{ColdStorageFile: packPath, ColdStoragePath: legacy})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer lib.Close()
+
+	if d, err := lib.coldStorageBackend.Get("folder", "block"); err != nil || string(d) != "migrated" {
+		t.Errorf("migrated block = %q, %v", d, err)
+	}
+	if _, err := lib.coldStorageBackend.Get("folder", "partial.tmp"); err == nil {
+		t.Error(".tmp files must not be migrated")
+	}
+
+	// The library chills and thaws through the pack.
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatalf("Chill: %v", err)
+	}
+	if st := g.MemoryUsage(); st.ColdStoredLeaves == 0 {
+		t.Errorf("nothing chilled: %+v", st)
+	}
+	if d, _ := g.NewCursor().ReadBytes(11); string(d) != "Hello World" {
+		t.Errorf("content after thaw = %q", d)
+	}
+	if _, err := os.Stat(filepath.Join(dir, g.id)); !os.IsNotExist(err) {
+		t.Error("pack backend should not create per-folder directories")
+	}
+}
+
+func TestPackColdStorageCorruptMiddleRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cold.pack")
+	p, _ := OpenPackColdStorage(path)
+	p.Set("g", "before", []byte("kept"))
+	p.Set("g", "damaged", []byte("old copy"))
+	p.Set("g", "damaged", []byte("bit rot lands here"))
+	p.Set("g", "after", []byte("also kept"))
+	p.Close()
+
+	// Flip a byte inside the second copy of "damaged".
+	data, _ := os.ReadFile(path)
+	i := bytes.Index(data, []byte("bit rot"))
+	data[i] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	p, err := OpenPackColdStorage(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if d, _ := p.Get("g", "before"); string(d) != "kept" {
+		t.Errorf("before = %q", d)
+	}
+	if d, _ := p.Get("g", "after"); string(d) != "also kept" {
+		t.Errorf("a record after the damage = %q, want it indexed", d)
+	}
+	if d, err := p.Get("g", "damaged"); err == nil {
+		t.Errorf("damaged block read back as %q; it must not fall back to the old copy", d)
+	}
+	p.Close()
+	if info, _ := os.Stat(path); info.Size() != int64(len(data)) {
+		t.Errorf("pack cut from %d to %d bytes", len(data), info.Size())
+	}
+
+	// Damaged framing mid-file cannot be skipped: the pack refuses to
+	// open instead of dropping what follows.
+	j := bytes.Index(data, []byte("also kept"))
+	data[bytes.LastIndexByte(data[:j], 'S')] = 'X'
+	os.WriteFile(path, data, 0644)
+	if _, err := OpenPackColdStorage(path); !errors.Is(err, errColdPackCorrupt) {
+		t.Errorf("bad framing: err = %v, want errColdPackCorrupt", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != int64(len(data)) {
+		t.Error("a pack that failed to open was truncated")
+	}
+}
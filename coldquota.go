@@ -0,0 +1,171 @@
+package garland
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// coldquota.go - cold storage disk quota.
+//
+// DESIGN: cold storage usually lives on a temp partition, and nothing
+// about chilling is bounded by the partition's size - a long session
+// over a big file could quietly fill it. LibraryOptions.ColdStorageQuota
+// caps the bytes the library will hand to the backend.
+//
+// ACCOUNTING: every chill charges its blocks (data plus the ".dec"
+// decoration block) against the library-wide total, keyed per garland
+// by block name so re-chilling a thawed snapshot (same block name,
+// rewritten in place) is not counted twice. The charge is taken BEFORE
+// the write - including a write handed to the write-behind queue - and
+// refunded if the write fails, so in-flight blocks can never push the
+// total past the quota.
+//
+// RELEASE: a charge lasts exactly as long as its blocks. When snapshot
+// GC (Prune, DeleteFork) drops a snapshot, its blocks are deleted from
+// the backend and refunded; Close does the same for every block the
+// garland still holds and removes its folder. A block that will not
+// delete stays charged - it still occupies the backend. A queued write
+// whose charge was released before it landed deletes what it wrote.
+//
+// ENFORCEMENT: a chill that would exceed the quota is REFUSED with
+// ErrColdStorageQuota; the snapshot simply stays in memory. Eviction
+// does not stop at the quota though: once usage reaches
+// coldQuotaPressure (90%) of the quota, LRU chilling tries
+// warm-eligible leaves first - evicting to the source file costs no
+// cold storage at all.
+
+// coldQuotaPressure is the fraction of the quota past which eviction
+// prefers warm-eligible leaves.
+const coldQuotaPressure = 0.9
+
+// ColdStorageUsage reports cold storage consumption.
+type ColdStorageUsage struct {
+	Bytes  int64 // bytes charged against the quota (all garlands)
+	Blocks int   // snapshots with blocks in cold storage (all garlands)
+	Quota  int64 // configured quota (0 = unlimited)
+}
+
+// coldQuota is the library-wide cold storage ledger. Its own mutex
+// keeps it usable from under a garland's lock (lib.mu must not be taken
+// there - lib.mu is always acquired before g.mu).
+type coldQuota struct {
+	mu     sync.Mutex
+	limit  int64 // 0 = unlimited
+	bytes  int64
+	blocks int
+}
+
+// charge adjusts the ledger by delta bytes (and blockDelta blocks),
+// refusing growth past the limit.
+func (q *coldQuota) charge(delta int64, blockDelta int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if delta > 0 && q.limit > 0 && q.bytes+delta > q.limit {
+		return ErrColdStorageQuota
+	}
+	q.bytes += delta
+	q.blocks += blockDelta
+	return nil
+}
+
+// underPressure reports whether usage has reached coldQuotaPressure of
+// the limit.
+func (q *coldQuota) underPressure() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.limit > 0 && float64(q.bytes) >= coldQuotaPressure*float64(q.limit)
+}
+
+// chargeColdLocked charges a snapshot's cold blocks (size bytes in
+// total) under blockName, replacing any earlier charge for the same
+// name. Returns the previous charge (for refundColdLocked) or
+// ErrColdStorageQuota. Caller must hold the write lock.
+func (g *Garland) chargeColdLocked(blockName string, size int64) (int64, error) {
+	if g.coldClosed {
+		return 0, ErrColdStorageFailure
+	}
+	prev, existed := g.coldCharges[blockName]
+	blockDelta := 1
+	if existed {
+		blockDelta = 0
+	}
+	if err := g.lib.coldQuota.charge(size-prev, blockDelta); err != nil {
+		return 0, err
+	}
+	if g.coldCharges == nil {
+		g.coldCharges = make(map[string]int64)
+	}
+	g.coldCharges[blockName] = size
+	g.coldBytes += size - prev
+	return prev, nil
+}
+
+// refundColdLocked undoes chargeColdLocked after a failed write,
+// restoring the previous charge (prev 0 = the block was never stored).
+// Caller must hold the write lock.
+func (g *Garland) refundColdLocked(blockName string, prev int64) {
+	cur, ok := g.coldCharges[blockName]
+	if !ok {
+		return
+	}
+	blockDelta := 0
+	if prev == 0 {
+		blockDelta = -1
+		delete(g.coldCharges, blockName)
+	} else {
+		g.coldCharges[blockName] = prev
+	}
+	_ = g.lib.coldQuota.charge(prev-cur, blockDelta)
+	g.coldBytes += prev - cur
+}
+
+// releaseColdLocked deletes a snapshot's cold blocks (data and
+// decorations) and refunds their charge; a no-op for a block that was
+// never charged. Caller must hold the write lock.
+func (g *Garland) releaseColdLocked(blockName string) {
+	cur, ok := g.coldCharges[blockName]
+	if !ok || !g.deleteColdBlocksLocked(blockName) {
+		return
+	}
+	delete(g.coldCharges, blockName)
+	_ = g.lib.coldQuota.charge(-cur, -1)
+	g.coldBytes -= cur
+}
+
+// deleteColdBlocksLocked removes blockName and its decoration block
+// from the backend, reporting whether both are gone (one that was
+// never written counts as gone). Caller must hold the write lock.
+func (g *Garland) deleteColdBlocksLocked(blockName string) bool {
+	gone := true
+	for _, name := range []string{blockName, blockName + ".dec"} {
+		err := g.lib.coldStorageBackend.Delete(g.id, name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			gone = false
+		}
+	}
+	return gone
+}
+
+// closeColdStorageLocked releases every block the garland holds and
+// removes its folder; chills after this are refused. Called by Close
+// with the write lock held.
+func (g *Garland) closeColdStorageLocked() {
+	g.coldClosed = true
+	if g.lib == nil || g.lib.coldStorageBackend == nil {
+		return
+	}
+	for blockName := range g.coldCharges {
+		g.releaseColdLocked(blockName)
+	}
+	_ = g.lib.coldStorageBackend.DeleteFolder(g.id)
+}
+
+// ColdStorageUsage reports the library's cold storage consumption
+// against the configured quota.
+func (lib *Library) ColdStorageUsage() ColdStorageUsage {
+	q := &lib.coldQuota
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return ColdStorageUsage{Bytes: q.bytes, Blocks: q.blocks, Quota: q.limit}
+}
@@ -0,0 +1,210 @@
+package garland
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestColdQuotaRefusesChill(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir(), ColdStorageQuota: 16})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("a", 64)})
+	defer g.Close()
+
+	g.mu.Lock()
+	var err error
+	for _, node := range g.nodeRegistry {
+		for forkRev, snap := range node.history {
+			if snap.isLeaf && len(snap.data) > 0 {
+				err = g.chillSnapshot(node.id, forkRev, snap)
+			}
+		}
+	}
+	g.mu.Unlock()
+
+	if !errors.Is(err, ErrColdStorageQuota) {
+		t.Fatalf("chill over quota: err = %v, want ErrColdStorageQuota", err)
+	}
+	if u := lib.ColdStorageUsage(); u.Bytes != 0 || u.Blocks != 0 || u.Quota != 16 {
+		t.Errorf("usage after refusal = %+v", u)
+	}
+	if st := g.MemoryUsage(); st.MemoryBytes != 64 || st.ColdStoredLeaves != 0 {
+		t.Errorf("refused chill should leave data in memory: %+v", st)
+	}
+}
+
+func TestColdQuotaAccounting(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir(), ColdStorageQuota: 1 << 20})
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatalf("Chill: %v", err)
+	}
+	u := lib.ColdStorageUsage()
+	if u.Bytes != 11 || u.Blocks != 1 {
+		t.Fatalf("usage after chill = %+v, want 11 bytes in 1 block", u)
+	}
+	if st := g.MemoryUsage(); st.ColdBytes != 11 || st.ColdQuota != 1<<20 {
+		t.Errorf("MemoryUsage cold fields = %+v", st)
+	}
+
+	// Thaw and re-chill: the same block is rewritten, not double-counted.
+	if err := g.Thaw(); err != nil {
+		t.Fatalf("Thaw: %v", err)
+	}
+	g.Chill(ChillEverything)
+	if u := lib.ColdStorageUsage(); u.Bytes != 11 || u.Blocks != 1 {
+		t.Errorf("usage after re-chill = %+v, want unchanged", u)
+	}
+}
+
+func TestColdQuotaRefundsFailedWriteBack(t *testing.T) {
+	backend := &gatedColdStorage{
+		inner: newFSColdStorage(&localFileSystem{}, t.TempDir()),
+		gate:  make(chan struct{}),
+		fail:  true,
+	}
+	close(backend.gate)
+	lib, _ := Init(LibraryOptions{
+		ColdStorageBackend: backend,
+		ColdWriteBackQueue: 4,
+		ColdStorageQuota:   1 << 20,
+	})
+	defer lib.Close()
+
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+
+	g.Chill(ChillEverything)
+	lib.FlushColdWrites()
+
+	if u := lib.ColdStorageUsage(); u.Bytes != 0 || u.Blocks != 0 {
+		t.Errorf("failed write should be refunded: %+v", u)
+	}
+}
+
+// coldBlockFiles counts the garland's blocks in a directory cold store
+// (-1 when its folder is gone).
+func coldBlockFiles(t *testing.T, dir string, g *Garland) int {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(dir, g.id))
+	if errors.Is(err, os.ErrNotExist) {
+		return -1
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestColdQuotaChillReportsRefusal(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir(), ColdStorageQuota: 40})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("a", 64), MaxLeafSize: 16})
+	defer g.Close()
+
+	// The leaves that fit are chilled; the rest are refused and stay put.
+	if err := g.Chill(ChillEverything); !errors.Is(err, ErrColdStorageQuota) {
+		t.Fatalf("Chill over quota: err = %v, want ErrColdStorageQuota", err)
+	}
+	st := g.MemoryUsage()
+	if u := lib.ColdStorageUsage(); u.Bytes > 40 || u.Bytes != st.ColdLeafBytes {
+		t.Errorf("usage = %+v, cold leaf bytes %d", u, st.ColdLeafBytes)
+	}
+	if st.ColdStoredLeaves == 0 || st.InMemoryLeaves == 0 || st.ColdLeafBytes+st.InMemoryLeafBytes != 64 {
+		t.Errorf("leaves after a partial chill: %+v", st)
+	}
+	if got := readAll(t, g); got != strings.Repeat("a", 64) {
+		t.Errorf("content after a partial chill: %q", got)
+	}
+}
+
+func TestColdQuotaReleasedOnClose(t *testing.T) {
+	dir := t.TempDir()
+	lib, _ := Init(LibraryOptions{ColdStoragePath: dir, ColdStorageQuota: 1 << 20})
+	g, _ := lib.Open(FileOptions{DataString: "Hello World", MaxLeafSize: 4})
+	other, _ := lib.Open(FileOptions{DataString: "kept"})
+	defer other.Close()
+	at := ByteAddress(2)
+	g.Decorate([]DecorationEntry{{Key: "mark", Address: &at}})
+	g.Chill(ChillEverything)
+	other.Chill(ChillEverything)
+
+	before := lib.ColdStorageUsage()
+	if n := coldBlockFiles(t, dir, g); n < 4 {
+		t.Fatalf("%d block files after the chill", n)
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := coldBlockFiles(t, dir, g); n != -1 {
+		t.Errorf("closed garland's folder still holds %d files", n)
+	}
+	if u := lib.ColdStorageUsage(); u.Bytes != 4 || u.Blocks != 1 || before.Bytes <= u.Bytes {
+		t.Errorf("usage after close = %+v (before %+v); want only the other garland's", u, before)
+	}
+	if coldBlockFiles(t, dir, other) != 1 {
+		t.Error("closing one garland touched another's blocks")
+	}
+}
+
+func TestColdQuotaReleasedOnPrune(t *testing.T) {
+	dir := t.TempDir()
+	lib, _ := Init(LibraryOptions{ColdStoragePath: dir, ColdStorageQuota: 1 << 20})
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+	c := g.NewCursor()
+	for i := 0; i < 4; i++ {
+		c.InsertString("x", nil, false)
+	}
+	g.Chill(ChillEverything)
+
+	before := lib.ColdStorageUsage()
+	files := coldBlockFiles(t, dir, g)
+	if err := g.Prune(g.CurrentRevision()); err != nil {
+		t.Fatal(err)
+	}
+	after := lib.ColdStorageUsage()
+	if after.Blocks >= before.Blocks || after.Bytes >= before.Bytes {
+		t.Fatalf("prune refunded nothing: %+v -> %+v", before, after)
+	}
+	if n := coldBlockFiles(t, dir, g); n != files-(before.Blocks-after.Blocks) {
+		t.Errorf("%d block files after prune, want %d", n, files-(before.Blocks-after.Blocks))
+	}
+	if st := g.MemoryUsage(); st.ColdBytes != after.Bytes {
+		t.Errorf("garland's cold bytes %d, library's %d", st.ColdBytes, after.Bytes)
+	}
+	if got := readAll(t, g); got != "xxxxHello World" {
+		t.Errorf("content after prune: %q", got)
+	}
+}
+
+func TestColdQuotaReleasedWhileQueued(t *testing.T) {
+	dir := t.TempDir()
+	backend := &gatedColdStorage{inner: newFSColdStorage(&localFileSystem{}, dir), gate: make(chan struct{})}
+	lib, _ := Init(LibraryOptions{ColdStorageBackend: backend, ColdWriteBackQueue: 16, ColdStorageQuota: 1 << 20})
+	defer lib.Close()
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+	c := g.NewCursor()
+	c.InsertString("x", nil, false)
+
+	// Both revisions' leaves are queued; prune drops the old one's
+	// snapshot (and charge) before its write lands.
+	g.Chill(ChillEverything)
+	if err := g.Prune(g.CurrentRevision()); err != nil {
+		t.Fatal(err)
+	}
+	close(backend.gate)
+	if err := lib.FlushColdWrites(); err != nil {
+		t.Fatal(err)
+	}
+	if u := lib.ColdStorageUsage(); u.Blocks != 1 || u.Bytes != 12 {
+		t.Errorf("usage = %+v, want the surviving leaf only", u)
+	}
+	if n := coldBlockFiles(t, dir, g); n != 1 {
+		t.Errorf("%d block files, want 1: the pruned leaf's late write was kept", n)
+	}
+}
@@ -0,0 +1,71 @@
+package garland
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf8"
+)
+
+// count_kernels.go - rune and newline counting for leaf statistics.
+//
+// DESIGN: every leaf rebuild, insert, delete and overwrite weighs its
+// bytes in runes and newlines, and opening a file weighs all of it - on
+// the 1GB workload that is a gigabyte of counting before the first
+// edit. The obvious loops (ranging over the bytes comparing to '\n',
+// len([]rune(string(data)))) touch one byte per iteration and the rune
+// conversion also allocates four bytes per rune. The kernels here:
+//
+//   - countNewlines is bytes.Count, which the runtime implements with
+//     SIMD on the common architectures.
+//   - countRunes tests eight bytes at a time for the high bit. Text is
+//     overwhelmingly ASCII, and an ASCII word is eight runes without
+//     decoding. Stretches of words holding non-ASCII bytes go to
+//     utf8.RuneCount.
+//
+// RULING: countRunes must equal utf8.RuneCount on ANY input, invalid
+// UTF-8 included, since reads decode with the utf8 package (an invalid
+// byte is one RuneError). Splitting only in front of an ASCII byte
+// guarantees it: no encoding, valid or not, continues through an ASCII
+// byte, so the counts of the pieces add up. No assembly: the word loop
+// and the runtime's bytes.Count get within a small factor of memory
+// bandwidth, which is not worth per-architecture code.
+
+// highBits masks the high bit of each byte of a little-endian word.
+const highBits = 0x8080808080808080
+
+// countNewlines returns the number of '\n' bytes in data.
+func countNewlines(data []byte) int64 {
+	return int64(bytes.Count(data, newline))
+}
+
+// newline is the separator countNewlines counts.
+var newline = []byte{'\n'}
+
+// countRunes returns utf8.RuneCount(data), skipping ASCII a word at a
+// time.
+func countRunes(data []byte) int64 {
+	n := len(data)
+	runes := int64(n)
+	i := 0
+	for i+8 <= n {
+		if binary.LittleEndian.Uint64(data[i:])&highBits == 0 {
+			i += 8
+			continue
+		}
+		// A non-ASCII stretch runs to the next all-ASCII word (whose
+		// first byte starts a rune) or the end of the data.
+		j := i + 8
+		for j+8 <= n && binary.LittleEndian.Uint64(data[j:])&highBits != 0 {
+			j += 8
+		}
+		if j+8 > n {
+			j = n
+		}
+		runes -= int64(j-i) - int64(utf8.RuneCount(data[i:j]))
+		i = j
+	}
+	if i < n {
+		runes -= int64(n-i) - int64(utf8.RuneCount(data[i:]))
+	}
+	return runes
+}
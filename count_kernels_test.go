@@ -0,0 +1,47 @@
+package garland
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCountKernels(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pieces := []string{"a", "hello world ", "\n", "é", "✓", "𝄞", "\x80", "\xff", "\xe2\x9c", "\xf0\x9d\x84"}
+	inputs := []string{"", "\n", "abcdefgh", "abcdefg\xe2", "\xe2\x9c\x93abcdefgh", "abcdefgh\xe2\x9c\x93"}
+	for n := 0; n < 500; n++ {
+		var sb strings.Builder
+		for k := rng.Intn(60); k > 0; k-- {
+			sb.WriteString(pieces[rng.Intn(len(pieces))])
+		}
+		inputs = append(inputs, sb.String())
+	}
+	for _, in := range inputs {
+		data := []byte(in)
+		for off := 0; off < len(data) && off < 9; off++ {
+			// Unaligned starts too: words then straddle the pieces.
+			d := data[off:]
+			if got, want := countRunes(d), int64(utf8.RuneCount(d)); got != want {
+				t.Fatalf("countRunes(%q) = %d, want %d", d, got, want)
+			}
+			if got, want := countNewlines(d), int64(bytes.Count(d, []byte{'\n'})); got != want {
+				t.Fatalf("countNewlines(%q) = %d, want %d", d, got, want)
+			}
+		}
+	}
+
+	// The leaf index built on the kernels agrees with a rune-by-rune walk.
+	for _, in := range inputs[:100] {
+		snap := createLeafSnapshot([]byte(in), nil, 0)
+		if snap.runeCount != int64(utf8.RuneCountInString(in)) || snap.lineCount != int64(strings.Count(in, "\n")) {
+			t.Fatalf("leaf %q: %d runes %d lines", in, snap.runeCount, snap.lineCount)
+		}
+		last := strings.LastIndexByte(in, '\n')
+		if want := int64(utf8.RuneCountInString(in[last+1:])); snap.runesAfterLastNewline != want {
+			t.Fatalf("leaf %q: %d runes after last newline, want %d", in, snap.runesAfterLastNewline, want)
+		}
+	}
+}
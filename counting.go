@@ -0,0 +1,177 @@
+package garland
+
+import "time"
+
+// counting.go - deferred rune/line indexing for binary-heavy documents.
+//
+// DESIGN: every leaf carries its rune count, newline count and line
+// starts index, and opening a document computes them for every leaf -
+// a full UTF-8 decode and newline scan of the file. For a large binary
+// that work is wasted: a hex editor addresses bytes, and rune or line
+// numbers of a firmware image mean nothing. FileOptions.Counting =
+// CountDeferred opens with the leaves UNCOUNTED (byte weights only) and
+// indexes them the first time anything asks for a rune or line:
+//
+//   - Leaves built by the initial load are created uncounted, and an
+//     internal snapshot over an uncounted child is uncounted too. Edits
+//     made meanwhile build counted leaves as usual (they are small);
+//     the internal nodes above them stay uncounted until the recount.
+//   - Byte-addressed work never needs the counts. While deferred the
+//     byte-to-rune/line conversions that only keep cursors' other
+//     coordinates current answer 0; the totals, cursors and recorded
+//     cursor history hold placeholders.
+//   - Every rune- or line-addressed entry point (seeks, reads, counts,
+//     line decorations, views, OT, ...) calls ensureCounts first. The
+//     first such call takes the write lock and indexes every uncounted
+//     snapshot in history - thawing chilled leaves for the scan and
+//     chilling them again - then recomputes the totals, every cursor's
+//     coordinates, and the positions recorded for undo and rollback.
+//     The document is eager from then on.
+//
+// RULING: the flag only ever goes from deferred to counted, so a reader
+// that has called ensureCounts may take the read lock and rely on the
+// counts; ensureCountsLocked under a read lock is then a no-op.
+// Streaming (DataChannel) sources count as they load and ignore the
+// option.
+
+// CountingMode selects when a document's rune and line index is built.
+type CountingMode int
+
+const (
+	// CountEager indexes runes and lines while loading (the default).
+	CountEager CountingMode = iota
+
+	// CountDeferred loads byte weights only and builds the rune/line
+	// index the first time a rune- or line-addressed operation needs
+	// it. Speeds opening large binaries that are only edited by byte.
+	CountDeferred
+)
+
+// CountsDeferred reports whether the rune/line index has not been
+// built yet (see CountDeferred).
+func (g *Garland) CountsDeferred() bool {
+	return g.countsDeferred.Load()
+}
+
+// createUncountedLeafSnapshot creates a leaf snapshot carrying only its
+// byte weight; indexCounts fills in the rest.
+func createUncountedLeafSnapshot(data []byte, originalOffset int64) *NodeSnapshot {
+	return &NodeSnapshot{
+		isLeaf:             true,
+		data:               data,
+		storageState:       StorageMemory,
+		originalFileOffset: originalOffset,
+		byteCount:          int64(len(data)),
+		uncounted:          true,
+		lastAccessTime:     time.Now(),
+	}
+}
+
+// ensureCounts builds the deferred rune/line index, if any. Called
+// without the lock, before taking it to read rune or line state.
+func (g *Garland) ensureCounts() {
+	if !g.countsDeferred.Load() {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+}
+
+// ensureCountsLocked is ensureCounts for a caller holding the write
+// lock (or, once counts are built, either lock).
+func (g *Garland) ensureCountsLocked() {
+	if !g.countsDeferred.Load() {
+		return
+	}
+	g.countsDeferred.Store(false)
+	g.invalidateLeafHints()
+
+	for _, node := range g.nodeRegistry {
+		for key, snap := range node.history {
+			g.countSnapshotLocked(node, key, snap)
+		}
+	}
+	g.updateCountsFromRoot()
+	g.reconcileCursorCoordinates()
+
+	// Recorded positions were captured with placeholder coordinates;
+	// redo each against the version it belongs to.
+	for _, c := range g.cursors {
+		for key, pos := range c.positionHistory {
+			if info := g.findRevisionInfo(key.Fork, key.Revision); info != nil {
+				g.recountPositionLocked(treeState{root: g.nodeRegistry[info.RootID], fork: key.Fork, rev: key.Revision}, pos)
+			}
+		}
+	}
+	if tx := g.transaction; tx != nil {
+		st := treeState{root: g.nodeRegistry[tx.preTransactionRoot], fork: tx.preTransactionFork, rev: tx.preTransactionRev}
+		for _, pos := range tx.preTransactionCursors {
+			g.recountPositionLocked(st, pos)
+		}
+	}
+}
+
+// countSnapshotLocked indexes snap (at history key on node) and, for an
+// internal snapshot, the uncounted snapshots below it.
+func (g *Garland) countSnapshotLocked(node *Node, key ForkRevision, snap *NodeSnapshot) {
+	if snap == nil || !snap.uncounted {
+		return
+	}
+	if snap.isLeaf {
+		resident := snap.storageState == StorageMemory
+		if err := g.ensureSnapshotData(node, key, snap); err != nil {
+			// Unreadable: weigh it as single-byte runes with no lines,
+			// as a placeholder reads.
+			snap.uncounted = false
+			snap.runeCount = snap.byteCount
+			snap.runesAfterLastNewline = snap.byteCount
+			snap.lineStarts = []LineStart{{}}
+			return
+		}
+		snap.indexCounts()
+		if !resident {
+			g.chillSnapshotWithTrust(node.id, key, snap) // best effort: stays resident otherwise
+		}
+		return
+	}
+
+	children := [2]*NodeSnapshot{}
+	for i, id := range [2]NodeID{snap.leftID, snap.rightID} {
+		child := g.nodeRegistry[id]
+		if child == nil {
+			return
+		}
+		childSnap, childKey := child.snapshotAtWithKey(key.Fork, key.Revision)
+		if childSnap == nil {
+			return
+		}
+		g.countSnapshotLocked(child, childKey, childSnap)
+		children[i] = childSnap
+	}
+	counted := createInternalSnapshot(snap.leftID, snap.rightID, children[0], children[1])
+	snap.runeCount = counted.runeCount
+	snap.lineCount = counted.lineCount
+	snap.runesAfterLastNewline = counted.runesAfterLastNewline
+	snap.uncounted = counted.uncounted
+}
+
+// recountPositionLocked recomputes pos's rune and line coordinates from
+// its byte position in version st.
+func (g *Garland) recountPositionLocked(st treeState, pos *CursorPosition) {
+	g.withStateLocked(st, func() error {
+		b := min(pos.BytePos, g.totalBytes)
+		pos.RunePos, _ = g.byteToRuneInternalUnlocked(b)
+		pos.Line, pos.LineRune, _ = g.byteToLineRuneInternalUnlocked(b)
+		return nil
+	})
+}
+
+// newLoadedLeafSnapshot creates a leaf of the initial load, uncounted
+// when counting is deferred.
+func (g *Garland) newLoadedLeafSnapshot(data []byte, fileOffset int64) *NodeSnapshot {
+	if g.countsDeferred.Load() {
+		return createUncountedLeafSnapshot(data, fileOffset)
+	}
+	return createLeafSnapshot(data, nil, fileOffset)
+}
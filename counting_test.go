@@ -0,0 +1,106 @@
+package garland
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDeferredCounting(t *testing.T) {
+	content := strings.Repeat("héllo\nwörld ✓\n", 200)
+	lib, _ := Init(LibraryOptions{})
+	g, err := lib.Open(FileOptions{DataString: content, MaxLeafSize: 64, Counting: CountDeferred})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if !g.CountsDeferred() {
+		t.Fatal("counts built at open")
+	}
+	if snap := g.root.snapshotAt(g.currentFork, g.currentRevision); !snap.uncounted {
+		t.Error("root snapshot is counted")
+	}
+
+	// Byte work: seeks, reads, edits and undo leave the counts deferred.
+	c := g.NewCursor()
+	other := g.NewCursor()
+	if err := other.SeekByte(int64(len(content)) - 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SeekByte(100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.InsertString("ünï\n", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	rev := g.CurrentRevision()
+	if _, _, err := c.DeleteBytes(9, false); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := c.ReadBytes(4); err != nil || len(b) != 4 {
+		t.Fatalf("ReadBytes %q %v", b, err)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("while deferred: %v", v)
+	}
+	if !g.CountsDeferred() {
+		t.Fatal("byte work built the counts")
+	}
+
+	// The first line-addressed operation builds them.
+	want := readAll(t, g)
+	if got := g.LineCount().Value; got != int64(strings.Count(want, "\n")) {
+		t.Errorf("%d lines, want %d", got, strings.Count(want, "\n"))
+	}
+	if g.CountsDeferred() {
+		t.Fatal("LineCount left the counts deferred")
+	}
+	if got := g.RuneCount().Value; got != int64(utf8.RuneCountInString(want)) {
+		t.Errorf("%d runes, want %d", got, utf8.RuneCountInString(want))
+	}
+	for _, cur := range []*Cursor{c, other} {
+		prefix := want[:cur.BytePos()]
+		line, col := cur.LinePos()
+		wantLine := int64(strings.Count(prefix, "\n"))
+		wantCol := int64(utf8.RuneCountInString(prefix[strings.LastIndexByte(prefix, '\n')+1:]))
+		if cur.RunePos() != int64(utf8.RuneCountInString(prefix)) || line != wantLine || col != wantCol {
+			t.Errorf("cursor at byte %d: rune %d line %d:%d, want %d line %d:%d", cur.BytePos(),
+				cur.RunePos(), line, col, utf8.RuneCountInString(prefix), wantLine, wantCol)
+		}
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("after counting: %v", v)
+	}
+
+	// Positions recorded for undo while deferred come back real.
+	if err := g.UndoSeek(rev); err != nil {
+		t.Fatal(err)
+	}
+	before := readAll(t, g)[:c.BytePos()]
+	if line, _ := c.LinePos(); line != int64(strings.Count(before, "\n")) {
+		t.Errorf("after undo cursor on line %d, want %d", line, strings.Count(before, "\n"))
+	}
+	if got := g.RuneCount().Value; got != int64(utf8.RuneCountInString(readAll(t, g))) {
+		t.Errorf("after undo %d runes", got)
+	}
+}
+
+func TestDeferredCountingView(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "α\nβ\nγ", Counting: CountDeferred})
+	defer g.Close()
+	v, err := g.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Release()
+	if b, _ := v.ReadBytes(0, 2); string(b) != "α" || !g.CountsDeferred() {
+		t.Errorf("view byte read %q", b)
+	}
+	if s, err := v.ReadLine(2); err != nil || s != "γ" {
+		t.Errorf("view line %q %v", s, err)
+	}
+	if v.RuneCount() != 5 || v.LineCount() != 2 {
+		t.Errorf("view counts %d/%d", v.RuneCount(), v.LineCount())
+	}
+}
@@ -0,0 +1,618 @@
+package garland
+
+import (
+	"sync"
+	"unicode/utf8"
+)
+
+// crdt.go - a CRDT identity layer for peer-to-peer editing.
+//
+// DESIGN: OT (ot.go) needs a server to order operations. Peers without
+// one need operations that commute on their own: a sequence CRDT gives
+// every rune a stable identity (site, seq) that never changes as text
+// shifts around it, so an insert says "between rune X and rune Y"
+// rather than "at offset 17", and a delete says "runes X..X+n", which
+// mean the same on every replica whatever else it has seen.
+//
+// The algorithm is YATA (the one behind Yjs): an inserted run records
+// its ORIGINS - the rune it was typed after and the item that followed
+// it - and concurrent inserts between the same origins are ordered by
+// a rule every replica evaluates identically (lower site first, with
+// the origin checks that keep interleaving out). Deleted runes stay as
+// tombstones so later operations can still name them.
+//
+// RULING: the Garland remains the text store; a CRDTReplica holds only
+// identities (runs of IDs, with no bytes) alongside it. Local edits are
+// made with the ordinary Garland API - cursors, transactions, undo -
+// and turned into CRDT operations LAZILY, by diffing the revisions made
+// since the last exchange (the same derivation as RevisionOps), when
+// TakeLocal or Merge runs. Remote operations are integrated into the
+// identity layer and played onto the Garland as ONE revision per Merge.
+// Operations are idempotent and may arrive in any order: one whose
+// dependencies (origins, targets, anchors) have not arrived yet waits
+// in the replica until they do.
+//
+// DECORATIONS converge too, for keys set through the replica: each is
+// anchored to the identity of the rune it sits on (or the document
+// end) with a last-writer-wins stamp (Lamport clock, then site). A
+// decoration whose rune is deleted sits where the rune was. After every
+// exchange the Garland's own positions for those keys are corrected to
+// the anchors, so local edit rules for decorations can never make two
+// replicas disagree.
+//
+// All replicas must start from the same content (it becomes site 0's
+// runs), and each needs a distinct non-zero site ID. The identity
+// layer is a flat run list - O(runs) per operation - which is fine for
+// documents under active collaborative editing; the Garland underneath
+// keeps its usual costs. A replica follows the fork it was created on;
+// switching forks makes TakeLocal and Merge fail with ErrCRDTFork.
+
+// CRDTID identifies one rune: the site that inserted it and its
+// sequence number there. The zero CRDTID means "none" (document start
+// as a left origin, document end as a right origin or anchor).
+type CRDTID struct {
+	Site uint64
+	Seq  uint64
+}
+
+// CRDTStamp orders decoration writes: higher Clock wins, then higher
+// Site.
+type CRDTStamp struct {
+	Clock uint64
+	Site  uint64
+}
+
+func (s CRDTStamp) after(o CRDTStamp) bool {
+	return s.Clock > o.Clock || (s.Clock == o.Clock && s.Site > o.Site)
+}
+
+// CRDTOpKind identifies the kind of a CRDT operation.
+type CRDTOpKind int
+
+const (
+	// CRDTInsert inserts Text, its runes numbered from ID, between
+	// OriginLeft and OriginRight.
+	CRDTInsert CRDTOpKind = iota
+
+	// CRDTDelete deletes the Count runes numbered from ID.
+	CRDTDelete
+
+	// CRDTDecorate sets decoration Key on the rune ID (zero: document
+	// end), or removes it (Removed), if Stamp is the newest write.
+	CRDTDecorate
+)
+
+// CRDTOp is one operation exchanged between replicas.
+type CRDTOp struct {
+	Kind        CRDTOpKind
+	ID          CRDTID
+	OriginLeft  CRDTID
+	OriginRight CRDTID
+	Text        string
+	Count       int64
+	Key         string
+	Removed     bool
+	Stamp       CRDTStamp
+}
+
+// crdtItem is a run of consecutive IDs from one site.
+type crdtItem struct {
+	id          CRDTID // first rune
+	length      int64
+	originLeft  CRDTID
+	originRight CRDTID
+	deleted     bool
+}
+
+// crdtMark is the converged state of one decoration key.
+type crdtMark struct {
+	anchor  CRDTID
+	removed bool
+	stamp   CRDTStamp
+}
+
+// CRDTReplica is one Garland's membership in a peer-to-peer session.
+// Its methods are safe for concurrent use.
+type CRDTReplica struct {
+	mu      sync.Mutex
+	g       *Garland
+	site    uint64
+	seq     uint64 // last sequence number used by this site
+	clock   uint64 // Lamport clock for decoration stamps
+	items   []crdtItem
+	marks   map[string]*crdtMark
+	synced  ForkRevision // the Garland version the identity layer matches
+	outbox  []CRDTOp     // local operations not yet taken
+	pending []CRDTOp     // remote operations waiting on dependencies
+	history []CRDTOp     // every operation integrated, for late joiners
+}
+
+// NewCRDTReplica starts a replica with the given site ID over the
+// Garland's current content, which every replica must share.
+func (g *Garland) NewCRDTReplica(site uint64) (*CRDTReplica, error) {
+	if site == 0 {
+		return nil, ErrInvalidSiteID
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	if g.transaction != nil {
+		return nil, ErrTransactionPending
+	}
+	if g.loader != nil && !g.loader.eofReached {
+		return nil, ErrNotReady
+	}
+	r := &CRDTReplica{
+		g:      g,
+		site:   site,
+		marks:  make(map[string]*crdtMark),
+		synced: ForkRevision{g.currentFork, g.currentRevision},
+	}
+	if g.totalRunes > 0 {
+		r.items = []crdtItem{{id: CRDTID{Site: 0, Seq: 1}, length: g.totalRunes}}
+	}
+	return r, nil
+}
+
+// Site returns the replica's site ID.
+func (r *CRDTReplica) Site() uint64 { return r.site }
+
+// TakeLocal converts the local edits made since the last exchange into
+// operations and returns every local operation not yet taken. Send
+// them to the other replicas.
+func (r *CRDTReplica) TakeLocal() ([]CRDTOp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.captureLocked(); err != nil {
+		return nil, err
+	}
+	if err := r.reconcileMarksLocked(); err != nil {
+		return nil, err
+	}
+	r.syncedNowLocked()
+	out := r.outbox
+	r.outbox = nil
+	return out, nil
+}
+
+// History returns every operation this replica has integrated, local
+// and remote, in an order any replica can Merge to catch up.
+func (r *CRDTReplica) History() []CRDTOp {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CRDTOp(nil), r.history...)
+}
+
+// Pending returns how many remote operations are waiting on operations
+// that have not arrived yet.
+func (r *CRDTReplica) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// Merge integrates remote operations and applies their effect to the
+// Garland as one revision. Local edits made since the last exchange are
+// captured first (into the outbox; TakeLocal returns them). Operations
+// already seen are ignored.
+func (r *CRDTReplica) Merge(ops []CRDTOp) (ChangeResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.captureLocked(); err != nil {
+		return ChangeResult{}, err
+	}
+
+	g := r.g
+	if err := g.TransactionStart("crdt merge"); err != nil {
+		return ChangeResult{}, err
+	}
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+
+	queue := append(r.pending, ops...)
+	r.pending = nil
+	for progress := true; progress && len(queue) > 0; {
+		progress = false
+		var waiting []CRDTOp
+		for _, op := range queue {
+			ok, err := r.integrateRemoteLocked(c, op)
+			if err != nil {
+				g.TransactionRollback()
+				return ChangeResult{}, err
+			}
+			if ok {
+				progress = true
+			} else {
+				waiting = append(waiting, op)
+			}
+		}
+		queue = waiting
+	}
+	r.pending = queue
+
+	if err := r.reconcileMarksLocked(); err != nil {
+		g.TransactionRollback()
+		return ChangeResult{}, err
+	}
+	change, err := g.TransactionCommit()
+	if err != nil {
+		return change, err
+	}
+	r.syncedNowLocked()
+	return change, nil
+}
+
+// Decorate sets decoration key on the rune at runePos (the document
+// end when runePos is the rune count), on the Garland and, through the
+// next TakeLocal, on every replica.
+func (r *CRDTReplica) Decorate(key string, runePos int64) error {
+	return r.setMark(key, runePos, false)
+}
+
+// RemoveDecoration removes decoration key here and on every replica.
+func (r *CRDTReplica) RemoveDecoration(key string) error {
+	return r.setMark(key, 0, true)
+}
+
+func (r *CRDTReplica) setMark(key string, runePos int64, removed bool) error {
+	if !ValidDecorationKey(key) {
+		return ErrInvalidDecorationKey
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.captureLocked(); err != nil {
+		return err
+	}
+	var anchor CRDTID
+	if !removed {
+		if runePos < 0 || runePos > r.visibleLen() {
+			return ErrInvalidPosition
+		}
+		if i, off, ok := r.locateVisible(runePos); ok {
+			anchor = r.idAt(i, off)
+		}
+	}
+	r.clock++
+	op := CRDTOp{Kind: CRDTDecorate, ID: anchor, Key: key, Removed: removed,
+		Stamp: CRDTStamp{Clock: r.clock, Site: r.site}}
+	r.applyMarkLocked(op)
+	r.outbox = append(r.outbox, op)
+	r.history = append(r.history, op)
+	if err := r.reconcileMarksLocked(); err != nil {
+		return err
+	}
+	r.syncedNowLocked()
+	return nil
+}
+
+// captureLocked turns the Garland revisions since the last exchange
+// into local operations.
+func (r *CRDTReplica) captureLocked() error {
+	g := r.g
+	g.mu.RLock()
+	now := ForkRevision{g.currentFork, g.currentRevision}
+	g.mu.RUnlock()
+	if now.Fork != r.synced.Fork {
+		return ErrCRDTFork
+	}
+	if now == r.synced {
+		return nil
+	}
+	op, err := g.OpsBetween(r.synced.Revision, now.Revision)
+	if err != nil {
+		return err
+	}
+	r.synced = now
+
+	vis := int64(0)
+	for _, step := range op.Ops {
+		switch step.Kind {
+		case OTRetain:
+			vis += step.Count
+		case OTInsert:
+			r.localInsertLocked(vis, step.Text, step.Count)
+			vis += step.Count
+		case OTDelete:
+			r.localDeleteLocked(vis, step.Count)
+		}
+	}
+	return nil
+}
+
+// localInsertLocked records a local insert of n runes at visible
+// position vis.
+func (r *CRDTReplica) localInsertLocked(vis int64, text string, n int64) {
+	var left, right CRDTID
+	at := 0 // item index the new run goes in front of
+	if vis > 0 {
+		i, off, _ := r.locateVisible(vis - 1)
+		r.splitAt(i, off+1)
+		left = r.idAt(i, off)
+		at = i + 1
+	}
+	if at < len(r.items) {
+		right = r.items[at].id
+	}
+	id := CRDTID{Site: r.site, Seq: r.seq + 1}
+	r.seq += uint64(n)
+	op := CRDTOp{Kind: CRDTInsert, ID: id, OriginLeft: left, OriginRight: right, Text: text, Count: n}
+	r.insertItem(at, crdtItem{id: id, length: n, originLeft: left, originRight: right})
+	r.outbox = append(r.outbox, op)
+	r.history = append(r.history, op)
+}
+
+// localDeleteLocked records a local delete of n runes at visible
+// position vis.
+func (r *CRDTReplica) localDeleteLocked(vis, n int64) {
+	for n > 0 {
+		i, off, ok := r.locateVisible(vis)
+		if !ok {
+			return
+		}
+		r.splitAt(i, off)
+		if off > 0 {
+			i++
+		}
+		if r.items[i].length > n {
+			r.splitAt(i, n)
+		}
+		it := &r.items[i]
+		it.deleted = true
+		op := CRDTOp{Kind: CRDTDelete, ID: it.id, Count: it.length}
+		r.outbox = append(r.outbox, op)
+		r.history = append(r.history, op)
+		n -= it.length
+	}
+}
+
+// integrateRemoteLocked integrates one remote operation and plays it
+// onto the Garland through c. It reports false (and changes nothing)
+// when the operation's dependencies have not arrived yet.
+func (r *CRDTReplica) integrateRemoteLocked(c *Cursor, op CRDTOp) (bool, error) {
+	switch op.Kind {
+	case CRDTInsert:
+		if op.Count <= 0 || int64(utf8.RuneCountInString(op.Text)) != op.Count {
+			return false, ErrOperationMismatch
+		}
+		if _, _, ok := r.find(op.ID); ok {
+			return true, nil // already integrated
+		}
+		if !r.known(op.OriginLeft) || !r.known(op.OriginRight) {
+			return false, nil
+		}
+		at := r.integrateInsert(op)
+		if err := c.SeekRune(r.visibleBefore(at)); err != nil {
+			return false, err
+		}
+		if _, err := c.InsertString(op.Text, nil, true); err != nil {
+			return false, err
+		}
+		// Our own run, replayed from elsewhere (a restarted replica
+		// catching up from History): never reuse its numbers.
+		if last := op.ID.Seq + uint64(op.Count) - 1; op.ID.Site == r.site && last > r.seq {
+			r.seq = last
+		}
+
+	case CRDTDelete:
+		for k := int64(0); k < op.Count; k++ {
+			if !r.known(CRDTID{Site: op.ID.Site, Seq: op.ID.Seq + uint64(k)}) {
+				return false, nil
+			}
+		}
+		for k := int64(0); k < op.Count; {
+			id := CRDTID{Site: op.ID.Site, Seq: op.ID.Seq + uint64(k)}
+			i, off, _ := r.find(id)
+			r.splitAt(i, off)
+			if off > 0 {
+				i++
+			}
+			if rest := op.Count - k; r.items[i].length > rest {
+				r.splitAt(i, rest)
+			}
+			it := &r.items[i]
+			if !it.deleted {
+				if err := c.SeekRune(r.visibleBefore(i)); err != nil {
+					return false, err
+				}
+				if _, _, err := c.DeleteRunes(it.length, false); err != nil {
+					return false, err
+				}
+				it.deleted = true
+			}
+			k += it.length
+		}
+
+	case CRDTDecorate:
+		if !op.Removed && !r.known(op.ID) {
+			return false, nil
+		}
+		if m := r.marks[op.Key]; m != nil && !op.Stamp.after(m.stamp) {
+			return true, nil // an equal or newer write is already in
+		}
+		r.applyMarkLocked(op)
+
+	default:
+		return true, nil
+	}
+	r.history = append(r.history, op)
+	return true, nil
+}
+
+// integrateInsert places a remote run (YATA) and returns its item index.
+func (r *CRDTReplica) integrateInsert(op CRDTOp) int {
+	left := -1
+	if op.OriginLeft != (CRDTID{}) {
+		i, off, _ := r.find(op.OriginLeft)
+		r.splitAt(i, off+1)
+		left = i
+	}
+	right := len(r.items)
+	if op.OriginRight != (CRDTID{}) {
+		i, off, _ := r.find(op.OriginRight)
+		r.splitAt(i, off)
+		if off > 0 {
+			i++
+		}
+		right = i
+	}
+
+	at := left // the new run goes after items[at]
+	before := make(map[int]bool)
+	conflicting := make(map[int]bool)
+	for o := left + 1; o < right; o++ {
+		other := r.items[o]
+		before[o] = true
+		conflicting[o] = true
+		if other.originLeft == op.OriginLeft {
+			if other.id.Site < op.ID.Site {
+				at = o
+				clear(conflicting)
+			} else if other.originRight == op.OriginRight {
+				break
+			}
+			continue
+		}
+		oi := -1
+		if other.originLeft != (CRDTID{}) {
+			oi, _, _ = r.find(other.originLeft)
+		}
+		if oi >= 0 && before[oi] {
+			if !conflicting[oi] {
+				at = o
+				clear(conflicting)
+			}
+			continue
+		}
+		break
+	}
+	r.insertItem(at+1, crdtItem{id: op.ID, length: op.Count, originLeft: op.OriginLeft, originRight: op.OriginRight})
+	return at + 1
+}
+
+// applyMarkLocked records a decoration write in the registry.
+func (r *CRDTReplica) applyMarkLocked(op CRDTOp) {
+	if op.Stamp.Clock > r.clock {
+		r.clock = op.Stamp.Clock
+	}
+	r.marks[op.Key] = &crdtMark{anchor: op.ID, removed: op.Removed, stamp: op.Stamp}
+}
+
+// reconcileMarksLocked moves (or removes) the Garland's decorations for
+// replica-managed keys to where their anchors resolve.
+func (r *CRDTReplica) reconcileMarksLocked() error {
+	var fix []DecorationEntry
+	for key, m := range r.marks {
+		cur, err := r.g.GetDecorationPosition(key)
+		exists := err == nil
+		if m.removed {
+			if exists {
+				fix = append(fix, DecorationEntry{Key: key})
+			}
+			continue
+		}
+		want := r.visibleLen()
+		if m.anchor != (CRDTID{}) {
+			i, off, _ := r.find(m.anchor)
+			want = r.visibleBefore(i)
+			if !r.items[i].deleted {
+				want += off
+			}
+		}
+		if exists {
+			if at, err := r.g.ByteToRune(cur.Byte); err == nil && at == want {
+				continue
+			}
+		}
+		fix = append(fix, DecorationEntry{Key: key, Address: &AbsoluteAddress{Mode: RuneMode, Rune: want}})
+	}
+	if len(fix) == 0 {
+		return nil
+	}
+	_, err := r.g.Decorate(fix)
+	return err
+}
+
+// syncedNowLocked marks the Garland's current version as matched by
+// the identity layer (after edits the replica made itself).
+func (r *CRDTReplica) syncedNowLocked() {
+	r.g.mu.RLock()
+	r.synced = ForkRevision{r.g.currentFork, r.g.currentRevision}
+	r.g.mu.RUnlock()
+}
+
+// find returns the item holding id and its offset in the run.
+func (r *CRDTReplica) find(id CRDTID) (int, int64, bool) {
+	for i, it := range r.items {
+		if it.id.Site == id.Site && id.Seq >= it.id.Seq && id.Seq < it.id.Seq+uint64(it.length) {
+			return i, int64(id.Seq - it.id.Seq), true
+		}
+	}
+	return -1, 0, false
+}
+
+// known reports whether id is integrated (the zero ID always is).
+func (r *CRDTReplica) known(id CRDTID) bool {
+	if id == (CRDTID{}) {
+		return true
+	}
+	_, _, ok := r.find(id)
+	return ok
+}
+
+// idAt returns the ID of rune off in item i.
+func (r *CRDTReplica) idAt(i int, off int64) CRDTID {
+	return CRDTID{Site: r.items[i].id.Site, Seq: r.items[i].id.Seq + uint64(off)}
+}
+
+// splitAt splits item i so that a new item starts at offset off
+// (a no-op at either end of the run).
+func (r *CRDTReplica) splitAt(i int, off int64) {
+	it := r.items[i]
+	if off <= 0 || off >= it.length {
+		return
+	}
+	tail := crdtItem{
+		id:          r.idAt(i, off),
+		length:      it.length - off,
+		originLeft:  r.idAt(i, off-1),
+		originRight: it.originRight,
+		deleted:     it.deleted,
+	}
+	r.items[i].length = off
+	r.insertItem(i+1, tail)
+}
+
+func (r *CRDTReplica) insertItem(at int, it crdtItem) {
+	r.items = append(r.items, crdtItem{})
+	copy(r.items[at+1:], r.items[at:])
+	r.items[at] = it
+}
+
+// locateVisible finds the item and offset of the visible rune at pos.
+func (r *CRDTReplica) locateVisible(pos int64) (int, int64, bool) {
+	for i, it := range r.items {
+		if it.deleted {
+			continue
+		}
+		if pos < it.length {
+			return i, pos, true
+		}
+		pos -= it.length
+	}
+	return len(r.items), 0, false
+}
+
+// visibleBefore counts the visible runes in items before index i.
+func (r *CRDTReplica) visibleBefore(i int) int64 {
+	n := int64(0)
+	for _, it := range r.items[:i] {
+		if !it.deleted {
+			n += it.length
+		}
+	}
+	return n
+}
+
+func (r *CRDTReplica) visibleLen() int64 {
+	return r.visibleBefore(len(r.items))
+}
@@ -0,0 +1,200 @@
+package garland
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func newReplicas(t *testing.T, text string, sites ...uint64) ([]*Garland, []*CRDTReplica) {
+	t.Helper()
+	lib, _ := Init(LibraryOptions{})
+	var gs []*Garland
+	var rs []*CRDTReplica
+	for _, site := range sites {
+		g, _ := lib.Open(FileOptions{DataString: text, MaxLeafSize: 8})
+		t.Cleanup(func() { g.Close() })
+		r, err := g.NewCRDTReplica(site)
+		if err != nil {
+			t.Fatalf("NewCRDTReplica: %v", err)
+		}
+		gs = append(gs, g)
+		rs = append(rs, r)
+	}
+	return gs, rs
+}
+
+// exchange delivers every replica's local operations to every other.
+func exchange(t *testing.T, rs []*CRDTReplica) {
+	t.Helper()
+	outs := make([][]CRDTOp, len(rs))
+	for i, r := range rs {
+		ops, err := r.TakeLocal()
+		if err != nil {
+			t.Fatalf("TakeLocal: %v", err)
+		}
+		outs[i] = ops
+	}
+	for i, r := range rs {
+		for j, ops := range outs {
+			if i != j {
+				if _, err := r.Merge(ops); err != nil {
+					t.Fatalf("Merge: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func TestCRDTConcurrentEditsConverge(t *testing.T) {
+	gs, rs := newReplicas(t, "hello world", 1, 2, 3)
+
+	// All three edit the same spot, and one deletes across it.
+	a := gs[0].NewCursor()
+	a.SeekRune(5)
+	a.InsertString(", dear", nil, true)
+	b := gs[1].NewCursor()
+	b.SeekRune(5)
+	b.InsertString(" there", nil, true)
+	c := gs[2].NewCursor()
+	c.SeekRune(3)
+	c.DeleteRunes(4, false)
+
+	exchange(t, rs)
+	want := readAllString(t, gs[0])
+	for i, g := range gs[1:] {
+		if got := readAllString(t, g); got != want {
+			t.Fatalf("replica %d = %q, replica 0 = %q", i+1, got, want)
+		}
+	}
+	if want != "hel, dear thereorld" {
+		t.Errorf("converged to %q", want)
+	}
+
+	// A second round on the merged state.
+	a.SeekRune(0)
+	a.InsertString(">", nil, true)
+	c2 := gs[2].NewCursor()
+	c2.SeekRune(gs[2].RuneCount().Value)
+	c2.InsertString("!", nil, true)
+	exchange(t, rs)
+	for _, g := range gs {
+		if got := readAllString(t, g); got != ">hel, dear thereorld!" {
+			t.Errorf("round two: %q", got)
+		}
+	}
+}
+
+func TestCRDTOutOfOrderDelivery(t *testing.T) {
+	gs, rs := newReplicas(t, "abc", 1, 2)
+
+	c := gs[0].NewCursor()
+	c.SeekRune(3)
+	c.InsertString("def", nil, true)
+	first, _ := rs[0].TakeLocal()
+	c.SeekRune(4)
+	c.DeleteRunes(1, false)
+	c.InsertString("X", nil, true)
+	second, _ := rs[0].TakeLocal()
+
+	if _, err := rs[1].Merge(second); err != nil {
+		t.Fatalf("Merge(second): %v", err)
+	}
+	if rs[1].Pending() == 0 {
+		t.Fatal("ops depending on unseen runs should wait")
+	}
+	if _, err := rs[1].Merge(append(first, first...)); err != nil {
+		t.Fatalf("Merge(first): %v", err)
+	}
+	if got, want := readAllString(t, gs[1]), readAllString(t, gs[0]); got != want || rs[1].Pending() != 0 {
+		t.Errorf("got %q, want %q (pending %d)", got, want, rs[1].Pending())
+	}
+}
+
+func TestCRDTDecorationsConverge(t *testing.T) {
+	gs, rs := newReplicas(t, "one two three", 1, 2)
+
+	if err := rs[0].Decorate("mark", 4); err != nil {
+		t.Fatalf("Decorate: %v", err)
+	}
+	exchange(t, rs)
+
+	// Replica 2 inserts right at the mark; replica 1 moves it later, concurrently.
+	c := gs[1].NewCursor()
+	c.SeekRune(4)
+	c.InsertString("big ", nil, true)
+	rs[0].Decorate("mark", 8)
+	exchange(t, rs)
+
+	for i, g := range gs {
+		addr, err := g.GetDecorationPosition("mark")
+		if err != nil {
+			t.Fatalf("replica %d: %v", i, err)
+		}
+		if r, _ := g.ByteToRune(addr.Byte); r != 12 {
+			t.Errorf("replica %d: mark at rune %d, want 12 (before \"three\")", i, r)
+		}
+	}
+
+	rs[1].RemoveDecoration("mark")
+	exchange(t, rs)
+	for i, g := range gs {
+		if _, err := g.GetDecorationPosition("mark"); err != ErrDecorationNotFound {
+			t.Errorf("replica %d: removed mark still present (%v)", i, err)
+		}
+	}
+}
+
+func TestCRDTRandomizedConvergence(t *testing.T) {
+	gs, rs := newReplicas(t, "the quick brown fox", 1, 2, 3)
+	rng := rand.New(rand.NewSource(7))
+	words := []string{"a", "bc", "déf", "\n", "ghij"}
+
+	var backlog [][]CRDTOp
+	for round := 0; round < 40; round++ {
+		for i, g := range gs {
+			c := g.NewEphemeralCursor()
+			n := g.RuneCount().Value
+			c.SeekRune(rng.Int63n(n + 1))
+			if rng.Intn(3) == 0 && n > 0 {
+				c.DeleteRunes(1+rng.Int63n(3), false)
+			} else {
+				c.InsertString(words[rng.Intn(len(words))], nil, true)
+			}
+			g.RemoveCursor(c)
+			ops, err := rs[i].TakeLocal()
+			if err != nil {
+				t.Fatalf("TakeLocal: %v", err)
+			}
+			backlog = append(backlog, ops)
+		}
+		// Deliver a random subset now, in random order; the rest later.
+		rng.Shuffle(len(backlog), func(a, b int) { backlog[a], backlog[b] = backlog[b], backlog[a] })
+		keep := backlog[:0]
+		for _, ops := range backlog {
+			if rng.Intn(2) == 0 {
+				keep = append(keep, ops)
+				continue
+			}
+			for _, r := range rs {
+				if _, err := r.Merge(ops); err != nil {
+					t.Fatalf("Merge: %v", err)
+				}
+			}
+		}
+		backlog = keep
+	}
+	for _, ops := range backlog {
+		for _, r := range rs {
+			r.Merge(ops)
+		}
+	}
+	want := readAllString(t, gs[0])
+	for i, g := range gs {
+		if got := readAllString(t, g); got != want {
+			t.Fatalf("replica %d diverged:\n%q\n%q", i, got, want)
+		}
+		if rs[i].Pending() != 0 {
+			t.Errorf("replica %d has %d ops pending", i, rs[i].Pending())
+		}
+	}
+}
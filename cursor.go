@@ -1,7 +1,9 @@
 package garland
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,12 +13,22 @@ type CursorPosition struct {
 	RunePos  int64
 	Line     int64
 	LineRune int64
+
+	// Selection anchor recorded with the position, so undo and
+	// rollback bring a selection back along with the cursor.
+	anchor    int64
+	hasAnchor bool
 }
 
 // Cursor represents a position within a Garland with its own ready state.
 // Cursors automatically update when content changes before their position.
 type Cursor struct {
+	// garland is set at creation and never changes - not even on
+	// removal, so a method that read it just before a concurrent
+	// RemoveCursor still holds a valid pointer. removed marks the
+	// cursor as unregistered (see RemoveCursor).
 	garland *Garland
+	removed atomic.Bool
 
 	// Current position. bytePos, runePos, and line are always kept in
 	// sync (they shift linearly under mutations elsewhere in the
@@ -48,6 +60,9 @@ type Cursor struct {
 	// to a historical position on a seek.
 	tracksHistory bool
 
+	// Leaf of the last placement; see leaf_hint.go.
+	hint leafHint
+
 	// Ready state
 	ready     bool
 	readyMu   sync.Mutex
@@ -58,6 +73,40 @@ type Cursor struct {
 
 	// Active optimized region (nil if none)
 	region *OptimizedRegionHandle
+
+	// Selection anchor (nil if none); see cursor_selection.go.
+	anchor *ephemeralMark
+
+	// Goal column of vertical motion; see cursor_column.go.
+	goal columnGoal
+
+	// Virtual space (see cursor_virtual.go): when enabled, virtualCol
+	// columns past the end of the line the cursor sits at.
+	virtualSpace bool
+	virtualCol   int64
+
+	// Frontend label and metadata; see cursor_label.go.
+	name     string
+	metadata map[string]interface{}
+
+	// Out-of-range seek handling; see cursor_seek_policy.go.
+	seekPolicy SeekPolicy
+
+	// Range the cursor is confined to (nil if none); see
+	// cursor_restrict.go.
+	restrict *restriction
+
+	// Whether the cursor follows a streaming load; see cursor_pin.go.
+	pin PinMode
+
+	// Read-only and unregistered; see cursor_ghost.go. Set at creation.
+	ghost bool
+}
+
+// detached reports whether the cursor no longer belongs to a garland
+// (RemoveCursor); its methods then fail with ErrCursorNotFound.
+func (c *Cursor) detached() bool {
+	return c.garland == nil || c.removed.Load()
 }
 
 // newCursor creates a new cursor at position 0.
@@ -114,6 +163,9 @@ func (c *Cursor) SetTracksHistory(track bool) {
 	}
 	c.garland.mu.Lock()
 	defer c.garland.mu.Unlock()
+	if c.ghost {
+		return // ghosts are never recorded
+	}
 	c.tracksHistory = track
 	if !track {
 		c.positionHistory = make(map[ForkRevision]*CursorPosition)
@@ -148,11 +200,23 @@ func (c *Cursor) posRune() int64 {
 	if c.garland == nil {
 		return c.runePos
 	}
+	c.garland.ensureCounts()
 	c.garland.mu.RLock()
 	defer c.garland.mu.RUnlock()
 	return c.runePos
 }
 
+// posLine reads the line number under the read lock.
+func (c *Cursor) posLine() int64 {
+	if c.garland == nil {
+		return c.line
+	}
+	c.garland.ensureCounts()
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	return c.line
+}
+
 // LinePos returns the cursor's line number and rune position within that line.
 // Both values are 0-indexed.
 func (c *Cursor) LinePos() (line, runeInLine int64) {
@@ -161,6 +225,7 @@ func (c *Cursor) LinePos() (line, runeInLine int64) {
 	}
 	c.garland.mu.Lock() // may lazily recompute the stale column
 	defer c.garland.mu.Unlock()
+	c.garland.ensureCountsLocked()
 	c.resolveStaleLineRuneLocked()
 	return c.line, c.lineRune
 }
@@ -172,6 +237,7 @@ func (c *Cursor) Position() CursorPosition {
 	}
 	c.garland.mu.Lock() // may lazily recompute the stale column
 	defer c.garland.mu.Unlock()
+	c.garland.ensureCountsLocked()
 	c.resolveStaleLineRuneLocked()
 	return CursorPosition{
 		BytePos:  c.bytePos,
@@ -213,12 +279,23 @@ func (c *Cursor) setReady(ready bool) {
 
 // Mode returns the cursor's current mode.
 func (c *Cursor) Mode() CursorMode {
+	if c.garland == nil {
+		return c.mode
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
 	return c.mode
 }
 
 // SetMode sets the cursor's mode.
 // Changing mode does not affect any currently active optimized region.
 func (c *Cursor) SetMode(mode CursorMode) {
+	if c.garland == nil {
+		c.mode = mode
+		return
+	}
+	c.garland.mu.Lock()
+	defer c.garland.mu.Unlock()
 	c.mode = mode
 }
 
@@ -265,7 +342,7 @@ func (c *Cursor) OptimizedRegionGraceWindow() (start, end int64, ok bool) {
 // or removed, this returns ErrNotSupported. (RULING 2026-07-12: keep
 // the scaffolding, block the entry point.)
 func (c *Cursor) BeginOptimizedRegion(startByte, endByte int64) error {
-	if c.garland == nil {
+	if c.detached() {
 		return ErrCursorNotFound
 	}
 	return ErrNotSupported
@@ -283,12 +360,12 @@ func (c *Cursor) SeekByte(pos int64) error {
 // If timeout is negative, blocks indefinitely.
 // If timeout is positive, waits up to that duration before returning ErrTimeout.
 func (c *Cursor) SeekByteWithTimeout(pos int64, timeout time.Duration) error {
-	if c.garland == nil {
+	if c.detached() {
 		return ErrCursorNotFound
 	}
 
 	// Wait for position to be available
-	if err := c.garland.waitForBytePosition(pos, timeout); err != nil {
+	if err := c.seekWait(c.garland.waitForBytePosition(context.Background(), pos, timeout)); err != nil {
 		return err
 	}
 
@@ -308,12 +385,12 @@ func (c *Cursor) SeekRune(pos int64) error {
 // If timeout is negative, blocks indefinitely.
 // If timeout is positive, waits up to that duration before returning ErrTimeout.
 func (c *Cursor) SeekRuneWithTimeout(pos int64, timeout time.Duration) error {
-	if c.garland == nil {
+	if c.detached() {
 		return ErrCursorNotFound
 	}
 
 	// Wait for position to be available
-	if err := c.garland.waitForRunePosition(pos, timeout); err != nil {
+	if err := c.seekWait(c.garland.waitForRunePosition(context.Background(), pos, timeout)); err != nil {
 		return err
 	}
 
@@ -334,12 +411,12 @@ func (c *Cursor) SeekLine(line, runeInLine int64) error {
 // If timeout is negative, blocks indefinitely.
 // If timeout is positive, waits up to that duration before returning ErrTimeout.
 func (c *Cursor) SeekLineWithTimeout(line, runeInLine int64, timeout time.Duration) error {
-	if c.garland == nil {
+	if c.detached() {
 		return ErrCursorNotFound
 	}
 
 	// Wait for line to be available
-	if err := c.garland.waitForLine(line, timeout); err != nil {
+	if err := c.seekWait(c.garland.waitForLine(context.Background(), line, timeout)); err != nil {
 		return err
 	}
 
@@ -351,7 +428,7 @@ func (c *Cursor) SeekLineWithTimeout(line, runeInLine int64, timeout time.Durati
 // Positive delta moves forward, negative moves backward.
 // Clamps to valid range [0, byteCount].
 func (c *Cursor) SeekRelativeBytes(delta int64) error {
-	if c.garland == nil {
+	if c.detached() {
 		return ErrCursorNotFound
 	}
 
@@ -367,7 +444,7 @@ func (c *Cursor) SeekRelativeBytes(delta int64) error {
 // Positive delta moves forward, negative moves backward.
 // Clamps to valid range [0, runeCount].
 func (c *Cursor) SeekRelativeRunes(delta int64) error {
-	if c.garland == nil {
+	if c.detached() {
 		return ErrCursorNotFound
 	}
 
@@ -406,7 +483,7 @@ func (c *Cursor) SeekByWord(n int) (int, error) {
 // WordStyle. Positive n moves forward, negative n moves backward.
 // Returns the number of words actually moved.
 func (c *Cursor) SeekByWordStyle(n int, style WordStyle) (int, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return 0, ErrCursorNotFound
 	}
 	return c.garland.seekByWordAt(c, n, style)
@@ -414,17 +491,17 @@ func (c *Cursor) SeekByWordStyle(n int, style WordStyle) (int, error) {
 
 // SeekLineStart moves the cursor to the beginning of the current line.
 func (c *Cursor) SeekLineStart() error {
-	if c.garland == nil {
+	if c.detached() {
 		return ErrCursorNotFound
 	}
 	// Simply set lineRune to 0 and recalculate byte/rune positions
-	return c.SeekLine(c.line, 0)
+	return c.SeekLine(c.posLine(), 0)
 }
 
 // SeekLineEnd moves the cursor to the end of the current line.
 // The cursor is positioned after the last character before the newline (or at EOF).
 func (c *Cursor) SeekLineEnd() error {
-	if c.garland == nil {
+	if c.detached() {
 		return ErrCursorNotFound
 	}
 	return c.garland.seekLineEndAt(c)
@@ -432,11 +509,14 @@ func (c *Cursor) SeekLineEnd() error {
 
 // updatePosition updates the cursor's position and records history if needed.
 func (c *Cursor) updatePosition(bytePos, runePos, line, lineRune int64) {
+	bytePos, runePos, line, lineRune = c.confineLocked(bytePos, runePos, line, lineRune)
 	c.bytePos = bytePos
 	c.runePos = runePos
 	c.line = line
 	c.lineRune = lineRune
 	c.lineRuneDirty = false
+	c.goal = columnGoal{} // SeekLineDelta sets it again after moving
+	c.virtualCol = 0
 
 	// Record position in history if version has changed. NEVER while a
 	// transaction holds uncommitted mutations: currentRevision is still
@@ -452,12 +532,12 @@ func (c *Cursor) updatePosition(bytePos, runePos, line, lineRune int64) {
 
 		if !inMutatedTx && (c.lastFork != currentFork || c.lastRevision != currentRev) {
 			if c.tracksHistory {
-				c.positionHistory[ForkRevision{currentFork, currentRev}] = &CursorPosition{
+				c.positionHistory[ForkRevision{currentFork, currentRev}] = c.withAnchor(&CursorPosition{
 					BytePos:  bytePos,
 					RunePos:  runePos,
 					Line:     line,
 					LineRune: lineRune,
-				}
+				})
 			}
 			c.lastFork = currentFork
 			c.lastRevision = currentRev
@@ -515,6 +595,8 @@ func (c *Cursor) restorePosition(pos *CursorPosition) {
 		c.line = pos.Line
 		c.lineRune = pos.LineRune
 		c.lineRuneDirty = false
+		c.virtualCol = 0
+		c.restoreAnchor(pos)
 	}
 }
 
@@ -522,12 +604,12 @@ func (c *Cursor) restorePosition(pos *CursorPosition) {
 // Callers hold the garland lock (transaction start).
 func (c *Cursor) snapshotPosition() *CursorPosition {
 	c.resolveStaleLineRuneLocked()
-	return &CursorPosition{
+	return c.withAnchor(&CursorPosition{
 		BytePos:  c.bytePos,
 		RunePos:  c.runePos,
 		Line:     c.line,
 		LineRune: c.lineRune,
-	}
+	})
 }
 
 // InsertBytes inserts raw bytes at the cursor position.
@@ -535,12 +617,16 @@ func (c *Cursor) snapshotPosition() *CursorPosition {
 // cursors/decorations at this position; otherwise after.
 // After insertion, cursor advances to the end of the inserted content.
 func (c *Cursor) InsertBytes(data []byte, decorations []RelativeDecoration, insertBefore bool) (ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return ChangeResult{}, ErrCursorNotFound
 	}
 	if err := validateRelativeDecorations(decorations); err != nil {
 		return ChangeResult{}, err
 	}
+	pad, decorations := c.virtualPad(decorations)
+	if pad != "" {
+		data = append([]byte(pad), data...)
+	}
 	result, err := c.garland.insertBytesAt(c, c.posByte(), data, decorations, insertBefore)
 	if err != nil {
 		return result, err
@@ -556,12 +642,14 @@ func (c *Cursor) InsertBytes(data []byte, decorations []RelativeDecoration, inse
 // cursors/decorations at this position; otherwise after.
 // After insertion, cursor advances to the end of the inserted content.
 func (c *Cursor) InsertString(data string, decorations []RelativeDecoration, insertBefore bool) (ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return ChangeResult{}, ErrCursorNotFound
 	}
 	if err := validateRelativeDecorations(decorations); err != nil {
 		return ChangeResult{}, err
 	}
+	pad, decorations := c.virtualPad(decorations)
+	data = pad + data
 	result, err := c.garland.insertStringAt(c, c.posByte(), data, decorations, insertBefore)
 	if err != nil {
 		return result, err
@@ -576,7 +664,7 @@ func (c *Cursor) InsertString(data string, decorations []RelativeDecoration, ins
 // If includeLineDecorations is true, also returns (but does not move)
 // decorations from partially affected lines.
 func (c *Cursor) DeleteBytes(length int64, includeLineDecorations bool) ([]RelativeDecoration, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ChangeResult{}, ErrCursorNotFound
 	}
 	return c.garland.deleteBytesAt(c, c.posByte(), length, includeLineDecorations)
@@ -589,7 +677,7 @@ func (c *Cursor) DeleteBytes(length int64, includeLineDecorations bool) ([]Relat
 // Returns decorations that were in the overwritten range.
 // Cursor position is not changed after the operation.
 func (c *Cursor) OverwriteBytes(length int64, newData []byte) ([]RelativeDecoration, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ChangeResult{}, ErrCursorNotFound
 	}
 	return c.garland.overwriteBytesAt(c, c.posByte(), length, newData)
@@ -600,7 +688,7 @@ func (c *Cursor) OverwriteBytes(length int64, newData []byte) ([]RelativeDecorat
 // - insertBefore: if true, displaced decorations consolidate to end; if false, to start
 // Returns the original decorations from the overwritten range with their original relative positions.
 func (c *Cursor) OverwriteBytesWithDecorations(length int64, newData []byte, decorationsToAdd []RelativeDecoration, insertBefore bool) ([]RelativeDecoration, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ChangeResult{}, ErrCursorNotFound
 	}
 	if err := validateRelativeDecorations(decorationsToAdd); err != nil {
@@ -623,7 +711,7 @@ func (c *Cursor) OverwriteBytesWithDecorations(length int64, newData []byte, dec
 // - insertBefore: if true, displaced decorations consolidate to end of new content
 // Returns MoveResult with the displaced decorations from the destination range.
 func (c *Cursor) MoveBytes(srcStart, srcEnd, dstStart, dstEnd int64, insertBefore bool) (MoveResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return MoveResult{}, ErrCursorNotFound
 	}
 	return c.garland.moveBytesAt(c, srcStart, srcEnd, dstStart, dstEnd, insertBefore)
@@ -640,7 +728,7 @@ func (c *Cursor) MoveBytes(srcStart, srcEnd, dstStart, dstEnd int64, insertBefor
 // - insertBefore: if true, displaced decorations consolidate to end of new content
 // Returns CopyResult with the displaced decorations from the destination range.
 func (c *Cursor) CopyBytes(srcStart, srcEnd, dstStart, dstEnd int64, decorationsToAdd []RelativeDecoration, insertBefore bool) (CopyResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return CopyResult{}, ErrCursorNotFound
 	}
 	if err := validateRelativeDecorations(decorationsToAdd); err != nil {
@@ -654,7 +742,7 @@ func (c *Cursor) CopyBytes(srcStart, srcEnd, dstStart, dstEnd int64, decorations
 // If includeLineDecorations is true, also returns (but does not move)
 // decorations from partially affected lines.
 func (c *Cursor) DeleteRunes(length int64, includeLineDecorations bool) ([]RelativeDecoration, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ChangeResult{}, ErrCursorNotFound
 	}
 	return c.garland.deleteRunesAt(c, c.posRune(), length, includeLineDecorations)
@@ -662,7 +750,7 @@ func (c *Cursor) DeleteRunes(length int64, includeLineDecorations bool) ([]Relat
 
 // TruncateToEOF deletes everything from cursor position to end of file.
 func (c *Cursor) TruncateToEOF() (ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return ChangeResult{}, ErrCursorNotFound
 	}
 	return c.garland.truncateAt(c, c.posByte())
@@ -671,10 +759,10 @@ func (c *Cursor) TruncateToEOF() (ChangeResult, error) {
 // ReadBytes reads `length` bytes starting at cursor position.
 // After reading, cursor advances past the read data.
 func (c *Cursor) ReadBytes(length int64) ([]byte, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ErrCursorNotFound
 	}
-	data, err := c.garland.readBytesAt(c.posByte(), length)
+	data, err := c.garland.readBytesFrom(c, c.posByte(), length)
 	if err != nil {
 		return nil, err
 	}
@@ -686,7 +774,7 @@ func (c *Cursor) ReadBytes(length int64) ([]byte, error) {
 // ReadString reads `length` runes starting at cursor position as a string.
 // After reading, cursor advances past the read data.
 func (c *Cursor) ReadString(length int64) (string, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return "", ErrCursorNotFound
 	}
 	data, err := c.garland.readStringAt(c.posRune(), length)
@@ -701,17 +789,17 @@ func (c *Cursor) ReadString(length int64) (string, error) {
 // ReadLine reads the entire line the cursor is on.
 // Note: Does NOT advance cursor (line-oriented reading is typically peek-like).
 func (c *Cursor) ReadLine() (string, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return "", ErrCursorNotFound
 	}
-	return c.garland.readLineAt(c.line)
+	return c.garland.readLineAt(c.posLine())
 }
 
 // BackDeleteBytes deletes `length` bytes BEFORE the cursor position.
 // Cursor moves to the start of the deleted range (its new position).
 // Returns decorations from the deleted range.
 func (c *Cursor) BackDeleteBytes(length int64, includeLineDecorations bool) ([]RelativeDecoration, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ChangeResult{}, ErrCursorNotFound
 	}
 	if length <= 0 {
@@ -733,7 +821,7 @@ func (c *Cursor) BackDeleteBytes(length int64, includeLineDecorations bool) ([]R
 // Cursor moves to the start of the deleted range (its new position).
 // Returns decorations from the deleted range.
 func (c *Cursor) BackDeleteRunes(length int64, includeLineDecorations bool) ([]RelativeDecoration, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ChangeResult{}, ErrCursorNotFound
 	}
 	if length <= 0 {
@@ -0,0 +1,151 @@
+package garland
+
+import "unicode/utf8"
+
+// cursor_column.go - vertical motion with a sticky goal column.
+//
+// DESIGN: arrow-key up/down moves to the same column on another line,
+// but a shorter line in between must not lose that column: going down
+// from column 30 through a 5-rune line and on to a long one lands on
+// column 30 again. The column the user is aiming for (the goal) is
+// therefore state that outlives any one position, and it lives on the
+// cursor.
+//
+//   - The first SeekLineDelta takes the goal from the cursor's current
+//     column; following ones keep it. Any other move of the cursor
+//     (a seek, or an edit through it) drops the goal, so the next
+//     vertical move starts from wherever the cursor is then. Edits by
+//     others that merely shift the cursor keep it.
+//   - On a line shorter than the goal the cursor sits at the line's end
+//     (before its newline).
+//   - Columns are runes (SeekLineDelta) or display columns with tab
+//     stops and wide runes (SeekLineDeltaVisual, see visual.go);
+//     switching kind, or tab width, starts a new goal.
+//   - The move is clamped to the document's first and last line; the
+//     number of lines actually moved is returned.
+//   - A cursor in virtual-space mode (cursor_virtual.go) lands on the
+//     goal column itself, in virtual space when the line is shorter.
+
+// columnGoal is a cursor's remembered column for vertical motion.
+type columnGoal struct {
+	col int64
+	tab int64 // 0: rune column; otherwise the tab width of a display column
+	ok  bool
+}
+
+// readThawingLocked reads [pos, pos+length), thawing cold leaves when
+// the range is not resident. Caller must hold the write lock.
+func (g *Garland) readThawingLocked(pos, length int64) ([]byte, error) {
+	data, err := g.readBytesRangeInternal(pos, length)
+	if err == ErrDataNotLoaded {
+		if err = g.thawRangeUnlocked(pos, pos+length); err == nil {
+			data, err = g.readBytesRangeInternal(pos, length)
+		}
+	}
+	return data, err
+}
+
+// lineTextLocked returns the start of line and its bytes without the
+// newline, thawing cold leaves as needed. Caller must hold the write
+// lock.
+func (g *Garland) lineTextLocked(line int64) (int64, []byte, error) {
+	res, err := g.findLeafByLineUnlocked(line, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	start := res.LineByteStart
+	end := g.findLineEndUnlocked(start)
+	data, err := g.readThawingLocked(start, end-start)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		data = data[:n-1]
+	}
+	return start, data, nil
+}
+
+// SeekLineDelta moves the cursor n lines down (negative: up), keeping
+// the rune column it started from across shorter lines. Returns the
+// number of lines actually moved.
+func (c *Cursor) SeekLineDelta(n int64) (int64, error) {
+	return c.seekLineDelta(n, 0)
+}
+
+// SeekLineDeltaVisual is SeekLineDelta for display columns, where a
+// tab advances to the next multiple of tabWidth (tabWidth below 2
+// counts a tab as one column) and a wide rune takes two.
+func (c *Cursor) SeekLineDeltaVisual(n, tabWidth int64) (int64, error) {
+	if tabWidth < 1 {
+		tabWidth = 1
+	}
+	return c.seekLineDelta(n, tabWidth)
+}
+
+// seekLineDelta moves n lines with a goal column of kind tab (see
+// columnGoal).
+func (c *Cursor) seekLineDelta(n, tab int64) (int64, error) {
+	if c.detached() {
+		return 0, ErrCursorNotFound
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+
+	c.resolveStaleLineRuneLocked()
+	goal := c.goal
+	if !goal.ok || goal.tab != tab {
+		goal = columnGoal{col: c.lineRune, tab: tab, ok: true}
+		if tab > 0 {
+			start, text, err := g.lineTextLocked(c.line)
+			if err != nil {
+				return 0, err
+			}
+			goal.col = visualWidth(text[:c.bytePos-start], tab)
+		}
+		goal.col += c.virtualCol
+	}
+
+	target := c.line + n
+	if target < 0 {
+		target = 0
+	}
+	if target > g.totalLines {
+		target = g.totalLines
+	}
+	start, text, err := g.lineTextLocked(target)
+	if err != nil {
+		return 0, err
+	}
+
+	// Walk the target line up to the goal column.
+	var col, runes int64
+	offset := 0
+	for offset < len(text) {
+		r, size := utf8.DecodeRune(text[offset:])
+		next := col + 1
+		if tab > 0 {
+			next = visualAdvance(col, r, tab)
+		}
+		if next > goal.col {
+			break
+		}
+		col = next
+		runes++
+		offset += size
+	}
+
+	pos := start + int64(offset)
+	runePos, err := g.byteToRuneInternalUnlocked(pos)
+	if err != nil {
+		return 0, err
+	}
+	moved := target - c.line
+	c.updatePosition(pos, runePos, target, runes)
+	c.goal = goal
+	if c.virtualSpace && offset == len(text) {
+		c.virtualCol = goal.col - col
+	}
+	return moved, nil
+}
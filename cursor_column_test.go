@@ -0,0 +1,66 @@
+package garland
+
+import "testing"
+
+func TestSeekLineDeltaKeepsGoalColumn(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "a long first line\nab\n\nanother long line\nxyz"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekLine(0, 9)
+	want := []struct{ line, col int64 }{{1, 2}, {2, 0}, {3, 9}, {4, 3}}
+	for _, w := range want {
+		if moved, err := c.SeekLineDelta(1); err != nil || moved != 1 {
+			t.Fatalf("moved %d, err %v", moved, err)
+		}
+		if line, col := c.LinePos(); line != w.line || col != w.col {
+			t.Errorf("at %d:%d, want %d:%d", line, col, w.line, w.col)
+		}
+	}
+	if moved, _ := c.SeekLineDelta(5); moved != 0 {
+		t.Errorf("past the last line moved %d", moved)
+	}
+	if moved, _ := c.SeekLineDelta(-10); moved != -4 {
+		t.Errorf("clamped up move %d, want -4", moved)
+	}
+	if line, col := c.LinePos(); line != 0 || col != 9 {
+		t.Errorf("back at %d:%d, want 0:9", line, col)
+	}
+
+	// Any other move drops the goal.
+	c.SeekLine(3, 12)
+	c.SeekLineDelta(-2)
+	c.SeekLineDelta(-1)
+	if line, col := c.LinePos(); line != 0 || col != 12 {
+		t.Errorf("new goal: at %d:%d, want 0:12", line, col)
+	}
+	c.SeekLineDelta(1)
+	c.SeekRelativeRunes(-1)
+	c.SeekLineDelta(-1)
+	if line, col := c.LinePos(); line != 0 || col != 1 {
+		t.Errorf("after seek: at %d:%d, want 0:1", line, col)
+	}
+}
+
+func TestSeekLineDeltaVisualTabs(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "\tx = 1\nabcdefghijk\n\t\tdeep\nnaïve text"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekLine(0, 1) // on 'x', display column 4
+	c.SeekLineDeltaVisual(1, 4)
+	if line, col := c.LinePos(); line != 1 || col != 4 {
+		t.Errorf("at %d:%d, want 1:4", line, col)
+	}
+	// Column 4 is where the second tab starts: stop before it.
+	c.SeekLineDeltaVisual(1, 4)
+	if line, col := c.LinePos(); line != 2 || col != 1 {
+		t.Errorf("at %d:%d, want 2:1", line, col)
+	}
+	c.SeekLineDeltaVisual(1, 4)
+	if line, col := c.LinePos(); line != 3 || col != 4 || c.BytePos() != 31 {
+		t.Errorf("at %d:%d byte %d, want 3:4 byte 31", line, col, c.BytePos())
+	}
+}
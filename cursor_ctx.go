@@ -0,0 +1,105 @@
+package garland
+
+import "context"
+
+// cursor_ctx.go - context-aware blocking cursor operations.
+//
+// DESIGN: during a streaming load, SeekByte and friends block on
+// streamCond until the position arrives. The *WithTimeout variants
+// bound that with a duration; these *Ctx variants bound it with a
+// context instead, so a request handler or UI task can cancel a wait
+// when the user navigates away, and a deadline on the context works
+// as a timeout. Both are the same wait loop (waitForCount): a done
+// context wakes the waiters exactly like an expired timer, and the
+// wait returns ctx.Err().
+//
+// The Read*Ctx variants wait for the END of what they read - the whole
+// range, or the whole line - so they never return a short read just
+// because the loader has not caught up. Reaching EOF is not an error:
+// the read is clamped to the content, as the plain Read* calls do.
+
+// SeekByteCtx moves the cursor to an absolute byte position, waiting
+// during lazy loading until the position is available or ctx is done.
+func (c *Cursor) SeekByteCtx(ctx context.Context, pos int64) error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	if err := c.seekWait(c.garland.waitForBytePosition(ctx, pos, -1)); err != nil {
+		return err
+	}
+	return c.garland.setCursorFromByte(c, pos)
+}
+
+// SeekRuneCtx moves the cursor to an absolute rune position, waiting
+// during lazy loading until the position is available or ctx is done.
+func (c *Cursor) SeekRuneCtx(ctx context.Context, pos int64) error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	if err := c.seekWait(c.garland.waitForRunePosition(ctx, pos, -1)); err != nil {
+		return err
+	}
+	return c.garland.setCursorFromRune(c, pos)
+}
+
+// SeekLineCtx moves the cursor to a line and rune-within-line position,
+// waiting during lazy loading until the line is available or ctx is
+// done.
+func (c *Cursor) SeekLineCtx(ctx context.Context, line, runeInLine int64) error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	if err := c.seekWait(c.garland.waitForLine(ctx, line, -1)); err != nil {
+		return err
+	}
+	return c.garland.setCursorFromLine(c, line, runeInLine)
+}
+
+// ReadBytesCtx reads length bytes at the cursor, first waiting until
+// all of them are loaded (or loading completes) or ctx is done. The
+// cursor advances past the data, as with ReadBytes.
+func (c *Cursor) ReadBytesCtx(ctx context.Context, length int64) ([]byte, error) {
+	if c.detached() {
+		return nil, ErrCursorNotFound
+	}
+	if err := eofIsFine(c.garland.waitForBytePosition(ctx, c.posByte()+length, -1)); err != nil {
+		return nil, err
+	}
+	return c.ReadBytes(length)
+}
+
+// ReadStringCtx reads length runes at the cursor, first waiting until
+// all of them are loaded (or loading completes) or ctx is done. The
+// cursor advances past the data, as with ReadString.
+func (c *Cursor) ReadStringCtx(ctx context.Context, length int64) (string, error) {
+	if c.detached() {
+		return "", ErrCursorNotFound
+	}
+	if err := eofIsFine(c.garland.waitForRunePosition(ctx, c.posRune()+length, -1)); err != nil {
+		return "", err
+	}
+	return c.ReadString(length)
+}
+
+// ReadLineCtx reads the cursor's line, first waiting until the whole
+// line is loaded (its newline has arrived, or loading completes) or
+// ctx is done. Like ReadLine, it does not move the cursor.
+func (c *Cursor) ReadLineCtx(ctx context.Context) (string, error) {
+	if c.detached() {
+		return "", ErrCursorNotFound
+	}
+	line, _ := c.LinePos()
+	if err := eofIsFine(c.garland.waitForLine(ctx, line+1, -1)); err != nil {
+		return "", err
+	}
+	return c.ReadLine()
+}
+
+// eofIsFine maps the "past the end of a fully loaded document" result
+// of a wait to success: the read that follows is clamped.
+func eofIsFine(err error) error {
+	if err == ErrInvalidPosition {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+package garland
+
+import "unicode/utf8"
+
+// cursor_delimiter.go - bracket and delimiter matching.
+//
+// DESIGN: paren highlighting asks "where is the partner of the bracket
+// under the caret" after nearly every keystroke, and a % motion jumps
+// there. The answer is a nesting-aware scan from the bracket outwards,
+// usually only a few lines long, so the scan reads the document in
+// fixed chunks from the bracket rather than materializing any text.
+//
+//   - The delimiter is the rune at the cursor, or failing that the rune
+//     just before it (the caret right after a closing bracket).
+//   - Nesting counts only the delimiter's own pair, as vi's % does: in
+//     "( [ )" the '(' matches the ')'. Pairs with the same opening and
+//     closing rune (quotes) have no direction and are not matched.
+//   - Chunks overlap by utf8.UTFMax bytes so a rune split across chunk
+//     (or leaf) boundaries still decodes; cold leaves are thawed.
+//   - DelimiterOptions.Limit bounds the bytes scanned from the
+//     delimiter, so a missing partner in a huge file costs at most that.
+
+// delimiterChunk is how many bytes a delimiter scan reads at a time.
+const delimiterChunk = 4096
+
+// DelimiterPair is an opening and closing delimiter.
+type DelimiterPair struct {
+	Open, Close rune
+}
+
+// DelimiterOptions configures MatchDelimiterWith.
+type DelimiterOptions struct {
+	Pairs []DelimiterPair // nil: (), [] and {}
+	Limit int64           // max bytes scanned from the delimiter; 0: no limit
+}
+
+// defaultDelimiterPairs are the pairs matched when none are given.
+var defaultDelimiterPairs = []DelimiterPair{{'(', ')'}, {'[', ']'}, {'{', '}'}}
+
+// MatchDelimiter finds the partner of the bracket at (or just before)
+// the cursor among (), [] and {}. It returns the byte positions of the
+// bracket and of its partner; the cursor does not move. Returns
+// ErrNoDelimiter when neither rune is a bracket and
+// ErrUnmatchedDelimiter when the partner is missing.
+func (c *Cursor) MatchDelimiter() (at, match int64, err error) {
+	return c.MatchDelimiterWith(DelimiterOptions{})
+}
+
+// MatchDelimiterWith is MatchDelimiter with configurable pairs and a
+// scan limit (see DelimiterOptions).
+func (c *Cursor) MatchDelimiterWith(opts DelimiterOptions) (at, match int64, err error) {
+	if c.detached() {
+		return 0, 0, ErrCursorNotFound
+	}
+	pairs := opts.Pairs
+	if pairs == nil {
+		pairs = defaultDelimiterPairs
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Find the delimiter: at the cursor, else just before it.
+	var pair DelimiterPair
+	var forward, found bool
+	r, size, err := g.runeAtLocked(c.bytePos)
+	if err != nil {
+		return 0, 0, err
+	}
+	if size > 0 {
+		pair, forward, found = delimiterRole(pairs, r)
+		at = c.bytePos
+	}
+	if !found {
+		if r, size, err = g.runeBeforeLocked(c.bytePos); err != nil {
+			return 0, 0, err
+		}
+		if size > 0 {
+			pair, forward, found = delimiterRole(pairs, r)
+			at = c.bytePos - int64(size)
+		}
+	}
+	if !found {
+		return 0, 0, ErrNoDelimiter
+	}
+
+	// Scan outwards, counting nesting of this pair only.
+	depth := 0
+	limit := int64(-1)
+	if opts.Limit > 0 {
+		limit = opts.Limit
+	}
+	visit := func(pos int64, r rune) bool {
+		switch r {
+		case pair.Open:
+			if forward {
+				depth++
+			} else {
+				depth--
+			}
+		case pair.Close:
+			if forward {
+				depth--
+			} else {
+				depth++
+			}
+		}
+		if depth == 0 {
+			match = pos
+			return true
+		}
+		return false
+	}
+	var done bool
+	if forward {
+		done, err = g.scanRunesForwardLocked(at, limit, visit)
+	} else {
+		done, err = g.scanRunesBackwardLocked(at+int64(size), limit, visit)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if !done {
+		return 0, 0, ErrUnmatchedDelimiter
+	}
+	return at, match, nil
+}
+
+// delimiterRole reports the pair r belongs to and whether it opens.
+func delimiterRole(pairs []DelimiterPair, r rune) (DelimiterPair, bool, bool) {
+	for _, p := range pairs {
+		if p.Open == p.Close {
+			continue
+		}
+		if r == p.Open {
+			return p, true, true
+		}
+		if r == p.Close {
+			return p, false, true
+		}
+	}
+	return DelimiterPair{}, false, false
+}
+
+// scanRunesForwardLocked calls visit for each rune from pos onwards
+// until it returns true (reported as done) or limit bytes (-1: no
+// limit) have been scanned. Caller must hold the write lock.
+func (g *Garland) scanRunesForwardLocked(pos, limit int64, visit func(pos int64, r rune) bool) (bool, error) {
+	end := g.totalBytes
+	if limit >= 0 && pos+limit < end {
+		end = pos + limit
+	}
+	for pos < end {
+		n := min(delimiterChunk+utf8.UTFMax, g.totalBytes-pos)
+		data, err := g.readThawingLocked(pos, n)
+		if err != nil {
+			return false, err
+		}
+		// Runes starting in the first delimiterChunk bytes are decoded
+		// here; the overlap only completes a rune split at the edge.
+		i := 0
+		for i < len(data) && (i < delimiterChunk || int64(len(data)) == g.totalBytes-pos) && pos+int64(i) < end {
+			r, size := utf8.DecodeRune(data[i:])
+			if visit(pos+int64(i), r) {
+				return true, nil
+			}
+			i += size
+		}
+		pos += int64(i)
+	}
+	return false, nil
+}
+
+// scanRunesBackwardLocked calls visit for each rune ending at or
+// before pos, nearest first, until it returns true or limit bytes (-1:
+// no limit) have been scanned. Caller must hold the write lock.
+func (g *Garland) scanRunesBackwardLocked(pos, limit int64, visit func(pos int64, r rune) bool) (bool, error) {
+	var stop int64
+	if limit >= 0 && pos-limit > 0 {
+		stop = pos - limit
+	}
+	for pos > stop {
+		start := max(pos-delimiterChunk-utf8.UTFMax, 0)
+		data, err := g.readThawingLocked(start, pos-start)
+		if err != nil {
+			return false, err
+		}
+		i := len(data)
+		for i > 0 && (len(data)-i < delimiterChunk || start == 0) && start+int64(i) > stop {
+			r, size := utf8.DecodeLastRune(data[:i])
+			i -= size
+			if visit(start+int64(i), r) {
+				return true, nil
+			}
+		}
+		pos = start + int64(i)
+	}
+	return false, nil
+}
@@ -0,0 +1,74 @@
+package garland
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchDelimiterNesting(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	body := strings.Repeat("x(y)[z] ", 1200) // spans several scan chunks
+	text := "f(a, [b(c)], {" + body + "}) + «q«r»»"
+	g, _ := lib.Open(FileOptions{DataString: text, MaxLeafSize: 64})
+	defer g.Close()
+
+	c := g.NewCursor()
+	closeBrace := int64(strings.LastIndex(text, "}"))
+	cases := []struct {
+		pos, at, match int64
+	}{
+		{1, 1, closeBrace + 1},              // '(' at the cursor
+		{11, 10, 5},                         // just after ']': matched backwards
+		{7, 7, 9},                           // '(' inside the brackets
+		{5, 5, 10},                          // '[' skips the nested ()
+		{13, 13, closeBrace},                // '{' across chunks and leaves
+		{closeBrace, closeBrace, 13},        // and back
+		{closeBrace + 2, closeBrace + 1, 1}, // just after the last ')'
+	}
+	for _, tc := range cases {
+		c.SeekByte(tc.pos)
+		at, match, err := c.MatchDelimiter()
+		if err != nil || at != tc.at || match != tc.match {
+			t.Errorf("at byte %d: got %d -> %d (%v), want %d -> %d", tc.pos, at, match, err, tc.at, tc.match)
+		}
+	}
+
+	// Configurable, multi-byte pairs.
+	guil := []DelimiterPair{{'«', '»'}}
+	open := int64(strings.Index(text, "«"))
+	c.SeekByte(open)
+	if at, match, err := c.MatchDelimiterWith(DelimiterOptions{Pairs: guil}); err != nil || at != open || match != int64(len(text))-2 {
+		t.Errorf("guillemets: %d -> %d (%v)", at, match, err)
+	}
+	if _, _, err := c.MatchDelimiter(); err != ErrNoDelimiter {
+		t.Errorf("'«' with default pairs: err = %v", err)
+	}
+}
+
+func TestMatchDelimiterUnmatchedAndLimit(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "a (b (c) d\n" + strings.Repeat(".", 100) + ")"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekByte(2)
+	if _, match, err := c.MatchDelimiter(); err != nil || match != 111 {
+		t.Errorf("match %d, err %v", match, err)
+	}
+	if _, _, err := c.MatchDelimiterWith(DelimiterOptions{Limit: 50}); err != ErrUnmatchedDelimiter {
+		t.Errorf("limited: err = %v", err)
+	}
+	c.SeekByte(0)
+	if _, _, err := c.MatchDelimiter(); err != ErrNoDelimiter {
+		t.Errorf("no delimiter: err = %v", err)
+	}
+	c.SeekByte(111)
+	if at, match, err := c.MatchDelimiter(); err != nil || at != 111 || match != 2 {
+		t.Errorf("from ')': %d -> %d (%v)", at, match, err)
+	}
+	g.NewCursor().DeleteBytes(3, false) // drop "a (": the ')' is now unmatched
+	c.SeekByte(108)
+	if _, _, err := c.MatchDelimiter(); err != ErrUnmatchedDelimiter {
+		t.Errorf("after delete: err = %v", err)
+	}
+}
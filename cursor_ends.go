@@ -0,0 +1,58 @@
+package garland
+
+import (
+	"context"
+	"math"
+)
+
+// cursor_ends.go - the start and end of the document.
+//
+// DESIGN: "go to the top" and "go to the bottom" are the most basic
+// motions, yet the end is a moving target while a source is streaming
+// in: ByteCount().Value is only where the loader has got to, and
+// seeking there strands the cursor short of the real end. SeekEnd waits
+// for loading to complete (as the other seeks wait for their target)
+// and lands on the true end; SeekEndCtx bounds the wait with a context.
+// AtEOF answers the matching question - at the end AND nothing more to
+// come - so navigation code never weighs Complete flags itself. (A
+// cursor that should keep up with a growing end is a pin; see
+// cursor_pin.go.)
+
+// SeekStart moves the cursor to the start of the document.
+func (c *Cursor) SeekStart() error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	return c.garland.setCursorFromByte(c, 0)
+}
+
+// SeekEnd moves the cursor to the end of the document, first waiting
+// for a streaming load to complete.
+func (c *Cursor) SeekEnd() error {
+	return c.SeekEndCtx(context.Background())
+}
+
+// SeekEndCtx is SeekEnd with the wait for loading bounded by ctx.
+func (c *Cursor) SeekEndCtx(ctx context.Context) error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	g := c.garland
+	if err := eofIsFine(g.waitForBytePosition(ctx, math.MaxInt64, -1)); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.placeCursorLocked(c, g.totalBytes)
+}
+
+// AtEOF reports whether the cursor is at the end of the document and
+// the document is completely loaded.
+func (c *Cursor) AtEOF() bool {
+	if c.garland == nil {
+		return false
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	return c.garland.countComplete && c.bytePos == c.garland.totalBytes
+}
@@ -0,0 +1,54 @@
+package garland
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSeekStartEnd(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "abc\ndef"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	if c.AtEOF() {
+		t.Error("AtEOF at the start")
+	}
+	if err := c.SeekEnd(); err != nil || c.BytePos() != 7 || !c.AtEOF() {
+		t.Errorf("SeekEnd: at %d, AtEOF %v, err %v", c.BytePos(), c.AtEOF(), err)
+	}
+	if line, col := c.LinePos(); line != 1 || col != 3 {
+		t.Errorf("end at %d:%d", line, col)
+	}
+	if err := c.SeekStart(); err != nil || c.BytePos() != 0 {
+		t.Errorf("SeekStart: at %d, err %v", c.BytePos(), err)
+	}
+}
+
+func TestSeekEndWaitsForStream(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	dataChan := make(chan []byte)
+	g, _ := lib.Open(FileOptions{DataChannel: dataChan})
+	defer g.Close()
+
+	c := g.NewCursor()
+	dataChan <- []byte("partial ")
+	c.SeekByte(8)
+	if c.AtEOF() {
+		t.Error("AtEOF while still loading")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.SeekEndCtx(ctx); err != context.DeadlineExceeded {
+		t.Errorf("SeekEndCtx during load: err = %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- c.SeekEnd() }()
+	dataChan <- []byte("rest")
+	close(dataChan)
+	if err := <-done; err != nil || c.BytePos() != 12 || !c.AtEOF() {
+		t.Errorf("SeekEnd: at %d, AtEOF %v, err %v", c.BytePos(), c.AtEOF(), err)
+	}
+}
@@ -0,0 +1,72 @@
+package garland
+
+import "sync"
+
+// cursor_ghost.go - read-only throwaway cursors.
+//
+// DESIGN: hit-testing a click, measuring where a refactor preview would
+// land, or scanning ahead for a highlighter all want a cursor for a few
+// calls - seek, read, convert - and then never again. A registered
+// cursor is the wrong tool: every edit walks the cursor list to adjust
+// it, every revision may record its position, and undo restores it, so
+// a few thousand forgotten helpers slow every keystroke and leak until
+// RemoveCursor. A ghost is a Cursor that the garland does not know
+// about:
+//
+//   - It is not in the cursor list. Edits do not adjust it, versions
+//     do not record it, UndoSeek and ForkSeek do not move it, and
+//     ListCursors and CursorsInOrder do not show it. Its position is
+//     just a number valid for the document as it was at the last seek -
+//     seek again after the document changes.
+//   - It is read-only: an edit through it fails with ErrGhostCursor
+//     (and a transaction around it rolls back as for any other error).
+//   - Creating one is an allocation; dropping it is letting go of it.
+//     There is nothing to remove.
+//
+// Everything else - seeks and their policies, reads, peeks, search,
+// conversions - works as on any cursor.
+
+// NewGhostCursor returns a read-only, unregistered cursor at the start
+// of the document (see cursor_ghost.go).
+func (g *Garland) NewGhostCursor() *Cursor {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return newGhostLocked(g, 0, 0, 0, 0)
+}
+
+// Ghost returns a ghost cursor at this cursor's position.
+func (c *Cursor) Ghost() (*Cursor, error) {
+	if c.detached() {
+		return nil, ErrCursorNotFound
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked() // the ghost copies every coordinate
+	c.resolveStaleLineRuneLocked()
+	return newGhostLocked(g, c.bytePos, c.runePos, c.line, c.lineRune), nil
+}
+
+// IsGhost reports whether the cursor is a ghost.
+func (c *Cursor) IsGhost() bool {
+	return c.ghost
+}
+
+// newGhostLocked builds a ghost at the given position. Caller must hold
+// the write lock.
+func newGhostLocked(g *Garland, bytePos, runePos, line, lineRune int64) *Cursor {
+	c := &Cursor{
+		garland:      g,
+		bytePos:      bytePos,
+		runePos:      runePos,
+		line:         line,
+		lineRune:     lineRune,
+		lastFork:     g.currentFork,
+		lastRevision: g.currentRevision,
+		mode:         CursorModeHuman,
+		ghost:        true,
+	}
+	c.readyCond = sync.NewCond(&c.readyMu)
+	g.updateCursorReady(c)
+	return c
+}
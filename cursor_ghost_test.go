@@ -0,0 +1,67 @@
+package garland
+
+import "testing"
+
+func TestGhostCursorReadsAndSeeks(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "alpha beta\ngamma"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekByte(6)
+	ghost, err := c.Ghost()
+	if err != nil || !ghost.IsGhost() || c.IsGhost() {
+		t.Fatalf("Ghost: %v", err)
+	}
+	if s, _ := ghost.PeekString(4); s != "beta" {
+		t.Errorf("ghost peek %q", s)
+	}
+	ghost.SeekLine(1, 2)
+	if b, _ := ghost.ReadBytes(3); string(b) != "mma" {
+		t.Errorf("ghost read %q", b)
+	}
+	if c.BytePos() != 6 {
+		t.Errorf("original moved to %d", c.BytePos())
+	}
+	if len(g.ListCursors()) != 1 || len(g.CursorsInOrder()) != 1 {
+		t.Error("ghost is listed with the cursors")
+	}
+
+	for i := 0; i < 1000; i++ {
+		g.NewGhostCursor().SeekByte(int64(i % 16))
+	}
+	if len(g.ListCursors()) != 1 {
+		t.Error("ghosts were registered")
+	}
+}
+
+func TestGhostCursorIsReadOnlyAndUnadjusted(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "hello world"})
+	defer g.Close()
+
+	ghost := g.NewGhostCursor()
+	ghost.SeekByte(6)
+	if _, err := ghost.InsertString("x", nil, false); err != ErrGhostCursor {
+		t.Errorf("insert: err = %v", err)
+	}
+	if _, _, err := ghost.DeleteBytes(1, false); err != ErrGhostCursor {
+		t.Errorf("delete: err = %v", err)
+	}
+	rev := g.CurrentRevision()
+
+	// Edits elsewhere do not adjust a ghost, and undo does not move it.
+	c := g.NewCursor()
+	c.InsertString(">> ", nil, false)
+	if ghost.BytePos() != 6 {
+		t.Errorf("ghost adjusted to %d", ghost.BytePos())
+	}
+	ghost.SeekByte(12)
+	g.UndoSeek(rev)
+	if ghost.BytePos() != 12 {
+		t.Errorf("ghost moved by undo to %d", ghost.BytePos())
+	}
+	if readAll(t, g) != "hello world" {
+		t.Error("ghost edit changed the document")
+	}
+}
@@ -0,0 +1,112 @@
+package garland
+
+// cursor_label.go - names and metadata on cursors.
+//
+// DESIGN: multi-cursor and multi-user frontends need to say which
+// cursor is whose - "alice", "search", "default" - and hang their own
+// state on it (a color, a peer ID, a selection style). Keeping that in
+// a map beside the Garland means keeping the map in step with
+// NewCursor and RemoveCursor; instead the cursor carries it, and
+// ListCursors reports every registered cursor with its label.
+//
+//   - A name is a plain label: it is not required, not validated and
+//     not unique. FindCursor returns the earliest-created cursor with
+//     the name.
+//   - Metadata is an arbitrary key -> value map owned by the caller;
+//     the Garland never looks inside. Values are returned as stored.
+//   - The name travels with MarshalState; metadata does not (it need
+//     not be serializable).
+
+// CursorInfo describes a registered cursor (see ListCursors).
+type CursorInfo struct {
+	Cursor        *Cursor
+	Name          string
+	Position      CursorPosition
+	TracksHistory bool
+	Metadata      map[string]interface{} // a copy; nil when empty
+}
+
+// Name returns the cursor's label ("" when unnamed).
+func (c *Cursor) Name() string {
+	if c.garland == nil {
+		return c.name
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	return c.name
+}
+
+// SetName sets the cursor's label.
+func (c *Cursor) SetName(name string) {
+	if c.garland == nil {
+		c.name = name
+		return
+	}
+	c.garland.mu.Lock()
+	defer c.garland.mu.Unlock()
+	c.name = name
+}
+
+// Metadata returns the value stored under key.
+func (c *Cursor) Metadata(key string) (interface{}, bool) {
+	if c.garland != nil {
+		c.garland.mu.RLock()
+		defer c.garland.mu.RUnlock()
+	}
+	value, ok := c.metadata[key]
+	return value, ok
+}
+
+// SetMetadata stores value under key; a nil value removes the key.
+func (c *Cursor) SetMetadata(key string, value interface{}) {
+	if c.garland != nil {
+		c.garland.mu.Lock()
+		defer c.garland.mu.Unlock()
+	}
+	if value == nil {
+		delete(c.metadata, key)
+		return
+	}
+	if c.metadata == nil {
+		c.metadata = make(map[string]interface{})
+	}
+	c.metadata[key] = value
+}
+
+// ListCursors returns every registered cursor, in creation order.
+func (g *Garland) ListCursors() []CursorInfo {
+	g.mu.Lock() // positions may lazily recompute stale columns
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	infos := make([]CursorInfo, 0, len(g.cursors))
+	for _, c := range g.cursors {
+		c.resolveStaleLineRuneLocked()
+		info := CursorInfo{
+			Cursor:        c,
+			Name:          c.name,
+			Position:      CursorPosition{BytePos: c.bytePos, RunePos: c.runePos, Line: c.line, LineRune: c.lineRune},
+			TracksHistory: c.tracksHistory,
+		}
+		if len(c.metadata) > 0 {
+			info.Metadata = make(map[string]interface{}, len(c.metadata))
+			for k, v := range c.metadata {
+				info.Metadata[k] = v
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// FindCursor returns the earliest-created registered cursor named
+// name, or ErrCursorNotFound.
+func (g *Garland) FindCursor(name string) (*Cursor, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, c := range g.cursors {
+		if c.name == name {
+			return c, nil
+		}
+	}
+	return nil, ErrCursorNotFound
+}
@@ -0,0 +1,65 @@
+package garland
+
+import "testing"
+
+func TestCursorLabelsAndListing(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "shared document"})
+	defer g.Close()
+
+	alice := g.NewCursor()
+	alice.SetName("alice")
+	alice.SetMetadata("color", "#e33")
+	bob := g.NewEphemeralCursor()
+	bob.SetName("bob")
+	bob.SeekByte(7)
+	g.NewCursor() // unnamed
+
+	infos := g.ListCursors()
+	if len(infos) != 3 || infos[0].Cursor != alice || infos[1].Name != "bob" || infos[2].Name != "" {
+		t.Fatalf("listing %+v", infos)
+	}
+	if infos[1].Position.BytePos != 7 || infos[1].TracksHistory || infos[0].Metadata["color"] != "#e33" {
+		t.Errorf("bob %+v, alice metadata %v", infos[1], infos[0].Metadata)
+	}
+	infos[0].Metadata["color"] = "changed" // a copy
+	if v, _ := alice.Metadata("color"); v != "#e33" {
+		t.Errorf("metadata %v after editing the listing", v)
+	}
+
+	if c, err := g.FindCursor("bob"); err != nil || c != bob {
+		t.Errorf("FindCursor(bob) = %v, %v", c, err)
+	}
+	g.RemoveCursor(bob)
+	if _, err := g.FindCursor("bob"); err != ErrCursorNotFound {
+		t.Errorf("removed cursor found: %v", err)
+	}
+	alice.SetMetadata("color", nil)
+	if _, ok := alice.Metadata("color"); ok {
+		t.Error("nil value kept the key")
+	}
+}
+
+func TestCursorNameTravelsWithState(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "abc"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SetName("session-main")
+	c.SetMetadata("peer", 42)
+	data, _ := c.MarshalState()
+	r, _, err := g.RestoreCursor(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name() != "session-main" {
+		t.Errorf("name %q", r.Name())
+	}
+	if _, ok := r.Metadata("peer"); ok {
+		t.Error("metadata was serialized")
+	}
+	if found, _ := g.FindCursor("session-main"); found != c {
+		t.Error("FindCursor did not return the earliest cursor")
+	}
+}
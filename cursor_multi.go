@@ -0,0 +1,71 @@
+package garland
+
+import "sort"
+
+// cursor_multi.go - the same edit at many cursors.
+//
+// DESIGN: multi-caret typing inserts the keystroke at every caret, and
+// the user expects one undo step to take it all back. EditAtCursors
+// runs a caller-supplied edit once per cursor inside a single
+// transaction, so the whole keystroke is one revision.
+//
+//   - Cursors are visited from the end of the document backwards. An
+//     edit then only ever moves text after the carets still to come, so
+//     each cursor is exactly where the caller left it when its turn
+//     comes; the ordinary cursor adjustment keeps the already-edited
+//     ones in step as earlier text grows or shrinks.
+//   - Cursors on the same byte are one caret: the edit runs at the first
+//     of them (in the order given) and the others are moved to where
+//     that one ends, so carets that met stay merged.
+//   - Any error, from validation or from fn, rolls the transaction back:
+//     no caret sees half a keystroke.
+//   - fn may move its cursor and make any number of edits through it,
+//     but must stay at or before where its cursor started - edits past
+//     it would land on carets already done.
+
+// EditAtCursors calls fn for each cursor, last in the document first,
+// inside one transaction, so the edits form a single revision. Cursors
+// at the same position are edited once and left together. Returns
+// ErrCursorNotFound if a cursor belongs to another garland or was
+// removed; an error from fn rolls back every edit and is returned.
+func (g *Garland) EditAtCursors(cursors []*Cursor, fn func(c *Cursor) error) (ChangeResult, error) {
+	type caret struct {
+		c   *Cursor
+		pos int64
+	}
+	carets := make([]caret, 0, len(cursors))
+	seen := make(map[*Cursor]bool, len(cursors))
+	for _, c := range cursors {
+		if c == nil || c.garland != g || c.detached() {
+			return ChangeResult{}, ErrCursorNotFound
+		}
+		if !seen[c] {
+			seen[c] = true
+			carets = append(carets, caret{c, c.BytePos()})
+		}
+	}
+	if len(carets) == 0 {
+		return ChangeResult{Fork: g.CurrentFork(), Revision: g.CurrentRevision()}, nil
+	}
+	sort.SliceStable(carets, func(i, j int) bool { return carets[i].pos > carets[j].pos })
+
+	if err := g.TransactionStart("multi-cursor"); err != nil {
+		return ChangeResult{}, err
+	}
+	for i := 0; i < len(carets); {
+		lead := carets[i].c
+		if err := fn(lead); err != nil {
+			g.TransactionRollback()
+			return ChangeResult{}, err
+		}
+		j := i + 1
+		for ; j < len(carets) && carets[j].pos == carets[i].pos; j++ {
+			if err := carets[j].c.SeekByte(lead.BytePos()); err != nil {
+				g.TransactionRollback()
+				return ChangeResult{}, err
+			}
+		}
+		i = j
+	}
+	return g.TransactionCommit()
+}
@@ -0,0 +1,86 @@
+package garland
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEditAtCursorsOneRevision(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "ab\ncd\nef"})
+	defer g.Close()
+
+	a, b, c, d := g.NewCursor(), g.NewCursor(), g.NewCursor(), g.NewCursor()
+	b.SeekByte(3)
+	c.SeekByte(6)
+	d.SeekByte(3) // same caret as b
+	before := g.CurrentRevision()
+
+	calls := 0
+	_, err := g.EditAtCursors([]*Cursor{a, b, c, d, a}, func(k *Cursor) error {
+		calls++
+		_, err := k.InsertString("x", nil, false)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("fn called %d times, want 3", calls)
+	}
+	if got := readAll(t, g); got != "xab\nxcd\nxef" {
+		t.Errorf("content %q", got)
+	}
+	for i, w := range []struct {
+		k   *Cursor
+		pos int64
+	}{{a, 1}, {b, 5}, {c, 9}, {d, 5}} {
+		if w.k.BytePos() != w.pos {
+			t.Errorf("cursor %d at %d, want %d", i, w.k.BytePos(), w.pos)
+		}
+	}
+	if now := g.CurrentRevision(); now != before+1 {
+		t.Errorf("revision %d, want %d", now, before+1)
+	}
+	g.UndoSeek(before)
+	if got := readAll(t, g); got != "ab\ncd\nef" {
+		t.Errorf("after undo %q", got)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestEditAtCursorsRollsBackOnError(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "one two three"})
+	defer g.Close()
+
+	a, b := g.NewCursor(), g.NewCursor()
+	b.SeekByte(8)
+	before := g.CurrentRevision()
+
+	boom := errors.New("boom")
+	_, err := g.EditAtCursors([]*Cursor{a, b}, func(k *Cursor) error {
+		if k == a {
+			return boom
+		}
+		_, err := k.InsertString("!", nil, false)
+		return err
+	})
+	if err != boom {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	if got := readAll(t, g); got != "one two three" {
+		t.Errorf("content %q", got)
+	}
+	if g.CurrentRevision() != before || b.BytePos() != 8 {
+		t.Errorf("revision %d, b at %d", g.CurrentRevision(), b.BytePos())
+	}
+
+	other, _ := lib.Open(FileOptions{DataString: "x"})
+	defer other.Close()
+	if _, err := g.EditAtCursors([]*Cursor{a, other.NewCursor()}, func(*Cursor) error { return nil }); err != ErrCursorNotFound {
+		t.Errorf("foreign cursor: err = %v", err)
+	}
+}
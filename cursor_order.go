@@ -0,0 +1,63 @@
+package garland
+
+// cursor_order.go - cursors by position.
+//
+// DESIGN: multi-cursor code (merging carets that met, walking carets
+// for an edit, painting them) wants the cursors in document order, and
+// sorting every cursor by BytePos on every keystroke costs a lock round
+// trip per cursor plus the sort. The garland instead keeps one ordered
+// list of its cursors and repairs it when asked:
+//
+//   - Edits never reorder cursors: they shift everything after a point
+//     by the same amount or collapse a range onto its start, both of
+//     which keep a sorted list sorted. What does reorder them - a seek,
+//     an undo jump, a moved range - typically moves a few cursors, so
+//     an insertion sort restores the order in close to one pass: linear
+//     when nothing changed, never a full re-sort of an ordered list.
+//   - The sort is stable: cursors at the same position keep their
+//     relative order from call to call (initially, creation order).
+//   - New cursors join at the end and are sorted in on the next call;
+//     removed ones leave the list at once.
+//
+// Compare is the ordering as a function, usable with slices.SortFunc.
+
+// Compare orders two cursors by byte position: negative when a is
+// before b, positive when after, 0 at the same position.
+func Compare(a, b *Cursor) int {
+	pa, pb := a.posByte(), b.posByte()
+	switch {
+	case pa < pb:
+		return -1
+	case pa > pb:
+		return 1
+	}
+	return 0
+}
+
+// CursorsInOrder returns the garland's cursors sorted by byte position,
+// ties in a stable order. The slice is a copy.
+func (g *Garland) CursorsInOrder() []*Cursor {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	order := g.cursorOrder
+	for i := 1; i < len(order); i++ {
+		c := order[i]
+		j := i
+		for ; j > 0 && order[j-1].bytePos > c.bytePos; j-- {
+			order[j] = order[j-1]
+		}
+		order[j] = c
+	}
+	return append([]*Cursor(nil), order...)
+}
+
+// dropFromCursorOrderLocked removes a cursor from the ordered list.
+// Caller must hold the write lock.
+func (g *Garland) dropFromCursorOrderLocked(c *Cursor) {
+	for i, o := range g.cursorOrder {
+		if o == c {
+			g.cursorOrder = append(g.cursorOrder[:i], g.cursorOrder[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package garland
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCursorsInOrder(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "0123456789abcdef"})
+	defer g.Close()
+
+	a, b, c, d := g.NewCursor(), g.NewCursor(), g.NewCursor(), g.NewCursor()
+	a.SeekByte(12)
+	b.SeekByte(3)
+	c.SeekByte(8)
+	d.SeekByte(3)
+	if got, want := g.CursorsInOrder(), []*Cursor{b, d, c, a}; !slices.Equal(got, want) {
+		t.Errorf("order %v, want b d c a", positions(got))
+	}
+
+	// An edit collapses c and a onto b's range end; a seek reorders.
+	b.DeleteBytes(10, false)
+	a.SeekByte(0)
+	if got, want := g.CursorsInOrder(), []*Cursor{a, b, d, c}; !slices.Equal(got, want) {
+		t.Errorf("order %v, want a b d c", positions(got))
+	}
+
+	g.RemoveCursor(d)
+	e := g.NewCursor()
+	e.SeekByte(6)
+	if got, want := g.CursorsInOrder(), []*Cursor{a, b, c, e}; !slices.Equal(got, want) {
+		t.Errorf("order %v, want a b c e", positions(got))
+	}
+}
+
+func TestCompareCursors(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "hello world"})
+	defer g.Close()
+
+	a, b := g.NewCursor(), g.NewCursor()
+	b.SeekByte(5)
+	if Compare(a, b) >= 0 || Compare(b, a) <= 0 || Compare(a, a) != 0 {
+		t.Errorf("Compare: %d %d %d", Compare(a, b), Compare(b, a), Compare(a, a))
+	}
+	cs := []*Cursor{b, a}
+	slices.SortFunc(cs, Compare)
+	if cs[0] != a {
+		t.Error("SortFunc with Compare did not order the cursors")
+	}
+}
+
+// positions returns the byte positions of cursors, for messages.
+func positions(cs []*Cursor) []int64 {
+	out := make([]int64, len(cs))
+	for i, c := range cs {
+		out[i] = c.BytePos()
+	}
+	return out
+}
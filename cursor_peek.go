@@ -0,0 +1,82 @@
+package garland
+
+// cursor_peek.go - lookahead reads that leave the cursor in place.
+//
+// DESIGN: syntax scanners and auto-pairing look at the text just after
+// the caret far more often than they consume it. ReadBytes and
+// ReadString advance the cursor, so each lookahead used to be a
+// save-read-restore dance - three lock round trips and a window in
+// which another goroutine's edit could land between the read and the
+// restore. The Peek calls read under one lock from the cursor's
+// position at that moment and never touch it.
+//
+//   - Lengths are clamped at the end of the document, like the Read
+//     calls: a peek at the end returns nothing, not an error.
+//   - PeekString counts runes; PeekLine is the rest of the cursor's line
+//     without its newline (ReadLine returns the whole line).
+//   - Cold leaves are thawed as needed.
+
+// PeekBytes returns up to length bytes from the cursor position without
+// moving the cursor.
+func (c *Cursor) PeekBytes(length int64) ([]byte, error) {
+	if c.detached() {
+		return nil, ErrCursorNotFound
+	}
+	if length <= 0 {
+		return nil, nil
+	}
+	g := c.garland
+	g.touchAccess()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.readThawingLocked(c.bytePos, min(length, g.totalBytes-c.bytePos))
+}
+
+// PeekString returns up to length runes from the cursor position
+// without moving the cursor.
+func (c *Cursor) PeekString(length int64) (string, error) {
+	if c.detached() {
+		return "", ErrCursorNotFound
+	}
+	if length <= 0 {
+		return "", nil
+	}
+	g := c.garland
+	g.touchAccess()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	end := g.totalBytes
+	if c.runePos+length < g.totalRunes {
+		var err error
+		if end, err = g.runeToByteInternalUnlocked(c.runePos + length); err != nil {
+			return "", err
+		}
+	}
+	data, err := g.readThawingLocked(c.bytePos, end-c.bytePos)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// PeekLine returns the rest of the cursor's line, from the cursor up to
+// (not including) the newline, without moving the cursor.
+func (c *Cursor) PeekLine() (string, error) {
+	if c.detached() {
+		return "", ErrCursorNotFound
+	}
+	g := c.garland
+	g.touchAccess()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	end := g.findLineEndUnlocked(c.bytePos)
+	data, err := g.readThawingLocked(c.bytePos, end-c.bytePos)
+	if err != nil {
+		return "", err
+	}
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		data = data[:n-1]
+	}
+	return string(data), nil
+}
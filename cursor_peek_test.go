@@ -0,0 +1,50 @@
+package garland
+
+import "testing"
+
+func TestPeekLeavesCursor(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "fn(naïve) {\nbody\n}"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekByte(3)
+	if b, err := c.PeekBytes(4); err != nil || string(b) != "naï" {
+		t.Errorf("PeekBytes = %q, %v", b, err)
+	}
+	if s, err := c.PeekString(5); err != nil || s != "naïve" {
+		t.Errorf("PeekString = %q, %v", s, err)
+	}
+	if s, err := c.PeekLine(); err != nil || s != "naïve) {" {
+		t.Errorf("PeekLine = %q, %v", s, err)
+	}
+	if c.BytePos() != 3 || c.RunePos() != 3 {
+		t.Errorf("cursor moved to byte %d rune %d", c.BytePos(), c.RunePos())
+	}
+}
+
+func TestPeekClampsAtEnd(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "ab\ncd"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekByte(3)
+	if b, _ := c.PeekBytes(10); string(b) != "cd" {
+		t.Errorf("PeekBytes past end = %q", b)
+	}
+	if s, _ := c.PeekString(10); s != "cd" {
+		t.Errorf("PeekString past end = %q", s)
+	}
+	c.SeekByte(5)
+	if b, err := c.PeekBytes(1); err != nil || len(b) != 0 {
+		t.Errorf("PeekBytes at end = %q, %v", b, err)
+	}
+	if s, err := c.PeekLine(); err != nil || s != "" {
+		t.Errorf("PeekLine at end = %q, %v", s, err)
+	}
+	c.SeekByte(2)
+	if s, _ := c.PeekLine(); s != "" {
+		t.Errorf("PeekLine before newline = %q", s)
+	}
+}
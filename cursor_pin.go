@@ -0,0 +1,87 @@
+package garland
+
+// cursor_pin.go - cursors that follow the end of a streaming load.
+//
+// DESIGN: while a DataChannel source is still arriving, the document
+// grows at its end, and a cursor parked "at EOF" is left behind at the
+// old end by every chunk: a follow/tail view would have to poll the
+// byte count and seek after each one. A pin makes the cursor ride the
+// growing end instead:
+//
+//   - PinToEnd: a cursor at the end of the document when a chunk
+//     arrives moves to the new end.
+//   - PinToLine: a cursor at the start of the last line when a chunk
+//     arrives moves to the start of the new last line - the line still
+//     being received, which is what a tail view keeps in sight.
+//
+// Only a cursor AT its pin point rides: seeking away (the user
+// scrolling up through the log) leaves it where it is while the data
+// keeps coming, and seeking back to the end resumes following - tail's
+// -f with a natural escape. Edits never move a pinned cursor other than
+// as they move any cursor, and once loading completes the pin has
+// nothing left to do. Pin moves are ordinary cursor moves; no revision.
+
+// PinMode selects whether a cursor follows a growing document.
+type PinMode int
+
+const (
+	// PinNone leaves the cursor where it is as data arrives.
+	PinNone PinMode = iota
+
+	// PinToEnd keeps a cursor at the end of the document at the end.
+	PinToEnd
+
+	// PinToLine keeps a cursor at the start of the last line at the
+	// start of the last line.
+	PinToLine
+)
+
+// Pin returns the cursor's pin mode.
+func (c *Cursor) Pin() PinMode {
+	if c.garland == nil {
+		return c.pin
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	return c.pin
+}
+
+// SetPin sets whether the cursor rides the end of a streaming load
+// (see PinMode). The cursor does not move.
+func (c *Cursor) SetPin(mode PinMode) {
+	if c.garland == nil {
+		c.pin = mode
+		return
+	}
+	c.garland.mu.Lock()
+	defer c.garland.mu.Unlock()
+	c.pin = mode
+}
+
+// followPinsLocked moves pinned cursors that sat at their pin point
+// before the document grew from oldBytes / oldLines to the current
+// totals. Caller must hold the write lock.
+func (g *Garland) followPinsLocked(oldBytes, oldLines int64) {
+	lastLineStart := int64(-1) // resolved on first use
+	for _, c := range g.cursors {
+		switch c.pin {
+		case PinToEnd:
+			if c.bytePos == oldBytes {
+				g.placeCursorLocked(c, g.totalBytes)
+			}
+		case PinToLine:
+			c.resolveStaleLineRuneLocked()
+			if c.line != oldLines || c.lineRune != 0 || g.totalLines == oldLines {
+				continue
+			}
+			if lastLineStart < 0 {
+				res, err := g.findLeafByLineUnlocked(g.totalLines, 0)
+				if err != nil {
+					return
+				}
+				lastLineStart = res.LineByteStart
+			}
+			g.placeCursorLocked(c, lastLineStart)
+		}
+	}
+}
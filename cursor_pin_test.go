@@ -0,0 +1,75 @@
+package garland
+
+import "testing"
+
+func TestPinToEndFollowsStream(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	dataChan := make(chan []byte)
+	g, _ := lib.Open(FileOptions{DataChannel: dataChan})
+	defer g.Close()
+
+	tail := g.NewCursor()
+	tail.SetPin(PinToEnd)
+	plain := g.NewCursor()
+	sync := g.NewEphemeralCursor()
+
+	dataChan <- []byte("one\n")
+	sync.SeekByte(4) // waits for the chunk
+	if tail.BytePos() != 4 || plain.BytePos() != 0 {
+		t.Errorf("after chunk 1: tail %d, plain %d", tail.BytePos(), plain.BytePos())
+	}
+	dataChan <- []byte("two\n")
+	sync.SeekByte(8)
+	if tail.BytePos() != 8 {
+		t.Errorf("after chunk 2: tail %d, want 8", tail.BytePos())
+	}
+
+	// Scrolled away: left behind; back at the end: follows again.
+	tail.SeekByte(2)
+	dataChan <- []byte("three\n")
+	sync.SeekByte(14)
+	if tail.BytePos() != 2 {
+		t.Errorf("away from the end: tail moved to %d", tail.BytePos())
+	}
+	tail.SeekByte(14)
+	dataChan <- []byte("four")
+	sync.SeekByte(18)
+	if tail.BytePos() != 18 {
+		t.Errorf("resumed: tail %d, want 18", tail.BytePos())
+	}
+	close(dataChan)
+}
+
+func TestPinToLineFollowsLastLine(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	dataChan := make(chan []byte)
+	g, _ := lib.Open(FileOptions{DataChannel: dataChan})
+	defer g.Close()
+
+	view := g.NewCursor()
+	view.SetPin(PinToLine)
+	sync := g.NewEphemeralCursor()
+
+	dataChan <- []byte("alpha\nbe")
+	sync.SeekByte(8)
+	if line, col := view.LinePos(); line != 1 || col != 0 || view.BytePos() != 6 {
+		t.Errorf("at %d:%d byte %d, want 1:0 byte 6", line, col, view.BytePos())
+	}
+	dataChan <- []byte("ta")
+	sync.SeekByte(10)
+	if view.BytePos() != 6 {
+		t.Errorf("same last line: moved to %d", view.BytePos())
+	}
+	dataChan <- []byte("\ngamma")
+	sync.SeekByte(16)
+	if line, col := view.LinePos(); line != 2 || col != 0 {
+		t.Errorf("at %d:%d, want 2:0", line, col)
+	}
+	close(dataChan)
+
+	data, _ := view.MarshalState()
+	r, _, err := g.RestoreCursor(data)
+	if err != nil || r.Pin() != PinToLine {
+		t.Errorf("restored pin %v, err %v", r.Pin(), err)
+	}
+}
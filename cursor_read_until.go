@@ -0,0 +1,110 @@
+package garland
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// cursor_read_until.go - reading up to a delimiter.
+//
+// DESIGN: record-oriented consumers - CSV rows, NUL-terminated strings,
+// length-less protocol frames - read "up to the next separator" and
+// continue after it, the shape of bufio.Reader.ReadBytes. ReadUntil
+// gives them that against the rope directly: it reads forward in
+// delimiterChunk pieces under one lock, searching each piece with a
+// tail of len(delim)-1 bytes kept from the previous one, so a delimiter
+// split across chunk (or leaf) boundaries is still found while each
+// byte is searched about once.
+//
+//   - Found: the data up to and including the delimiter, with the
+//     cursor left just after it.
+//   - The end of the document first: the rest of it and io.EOF, with
+//     the cursor at the end - as bufio does, so a final record without
+//     a trailing separator is still delivered. During a streaming load
+//     the end of what has arrived is not the end of the document:
+//     ReadUntil waits for more (as SeekByte waits for a position) and
+//     returns io.EOF only once loading is complete.
+//   - maxBytes (0: none) bounds the returned data, delimiter included.
+//     Running out of it first is ErrDelimiterNotFound and consumes
+//     nothing: a runaway record is the caller's to handle, not silently
+//     split.
+
+// ReadUntil reads from the cursor up to and including the first
+// occurrence of delim and moves the cursor past it. When the document
+// ends first, it returns the rest with io.EOF and the cursor at the
+// end; when maxBytes (0: no limit) run out first, it returns
+// ErrDelimiterNotFound and the cursor does not move. During lazy
+// loading it blocks until the delimiter arrives or loading completes.
+func (c *Cursor) ReadUntil(delim []byte, maxBytes int64) ([]byte, error) {
+	if c.detached() {
+		return nil, ErrCursorNotFound
+	}
+	if len(delim) == 0 {
+		return nil, nil
+	}
+	g := c.garland
+	g.touchAccess()
+	g.mu.Lock()
+	r := &untilRead{start: c.bytePos, delim: delim, maxBytes: maxBytes}
+	g.mu.Unlock()
+	for {
+		g.mu.Lock()
+		data, done, err := g.readUntilLocked(c, r)
+		loaded := g.totalBytes
+		g.mu.Unlock()
+		if done {
+			return data, err
+		}
+		// Everything loaded so far is searched: wait for the next byte
+		// (ErrInvalidPosition: loading completed without one).
+		if err := g.waitForBytePosition(context.Background(), loaded+1, -1); err != nil && err != ErrInvalidPosition {
+			return nil, err
+		}
+	}
+}
+
+// untilRead is a ReadUntil in progress: what it has read so far, kept
+// across waits for a streaming load.
+type untilRead struct {
+	start    int64
+	delim    []byte
+	maxBytes int64
+	buf      []byte
+	from     int // where the next search starts
+}
+
+// readUntilLocked searches on from what r has read, through the bytes
+// loaded so far. done is false when they ran out before the delimiter,
+// the limit or the end of a complete document.
+func (g *Garland) readUntilLocked(c *Cursor, r *untilRead) (data []byte, done bool, err error) {
+	limit := g.totalBytes - r.start
+	if r.maxBytes > 0 && r.maxBytes < limit {
+		limit = r.maxBytes
+	}
+	for int64(len(r.buf)) < limit {
+		chunk, err := g.readThawingLocked(r.start+int64(len(r.buf)), min(delimiterChunk, limit-int64(len(r.buf))))
+		if err != nil {
+			return nil, true, err
+		}
+		r.buf = append(r.buf, chunk...)
+		if i := bytes.Index(r.buf[r.from:], r.delim); i >= 0 {
+			r.buf = r.buf[:r.from+i+len(r.delim)]
+			if err := g.placeCursorLocked(c, r.start+int64(len(r.buf))); err != nil {
+				return nil, true, err
+			}
+			return r.buf, true, nil
+		}
+		r.from = max(len(r.buf)-len(r.delim)+1, 0)
+	}
+	if r.start+limit < g.totalBytes {
+		return nil, true, ErrDelimiterNotFound
+	}
+	if !g.countComplete {
+		return nil, false, nil
+	}
+	if err := g.placeCursorLocked(c, g.totalBytes); err != nil {
+		return nil, true, err
+	}
+	return r.buf, true, io.EOF
+}
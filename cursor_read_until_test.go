@@ -0,0 +1,81 @@
+package garland
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadUntilRecords(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "a,b\r\nc,d\r\ne,f"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	for _, want := range []string{"a,b\r\n", "c,d\r\n"} {
+		got, err := c.ReadUntil([]byte("\r\n"), 0)
+		if err != nil || string(got) != want {
+			t.Errorf("ReadUntil = %q, %v; want %q", got, err, want)
+		}
+	}
+	if c.BytePos() != 10 {
+		t.Errorf("cursor at %d, want 10", c.BytePos())
+	}
+	if got, err := c.ReadUntil([]byte("\r\n"), 0); err != io.EOF || string(got) != "e,f" {
+		t.Errorf("last record = %q, %v", got, err)
+	}
+	if got, err := c.ReadUntil([]byte("\r\n"), 0); err != io.EOF || len(got) != 0 {
+		t.Errorf("at the end = %q, %v", got, err)
+	}
+}
+
+func TestReadUntilLimitAndChunks(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	// The delimiter straddles the first chunk boundary.
+	long := strings.Repeat("x", delimiterChunk-1)
+	g, _ := lib.Open(FileOptions{DataString: long + "<END>tail\x00rest"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	if _, err := c.ReadUntil([]byte("<END>"), 100); err != ErrDelimiterNotFound || c.BytePos() != 0 {
+		t.Errorf("limit: err %v, cursor at %d", err, c.BytePos())
+	}
+	got, err := c.ReadUntil([]byte("<END>"), 0)
+	if err != nil || string(got) != long+"<END>" {
+		t.Errorf("across chunks: %d bytes, %v", len(got), err)
+	}
+	if got, err := c.ReadUntil([]byte{0}, 5); err != nil || string(got) != "tail\x00" {
+		t.Errorf("exactly at the limit = %q, %v", got, err)
+	}
+}
+
+func TestReadUntilWaitsForStream(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	ch := make(chan []byte)
+	g, _ := lib.Open(FileOptions{DataChannel: ch})
+	defer g.Close()
+	ch <- []byte("a,b\nc")
+	for !g.IsByteReady(5) {
+		time.Sleep(time.Millisecond)
+	}
+
+	c := g.NewCursor()
+	if got, err := c.ReadUntil([]byte("\n"), 0); err != nil || string(got) != "a,b\n" {
+		t.Fatalf("first record = %q, %v", got, err)
+	}
+
+	// "c" is all that has arrived of the next record: ReadUntil waits
+	// for the rest instead of calling it the last one.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ch <- []byte(",d\ne")
+		close(ch)
+	}()
+	if got, err := c.ReadUntil([]byte("\n"), 0); err != nil || string(got) != "c,d\n" {
+		t.Errorf("record split by the stream = %q, %v", got, err)
+	}
+	if got, err := c.ReadUntil([]byte("\n"), 0); err != io.EOF || string(got) != "e" {
+		t.Errorf("final record = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,80 @@
+package garland
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRemoveCursorDuringConcurrentEdits(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "0123456789"})
+	defer g.Close()
+
+	anchor := g.NewCursor()
+	anchor.SeekByte(10)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				c := g.NewCursor()
+				done := make(chan struct{})
+				go func() {
+					g.RemoveCursor(c) // races the insert below
+					close(done)
+				}()
+				if _, err := c.InsertString("x", nil, true); err != nil && err != ErrCursorNotFound {
+					t.Errorf("insert: %v", err)
+				}
+				<-done
+				if _, err := c.InsertString("y", nil, true); err != ErrCursorNotFound {
+					t.Errorf("insert through a removed cursor: err = %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every insert that happened landed before the anchor and moved it.
+	if got, want := anchor.BytePos(), g.ByteCount().Value; got != want {
+		t.Errorf("anchor at %d, want %d (end of buffer)", got, want)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestCursorRegistryIsCopyOnWrite(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "abc"})
+	defer g.Close()
+
+	a, b, c := g.NewCursor(), g.NewCursor(), g.NewCursor()
+	g.mu.RLock()
+	held := g.cursors
+	g.mu.RUnlock()
+
+	g.RemoveCursor(a)
+	d := g.NewCursor()
+	if len(held) != 3 || held[0] != a || held[1] != b || held[2] != c {
+		t.Errorf("held list changed under removal/registration: %v", held)
+	}
+	g.mu.RLock()
+	now := g.cursors
+	g.mu.RUnlock()
+	if len(now) != 3 || now[0] != b || now[1] != c || now[2] != d {
+		t.Errorf("registry is %v", now)
+	}
+
+	if err := g.RemoveCursor(a); err != ErrCursorNotFound {
+		t.Errorf("second RemoveCursor: err = %v", err)
+	}
+	if err := a.SeekByte(1); err != ErrCursorNotFound {
+		t.Errorf("seek on a removed cursor: err = %v", err)
+	}
+	if a.BytePos() != 0 {
+		t.Errorf("removed cursor reports position %d", a.BytePos())
+	}
+}
@@ -0,0 +1,167 @@
+package garland
+
+// cursor_restrict.go - cursors confined to a part of the document.
+//
+// DESIGN: a REPL buffer lets the user edit the input after the prompt
+// but not the transcript above it; a template lets them fill in fields
+// and nothing else. Enforcing that in the frontend means checking every
+// motion and every edit path, so the library does it: a cursor may be
+// restricted to a byte range, and then
+//
+//   - every move of the cursor - seeks of any kind, word and line
+//     motions - is clamped into the range (in updatePosition, the one
+//     place a cursor's own moves land);
+//   - edits through the cursor that reach outside the range fail with
+//     ErrOutsideRestriction and change nothing: an insert must be at a
+//     position in [start, end], a delete or overwrite must lie within
+//     it, a move must take from and put into it, a copy must put into
+//     it (reading from elsewhere is fine).
+//
+// Edits through other cursors are not restricted - the program writing
+// the transcript is not the user typing at the prompt - but the range
+// follows them: its ends are ephemeral marks (decoration_ephemeral.go).
+// The start has left gravity and the end right gravity, so text
+// inserted at either edge joins the range; a deleted range collapses
+// ends inside it. A rollback restores the ends with the other marks.
+//
+// RestrictLines converts lines to bytes once, when called: from the
+// start of the first line to the end of the last (its newline
+// included), after which the range is bytes like any other.
+
+// restriction is the range a cursor is confined to.
+type restriction struct {
+	start, end ephemeralMark
+}
+
+// boundsLocked returns the range in document order. (A move can carry
+// one end past the other.) Caller must hold the lock.
+func (r *restriction) boundsLocked() (int64, int64) {
+	return min(r.start.pos, r.end.pos), max(r.start.pos, r.end.pos)
+}
+
+// Restrict confines the cursor to bytes [start, end): its moves are
+// clamped into the range and its edits may not reach outside it. The
+// cursor is moved into the range if it is outside. Replaces any
+// previous restriction.
+func (c *Cursor) Restrict(start, end int64) error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if start < 0 || end < start || end > g.totalBytes {
+		return ErrInvalidPosition
+	}
+	g.restrictLocked(c, start, end)
+	return nil
+}
+
+// RestrictLines confines the cursor to lines first through last,
+// inclusive, as Restrict does for their bytes at the time of the call.
+func (c *Cursor) RestrictLines(first, last int64) error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	if first < 0 || last < first || last > g.totalLines {
+		return ErrInvalidPosition
+	}
+	res, err := g.findLeafByLineUnlocked(first, 0)
+	if err != nil {
+		return err
+	}
+	start := res.LineByteStart
+	end := g.totalBytes
+	if last < g.totalLines {
+		if res, err = g.findLeafByLineUnlocked(last+1, 0); err != nil {
+			return err
+		}
+		end = res.LineByteStart
+	}
+	g.restrictLocked(c, start, end)
+	return nil
+}
+
+// restrictLocked installs a restriction and moves the cursor into it.
+// Caller must hold the write lock.
+func (g *Garland) restrictLocked(c *Cursor, start, end int64) {
+	c.restrict = &restriction{
+		start: ephemeralMark{pos: start, gravity: GravityLeft},
+		end:   ephemeralMark{pos: end, gravity: GravityRight},
+	}
+	if c.bytePos < start || c.bytePos > end {
+		c.updatePosition(c.bytePos, c.runePos, c.line, c.lineRune) // clamps
+	}
+}
+
+// Unrestrict lifts the cursor's restriction, if any.
+func (c *Cursor) Unrestrict() {
+	if c.garland == nil {
+		c.restrict = nil
+		return
+	}
+	c.garland.mu.Lock()
+	defer c.garland.mu.Unlock()
+	c.restrict = nil
+}
+
+// Restriction returns the byte range the cursor is confined to; ok is
+// false when it is unrestricted.
+func (c *Cursor) Restriction() (start, end int64, ok bool) {
+	if c.garland == nil || c.restrict == nil {
+		return 0, 0, false
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	if c.restrict == nil {
+		return 0, 0, false
+	}
+	start, end = c.restrict.boundsLocked()
+	return start, end, true
+}
+
+// confineLocked clamps a position the cursor is about to take into its
+// restriction, recomputing the other coordinates when it moves. Caller
+// must hold the write lock.
+func (c *Cursor) confineLocked(bytePos, runePos, line, lineRune int64) (int64, int64, int64, int64) {
+	if c.restrict == nil || c.garland == nil {
+		return bytePos, runePos, line, lineRune
+	}
+	start, end := c.restrict.boundsLocked()
+	if bytePos >= start && bytePos <= end {
+		return bytePos, runePos, line, lineRune
+	}
+	pos := min(max(bytePos, start), end)
+	g := c.garland
+	r, err := g.byteToRuneInternalUnlocked(pos)
+	if err != nil {
+		return bytePos, runePos, line, lineRune
+	}
+	l, lr, err := g.byteToLineRuneInternalUnlocked(pos)
+	if err != nil {
+		return bytePos, runePos, line, lineRune
+	}
+	return pos, r, l, lr
+}
+
+// editableLocked reports whether an edit through the cursor may change
+// bytes [start, end) (an insert: start == end): not through a ghost
+// (cursor_ghost.go), nor outside a restriction. Caller must hold the
+// lock.
+func (c *Cursor) editableLocked(start, end int64) error {
+	if c.ghost {
+		return ErrGhostCursor
+	}
+	if c.restrict == nil {
+		return nil
+	}
+	lo, hi := c.restrict.boundsLocked()
+	if start < lo || end > hi {
+		return ErrOutsideRestriction
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package garland
+
+import "testing"
+
+func TestRestrictedCursorEdits(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "output\n> cmd"})
+	defer g.Close()
+
+	in := g.NewCursor()
+	if err := in.Restrict(9, 12); err != nil {
+		t.Fatal(err)
+	}
+	if in.BytePos() != 9 {
+		t.Errorf("moved into range at %d, want 9", in.BytePos())
+	}
+	if _, _, err := in.DeleteBytes(1, false); err != nil {
+		t.Fatal(err)
+	}
+	in.InsertString("C", nil, false)
+	if _, _, err := in.BackDeleteBytes(5, false); err != ErrOutsideRestriction {
+		t.Errorf("backspace into the prompt: err = %v", err)
+	}
+	in.SeekByte(12)
+	in.InsertString(" -v", nil, false)
+	if got := readAll(t, g); got != "output\n> Cmd -v" {
+		t.Errorf("content %q", got)
+	}
+
+	// Another cursor writes above; the range follows.
+	out := g.NewCursor()
+	out.SeekByte(6)
+	out.InsertString("\nmore", nil, false)
+	if s, e, ok := in.Restriction(); !ok || s != 14 || e != 20 {
+		t.Errorf("restriction [%d, %d) %v, want [14, 20)", s, e, ok)
+	}
+	in.SeekByte(14)
+	if _, err := in.InsertString("x", nil, true); err != nil {
+		t.Errorf("insert at the start: %v", err)
+	}
+	if _, _, err := in.OverwriteBytes(3, []byte("abc")); err != nil {
+		t.Errorf("overwrite inside: %v", err)
+	}
+	in.Restrict(14, 17)
+	in.SeekByte(16)
+	if _, _, err := in.OverwriteBytes(2, []byte("ab")); err != ErrOutsideRestriction {
+		t.Errorf("overwrite past the end: err = %v", err)
+	}
+
+	in.Unrestrict()
+	if _, _, err := in.BackDeleteBytes(5, false); err != nil {
+		t.Errorf("unrestricted: %v", err)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestRestrictedCursorSeeksClamp(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "zero\none\ntwo\nthree"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	if err := c.RestrictLines(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if s, e, _ := c.Restriction(); s != 5 || e != 13 {
+		t.Errorf("lines 1-2 are [%d, %d), want [5, 13)", s, e)
+	}
+	c.SeekByte(0)
+	if c.BytePos() != 5 {
+		t.Errorf("SeekByte(0) at %d, want 5", c.BytePos())
+	}
+	c.SeekLine(3, 2)
+	if line, col := c.LinePos(); line != 3 || col != 0 || c.BytePos() != 13 {
+		t.Errorf("SeekLine(3, 2) at %d:%d byte %d, want 3:0 byte 13", line, col, c.BytePos())
+	}
+	c.SeekByWord(-5)
+	if c.BytePos() != 5 {
+		t.Errorf("word motion at %d, want 5", c.BytePos())
+	}
+	c.SeekLineDelta(-1)
+	if line, _ := c.LinePos(); line != 1 {
+		t.Errorf("line motion to line %d, want 1", line)
+	}
+
+	// The restriction survives MarshalState / RestoreCursor.
+	data, _ := c.MarshalState()
+	r, _, err := g.RestoreCursor(data)
+	if s, e, ok := r.Restriction(); err != nil || !ok || s != 5 || e != 13 {
+		t.Errorf("restored restriction [%d, %d) %v, err %v", s, e, ok, err)
+	}
+}
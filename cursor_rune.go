@@ -0,0 +1,68 @@
+package garland
+
+import "unicode/utf8"
+
+// cursor_rune.go - the rune under and before the cursor.
+//
+// DESIGN: word motion, auto-indent and bracket handling all start with
+// "which character is the caret on", and the hand-rolled answer -
+// ReadBytes(4) plus utf8.DecodeRune, then seeking back - goes wrong at
+// the end of the document, loses its place on the advance, and needs a
+// second read for the rune before. RuneAt and RuneBefore decode under
+// the lock from a window of at most utf8.UTFMax bytes either side, so
+// leaf boundaries are invisible and the cursor never moves.
+//
+//   - Results follow utf8.DecodeRune: invalid bytes decode as
+//     utf8.RuneError with size 1, and there being no rune (the end of
+//     the document for RuneAt, its start for RuneBefore) is
+//     utf8.RuneError with size 0 - not an error.
+//   - Cold leaves are thawed.
+
+// RuneAt returns the rune at the cursor and its width in bytes, without
+// moving the cursor. At the end of the document it returns
+// utf8.RuneError and size 0.
+func (c *Cursor) RuneAt() (r rune, size int, err error) {
+	if c.detached() {
+		return utf8.RuneError, 0, ErrCursorNotFound
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.runeAtLocked(c.bytePos)
+}
+
+// RuneBefore returns the rune ending at the cursor and its width in
+// bytes, without moving the cursor. At the start of the document it
+// returns utf8.RuneError and size 0.
+func (c *Cursor) RuneBefore() (r rune, size int, err error) {
+	if c.detached() {
+		return utf8.RuneError, 0, ErrCursorNotFound
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.runeBeforeLocked(c.bytePos)
+}
+
+// runeAtLocked decodes the rune starting at pos. Caller must hold the
+// write lock.
+func (g *Garland) runeAtLocked(pos int64) (rune, int, error) {
+	data, err := g.readThawingLocked(pos, min(utf8.UTFMax, g.totalBytes-pos))
+	if err != nil {
+		return utf8.RuneError, 0, err
+	}
+	r, size := utf8.DecodeRune(data)
+	return r, size, nil
+}
+
+// runeBeforeLocked decodes the rune ending at pos. Caller must hold the
+// write lock.
+func (g *Garland) runeBeforeLocked(pos int64) (rune, int, error) {
+	lo := max(pos-utf8.UTFMax, 0)
+	data, err := g.readThawingLocked(lo, pos-lo)
+	if err != nil {
+		return utf8.RuneError, 0, err
+	}
+	r, size := utf8.DecodeLastRune(data)
+	return r, size, nil
+}
@@ -0,0 +1,57 @@
+package garland
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRuneAtAndBefore(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "a€😀b"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	want := []struct {
+		pos          int64
+		at, before   rune
+		atN, beforeN int
+	}{
+		{0, 'a', utf8.RuneError, 1, 0},
+		{1, '€', 'a', 3, 1},
+		{4, '😀', '€', 4, 3},
+		{8, 'b', '😀', 1, 4},
+		{9, utf8.RuneError, 'b', 0, 1},
+	}
+	for _, w := range want {
+		c.SeekByte(w.pos)
+		if r, n, err := c.RuneAt(); err != nil || r != w.at || n != w.atN {
+			t.Errorf("RuneAt at %d = %q/%d, %v", w.pos, r, n, err)
+		}
+		if r, n, err := c.RuneBefore(); err != nil || r != w.before || n != w.beforeN {
+			t.Errorf("RuneBefore at %d = %q/%d, %v", w.pos, r, n, err)
+		}
+		if c.BytePos() != w.pos {
+			t.Errorf("cursor moved from %d to %d", w.pos, c.BytePos())
+		}
+	}
+}
+
+func TestRuneAtAcrossLeaves(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "x"})
+	defer g.Close()
+
+	// Separate inserts put the halves of one rune in different leaves.
+	c := g.NewCursor()
+	c.SeekByte(1)
+	c.InsertBytes([]byte("é")[:1], nil, false)
+	c.InsertBytes([]byte("é")[1:], nil, false)
+	c.SeekByte(1)
+	if r, n, _ := c.RuneAt(); r != 'é' || n != 2 {
+		t.Errorf("RuneAt = %q/%d", r, n)
+	}
+	c.SeekByte(3)
+	if r, n, _ := c.RuneBefore(); r != 'é' || n != 2 {
+		t.Errorf("RuneBefore = %q/%d", r, n)
+	}
+}
@@ -0,0 +1,112 @@
+package garland
+
+import "unicode/utf8"
+
+// cursor_seek_policy.go - what a seek out of range does.
+//
+// DESIGN: a seek past the end of the document fails with
+// ErrInvalidPosition, which is right for a program that computed a
+// position and wants to know it was wrong, and a nuisance for an editor
+// where "go to line 9999" or a click below the last line means "as far
+// as it goes". Rather than every caller wrapping every seek, the cursor
+// carries the choice:
+//
+//   - SeekPolicyError (the default) keeps the errors.
+//   - SeekPolicyClampToEOF clamps: byte and rune seeks to [0, end], a
+//     line past the last (or a column running past the end of the
+//     document) to the end, a negative line or column to its start.
+//   - SeekPolicyClampToLineEnd clamps SeekLine within the line instead:
+//     the line to [0, last], the column to the line's end before its
+//     newline, where the default would carry it into the next line.
+//     Byte and rune seeks clamp as ClampToEOF.
+//
+// The policy applies to SeekByte, SeekRune and SeekLine with their
+// WithTimeout and Ctx variants (and so to the relative seeks built on
+// them). While a file is still streaming in, a clamping seek first
+// waits for its target as usual and clamps only once loading is
+// complete. A cursor in virtual space keeps its columns past the line
+// end under either clamping policy; only the line is clamped.
+
+// SeekPolicy selects how a cursor handles seeks out of range.
+type SeekPolicy int
+
+const (
+	// SeekPolicyError fails out-of-range seeks with ErrInvalidPosition.
+	SeekPolicyError SeekPolicy = iota
+
+	// SeekPolicyClampToEOF clamps out-of-range seeks to the document.
+	SeekPolicyClampToEOF
+
+	// SeekPolicyClampToLineEnd is SeekPolicyClampToEOF, except that
+	// SeekLine clamps the column to the end of the requested line.
+	SeekPolicyClampToLineEnd
+)
+
+// SeekPolicy returns the cursor's out-of-range seek policy.
+func (c *Cursor) SeekPolicy() SeekPolicy {
+	if c.garland == nil {
+		return c.seekPolicy
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	return c.seekPolicy
+}
+
+// SetSeekPolicy sets how the cursor handles seeks out of range.
+func (c *Cursor) SetSeekPolicy(p SeekPolicy) {
+	if c.garland == nil {
+		c.seekPolicy = p
+		return
+	}
+	c.garland.mu.Lock()
+	defer c.garland.mu.Unlock()
+	c.seekPolicy = p
+}
+
+// seekWait filters the error of a seek's wait for its target: a
+// clamping cursor treats a target beyond the loaded document as in
+// range, to be clamped once placed.
+func (c *Cursor) seekWait(err error) error {
+	if err == ErrInvalidPosition && c.SeekPolicy() != SeekPolicyError {
+		return nil
+	}
+	return err
+}
+
+// clampSeekLocked applies the cursor's policy to a byte or rune seek
+// target in a document of size end. Caller must hold the write lock.
+func (c *Cursor) clampSeekLocked(pos, end int64) int64 {
+	if c.seekPolicy == SeekPolicyError {
+		return pos
+	}
+	return min(max(pos, 0), end)
+}
+
+// clampSeekLineLocked applies a clamping policy to a SeekLine target.
+// Caller must hold the write lock.
+func (g *Garland) clampSeekLineLocked(c *Cursor, line, runeInLine int64) (int64, int64, error) {
+	runeInLine = max(runeInLine, 0)
+	pastEnd := line > g.totalLines
+	switch {
+	case line < 0:
+		return 0, 0, nil
+	case pastEnd:
+		line = g.totalLines
+	}
+	clampColumn := c.seekPolicy == SeekPolicyClampToLineEnd && !c.virtualSpace
+	if !pastEnd && !clampColumn {
+		return line, runeInLine, nil
+	}
+	_, text, err := g.lineTextLocked(line)
+	if err != nil {
+		return 0, 0, err
+	}
+	runes := int64(utf8.RuneCount(text))
+	if pastEnd && c.seekPolicy == SeekPolicyClampToEOF {
+		return line, runes, nil // the end of the document
+	}
+	if clampColumn {
+		runeInLine = min(runeInLine, runes)
+	}
+	return line, runeInLine, nil
+}
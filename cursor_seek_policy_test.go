@@ -0,0 +1,61 @@
+package garland
+
+import "testing"
+
+func TestSeekPolicyClampToEOF(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "héllo\nworld\n!"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	if err := c.SeekByte(99); err != ErrInvalidPosition {
+		t.Fatalf("default policy: err = %v", err)
+	}
+	c.SetSeekPolicy(SeekPolicyClampToEOF)
+	if err := c.SeekByte(99); err != nil || c.BytePos() != 14 {
+		t.Errorf("SeekByte(99): at %d, err %v", c.BytePos(), err)
+	}
+	if err := c.SeekRune(-5); err != nil || c.BytePos() != 0 {
+		t.Errorf("SeekRune(-5): at %d, err %v", c.BytePos(), err)
+	}
+	if err := c.SeekLine(7, 2); err != nil || c.BytePos() != 14 {
+		t.Errorf("SeekLine(7, 2): at %d, err %v", c.BytePos(), err)
+	}
+	if line, col := c.LinePos(); line != 2 || col != 1 {
+		t.Errorf("end of document at %d:%d", line, col)
+	}
+	// Within range the column still carries into the next lines.
+	if err := c.SeekLine(1, 8); err != nil || c.BytePos() != 14 {
+		t.Errorf("SeekLine(1, 8): at %d, err %v", c.BytePos(), err)
+	}
+	if err := c.SeekRelativeBytes(5); err != nil || c.BytePos() != 14 {
+		t.Errorf("relative past end: at %d, err %v", c.BytePos(), err)
+	}
+}
+
+func TestSeekPolicyClampToLineEnd(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "héllo\nworld\n!"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SetSeekPolicy(SeekPolicyClampToLineEnd)
+	c.SeekLine(0, 40)
+	if line, col := c.LinePos(); line != 0 || col != 5 || c.BytePos() != 6 {
+		t.Errorf("at %d:%d byte %d, want 0:5 byte 6", line, col, c.BytePos())
+	}
+	c.SeekLine(9, 0)
+	if line, col := c.LinePos(); line != 2 || col != 0 {
+		t.Errorf("past last line at %d:%d, want 2:0", line, col)
+	}
+	if err := c.SeekByte(99); err != nil || c.BytePos() != 14 {
+		t.Errorf("SeekByte(99): at %d, err %v", c.BytePos(), err)
+	}
+
+	// The policy survives MarshalState / RestoreCursor.
+	data, _ := c.MarshalState()
+	r, _, err := g.RestoreCursor(data)
+	if err != nil || r.SeekPolicy() != SeekPolicyClampToLineEnd {
+		t.Errorf("restored policy %v, err %v", r.SeekPolicy(), err)
+	}
+}
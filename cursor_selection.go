@@ -0,0 +1,139 @@
+package garland
+
+// cursor_selection.go - selections: an anchor plus the cursor.
+//
+// DESIGN: a selection is the span between a cursor (the point) and an
+// anchor dropped earlier. Frontends used to keep the anchor in a second
+// cursor and re-derive the span after every edit; here the anchor lives
+// on the cursor and is maintained by the engine.
+//
+//   - The anchor is an ephemeral mark (see decoration_ephemeral.go):
+//     edits map it exactly like the other cursors - an insert at it
+//     follows the edit's insertBefore flag, a deleted range collapses
+//     it to the range start, a moved range carries it along.
+//   - It is recorded with the cursor's position history, so UndoSeek,
+//     ForkSeek and a transaction rollback bring back the selection that
+//     was there, not just the caret. A version without a record keeps
+//     the anchor's byte position, clamped to the content.
+//   - Setting or clearing the anchor is not an edit: no revision, no
+//     replay entry.
+//   - The selection is [min, max) of anchor and point, so it may be
+//     empty (anchor == point) while still set.
+
+// withAnchor stamps the cursor's anchor onto a recorded position.
+func (c *Cursor) withAnchor(pos *CursorPosition) *CursorPosition {
+	if c.anchor != nil {
+		pos.anchor, pos.hasAnchor = c.anchor.pos, true
+	}
+	return pos
+}
+
+// restoreAnchor puts back the anchor recorded with pos.
+func (c *Cursor) restoreAnchor(pos *CursorPosition) {
+	switch {
+	case !pos.hasAnchor:
+		c.anchor = nil
+	case c.anchor == nil:
+		c.anchor = &ephemeralMark{pos: pos.anchor}
+	default:
+		c.anchor.pos = pos.anchor
+	}
+}
+
+// SetAnchor drops the selection anchor at the cursor's position,
+// replacing any previous anchor. Moving the cursor then extends the
+// selection.
+func (c *Cursor) SetAnchor() error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	c.garland.mu.Lock()
+	defer c.garland.mu.Unlock()
+	c.anchor = &ephemeralMark{pos: c.bytePos}
+	return nil
+}
+
+// ClearAnchor removes the selection anchor, if any.
+func (c *Cursor) ClearAnchor() {
+	if c.garland == nil {
+		c.anchor = nil
+		return
+	}
+	c.garland.mu.Lock()
+	defer c.garland.mu.Unlock()
+	c.anchor = nil
+}
+
+// Anchor returns the anchor's byte position; ok is false when no
+// anchor is set.
+func (c *Cursor) Anchor() (pos int64, ok bool) {
+	if c.garland == nil {
+		return 0, false
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	if c.anchor == nil {
+		return 0, false
+	}
+	return c.anchor.pos, true
+}
+
+// selectionLocked returns the selected byte range. Caller must hold
+// the lock.
+func (c *Cursor) selectionLocked() (start, end int64, ok bool) {
+	if c.anchor == nil {
+		return 0, 0, false
+	}
+	start, end = c.anchor.pos, c.bytePos
+	if start > end {
+		start, end = end, start
+	}
+	return start, end, true
+}
+
+// SelectionRange returns the selected byte range [start, end), in
+// document order whichever side the anchor is on. ok is false when no
+// anchor is set.
+func (c *Cursor) SelectionRange() (start, end int64, ok bool) {
+	if c.garland == nil {
+		return 0, 0, false
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	return c.selectionLocked()
+}
+
+// SelectedText returns the selected bytes. Returns ErrNoSelection when
+// no anchor is set. The cursor does not move.
+func (c *Cursor) SelectedText() ([]byte, error) {
+	if c.detached() {
+		return nil, ErrCursorNotFound
+	}
+	start, end, ok := c.SelectionRange()
+	if !ok {
+		return nil, ErrNoSelection
+	}
+	return c.garland.readBytesAt(start, end-start)
+}
+
+// ReplaceSelection replaces the selected bytes with data as a single
+// overwrite (one revision), returning the decorations displaced from
+// the selection as OverwriteBytes does. The anchor is cleared and the
+// cursor left after the new content; undoing the edit restores both.
+// Returns ErrNoSelection when no anchor is set.
+func (c *Cursor) ReplaceSelection(data []byte) ([]RelativeDecoration, ChangeResult, error) {
+	if c.detached() {
+		return nil, ChangeResult{}, ErrCursorNotFound
+	}
+	start, end, ok := c.SelectionRange()
+	if !ok {
+		return nil, ChangeResult{}, ErrNoSelection
+	}
+	decs, result, err := c.garland.overwriteBytesAt(c, start, end-start, data)
+	if err != nil {
+		return nil, result, err
+	}
+	c.ClearAnchor()
+	c.SeekByte(start + int64(len(data)))
+	return decs, result, nil
+}
@@ -0,0 +1,91 @@
+package garland
+
+import "testing"
+
+func TestSelectionFollowsEditsAndUndo(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "one two three four"})
+	defer g.Close()
+
+	sel := g.NewCursor()
+	if _, _, err := sel.ReplaceSelection([]byte("x")); err != ErrNoSelection {
+		t.Fatalf("no anchor: err = %v", err)
+	}
+	sel.SeekByte(8) // "three"
+	sel.SetAnchor()
+	sel.SeekByte(13)
+	start0 := g.CurrentRevision()
+
+	// Another cursor edits before and inside the selection.
+	other := g.NewCursor()
+	other.InsertString(">> ", nil, true)
+	other.SeekByte(13)
+	other.InsertString("EE", nil, true)
+	if text, _ := sel.SelectedText(); string(text) != "thEEree" {
+		t.Errorf("selected %q", text)
+	}
+
+	// Selecting backwards gives the same ordered range.
+	sel.SeekByte(3)
+	if s, e, ok := sel.SelectionRange(); !ok || s != 3 || e != 11 {
+		t.Errorf("backwards range [%d, %d) %v", s, e, ok)
+	}
+	sel.SeekByte(18)
+	afterEdits := g.CurrentRevision()
+
+	if _, _, err := sel.ReplaceSelection([]byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, g); got != ">> one two 3 four" {
+		t.Errorf("content %q", got)
+	}
+	if _, ok := sel.Anchor(); ok || sel.BytePos() != 12 {
+		t.Errorf("after replace: anchor kept %v, cursor at %d", ok, sel.BytePos())
+	}
+
+	g.UndoSeek(afterEdits)
+	if s, e, ok := sel.SelectionRange(); !ok || s != 11 || e != 18 {
+		t.Errorf("undo replace: range [%d, %d) %v", s, e, ok)
+	}
+	g.UndoSeek(start0)
+	if text, _ := sel.SelectedText(); string(text) != "three" {
+		t.Errorf("undo to start: selected %q", text)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestSelectionRollbackAndDelete(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "abcdefghij"})
+	defer g.Close()
+
+	sel := g.NewCursor()
+	sel.SeekByte(2)
+	sel.SetAnchor()
+	sel.SeekByte(6)
+
+	g.TransactionStart("t")
+	sel.ClearAnchor()
+	other := g.NewCursor()
+	other.InsertString("123", nil, true)
+	g.TransactionRollback()
+	if s, e, ok := sel.SelectionRange(); !ok || s != 2 || e != 6 {
+		t.Errorf("after rollback: [%d, %d) %v", s, e, ok)
+	}
+
+	// Deleting across the anchor collapses it to the deletion point.
+	other.SeekByte(1)
+	other.DeleteBytes(3, false)
+	if a, ok := sel.Anchor(); !ok || a != 1 {
+		t.Errorf("anchor at %d %v, want 1", a, ok)
+	}
+	if text, _ := sel.SelectedText(); string(text) != "ef" {
+		t.Errorf("selected %q", text)
+	}
+	sel.ClearAnchor()
+	if _, err := sel.SelectedText(); err != ErrNoSelection {
+		t.Errorf("cleared: err = %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package garland
+
+import "encoding/json"
+
+// cursor_state.go - cursor serialization.
+//
+// DESIGN: sessions reopen files with the carets where they were, and a
+// cursor handed to another process (a helper, a peer) should arrive
+// with its selection and settings. MarshalState captures one cursor as
+// a small versioned JSON document; RestoreCursor creates a new cursor
+// from it:
+//
+//	{
+//	  "format": "garland-cursor",
+//	  "version": 1,
+//	  "name": "alice",
+//	  "byte": 1042, "line": 37, "lineRune": 12,
+//	  "anchor": 990,
+//	  "restrict": [900, 1200],
+//	  "virtualSpace": true,
+//	  "mode": "process",
+//	  "documentBytes": 52110
+//	}
+//
+//   - The byte position is authoritative; line and lineRune are there
+//     for readers that think in lines. The document may have changed
+//     since: a position or anchor past the end is clamped, and the
+//     CursorRestoreReport says so (and whether the length differs from
+//     capture time, the cheap sign that the text moved under it).
+//   - Configuration travels too: the name, history tracking (an
+//     ephemeral cursor stays ephemeral), mode, seek policy, restriction,
+//     pin, and virtual space with its columns. The virtual columns are kept only when the cursor
+//     still lands at a line end.
+//   - Position history is not captured: it names revisions of this
+//     session only.
+//   - Format and version checks follow the JSON decoration dump: other
+//     formats and newer versions are refused with ErrCursorStateFormat,
+//     unknown members are ignored.
+
+// cursorStateFormat identifies a serialized cursor.
+const cursorStateFormat = "garland-cursor"
+
+// CursorStateVersion is the version MarshalState writes and the newest
+// RestoreCursor reads.
+const CursorStateVersion = 1
+
+// CursorState is the JSON document of a serialized cursor.
+type CursorState struct {
+	Format        string  `json:"format"`
+	Version       int     `json:"version"`
+	Name          string  `json:"name,omitempty"`
+	Byte          int64   `json:"byte"`
+	Line          int64   `json:"line"`
+	LineRune      int64   `json:"lineRune"`
+	Anchor        *int64  `json:"anchor,omitempty"`
+	Restrict      []int64 `json:"restrict,omitempty"` // [start, end]
+	VirtualSpace  bool    `json:"virtualSpace,omitempty"`
+	VirtualColumn int64   `json:"virtualColumn,omitempty"`
+	Ephemeral     bool    `json:"ephemeral,omitempty"`
+	Mode          string  `json:"mode,omitempty"`       // "" (human) or "process"
+	SeekPolicy    string  `json:"seekPolicy,omitempty"` // "", "clampToEOF" or "clampToLineEnd"
+	Pin           string  `json:"pin,omitempty"`        // "", "end" or "line"
+	DocumentBytes int64   `json:"documentBytes"`
+}
+
+// seekPolicyNames are the serialized names of the seek policies.
+var seekPolicyNames = map[string]SeekPolicy{
+	"":               SeekPolicyError,
+	"clampToEOF":     SeekPolicyClampToEOF,
+	"clampToLineEnd": SeekPolicyClampToLineEnd,
+}
+
+// pinModeNames are the serialized names of the pin modes.
+var pinModeNames = map[string]PinMode{
+	"":     PinNone,
+	"end":  PinToEnd,
+	"line": PinToLine,
+}
+
+// CursorRestoreReport describes how RestoreCursor placed a cursor.
+type CursorRestoreReport struct {
+	Clamped         bool // position or anchor lay past the end and was clamped
+	DocumentChanged bool // document length differs from capture time
+}
+
+// MarshalState returns the cursor's position and configuration as a
+// JSON document (see CursorState).
+func (c *Cursor) MarshalState() ([]byte, error) {
+	if c.detached() {
+		return nil, ErrCursorNotFound
+	}
+	g := c.garland
+	g.mu.Lock()
+	state := c.stateLocked()
+	g.mu.Unlock()
+	return json.MarshalIndent(state, "", "  ")
+}
+
+// stateLocked captures the cursor as a CursorState. Caller must hold
+// the write lock.
+func (c *Cursor) stateLocked() CursorState {
+	g := c.garland
+	g.ensureCountsLocked()
+	c.resolveStaleLineRuneLocked()
+	state := CursorState{
+		Format:        cursorStateFormat,
+		Version:       CursorStateVersion,
+		Name:          c.name,
+		Byte:          c.bytePos,
+		Line:          c.line,
+		LineRune:      c.lineRune,
+		VirtualSpace:  c.virtualSpace,
+		VirtualColumn: c.virtualCol,
+		Ephemeral:     !c.tracksHistory,
+		DocumentBytes: g.totalBytes,
+	}
+	if c.anchor != nil {
+		anchor := c.anchor.pos
+		state.Anchor = &anchor
+	}
+	if c.restrict != nil {
+		start, end := c.restrict.boundsLocked()
+		state.Restrict = []int64{start, end}
+	}
+	if c.mode == CursorModeProcess {
+		state.Mode = "process"
+	}
+	for name, p := range seekPolicyNames {
+		if p == c.seekPolicy {
+			state.SeekPolicy = name
+		}
+	}
+	for name, p := range pinModeNames {
+		if p == c.pin {
+			state.Pin = name
+		}
+	}
+	return state
+}
+
+// parseCursorState validates a serialized cursor.
+func parseCursorState(data []byte) (CursorState, error) {
+	var state CursorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return CursorState{}, ErrCursorStateFormat
+	}
+	if state.Format != cursorStateFormat || state.Version < 1 || state.Version > CursorStateVersion {
+		return CursorState{}, ErrCursorStateFormat
+	}
+	if state.Restrict != nil && (len(state.Restrict) != 2 || state.Restrict[0] < 0 || state.Restrict[1] < state.Restrict[0]) {
+		return CursorState{}, ErrCursorStateFormat
+	}
+	if state.Byte < 0 || (state.Anchor != nil && *state.Anchor < 0) || state.VirtualColumn < 0 ||
+		(state.Mode != "" && state.Mode != "process") {
+		return CursorState{}, ErrCursorStateFormat
+	}
+	if _, ok := pinModeNames[state.Pin]; !ok {
+		return CursorState{}, ErrCursorStateFormat
+	}
+	if _, ok := seekPolicyNames[state.SeekPolicy]; !ok {
+		return CursorState{}, ErrCursorStateFormat
+	}
+	return state, nil
+}
+
+// RestoreCursor creates a cursor from a MarshalState document, clamping
+// positions the document no longer reaches.
+func (g *Garland) RestoreCursor(data []byte) (*Cursor, CursorRestoreReport, error) {
+	state, err := parseCursorState(data)
+	if err != nil {
+		return nil, CursorRestoreReport{}, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := newCursor(g, !state.Ephemeral)
+	c.name = state.Name
+	report := CursorRestoreReport{DocumentChanged: state.DocumentBytes != g.totalBytes}
+	clamp := func(pos int64) int64 {
+		if pos > g.totalBytes {
+			report.Clamped = true
+			return g.totalBytes
+		}
+		return pos
+	}
+
+	pos := clamp(state.Byte)
+	runePos, err := g.byteToRuneInternalUnlocked(pos)
+	if err != nil {
+		return nil, CursorRestoreReport{}, err
+	}
+	line, lineRune, err := g.byteToLineRuneInternalUnlocked(pos)
+	if err != nil {
+		return nil, CursorRestoreReport{}, err
+	}
+	c.updatePosition(pos, runePos, line, lineRune)
+
+	if state.Anchor != nil {
+		c.anchor = &ephemeralMark{pos: clamp(*state.Anchor)}
+	}
+	if state.Restrict != nil {
+		g.restrictLocked(c, clamp(state.Restrict[0]), clamp(state.Restrict[1]))
+	}
+	if state.Mode == "process" {
+		c.mode = CursorModeProcess
+	}
+	c.seekPolicy = seekPolicyNames[state.SeekPolicy]
+	c.pin = pinModeNames[state.Pin]
+	c.virtualSpace = state.VirtualSpace
+	if state.VirtualSpace && state.VirtualColumn > 0 {
+		next, err := g.readThawingLocked(pos, 1)
+		if err != nil {
+			return nil, CursorRestoreReport{}, err
+		}
+		if len(next) == 0 || next[0] == '\n' {
+			c.virtualCol = state.VirtualColumn
+		}
+	}
+
+	if c.tracksHistory {
+		// newCursor recorded position 0 for this revision.
+		c.positionHistory[ForkRevision{g.currentFork, g.currentRevision}] = c.snapshotPosition()
+	}
+
+	// Register only once fully placed: edits never see a half-restored
+	// cursor, and a failure leaves nothing behind.
+	g.cursors = append(g.cursors[:len(g.cursors):len(g.cursors)], c) // copy-on-write
+	g.cursorOrder = append(g.cursorOrder, c)
+	g.updateCursorReady(c)
+	return c, report, nil
+}
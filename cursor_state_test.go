@@ -0,0 +1,79 @@
+package garland
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCursorStateRoundTrip(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "first line\nsecond\nthird line"})
+	defer g.Close()
+
+	c := g.NewEphemeralCursor()
+	c.SetMode(CursorModeProcess)
+	c.SetVirtualSpace(true)
+	c.SeekLine(1, 3)
+	c.SetAnchor()
+	c.SeekLine(1, 9)
+	data, err := c.MarshalState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, report, err := g.RestoreCursor(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Clamped || report.DocumentChanged {
+		t.Errorf("report %+v", report)
+	}
+	line, col := r.VirtualLinePos()
+	start, end, _ := r.SelectionRange()
+	if line != 1 || col != 9 || start != 14 || end != 17 || r.TracksHistory() || r.Mode() != CursorModeProcess || !r.VirtualSpace() {
+		t.Errorf("restored %d:%d [%d, %d) tracks=%v mode=%v virtual=%v",
+			line, col, start, end, r.TracksHistory(), r.Mode(), r.VirtualSpace())
+	}
+
+	// The restored cursor is registered: edits move it.
+	g.NewCursor().InsertString(">", nil, true)
+	if r.BytePos() != 18 {
+		t.Errorf("after edit at %d, want 18", r.BytePos())
+	}
+}
+
+func TestRestoreCursorClampsToChangedDocument(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("x", 100)})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekByte(80)
+	c.SetAnchor()
+	c.SeekByte(95)
+	data, _ := c.MarshalState()
+
+	other, _ := lib.Open(FileOptions{DataString: strings.Repeat("y", 90)})
+	defer other.Close()
+	r, report, err := other.RestoreCursor(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Clamped || !report.DocumentChanged || r.BytePos() != 90 {
+		t.Errorf("report %+v, at %d", report, r.BytePos())
+	}
+	if a, _ := r.Anchor(); a != 80 {
+		t.Errorf("anchor %d", a)
+	}
+
+	for _, bad := range []string{
+		`{"format":"garland-cursor","version":2,"byte":1}`,
+		`{"format":"garland-decorations","version":1,"byte":1}`,
+		`{"format":"garland-cursor","version":1,"byte":-4}`,
+		`not json`,
+	} {
+		if _, _, err := other.RestoreCursor([]byte(bad)); err != ErrCursorStateFormat {
+			t.Errorf("%s: err = %v", bad, err)
+		}
+	}
+}
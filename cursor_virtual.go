@@ -0,0 +1,109 @@
+package garland
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// cursor_virtual.go - virtual space past the end of a line.
+//
+// DESIGN: block editing and some terminal editors let the caret sit at
+// any column, even past the end of a short line, and only make the
+// gap real when something is typed there. In virtual-space mode a
+// cursor may do that: it stands at the line's end (its byte position
+// is real) and carries the number of further columns it sits beyond.
+//
+//   - Opt-in per cursor (SetVirtualSpace). Without it a column past the
+//     line's end migrates into the next line, as SeekLine documents.
+//   - SeekLine to a column past the line's end, and SeekLineDelta
+//     aiming at a goal column a shorter line lacks, leave the cursor in
+//     virtual space. Every other move leaves it (the virtual columns
+//     drop to zero), as does an undo or rollback restoring the cursor.
+//   - InsertBytes / InsertString there first pad with spaces, in the
+//     same edit (one revision); relative decorations are shifted past
+//     the padding. Other edits act at the real position.
+//   - Edits elsewhere shift the real position as usual and keep the
+//     virtual columns.
+
+// SetVirtualSpace turns virtual-space mode on or off for this cursor.
+// Turning it off brings the cursor back to the real line end.
+func (c *Cursor) SetVirtualSpace(on bool) {
+	if c.garland == nil {
+		c.virtualSpace, c.virtualCol = on, 0
+		return
+	}
+	c.garland.mu.Lock()
+	defer c.garland.mu.Unlock()
+	c.virtualSpace = on
+	if !on {
+		c.virtualCol = 0
+	}
+}
+
+// VirtualSpace reports whether virtual-space mode is on.
+func (c *Cursor) VirtualSpace() bool {
+	if c.garland == nil {
+		return c.virtualSpace
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	return c.virtualSpace
+}
+
+// VirtualColumn returns how many columns past the end of its line the
+// cursor sits (0 when it is on real content).
+func (c *Cursor) VirtualColumn() int64 {
+	if c.garland == nil {
+		return c.virtualCol
+	}
+	c.garland.mu.RLock()
+	defer c.garland.mu.RUnlock()
+	return c.virtualCol
+}
+
+// VirtualLinePos is LinePos counting the virtual columns: the column
+// the cursor appears at.
+func (c *Cursor) VirtualLinePos() (line, col int64) {
+	line, col = c.LinePos()
+	return line, col + c.VirtualColumn()
+}
+
+// virtualPad returns the spaces an insert at the cursor must start
+// with, and decs shifted past them.
+func (c *Cursor) virtualPad(decs []RelativeDecoration) (string, []RelativeDecoration) {
+	pad := c.VirtualColumn()
+	if pad == 0 {
+		return "", decs
+	}
+	shifted := make([]RelativeDecoration, len(decs))
+	for i, d := range decs {
+		d.Position += pad
+		shifted[i] = d
+	}
+	return strings.Repeat(" ", int(pad)), shifted
+}
+
+// seekVirtualLocked places c at runeInLine of line when that column
+// lies past the line's end, reporting whether it did. Caller must hold
+// the write lock.
+func (g *Garland) seekVirtualLocked(c *Cursor, line, runeInLine int64) (bool, error) {
+	if line < 0 || line > g.totalLines {
+		return false, nil // the regular path reports the error
+	}
+	start, text, err := g.lineTextLocked(line)
+	if err != nil {
+		return false, err
+	}
+	runes := int64(utf8.RuneCount(text))
+	if runeInLine <= runes {
+		return false, nil
+	}
+	pos := start + int64(len(text))
+	runePos, err := g.byteToRuneInternalUnlocked(pos)
+	if err != nil {
+		return false, err
+	}
+	c.updatePosition(pos, runePos, line, runes)
+	c.virtualCol = runeInLine - runes
+	return true, nil
+}
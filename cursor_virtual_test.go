@@ -0,0 +1,64 @@
+package garland
+
+import "testing"
+
+func TestVirtualSpaceSeekAndPad(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "long line here\nab\nxyz"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekLine(1, 6) // without virtual space: migrates into line 2
+	if line, col := c.LinePos(); line != 2 || col != 3 {
+		t.Errorf("plain seek at %d:%d", line, col)
+	}
+
+	c.SetVirtualSpace(true)
+	c.SeekLine(1, 6)
+	if line, col := c.VirtualLinePos(); line != 1 || col != 6 || c.BytePos() != 17 || c.VirtualColumn() != 4 {
+		t.Errorf("virtual seek at %d:%d byte %d", line, col, c.BytePos())
+	}
+	res, _ := c.InsertString("#", []RelativeDecoration{{Key: "hash", Position: 0}}, false)
+	if got := readAll(t, g); got != "long line here\nab    #\nxyz" {
+		t.Errorf("content %q", got)
+	}
+	if res.Revision != 1 || c.VirtualColumn() != 0 || c.BytePos() != 22 {
+		t.Errorf("revision %d, virtual %d, byte %d", res.Revision, c.VirtualColumn(), c.BytePos())
+	}
+	if pos := decorationAt(t, g, "hash"); pos != 21 {
+		t.Errorf("decoration at %d, want 21", pos)
+	}
+
+	c.SeekLine(2, 5)
+	c.SeekRelativeBytes(0) // any other move leaves virtual space
+	if c.VirtualColumn() != 0 {
+		t.Errorf("virtual column %d kept after a seek", c.VirtualColumn())
+	}
+}
+
+func TestVirtualSpaceVerticalMotion(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "0123456789\n\n0123"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SetVirtualSpace(true)
+	c.SeekLine(0, 8)
+	c.SeekLineDelta(1)
+	if line, col := c.VirtualLinePos(); line != 1 || col != 8 || c.VirtualColumn() != 8 {
+		t.Errorf("at %d:%d (virtual %d)", line, col, c.VirtualColumn())
+	}
+	c.SeekLineDelta(1)
+	if line, col := c.LinePos(); line != 2 || col != 4 || c.VirtualColumn() != 4 {
+		t.Errorf("at %d:%d (virtual %d)", line, col, c.VirtualColumn())
+	}
+
+	c.SetVirtualSpace(false)
+	if c.VirtualColumn() != 0 {
+		t.Errorf("mode off kept %d virtual columns", c.VirtualColumn())
+	}
+	c.InsertString("!", nil, false)
+	if got := readAll(t, g); got != "0123456789\n\n0123!" {
+		t.Errorf("content %q", got)
+	}
+}
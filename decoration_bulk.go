@@ -0,0 +1,181 @@
+package garland
+
+import "sort"
+
+// decoration_bulk.go - batch decoration placement.
+//
+// DESIGN: placing a mark rewrites its leaf and the path above it, so a
+// Decorate batch of N additions used to cost N leaf rewrites and N
+// root-to-leaf rebuilds - plus, per key, a lookup to remove any older
+// instance elsewhere. Attaching 100k syntax or diagnostic marks that
+// way is quadratic in practice. Decorate now hands any batch of two or
+// more additions to decorateBulkLocked, which:
+//
+//   - sorts the placements by byte and routes them down the tree the
+//     way findLeafByByte would (a position on a leaf boundary belongs
+//     to the right-hand leaf; EOF to the last leaf), so each affected
+//     leaf is rewritten ONCE and each internal node on the way rebuilt
+//     once;
+//   - removes older instances of the placed keys, and the batch's
+//     deletions, in the same walk. Only keys that can exist are looked
+//     for: outside a transaction a key absent from the location cache
+//     was never placed, so a batch of fresh keys never searches at
+//     all. Subtrees without marks (decorationCount 0) are not entered
+//     for removal;
+//   - keeps Decorate's semantics: one revision, deletions before
+//     additions, the last placement of a key in the batch wins.
+//
+// Cost is O(K log K + L log n) for K placements landing in L leaves,
+// plus one pass over the leaves holding marks when older instances
+// may need removing.
+
+// decorationPlacement is one addition or update in a Decorate batch.
+type decorationPlacement struct {
+	key     string
+	bytePos int64
+	gravity Gravity
+}
+
+// decorateBulkLocked applies a batch of deletions and placements in a
+// single walk of the tree. Caller must hold the write lock and record
+// the mutation afterwards.
+func (g *Garland) decorateBulkLocked(deletions []string, additions []decorationPlacement) error {
+	// Last placement of a key wins.
+	last := make(map[string]int, len(additions))
+	for i, a := range additions {
+		last[a.key] = i
+	}
+	adds := make([]decorationPlacement, 0, len(last))
+	for i, a := range additions {
+		if last[a.key] == i {
+			adds = append(adds, a)
+		}
+	}
+	sort.SliceStable(adds, func(i, j int) bool { return adds[i].bytePos < adds[j].bytePos })
+
+	// Keys whose current instance must go, wherever it lives. Mid-
+	// transaction the cache lags the tree, so every placed key might
+	// already exist.
+	inTransaction := g.transaction != nil && g.transaction.hasMutations
+	remove := make(map[string]bool, len(deletions))
+	for _, key := range deletions {
+		remove[key] = true
+	}
+	for _, a := range adds {
+		if _, known := g.decorationCache[a.key]; known || inTransaction {
+			remove[a.key] = true
+		}
+	}
+
+	rootSnap := g.root.snapshotAt(g.currentFork, g.currentRevision)
+	if rootSnap == nil {
+		return ErrInvalidPosition
+	}
+	removed := make(map[string]bool)
+	newRootID, changed, err := g.decorateBulkInternal(g.root, rootSnap, 0, adds, remove, removed)
+	if err != nil {
+		return err
+	}
+	if changed {
+		g.root = g.nodeRegistry[newRootID]
+	}
+	for key := range removed {
+		g.pendingDecorationDeletes = append(g.pendingDecorationDeletes, key)
+	}
+	return nil
+}
+
+// decorateBulkInternal rewrites the subtree at offset: marks in remove
+// are dropped (and noted in removed), adds - sorted, absolute, all
+// routed to this subtree - are placed. Returns the new node ID and
+// whether anything changed.
+func (g *Garland) decorateBulkInternal(node *Node, snap *NodeSnapshot, offset int64, adds []decorationPlacement, remove, removed map[string]bool) (NodeID, bool, error) {
+	if snap.isLeaf {
+		// Thaw first: a chilled leaf's marks live in its side block.
+		if err := g.ensureLeafDataResident(node, snap); err != nil {
+			return 0, false, err
+		}
+		var placedHere map[string]bool
+		if len(adds) > 0 {
+			placedHere = make(map[string]bool, len(adds))
+			for _, a := range adds {
+				placedHere[a.key] = true
+			}
+		}
+		newDecs := make([]Decoration, 0, len(snap.decorations)+len(adds))
+		dropped := false
+		for _, d := range snap.decorations {
+			switch {
+			case remove[d.Key]:
+				removed[d.Key] = true
+				dropped = true
+			case placedHere[d.Key]:
+				dropped = true // updated in place below
+			default:
+				newDecs = append(newDecs, d)
+			}
+		}
+		if !dropped && len(adds) == 0 {
+			return node.id, false, nil
+		}
+		for _, a := range adds {
+			newDecs = append(newDecs, Decoration{Key: a.key, Position: a.bytePos - offset, Gravity: a.gravity})
+		}
+
+		g.nextNodeID++
+		newLeaf := newNode(g.nextNodeID, g)
+		g.nodeRegistry[newLeaf.id] = newLeaf
+		newLeaf.setSnapshot(g.currentFork, g.currentRevision, createLeafSnapshot(snap.data, newDecs, snap.originalFileOffset))
+
+		for _, a := range adds {
+			g.indexDecorationNamespaceLocked(a.key)
+			g.pendingDecorationUpdates = append(g.pendingDecorationUpdates, pendingDecorationUpdate{
+				Key:    a.key,
+				NodeID: newLeaf.id,
+				Offset: offset,
+			})
+		}
+		return newLeaf.id, true, nil
+	}
+
+	leftNode := g.nodeRegistry[snap.leftID]
+	rightNode := g.nodeRegistry[snap.rightID]
+	if leftNode == nil || rightNode == nil {
+		return 0, false, ErrInvalidPosition
+	}
+	leftSnap := leftNode.snapshotAt(g.currentFork, g.currentRevision)
+	rightSnap := rightNode.snapshotAt(g.currentFork, g.currentRevision)
+	if leftSnap == nil || rightSnap == nil {
+		return 0, false, ErrInvalidPosition
+	}
+
+	// Same routing as findLeafByByteInternal: pos < left's bytes goes left.
+	split := offset + leftSnap.byteCount
+	cut := sort.Search(len(adds), func(i int) bool { return adds[i].bytePos >= split })
+
+	newLeftID, leftChanged := snap.leftID, false
+	if cut > 0 || len(remove) > 0 && leftSnap.decorationCount > 0 {
+		var err error
+		newLeftID, leftChanged, err = g.decorateBulkInternal(leftNode, leftSnap, offset, adds[:cut], remove, removed)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	newRightID, rightChanged := snap.rightID, false
+	if cut < len(adds) || len(remove) > 0 && rightSnap.decorationCount > 0 {
+		var err error
+		newRightID, rightChanged, err = g.decorateBulkInternal(rightNode, rightSnap, split, adds[cut:], remove, removed)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	if !leftChanged && !rightChanged {
+		return node.id, false, nil
+	}
+	newID, err := g.concatenate(newLeftID, newRightID)
+	if err != nil {
+		return 0, false, err
+	}
+	return newID, true, nil
+}
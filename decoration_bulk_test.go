@@ -0,0 +1,121 @@
+package garland
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDecorateBulkRewritesEachLeafOnce(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("word ", 4000), MaxLeafSize: 128})
+	defer g.Close()
+
+	// A mark on every word, in reverse order, plus one at EOF.
+	var entries []DecorationEntry
+	for pos := int64(19995); pos >= 0; pos -= 5 {
+		addr := ByteAddress(pos)
+		entries = append(entries, DecorationEntry{Key: fmt.Sprintf("w%d", pos), Namespace: "syntax", Address: &addr})
+	}
+	eof := ByteAddress(20000)
+	entries = append(entries, DecorationEntry{Key: "eof", Address: &eof})
+
+	var countLeaves func(*TreeNodeInfo) int64
+	countLeaves = func(n *TreeNodeInfo) int64 {
+		if n.IsLeaf {
+			return 1
+		}
+		var sum int64
+		for _, c := range n.Children {
+			sum += countLeaves(c)
+		}
+		return sum
+	}
+	leaves := countLeaves(g.GetTreeInfo())
+
+	g.mu.RLock()
+	before := g.nextNodeID
+	g.mu.RUnlock()
+	rev := g.CurrentRevision()
+	if _, err := g.Decorate(entries); err != nil {
+		t.Fatal(err)
+	}
+	g.mu.RLock()
+	created := g.nextNodeID - before
+	g.mu.RUnlock()
+
+	// Every leaf holds marks: one new node per leaf plus one per
+	// internal node above them - not one path rebuild per mark.
+	if int64(created) > 2*leaves {
+		t.Errorf("batch of %d marks created %d nodes for %d leaves", len(entries), created, leaves)
+	}
+	if g.CurrentRevision() != rev+1 {
+		t.Errorf("batch took %d revisions", g.CurrentRevision()-rev)
+	}
+	for _, pos := range []int64{0, 125, 130, 19995} {
+		addr, err := g.GetDecorationPositionIn("syntax", fmt.Sprintf("w%d", pos))
+		if err != nil || addr.Byte != pos {
+			t.Errorf("w%d at %+v, %v", pos, addr, err)
+		}
+	}
+	if got := decorationAt(t, g, "eof"); got != 20000 {
+		t.Errorf("eof at %d", got)
+	}
+	all, _ := g.GetDecorationsInByteRange(0, 20001)
+	if len(all) != len(entries) {
+		t.Errorf("%d marks in the buffer, want %d", len(all), len(entries))
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestDecorateBulkUpdatesAndDeletes(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("0123456789", 20), MaxLeafSize: 16})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	g.Decorate([]DecorationEntry{{Key: "a", Address: at(5)}, {Key: "b", Address: at(100)}, {Key: "c", Address: at(150)}})
+
+	// Move a across leaves, delete b, place d twice (last wins).
+	g.Decorate([]DecorationEntry{
+		{Key: "a", Address: at(180)},
+		{Key: "b"},
+		{Key: "d", Address: at(10)},
+		{Key: "d", Address: at(60)},
+	})
+	all, _ := g.GetDecorationsInByteRange(0, 201)
+	if len(all) != 3 {
+		t.Fatalf("marks %+v, want a, c, d once each", all)
+	}
+	for key, want := range map[string]int64{"a": 180, "c": 150, "d": 60} {
+		if got := decorationAt(t, g, key); got != want {
+			t.Errorf("%s at %d, want %d", key, got, want)
+		}
+	}
+	if _, err := g.GetDecorationPosition("b"); err != ErrDecorationNotFound {
+		t.Errorf("b still present: %v", err)
+	}
+
+	// Inside a transaction the cache lags the tree; the batch still
+	// finds the key the transaction placed and moves it.
+	g.TransactionStart("bulk")
+	g.Decorate([]DecorationEntry{{Key: "e", Address: at(20)}})
+	g.Decorate([]DecorationEntry{{Key: "e", Address: at(120)}, {Key: "f", Address: at(121)}})
+	g.TransactionCommit()
+	if got := decorationAt(t, g, "e"); got != 120 {
+		t.Errorf("e at %d, want 120", got)
+	}
+	if all, _ := g.GetDecorationsInByteRange(0, 201); len(all) != 5 {
+		t.Errorf("after the transaction: %+v", all)
+	}
+
+	g.UndoSeek(g.CurrentRevision() - 2)
+	if got := decorationAt(t, g, "a"); got != 5 {
+		t.Errorf("undo: a at %d, want 5", got)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
@@ -0,0 +1,45 @@
+package garland
+
+import "sort"
+
+// decoration_eof.go - end-of-document anchored decorations.
+//
+// DESIGN: a mark meant to live at the end of the document ("end of
+// buffer" marker, an append point for a log view) could be placed at
+// ByteAddress(ByteCount()), but that address is a snapshot: the next
+// append leaves a default-gravity mark behind. EOFAddress() names the
+// end itself.
+//
+//   - An EOFMode address resolves to the current byte count wherever
+//     addresses are accepted (Decorate, ephemeral marks).
+//   - A decoration placed at it is stored with GravityRight. That is
+//     all anchoring takes: an insert AT the mark - every append -
+//     slides it past the new content, a truncation ending at EOF pulls
+//     it back to the new end, and no edit can put content after it
+//     without inserting at it. The anchor therefore survives saves,
+//     cold storage, dumps and replay as an ordinary mark.
+//   - GetEOFDecorations lists the marks at the end right now (anchored
+//     or not; Gravity tells them apart).
+
+// anchoredGravity returns the gravity a placement stores: GravityRight
+// for an EOF-anchored address, the entry's own otherwise.
+func anchoredGravity(e DecorationEntry) Gravity {
+	if e.Address != nil && e.Address.Mode == EOFMode {
+		return GravityRight
+	}
+	return e.Gravity
+}
+
+// GetEOFDecorations returns the decorations at the end of the
+// document, ordered by key.
+func (g *Garland) GetEOFDecorations() ([]DecorationEntry, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var out []DecorationEntry
+	if rootSnap := g.root.snapshotAt(g.currentFork, g.currentRevision); rootSnap != nil {
+		g.collectDecorationsInRangeInternal(g.root, rootSnap, g.totalBytes, g.totalBytes+1, 0, &out)
+	}
+	sort.Slice(out, func(i, j int) bool { return decorationLess(out[i], out[j]) })
+	return out, nil
+}
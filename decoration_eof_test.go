@@ -0,0 +1,64 @@
+package garland
+
+import "testing"
+
+func TestEOFAnchoredDecorationStaysAtEnd(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "line one\nline two\n", MaxLeafSize: 8})
+	defer g.Close()
+
+	eof := EOFAddress()
+	plain := ByteAddress(18)
+	if _, err := g.Decorate([]DecorationEntry{
+		{Key: "end", Address: &eof, Gravity: GravityLeft}, // EOF wins over the asked gravity
+		{Key: "was-end", Address: &plain},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	g.SetEphemeralDecorations([]DecorationEntry{{Key: "tail", Address: &eof}})
+
+	check := func(step string) {
+		t.Helper()
+		n := g.ByteCount().Value
+		if got := decorationAt(t, g, "end"); got != n {
+			t.Errorf("%s: end at %d, want EOF %d", step, got, n)
+		}
+		if got := ephemeralAt(t, g, "tail"); got != n {
+			t.Errorf("%s: ephemeral tail at %d, want EOF %d", step, got, n)
+		}
+		if v := g.CheckInvariants(); v != nil {
+			t.Errorf("%s: %v", step, v)
+		}
+	}
+
+	c := g.NewCursor()
+	c.SeekByte(g.ByteCount().Value)
+	c.InsertString("line three\n", nil, false)
+	check("append")
+	if got := decorationAt(t, g, "was-end"); got != 18 {
+		t.Errorf("default-gravity mark followed the append to %d", got)
+	}
+
+	c.SeekByte(g.ByteCount().Value)
+	c.InsertString("more", nil, true)
+	check("append with insertBefore")
+
+	c.SeekByte(20)
+	c.DeleteBytes(g.ByteCount().Value-20, false)
+	check("truncate")
+
+	c.CopyBytes(0, 5, g.ByteCount().Value, g.ByteCount().Value, nil, false)
+	check("copy to end")
+	c.MoveBytes(0, 5, g.ByteCount().Value, g.ByteCount().Value, false)
+	check("move to end")
+
+	g.UndoSeek(g.CurrentRevision() - 4)
+	if got := decorationAt(t, g, "end"); got != g.ByteCount().Value {
+		t.Errorf("undo: end at %d, want %d", got, g.ByteCount().Value)
+	}
+
+	at, _ := g.GetEOFDecorations()
+	if len(at) != 1 || at[0].Key != "end" || at[0].Gravity != GravityRight {
+		t.Errorf("GetEOFDecorations = %+v", at)
+	}
+}
@@ -0,0 +1,239 @@
+package garland
+
+import "sort"
+
+// decoration_ephemeral.go - ephemeral decorations.
+//
+// DESIGN: search highlights, hover previews and a peer's caret change
+// many times a second and mean nothing a minute later. As ordinary
+// decorations each change would be a revision, an undo step, and a
+// node rewrite kept forever in history. Ephemeral decorations live
+// outside the tree instead, in a plain key -> position map on the
+// Garland, and follow edits the way cursors do.
+//
+//   - Setting or removing one never creates a revision, never enters
+//     the replay log, and is never captured by undo; ChangeResults are
+//     not involved. They are not saved, dumped, or chilled.
+//   - Every edit primitive maps them like a cursor: an insert at a
+//     mark follows the mark's Gravity (GravityDefault: the edit's
+//     insertBefore flag), a deleted range collapses the marks inside
+//     it to its start, and marks in a moved range travel with it.
+//     Moving around history (UndoSeek, ForkSeek) has no record to map
+//     through: marks keep their byte position, clamped to the content.
+//     A rolled-back transaction restores the positions it began with.
+//   - The key space - namespaces included - is separate from persistent
+//     decorations: the same key may name one of each.
+//   - Cost is one map walk per edit, so this is for the hundreds or
+//     thousands of marks a UI shows, not for 100k syntax spans (use
+//     Decorate for those).
+
+// ephemeralMark is an ephemeral decoration's position.
+type ephemeralMark struct {
+	pos     int64
+	gravity Gravity
+}
+
+// shiftEphemeralLocked maps ephemeral marks through an edit that
+// replaced [pos, pos+removed) with inserted bytes. Caller must hold
+// the write lock.
+func (g *Garland) shiftEphemeralLocked(pos, removed, inserted int64, insertBefore bool) {
+	end := pos + removed
+	g.forEachEphemeralMarkLocked(func(m *ephemeralMark) {
+		switch {
+		case m.pos > end || m.pos == end && removed > 0:
+			m.pos += inserted - removed
+		case m.pos > pos:
+			m.pos = pos
+		case m.pos == pos && removed == 0 && m.gravity.slides(insertBefore):
+			m.pos += inserted
+		}
+	})
+}
+
+// moveEphemeralLocked maps ephemeral marks through a move: marks in
+// [srcStart, srcEnd) travel with the content to finalDst, the rest
+// are mapped through the deletes and the insert in the order
+// moveBytesAt applies them. Caller must hold the write lock.
+func (g *Garland) moveEphemeralLocked(srcStart, srcEnd, dstStart, dstEnd, finalDst int64, insertBefore bool) {
+	if !g.hasEphemeralMarksLocked() {
+		return
+	}
+	srcLen, dstLen := srcEnd-srcStart, dstEnd-dstStart
+	travelling := make(map[*ephemeralMark]int64)
+	g.forEachEphemeralMarkLocked(func(m *ephemeralMark) {
+		if m.pos >= srcStart && m.pos < srcEnd {
+			travelling[m] = m.pos - srcStart
+		}
+	})
+	if srcStart < dstStart {
+		g.shiftEphemeralLocked(dstStart, dstLen, 0, false)
+		g.shiftEphemeralLocked(srcStart, srcLen, 0, false)
+	} else {
+		g.shiftEphemeralLocked(srcStart, srcLen, 0, false)
+		g.shiftEphemeralLocked(dstStart, dstLen, 0, false)
+	}
+	// The seam rule of moveBytesAt: marks collapsed there from after a
+	// deleted range slide past the landing content.
+	seam := insertBefore || dstLen > 0 || srcStart >= dstStart && srcStart == dstEnd
+	g.shiftEphemeralLocked(finalDst, 0, srcLen, seam)
+	for m, rel := range travelling {
+		m.pos = finalDst + rel
+	}
+}
+
+// clampEphemeralLocked keeps ephemeral marks inside the content after
+// a jump to another version. Caller must hold the write lock.
+func (g *Garland) clampEphemeralLocked() {
+	g.forEachEphemeralMarkLocked(func(m *ephemeralMark) {
+		if m.pos > g.totalBytes {
+			m.pos = g.totalBytes
+		}
+	})
+}
+
+// hasEphemeralMarksLocked reports whether forEachEphemeralMarkLocked
+// has anything to visit. Caller must hold the lock.
+func (g *Garland) hasEphemeralMarksLocked() bool {
+	if len(g.ephemeral) > 0 || len(g.diagnostics) > 0 {
+		return true
+	}
+	for _, c := range g.cursors {
+		if c.anchor != nil || c.restrict != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachEphemeralMarkLocked calls fn for every mark that follows edits
+// outside the tree: the ephemeral decorations, the ends of each
+// diagnostic's range, cursors' selection anchors and the ends of their
+// restrictions. fn may move them, so the diagnostic index is dropped.
+// Caller must hold the write lock.
+func (g *Garland) forEachEphemeralMarkLocked(fn func(m *ephemeralMark)) {
+	g.diagnosticIndex = nil
+	for _, m := range g.ephemeral {
+		fn(m)
+	}
+	for _, records := range g.diagnostics {
+		for _, r := range records {
+			fn(&r.start)
+			fn(&r.end)
+		}
+	}
+	for _, c := range g.cursors {
+		if c.anchor != nil {
+			fn(c.anchor)
+		}
+		if c.restrict != nil {
+			fn(&c.restrict.start)
+			fn(&c.restrict.end)
+		}
+	}
+}
+
+// snapshotEphemeralLocked copies the ephemeral positions (for a
+// transaction to restore on rollback). Caller must hold the lock.
+func (g *Garland) snapshotEphemeralLocked() map[*ephemeralMark]ephemeralMark {
+	if !g.hasEphemeralMarksLocked() {
+		return nil
+	}
+	saved := make(map[*ephemeralMark]ephemeralMark)
+	g.forEachEphemeralMarkLocked(func(m *ephemeralMark) {
+		saved[m] = *m
+	})
+	return saved
+}
+
+// restoreEphemeralLocked puts back positions saved by
+// snapshotEphemeralLocked. Marks set since keep their (clamped)
+// positions. Caller must hold the write lock.
+func (g *Garland) restoreEphemeralLocked(saved map[*ephemeralMark]ephemeralMark) {
+	for m, was := range saved {
+		*m = was
+	}
+	g.clampEphemeralLocked()
+}
+
+// SetEphemeralDecorations adds, moves, or removes (nil Address)
+// ephemeral decorations. It never creates a revision.
+func (g *Garland) SetEphemeralDecorations(entries []DecorationEntry) error {
+	for _, e := range entries {
+		if !ValidDecorationKey(e.Key) || (e.Namespace != "" && !ValidDecorationKey(e.Namespace)) {
+			return ErrInvalidDecorationKey
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Resolve every address first: a bad entry changes nothing.
+	positions := make([]int64, len(entries))
+	for i, e := range entries {
+		if e.Address == nil {
+			continue
+		}
+		pos, err := g.addressToByteUnlocked(e.Address)
+		if err != nil {
+			return err
+		}
+		positions[i] = pos
+	}
+	if g.ephemeral == nil {
+		g.ephemeral = make(map[string]*ephemeralMark)
+	}
+	for i, e := range entries {
+		key := namespacedKey(e.Namespace, e.Key)
+		if e.Address == nil {
+			delete(g.ephemeral, key)
+		} else {
+			g.ephemeral[key] = &ephemeralMark{pos: positions[i], gravity: anchoredGravity(e)}
+		}
+	}
+	return nil
+}
+
+// GetEphemeralDecorationPosition returns the position of ephemeral
+// decoration key in namespace ns ("" for the plain key space).
+func (g *Garland) GetEphemeralDecorationPosition(ns, key string) (AbsoluteAddress, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	m := g.ephemeral[namespacedKey(ns, key)]
+	if m == nil {
+		return AbsoluteAddress{}, ErrDecorationNotFound
+	}
+	return ByteAddress(m.pos), nil
+}
+
+// GetEphemeralDecorationsInByteRange returns the ephemeral decorations
+// in [start, end), in document order.
+func (g *Garland) GetEphemeralDecorationsInByteRange(start, end int64) ([]DecorationEntry, error) {
+	if start < 0 || end < start {
+		return nil, ErrInvalidPosition
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var out []DecorationEntry
+	for stored, m := range g.ephemeral {
+		if m.pos >= start && m.pos < end {
+			addr := ByteAddress(m.pos)
+			ns, key := splitNamespacedKey(stored)
+			out = append(out, DecorationEntry{Key: key, Namespace: ns, Address: &addr, Gravity: m.gravity})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return decorationLess(out[i], out[j]) })
+	return out, nil
+}
+
+// ClearEphemeralDecorations removes every ephemeral decoration in
+// namespace ns ("" for the plain key space).
+func (g *Garland) ClearEphemeralDecorations(ns string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for stored := range g.ephemeral {
+		if n, _ := splitNamespacedKey(stored); n == ns {
+			delete(g.ephemeral, stored)
+		}
+	}
+}
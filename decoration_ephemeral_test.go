@@ -0,0 +1,106 @@
+package garland
+
+import "testing"
+
+func ephemeralAt(t *testing.T, g *Garland, key string) int64 {
+	t.Helper()
+	addr, err := g.GetEphemeralDecorationPosition("", key)
+	if err != nil {
+		t.Fatalf("GetEphemeralDecorationPosition(%q): %v", key, err)
+	}
+	return addr.Byte
+}
+
+func TestEphemeralDecorationsFollowEditsWithoutRevisions(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "0123456789abcdef", MaxLeafSize: 4})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	version := g.CurrentVersion()
+	if err := g.SetEphemeralDecorations([]DecorationEntry{
+		{Key: "hit", Address: at(4)},
+		{Key: "sticky", Address: at(4), Gravity: GravityLeft},
+		{Key: "inside", Address: at(9)},
+		{Key: "tail", Address: at(14)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g.CurrentVersion() != version {
+		t.Errorf("setting ephemeral marks moved the version to %+v", g.CurrentVersion())
+	}
+
+	c := g.NewCursor()
+	c.SeekByte(4)
+	c.InsertString("XY", nil, true) // hit slides, sticky stays
+	c.SeekByte(10)
+	c.DeleteBytes(2, false) // "inside" (at 11) collapses to 10
+	for key, want := range map[string]int64{"hit": 6, "sticky": 4, "inside": 10, "tail": 14} {
+		if got := ephemeralAt(t, g, key); got != want {
+			t.Errorf("%s at %d, want %d", key, got, want)
+		}
+	}
+
+	// Moving [4, 8) to the end carries sticky and hit along.
+	c.MoveBytes(4, 8, 16, 16, false)
+	for key, want := range map[string]int64{"sticky": 12, "hit": 14, "inside": 6, "tail": 10} {
+		if got := ephemeralAt(t, g, key); got != want {
+			t.Errorf("after move: %s at %d, want %d", key, got, want)
+		}
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+
+	// Undo restores content, not ephemeral positions (clamped only).
+	g.UndoSeek(version.Revision)
+	if got := ephemeralAt(t, g, "hit"); got != 14 {
+		t.Errorf("after undo: hit at %d, want 14", got)
+	}
+	if _, err := g.GetDecorationPosition("hit"); err != ErrDecorationNotFound {
+		t.Errorf("ephemeral key visible as a persistent decoration: %v", err)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants after undo: %v", v)
+	}
+}
+
+func TestEphemeralDecorationsRollbackAndClear(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "hello world"})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	g.SetEphemeralDecorations([]DecorationEntry{
+		{Key: "w", Namespace: "search", Address: at(6)},
+		{Key: "h", Namespace: "search", Address: at(0)},
+		{Key: "peer", Address: at(11)},
+	})
+
+	g.TransactionStart("t")
+	c := g.NewCursor()
+	c.InsertString(">> ", nil, true)
+	if addr, _ := g.GetEphemeralDecorationPosition("search", "w"); addr.Byte != 9 {
+		t.Errorf("in transaction: w at %d, want 9", addr.Byte)
+	}
+	g.TransactionRollback()
+	if addr, _ := g.GetEphemeralDecorationPosition("search", "w"); addr.Byte != 6 {
+		t.Errorf("after rollback: w at %d, want 6", addr.Byte)
+	}
+
+	entries, _ := g.GetEphemeralDecorationsInByteRange(0, 12)
+	if len(entries) != 3 || entries[0].Key != "h" || entries[1].Key != "w" || entries[2].Key != "peer" {
+		t.Errorf("range query: %+v", entries)
+	}
+
+	g.ClearEphemeralDecorations("search")
+	if entries, _ := g.GetEphemeralDecorationsInByteRange(0, 12); len(entries) != 1 || entries[0].Key != "peer" {
+		t.Errorf("after clearing search: %+v", entries)
+	}
+	if err := g.SetEphemeralDecorations([]DecorationEntry{{Key: "ok", Address: at(1)}, {Key: "bad", Address: at(99)}}); err != ErrInvalidPosition {
+		t.Errorf("out of range: err = %v", err)
+	}
+	if _, err := g.GetEphemeralDecorationPosition("", "ok"); err != ErrDecorationNotFound {
+		t.Errorf("partial batch applied: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package garland
+
+import "testing"
+
+func decorationAt(t *testing.T, g *Garland, key string) int64 {
+	t.Helper()
+	addr, err := g.GetDecorationPosition(key)
+	if err != nil {
+		t.Fatalf("GetDecorationPosition(%q): %v", key, err)
+	}
+	return addr.Byte
+}
+
+func TestDecorationGravityOnInsert(t *testing.T) {
+	// Leaf size 4 puts position 8 on a leaf boundary; 64 keeps it mid-leaf.
+	for _, leaf := range []int64{4, 64} {
+		for _, before := range []bool{false, true} {
+			lib, _ := Init(LibraryOptions{})
+			g, _ := lib.Open(FileOptions{DataString: "0123456789abcdef", MaxLeafSize: leaf})
+			at := ByteAddress(8)
+			g.Decorate([]DecorationEntry{
+				{Key: "default", Address: &at},
+				{Key: "left", Address: &at, Gravity: GravityLeft},
+				{Key: "right", Address: &at, Gravity: GravityRight},
+			})
+
+			c := g.NewCursor()
+			c.SeekByte(8)
+			c.InsertString("XYZ", nil, before)
+
+			wantDefault := int64(8)
+			if before {
+				wantDefault = 11
+			}
+			for key, want := range map[string]int64{"default": wantDefault, "left": 8, "right": 11} {
+				if got := decorationAt(t, g, key); got != want {
+					t.Errorf("leaf %d, insertBefore %v: %s at %d, want %d", leaf, before, key, got, want)
+				}
+			}
+			if v := g.CheckInvariants(); v != nil {
+				t.Errorf("leaf %d, insertBefore %v: %v", leaf, before, v)
+			}
+			g.Close()
+		}
+	}
+}
+
+func TestDecorationGravitySurvivesDeleteMoveAndColdStorage(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "hello brave new world"})
+	defer g.Close()
+	at := ByteAddress(8)
+	g.Decorate([]DecorationEntry{{Key: "sticky", Address: &at, Gravity: GravityLeft}})
+
+	// Deleting "brave " collapses the mark to 6; it still sticks left.
+	c := g.NewCursor()
+	c.SeekByte(6)
+	decs, _, _ := c.DeleteBytes(6, false)
+	if len(decs) != 1 || decs[0].Gravity != GravityLeft {
+		t.Fatalf("deletion reported %+v", decs)
+	}
+	c.InsertString("bold ", nil, true)
+	if got := decorationAt(t, g, "sticky"); got != 6 {
+		t.Errorf("after insert at the collapsed mark: %d, want 6", got)
+	}
+
+	// Moving "bold " (mark included) to the end keeps the gravity.
+	c.MoveBytes(6, 11, g.ByteCount().Value, g.ByteCount().Value, false)
+	entries, _ := g.GetDecorationsInByteRange(0, g.ByteCount().Value+1)
+	if len(entries) != 1 || entries[0].Gravity != GravityLeft {
+		t.Errorf("after move: %+v", entries)
+	}
+
+	decoded, err := decodeDecorations(encodeDecorations([]Decoration{
+		{Key: "a", Position: 1}, {Key: "b", Position: 22, Gravity: GravityLeft}, {Key: "c", Position: 0, Gravity: GravityRight},
+	}))
+	if err != nil || len(decoded) != 3 || decoded[0].Gravity != GravityDefault ||
+		decoded[1] != (Decoration{Key: "b", Position: 22, Gravity: GravityLeft}) || decoded[2].Gravity != GravityRight {
+		t.Errorf("cold storage round trip: %+v, %v", decoded, err)
+	}
+	if _, err := decodeDecorations([]byte("a\x00L\n")); err == nil {
+		t.Error("a gravity suffix without a position decoded")
+	}
+}
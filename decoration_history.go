@@ -0,0 +1,122 @@
+package garland
+
+// decoration_history.go - decoration dumps of past revisions.
+//
+// DESIGN: every revision's decorations are still in the tree - a leaf
+// snapshot carries its marks, and history keeps the snapshots - so
+// "where were the marks at revision 12 of fork 3" is a read, not an
+// UndoSeek. The dump variants taking (fork, revision) resolve that
+// version's root and walk it under the live coordinates' lock, the way
+// SnapshotView borrows the read helpers: the live document, its
+// cursors and its position in history are untouched.
+//
+//   - The formats are the current-revision ones (INI, JSON); only the
+//     source version differs.
+//   - The walk visits only subtrees holding marks and thaws cold leaves,
+//     since old revisions are the likeliest to have been chilled.
+//   - A pruned revision (or one of a deleted fork) cannot be dumped:
+//     ErrRevisionNotFound / ErrForkNotFound.
+
+// decorationStateLocked resolves fork and rev to a tree version; the
+// live revision resolves to the live tree (even mid-transaction).
+// Caller must hold the lock.
+func (g *Garland) decorationStateLocked(fork ForkID, rev RevisionID) (treeState, error) {
+	if fork == g.currentFork && rev == g.currentRevision {
+		return g.liveStateLocked(), nil
+	}
+	if _, ok := g.forks[fork]; !ok {
+		return treeState{}, ErrForkNotFound
+	}
+	st, ok := g.stateAtLocked(fork, rev)
+	if !ok || st.rootSnap() == nil {
+		return treeState{}, ErrRevisionNotFound
+	}
+	return st, nil
+}
+
+// decorationsAtLocked returns every decoration of version st, in tree
+// order. Caller must hold the write lock (cold leaves are thawed).
+func (g *Garland) decorationsAtLocked(st treeState) ([]DecorationEntry, error) {
+	if st.rootSnap() == nil {
+		return nil, nil
+	}
+	var decorations []DecorationEntry
+	err := g.withStateLocked(st, func() error {
+		return g.collectAllDecorationsLocked(g.root, g.root.snapshotAt(g.currentFork, g.currentRevision), 0, &decorations)
+	})
+	return decorations, err
+}
+
+// collectAllDecorationsLocked appends the subtree's decorations,
+// skipping subtrees without marks. Caller must hold the write lock.
+func (g *Garland) collectAllDecorationsLocked(node *Node, snap *NodeSnapshot, offset int64, out *[]DecorationEntry) error {
+	if snap == nil || snap.decorationCount == 0 {
+		return nil
+	}
+	if snap.isLeaf {
+		if err := g.ensureLeafDataResident(node, snap); err != nil {
+			return err
+		}
+		for _, d := range snap.decorations {
+			addr := ByteAddress(offset + d.Position)
+			ns, key := splitNamespacedKey(d.Key)
+			*out = append(*out, DecorationEntry{Key: key, Namespace: ns, Address: &addr, Gravity: d.Gravity})
+		}
+		return nil
+	}
+	left, right := g.nodeRegistry[snap.leftID], g.nodeRegistry[snap.rightID]
+	if left == nil || right == nil {
+		return ErrInternal
+	}
+	leftSnap := left.snapshotAt(g.currentFork, g.currentRevision)
+	if err := g.collectAllDecorationsLocked(left, leftSnap, offset, out); err != nil {
+		return err
+	}
+	return g.collectAllDecorationsLocked(right, right.snapshotAt(g.currentFork, g.currentRevision), offset+leftSnap.byteCount, out)
+}
+
+// decorationsAt locks and returns the decorations of fork and rev.
+func (g *Garland) decorationsAt(fork ForkID, rev RevisionID) ([]DecorationEntry, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st, err := g.decorationStateLocked(fork, rev)
+	if err != nil {
+		return nil, err
+	}
+	return g.decorationsAtLocked(st)
+}
+
+// DumpDecorationsAt writes the decorations of revision rev of fork to
+// a file in the INI-like format of DumpDecorations. If fs is nil, uses
+// the Garland's source filesystem.
+func (g *Garland) DumpDecorationsAt(fs FileSystemInterface, path string, fork ForkID, rev RevisionID) error {
+	decorations, err := g.decorationsAt(fork, rev)
+	if err != nil {
+		return err
+	}
+	if fs == nil {
+		fs = g.sourceFS
+	}
+	return fs.WriteFile(path, formatDecorationsINI(decorations))
+}
+
+// MarshalDecorationsJSONAt returns the decorations of revision rev of
+// fork as a JSON document (see DecorationDump).
+func (g *Garland) MarshalDecorationsJSONAt(fork ForkID, rev RevisionID) ([]byte, error) {
+	decorations, err := g.decorationsAt(fork, rev)
+	if err != nil {
+		return nil, err
+	}
+	return marshalDecorationsJSON(decorations)
+}
+
+// DumpDecorationsJSONAt writes the decorations of revision rev of fork
+// to path as a JSON document. If fs is nil, uses the Garland's source
+// filesystem.
+func (g *Garland) DumpDecorationsJSONAt(fs FileSystemInterface, path string, fork ForkID, rev RevisionID) error {
+	data, err := g.MarshalDecorationsJSONAt(fork, rev)
+	if err != nil {
+		return err
+	}
+	return g.writeDecorationJSON(fs, path, data)
+}
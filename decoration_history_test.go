@@ -0,0 +1,79 @@
+package garland
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDumpDecorationsAtPastRevision(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("abcdefgh", 16), MaxLeafSize: 16})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	res, _ := g.Decorate([]DecorationEntry{
+		{Key: "m", Address: at(40)},
+		{Key: "b1", Namespace: "bookmarks", Address: at(100), Gravity: GravityLeft},
+	})
+	then := res.Revision
+
+	c := g.NewCursor()
+	c.InsertString(">>>>", nil, true)
+	g.Decorate([]DecorationEntry{{Key: "later", Address: at(0)}})
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatal(err)
+	}
+	liveRev := g.CurrentRevision()
+
+	dir := t.TempDir()
+	if err := g.DumpDecorationsAt(nil, dir+"/then.ini", g.CurrentFork(), then); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(dir + "/then.ini")
+	if !strings.Contains(string(raw), "[decorations]\nm=40\nbookmarks/b1=100\n") {
+		t.Errorf("INI dump at revision %d:\n%s", then, raw)
+	}
+
+	data, err := g.MarshalDecorationsJSONAt(g.CurrentFork(), then)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "later") || !strings.Contains(string(data), `"gravity": "left"`) {
+		t.Errorf("JSON dump at revision %d:\n%s", then, data)
+	}
+	if g.CurrentRevision() != liveRev || g.ByteCount().Value != 132 {
+		t.Errorf("dumping moved the live document to %d", g.CurrentRevision())
+	}
+	if got := decorationAt(t, g, "m"); got != 44 {
+		t.Errorf("live m at %d, want 44", got)
+	}
+
+	live, _ := g.MarshalDecorationsJSONAt(g.CurrentFork(), g.CurrentRevision())
+	current, _ := g.MarshalDecorationsJSON()
+	if string(live) != string(current) {
+		t.Errorf("live revision dump differs from MarshalDecorationsJSON")
+	}
+}
+
+func TestDumpDecorationsAtMissingVersion(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "hello"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.InsertString("a", nil, true)
+	c.InsertString("b", nil, true)
+	if err := g.Prune(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.MarshalDecorationsJSONAt(g.CurrentFork(), 1); err != ErrRevisionNotFound {
+		t.Errorf("pruned revision: err = %v", err)
+	}
+	if _, err := g.MarshalDecorationsJSONAt(g.CurrentFork(), 9); err != ErrRevisionNotFound {
+		t.Errorf("future revision: err = %v", err)
+	}
+	if _, err := g.MarshalDecorationsJSONAt(42, 0); err != ErrForkNotFound {
+		t.Errorf("unknown fork: err = %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package garland
+
+// decoration_ini.go - the versioned INI decoration dump.
+//
+// DESIGN: the original dump was a bare [decorations] section of
+// key=byte lines. It had no version, so nothing could ever be added
+// safely, and it leaned entirely on the key ruling (ValidDecorationKey)
+// for framing: a key holding '=', ';', whitespace, a newline or
+// non-ASCII bytes would have split or swallowed lines. Version 2 keeps
+// the same shape, so version-1 readers still load every mark, and adds:
+//
+//	[garland]
+//	format=decorations
+//	version=2
+//
+//	[decorations]
+//	cursor-main=12050
+//	bookmarks/b1=4521
+//
+//	[gravity]
+//	bookmarks/b1=left
+//
+//   - A [garland] header names the format and version. A file without
+//     one is version 1 and is read as before (lenient: malformed lines
+//     are skipped). A newer version, or another format, is refused with
+//     ErrDecorationFormat rather than half-read.
+//   - Keys are escaped: namespace and key are escaped separately and
+//     joined with '/'; any byte ValidDecorationKey does not allow is
+//     written %XX. Valid keys are therefore written as themselves,
+//     which is why version-1 readers still understand them.
+//   - Gravity goes in its own [gravity] section (left or right; default
+//     is omitted), which version-1 readers ignore as unknown.
+//   - A version-2 file is strict: a bad escape, position or gravity is
+//     ErrDecorationFormat. Keys that decode to something Decorate
+//     refuses fail the load with ErrInvalidDecorationKey; nothing is
+//     applied either way.
+
+// DecorationINIVersion is the version DumpDecorations writes and the
+// newest LoadDecorations reads.
+const DecorationINIVersion = 2
+
+// iniDocument is a decoration INI file split into its sections.
+type iniDocument struct {
+	header      map[string]string
+	decorations [][2]string // key, value in file order
+	gravity     map[string]string
+}
+
+// escapeDecorationKeyPart escapes one namespace or key for the INI dump.
+func escapeDecorationKeyPart(s string) string {
+	const hex = "0123456789ABCDEF"
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '_', c == '.', c == '#', c == '-':
+			out = append(out, c)
+		default:
+			out = append(out, '%', hex[c>>4], hex[c&15])
+		}
+	}
+	return string(out)
+}
+
+// unescapeDecorationKeyPart reverses escapeDecorationKeyPart.
+func unescapeDecorationKeyPart(s string) (string, bool) {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", false
+		}
+		hi, ok1 := hexDigit(s[i+1])
+		lo, ok2 := hexDigit(s[i+2])
+		if !ok1 || !ok2 {
+			return "", false
+		}
+		out = append(out, hi<<4|lo)
+		i += 2
+	}
+	return string(out), true
+}
+
+// hexDigit decodes one hexadecimal digit.
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// iniDecorationKey renders an entry's namespace and key for the dump.
+func iniDecorationKey(d DecorationEntry) string {
+	if d.Namespace == "" {
+		return escapeDecorationKeyPart(d.Key)
+	}
+	return escapeDecorationKeyPart(d.Namespace) + "/" + escapeDecorationKeyPart(d.Key)
+}
+
+// formatDecorationsINI renders decorations in the INI dump format.
+func formatDecorationsINI(decorations []DecorationEntry) []byte {
+	content := "[garland]\nformat=decorations\nversion=" + formatInt64(DecorationINIVersion) + "\n\n[decorations]\n"
+	var gravity string
+	for _, d := range decorations {
+		if d.Address == nil {
+			continue
+		}
+		key := iniDecorationKey(d)
+		content += key + "=" + formatInt64(d.Address.Byte) + "\n"
+		if name := gravityNames[d.Gravity]; name != "" {
+			gravity += key + "=" + name + "\n"
+		}
+	}
+	if gravity != "" {
+		content += "\n[gravity]\n" + gravity
+	}
+	return []byte(content)
+}
+
+// decodeDecorationINI turns a parsed file into entries, by version.
+func decodeDecorationINI(doc iniDocument) ([]DecorationEntry, error) {
+	version := int64(1)
+	if doc.header != nil {
+		v, err := parseInt64(doc.header["version"])
+		if err != nil || doc.header["format"] != "decorations" || v < 1 || v > DecorationINIVersion {
+			return nil, ErrDecorationFormat
+		}
+		version = v
+	}
+
+	var entries []DecorationEntry
+	if version == 1 {
+		for _, kv := range doc.decorations {
+			bytePos, err := parseInt64(kv[1])
+			if err != nil {
+				// Skip malformed entries silently for robustness
+				continue
+			}
+			addr := ByteAddress(bytePos)
+			ns, key := splitNamespacedKey(kv[0])
+			entries = append(entries, DecorationEntry{Key: key, Namespace: ns, Address: &addr})
+		}
+		return entries, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, kv := range doc.decorations {
+		bytePos, err := parseInt64(kv[1])
+		if err != nil || bytePos < 0 {
+			return nil, ErrDecorationFormat
+		}
+		rawNS, rawKey := splitNamespacedKey(kv[0])
+		ns, ok1 := unescapeDecorationKeyPart(rawNS)
+		key, ok2 := unescapeDecorationKeyPart(rawKey)
+		if !ok1 || !ok2 {
+			return nil, ErrDecorationFormat
+		}
+		gravity, ok := parseGravityName(doc.gravity[kv[0]])
+		if !ok {
+			return nil, ErrDecorationFormat
+		}
+		seen[kv[0]] = true
+		addr := ByteAddress(bytePos)
+		entries = append(entries, DecorationEntry{Key: key, Namespace: ns, Address: &addr, Gravity: gravity})
+	}
+	for key := range doc.gravity {
+		if !seen[key] {
+			return nil, ErrDecorationFormat
+		}
+	}
+	return entries, nil
+}
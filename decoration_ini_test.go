@@ -0,0 +1,99 @@
+package garland
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecorationINIRoundTripsHostileKeys(t *testing.T) {
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	hostile := []DecorationEntry{
+		{Key: "a=b", Address: at(1)},
+		{Key: "line\nbreak\r", Address: at(2), Gravity: GravityLeft},
+		{Key: "ünïcödé", Namespace: "ns with space", Address: at(3)},
+		{Key: "semi ;colon #hash", Address: at(4), Gravity: GravityRight},
+		{Key: "[section]", Namespace: "a/b", Address: at(5)},
+		{Key: "%41", Address: at(6)},
+		{Key: "plain-key.1#x", Namespace: "bookmarks", Address: at(7)},
+	}
+	data := formatDecorationsINI(hostile)
+	if !strings.HasPrefix(string(data), "[garland]\nformat=decorations\nversion=2\n") {
+		t.Errorf("missing version header:\n%s", data)
+	}
+	if !strings.Contains(string(data), "\nbookmarks/plain-key.1#x=7\n") {
+		t.Errorf("valid key was escaped:\n%s", data)
+	}
+	got, err := parseDecorationINI(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(hostile) {
+		t.Fatalf("parsed %d entries, want %d:\n%s", len(got), len(hostile), data)
+	}
+	for i, want := range hostile {
+		g := got[i]
+		if g.Key != want.Key || g.Namespace != want.Namespace || g.Address.Byte != want.Address.Byte || g.Gravity != want.Gravity {
+			t.Errorf("entry %d: got %q/%q@%d g%d, want %q/%q@%d g%d", i,
+				g.Namespace, g.Key, g.Address.Byte, g.Gravity, want.Namespace, want.Key, want.Address.Byte, want.Gravity)
+		}
+	}
+
+	// Loading hostile keys into a Garland is refused as a whole.
+	lib, _ := Init(LibraryOptions{})
+	gl, _ := lib.Open(FileOptions{DataString: "0123456789"})
+	defer gl.Close()
+	if err := gl.LoadDecorationsFromString(string(data)); err != ErrInvalidDecorationKey {
+		t.Errorf("hostile load: err = %v", err)
+	}
+	if n := gl.DecorationCount(); n != 0 {
+		t.Errorf("hostile load applied %d marks", n)
+	}
+}
+
+func TestDecorationINIVersionsAndGravity(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "hello world"})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	g.Decorate([]DecorationEntry{
+		{Key: "w", Namespace: "search", Address: at(6), Gravity: GravityLeft},
+		{Key: "h", Address: at(0)},
+	})
+	path := t.TempDir() + "/decs.ini"
+	if err := g.DumpDecorations(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(path)
+
+	g2, _ := lib.Open(FileOptions{DataString: "hello world"})
+	defer g2.Close()
+	if err := g2.LoadDecorations(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := g2.NextDecoration(5, nil); err != nil || e.Key != "w" || e.Gravity != GravityLeft {
+		t.Errorf("gravity lost in round trip: %+v, %v\n%s", e, err, raw)
+	}
+
+	// Version 1 (no header) is still read, leniently.
+	if err := g2.LoadDecorationsFromString("[decorations]\nold=3\nbroken=x\n"); err != nil {
+		t.Errorf("v1 file: %v", err)
+	}
+	if got := decorationAt(t, g2, "old"); got != 3 {
+		t.Errorf("v1 mark at %d", got)
+	}
+
+	for doc, want := range map[string]error{
+		"[garland]\nformat=decorations\nversion=3\n[decorations]\na=1\n":                  ErrDecorationFormat,
+		"[garland]\nformat=other\nversion=2\n":                                            ErrDecorationFormat,
+		"[garland]\nformat=decorations\nversion=2\n[decorations]\na=x\n":                  ErrDecorationFormat,
+		"[garland]\nformat=decorations\nversion=2\n[decorations]\na%4=1\n":                ErrDecorationFormat,
+		"[garland]\nformat=decorations\nversion=2\n[decorations]\na=1\n[gravity]\na=up\n": ErrDecorationFormat,
+		"[garland]\nformat=decorations\nversion=2\n[gravity]\nghost=left\n":               ErrDecorationFormat,
+	} {
+		if err := g2.LoadDecorationsFromString(doc); err != want {
+			t.Errorf("%q: err = %v, want %v", doc, err, want)
+		}
+	}
+}
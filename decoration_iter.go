@@ -0,0 +1,140 @@
+package garland
+
+import (
+	"iter"
+	"sort"
+)
+
+// decoration_iter.go - streaming decoration iteration.
+//
+// DESIGN: GetDecorationsInByteRange materializes every mark in the
+// range, which for a buffer carrying hundreds of thousands of marks
+// (diagnostics, syntax spans, word indexes) means a large slice built
+// only to find the first few. DecorationsInByteRange walks the leaves
+// in document order and yields marks as it reaches them; breaking out
+// of the loop stops the walk.
+//
+//   - The iterator reads the revision current when iteration began
+//     (the tree is persistent, so that version stays intact while
+//     edits continue). The caller may edit - or do anything else - in
+//     the loop body: the lock is held only while the walker steps to
+//     the next leaf, never across a yield.
+//   - Marks come in document order (by byte address, ties by key),
+//     split into Namespace and Key like every other report.
+//   - The range follows GetDecorationsInByteRange: [start, end), with
+//     end allowed one past the last byte to include an EOF mark.
+//   - Errors (an invalid range; the revision pruned away mid-walk) are
+//     yielded as the final pair.
+
+// decorationFrame is a subtree the walker has yet to visit.
+type decorationFrame struct {
+	id     NodeID
+	offset int64
+}
+
+// nextDecorationLeafLocked pops frames until it reaches a leaf that
+// overlaps [start, end) and returns its marks there, sorted; ok is
+// false when the walk is done. Caller must hold at least the read
+// lock.
+func (g *Garland) nextDecorationLeafLocked(st treeState, stack *[]decorationFrame, start, end int64) (out []DecorationEntry, ok bool, err error) {
+	for len(*stack) > 0 {
+		f := (*stack)[len(*stack)-1]
+		*stack = (*stack)[:len(*stack)-1]
+		node := g.nodeRegistry[f.id]
+		if node == nil {
+			return nil, false, ErrRevisionNotFound
+		}
+		snap := node.snapshotAt(st.fork, st.rev)
+		if snap == nil {
+			return nil, false, ErrRevisionNotFound
+		}
+		// Same overlap test as collectDecorationsInRangeInternal: a
+		// node ending exactly at start may hold an EOF mark there.
+		if f.offset+snap.byteCount < start || f.offset >= end {
+			continue
+		}
+		if !snap.isLeaf {
+			left := g.nodeRegistry[snap.leftID]
+			if left == nil {
+				return nil, false, ErrRevisionNotFound
+			}
+			leftSnap := left.snapshotAt(st.fork, st.rev)
+			if leftSnap == nil {
+				return nil, false, ErrRevisionNotFound
+			}
+			*stack = append(*stack,
+				decorationFrame{snap.rightID, f.offset + leftSnap.byteCount},
+				decorationFrame{snap.leftID, f.offset})
+			continue
+		}
+		for _, d := range snap.decorations {
+			abs := f.offset + d.Position
+			if abs >= start && abs < end {
+				addr := ByteAddress(abs)
+				ns, key := splitNamespacedKey(d.Key)
+				out = append(out, DecorationEntry{Key: key, Namespace: ns, Address: &addr, Gravity: d.Gravity})
+			}
+		}
+		if len(out) == 0 {
+			continue
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Address.Byte != out[j].Address.Byte {
+				return out[i].Address.Byte < out[j].Address.Byte
+			}
+			return namespacedKey(out[i].Namespace, out[i].Key) < namespacedKey(out[j].Namespace, out[j].Key)
+		})
+		return out, true, nil
+	}
+	return nil, false, nil
+}
+
+// DecorationsInByteRange iterates the decorations in [start, end) in
+// document order, lazily, leaf by leaf:
+//
+//	for e, err := range g.DecorationsInByteRange(0, g.ByteCount().Value+1) {
+//		if err != nil { ... }
+//		if done(e) { break }
+//	}
+//
+// It walks the revision current at the first step; the loop body may
+// edit freely. An error ends the sequence.
+func (g *Garland) DecorationsInByteRange(start, end int64) iter.Seq2[DecorationEntry, error] {
+	return func(yield func(DecorationEntry, error) bool) {
+		if start < 0 || end < start {
+			yield(DecorationEntry{}, ErrInvalidPosition)
+			return
+		}
+
+		g.mu.RLock()
+		if start > g.totalBytes {
+			g.mu.RUnlock()
+			yield(DecorationEntry{}, ErrInvalidPosition)
+			return
+		}
+		if end > g.totalBytes+1 {
+			end = g.totalBytes + 1
+		}
+		st := g.liveStateLocked()
+		g.mu.RUnlock()
+
+		stack := []decorationFrame{{st.root.id, 0}}
+		for {
+			g.mu.RLock()
+			batch, ok, err := g.nextDecorationLeafLocked(st, &stack, start, end)
+			g.mu.RUnlock()
+			if err != nil {
+				yield(DecorationEntry{}, err)
+				return
+			}
+			if !ok {
+				return
+			}
+			for _, e := range batch {
+				if !yield(e, nil) {
+					return
+				}
+			}
+		}
+	}
+}
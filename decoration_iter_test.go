@@ -0,0 +1,88 @@
+package garland
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDecorationsInByteRangeOrderAndEarlyStop(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("x", 2000), MaxLeafSize: 64})
+	defer g.Close()
+
+	// Marks placed in reverse order, one every 7 bytes, plus an EOF mark.
+	var entries []DecorationEntry
+	for pos := int64(1995); pos >= 0; pos -= 7 {
+		addr := ByteAddress(pos)
+		entries = append(entries, DecorationEntry{Key: fmt.Sprintf("m%d", pos), Address: &addr})
+	}
+	eof := ByteAddress(2000)
+	entries = append(entries, DecorationEntry{Key: "eof", Namespace: "ns", Address: &eof})
+	g.Decorate(entries)
+
+	var got []int64
+	for e, err := range g.DecorationsInByteRange(0, 2001) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e.Address.Byte)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("iterated %d marks, want %d", len(got), len(entries))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] < got[i-1] {
+			t.Fatalf("out of order at %d: %d after %d", i, got[i], got[i-1])
+		}
+	}
+
+	// Stop after three marks in a sub-range.
+	n := 0
+	for e := range g.DecorationsInByteRange(100, 200) {
+		if e.Address.Byte < 100 || e.Address.Byte >= 200 {
+			t.Errorf("mark at %d outside [100, 200)", e.Address.Byte)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Errorf("stopped after %d marks", n)
+	}
+
+	for _, err := range g.DecorationsInByteRange(5, 1) {
+		if err != ErrInvalidPosition {
+			t.Errorf("reversed range: err = %v", err)
+		}
+	}
+}
+
+func TestDecorationsInByteRangeAllowsEditsInLoop(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "a b c d e f g h", MaxLeafSize: 4})
+	defer g.Close()
+	for i := int64(0); i < 15; i += 2 {
+		addr := ByteAddress(i)
+		g.Decorate([]DecorationEntry{{Key: fmt.Sprintf("w%d", i), Address: &addr}})
+	}
+
+	// Delete every mark while iterating: the walk sees the revision it
+	// started on, so it visits all eight.
+	seen := 0
+	for e, err := range g.DecorationsInByteRange(0, g.ByteCount().Value) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen++
+		if _, err := g.Decorate([]DecorationEntry{{Key: e.Key}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if seen != 8 {
+		t.Errorf("visited %d marks, want 8", seen)
+	}
+	if left, _ := g.GetDecorationsInByteRange(0, g.ByteCount().Value+1); len(left) != 0 {
+		t.Errorf("%d marks survived", len(left))
+	}
+}
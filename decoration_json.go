@@ -0,0 +1,176 @@
+package garland
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// decoration_json.go - JSON decoration interchange.
+//
+// DESIGN: the INI dump (DumpDecorations) is a flat key=byte list with
+// side sections, shaped for hand-editing and old readers. The JSON
+// form is for exchanging marks with external tools and for persisted
+// sessions, so it is a documented, versioned schema:
+//
+//	{
+//	  "format": "garland-decorations",
+//	  "version": 1,
+//	  "decorations": [
+//	    {"key": "b1", "namespace": "bookmarks", "byte": 120, "gravity": "left"},
+//	    {"key": "eof", "byte": 4096}
+//	  ]
+//	}
+//
+//   - "format" must be exactly "garland-decorations"; "version" must be
+//     a version this build reads (1). A newer version is refused with
+//     ErrDecorationFormat rather than half-read.
+//   - Each decoration has "key" (required), "namespace" (omitted for
+//     the plain key space), "byte" (absolute byte address, required,
+//     0 through the buffer's length) and "gravity" ("left", "right", or
+//     omitted for the default).
+//   - Unknown members are ignored, so additions that old readers can
+//     safely skip do not need a version bump.
+//   - Marks are written in document order. Loading validates the whole
+//     document before applying any of it, then applies it as a single
+//     Decorate batch: one revision, and the last entry for a key wins.
+
+// decorationJSONFormat identifies a JSON decoration dump.
+const decorationJSONFormat = "garland-decorations"
+
+// DecorationJSONVersion is the schema version DumpDecorationsJSON
+// writes and the newest LoadDecorationsJSON reads.
+const DecorationJSONVersion = 1
+
+// DecorationDump is the JSON decoration document.
+type DecorationDump struct {
+	Format      string           `json:"format"`
+	Version     int              `json:"version"`
+	Decorations []DecorationJSON `json:"decorations"`
+}
+
+// DecorationJSON is one decoration in a DecorationDump.
+type DecorationJSON struct {
+	Key       string `json:"key"`
+	Namespace string `json:"namespace,omitempty"`
+	Byte      *int64 `json:"byte"`
+	Gravity   string `json:"gravity,omitempty"`
+}
+
+// gravityNames maps Gravity to its JSON spelling.
+var gravityNames = map[Gravity]string{GravityDefault: "", GravityLeft: "left", GravityRight: "right"}
+
+// parseGravityName is the inverse of gravityNames.
+func parseGravityName(name string) (Gravity, bool) {
+	for g, n := range gravityNames {
+		if n == name {
+			return g, true
+		}
+	}
+	return GravityDefault, false
+}
+
+// MarshalDecorationsJSON returns every decoration as a JSON document
+// (see DecorationDump).
+func (g *Garland) MarshalDecorationsJSON() ([]byte, error) {
+	g.mu.Lock()
+	decorations, err := g.decorationsAtLocked(g.liveStateLocked())
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return marshalDecorationsJSON(decorations)
+}
+
+// marshalDecorationsJSON renders decorations as a JSON document, in
+// document order.
+func marshalDecorationsJSON(decorations []DecorationEntry) ([]byte, error) {
+	sort.Slice(decorations, func(i, j int) bool { return decorationLess(decorations[i], decorations[j]) })
+	dump := DecorationDump{Format: decorationJSONFormat, Version: DecorationJSONVersion, Decorations: []DecorationJSON{}}
+	for _, d := range decorations {
+		pos := d.Address.Byte
+		dump.Decorations = append(dump.Decorations, DecorationJSON{
+			Key:       d.Key,
+			Namespace: d.Namespace,
+			Byte:      &pos,
+			Gravity:   gravityNames[d.Gravity],
+		})
+	}
+	return json.MarshalIndent(dump, "", "  ")
+}
+
+// DumpDecorationsJSON writes every decoration to path as a JSON
+// document. If fs is nil, uses the Garland's source filesystem.
+func (g *Garland) DumpDecorationsJSON(fs FileSystemInterface, path string) error {
+	data, err := g.MarshalDecorationsJSON()
+	if err != nil {
+		return err
+	}
+	return g.writeDecorationJSON(fs, path, data)
+}
+
+// writeDecorationJSON writes a rendered JSON dump to path. If fs is
+// nil, uses the Garland's source filesystem.
+func (g *Garland) writeDecorationJSON(fs FileSystemInterface, path string, data []byte) error {
+	if fs == nil {
+		fs = g.sourceFS
+	}
+	if fs == nil {
+		return ErrNoDataSource
+	}
+	return fs.WriteFile(path, append(data, '\n'))
+}
+
+// parseDecorationJSON validates a JSON decoration document and returns
+// its entries.
+func parseDecorationJSON(data []byte) ([]DecorationEntry, error) {
+	var dump DecorationDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, ErrDecorationFormat
+	}
+	if dump.Format != decorationJSONFormat || dump.Version < 1 || dump.Version > DecorationJSONVersion {
+		return nil, ErrDecorationFormat
+	}
+	entries := make([]DecorationEntry, 0, len(dump.Decorations))
+	for _, d := range dump.Decorations {
+		if !ValidDecorationKey(d.Key) || (d.Namespace != "" && !ValidDecorationKey(d.Namespace)) {
+			return nil, ErrInvalidDecorationKey
+		}
+		gravity, ok := parseGravityName(d.Gravity)
+		if d.Byte == nil || *d.Byte < 0 || !ok {
+			return nil, ErrDecorationFormat
+		}
+		addr := ByteAddress(*d.Byte)
+		entries = append(entries, DecorationEntry{Key: d.Key, Namespace: d.Namespace, Address: &addr, Gravity: gravity})
+	}
+	return entries, nil
+}
+
+// LoadDecorationsJSONFromBytes applies a JSON decoration document as a
+// single revision. Nothing is applied if any entry is malformed.
+func (g *Garland) LoadDecorationsJSONFromBytes(data []byte) error {
+	entries, err := parseDecorationJSON(data)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err = g.Decorate(entries)
+	return err
+}
+
+// LoadDecorationsJSON loads a JSON decoration document from path. If
+// fs is nil, uses the Garland's source filesystem.
+func (g *Garland) LoadDecorationsJSON(fs FileSystemInterface, path string) error {
+	if fs == nil {
+		fs = g.sourceFS
+	}
+	if fs == nil {
+		return ErrNoDataSource
+	}
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return g.LoadDecorationsJSONFromBytes(data)
+}
@@ -0,0 +1,88 @@
+package garland
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecorationsJSONRoundTrip(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "hello brave new world", MaxLeafSize: 8})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	g.Decorate([]DecorationEntry{
+		{Key: "b1", Namespace: "bookmarks", Address: at(6), Gravity: GravityLeft},
+		{Key: "start", Address: at(0)},
+		{Key: "eof", Address: at(21), Gravity: GravityRight},
+	})
+
+	path := t.TempDir() + "/decs.json"
+	if err := g.DumpDecorationsJSON(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(path)
+	for _, want := range []string{`"format": "garland-decorations"`, `"version": 1`, `"namespace": "bookmarks"`, `"gravity": "left"`} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("dump lacks %s:\n%s", want, raw)
+		}
+	}
+	if strings.Index(string(raw), `"start"`) > strings.Index(string(raw), `"eof"`) {
+		t.Errorf("dump not in document order:\n%s", raw)
+	}
+
+	g2, _ := lib.Open(FileOptions{DataString: "hello brave new world"})
+	defer g2.Close()
+	rev := g2.CurrentRevision()
+	if err := g2.LoadDecorationsJSON(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	if g2.CurrentRevision() != rev+1 {
+		t.Errorf("load took %d revisions", g2.CurrentRevision()-rev)
+	}
+	want, _ := g.GetDecorationsInByteRange(0, 22)
+	got, _ := g2.GetDecorationsInByteRange(0, 22)
+	if len(got) != len(want) {
+		t.Fatalf("loaded %+v, want %+v", got, want)
+	}
+	for _, w := range want {
+		e, err := g2.NextDecoration(w.Address.Byte-1, func(e DecorationEntry) bool { return e.Key == w.Key })
+		if err != nil || e.Address.Byte != w.Address.Byte || e.Namespace != w.Namespace || e.Gravity != w.Gravity {
+			t.Errorf("loaded %+v (%v), want %+v", e, err, w)
+		}
+	}
+}
+
+func TestLoadDecorationsJSONRejectsBadDocuments(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "0123456789"})
+	defer g.Close()
+
+	for doc, want := range map[string]error{
+		`not json`: ErrDecorationFormat,
+		`{"format": "other", "version": 1, "decorations": []}`:                                                       ErrDecorationFormat,
+		`{"format": "garland-decorations", "version": 2, "decorations": []}`:                                         ErrDecorationFormat,
+		`{"format": "garland-decorations", "version": 1, "decorations": [{"key": "a"}]}`:                             ErrDecorationFormat,
+		`{"format": "garland-decorations", "version": 1, "decorations": [{"key": "a/b", "byte": 1}]}`:                ErrInvalidDecorationKey,
+		`{"format": "garland-decorations", "version": 1, "decorations": [{"key": "a", "byte": 1, "gravity": "up"}]}`: ErrDecorationFormat,
+		// A bad entry after a good one: nothing is applied.
+		`{"format": "garland-decorations", "version": 1, "decorations": [{"key": "ok", "byte": 1}, {"key": "a", "byte": 99}]}`: ErrInvalidPosition,
+	} {
+		if err := g.LoadDecorationsJSONFromBytes([]byte(doc)); err != want {
+			t.Errorf("%s: err = %v, want %v", doc, err, want)
+		}
+	}
+	if _, err := g.GetDecorationPosition("ok"); err != ErrDecorationNotFound {
+		t.Errorf("partial document applied: %v", err)
+	}
+
+	// Unknown members are ignored.
+	doc := `{"format": "garland-decorations", "version": 1, "tool": "x", "decorations": [{"key": "k", "byte": 4, "note": "hi"}]}`
+	if err := g.LoadDecorationsJSONFromBytes([]byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if got := decorationAt(t, g, "k"); got != 4 {
+		t.Errorf("k at %d", got)
+	}
+}
@@ -0,0 +1,92 @@
+package garland
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGetDecorationsOnLineRangeMatchesPerLine(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("line of text\n", 30) + "tail", MaxLeafSize: 24})
+	defer g.Close()
+
+	var entries []DecorationEntry
+	for i := int64(0); i < 60; i++ {
+		addr := ByteAddress(i * 6)
+		entries = append(entries, DecorationEntry{Key: fmt.Sprintf("m%d", i), Address: &addr})
+	}
+	nl := ByteAddress(12) // on the newline ending line 0
+	entries = append(entries, DecorationEntry{Key: "nl", Address: &nl})
+	g.Decorate(entries)
+
+	groups, err := g.GetDecorationsOnLineRange(3, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 28 {
+		t.Fatalf("got %d groups, want 28", len(groups))
+	}
+	for i, got := range groups {
+		want, _ := g.GetDecorationsOnLine(int64(3 + i))
+		if fmt.Sprint(keysOf(got)) != fmt.Sprint(keysOf(want)) {
+			t.Errorf("line %d: got %v, want %v", 3+i, keysOf(got), keysOf(want))
+		}
+	}
+	first, _ := g.GetDecorationsOnLineRange(0, 0)
+	if got := fmt.Sprint(keysOf(first[0])); got != "[m0 m1 m2 nl]" && got != "[m0 m1 nl m2]" {
+		t.Errorf("line 0: %v", got)
+	}
+}
+
+func TestGetDecorationsOnLineRangeBounds(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "a\nb\nc"})
+	defer g.Close()
+
+	for _, r := range [][2]int64{{-1, 1}, {2, 1}, {3, 4}} {
+		if _, err := g.GetDecorationsOnLineRange(r[0], r[1]); err != ErrInvalidPosition {
+			t.Errorf("lines %v: err = %v", r, err)
+		}
+	}
+	if groups, err := g.GetDecorationsOnLineRange(0, 2); err != nil || len(groups) != 3 {
+		t.Errorf("no marks: %v, %v", groups, err)
+	}
+	// Past the end clamps to the last line, as ReadLineRange does.
+	if groups, err := g.GetDecorationsOnLineRange(1, 99); err != nil || len(groups) != 2 {
+		t.Errorf("lines 1-99: %d groups, %v", len(groups), err)
+	}
+}
+
+func TestGetDecorationsOnLineRangeDescendsTwice(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("x\n", 4000), MaxLeafSize: 64})
+	defer g.Close()
+	addr := ByteAddress(2001)
+	g.Decorate([]DecorationEntry{{Key: "m", Address: &addr}})
+	g.SetTracing(true)
+
+	// 2000 lines with a single mark: the cost is two descents and the
+	// pass over the span, not a descent per line.
+	before := g.TreeCounts()
+	groups, err := g.GetDecorationsOnLineRange(0, 1999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := g.TreeCounts().Sub(before).NodesVisited; n > 400 {
+		t.Errorf("visited %d nodes for 2000 lines", n)
+	}
+	for i, group := range groups {
+		if want := i == 1000; (len(group) == 1) != want {
+			t.Errorf("line %d: %v", i, keysOf(group))
+		}
+	}
+}
+
+func keysOf(entries []DecorationEntry) []string {
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
@@ -0,0 +1,179 @@
+package garland
+
+import (
+	"sort"
+	"strings"
+)
+
+// decoration_namespace.go - decoration namespaces.
+//
+// DESIGN: independent subsystems decorate the same buffer - bookmarks,
+// lint diagnostics, search highlights, a collaborator's carets - and
+// each wants to own its marks: pick keys without coordinating with
+// the others, list its own marks, and wipe them all when its results
+// go stale. A Namespace on DecorationEntry / RelativeDecoration gives
+// each subsystem its own key space.
+//
+//   - A namespaced mark is STORED under "namespace/key". '/' is not a
+//     legal key character (ValidDecorationKey), so a stored key can
+//     never collide with an un-namespaced one, and every existing
+//     mechanism - the tree, the location cache, cold storage, history
+//     - handles namespaced marks unchanged. The namespace is itself a
+//     validated identifier, so the stored form stays framing-safe.
+//   - Marks reported back (GetDecorationsInByteRange, deletions,
+//     displaced marks, DumpDecorations/LoadDecorations) are split into
+//     Namespace and Key again. The empty namespace is the plain key
+//     space every mark used before namespaces existed.
+//   - Namespace-scoped queries never filter the whole document: each
+//     namespace keeps an index of the keys ever placed in it (a hint
+//     superset, like the location cache - never pruned, so undo can
+//     bring any of them back), and only those keys are looked up.
+//     Cost is proportional to the namespace, not the buffer.
+//   - ClearNamespace removes every live mark of a namespace as ONE
+//     revision (one undo step), like a batch Decorate.
+
+// namespaceSeparator joins a namespace and a key in stored form.
+const namespaceSeparator = "/"
+
+// namespacedKey returns the stored key for key in namespace ns.
+func namespacedKey(ns, key string) string {
+	if ns == "" {
+		return key
+	}
+	return ns + namespaceSeparator + key
+}
+
+// splitNamespacedKey splits a stored key into namespace and key.
+func splitNamespacedKey(stored string) (ns, key string) {
+	if i := strings.Index(stored, namespaceSeparator); i >= 0 {
+		return stored[:i], stored[i+1:]
+	}
+	return "", stored
+}
+
+// validStoredDecorationKey reports whether stored is a legal key in
+// stored form: a key, or a namespace and a key joined by '/'.
+func validStoredDecorationKey(stored string) bool {
+	ns, key := splitNamespacedKey(stored)
+	if ns == "" {
+		return ValidDecorationKey(stored)
+	}
+	return ValidDecorationKey(ns) && ValidDecorationKey(key)
+}
+
+// storedRelativeDecorations returns decs with namespaces folded into
+// the keys (decs itself when none has a namespace).
+func storedRelativeDecorations(decs []RelativeDecoration) []RelativeDecoration {
+	var out []RelativeDecoration
+	for i, d := range decs {
+		if d.Namespace == "" {
+			if out != nil {
+				out = append(out, d)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]RelativeDecoration, 0, len(decs)), decs[:i]...)
+		}
+		d.Key, d.Namespace = namespacedKey(d.Namespace, d.Key), ""
+		out = append(out, d)
+	}
+	if out == nil {
+		return decs
+	}
+	return out
+}
+
+// reportRelativeDecoration converts a stored decoration at absolute
+// position d.Position into the caller-facing form relative to origin.
+func reportRelativeDecoration(d Decoration, origin int64) RelativeDecoration {
+	ns, key := splitNamespacedKey(d.Key)
+	return RelativeDecoration{Key: key, Namespace: ns, Position: d.Position - origin, Gravity: d.Gravity}
+}
+
+// indexDecorationNamespaceLocked records a placed stored key in its
+// namespace's index. Caller must hold the write lock.
+func (g *Garland) indexDecorationNamespaceLocked(stored string) {
+	ns, _ := splitNamespacedKey(stored)
+	if ns == "" {
+		return
+	}
+	if g.decorationNamespaces == nil {
+		g.decorationNamespaces = make(map[string]map[string]bool)
+	}
+	keys := g.decorationNamespaces[ns]
+	if keys == nil {
+		keys = make(map[string]bool)
+		g.decorationNamespaces[ns] = keys
+	}
+	keys[stored] = true
+}
+
+// namespaceDecorationsLocked returns the live marks of namespace ns,
+// in document order. Caller must hold the write lock.
+func (g *Garland) namespaceDecorationsLocked(ns string) []DecorationEntry {
+	var out []DecorationEntry
+	for stored := range g.decorationNamespaces[ns] {
+		addr, err := g.decorationPositionLocked(stored)
+		if err != nil {
+			continue // placed once, not live at this revision
+		}
+		// The mark's own entry (for its gravity): one leaf's worth.
+		var here []DecorationEntry
+		g.collectDecorationsInRangeInternal(g.root, g.root.snapshotAt(g.currentFork, g.currentRevision), addr.Byte, addr.Byte+1, 0, &here)
+		_, key := splitNamespacedKey(stored)
+		for _, e := range here {
+			if e.Key == key && e.Namespace == ns {
+				out = append(out, e)
+				break
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Address.Byte != out[j].Address.Byte {
+			return out[i].Address.Byte < out[j].Address.Byte
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// GetNamespaceDecorations returns every decoration in namespace ns, in
+// document order (byte addresses).
+func (g *Garland) GetNamespaceDecorations(ns string) ([]DecorationEntry, error) {
+	if !ValidDecorationKey(ns) {
+		return nil, ErrInvalidDecorationKey
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.namespaceDecorationsLocked(ns), nil
+}
+
+// GetDecorationPositionIn returns the position of decoration key in
+// namespace ns (GetDecorationPosition for the empty namespace).
+func (g *Garland) GetDecorationPositionIn(ns, key string) (AbsoluteAddress, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.decorationPositionLocked(namespacedKey(ns, key))
+}
+
+// ClearNamespace removes every decoration in namespace ns as a single
+// revision. Clearing an empty namespace changes nothing.
+func (g *Garland) ClearNamespace(ns string) (ChangeResult, error) {
+	if !ValidDecorationKey(ns) {
+		return ChangeResult{}, ErrInvalidDecorationKey
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	live := g.namespaceDecorationsLocked(ns)
+	if len(live) == 0 {
+		return ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}, nil
+	}
+	deletions := make([]DecorationEntry, len(live))
+	for i, e := range live {
+		deletions[i] = DecorationEntry{Key: e.Key, Namespace: ns}
+	}
+	defer g.noteOpLocked(ReplayRecord{Op: replayDecorate, Entries: deletions})()
+	return g.decorateLocked(deletions)
+}
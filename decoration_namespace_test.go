@@ -0,0 +1,88 @@
+package garland
+
+import "testing"
+
+func TestDecorationNamespacesCoexistAndClear(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "one two three four\n"})
+	defer g.Close()
+
+	a, b, c := ByteAddress(4), ByteAddress(8), ByteAddress(14)
+	g.Decorate([]DecorationEntry{
+		{Key: "m1", Address: &c},
+		{Key: "m1", Namespace: "lint", Address: &b, Gravity: GravityLeft},
+		{Key: "m0", Namespace: "lint", Address: &a},
+		{Key: "m1", Namespace: "bookmarks", Address: &a},
+	})
+
+	// The same key in three key spaces: three independent marks.
+	for _, tc := range []struct {
+		ns   string
+		want int64
+	}{{"", 14}, {"lint", 8}, {"bookmarks", 4}} {
+		if addr, err := g.GetDecorationPositionIn(tc.ns, "m1"); err != nil || addr.Byte != tc.want {
+			t.Errorf("%q/m1 at %d (%v), want %d", tc.ns, addr.Byte, err, tc.want)
+		}
+	}
+	lint, _ := g.GetNamespaceDecorations("lint")
+	if len(lint) != 2 || lint[0].Key != "m0" || lint[1].Key != "m1" || lint[1].Gravity != GravityLeft || lint[1].Namespace != "lint" {
+		t.Fatalf("lint namespace: %+v", lint)
+	}
+
+	rev := g.CurrentRevision()
+	if _, err := g.ClearNamespace("lint"); err != nil {
+		t.Fatal(err)
+	}
+	if g.CurrentRevision() != rev+1 {
+		t.Errorf("ClearNamespace took %d revisions", g.CurrentRevision()-rev)
+	}
+	if lint, _ := g.GetNamespaceDecorations("lint"); len(lint) != 0 {
+		t.Errorf("lint after clear: %+v", lint)
+	}
+	if _, err := g.GetDecorationPositionIn("bookmarks", "m1"); err != nil {
+		t.Error("clearing lint removed a bookmark")
+	}
+	if _, err := g.GetDecorationPosition("m1"); err != nil {
+		t.Error("clearing lint removed the plain m1")
+	}
+
+	g.UndoSeek(rev)
+	if lint, _ := g.GetNamespaceDecorations("lint"); len(lint) != 2 {
+		t.Errorf("undo restored %d lint marks, want 2", len(lint))
+	}
+	if _, err := g.ClearNamespace("bad/ns"); err != ErrInvalidDecorationKey {
+		t.Errorf("ClearNamespace(bad/ns): err = %v", err)
+	}
+}
+
+func TestDecorationNamespacesThroughEditsAndDumps(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "abc\n"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekByte(3)
+	c.InsertString("XYZ", []RelativeDecoration{{Key: "hit", Namespace: "search", Position: 1}}, false)
+	if addr, err := g.GetDecorationPositionIn("search", "hit"); err != nil || addr.Byte != 4 {
+		t.Fatalf("inserted namespaced mark at %d (%v)", addr.Byte, err)
+	}
+
+	c.SeekByte(3)
+	decs, _, _ := c.DeleteBytes(3, false)
+	if len(decs) != 1 || decs[0].Key != "hit" || decs[0].Namespace != "search" {
+		t.Errorf("deletion reported %+v", decs)
+	}
+
+	path := t.TempDir() + "/decs.ini"
+	if err := g.DumpDecorations(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	g2, _ := lib.Open(FileOptions{DataString: "abc\n"})
+	defer g2.Close()
+	if err := g2.LoadDecorations(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := g2.GetDecorationPositionIn("search", "hit"); err != nil || addr.Byte != 3 {
+		t.Errorf("loaded namespaced mark at %d (%v)", addr.Byte, err)
+	}
+}
@@ -0,0 +1,141 @@
+package garland
+
+// decoration_nav.go - nearest-decoration navigation.
+//
+// DESIGN: "jump to the next bookmark / diagnostic" needs only the one
+// mark closest to the cursor, but GetDecorationsInByteRange would
+// collect every mark between the cursor and the end of the buffer to
+// find it. NextDecoration / PrevDecoration descend the tree instead.
+//
+//   - Every snapshot carries decorationCount, the number of marks in
+//     its subtree (a weight like byteCount, summed up the tree when
+//     the path is copied). The descent skips subtrees with no marks,
+//     and subtrees entirely on the wrong side of pos, without visiting
+//     them: with no filter the answer costs O(log n) node visits.
+//   - A filter (say, one namespace, or one key prefix) is applied to
+//     the marks in the leaves the descent reaches. Marks it rejects
+//     still count, so a filter matching few of many marks walks more
+//     leaves - still in order, still stopping at the first match.
+//   - "After" and "before" are strict: NextDecoration(pos) finds a
+//     mark at pos+1 or later, so calling it again from the mark found
+//     moves on. Ties at one byte go by key, in document order (the
+//     order DecorationsInByteRange yields).
+//   - Marks in cold leaves are not visible, as with every other
+//     decoration query: the descent does not thaw.
+
+// decorationLess orders a before b in document order: by byte, ties
+// by stored key.
+func decorationLess(a, b DecorationEntry) bool {
+	if a.Address.Byte != b.Address.Byte {
+		return a.Address.Byte < b.Address.Byte
+	}
+	return namespacedKey(a.Namespace, a.Key) < namespacedKey(b.Namespace, b.Key)
+}
+
+// nearestDecorationLocked finds the mark nearest pos in the subtree id
+// at offset: the first strictly after pos when forward, else the last
+// strictly before it. Caller must hold at least the read lock.
+func (g *Garland) nearestDecorationLocked(st treeState, id NodeID, offset, pos int64, forward bool, filter func(DecorationEntry) bool) (best DecorationEntry, found bool, err error) {
+	node := g.nodeRegistry[id]
+	if node == nil {
+		return best, false, ErrRevisionNotFound
+	}
+	snap := node.snapshotAt(st.fork, st.rev)
+	if snap == nil {
+		return best, false, ErrRevisionNotFound
+	}
+	if snap.decorationCount == 0 {
+		return best, false, nil
+	}
+	// Marks lie in [offset, offset+byteCount] (a mark may sit at the
+	// leaf's end).
+	if forward && offset+snap.byteCount <= pos || !forward && offset >= pos {
+		return best, false, nil
+	}
+
+	if snap.isLeaf {
+		for _, d := range snap.decorations {
+			abs := offset + d.Position
+			if forward && abs <= pos || !forward && abs >= pos {
+				continue
+			}
+			addr := ByteAddress(abs)
+			ns, key := splitNamespacedKey(d.Key)
+			e := DecorationEntry{Key: key, Namespace: ns, Address: &addr, Gravity: d.Gravity}
+			if filter != nil && !filter(e) {
+				continue
+			}
+			if !found || decorationLess(e, best) == forward {
+				best, found = e, true
+			}
+		}
+		return best, found, nil
+	}
+
+	left := g.nodeRegistry[snap.leftID]
+	if left == nil {
+		return best, false, ErrRevisionNotFound
+	}
+	leftSnap := left.snapshotAt(st.fork, st.rev)
+	if leftSnap == nil {
+		return best, false, ErrRevisionNotFound
+	}
+	split := offset + leftSnap.byteCount
+	near, far := snap.leftID, snap.rightID
+	nearOffset, farOffset := offset, split
+	if !forward {
+		near, far = far, near
+		nearOffset, farOffset = farOffset, nearOffset
+	}
+
+	best, found, err = g.nearestDecorationLocked(st, near, nearOffset, pos, forward, filter)
+	if err != nil || found && best.Address.Byte != split {
+		return best, found, err
+	}
+	// Nothing on the near side, or a hit on the split point, where the
+	// far side's first leaf may hold a mark at the same byte that
+	// orders ahead of it.
+	other, ok, err := g.nearestDecorationLocked(st, far, farOffset, pos, forward, filter)
+	if err != nil {
+		return best, false, err
+	}
+	if ok && (!found || decorationLess(other, best) == forward) {
+		best, found = other, true
+	}
+	return best, found, nil
+}
+
+// nearestDecoration validates pos and runs the descent on the live
+// revision.
+func (g *Garland) nearestDecoration(pos int64, forward bool, filter func(DecorationEntry) bool) (DecorationEntry, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if pos < -1 || pos > g.totalBytes+1 {
+		return DecorationEntry{}, ErrInvalidPosition
+	}
+	st := g.liveStateLocked()
+	e, ok, err := g.nearestDecorationLocked(st, st.root.id, 0, pos, forward, filter)
+	if err != nil {
+		return DecorationEntry{}, err
+	}
+	if !ok {
+		return DecorationEntry{}, ErrDecorationNotFound
+	}
+	return e, nil
+}
+
+// NextDecoration returns the first decoration strictly after byte pos
+// that filter accepts (nil accepts all), or ErrDecorationNotFound.
+// Pass -1 to include a mark at byte 0. The filter runs under the
+// Garland's read lock and must not call back into it.
+func (g *Garland) NextDecoration(pos int64, filter func(DecorationEntry) bool) (DecorationEntry, error) {
+	return g.nearestDecoration(pos, true, filter)
+}
+
+// PrevDecoration returns the last decoration strictly before byte pos
+// that filter accepts (nil accepts all), or ErrDecorationNotFound.
+// Pass one past the end of the buffer to include an EOF mark.
+func (g *Garland) PrevDecoration(pos int64, filter func(DecorationEntry) bool) (DecorationEntry, error) {
+	return g.nearestDecoration(pos, false, filter)
+}
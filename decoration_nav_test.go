@@ -0,0 +1,105 @@
+package garland
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNextPrevDecorationMatchesScan(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("abcdefghij", 60), MaxLeafSize: 32})
+	defer g.Close()
+
+	// Sparse marks (long mark-free stretches), two sharing a byte, one at EOF.
+	var entries []DecorationEntry
+	for _, pos := range []int64{0, 3, 3, 150, 151, 400, 599, 600} {
+		addr := ByteAddress(pos)
+		entries = append(entries, DecorationEntry{Key: fmt.Sprintf("m%d_%d", pos, len(entries)), Address: &addr})
+	}
+	g.Decorate(entries)
+	c := g.NewCursor()
+	c.SeekByte(200)
+	c.InsertString("inserted text\n", nil, true) // shifts the marks past 200
+	c.SeekByte(10)
+	c.DeleteBytes(20, false)
+
+	all, _ := g.GetDecorationsInByteRange(0, g.ByteCount().Value+1)
+	ordered := append([]DecorationEntry(nil), all...)
+	for i := 1; i < len(ordered); i++ {
+		for j := i; j > 0 && decorationLess(ordered[j], ordered[j-1]); j-- {
+			ordered[j], ordered[j-1] = ordered[j-1], ordered[j]
+		}
+	}
+
+	for pos := int64(-1); pos <= g.ByteCount().Value+1; pos++ {
+		var wantNext, wantPrev string
+		for _, e := range ordered {
+			if e.Address.Byte > pos && wantNext == "" {
+				wantNext = e.Key
+			}
+			if e.Address.Byte < pos {
+				wantPrev = e.Key
+			}
+		}
+		next, err := g.NextDecoration(pos, nil)
+		if got := next.Key; (err == nil) != (wantNext != "") || got != wantNext {
+			t.Fatalf("NextDecoration(%d) = %q, %v; want %q", pos, got, err, wantNext)
+		}
+		prev, err := g.PrevDecoration(pos, nil)
+		if got := prev.Key; (err == nil) != (wantPrev != "") || got != wantPrev {
+			t.Fatalf("PrevDecoration(%d) = %q, %v; want %q", pos, got, err, wantPrev)
+		}
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestNextDecorationFilterAndErrors(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("x", 300), MaxLeafSize: 16})
+	defer g.Close()
+
+	var entries []DecorationEntry
+	for pos := int64(0); pos < 300; pos += 10 {
+		addr := ByteAddress(pos)
+		ns := "lint"
+		if pos%50 == 0 {
+			ns = "bookmarks"
+		}
+		entries = append(entries, DecorationEntry{Key: fmt.Sprintf("k%d", pos), Namespace: ns, Address: &addr})
+	}
+	g.Decorate(entries)
+
+	bookmarks := func(e DecorationEntry) bool { return e.Namespace == "bookmarks" }
+	var hops []int64
+	for pos := int64(-1); ; {
+		e, err := g.NextDecoration(pos, bookmarks)
+		if err == ErrDecorationNotFound {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hops = append(hops, e.Address.Byte)
+		pos = e.Address.Byte
+	}
+	if fmt.Sprint(hops) != "[0 50 100 150 200 250]" {
+		t.Errorf("bookmark hops %v", hops)
+	}
+	if e, err := g.PrevDecoration(250, bookmarks); err != nil || e.Address.Byte != 200 || e.Key != "k200" {
+		t.Errorf("PrevDecoration(250) = %+v, %v", e, err)
+	}
+
+	if _, err := g.NextDecoration(-2, nil); err != ErrInvalidPosition {
+		t.Errorf("NextDecoration(-2): err = %v", err)
+	}
+	if _, err := g.PrevDecoration(302, nil); err != ErrInvalidPosition {
+		t.Errorf("PrevDecoration(302): err = %v", err)
+	}
+	g.ClearNamespace("bookmarks")
+	if _, err := g.NextDecoration(-1, bookmarks); err != ErrDecorationNotFound {
+		t.Errorf("after ClearNamespace: err = %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package garland
+
+// decoration_rename.go - renaming a decoration key.
+//
+// DESIGN: renaming through Decorate is a delete plus an add: two tree
+// passes, a re-placement that may land the mark in a different leaf at
+// a boundary, and a gravity the caller has to know and restate. A
+// rename only changes the key, so it rewrites the one leaf holding the
+// mark, in place.
+//
+//   - One revision. Position, gravity and order within the leaf are
+//     kept exactly; only Key changes.
+//   - The new key takes over the old key's cache hint (same leaf, same
+//     offset), and the old key is recorded as not present, so both
+//     lookups stay O(1) afterwards.
+//   - A key is unique document-wide, so a decoration already holding the
+//     new key is replaced (as Decorate would move it). Renaming a key to
+//     itself changes nothing.
+//   - The replay log records it as the equivalent Decorate batch.
+
+// decorationLeafLocked finds the leaf holding stored key: the cache
+// hint when it is current, otherwise a walk that skips subtrees with no
+// marks of the key's namespace. Cold leaves on the way are thawed.
+// Caller must hold the write lock.
+func (g *Garland) decorationLeafLocked(key string) (*Node, *NodeSnapshot, int64, error) {
+	inTransaction := g.transaction != nil && g.transaction.hasMutations
+	entry, exists := g.decorationCache[key]
+	if !exists && !inTransaction {
+		return nil, nil, 0, nil
+	}
+	if exists && !inTransaction && entry.LastKnownFork == g.currentFork && entry.LastKnownRev == g.currentRevision {
+		if entry.LastKnownNode == 0 {
+			return nil, nil, 0, nil
+		}
+		if node := g.nodeRegistry[entry.LastKnownNode]; node != nil {
+			snap := node.snapshotAt(g.currentFork, g.currentRevision)
+			if snap != nil && snap.isLeaf {
+				if err := g.ensureLeafDataResident(node, snap); err != nil {
+					return nil, nil, 0, err
+				}
+				for _, d := range snap.decorations {
+					if d.Key == key {
+						return node, snap, entry.LastKnownOffset, nil
+					}
+				}
+			}
+		}
+	}
+	ns, _ := splitNamespacedKey(key)
+	return g.findDecorationLeafInternal(g.root, g.root.snapshotAt(g.currentFork, g.currentRevision), key, ns, 0)
+}
+
+// findDecorationLeafInternal walks the subtree for the leaf holding key.
+func (g *Garland) findDecorationLeafInternal(node *Node, snap *NodeSnapshot, key, ns string, offset int64) (*Node, *NodeSnapshot, int64, error) {
+	if snap == nil || namespaceWeight(snap, ns) == 0 {
+		return nil, nil, 0, nil
+	}
+	if snap.isLeaf {
+		if err := g.ensureLeafDataResident(node, snap); err != nil {
+			return nil, nil, 0, err
+		}
+		for _, d := range snap.decorations {
+			if d.Key == key {
+				return node, snap, offset, nil
+			}
+		}
+		return nil, nil, 0, nil
+	}
+	left, right := g.nodeRegistry[snap.leftID], g.nodeRegistry[snap.rightID]
+	if left == nil || right == nil {
+		return nil, nil, 0, ErrInternal
+	}
+	leftSnap := left.snapshotAt(g.currentFork, g.currentRevision)
+	found, foundSnap, at, err := g.findDecorationLeafInternal(left, leftSnap, key, ns, offset)
+	if found != nil || err != nil {
+		return found, foundSnap, at, err
+	}
+	return g.findDecorationLeafInternal(right, right.snapshotAt(g.currentFork, g.currentRevision), key, ns, offset+leftSnap.byteCount)
+}
+
+// rewriteLeafDecorationsLocked replaces the leaf at offset with a copy
+// carrying decs and installs the new root. Caller must hold the write
+// lock.
+func (g *Garland) rewriteLeafDecorationsLocked(snap *NodeSnapshot, offset int64, decs []Decoration) (NodeID, error) {
+	g.nextNodeID++
+	leaf := newNode(g.nextNodeID, g)
+	g.nodeRegistry[leaf.id] = leaf
+	leaf.setSnapshot(g.currentFork, g.currentRevision, createLeafSnapshot(snap.data, decs, snap.originalFileOffset))
+	newRootID, err := g.rebuildFromLeaf(&LeafSearchResult{LeafByteStart: offset}, leaf.id)
+	if err != nil {
+		return 0, err
+	}
+	g.root = g.nodeRegistry[newRootID]
+	return leaf.id, nil
+}
+
+// renameDecorationLocked renames stored key oldKey to newKey. Caller
+// must hold the write lock.
+func (g *Garland) renameDecorationLocked(oldKey, newKey string) (ChangeResult, error) {
+	_, snap, offset, err := g.decorationLeafLocked(oldKey)
+	if err != nil {
+		return ChangeResult{}, err
+	}
+	if snap == nil {
+		return ChangeResult{}, ErrDecorationNotFound
+	}
+	if oldKey == newKey {
+		return ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}, nil
+	}
+	var moved Decoration
+	for _, d := range snap.decorations {
+		if d.Key == oldKey {
+			moved = d
+		}
+	}
+	if g.transaction == nil {
+		g.recordCursorPositionsInHistory()
+	}
+	pos := offset + moved.Position
+	addr := ByteAddress(pos)
+	oldNS, oldName := splitNamespacedKey(oldKey)
+	newNS, newName := splitNamespacedKey(newKey)
+	defer g.noteOpLocked(ReplayRecord{Op: replayDecorate, Entries: []DecorationEntry{
+		{Key: oldName, Namespace: oldNS},
+		{Key: newName, Namespace: newNS, Address: &addr, Gravity: moved.Gravity},
+	}})()
+
+	// A mark already holding newKey elsewhere goes first (its leaf is
+	// rewritten; the renamed mark's leaf is found again after).
+	if _, other, otherOffset, err := g.decorationLeafLocked(newKey); err != nil {
+		return ChangeResult{}, err
+	} else if other != nil && other != snap {
+		var kept []Decoration
+		for _, d := range other.decorations {
+			if d.Key != newKey {
+				kept = append(kept, d)
+			}
+		}
+		if _, err := g.rewriteLeafDecorationsLocked(other, otherOffset, kept); err != nil {
+			return ChangeResult{}, err
+		}
+		if _, snap, offset, err = g.findDecorationLeafInternal(g.root, g.root.snapshotAt(g.currentFork, g.currentRevision), oldKey, oldNS, 0); err != nil || snap == nil {
+			return ChangeResult{}, ErrInternal
+		}
+	}
+
+	decs := make([]Decoration, 0, len(snap.decorations))
+	for _, d := range snap.decorations {
+		switch d.Key {
+		case newKey:
+			continue
+		case oldKey:
+			d.Key = newKey
+		}
+		decs = append(decs, d)
+	}
+	leafID, err := g.rewriteLeafDecorationsLocked(snap, offset, decs)
+	if err != nil {
+		return ChangeResult{}, err
+	}
+	g.indexDecorationNamespaceLocked(newKey)
+	g.pendingDecorationDeletes = append(g.pendingDecorationDeletes, oldKey)
+	g.pendingDecorationUpdates = append(g.pendingDecorationUpdates, pendingDecorationUpdate{Key: newKey, NodeID: leafID, Offset: offset})
+	return g.recordMutation(), nil
+}
+
+// RenameDecoration renames decoration oldKey to newKey as a single
+// revision, keeping its position and gravity. A decoration already
+// named newKey is replaced.
+func (g *Garland) RenameDecoration(oldKey, newKey string) (ChangeResult, error) {
+	return g.RenameDecorationIn("", oldKey, newKey)
+}
+
+// RenameDecorationIn is RenameDecoration within namespace ns ("" for
+// the plain key space).
+func (g *Garland) RenameDecorationIn(ns, oldKey, newKey string) (ChangeResult, error) {
+	if !ValidDecorationKey(oldKey) || !ValidDecorationKey(newKey) || (ns != "" && !ValidDecorationKey(ns)) {
+		return ChangeResult{}, ErrInvalidDecorationKey
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.renameDecorationLocked(namespacedKey(ns, oldKey), namespacedKey(ns, newKey))
+}
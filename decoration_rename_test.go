@@ -0,0 +1,84 @@
+package garland
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenameDecorationKeepsPositionAndGravity(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("0123456789", 20), MaxLeafSize: 16})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	g.Decorate([]DecorationEntry{
+		{Key: "old", Address: at(50), Gravity: GravityLeft},
+		{Key: "taken", Address: at(150)},
+		{Key: "b1", Namespace: "bookmarks", Address: at(7)},
+	})
+	rev := g.CurrentRevision()
+
+	res, err := g.RenameDecoration("old", "taken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Revision != rev+1 {
+		t.Errorf("rename produced revision %d, want %d", res.Revision, rev+1)
+	}
+	if got := decorationAt(t, g, "taken"); got != 50 {
+		t.Errorf("taken at %d, want 50", got)
+	}
+	if _, err := g.GetDecorationPosition("old"); err != ErrDecorationNotFound {
+		t.Errorf("old key still present: %v", err)
+	}
+	if n := g.DecorationCount(); n != 2 {
+		t.Errorf("DecorationCount = %d, want 2 (the displaced mark is gone)", n)
+	}
+
+	// Gravity survives: an insert at the mark leaves it in place.
+	c := g.NewCursor()
+	c.SeekByte(50)
+	c.InsertString("XX", nil, false)
+	if got := decorationAt(t, g, "taken"); got != 50 {
+		t.Errorf("after insert: taken at %d, want 50", got)
+	}
+
+	g.UndoSeek(rev)
+	if got := decorationAt(t, g, "old"); got != 50 {
+		t.Errorf("after undo: old at %d", got)
+	}
+	if got := decorationAt(t, g, "taken"); got != 150 {
+		t.Errorf("after undo: taken at %d", got)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestRenameDecorationInNamespaceAndColdLeaf(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("x", 200), MaxLeafSize: 32})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	g.Decorate([]DecorationEntry{{Key: "a", Namespace: "marks", Address: at(120)}})
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.RenameDecorationIn("marks", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := g.GetDecorationPositionIn("marks", "b"); err != nil || addr.Byte != 120 {
+		t.Errorf("marks/b at %v, %v", addr, err)
+	}
+
+	if _, err := g.RenameDecoration("missing", "x"); err != ErrDecorationNotFound {
+		t.Errorf("missing key: err = %v", err)
+	}
+	if _, err := g.RenameDecorationIn("marks", "b", "bad/key"); err != ErrInvalidDecorationKey {
+		t.Errorf("bad key: err = %v", err)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
@@ -0,0 +1,121 @@
+package garland
+
+import (
+	"sort"
+	"strings"
+)
+
+// decoration_stats.go - decoration counts and key listing.
+//
+// DESIGN: a status line showing "34 bookmarks, 1,208 diagnostics"
+// must not cost a collection pass over every mark on every redraw.
+// The counts are tree weights: each snapshot carries decorationCount
+// and namespaceCounts for its subtree, maintained when the path is
+// copied like byteCount, so the totals are read off the root.
+//
+//   - DecorationCount and DecorationNamespaceCounts are O(1) reads
+//     (plus the size of the map), and include marks in cold leaves.
+//   - Key listing must name every key, so it visits the leaves that
+//     hold marks - skipping mark-free subtrees - and thaws cold ones.
+//     It reports keys of one namespace, sorted.
+//   - Ephemeral marks are not counted (they are not in the tree).
+
+// DecorationCount returns the number of decorations in the document,
+// in every namespace.
+func (g *Garland) DecorationCount() int64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if snap := g.root.snapshotAt(g.currentFork, g.currentRevision); snap != nil {
+		return snap.decorationCount
+	}
+	return 0
+}
+
+// DecorationNamespaceCounts returns the number of decorations in each
+// namespace that has any; the plain key space is counted under "".
+func (g *Garland) DecorationNamespaceCounts() map[string]int64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	counts := make(map[string]int64)
+	snap := g.root.snapshotAt(g.currentFork, g.currentRevision)
+	if snap == nil {
+		return counts
+	}
+	plain := snap.decorationCount
+	for ns, n := range snap.namespaceCounts {
+		if n > 0 {
+			counts[ns] = n
+			plain -= n
+		}
+	}
+	if plain > 0 {
+		counts[""] = plain
+	}
+	return counts
+}
+
+// namespaceWeight returns how many decorations of namespace ns ("" for
+// the plain key space) the subtree holds.
+func namespaceWeight(snap *NodeSnapshot, ns string) int64 {
+	if ns != "" {
+		return snap.namespaceCounts[ns]
+	}
+	n := snap.decorationCount
+	for _, c := range snap.namespaceCounts {
+		n -= c
+	}
+	return n
+}
+
+// collectDecorationKeysLocked appends the stored keys in the subtree
+// that belong to namespace ns and start with prefix. Caller must hold
+// the write lock (cold leaves are thawed).
+func (g *Garland) collectDecorationKeysLocked(node *Node, snap *NodeSnapshot, ns, prefix string, out *[]string) error {
+	if snap == nil || namespaceWeight(snap, ns) == 0 {
+		return nil
+	}
+	if snap.isLeaf {
+		if err := g.ensureLeafDataResident(node, snap); err != nil {
+			return err
+		}
+		for _, d := range snap.decorations {
+			if n, key := splitNamespacedKey(d.Key); n == ns && strings.HasPrefix(key, prefix) {
+				*out = append(*out, key)
+			}
+		}
+		return nil
+	}
+	for _, id := range [2]NodeID{snap.leftID, snap.rightID} {
+		child := g.nodeRegistry[id]
+		if child == nil {
+			return ErrRevisionNotFound
+		}
+		if err := g.collectDecorationKeysLocked(child, child.snapshotAt(g.currentFork, g.currentRevision), ns, prefix, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListDecorationKeysIn returns the keys of namespace ns ("" for the
+// plain key space) that start with prefix, sorted.
+func (g *Garland) ListDecorationKeysIn(ns, prefix string) ([]string, error) {
+	if ns != "" && !ValidDecorationKey(ns) {
+		return nil, ErrInvalidDecorationKey
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var keys []string
+	if err := g.collectDecorationKeysLocked(g.root, g.root.snapshotAt(g.currentFork, g.currentRevision), ns, prefix, &keys); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ListDecorationKeys returns the keys of the plain key space that
+// start with prefix, sorted.
+func (g *Garland) ListDecorationKeys(prefix string) ([]string, error) {
+	return g.ListDecorationKeysIn("", prefix)
+}
@@ -0,0 +1,83 @@
+package garland
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDecorationCountsFollowEditsAndUndo(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("abcdefghij", 50), MaxLeafSize: 32})
+	defer g.Close()
+
+	var entries []DecorationEntry
+	for i := int64(0); i < 50; i++ {
+		addr := ByteAddress(i * 10)
+		ns := "diagnostics"
+		if i%10 == 0 {
+			ns = "bookmarks"
+		}
+		entries = append(entries, DecorationEntry{Key: fmt.Sprintf("m%d", i), Namespace: ns, Address: &addr})
+	}
+	a, b := ByteAddress(3), ByteAddress(4)
+	entries = append(entries, DecorationEntry{Key: "plain", Address: &a}, DecorationEntry{Key: "other", Address: &b})
+	g.Decorate(entries)
+	rev := g.CurrentRevision()
+
+	if n := g.DecorationCount(); n != 52 {
+		t.Errorf("DecorationCount = %d, want 52", n)
+	}
+	if got := fmt.Sprint(g.DecorationNamespaceCounts()); got != "map[:2 bookmarks:5 diagnostics:45]" {
+		t.Errorf("namespace counts %s", got)
+	}
+
+	g.ClearNamespace("bookmarks")
+	c := g.NewCursor()
+	c.SeekByte(100)
+	c.DeleteBytes(50, false) // marks collapse, none are lost
+	if got := fmt.Sprint(g.DecorationNamespaceCounts()); got != "map[:2 diagnostics:45]" {
+		t.Errorf("after clearing bookmarks: %s", got)
+	}
+
+	g.UndoSeek(rev)
+	if got := fmt.Sprint(g.DecorationNamespaceCounts()); got != "map[:2 bookmarks:5 diagnostics:45]" {
+		t.Errorf("after undo: %s", got)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestListDecorationKeysIncludesColdLeaves(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("x", 400), MaxLeafSize: 32})
+	defer g.Close()
+
+	var entries []DecorationEntry
+	for _, key := range []string{"bm-2", "bm-1", "err-1", "bm-10"} {
+		addr := ByteAddress(int64(len(entries)) * 100)
+		entries = append(entries, DecorationEntry{Key: key, Address: &addr})
+	}
+	hit := ByteAddress(250)
+	entries = append(entries, DecorationEntry{Key: "bm-9", Namespace: "search", Address: &hit})
+	g.Decorate(entries)
+
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatal(err)
+	}
+	if n := g.DecorationCount(); n != 5 {
+		t.Errorf("DecorationCount with cold leaves = %d, want 5", n)
+	}
+	keys, err := g.ListDecorationKeys("bm-")
+	if err != nil || fmt.Sprint(keys) != "[bm-1 bm-10 bm-2]" {
+		t.Errorf("ListDecorationKeys(bm-) = %v, %v", keys, err)
+	}
+	keys, _ = g.ListDecorationKeysIn("search", "")
+	if fmt.Sprint(keys) != "[bm-9]" {
+		t.Errorf("ListDecorationKeysIn(search) = %v", keys)
+	}
+	if _, err := g.ListDecorationKeysIn("bad/ns", ""); err != ErrInvalidDecorationKey {
+		t.Errorf("bad namespace: err = %v", err)
+	}
+}
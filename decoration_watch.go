@@ -0,0 +1,148 @@
+package garland
+
+import "sync"
+
+// decoration_watch.go - watching a decoration's position.
+//
+// DESIGN: "return to mark", breakpoint gutters and bookmark lists want
+// to hear when one particular mark moves, not to poll its position
+// after every revision. A watch names a key and a callback; whenever
+// the document reaches a new settled state the watched keys are looked
+// up again and a changed position is reported as (old, new).
+//
+//   - Settled states are: each edit outside a transaction (including
+//     one coalesced into the previous revision), a transaction commit,
+//     and UndoSeek / ForkSeek. Positions inside a transaction are
+//     provisional and are not reported; a rollback returns to the last
+//     reported state, so it reports nothing.
+//   - A removed decoration is reported with new.Byte == -1, and one
+//     that (re)appears - set again, or brought back by undo - with
+//     old.Byte == -1. Positions are ByteAddresses.
+//   - Callbacks never run under the Garland's lock: events are queued
+//     in order and delivered by one goroutine at a time, so a callback
+//     may call back into the Garland. They arrive in the order the
+//     changes happened, shortly after the change (not before the
+//     mutating call returns).
+//   - Cost is one position lookup per watched key per settled state,
+//     so this is for a handful of marks, not for every decoration.
+
+// DecorationWatchFunc is called when a watched decoration moves.
+type DecorationWatchFunc func(old, new AbsoluteAddress)
+
+// decorationWatch is one registered watch.
+type decorationWatch struct {
+	fn   DecorationWatchFunc
+	last int64 // -1 while the key is absent
+}
+
+// watchQueue orders callbacks outside the Garland's lock. Decoration
+// and input-edit watches (input_edit.go) share it, so their callbacks
+// arrive in the order the changes happened.
+type watchQueue struct {
+	mu         sync.Mutex
+	events     []func()
+	delivering bool
+}
+
+// watchedPositionLocked returns stored key's position, -1 if absent.
+// Caller must hold the write lock.
+func (g *Garland) watchedPositionLocked(key string) int64 {
+	addr, err := g.decorationPositionLocked(key)
+	if err != nil {
+		return -1
+	}
+	return addr.Byte
+}
+
+// checkDecorationWatchesLocked looks up every watched key and queues a
+// callback for each watch whose position changed. Caller must hold the
+// write lock.
+func (g *Garland) checkDecorationWatchesLocked() {
+	if len(g.decorationWatches) == 0 {
+		return
+	}
+	var events []func()
+	for key, watches := range g.decorationWatches {
+		pos := g.watchedPositionLocked(key)
+		for _, w := range watches {
+			if w.last != pos {
+				fn, old := w.fn, w.last
+				events = append(events, func() { fn(ByteAddress(old), ByteAddress(pos)) })
+				w.last = pos
+			}
+		}
+	}
+	g.watchQueue.push(events)
+}
+
+// push queues events and starts a delivery goroutine if none is running.
+func (q *watchQueue) push(events []func()) {
+	if len(events) == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.events = append(q.events, events...)
+	start := !q.delivering
+	q.delivering = true
+	q.mu.Unlock()
+	if start {
+		go q.deliver()
+	}
+}
+
+// deliver runs queued callbacks in order until the queue is empty.
+func (q *watchQueue) deliver() {
+	for {
+		q.mu.Lock()
+		if len(q.events) == 0 {
+			q.delivering = false
+			q.mu.Unlock()
+			return
+		}
+		ev := q.events[0]
+		q.events = q.events[1:]
+		q.mu.Unlock()
+		ev()
+	}
+}
+
+// WatchDecoration calls fn whenever decoration key's position changes
+// (see the file comment for when, and how removal is reported). It
+// returns a function that cancels the watch.
+func (g *Garland) WatchDecoration(key string, fn DecorationWatchFunc) (func(), error) {
+	return g.WatchDecorationIn("", key, fn)
+}
+
+// WatchDecorationIn is WatchDecoration for key in namespace ns ("" for
+// the plain key space).
+func (g *Garland) WatchDecorationIn(ns, key string, fn DecorationWatchFunc) (func(), error) {
+	if !ValidDecorationKey(key) || (ns != "" && !ValidDecorationKey(ns)) {
+		return nil, ErrInvalidDecorationKey
+	}
+	stored := namespacedKey(ns, key)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	w := &decorationWatch{fn: fn, last: g.watchedPositionLocked(stored)}
+	if g.decorationWatches == nil {
+		g.decorationWatches = make(map[string][]*decorationWatch)
+	}
+	g.decorationWatches[stored] = append(g.decorationWatches[stored], w)
+
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		watches := g.decorationWatches[stored]
+		for i, other := range watches {
+			if other == w {
+				watches = append(watches[:i:i], watches[i+1:]...)
+				break
+			}
+		}
+		if len(watches) == 0 {
+			delete(g.decorationWatches, stored)
+		} else {
+			g.decorationWatches[stored] = watches
+		}
+	}, nil
+}
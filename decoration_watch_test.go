@@ -0,0 +1,101 @@
+package garland
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// watchLog collects watch callbacks as "old->new" strings.
+func watchLog() (DecorationWatchFunc, func(t *testing.T, n int) []string) {
+	ch := make(chan string, 64)
+	fn := func(old, new AbsoluteAddress) { ch <- fmt.Sprintf("%d->%d", old.Byte, new.Byte) }
+	wait := func(t *testing.T, n int) []string {
+		t.Helper()
+		var got []string
+		for len(got) < n {
+			select {
+			case s := <-ch:
+				got = append(got, s)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("timed out after %v, want %d events", got, n)
+			}
+		}
+		select {
+		case s := <-ch:
+			t.Errorf("unexpected extra event %s after %v", s, got)
+		case <-time.After(20 * time.Millisecond):
+		}
+		return got
+	}
+	return fn, wait
+}
+
+func TestWatchDecorationReportsMovesAndRemoval(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "0123456789abcdef", MaxLeafSize: 4})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	g.Decorate([]DecorationEntry{{Key: "bp", Address: at(10)}})
+	start := g.CurrentRevision()
+
+	fn, wait := watchLog()
+	cancel, err := g.WatchDecoration("bp", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := g.NewCursor()
+	c.InsertString("XY", nil, true) // displaces bp
+	c.SeekByte(15)
+	c.InsertString("after", nil, true) // does not
+	g.Decorate([]DecorationEntry{{Key: "bp"}})
+	if got := fmt.Sprint(wait(t, 2)); got != "[10->12 12->-1]" {
+		t.Errorf("events %s", got)
+	}
+
+	g.UndoSeek(start)
+	if got := fmt.Sprint(wait(t, 1)); got != "[-1->10]" {
+		t.Errorf("after undo: %s", got)
+	}
+
+	cancel()
+	c.SeekByte(0)
+	c.InsertString("Z", nil, true)
+	wait(t, 0)
+}
+
+func TestWatchDecorationWaitsForCommit(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "hello world"})
+	defer g.Close()
+
+	at := func(p int64) *AbsoluteAddress { a := ByteAddress(p); return &a }
+	g.Decorate([]DecorationEntry{{Key: "w", Namespace: "marks", Address: at(6)}})
+	fn, wait := watchLog()
+	if _, err := g.WatchDecorationIn("marks", "w", fn); err != nil {
+		t.Fatal(err)
+	}
+
+	c := g.NewCursor()
+	g.TransactionStart("t")
+	c.InsertString(">>", nil, true)
+	c.InsertString(">>", nil, true)
+	g.TransactionRollback()
+	wait(t, 0)
+
+	g.TransactionStart("t")
+	c.SeekByte(0)
+	c.InsertString(">>", nil, true)
+	c.InsertString(">>", nil, true)
+	wait(t, 0)
+	g.TransactionCommit()
+	if got := fmt.Sprint(wait(t, 1)); got != "[6->10]" {
+		t.Errorf("after commit: %s", got)
+	}
+
+	if _, err := g.WatchDecoration("bad key", fn); err != ErrInvalidDecorationKey {
+		t.Errorf("bad key: err = %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package garland
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"unicode/utf8"
+)
+
+// delta.go - compact binary deltas for mirrored documents.
+//
+// DESIGN: a headless garland process and a UI process (or two
+// machines) each hold the same document; after an edit on one side,
+// the other needs the change, not the document. SerializeDelta encodes
+// the difference between two revisions - derived exactly as OpsBetween
+// derives it, so it costs what the edit touched, not the document size -
+// and ApplyDelta plays it on the mirror as one revision.
+//
+// FORMAT (all integers uvarint):
+//
+//	deltaMagic
+//	fork, fromRevision, toRevision      (sender's coordinates; informational)
+//	baseRunes, targetRunes
+//	opCount, then per op: kind byte, and
+//	    retain / delete: rune count
+//	    insert:          byte length, UTF-8 bytes
+//	CRC-32 (IEEE, little-endian) of everything before it
+//
+// The receiver checks the CRC and that its rune count is baseRunes
+// before touching anything: a delta applied to the wrong base fails
+// with ErrOperationMismatch rather than corrupting the mirror. Keeping
+// the mirror at the right base (sending deltas in order, from the
+// revision the mirror last applied) is the caller's protocol.
+
+// deltaMagic identifies a delta (and its format version).
+const deltaMagic = "GDL1"
+
+// DeltaHeader describes a decoded delta.
+type DeltaHeader struct {
+	Fork         ForkID
+	FromRevision RevisionID
+	ToRevision   RevisionID
+}
+
+// SerializeDelta encodes the change from revision from to revision to
+// of the current fork.
+func (g *Garland) SerializeDelta(from, to RevisionID) ([]byte, error) {
+	op, err := g.OpsBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeDelta(DeltaHeader{Fork: g.CurrentFork(), FromRevision: from, ToRevision: to}, op), nil
+}
+
+// ApplyDelta applies a delta from SerializeDelta as one revision. The
+// document must be at the delta's base (same rune count).
+func (g *Garland) ApplyDelta(data []byte) (ChangeResult, error) {
+	hdr, op, err := DecodeDelta(data)
+	if err != nil {
+		return ChangeResult{}, err
+	}
+	return g.ApplyOps(op, fmt.Sprintf("delta %d..%d", hdr.FromRevision, hdr.ToRevision))
+}
+
+// EncodeDelta encodes an operation in the delta format.
+func EncodeDelta(hdr DeltaHeader, op OTOperation) []byte {
+	buf := []byte(deltaMagic)
+	buf = binary.AppendUvarint(buf, uint64(hdr.Fork))
+	buf = binary.AppendUvarint(buf, uint64(hdr.FromRevision))
+	buf = binary.AppendUvarint(buf, uint64(hdr.ToRevision))
+	buf = binary.AppendUvarint(buf, uint64(op.BaseLength))
+	buf = binary.AppendUvarint(buf, uint64(op.TargetLength))
+	buf = binary.AppendUvarint(buf, uint64(len(op.Ops)))
+	for _, o := range op.Ops {
+		buf = append(buf, byte(o.Kind))
+		if o.Kind == OTInsert {
+			buf = binary.AppendUvarint(buf, uint64(len(o.Text)))
+			buf = append(buf, o.Text...)
+		} else {
+			buf = binary.AppendUvarint(buf, uint64(o.Count))
+		}
+	}
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// DecodeDelta decodes and verifies a delta.
+func DecodeDelta(data []byte) (DeltaHeader, OTOperation, error) {
+	var hdr DeltaHeader
+	var op OTOperation
+	if len(data) < len(deltaMagic)+4 || string(data[:len(deltaMagic)]) != deltaMagic {
+		return hdr, op, ErrCorruptDelta
+	}
+	body := data[:len(data)-4]
+	if binary.LittleEndian.Uint32(data[len(body):]) != crc32.ChecksumIEEE(body) {
+		return hdr, op, ErrCorruptDelta
+	}
+
+	r := bytes.NewReader(body[len(deltaMagic):])
+	var fields [6]uint64
+	for i := range fields {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return hdr, op, ErrCorruptDelta
+		}
+		fields[i] = v
+	}
+	hdr = DeltaHeader{Fork: ForkID(fields[0]), FromRevision: RevisionID(fields[1]), ToRevision: RevisionID(fields[2])}
+	for n := fields[5]; n > 0; n-- {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return hdr, OTOperation{}, ErrCorruptDelta
+		}
+		v, err := binary.ReadUvarint(r)
+		if err != nil || v > math.MaxInt64 {
+			return hdr, OTOperation{}, ErrCorruptDelta
+		}
+		switch OTOpKind(kind) {
+		case OTRetain:
+			op.Retain(int64(v))
+		case OTDelete:
+			op.Delete(int64(v))
+		case OTInsert:
+			if v > uint64(r.Len()) {
+				return hdr, OTOperation{}, ErrCorruptDelta
+			}
+			text := make([]byte, v)
+			r.Read(text)
+			if !utf8.Valid(text) {
+				return hdr, OTOperation{}, ErrCorruptDelta
+			}
+			op.Insert(string(text))
+		default:
+			return hdr, OTOperation{}, ErrCorruptDelta
+		}
+	}
+	if r.Len() != 0 || op.BaseLength != int64(fields[3]) || op.TargetLength != int64(fields[4]) {
+		return hdr, OTOperation{}, ErrCorruptDelta
+	}
+	return hdr, op, nil
+}
@@ -0,0 +1,51 @@
+package garland
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeltaMirrorsDocument(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	base := strings.Repeat("mirror me ünïcode line\n", 200)
+	g, _ := lib.Open(FileOptions{DataString: base, MaxLeafSize: 64})
+	defer g.Close()
+	mirror, _ := lib.Open(FileOptions{DataString: base})
+	defer mirror.Close()
+
+	c := g.NewCursor()
+	last := g.CurrentRevision()
+	for i := 0; i < 5; i++ {
+		c.SeekRune(int64(i * 700))
+		c.InsertString("edit→", nil, true)
+		c.DeleteRunes(3, false)
+
+		delta, err := g.SerializeDelta(last, g.CurrentRevision())
+		if err != nil {
+			t.Fatalf("SerializeDelta: %v", err)
+		}
+		if len(delta) > 64 {
+			t.Errorf("delta for a small edit is %d bytes", len(delta))
+		}
+		if _, err := mirror.ApplyDelta(delta); err != nil {
+			t.Fatalf("ApplyDelta: %v", err)
+		}
+		last = g.CurrentRevision()
+	}
+	if readAllString(t, mirror) != readAllString(t, g) {
+		t.Fatal("mirror diverged")
+	}
+
+	// Replaying an already-applied delta hits the wrong base.
+	c.InsertString("!", nil, true)
+	delta, _ := g.SerializeDelta(last, g.CurrentRevision())
+	mirror.ApplyDelta(delta)
+	if _, err := mirror.ApplyDelta(delta); err != ErrOperationMismatch {
+		t.Errorf("reapply: err = %v, want ErrOperationMismatch", err)
+	}
+
+	delta[len(delta)/2] ^= 0xff
+	if _, err := mirror.ApplyDelta(delta); err != ErrCorruptDelta {
+		t.Errorf("damaged delta: err = %v, want ErrCorruptDelta", err)
+	}
+}
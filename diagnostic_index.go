@@ -0,0 +1,105 @@
+package garland
+
+import "sort"
+
+// diagnostic_index.go - interval index over diagnostic ranges.
+//
+// DESIGN: a renderer asks "which diagnostics touch this line" for every
+// visible line, and a hover asks "which contain byte X"; with thousands
+// of diagnostics a scan per question is the wrong shape. The ranges live
+// outside the tree (diagnostics.go), so the index does too: an interval
+// tree laid out implicitly over the diagnostics sorted by start, each
+// node carrying the greatest End in its subtree. A stabbing or
+// intersection query descends only into subtrees whose max end reaches
+// the query and whose starts precede its end: O(log n + k).
+//
+//   - The index is built on the first query after the marks move and
+//     kept until they move again (any edit, SetDiagnostics, rollback).
+//     Building is O(n log n); edits already cost O(n) to map the marks,
+//     so a typing burst followed by a redraw pays one build, and every
+//     query of the redraw is logarithmic.
+//   - The persistent tree holds only point decorations, so there is no
+//     range decoration to index there; a future in-tree range kind can
+//     reuse this layout per leaf.
+
+// diagnosticIndex is an implicit interval tree: items sorted by start,
+// the node for [lo, hi) at mid = (lo+hi)/2, maxEnd[mid] the greatest
+// End in [lo, hi).
+type diagnosticIndex struct {
+	items  []Diagnostic
+	maxEnd []int64
+}
+
+// buildDiagnosticIndex sorts the diagnostics and fills in max ends.
+func buildDiagnosticIndex(items []Diagnostic) *diagnosticIndex {
+	sort.Slice(items, func(i, j int) bool { return diagnosticLess(items[i], items[j]) })
+	ix := &diagnosticIndex{items: items, maxEnd: make([]int64, len(items))}
+	ix.fill(0, len(items))
+	return ix
+}
+
+// fill computes maxEnd for the node of [lo, hi) and returns it.
+func (ix *diagnosticIndex) fill(lo, hi int) int64 {
+	if lo >= hi {
+		return -1
+	}
+	mid := (lo + hi) / 2
+	m := max(ix.items[mid].End, ix.fill(lo, mid), ix.fill(mid+1, hi))
+	ix.maxEnd[mid] = m
+	return m
+}
+
+// collect appends, in order, the items of [lo, hi) that touch
+// [start, end) - with eof, zero-width items at end count too.
+func (ix *diagnosticIndex) collect(lo, hi int, start, end int64, eof bool, out *[]Diagnostic) {
+	if lo >= hi {
+		return
+	}
+	mid := (lo + hi) / 2
+	if ix.maxEnd[mid] < start {
+		return // nothing here reaches the query
+	}
+	ix.collect(lo, mid, start, end, eof, out)
+	d := ix.items[mid]
+	if d.Start > end || d.Start == end && !eof {
+		return // this and everything to its right start too late
+	}
+	if d.Start < end && d.End > start ||
+		d.Start == d.End && d.Start >= start && (d.Start < end || eof && d.Start == end) {
+		*out = append(*out, d)
+	}
+	ix.collect(mid+1, hi, start, end, eof, out)
+}
+
+// diagnosticIndexLocked returns the index, building it if marks have
+// moved since the last one. Caller must hold the write lock.
+func (g *Garland) diagnosticIndexLocked() *diagnosticIndex {
+	if g.diagnosticIndex == nil {
+		var items []Diagnostic
+		for _, records := range g.diagnostics {
+			for _, r := range records {
+				items = append(items, r.current())
+			}
+		}
+		g.diagnosticIndex = buildDiagnosticIndex(items)
+	}
+	return g.diagnosticIndex
+}
+
+// GetDiagnosticsAt returns the diagnostics of every source whose range
+// contains pos (Start <= pos < End, or zero-width at pos), in document
+// order.
+func (g *Garland) GetDiagnosticsAt(pos int64) ([]Diagnostic, error) {
+	if pos < 0 {
+		return nil, ErrInvalidPosition
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if pos > g.totalBytes {
+		return nil, ErrInvalidPosition
+	}
+	ix := g.diagnosticIndexLocked()
+	var out []Diagnostic
+	ix.collect(0, len(ix.items), pos, pos+1, false, &out)
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package garland
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiagnosticIndexMatchesScan(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("abcdefghij\n", 100), MaxLeafSize: 64})
+	defer g.Close()
+
+	rng := rand.New(rand.NewSource(7))
+	var diags []Diagnostic
+	for i := 0; i < 300; i++ {
+		start := rng.Int63n(1100)
+		end := min(start+rng.Int63n(80), 1100)
+		if i%10 == 0 {
+			end = start // zero-width
+		}
+		diags = append(diags, Diagnostic{Start: start, End: end, Severity: DiagnosticWarning})
+	}
+	if err := g.SetDiagnostics("fuzz", diags); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(when string) {
+		all := g.GetDiagnostics("fuzz")
+		size := g.ByteCount().Value
+		for i := 0; i < 200; i++ {
+			start := rng.Int63n(size + 1)
+			end := start + rng.Int63n(min(40, size-start)+1)
+			got, err := g.GetDiagnosticsInByteRange(start, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			for _, d := range all {
+				if d.Start < end && d.End > start ||
+					d.Start == d.End && d.Start >= start && (d.Start < end || end == size && d.Start == end) {
+					want++
+				}
+			}
+			if len(got) != want {
+				t.Fatalf("%s: [%d, %d) found %d, scan %d", when, start, end, len(got), want)
+			}
+			for j := 1; j < len(got); j++ {
+				if diagnosticLess(got[j], got[j-1]) {
+					t.Fatalf("%s: results out of order at %d", when, j)
+				}
+			}
+		}
+	}
+	check("initial")
+
+	// Edits move the marks; the index must follow.
+	c := g.NewCursor()
+	c.SeekByte(300)
+	c.InsertString(strings.Repeat("new\n", 20), nil, true)
+	c.SeekByte(600)
+	c.DeleteBytes(150, false)
+	check("after edits")
+}
+
+func TestGetDiagnosticsAtStabs(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "func main() { x() }"})
+	defer g.Close()
+
+	g.SetDiagnostics("a", []Diagnostic{
+		{Start: 0, End: 19, Severity: DiagnosticInformation, Message: "whole"},
+		{Start: 14, End: 15, Severity: DiagnosticError, Message: "x"},
+		{Start: 17, End: 17, Severity: DiagnosticHint, Message: "caret"},
+	})
+	for pos, want := range map[int64]int{0: 1, 14: 2, 15: 1, 17: 2, 19: 0} {
+		got, err := g.GetDiagnosticsAt(pos)
+		if err != nil || len(got) != want {
+			t.Errorf("at %d: %+v (%v), want %d", pos, got, err, want)
+		}
+	}
+	if _, err := g.GetDiagnosticsAt(20); err != ErrInvalidPosition {
+		t.Errorf("past end: err = %v", err)
+	}
+}
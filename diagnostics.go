@@ -0,0 +1,183 @@
+package garland
+
+import "sort"
+
+// diagnostics.go - the diagnostics store.
+//
+// DESIGN: compilers, linters and language servers publish diagnostics
+// as a complete set per source ("gopls", "eslint"), replacing whatever
+// that source said before. Each is a byte range with a severity and a
+// message. Between publications the ranges must follow the user's
+// edits, or squiggles drift off the code they describe.
+//
+//   - A diagnostic's range is a pair of ephemeral marks: start with
+//     GravityRight, end with GravityLeft, so typing at either edge does
+//     not grow the range. The marks are mapped by every edit primitive
+//     along with ephemeral decorations; a deleted range collapses to a
+//     zero-width diagnostic at the deletion point.
+//   - Like ephemeral decorations, diagnostics never create revisions and
+//     undo never captures them: they describe the text the tool last
+//     saw, and the tool republishes after undo anyway.
+//   - SetDiagnostics replaces one source's set in a single step. The
+//     whole set is validated before anything changes.
+//   - Severities use the Language Server Protocol's numbering, so LSP
+//     payloads map across directly; 0 means unspecified.
+//   - Zero-width diagnostics at p are reported by range queries with
+//     start <= p < end; at the end of the text, by ranges reaching it
+//     and by the last line.
+
+// DiagnosticSeverity is a diagnostic's severity, numbered as in LSP.
+type DiagnosticSeverity int
+
+const (
+	DiagnosticError       DiagnosticSeverity = 1
+	DiagnosticWarning     DiagnosticSeverity = 2
+	DiagnosticInformation DiagnosticSeverity = 3
+	DiagnosticHint        DiagnosticSeverity = 4
+)
+
+// Diagnostic is one message about a byte range [Start, End).
+type Diagnostic struct {
+	Start    int64
+	End      int64
+	Severity DiagnosticSeverity
+	Code     string
+	Source   string // filled in from the source it was published under
+	Message  string
+}
+
+// diagnosticRecord is a stored diagnostic with its range as marks.
+type diagnosticRecord struct {
+	diag  Diagnostic
+	start ephemeralMark
+	end   ephemeralMark
+}
+
+// current returns the diagnostic at its mapped range.
+func (r *diagnosticRecord) current() Diagnostic {
+	d := r.diag
+	d.Start, d.End = r.start.pos, max(r.end.pos, r.start.pos)
+	return d
+}
+
+// diagnosticLess orders diagnostics by range, then severity, source
+// and message, so query results are deterministic.
+func diagnosticLess(a, b Diagnostic) bool {
+	switch {
+	case a.Start != b.Start:
+		return a.Start < b.Start
+	case a.End != b.End:
+		return a.End < b.End
+	case a.Severity != b.Severity:
+		return a.Severity < b.Severity
+	case a.Source != b.Source:
+		return a.Source < b.Source
+	}
+	return a.Message < b.Message
+}
+
+// SetDiagnostics replaces every diagnostic published by source with
+// diags (empty to clear). It never creates a revision.
+func (g *Garland) SetDiagnostics(source string, diags []Diagnostic) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, d := range diags {
+		if d.Start < 0 || d.End < d.Start || d.End > g.totalBytes {
+			return ErrInvalidPosition
+		}
+		if d.Severity < 0 || d.Severity > DiagnosticHint {
+			return ErrInvalidDiagnostic
+		}
+	}
+	if len(diags) == 0 {
+		delete(g.diagnostics, source)
+		g.diagnosticIndex = nil
+		return nil
+	}
+	records := make([]*diagnosticRecord, len(diags))
+	for i, d := range diags {
+		d.Source = source
+		records[i] = &diagnosticRecord{
+			diag:  d,
+			start: ephemeralMark{pos: d.Start, gravity: GravityRight},
+			end:   ephemeralMark{pos: d.End, gravity: GravityLeft},
+		}
+	}
+	if g.diagnostics == nil {
+		g.diagnostics = make(map[string][]*diagnosticRecord)
+	}
+	g.diagnostics[source] = records
+	g.diagnosticIndex = nil
+	return nil
+}
+
+// ClearDiagnostics removes every diagnostic published by source.
+func (g *Garland) ClearDiagnostics(source string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.diagnostics, source)
+	g.diagnosticIndex = nil
+}
+
+// GetDiagnostics returns the diagnostics published by source at their
+// current ranges, in document order.
+func (g *Garland) GetDiagnostics(source string) []Diagnostic {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var out []Diagnostic
+	for _, r := range g.diagnostics[source] {
+		out = append(out, r.current())
+	}
+	sort.Slice(out, func(i, j int) bool { return diagnosticLess(out[i], out[j]) })
+	return out
+}
+
+// diagnosticsInRangeLocked collects every source's diagnostics touching
+// [start, end); with eof, zero-width ones at end count too. Caller must
+// hold the write lock (the index may be rebuilt).
+func (g *Garland) diagnosticsInRangeLocked(start, end int64, eof bool) []Diagnostic {
+	ix := g.diagnosticIndexLocked()
+	var out []Diagnostic
+	ix.collect(0, len(ix.items), start, end, eof, &out)
+	return out
+}
+
+// GetDiagnosticsInByteRange returns the diagnostics of every source
+// that overlap [start, end), in document order.
+func (g *Garland) GetDiagnosticsInByteRange(start, end int64) ([]Diagnostic, error) {
+	if start < 0 || end < start {
+		return nil, ErrInvalidPosition
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if end > g.totalBytes {
+		return nil, ErrInvalidPosition
+	}
+	return g.diagnosticsInRangeLocked(start, end, end == g.totalBytes), nil
+}
+
+// GetDiagnosticsOnLine returns the diagnostics of every source that
+// overlap line (its newline included), in document order.
+func (g *Garland) GetDiagnosticsOnLine(line int64) ([]Diagnostic, error) {
+	if line < 0 {
+		return nil, ErrInvalidPosition
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	if line > g.totalLines {
+		return nil, ErrInvalidPosition
+	}
+	start, err := g.lineRuneToByteUnlocked(line, 0)
+	if err != nil {
+		return nil, err
+	}
+	end := g.totalBytes
+	if line < g.totalLines {
+		if end, err = g.lineRuneToByteUnlocked(line+1, 0); err != nil {
+			return nil, err
+		}
+	}
+	return g.diagnosticsInRangeLocked(start, end, line == g.totalLines), nil
+}
@@ -0,0 +1,93 @@
+package garland
+
+import "testing"
+
+func TestDiagnosticsFollowEditsAndReplacePerSource(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "x := 1\ny := undefined\nz := y\n", MaxLeafSize: 8})
+	defer g.Close()
+
+	rev := g.CurrentRevision()
+	if err := g.SetDiagnostics("gopls", []Diagnostic{
+		{Start: 12, End: 21, Severity: DiagnosticError, Code: "UndeclaredName", Message: "undefined: undefined"},
+		{Start: 0, End: 1, Severity: DiagnosticWarning, Message: "x declared and not used"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	g.SetDiagnostics("vet", []Diagnostic{{Start: 29, End: 29, Severity: DiagnosticHint, Message: "eof"}})
+	if g.CurrentRevision() != rev {
+		t.Errorf("publishing diagnostics created revision %d", g.CurrentRevision())
+	}
+
+	c := g.NewCursor()
+	c.InsertString("// top\n", nil, true) // everything shifts by 7
+	c.SeekByte(19)
+	c.InsertString("no", nil, true) // at the error's start: it does not grow
+	diags := g.GetDiagnostics("gopls")
+	if len(diags) != 2 || diags[0].Start != 7 || diags[1].Start != 21 || diags[1].End != 30 || diags[1].Source != "gopls" {
+		t.Errorf("after edits: %+v", diags)
+	}
+
+	if line, _ := g.GetDiagnosticsOnLine(2); len(line) != 1 || line[0].Code != "UndeclaredName" {
+		t.Errorf("line 2: %+v", line)
+	}
+	if line, _ := g.GetDiagnosticsOnLine(4); len(line) != 1 || line[0].Source != "vet" {
+		t.Errorf("last line: %+v", line)
+	}
+	if inRange, _ := g.GetDiagnosticsInByteRange(0, 22); len(inRange) != 2 {
+		t.Errorf("range [0, 22): %+v", inRange)
+	}
+
+	// Deleting the error's text collapses it; republishing replaces the set.
+	c.SeekByte(21)
+	c.DeleteBytes(9, false)
+	if d := g.GetDiagnostics("gopls"); d[1].Start != 21 || d[1].End != 21 {
+		t.Errorf("after delete: %+v", d[1])
+	}
+	g.SetDiagnostics("gopls", []Diagnostic{{Start: 7, End: 9, Message: "fresh"}})
+	if d := g.GetDiagnostics("gopls"); len(d) != 1 || d[0].Message != "fresh" {
+		t.Errorf("after republish: %+v", d)
+	}
+	if d := g.GetDiagnostics("vet"); len(d) != 1 {
+		t.Errorf("other source touched: %+v", d)
+	}
+	if v := g.CheckInvariants(); v != nil {
+		t.Errorf("invariants: %v", v)
+	}
+}
+
+func TestSetDiagnosticsValidatesWholeSet(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "0123456789"})
+	defer g.Close()
+
+	g.SetDiagnostics("lint", []Diagnostic{{Start: 1, End: 2, Message: "kept"}})
+	for _, bad := range []struct {
+		d    Diagnostic
+		want error
+	}{
+		{Diagnostic{Start: 4, End: 3}, ErrInvalidPosition},
+		{Diagnostic{Start: 4, End: 11}, ErrInvalidPosition},
+		{Diagnostic{Start: 4, End: 5, Severity: 5}, ErrInvalidDiagnostic},
+	} {
+		err := g.SetDiagnostics("lint", []Diagnostic{{Start: 0, End: 1}, bad.d})
+		if err != bad.want {
+			t.Errorf("%+v: err = %v, want %v", bad.d, err, bad.want)
+		}
+	}
+	if d := g.GetDiagnostics("lint"); len(d) != 1 || d[0].Message != "kept" {
+		t.Errorf("rejected set applied: %+v", d)
+	}
+
+	g.TransactionStart("t")
+	c := g.NewCursor()
+	c.InsertString(">>", nil, true)
+	g.TransactionRollback()
+	if d := g.GetDiagnostics("lint"); d[0].Start != 1 {
+		t.Errorf("after rollback: %+v", d)
+	}
+	g.ClearDiagnostics("lint")
+	if d, _ := g.GetDiagnosticsInByteRange(0, 10); len(d) != 0 {
+		t.Errorf("after clear: %+v", d)
+	}
+}
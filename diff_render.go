@@ -0,0 +1,304 @@
+package garland
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+)
+
+// diff_render.go - diffs rendered for people, with decoration overlays.
+//
+// DESIGN: a "preview changes before save" pane and a review view of an
+// editing session both want the diff already styled, with the marks an
+// application cares about (diagnostics anchors, bookmarks, review
+// comments) shown where they sit. RenderRevisionDiff renders the change
+// between two revisions of the current lineage; RenderSourceDiff the
+// change from the file on disk to the current revision. Both produce
+// ANSI-colored text for a terminal or an HTML fragment.
+//
+//   - The diff is the line diff DiffAgainstSource computes (hashed
+//     lines, Myers, hunks grouped when their context would touch); the
+//     layout is unified: hunk headers, then context, deleted and added
+//     lines.
+//   - Overlays are decoration namespaces chosen by the caller ("" is
+//     the un-namespaced one). A mark is drawn inline, before the byte it
+//     sits on: deleted lines show the old version's marks, context and
+//     added lines the new version's. A mark at the very end of a
+//     document without a final newline is drawn at the end of the last
+//     line.
+//   - ANSI output uses the 16-color palette (red deletions, green
+//     additions, cyan hunk headers) with marks in reverse video. HTML
+//     output is one <pre class="garland-diff"> whose lines are spans of
+//     class file, hunk, ctx, del or add and whose marks are
+//     <mark class="decoration"> elements, all escaped; styling is left
+//     to the page.
+//   - Revisions are read under the lock and rendered into memory, then
+//     written after it is released; the output is bounded by the hunks
+//     and their context. Like OpsBetween, a revision diff is refused
+//     during a transaction or a streaming load. The source diff reads
+//     as DiffAgainstSource does.
+
+// DiffFormat selects the rendered diff's output.
+type DiffFormat int
+
+const (
+	DiffANSI DiffFormat = iota // ANSI-colored text for terminals
+	DiffHTML                   // an HTML fragment
+)
+
+// DiffRenderOptions controls RenderRevisionDiff and RenderSourceDiff.
+type DiffRenderOptions struct {
+	Format       DiffFormat
+	ContextLines int      // unchanged lines shown around each change
+	Namespaces   []string // decoration namespaces to overlay ("" for un-namespaced)
+}
+
+// diffMark is one overlaid decoration.
+type diffMark struct {
+	pos   int64
+	label string
+}
+
+// RenderRevisionDiff writes the change from revision from to revision
+// to (both in the current fork's lineage) to w. Nothing is written when
+// they have the same content.
+func (g *Garland) RenderRevisionDiff(w io.Writer, from, to RevisionID, opts DiffRenderOptions) error {
+	var buf bytes.Buffer
+	if err := g.renderRevisionDiff(&buf, from, to, opts); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// renderRevisionDiff renders into buf under the lock.
+func (g *Garland) renderRevisionDiff(buf *bytes.Buffer, from, to RevisionID, opts DiffRenderOptions) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.transaction != nil {
+		return ErrTransactionPending
+	}
+	if g.loader != nil && !g.loader.eofReached {
+		return ErrNotReady
+	}
+	a, err := g.revisionStateLocked(from)
+	if err != nil {
+		return err
+	}
+	b, err := g.revisionStateLocked(to)
+	if err != nil {
+		return err
+	}
+
+	reader := func(st treeState) func(pos, length int64) ([]byte, error) {
+		return func(pos, length int64) (data []byte, err error) {
+			err = g.withStateLocked(st, func() error {
+				data, err = g.readBytesRangeInternal(pos, min(length, g.totalBytes-pos))
+				return err
+			})
+			return data, err
+		}
+	}
+	d := &sourceDiff{readOld: reader(a), readNew: reader(b), newState: b}
+	if d.old, err = indexLines(d.readOld, a.rootSnap().byteCount); err != nil {
+		return err
+	}
+	if d.new, err = indexLines(d.readNew, b.rootSnap().byteCount); err != nil {
+		return err
+	}
+	d.hunks = diffLineIndexes(d.old, d.new)
+
+	oldMarks, err := g.diffMarksLocked(a, opts.Namespaces)
+	if err != nil {
+		return err
+	}
+	newMarks, err := g.diffMarksLocked(b, opts.Namespaces)
+	if err != nil {
+		return err
+	}
+	return d.render(buf, opts, fmt.Sprintf("revision %d", from), fmt.Sprintf("revision %d", to), oldMarks, newMarks)
+}
+
+// RenderSourceDiff writes the change from the file at the source path
+// to the current revision to w: the pre-save preview. The file side
+// has no marks. Returns ErrNoDataSource when there is no source path.
+func (g *Garland) RenderSourceDiff(w io.Writer, opts DiffRenderOptions) error {
+	return g.withSourceDiff(func(d *sourceDiff) error {
+		g.mu.Lock()
+		marks, err := g.diffMarksLocked(d.newState, opts.Namespaces)
+		g.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		return d.render(w, opts, d.path, d.path+" (buffer)", nil, marks)
+	})
+}
+
+// indexLines streams length bytes through read into a lineIndex.
+func indexLines(read func(pos, length int64) ([]byte, error), length int64) (lineIndex, error) {
+	li := newLineIndexer()
+	for pos := int64(0); pos < length; pos += diffChunk {
+		data, err := read(pos, min(diffChunk, length-pos))
+		if err != nil {
+			return lineIndex{}, err
+		}
+		li.write(data)
+	}
+	return li.finish(), nil
+}
+
+// diffMarksLocked returns st's decorations in the given namespaces, in
+// position order. Caller must hold the write lock.
+func (g *Garland) diffMarksLocked(st treeState, namespaces []string) ([]diffMark, error) {
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+	wanted := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		wanted[ns] = true
+	}
+	entries, err := g.decorationsAtLocked(st)
+	if err != nil {
+		return nil, err
+	}
+	var marks []diffMark
+	for _, e := range entries {
+		if !wanted[e.Namespace] || e.Address == nil {
+			continue
+		}
+		label := e.Key
+		if e.Namespace != "" {
+			label = e.Namespace + ":" + e.Key
+		}
+		marks = append(marks, diffMark{pos: e.Address.Byte, label: label})
+	}
+	sort.SliceStable(marks, func(i, j int) bool { return marks[i].pos < marks[j].pos })
+	return marks, nil
+}
+
+// diffPainter writes styled diff lines in one format.
+type diffPainter struct {
+	w      *bufio.Writer
+	format DiffFormat
+}
+
+// ANSI styles and HTML classes per line kind.
+var (
+	diffANSIStyle = map[string]string{"file": "\x1b[1m", "hunk": "\x1b[36m", "del": "\x1b[31m", "add": "\x1b[32m", "ctx": ""}
+	diffPrefix    = map[string]string{"del": "-", "add": "+", "ctx": " "}
+)
+
+// header writes a file or hunk header line.
+func (p *diffPainter) header(kind, text string) {
+	if p.format == DiffHTML {
+		fmt.Fprintf(p.w, "<span class=\"%s\">%s</span>\n", kind, html.EscapeString(text))
+		return
+	}
+	fmt.Fprintf(p.w, "%s%s\x1b[0m\n", diffANSIStyle[kind], text)
+}
+
+// line writes one document line (without its newline) of kind, with
+// marks at their offsets into it.
+func (p *diffPainter) line(kind string, text []byte, marks []diffMark, start int64, noEOL bool) {
+	style := diffANSIStyle[kind]
+	if p.format == DiffHTML {
+		fmt.Fprintf(p.w, "<span class=\"%s\">%s", kind, diffPrefix[kind])
+	} else {
+		p.w.WriteString(style + diffPrefix[kind])
+	}
+	at := 0
+	for _, m := range marks {
+		off := int(min(m.pos-start, int64(len(text))))
+		p.text(text[at:off])
+		at = off
+		if p.format == DiffHTML {
+			fmt.Fprintf(p.w, "<mark class=\"decoration\">%s</mark>", html.EscapeString(m.label))
+		} else {
+			fmt.Fprintf(p.w, "\x1b[7m%s\x1b[27m", m.label)
+		}
+	}
+	p.text(text[at:])
+	if p.format == DiffHTML {
+		p.w.WriteString("</span>\n")
+	} else {
+		p.w.WriteString("\x1b[0m\n")
+	}
+	if noEOL {
+		p.header("ctx", `\ No newline at end of file`)
+	}
+}
+
+func (p *diffPainter) text(b []byte) {
+	if p.format == DiffHTML {
+		p.w.WriteString(html.EscapeString(string(b)))
+	} else {
+		p.w.Write(b)
+	}
+}
+
+// render writes the diff with overlays.
+func (d *sourceDiff) render(w io.Writer, opts DiffRenderOptions, oldName, newName string, oldMarks, newMarks []diffMark) error {
+	if len(d.hunks) == 0 {
+		return nil
+	}
+	p := &diffPainter{w: bufio.NewWriter(w), format: opts.Format}
+	if p.format == DiffHTML {
+		p.w.WriteString("<pre class=\"garland-diff\">")
+	}
+	p.header("file", "--- "+oldName)
+	p.header("file", "+++ "+newName)
+
+	// lines paints lines [lo, hi) of one side.
+	lines := func(kind string, read func(pos, length int64) ([]byte, error), idx lineIndex, marks []diffMark, lo, hi int64) error {
+		for l := lo; l < hi; l++ {
+			start, end := idx.offs[l], idx.offs[l+1]
+			data, err := read(start, end-start)
+			if err != nil {
+				return err
+			}
+			noEOL := len(data) == 0 || data[len(data)-1] != '\n'
+			text := bytes.TrimSuffix(data, []byte{'\n'})
+			p.line(kind, text, marksIn(marks, start, end, noEOL), start, noEOL)
+		}
+		return nil
+	}
+	err := d.eachGroup(int64(max(opts.ContextLines, 0)), func(oLo, oHi, nLo, nHi int64, hunks []DiffHunk) error {
+		p.header("hunk", fmt.Sprintf("@@ -%s +%s @@", unifiedRange(oLo, oHi-oLo), unifiedRange(nLo, nHi-nLo)))
+		n := nLo
+		for _, h := range hunks {
+			if err := lines("ctx", d.readNew, d.new, newMarks, n, h.NewLine); err != nil {
+				return err
+			}
+			if err := lines("del", d.readOld, d.old, oldMarks, h.OldLine, h.OldLine+h.OldLines); err != nil {
+				return err
+			}
+			if err := lines("add", d.readNew, d.new, newMarks, h.NewLine, h.NewLine+h.NewLines); err != nil {
+				return err
+			}
+			n = h.NewLine + h.NewLines
+		}
+		return lines("ctx", d.readNew, d.new, newMarks, n, nHi)
+	})
+	if err != nil {
+		return err
+	}
+	if p.format == DiffHTML {
+		p.w.WriteString("</pre>\n")
+	}
+	return p.w.Flush()
+}
+
+// marksIn returns the marks on the line [start, end); a line without a
+// newline (the last) also takes a mark at its end.
+func marksIn(marks []diffMark, start, end int64, noEOL bool) []diffMark {
+	lo := sort.Search(len(marks), func(i int) bool { return marks[i].pos >= start })
+	hi := lo
+	for hi < len(marks) && (marks[hi].pos < end || (noEOL && marks[hi].pos == end)) {
+		hi++
+	}
+	return marks[lo:hi]
+}
@@ -0,0 +1,80 @@
+package garland
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderRevisionDiff(t *testing.T) {
+	g, c := openWithRevisions(t, nil)
+	c.SeekByte(g.ByteCount().Value)
+	c.InsertString("a <b>\nlast", nil, true)
+	rev1 := g.CurrentRevision()
+	at, tail := ByteAddress(15), EOFAddress()
+	g.Decorate([]DecorationEntry{
+		{Key: "note", Namespace: "review", Address: &at},
+		{Key: "end", Namespace: "review", Address: &tail},
+		{Key: "hidden", Namespace: "other", Address: &at},
+	})
+	c.SeekByte(0)
+	c.DeleteBytes(5, false) // "rev0 " goes
+
+	var out bytes.Buffer
+	opts := DiffRenderOptions{Format: DiffHTML, ContextLines: 1, Namespaces: []string{"review"}}
+	if err := g.RenderRevisionDiff(&out, rev1, g.CurrentRevision(), opts); err != nil {
+		t.Fatal(err)
+	}
+	want := `<pre class="garland-diff"><span class="file">--- revision 1</span>
+<span class="file">+++ revision 3</span>
+<span class="hunk">@@ -1,2 +1,2 @@</span>
+<span class="del">-rev0 content</span>
+<span class="add">+content</span>
+<span class="ctx"> a <mark class="decoration">review:note</mark>&lt;b&gt;</span>
+</pre>
+`
+	if out.String() != want {
+		t.Errorf("html:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	opts = DiffRenderOptions{Format: DiffANSI, ContextLines: 5, Namespaces: []string{"review"}}
+	if err := g.RenderRevisionDiff(&out, rev1, g.CurrentRevision(), opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{"\x1b[31m-rev0 content\x1b[0m\n", "\x1b[32m+content\x1b[0m\n",
+		" last\x1b[7mreview:end\x1b[27m\x1b[0m\n", `\ No newline at end of file`} {
+		if !strings.Contains(out.String(), part) {
+			t.Errorf("ansi output lacks %q:\n%q", part, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := g.RenderRevisionDiff(&out, rev1, rev1, opts); err != nil || out.Len() != 0 {
+		t.Errorf("same revision: %q, %v", out.String(), err)
+	}
+	if err := g.RenderRevisionDiff(&out, rev1, 99, opts); err != ErrRevisionNotFound {
+		t.Errorf("unknown revision: err = %v", err)
+	}
+}
+
+func TestRenderSourceDiff(t *testing.T) {
+	g, c := openSourceFile(t, "one\ntwo\nthree\n")
+	c.SeekByte(4)
+	c.DeleteBytes(3, false)
+	c.InsertString("2", nil, true)
+	at := ByteAddress(4)
+	g.Decorate([]DecorationEntry{{Key: "here", Address: &at}})
+
+	var out bytes.Buffer
+	if err := g.RenderSourceDiff(&out, DiffRenderOptions{Namespaces: []string{""}}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 6 || !strings.HasSuffix(lines[1], "(buffer)\x1b[0m") ||
+		lines[2] != "\x1b[36m@@ -2,1 +2,1 @@\x1b[0m" ||
+		lines[3] != "\x1b[31m-two\x1b[0m" ||
+		lines[4] != "\x1b[32m+\x1b[7mhere\x1b[27m2\x1b[0m" {
+		t.Errorf("source diff:\n%q", out.String())
+	}
+}
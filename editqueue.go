@@ -0,0 +1,189 @@
+package garland
+
+import (
+	"fmt"
+	"sync"
+)
+
+// editqueue.go - the serialized mutation queue (SubmitEdit).
+//
+// DESIGN: each mutation is safe on its own (it runs under g.mu), but a
+// logical edit is usually several - delete a range, insert the
+// replacement, move a mark - and two producers (an LSP handler applying
+// a workspace edit, the UI typing, a formatter plugin) interleave
+// those steps freely. The transaction API groups steps, but it is
+// single-goroutine state: two goroutines in TransactionStart at once
+// corrupt each other.
+//
+// SubmitEdit hands a whole edit to ONE writer goroutine per Garland.
+// The writer runs each EditFunc inside its own transaction, in
+// submission order: the edit's steps never interleave with another
+// edit's, it lands as one revision (named by the submitter), and an
+// error (or panic) from the func rolls every step back. The result -
+// the new revision, or the error - arrives on the returned channel, so
+// a producer can wait for it or carry on.
+//
+// RULES:
+//   - Once edits go through the queue, ALL edits should: a direct
+//     mutation or transaction from another goroutine can land in the
+//     middle of a queued edit's transaction.
+//   - Readers see each step as it happens (the edit mutates the live
+//     tree). Readers that need committed states only use Snapshot().
+//   - An EditFunc must not call SubmitEdit and wait on the result - the
+//     writer would wait on itself.
+//
+// The writer starts with the first SubmitEdit and stops on Close; edits
+// still queued at Close fail with ErrEditQueueClosed.
+
+// DefaultEditQueueSize is the submission buffer used when
+// FileOptions.EditQueueSize is 0. A full buffer makes SubmitEdit wait.
+const DefaultEditQueueSize = 64
+
+// EditFunc performs one logical edit. c is a cursor owned by the queue's
+// writer (ephemeral: position it freely, it is shared only with later
+// edits). Returning an error rolls the whole edit back.
+type EditFunc func(g *Garland, c *Cursor) error
+
+// EditResult is the outcome of a submitted edit.
+type EditResult struct {
+	Change ChangeResult // the revision the edit committed as
+	Err    error        // non-nil if the edit failed and was rolled back
+}
+
+type editRequest struct {
+	name   string
+	fn     EditFunc
+	expect *ChangeResult // compare-and-edit guard (cas_edit.go), or nil
+	done   chan EditResult
+}
+
+type editQueue struct {
+	reqs chan editRequest
+	stop chan struct{}
+	mu   sync.RWMutex // held shared by senders, exclusive by stop
+	shut bool
+	exit chan struct{}
+}
+
+// SubmitEdit queues fn to run as one transaction (named name) on the
+// Garland's writer goroutine, and returns a channel that receives its
+// result exactly once.
+func (g *Garland) SubmitEdit(name string, fn EditFunc) <-chan EditResult {
+	return g.submitEdit(editRequest{name: name, fn: fn})
+}
+
+// submitEdit queues r and returns its result channel.
+func (g *Garland) submitEdit(r editRequest) <-chan EditResult {
+	done := make(chan EditResult, 1)
+	r.done = done
+	q := g.editQueueStart()
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.shut {
+		done <- EditResult{Err: ErrEditQueueClosed}
+		return done
+	}
+	select {
+	case q.reqs <- r:
+	case <-q.stop:
+		done <- EditResult{Err: ErrEditQueueClosed}
+	}
+	return done
+}
+
+// ApplyEdit submits fn and waits for its result.
+func (g *Garland) ApplyEdit(name string, fn EditFunc) (ChangeResult, error) {
+	r := <-g.SubmitEdit(name, fn)
+	return r.Change, r.Err
+}
+
+// editQueueStart returns the writer's queue, starting it on first use.
+func (g *Garland) editQueueStart() *editQueue {
+	g.editsOnce.Do(func() {
+		size := g.editQueueSize
+		if size <= 0 {
+			size = DefaultEditQueueSize
+		}
+		q := &editQueue{
+			reqs: make(chan editRequest, size),
+			stop: make(chan struct{}),
+			exit: make(chan struct{}),
+		}
+		g.mu.Lock()
+		g.edits = q
+		g.mu.Unlock()
+		go g.runEditQueue(q)
+	})
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.edits
+}
+
+// runEditQueue is the writer goroutine.
+func (g *Garland) runEditQueue(q *editQueue) {
+	defer close(q.exit)
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+	for {
+		select {
+		case r := <-q.reqs:
+			r.done <- g.applyQueuedEdit(c, r)
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// applyQueuedEdit runs one edit inside its own transaction.
+func (g *Garland) applyQueuedEdit(c *Cursor, r editRequest) (res EditResult) {
+	if r.expect != nil {
+		if now := g.currentVersion(); now != *r.expect {
+			return EditResult{Change: now, Err: ErrStaleRevision}
+		}
+	}
+	if err := g.TransactionStart(r.name); err != nil {
+		return EditResult{Err: err}
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			g.TransactionRollback()
+			res = EditResult{Err: fmt.Errorf("garland: edit %q panicked: %v", r.name, p)}
+		}
+	}()
+	if err := r.fn(g, c); err != nil {
+		g.TransactionRollback()
+		return EditResult{Err: err}
+	}
+	change, err := g.TransactionCommit()
+	return EditResult{Change: change, Err: err}
+}
+
+// stopEditQueue stops the writer (if it ever started) and fails any
+// edits still queued. Called from Close.
+func (g *Garland) stopEditQueue() {
+	g.mu.RLock()
+	q := g.edits
+	g.mu.RUnlock()
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	if q.shut {
+		q.mu.Unlock()
+		return
+	}
+	q.shut = true
+	close(q.stop)
+	q.mu.Unlock()
+	<-q.exit
+
+	for {
+		select {
+		case r := <-q.reqs:
+			r.done <- EditResult{Err: ErrEditQueueClosed}
+		default:
+			return
+		}
+	}
+}
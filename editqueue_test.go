@@ -0,0 +1,111 @@
+package garland
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSubmitEditSerializesProducers(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "|", MaxLeafSize: 16})
+	defer g.Close()
+
+	const producers, edits = 8, 25
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < edits; i++ {
+				// Three steps per edit; they must land together.
+				r := <-g.SubmitEdit("append", func(g *Garland, c *Cursor) error {
+					for _, part := range []string{"<", fmt.Sprint(p), ">"} {
+						if err := c.SeekByte(g.ByteCount().Value); err != nil {
+							return err
+						}
+						if _, err := c.InsertString(part, nil, true); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if r.Err != nil {
+					t.Errorf("producer %d: %v", p, r.Err)
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	data, _ := g.NewCursor().ReadBytes(g.ByteCount().Value)
+	body := strings.TrimPrefix(string(data), "|")
+	if n := strings.Count(body, "<"); n != producers*edits {
+		t.Fatalf("%d edits landed, want %d", n, producers*edits)
+	}
+	for _, chunk := range strings.SplitAfter(body, ">") {
+		if chunk == "" {
+			continue
+		}
+		if len(chunk) != 3 || chunk[0] != '<' || chunk[2] != '>' {
+			t.Fatalf("interleaved edit %q in %q", chunk, body)
+		}
+	}
+	if g.CurrentRevision() != producers*edits {
+		t.Errorf("revision %d, want one per edit (%d)", g.CurrentRevision(), producers*edits)
+	}
+}
+
+func TestSubmitEditRollsBackFailures(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "keep"})
+	defer g.Close()
+
+	boom := errors.New("boom")
+	_, err := g.ApplyEdit("fails", func(g *Garland, c *Cursor) error {
+		c.InsertString("lost ", nil, true)
+		return boom
+	})
+	if err != boom {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	_, err = g.ApplyEdit("panics", func(g *Garland, c *Cursor) error {
+		c.InsertString("lost ", nil, true)
+		panic("bad plugin")
+	})
+	if err == nil || !strings.Contains(err.Error(), "bad plugin") {
+		t.Fatalf("panic err = %v", err)
+	}
+
+	change, err := g.ApplyEdit("works", func(g *Garland, c *Cursor) error {
+		c.SeekByte(0)
+		_, err := c.InsertString("I ", nil, true)
+		return err
+	})
+	if err != nil || change.Revision != 1 {
+		t.Fatalf("ApplyEdit = %+v, %v", change, err)
+	}
+	if data, _ := g.NewCursor().ReadBytes(g.ByteCount().Value); string(data) != "I keep" {
+		t.Errorf("content = %q", data)
+	}
+}
+
+func TestSubmitEditAfterClose(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "x", EditQueueSize: 1})
+
+	if _, err := g.ApplyEdit("first", func(*Garland, *Cursor) error { return nil }); err != nil {
+		t.Fatalf("ApplyEdit: %v", err)
+	}
+	g.Close()
+	r := <-g.SubmitEdit("late", func(*Garland, *Cursor) error {
+		t.Error("edit ran after Close")
+		return nil
+	})
+	if r.Err != ErrEditQueueClosed {
+		t.Errorf("err = %v, want ErrEditQueueClosed", r.Err)
+	}
+}
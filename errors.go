@@ -21,6 +21,14 @@ var (
 	// ErrOverlappingRanges indicates that source and destination ranges overlap
 	// in an operation that doesn't allow overlap (e.g., Move).
 	ErrOverlappingRanges = errors.New("source and destination ranges overlap")
+
+	// ErrLineBreak indicates that text given as one line (LineSlice)
+	// contains a newline.
+	ErrLineBreak = errors.New("line text contains a line break")
+
+	// ErrInvalidHex indicates a hex digit or nibble value out of range
+	// (OverwriteHex, OverwriteNibble).
+	ErrInvalidHex = errors.New("invalid hex digit or nibble")
 )
 
 // Decoration errors
@@ -33,6 +41,14 @@ var (
 	// letters, digits, '_', '.', '#', and '-' only, non-empty. This
 	// keeps every serialization of keys framing-safe by construction.
 	ErrInvalidDecorationKey = errors.New("invalid decoration key: letters, digits, '_', '.', '#', '-' only")
+
+	// ErrDecorationFormat indicates a decoration dump that is malformed
+	// or written in a version this build cannot read.
+	ErrDecorationFormat = errors.New("malformed or unsupported decoration dump")
+
+	// ErrInvalidDiagnostic indicates a diagnostic with a severity outside
+	// the LSP range (0 for unspecified, 1-4).
+	ErrInvalidDiagnostic = errors.New("invalid diagnostic severity")
 )
 
 // Versioning errors
@@ -42,6 +58,29 @@ var (
 
 	// ErrRevisionNotFound indicates that a revision does not exist in the current fork.
 	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrSnapshotReleased indicates a read through a SnapshotView after
+	// its Release.
+	ErrSnapshotReleased = errors.New("snapshot view released")
+
+	// ErrStaleRevision indicates a compare-and-edit whose expected fork
+	// and revision are no longer current: the document has moved on.
+	ErrStaleRevision = errors.New("document has moved past the expected revision")
+
+	// ErrOperationMismatch indicates an OT operation whose lengths do not
+	// fit the document or the operation it is combined with.
+	ErrOperationMismatch = errors.New("operation length does not match")
+
+	// ErrCorruptDelta indicates a delta that fails to decode or verify.
+	ErrCorruptDelta = errors.New("corrupt delta")
+
+	// ErrInvalidSiteID indicates a CRDT replica site ID of zero (reserved
+	// for the shared initial content).
+	ErrInvalidSiteID = errors.New("invalid CRDT site ID")
+
+	// ErrCRDTFork indicates that the Garland moved to another fork than
+	// the one its CRDT replica follows.
+	ErrCRDTFork = errors.New("document left the CRDT replica's fork")
 )
 
 // Storage errors
@@ -62,11 +101,42 @@ var (
 	// location could be verified and adopted (TryRecoverSource).
 	ErrNoRecoverySource = errors.New("no alternate save location could be adopted")
 
+	// ErrNoJournal indicates that Recover found no crash-recovery
+	// journal for the file.
+	ErrNoJournal = errors.New("no recovery journal")
+
+	// ErrCorruptJournal indicates a recovery journal whose header or
+	// base record cannot be read.
+	ErrCorruptJournal = errors.New("corrupt recovery journal")
+
+	// ErrJournalMismatch indicates a recovery journal whose base no
+	// longer matches its source file: the file changed after the
+	// journal began, so the journaled edits do not apply to it.
+	ErrJournalMismatch = errors.New("recovery journal does not match its source")
+
 	// ErrMemoryPressure indicates that memory limits are exceeded and cannot be reduced.
 	// This occurs when hard memory limit is set but no cold storage is configured,
 	// or when cold storage is full/unavailable. The application should handle this
 	// by closing unused garlands, reducing operations, or configuring cold storage.
 	ErrMemoryPressure = errors.New("memory limit exceeded and cannot be reduced")
+
+	// ErrColdStorageQuota indicates that a chill was refused because it
+	// would push cold storage past LibraryOptions.ColdStorageQuota. The
+	// data stays in memory.
+	ErrColdStorageQuota = errors.New("cold storage quota exceeded")
+
+	// ErrPinned indicates that a leaf could not be chilled because a
+	// zero-copy read still borrows its data (Cursor.ReadBytesZeroCopy).
+	ErrPinned = errors.New("leaf is pinned by a zero-copy read")
+
+	// ErrBundleFormat indicates a bundle (ImportBundle) that is
+	// malformed, from a newer version, or does not replay to the text
+	// it recorded.
+	ErrBundleFormat = errors.New("malformed or unsupported bundle")
+
+	// ErrBundleSourceMismatch indicates that the source file a bundle
+	// refers to does not hold the bundle's base text.
+	ErrBundleSourceMismatch = errors.New("bundle source file does not match its base")
 )
 
 // File system errors
@@ -76,6 +146,14 @@ var (
 
 	// ErrFileNotOpen indicates that the file handle is not open.
 	ErrFileNotOpen = errors.New("file not open")
+
+	// ErrFileLocked indicates that another holder has the advisory lock
+	// on a file (FileOptions.AdvisoryLock).
+	ErrFileLocked = errors.New("file is locked by another process")
+
+	// ErrSaveVetoed is available to pre-save hooks (AddSaveHook) that
+	// refuse a save without a more specific error.
+	ErrSaveVetoed = errors.New("save vetoed by a save hook")
 )
 
 // Region errors
@@ -97,12 +175,41 @@ var (
 
 	// ErrNoTransaction indicates that there is no active transaction.
 	ErrNoTransaction = errors.New("no active transaction")
+
+	// ErrEditQueueClosed indicates that an edit was submitted to, or still
+	// queued in, the edit queue of a closed Garland.
+	ErrEditQueueClosed = errors.New("edit queue closed")
 )
 
 // Cursor errors
 var (
 	// ErrCursorNotFound indicates that the cursor does not belong to this garland.
 	ErrCursorNotFound = errors.New("cursor not found")
+
+	// ErrNoSelection indicates that the cursor has no anchor set.
+	ErrNoSelection = errors.New("cursor has no selection")
+
+	// ErrNoDelimiter indicates that there is no delimiter at the cursor.
+	ErrNoDelimiter = errors.New("no delimiter at cursor")
+
+	// ErrUnmatchedDelimiter indicates that a delimiter has no partner
+	// (within the scan limit).
+	ErrUnmatchedDelimiter = errors.New("unmatched delimiter")
+
+	// ErrCursorStateFormat indicates a malformed or unsupported
+	// serialized cursor.
+	ErrCursorStateFormat = errors.New("malformed or unsupported cursor state")
+
+	// ErrOutsideRestriction indicates an edit through a restricted
+	// cursor that reaches outside its range.
+	ErrOutsideRestriction = errors.New("edit outside the cursor's restricted range")
+
+	// ErrDelimiterNotFound indicates that ReadUntil found no delimiter
+	// within its byte limit.
+	ErrDelimiterNotFound = errors.New("delimiter not found within limit")
+
+	// ErrGhostCursor indicates an edit through a read-only ghost cursor.
+	ErrGhostCursor = errors.New("ghost cursors are read-only")
 )
 
 // Tree structure errors
@@ -112,6 +219,14 @@ var (
 
 	// ErrInternal indicates an internal consistency error (should not happen).
 	ErrInternal = errors.New("internal error")
+
+	// ErrReplayLog indicates a replay log (FileOptions.RecordTo) that
+	// cannot be parsed or does not begin with its open record.
+	ErrReplayLog = errors.New("malformed replay log")
+
+	// ErrReplayDiverged indicates a replay whose outcome differs from
+	// the recorded session (see ReplayReport.Divergence).
+	ErrReplayDiverged = errors.New("replay diverged from the recorded session")
 )
 
 // Configuration errors
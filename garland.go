@@ -1,6 +1,11 @@
 package garland
 
 import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -87,6 +92,28 @@ type LibraryOptions struct {
 	// ColdStorageBackend is a custom cold storage implementation.
 	ColdStorageBackend ColdStorageInterface
 
+	// ColdStorageFile selects the single-file backend: every cold block
+	// lives in one pack file at this path instead of one file per block
+	// (see coldpack.go). Ignored when ColdStorageBackend is set. When
+	// ColdStoragePath is ALSO given, it names an existing directory
+	// store whose blocks are migrated into a new (empty) pack at Init.
+	ColdStorageFile string
+
+	// ColdWriteBackQueue enables asynchronous write-behind for chilling:
+	// cold-storage writes run on a worker goroutine through a queue of
+	// this many blocks, and a snapshot only becomes cold once its write
+	// has landed. When the queue is full, chilling writes synchronously.
+	// 0 means disabled (default) - every chill writes inline.
+	// See writeback.go.
+	ColdWriteBackQueue int
+
+	// ColdStorageQuota caps the bytes the library stores in cold storage
+	// (across all garlands). A chill that would exceed it is refused and
+	// the data stays in memory; near the quota, eviction prefers leaves
+	// that can go to warm storage instead. 0 means unlimited (default).
+	// See coldquota.go.
+	ColdStorageQuota int64
+
 	// Memory management options
 	// MemorySoftLimit is the target memory usage in bytes.
 	// When exceeded, background maintenance starts chilling LRU nodes.
@@ -102,6 +129,10 @@ type LibraryOptions struct {
 	// Default is 5 if not specified.
 	ChillBudgetPerTick int
 
+	// Rebalance configures automatic tree rebalancing (see rebalance.go).
+	// The zero value keeps rebalancing manual.
+	Rebalance RebalancePolicy
+
 	// RebalanceBudget is the maximum rotations per mutation operation.
 	// Default is 2 if not specified.
 	RebalanceBudget int
@@ -110,6 +141,14 @@ type LibraryOptions struct {
 	// 0 means disabled (maintenance only happens opportunistically).
 	// Typical value: 100ms to 1s.
 	BackgroundInterval time.Duration
+
+	// IdleChillAfter chills a document completely (ChillEverything) once
+	// it has not been read, edited or navigated for this long, so
+	// background buffers stop holding RAM. Checked by the background
+	// maintenance worker, which is started for it when BackgroundInterval
+	// is 0 (at a quarter of this duration, capped at one minute).
+	// 0 means disabled (default).
+	IdleChillAfter time.Duration
 }
 
 // Library manages garland instances and shared resources like cold storage.
@@ -129,7 +168,9 @@ type Library struct {
 	memoryHardLimit    int64
 	chillBudgetPerTick int
 	rebalanceBudget    int
+	rebalancePolicy    RebalancePolicy
 	backgroundInterval time.Duration
+	idleChillAfter     time.Duration
 
 	// Memory pressure state - set when hard limit exceeded and can't reduce
 	memoryPressure bool
@@ -137,6 +178,16 @@ type Library struct {
 	// Background maintenance worker
 	maintenanceStop chan struct{}
 	maintenanceWg   sync.WaitGroup
+
+	// writeBack is the cold-storage write-behind queue (nil = disabled)
+	writeBack *writeBackQueue
+
+	// coldQuota is the cold storage ledger (ColdStorageQuota)
+	coldQuota coldQuota
+
+	// ownedPack is the pack backend Init opened (ColdStorageFile), closed
+	// with the library
+	ownedPack *PackColdStorage
 }
 
 // Init initializes the garland library with cold storage options.
@@ -163,16 +214,48 @@ func Init(options LibraryOptions) (*Library, error) {
 		memoryHardLimit:    options.MemoryHardLimit,
 		chillBudgetPerTick: chillBudget,
 		rebalanceBudget:    rebalanceBudget,
+		rebalancePolicy:    normalizedPolicy(options.Rebalance),
 		backgroundInterval: options.BackgroundInterval,
+		idleChillAfter:     options.IdleChillAfter,
 	}
+	lib.coldQuota.limit = options.ColdStorageQuota
 
 	// If a path was provided but no backend, create a file-based backend
-	if options.ColdStoragePath != "" && options.ColdStorageBackend == nil {
+	// (a single pack file when requested, else one file per block)
+	if options.ColdStorageFile != "" && options.ColdStorageBackend == nil {
+		pack, err := OpenPackColdStorage(options.ColdStorageFile)
+		if err != nil {
+			return nil, err
+		}
+		if options.ColdStoragePath != "" && pack.empty() {
+			if _, err := MigrateColdStorageDir(options.ColdStoragePath, pack); err != nil && !os.IsNotExist(err) {
+				pack.Close()
+				return nil, err
+			}
+		}
+		lib.coldStorageBackend = pack
+		lib.ownedPack = pack
+	} else if options.ColdStoragePath != "" && options.ColdStorageBackend == nil {
 		lib.coldStorageBackend = newFSColdStorage(lib.defaultFS, options.ColdStoragePath)
 	}
 
-	// Start background maintenance worker if configured
-	if options.BackgroundInterval > 0 {
+	// Start the cold-storage write-behind worker if configured
+	if options.ColdWriteBackQueue > 0 && lib.coldStorageBackend != nil {
+		lib.writeBack = newWriteBackQueue(lib.coldStorageBackend, options.ColdWriteBackQueue)
+	}
+
+	// Start background maintenance worker if configured (idle chilling
+	// needs it too)
+	if options.IdleChillAfter > 0 && lib.backgroundInterval <= 0 {
+		lib.backgroundInterval = options.IdleChillAfter / 4
+		if lib.backgroundInterval > time.Minute {
+			lib.backgroundInterval = time.Minute
+		}
+		if lib.backgroundInterval <= 0 {
+			lib.backgroundInterval = options.IdleChillAfter
+		}
+	}
+	if lib.backgroundInterval > 0 {
 		lib.startMaintenanceWorker()
 	}
 
@@ -264,6 +347,42 @@ type FileOptions struct {
 	// value is used verbatim after trimming surrounding whitespace,
 	// and must be a single line. Only meaningful with UseEmacsLocks.
 	LockOwner string
+
+	// AdvisoryLock (opt-in, file sources only) holds an OS advisory lock
+	// (flock / LockFileEx) on the source while the Garland is open, and
+	// refuses to save over a source another process has locked. See
+	// advisory_lock.go.
+	AdvisoryLock bool
+
+	// Journal (opt-in) keeps a crash-recovery journal: every committed
+	// revision's change is appended to a sidecar file until the next
+	// save, so Library.Recover can rebuild unsaved edits after a crash.
+	// File sources default to ".<name>.garland-journal" beside the
+	// file; other sources need JournalPath. See journal.go.
+	Journal     bool
+	JournalPath string
+
+	// GitHistory (opt-in) is a bare git repository, created if missing,
+	// that receives every revision as a commit, one branch per fork, for
+	// inspecting the editing history with git tooling. See
+	// git_history.go.
+	GitHistory string
+
+	// RecordTo (opt-in) logs every mutation and history operation to
+	// this writer, as JSON lines Library.Replay can reproduce on a fresh
+	// Garland. Not available for DataChannel sources. See replay.go.
+	RecordTo io.Writer
+
+	// EditQueueSize is the submission buffer of the serialized edit
+	// queue (SubmitEdit); 0 means DefaultEditQueueSize. The queue only
+	// starts with the first SubmitEdit. See editqueue.go.
+	EditQueueSize int
+
+	// Counting selects when the rune/line index is built. CountDeferred
+	// skips it at load and builds it on the first rune- or
+	// line-addressed operation - for large binaries edited by byte.
+	// Ignored for DataChannel sources. See counting.go.
+	Counting CountingMode
 }
 
 // ChangeResult contains version information after a mutation.
@@ -335,10 +454,11 @@ type TransactionState struct {
 	poisoned bool   // whether any inner transaction rolled back
 
 	// Pre-transaction state for rollback
-	preTransactionRoot    NodeID
-	preTransactionFork    ForkID
-	preTransactionRev     RevisionID
-	preTransactionCursors map[*Cursor]*CursorPosition
+	preTransactionRoot      NodeID
+	preTransactionFork      ForkID
+	preTransactionRev       RevisionID
+	preTransactionCursors   map[*Cursor]*CursorPosition
+	preTransactionEphemeral map[*ephemeralMark]ephemeralMark
 
 	// Pending revision (assigned at TransactionStart)
 	pendingRevision RevisionID
@@ -375,6 +495,20 @@ type Garland struct {
 	// Tree balance tracking
 	nodeManipulations int64 // count of node operations since last rebalance
 
+	// rebalance tracks depth samples and any partial rebuild
+	// (see rebalance.go)
+	rebalance rebalanceState
+
+	// views are the live read-only views; each pins its revision
+	// against pruning and snapshot GC (see snapshot_view.go)
+	views map[*SnapshotView]struct{}
+
+	// edits is the serialized edit queue, started by the first
+	// SubmitEdit (see editqueue.go)
+	edits         *editQueue
+	editsOnce     sync.Once
+	editQueueSize int
+
 	// Versioning
 	currentFork     ForkID
 	currentRevision RevisionID
@@ -382,9 +516,16 @@ type Garland struct {
 	nextForkID      ForkID
 	revisionInfo    map[ForkRevision]*RevisionInfo
 
-	// Cursors
+	// Cursors. The slice is COPY-ON-WRITE: registration and removal
+	// (under the write lock) install a new slice and never modify one
+	// in place, so a loop over g.cursors - or a copy of the header held
+	// past the lock - always sees a stable, complete list.
 	cursors []*Cursor
 
+	// The same cursors by position, kept for CursorsInOrder (see
+	// cursor_order.go). Updated in place under the write lock.
+	cursorOrder []*Cursor
+
 	// Decoration cache (hints only).
 	// IMPORTANT: Never delete entries from this map! Deletions break undo/history.
 	// To mark a decoration as "not present", set LastKnownNode to 0 instead.
@@ -394,6 +535,36 @@ type Garland struct {
 	pendingDecorationUpdates []pendingDecorationUpdate
 	pendingDecorationDeletes []string
 
+	// decorationNamespaces maps each namespace to every stored key ever
+	// placed in it (hints only, like decorationCache: never pruned, so
+	// undo can bring any of them back). Lazily allocated. See
+	// decoration_namespace.go.
+	decorationNamespaces map[string]map[string]bool
+
+	// ephemeral holds the ephemeral decorations by stored key: outside
+	// the tree and history, mapped through every edit like cursors.
+	// Lazily allocated. See decoration_ephemeral.go.
+	ephemeral map[string]*ephemeralMark
+
+	// diagnostics holds each source's diagnostics, whose range ends are
+	// mapped like ephemeral marks. See diagnostics.go.
+	diagnostics map[string][]*diagnosticRecord
+
+	// diagnosticIndex is the interval index over every diagnostic, built
+	// on the first query after marks move (nil until then).
+	diagnosticIndex *diagnosticIndex
+
+	// decorationWatches holds the watches by stored key, and
+	// watchQueue their pending callbacks. See decoration_watch.go.
+	decorationWatches map[string][]*decorationWatch
+	watchQueue        watchQueue
+
+	// inputEditWatches are the WatchInputEdits callbacks, and
+	// inputEditLast the version they last heard about. See
+	// input_edit.go.
+	inputEditWatches []*inputEditWatch
+	inputEditLast    inputEditBaseline
+
 	// Loading state
 	loader         *Loader
 	highestSeekPos int64
@@ -405,6 +576,10 @@ type Garland struct {
 	totalLines    int64
 	countComplete bool
 
+	// countsDeferred is set while the rune/line index of a
+	// CountDeferred load has not been built (see counting.go).
+	countsDeferred atomic.Bool
+
 	// Streaming synchronization - for blocking waits on lazy loading
 	streamCond *sync.Cond // Signaled when new data arrives or loading completes
 
@@ -425,6 +600,23 @@ type Garland struct {
 	// Memory tracking for incremental maintenance
 	memoryBytes int64 // total bytes of in-memory leaf data
 
+	// Storage-tier traffic counters (MemoryUsage)
+	tierStats tierCounters
+
+	// Tree work counters (SetTracing; see tracing.go)
+	trace treeTrace
+
+	// treeGen retires cursors' leaf hints (see leaf_hint.go)
+	treeGen uint64
+
+	// typing is the open typing streak, if any (see typing_leaf.go)
+	typing typingLeaf
+
+	// Cold storage accounting (see coldquota.go)
+	coldCharges map[string]int64 // block name -> bytes charged
+	coldBytes   int64            // sum of coldCharges
+	coldClosed  bool             // Close released the blocks; no more chills
+
 	// Source file change detection
 	sourceState      *sourceState
 	warmVerification map[NodeID]*warmVerificationState
@@ -440,6 +632,22 @@ type Garland struct {
 	// (FileOptions.UseEmacsLocks).
 	emacsLock *emacsLockState
 
+	// advisory, when non-nil, holds (or tracks the holder of) an OS
+	// advisory lock on the source (FileOptions.AdvisoryLock).
+	advisory *advisoryLockState
+
+	// journal, when non-nil, appends each committed change to a
+	// crash-recovery journal until the next save (FileOptions.Journal).
+	journal *journalState
+
+	// gitHistory, when non-nil, commits each revision into a bare git
+	// repository (FileOptions.GitHistory).
+	gitHistory *gitHistoryState
+
+	// recorder, when non-nil, logs mutations for deterministic replay
+	// (FileOptions.RecordTo).
+	recorder *opRecorder
+
 	// backup, when non-nil, streams a pre-session copy of the source
 	// file to an app-chosen location on the first mutation, so the
 	// backup is in place before any save overwrites the file
@@ -459,8 +667,21 @@ type Garland struct {
 	integrityLog []IntegrityEvent
 
 	// maintenanceInFlight guards against stacking CheckMemoryPressure
-	// goroutines (one per mutation would each scan the node registry).
+	// goroutines (one per mutation would each scan the node registry);
+	// maintenanceWg counts them so Close can wait them out.
 	maintenanceInFlight int32
+	maintenanceWg       sync.WaitGroup
+
+	// closed is set (under mu) when Close begins: maintenance leaves
+	// the garland alone from then on.
+	closed bool
+
+	// lastAccess is when the document was last read, edited or
+	// navigated (unix nanoseconds), for IdleChillAfter; idleChilled is
+	// set once the idle chill ran and cleared by the next access, so an
+	// idle document is chilled once, not every tick.
+	lastAccess  atomic.Int64
+	idleChilled atomic.Bool
 
 	// Concurrent-save coordination. saveMu serializes saves (Save,
 	// SaveWith, SaveAs) against each other. saveInFlight is true while
@@ -472,6 +693,10 @@ type Garland struct {
 	saveMu       sync.Mutex
 	saveInFlight bool
 	saveCond     *sync.Cond
+
+	// saveHooks run inside every save (AddSaveHook; see save_hooks.go).
+	// Guarded by mu.
+	saveHooks []namedSaveHook
 }
 
 // awaitNoSaveLocked blocks until no Concurrent save rewrite is in
@@ -509,6 +734,9 @@ func (lib *Library) Open(options FileOptions) (*Garland, error) {
 	if sourceCount > 1 {
 		return nil, ErrMultipleDataSources
 	}
+	if options.RecordTo != nil && options.DataChannel != nil {
+		return nil, ErrNotSupported
+	}
 
 	lib.mu.Lock()
 	lib.nextGarlandID++
@@ -546,6 +774,7 @@ func (lib *Library) Open(options FileOptions) (*Garland, error) {
 		targetLeafSize:  targetLeaf,
 		minLeafSize:     minLeaf,
 		graceWindowSize: 128, // default grace window for auto-created regions
+		editQueueSize:   options.EditQueueSize,
 
 		nodeRegistry:            make(map[NodeID]*Node),
 		nextNodeID:              1,
@@ -559,6 +788,9 @@ func (lib *Library) Open(options FileOptions) (*Garland, error) {
 	// Initialize streaming condition variable (uses the garland's mutex)
 	g.streamCond = sync.NewCond(&g.mu)
 
+	// Opening counts as an access (IdleChillAfter)
+	g.touchAccess()
+
 	// Initialize source change detection
 	g.initSourceState()
 
@@ -607,6 +839,9 @@ func (lib *Library) Open(options FileOptions) (*Garland, error) {
 			// published, so the *Locked helper is safe to call.
 			g.initEmacsLockLocked(options.LockOwner)
 		}
+		if options.AdvisoryLock {
+			g.initAdvisoryLockLocked()
+		}
 
 	case options.DataChannel != nil:
 		// Start async loading
@@ -616,6 +851,7 @@ func (lib *Library) Open(options FileOptions) (*Garland, error) {
 
 	// Build initial tree structure
 	if initialData != nil {
+		g.countsDeferred.Store(options.Counting == CountDeferred)
 		g.buildInitialTree(initialData, options.InitialUsageStart, options.InitialUsageEnd)
 	} else {
 		// Create empty tree for async loading
@@ -627,6 +863,19 @@ func (lib *Library) Open(options FileOptions) (*Garland, error) {
 		return nil, err
 	}
 
+	// The journal starts from the content as loaded (streamed sources
+	// have no reproducible base until they finish, so they are not
+	// journaled).
+	if options.Journal && options.DataChannel == nil {
+		g.initJournalLocked(options.JournalPath)
+	}
+	if options.GitHistory != "" {
+		g.initGitHistoryLocked(options.GitHistory)
+	}
+	if options.RecordTo != nil {
+		g.startRecordingLocked(options.RecordTo)
+	}
+
 	// Calculate initial memory usage
 	g.recalculateMemoryUsage()
 
@@ -643,34 +892,56 @@ func (lib *Library) Open(options FileOptions) (*Garland, error) {
 
 // Close releases resources associated with the Garland.
 func (g *Garland) Close() error {
+	// The edit queue's writer finishes its current edit; anything still
+	// queued fails with ErrEditQueueClosed.
+	g.stopEditQueue()
+
+	// Maintenance stops finding the garland (library ticks walk
+	// activeGarlands; a pass that already listed it sees closed once it
+	// takes g.mu) and no new pressure check starts; one under way
+	// finishes before storage is torn down.
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	if g.lib != nil {
+		g.lib.mu.Lock()
+		delete(g.lib.activeGarlands, g.id)
+		g.lib.mu.Unlock()
+	}
+	g.maintenanceWg.Wait()
+
+	// Queued cold writes finish against a live garland (the worker
+	// completes each one under g.mu).
+	if g.lib != nil {
+		_ = g.lib.FlushColdWrites()
+	}
+
 	// Let any in-flight save or backup stream finish before tearing
 	// down (both hold saveMu for their duration), then clean up the
 	// session artifacts: a held emacs lock does not survive the buffer
-	// it protects, and an uncommitted backup (its subject was never
+	// it protects, a deliberate Close is no crash (the recovery journal
+	// is removed), and an uncommitted backup (its subject was never
 	// overwritten) is removed so viewing files never accumulates
 	// backup storage.
 	g.saveMu.Lock()
 	g.mu.Lock()
 	g.awaitNoSaveLocked()
 	g.releaseEmacsLockLocked()
+	g.releaseAdvisoryLockLocked()
+	g.closeJournalLocked()
+	g.stopRecordingLocked()
 	g.cleanupBackupLocked()
+	g.closeColdStorageLocked()
+	if g.sourceHandle != nil && g.sourceFS != nil {
+		g.sourceFS.Close(g.sourceHandle)
+		g.sourceHandle = nil
+	}
 	g.mu.Unlock()
 	g.saveMu.Unlock()
 
 	// Stop source file watching
 	g.DisableSourceWatch()
 
-	if g.lib != nil {
-		g.lib.mu.Lock()
-		delete(g.lib.activeGarlands, g.id)
-		g.lib.mu.Unlock()
-	}
-
-	if g.sourceHandle != nil && g.sourceFS != nil {
-		g.sourceFS.Close(g.sourceHandle)
-		g.sourceHandle = nil
-	}
-
 	return nil
 }
 
@@ -738,24 +1009,48 @@ func (g *Garland) SaveAsWith(fs FileSystemInterface, name string, opts SaveAsOpt
 	// first (no-op when unarmed, finished, or failed).
 	g.ensureBackupBeforeSave()
 
-	// Full lock: streaming may thaw chilled snapshots, which mutates them.
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
 	// A nil filesystem resolves exactly like SaveWith: the buffer's own
 	// source filesystem, else the library default (local disk). This
 	// lets a host stream a save-as to a new path without reimplementing
 	// FileSystemInterface just to name the local disk. Resolved under
 	// the lock because g.sourceFS can change (RebaseOnFile).
+	g.mu.Lock()
 	if fs == nil {
 		fs = g.sourceFS
 		if fs == nil {
 			fs = g.lib.defaultFS
 		}
 	}
+	inPlace := g.sourcePath != "" && name == g.sourcePath &&
+		(fs == g.sourceFS || (g.sourceFS == nil && fs == g.lib.defaultFS))
+	var err error
+	if inPlace {
+		err = g.checkAdvisoryLockLocked()
+	}
+	g.mu.Unlock()
+	if err != nil {
+		return SaveReport{}, err
+	}
+
+	ev := SaveEvent{Path: name, InPlace: inPlace, Adopt: opts.AdoptAsSource && !inPlace}
+	if err := g.runPreSaveHooks(ev); err != nil {
+		return SaveReport{}, err
+	}
+
+	// Full lock: streaming may thaw chilled snapshots, which mutates them.
+	g.mu.Lock()
+	report, err := g.saveAsLocked(fs, name, inPlace, opts)
+	g.mu.Unlock()
+	if err == nil {
+		g.runPostSaveHooks(ev, report)
+	}
+	return report, err
+}
 
-	if g.sourcePath != "" && name == g.sourcePath &&
-		(fs == g.sourceFS || (g.sourceFS == nil && fs == g.lib.defaultFS)) {
+// saveAsLocked is the write phase of SaveAsWith. Caller must hold
+// saveMu and the write lock.
+func (g *Garland) saveAsLocked(fs FileSystemInterface, name string, inPlace bool, opts SaveAsOptions) (SaveReport, error) {
+	if inPlace {
 		// The destination IS the source: the in-place engine handles
 		// re-homing and baselines (and records the save point).
 		return g.saveInPlace(fs, SaveOptions{PreserveHistory: true})
@@ -849,6 +1144,9 @@ func (g *Garland) streamWriteNode(fs FileSystemInterface, handle FileHandle, nod
 //   - ChillOldHistory: Also chill old undo history beyond recent revisions
 //   - ChillUnusedData: Chill everything not used at current revision
 //   - ChillEverything: Chill all data (for switching documents or shells)
+//
+// Leaves the cold storage quota refuses stay in memory, and Chill returns
+// ErrColdStorageQuota once it has chilled everything else it could.
 func (g *Garland) Chill(level ChillLevel) error {
 	// MemoryOnly files don't use cold storage
 	if g.loadingStyle == MemoryOnly {
@@ -862,6 +1160,9 @@ func (g *Garland) Chill(level ChillLevel) error {
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	if g.closed {
+		return nil
+	}
 
 	// Collect nodes that are "in use" based on the level
 	inUse := make(map[NodeID]bool)
@@ -891,6 +1192,7 @@ func (g *Garland) Chill(level ChillLevel) error {
 
 	// Move data for nodes not in use to cold storage
 	chilledCount := 0
+	overQuota := false
 	for _, node := range g.nodeRegistry {
 		if inUse[node.id] {
 			continue
@@ -900,6 +1202,7 @@ func (g *Garland) Chill(level ChillLevel) error {
 				err := g.chillSnapshot(node.id, forkRev, snap)
 				if err != nil {
 					// Log error but continue chilling other nodes
+					overQuota = overQuota || errors.Is(err, ErrColdStorageQuota)
 					continue
 				}
 				chilledCount++
@@ -918,6 +1221,7 @@ func (g *Garland) Chill(level ChillLevel) error {
 				if snap.isLeaf && snap.storageState == StorageMemory && len(snap.data) > 0 {
 					err := g.chillSnapshot(node.id, forkRev, snap)
 					if err != nil {
+						overQuota = overQuota || errors.Is(err, ErrColdStorageQuota)
 						continue
 					}
 					chilledCount++
@@ -926,6 +1230,10 @@ func (g *Garland) Chill(level ChillLevel) error {
 		}
 	}
 
+	// The refused leaves stay in memory; the caller learns they did
+	if overQuota {
+		return ErrColdStorageQuota
+	}
 	return nil
 }
 
@@ -1123,6 +1431,11 @@ func (g *Garland) thawNodeRecursive(node *Node, fork ForkID, rev RevisionID) {
 // chillSnapshotWithTrust moves a snapshot's data to storage, respecting warm storage trust levels.
 // It prefers warm storage if available and trusted, otherwise uses cold storage.
 func (g *Garland) chillSnapshotWithTrust(nodeID NodeID, forkRev ForkRevision, snap *NodeSnapshot) error {
+	// Borrowed by a zero-copy read: stays resident until released
+	if snap.pins > 0 {
+		return ErrPinned
+	}
+
 	// Check if warm storage is available for this block
 	canUseWarm := snap.originalFileOffset >= 0 && g.sourceHandle != nil && g.sourceFS != nil
 
@@ -1172,6 +1485,7 @@ func (g *Garland) chillToWarmStorage(nodeID NodeID, snap *NodeSnapshot) error {
 
 	// Update memory tracking
 	g.updateMemoryTracking(-bytesFreed)
+	g.tierStats.warmEvictions++
 
 	// Record verification state
 	g.updateWarmVerification(nodeID)
@@ -1179,31 +1493,60 @@ func (g *Garland) chillToWarmStorage(nodeID NodeID, snap *NodeSnapshot) error {
 	return nil
 }
 
-// chillSnapshot moves a snapshot's data to cold storage.
+// chillSnapshot moves a snapshot's data to cold storage. With
+// write-behind enabled the write is queued and the snapshot stays in
+// memory until it lands (see writeback.go).
 func (g *Garland) chillSnapshot(nodeID NodeID, forkRev ForkRevision, snap *NodeSnapshot) error {
+	// Already on its way to cold storage
+	if snap.writeBackPending {
+		return nil
+	}
+
+	// Borrowed by a zero-copy read: stays resident until released
+	if snap.pins > 0 {
+		return ErrPinned
+	}
+
 	// Compute hash if not already present
 	if len(snap.dataHash) == 0 {
 		snap.dataHash = computeHash(snap.data)
 	}
 
+	// Encode decorations once: the bytes are both hashed and stored
+	var decData []byte
+	if len(snap.decorations) > 0 {
+		decData = encodeDecorations(snap.decorations)
+		if len(snap.decorationHash) == 0 {
+			snap.decorationHash = computeHash(decData)
+		}
+	}
+
+	// Charge the quota before anything is written (see coldquota.go)
+	blockName := formatBlockName(nodeID, forkRev)
+	prevCharge, err := g.chargeColdLocked(blockName, int64(len(snap.data)+len(decData)))
+	if err != nil {
+		return err
+	}
+
+	if g.enqueueWriteBackLocked(nodeID, forkRev, snap, decData, prevCharge) {
+		return nil
+	}
+
 	// Track bytes being freed
 	bytesFreed := int64(len(snap.data))
 
 	// Store data in cold storage
-	blockName := formatBlockName(nodeID, forkRev)
-	err := g.lib.coldStorageBackend.Set(g.id, blockName, snap.data)
+	err = g.lib.coldStorageBackend.Set(g.id, blockName, snap.data)
 	if err != nil {
+		g.refundColdLocked(blockName, prevCharge)
 		return err
 	}
 
 	// Store decorations if present
-	if len(snap.decorations) > 0 {
-		if len(snap.decorationHash) == 0 {
-			snap.decorationHash = computeHash(encodeDecorations(snap.decorations))
-		}
-		decBlockName := formatBlockName(nodeID, forkRev) + ".dec"
-		err = g.lib.coldStorageBackend.Set(g.id, decBlockName, encodeDecorations(snap.decorations))
+	if decData != nil {
+		err = g.lib.coldStorageBackend.Set(g.id, blockName+".dec", decData)
 		if err != nil {
+			g.refundColdLocked(blockName, prevCharge)
 			return err
 		}
 		snap.decorations = nil
@@ -1215,6 +1558,7 @@ func (g *Garland) chillSnapshot(nodeID NodeID, forkRev ForkRevision, snap *NodeS
 
 	// Update memory tracking
 	g.updateMemoryTracking(-bytesFreed)
+	g.tierStats.chills++
 
 	return nil
 }
@@ -1318,12 +1662,20 @@ func formatUint64(n uint64) string {
 
 // encodeDecorations serializes decorations for cold storage.
 func encodeDecorations(decs []Decoration) []byte {
-	// Simple format: key\0position\n for each decoration
+	// Simple format: key\0position\n for each decoration, the position
+	// suffixed 'L' or 'R' for a non-default Gravity (older blocks, which
+	// have no suffixes, read back as GravityDefault)
 	var buf []byte
 	for _, d := range decs {
 		buf = append(buf, []byte(d.Key)...)
 		buf = append(buf, 0)
 		buf = append(buf, []byte(formatUint64(uint64(d.Position)))...)
+		switch d.Gravity {
+		case GravityLeft:
+			buf = append(buf, 'L')
+		case GravityRight:
+			buf = append(buf, 'R')
+		}
 		buf = append(buf, '\n')
 	}
 	return buf
@@ -1350,7 +1702,7 @@ func decodeDecorations(data []byte) ([]Decoration, error) {
 			return nil, ErrColdStorageFailure // truncated record
 		}
 		key := string(data[i:keyEnd])
-		if !ValidDecorationKey(key) {
+		if !validStoredDecorationKey(key) {
 			return nil, ErrColdStorageFailure
 		}
 
@@ -1363,15 +1715,25 @@ func decodeDecorations(data []byte) ([]Decoration, error) {
 		if posEnd == posStart || posEnd >= len(data) {
 			return nil, ErrColdStorageFailure // empty or unterminated position
 		}
+		gravity, digitsEnd := GravityDefault, posEnd
+		switch data[posEnd-1] {
+		case 'L':
+			gravity, digitsEnd = GravityLeft, posEnd-1
+		case 'R':
+			gravity, digitsEnd = GravityRight, posEnd-1
+		}
+		if digitsEnd == posStart {
+			return nil, ErrColdStorageFailure // suffix without a position
+		}
 		var pos uint64
-		for j := posStart; j < posEnd; j++ {
+		for j := posStart; j < digitsEnd; j++ {
 			c := data[j]
 			if c < '0' || c > '9' {
 				return nil, ErrColdStorageFailure
 			}
 			pos = pos*10 + uint64(c-'0')
 		}
-		decs = append(decs, Decoration{Key: key, Position: int64(pos)})
+		decs = append(decs, Decoration{Key: key, Position: int64(pos), Gravity: gravity})
 
 		i = posEnd + 1
 	}
@@ -1418,6 +1780,7 @@ func (g *Garland) thawSnapshot(nodeID NodeID, forkRev ForkRevision, snap *NodeSn
 
 	// Update memory tracking
 	g.updateMemoryTracking(int64(len(data)))
+	g.tierStats.thaws++
 
 	// Mark as recently accessed
 	g.touchSnapshot(snap)
@@ -1457,6 +1820,7 @@ func (g *Garland) thawSnapshot(nodeID NodeID, forkRev ForkRevision, snap *NodeSn
 		// Note: The offset is unknown, so we set it to 0 as a hint
 		// GetDecorationPosition will update with correct offset on access
 		for _, d := range snap.decorations {
+			g.indexDecorationNamespaceLocked(d.Key)
 			if _, exists := g.decorationCache[d.Key]; !exists {
 				g.decorationCache[d.Key] = &DecorationCacheEntry{
 					LastKnownFork:   forkRev.Fork,
@@ -1499,6 +1863,7 @@ func (g *Garland) ensureSnapshotData(node *Node, forkRev ForkRevision, snap *Nod
 	case StorageMemory:
 		// Data is already in memory - touch it for LRU tracking
 		g.touchSnapshot(snap)
+		g.tierStats.hits.Add(1)
 		return nil
 
 	case StorageCold:
@@ -1524,7 +1889,11 @@ func (g *Garland) ensureSnapshotData(node *Node, forkRev ForkRevision, snap *Nod
 // and falsely placeholders the leaf. This is the entry point every
 // reader of snap.data must pass through when the leaf may be chilled.
 func (g *Garland) ensureLeafDataResident(node *Node, snap *NodeSnapshot) error {
-	if snap == nil || !snap.isLeaf || snap.storageState == StorageMemory {
+	if snap == nil || !snap.isLeaf {
+		return nil
+	}
+	if snap.storageState == StorageMemory {
+		g.tierStats.hits.Add(1)
 		return nil
 	}
 	for k, s := range node.history {
@@ -1601,6 +1970,7 @@ func (g *Garland) readFromWarmStorageWithTrust(nodeID NodeID, snap *NodeSnapshot
 
 	// Update memory tracking
 	g.updateMemoryTracking(int64(len(data)))
+	g.tierStats.warmReads++
 
 	// Mark as recently accessed
 	g.touchSnapshot(snap)
@@ -1651,24 +2021,33 @@ func (g *Garland) newRegisteredCursor(tracksHistory bool) *Cursor {
 	// or a concurrent mutation's recordMutation races the read.
 	g.mu.Lock()
 	c := newCursor(g, tracksHistory)
-	g.cursors = append(g.cursors, c)
-	g.mu.Unlock()
-
-	// Check if position 0 is ready
+	g.cursors = append(g.cursors[:len(g.cursors):len(g.cursors)], c) // copy-on-write
+	g.cursorOrder = append(g.cursorOrder, c)
+	// Check if position 0 is ready (reads the counts: also under the lock)
 	g.updateCursorReady(c)
+	g.mu.Unlock()
 
 	return c
 }
 
-// RemoveCursor removes a cursor from the Garland.
+// RemoveCursor removes a cursor from the Garland. It is safe at any
+// time and from any goroutine, including while edits are running:
+// removal takes effect at the write lock. An edit already holding the
+// lock completes (adjusting the cursor one last time); any later
+// operation on the cursor fails with ErrCursorNotFound, and edits no
+// longer adjust it. Code iterating cursors never observes a partially
+// updated list (see the cursors field).
 func (g *Garland) RemoveCursor(c *Cursor) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
 	for i, cursor := range g.cursors {
 		if cursor == c {
-			g.cursors = append(g.cursors[:i], g.cursors[i+1:]...)
-			c.garland = nil
+			kept := make([]*Cursor, 0, len(g.cursors)-1)
+			kept = append(kept, g.cursors[:i]...)
+			g.cursors = append(kept, g.cursors[i+1:]...)
+			g.dropFromCursorOrderLocked(c)
+			c.removed.Store(true)
 			return nil
 		}
 	}
@@ -1734,6 +2113,7 @@ func (g *Garland) ByteCount() CountResult {
 
 // RuneCount returns total runes (or known runes if still loading).
 func (g *Garland) RuneCount() CountResult {
+	g.ensureCounts()
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 	return CountResult{
@@ -1744,6 +2124,7 @@ func (g *Garland) RuneCount() CountResult {
 
 // LineCount returns total newlines (or known newlines if still loading).
 func (g *Garland) LineCount() CountResult {
+	g.ensureCounts()
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 	return CountResult{
@@ -1782,7 +2163,8 @@ func (g *Garland) TransactionDepth() int {
 }
 
 // TransactionStart begins a new transaction with an optional descriptive name.
-func (g *Garland) TransactionStart(name string) error {
+func (g *Garland) TransactionStart(name string) (err error) {
+	defer func() { g.logOp(ReplayRecord{Op: replayTxStart, Name: name}, err) }()
 	if g.transaction == nil {
 		// Top-level transaction: checkpoint any active optimized regions first
 		// This ensures the transaction has a clean baseline to rollback to
@@ -1799,15 +2181,16 @@ func (g *Garland) TransactionStart(name string) error {
 
 		// First level: create new transaction state
 		g.transaction = &TransactionState{
-			depth:                 1,
-			name:                  name,
-			poisoned:              false,
-			preTransactionRoot:    g.root.id,
-			preTransactionFork:    g.currentFork,
-			preTransactionRev:     g.currentRevision,
-			preTransactionCursors: g.snapshotCursorPositions(),
-			pendingRevision:       g.currentRevision + 1,
-			hasMutations:          false,
+			depth:                   1,
+			name:                    name,
+			poisoned:                false,
+			preTransactionRoot:      g.root.id,
+			preTransactionFork:      g.currentFork,
+			preTransactionRev:       g.currentRevision,
+			preTransactionCursors:   g.snapshotCursorPositions(),
+			preTransactionEphemeral: g.snapshotEphemeralLocked(),
+			pendingRevision:         g.currentRevision + 1,
+			hasMutations:            false,
 		}
 	} else {
 		// Nested: just increment depth
@@ -1817,7 +2200,8 @@ func (g *Garland) TransactionStart(name string) error {
 }
 
 // TransactionCommit commits the current transaction.
-func (g *Garland) TransactionCommit() (ChangeResult, error) {
+func (g *Garland) TransactionCommit() (result ChangeResult, err error) {
+	defer func() { g.logOp(ReplayRecord{Op: replayTxCommit, Result: result}, err) }()
 	if g.transaction == nil {
 		return ChangeResult{}, ErrNoTransaction
 	}
@@ -1873,18 +2257,24 @@ func (g *Garland) TransactionCommit() (ChangeResult, error) {
 		HasChanges:       g.transaction.hasMutations,
 		RootID:           g.root.id,
 		StreamKnownBytes: streamKnown,
+		Time:             g.coalesce.clock(),
 	}
 
-	result := ChangeResult{
+	result = ChangeResult{
 		Fork:     g.currentFork,
 		Revision: g.currentRevision,
 	}
 	g.transaction = nil
+	g.journalLocked()
+	g.gitHistoryLocked()
+	g.checkInputEditWatchesLocked()
+	g.checkDecorationWatchesLocked()
 	return result, nil
 }
 
 // TransactionRollback discards all changes in the current transaction.
-func (g *Garland) TransactionRollback() error {
+func (g *Garland) TransactionRollback() (err error) {
+	defer func() { g.logOp(ReplayRecord{Op: replayTxRollback}, err) }()
 	if g.transaction == nil {
 		return ErrNoTransaction
 	}
@@ -1926,11 +2316,13 @@ func (g *Garland) GetRevisionRange(start, end RevisionID) ([]RevisionInfo, error
 // UndoSeek navigates to a specific revision within the current fork.
 // Cannot seek forward past the highest revision in this fork.
 // Seeking backwards then making a change creates a new fork.
-func (g *Garland) UndoSeek(revision RevisionID) error {
+func (g *Garland) UndoSeek(revision RevisionID) (err error) {
+	defer func() { g.logOp(ReplayRecord{Op: replayUndoSeek, Revision: revision}, err) }()
 	// Block during transactions
 	if g.transaction != nil {
 		return ErrTransactionPending
 	}
+	g.touchAccess()
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -2006,6 +2398,9 @@ func (g *Garland) UndoSeek(revision RevisionID) error {
 		cursor.lastFork = g.currentFork
 		cursor.lastRevision = g.currentRevision
 	}
+	g.clampEphemeralLocked()
+	g.checkInputEditWatchesLocked()
+	g.checkDecorationWatchesLocked()
 
 	// History navigation is a hard edge for undo coalescing: resuming
 	// an old run after looking around would rewrite what the user just
@@ -2015,6 +2410,8 @@ func (g *Garland) UndoSeek(revision RevisionID) error {
 	// Landing exactly on the last-saved state releases the emacs lock;
 	// landing anywhere else (re-)acquires it.
 	g.syncEmacsLockAfterSeekLocked()
+	g.journalSeekLocked()
+	g.gitHistoryLocked()
 
 	return nil
 }
@@ -2022,11 +2419,13 @@ func (g *Garland) UndoSeek(revision RevisionID) error {
 // ForkSeek switches to a different fork.
 // Retains current revision if it exists in both forks,
 // otherwise retreats to the last common revision.
-func (g *Garland) ForkSeek(fork ForkID) error {
+func (g *Garland) ForkSeek(fork ForkID) (err error) {
+	defer func() { g.logOp(ReplayRecord{Op: replayForkSeek, Fork: fork}, err) }()
 	// Block during transactions
 	if g.transaction != nil {
 		return ErrTransactionPending
 	}
+	g.touchAccess()
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -2099,6 +2498,9 @@ func (g *Garland) ForkSeek(fork ForkID) error {
 		cursor.lastFork = fork
 		cursor.lastRevision = targetRevision
 	}
+	g.clampEphemeralLocked()
+	g.checkInputEditWatchesLocked()
+	g.checkDecorationWatchesLocked()
 
 	// History navigation is a hard edge for undo coalescing: resuming
 	// an old run after looking around would rewrite what the user just
@@ -2108,6 +2510,8 @@ func (g *Garland) ForkSeek(fork ForkID) error {
 	// Landing exactly on the last-saved state releases the emacs lock;
 	// landing anywhere else (re-)acquires it.
 	g.syncEmacsLockAfterSeekLocked()
+	g.journalSeekLocked()
+	g.gitHistoryLocked()
 
 	return nil
 }
@@ -2157,7 +2561,8 @@ func (g *Garland) ListForks() []ForkInfo {
 //
 // Shared revisions (inherited from parent forks) are only truly deleted
 // when all forks that share them have pruned past that point.
-func (g *Garland) Prune(keepFromRevision RevisionID) error {
+func (g *Garland) Prune(keepFromRevision RevisionID) (err error) {
+	defer func() { g.logOp(ReplayRecord{Op: replayPrune, Revision: keepFromRevision}, err) }()
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.awaitNoSaveLocked() // pruning destroys cold blocks a save may be reading
@@ -2192,7 +2597,7 @@ func (g *Garland) Prune(keepFromRevision RevisionID) error {
 	// DeleteFork).
 	for forkRev := range g.revisionInfo {
 		if forkRev.Fork == g.currentFork && forkRev.Revision < keepFromRevision {
-			if g.revisionNeededByOthers(g.currentFork, forkRev.Revision) {
+			if g.revisionNeededByOthers(g.currentFork, forkRev.Revision) || g.viewHoldsRevisionLocked(forkRev) {
 				continue
 			}
 			delete(g.revisionInfo, forkRev)
@@ -2266,7 +2671,8 @@ func (g *Garland) revisionNeededByOthers(f ForkID, rev RevisionID) bool {
 // DeleteFork soft-deletes a fork, preventing further navigation to it.
 // The fork's data remains until no other forks depend on it.
 // Cannot delete the current fork or the last remaining non-deleted fork.
-func (g *Garland) DeleteFork(fork ForkID) error {
+func (g *Garland) DeleteFork(fork ForkID) (err error) {
+	defer func() { g.logOp(ReplayRecord{Op: replayDeleteFork, Fork: fork}, err) }()
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.awaitNoSaveLocked() // fork GC destroys cold blocks a save may be reading
@@ -2316,7 +2722,7 @@ func (g *Garland) DeleteFork(fork ForkID) error {
 	}
 
 	for forkRev := range g.revisionInfo {
-		if forkRev.Fork == fork && !g.revisionNeededByOthers(fork, forkRev.Revision) {
+		if forkRev.Fork == fork && !g.revisionNeededByOthers(fork, forkRev.Revision) && !g.viewHoldsRevisionLocked(forkRev) {
 			delete(g.revisionInfo, forkRev)
 		}
 	}
@@ -2354,6 +2760,7 @@ func (g *Garland) garbageCollectSnapshots() {
 			g.markSnapshotsInUseForRevision(forkID, rev, inUse)
 		}
 	}
+	g.markViewSnapshotsInUse(inUse)
 
 	// Remove snapshots not in use
 	for _, node := range g.nodeRegistry {
@@ -2364,6 +2771,7 @@ func (g *Garland) garbageCollectSnapshots() {
 		for forkRev := range node.history {
 			if nodeInUse == nil || !nodeInUse[forkRev] {
 				delete(node.history, forkRev)
+				g.releaseColdLocked(formatBlockName(node.id, forkRev))
 			}
 		}
 	}
@@ -2677,6 +3085,8 @@ func (g *Garland) rollbackToPreTransaction() {
 	for cursor, pos := range g.transaction.preTransactionCursors {
 		cursor.restorePosition(pos)
 	}
+	g.restoreEphemeralLocked(g.transaction.preTransactionEphemeral)
+	g.journalRollbackLocked()
 }
 
 // Helper functions (stubs to be implemented)
@@ -2840,9 +3250,11 @@ func (g *Garland) appendStreamData(data []byte) {
 	}
 
 	// Update counts
+	oldBytes, oldLines := g.totalBytes, g.totalLines
 	g.totalBytes += snap.byteCount
 	g.totalRunes += snap.runeCount
 	g.totalLines += snap.lineCount
+	g.followPinsLocked(oldBytes, oldLines)
 
 	// Update loader progress
 	if g.loader != nil {
@@ -2884,7 +3296,7 @@ func (g *Garland) buildInitialTree(data []byte, usageStart, usageEnd int64) {
 		contentNode := newNode(g.nextNodeID, g)
 		g.nodeRegistry[contentNode.id] = contentNode
 
-		contentSnap = createLeafSnapshot(data, nil, 0)
+		contentSnap = g.newLoadedLeafSnapshot(data, 0)
 		contentNode.setSnapshot(0, 0, contentSnap)
 		contentNodeID = contentNode.id
 	} else {
@@ -2923,6 +3335,7 @@ func (g *Garland) buildInitialTree(data []byte, usageStart, usageEnd int64) {
 		HasChanges:       false,
 		RootID:           g.root.id,
 		StreamKnownBytes: -1, // -1 means complete (not streaming)
+		Time:             g.coalesce.clock(),
 	}
 
 	// Chill nodes outside the usage window
@@ -2931,45 +3344,6 @@ func (g *Garland) buildInitialTree(data []byte, usageStart, usageEnd int64) {
 	}
 }
 
-// buildBalancedSubtree recursively builds a balanced tree from data.
-// Returns the node ID and the snapshot for the subtree root.
-func (g *Garland) buildBalancedSubtree(data []byte, fileOffset int64) (NodeID, *NodeSnapshot) {
-	dataLen := int64(len(data))
-
-	// Base case: data fits in a single leaf
-	if dataLen <= g.targetLeafSize {
-		g.nextNodeID++
-		node := newNode(g.nextNodeID, g)
-		g.nodeRegistry[node.id] = node
-
-		snap := createLeafSnapshot(data, nil, fileOffset)
-		node.setSnapshot(0, 0, snap)
-		return node.id, snap
-	}
-
-	// Recursive case: split at midpoint and build subtrees
-	mid := dataLen / 2
-
-	// Align to rune boundary to avoid splitting UTF-8 characters
-	mid = int64(alignToRuneBoundary(data, mid))
-
-	leftID, leftSnap := g.buildBalancedSubtree(data[:mid], fileOffset)
-	rightID, rightSnap := g.buildBalancedSubtree(data[mid:], fileOffset+mid)
-
-	// Create internal node
-	g.nextNodeID++
-	node := newNode(g.nextNodeID, g)
-	g.nodeRegistry[node.id] = node
-
-	snap := createInternalSnapshot(leftID, rightID, leftSnap, rightSnap)
-	node.setSnapshot(0, 0, snap)
-
-	// Register for structure reuse
-	g.internalNodesByChildren[[2]NodeID{leftID, rightID}] = node.id
-
-	return node.id, snap
-}
-
 // chillNodesOutsideRange moves leaf data outside the specified byte range to cold storage.
 // This is called after initial tree build to avoid keeping large files entirely in RAM.
 func (g *Garland) chillNodesOutsideRange(usageStart, usageEnd int64) {
@@ -3063,6 +3437,7 @@ func (g *Garland) buildEmptyTree() {
 		HasChanges:       false,
 		RootID:           g.root.id,
 		StreamKnownBytes: 0, // 0 means streaming hasn't loaded anything yet
+		Time:             g.coalesce.clock(),
 	}
 }
 
@@ -3113,6 +3488,7 @@ func (g *Garland) IsRuneReady(pos int64) bool {
 	if pos < 0 {
 		return false
 	}
+	g.ensureCounts()
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 	return g.countComplete || pos <= g.totalRunes
@@ -3124,6 +3500,7 @@ func (g *Garland) IsLineReady(line int64) bool {
 	if line < 0 {
 		return false
 	}
+	g.ensureCounts()
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 	return g.countComplete || line <= g.totalLines
@@ -3131,148 +3508,50 @@ func (g *Garland) IsLineReady(line int64) bool {
 
 // waitForBytePosition blocks until the given byte position is available or timeout expires.
 // If timeout is 0, it returns immediately with ErrNotReady if not available.
-// If timeout is negative, it blocks indefinitely.
+// If timeout is negative, it blocks indefinitely (or until ctx is done).
 // Caller must NOT hold the lock when calling this function.
-func (g *Garland) waitForBytePosition(pos int64, timeout time.Duration) error {
-	if pos < 0 {
-		return ErrInvalidPosition
-	}
-
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	// Fast path: already available or complete
-	if g.countComplete {
-		if pos > g.totalBytes {
-			return ErrInvalidPosition
-		}
-		return nil
-	}
-	if pos <= g.totalBytes {
-		return nil
-	}
-
-	// Non-blocking mode
-	if timeout == 0 {
-		return ErrNotReady
-	}
-
-	// Set up timeout if needed
-	var deadline time.Time
-	var timer *time.Timer
-	timedOut := false
-
-	if timeout > 0 {
-		deadline = time.Now().Add(timeout)
-		timer = time.AfterFunc(timeout, func() {
-			g.mu.Lock()
-			timedOut = true
-			g.streamCond.Broadcast() // Wake up all waiters to check timeout
-			g.mu.Unlock()
-		})
-		defer timer.Stop()
-	}
-
-	// Blocking wait loop
-	for !g.countComplete && pos > g.totalBytes {
-		if timedOut {
-			return ErrTimeout
-		}
-		if timeout > 0 && time.Now().After(deadline) {
-			return ErrTimeout
-		}
-		g.streamCond.Wait() // Releases lock, waits for signal, reacquires lock
-	}
-
-	// Check final state
-	if g.countComplete && pos > g.totalBytes {
-		return ErrInvalidPosition
-	}
-	return nil
+func (g *Garland) waitForBytePosition(ctx context.Context, pos int64, timeout time.Duration) error {
+	return g.waitForCount(ctx, pos, timeout, &g.totalBytes)
 }
 
 // waitForRunePosition blocks until the given rune position is available or timeout expires.
-// If timeout is 0, it returns immediately with ErrNotReady if not available.
-// If timeout is negative, it blocks indefinitely.
+// Same timeout and ctx rules as waitForBytePosition.
 // Caller must NOT hold the lock when calling this function.
-func (g *Garland) waitForRunePosition(pos int64, timeout time.Duration) error {
-	if pos < 0 {
-		return ErrInvalidPosition
-	}
-
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	// Fast path
-	if g.countComplete {
-		if pos > g.totalRunes {
-			return ErrInvalidPosition
-		}
-		return nil
-	}
-	if pos <= g.totalRunes {
-		return nil
-	}
-
-	// Non-blocking mode
-	if timeout == 0 {
-		return ErrNotReady
-	}
-
-	// Set up timeout if needed
-	var deadline time.Time
-	var timer *time.Timer
-	timedOut := false
-
-	if timeout > 0 {
-		deadline = time.Now().Add(timeout)
-		timer = time.AfterFunc(timeout, func() {
-			g.mu.Lock()
-			timedOut = true
-			g.streamCond.Broadcast()
-			g.mu.Unlock()
-		})
-		defer timer.Stop()
-	}
-
-	// Blocking wait loop
-	for !g.countComplete && pos > g.totalRunes {
-		if timedOut {
-			return ErrTimeout
-		}
-		if timeout > 0 && time.Now().After(deadline) {
-			return ErrTimeout
-		}
-		g.streamCond.Wait()
-	}
-
-	// Check final state
-	if g.countComplete && pos > g.totalRunes {
-		return ErrInvalidPosition
-	}
-	return nil
+func (g *Garland) waitForRunePosition(ctx context.Context, pos int64, timeout time.Duration) error {
+	g.ensureCounts()
+	return g.waitForCount(ctx, pos, timeout, &g.totalRunes)
 }
 
 // waitForLine blocks until the given line is available or timeout expires.
-// If timeout is 0, it returns immediately with ErrNotReady if not available.
-// If timeout is negative, it blocks indefinitely.
+// Same timeout and ctx rules as waitForBytePosition.
 // Caller must NOT hold the lock when calling this function.
-func (g *Garland) waitForLine(line int64, timeout time.Duration) error {
-	if line < 0 {
+func (g *Garland) waitForLine(ctx context.Context, line int64, timeout time.Duration) error {
+	g.ensureCounts()
+	return g.waitForCount(ctx, line, timeout, &g.totalLines)
+}
+
+// waitForCount is the single wait loop behind the three waitFor*
+// functions: it blocks until *count (one of the running totals, read
+// under g.mu) reaches pos, loading completes, the timeout expires
+// (ErrTimeout) or ctx is done (ctx.Err()). Timer and context both wake
+// the waiters with a broadcast on streamCond; each waiter re-checks its
+// own condition.
+func (g *Garland) waitForCount(ctx context.Context, pos int64, timeout time.Duration, count *int64) error {
+	if pos < 0 {
 		return ErrInvalidPosition
 	}
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	// Fast path
+	// Fast path: already available or complete
 	if g.countComplete {
-		if line > g.totalLines {
+		if pos > *count {
 			return ErrInvalidPosition
 		}
 		return nil
 	}
-	if line <= g.totalLines {
+	if pos <= *count {
 		return nil
 	}
 
@@ -3280,36 +3559,41 @@ func (g *Garland) waitForLine(line int64, timeout time.Duration) error {
 	if timeout == 0 {
 		return ErrNotReady
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	wake := func() {
+		g.mu.Lock()
+		g.streamCond.Broadcast() // Wake up all waiters to check their limits
+		g.mu.Unlock()
+	}
 
 	// Set up timeout if needed
 	var deadline time.Time
-	var timer *time.Timer
-	timedOut := false
-
 	if timeout > 0 {
 		deadline = time.Now().Add(timeout)
-		timer = time.AfterFunc(timeout, func() {
-			g.mu.Lock()
-			timedOut = true
-			g.streamCond.Broadcast()
-			g.mu.Unlock()
-		})
+		timer := time.AfterFunc(timeout, wake)
 		defer timer.Stop()
 	}
+	if ctx.Done() != nil {
+		stop := context.AfterFunc(ctx, wake)
+		defer stop()
+	}
 
 	// Blocking wait loop
-	for !g.countComplete && line > g.totalLines {
-		if timedOut {
+	for !g.countComplete && pos > *count {
+		if timeout > 0 && !time.Now().Before(deadline) {
 			return ErrTimeout
 		}
-		if timeout > 0 && time.Now().After(deadline) {
-			return ErrTimeout
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		g.streamCond.Wait()
+		g.streamCond.Wait() // Releases lock, waits for signal, reacquires lock
 	}
 
 	// Check final state
-	if g.countComplete && line > g.totalLines {
+	if g.countComplete && pos > *count {
 		return ErrInvalidPosition
 	}
 	return nil
@@ -3353,14 +3637,17 @@ func (g *Garland) ByteToLineRune(bytePos int64) (line, runeInLine int64, err err
 // implementation in byteToRuneInternalUnlocked (the RWMutex is not
 // reentrant; paths already holding the lock call the Unlocked core).
 func (g *Garland) byteToRuneInternal(bytePos int64) (int64, error) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+	g.ensureCounts()
+	defer g.lockForRead(bytePos, bytePos+1)()
 	return g.byteToRuneInternalUnlocked(bytePos)
 }
 
 // byteToRuneInternalUnlocked is the unlocked version for use when caller already holds the lock.
+// While counting is deferred it answers 0: its in-tree callers only keep
+// cursors' rune coordinates current, and those are recomputed when the
+// counts are built (see counting.go).
 func (g *Garland) byteToRuneInternalUnlocked(bytePos int64) (int64, error) {
-	if bytePos == 0 {
+	if bytePos == 0 || g.countsDeferred.Load() {
 		return 0, nil
 	}
 
@@ -3401,14 +3688,16 @@ func (g *Garland) runeToByteInternalUnlocked(runePos int64) (int64, error) {
 // the read lock now covers the WHOLE conversion instead of being
 // taken piecemeal by each tree lookup.
 func (g *Garland) byteToLineRuneInternal(bytePos int64) (int64, int64, error) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+	g.ensureCounts()
+	// The conversion may look one byte back (end-of-leaf case).
+	defer g.lockForRead(bytePos-1, bytePos+1)()
 	return g.byteToLineRuneInternalUnlocked(bytePos)
 }
 
 // byteToLineRuneInternalUnlocked is the unlocked version for use when caller already holds the lock.
+// Like byteToRuneInternalUnlocked it answers 0 while counting is deferred.
 func (g *Garland) byteToLineRuneInternalUnlocked(bytePos int64) (int64, int64, error) {
-	if bytePos == 0 {
+	if bytePos == 0 || g.countsDeferred.Load() {
 		return 0, 0, nil
 	}
 
@@ -3416,7 +3705,12 @@ func (g *Garland) byteToLineRuneInternalUnlocked(bytePos int64) (int64, int64, e
 	if err != nil {
 		return 0, 0, err
 	}
+	return g.lineRuneInLeafLocked(result, bytePos)
+}
 
+// lineRuneInLeafLocked finishes byteToLineRuneInternalUnlocked once the
+// leaf holding bytePos (> 0) has been found.
+func (g *Garland) lineRuneInLeafLocked(result *LeafSearchResult, bytePos int64) (int64, int64, error) {
 	snap := result.Snapshot
 
 	// Handle position at the end of a leaf (ByteOffset == len(data)) or in empty leaf
@@ -3434,7 +3728,7 @@ func (g *Garland) byteToLineRuneInternalUnlocked(bytePos int64) (int64, int64, e
 		if lastByte == '\n' {
 			// We're on a new line after the newline
 			// Count all lines up to and including this leaf
-			absoluteLine := g.countLinesBeforeLeaf(result.LeafByteStart) + snap.lineCount
+			absoluteLine := result.LeafLineStart + snap.lineCount
 			return absoluteLine, 0, nil
 		}
 
@@ -3452,7 +3746,7 @@ func (g *Garland) byteToLineRuneInternalUnlocked(bytePos int64) (int64, int64, e
 			}
 		}
 
-		absoluteLine := g.countLinesBeforeLeaf(prevResult.LeafByteStart) + line
+		absoluteLine := prevResult.LeafLineStart + line
 		runeInLine := prevSnap.runeCount - lineRuneStart
 		if line == 0 {
 			// The final line may SPAN leaves: when the previous leaf has
@@ -3479,7 +3773,7 @@ func (g *Garland) byteToLineRuneInternalUnlocked(bytePos int64) (int64, int64, e
 	}
 
 	// Calculate absolute line number
-	absoluteLine := g.countLinesBeforeLeaf(result.LeafByteStart) + line
+	absoluteLine := result.LeafLineStart + line
 
 	// Calculate rune position within the line
 	runeInLine := result.RuneOffset - lineRuneStart
@@ -3780,6 +4074,7 @@ func decodeLastRune(data []byte) (rune, int) {
 func (g *Garland) seekLineEndAt(c *Cursor) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.ensureCountsLocked()
 
 	currentLine := c.line
 
@@ -3809,62 +4104,34 @@ func (g *Garland) seekLineEndAt(c *Cursor) error {
 	return nil
 }
 
-// countLinesBeforeLeaf counts the total lines in all leaves before the one starting at byteStart.
-func (g *Garland) countLinesBeforeLeaf(byteStart int64) int64 {
-	if byteStart == 0 {
-		return 0
-	}
-
-	rootSnap := g.root.snapshotAt(g.currentFork, g.currentRevision)
-	if rootSnap == nil {
-		return 0
-	}
-
-	return g.countLinesBeforeByteInternal(g.root, rootSnap, byteStart, 0)
-}
-
-func (g *Garland) countLinesBeforeByteInternal(node *Node, snap *NodeSnapshot, targetByte int64, currentByte int64) int64 {
-	if snap.isLeaf {
-		return 0
-	}
-
-	leftNode := g.nodeRegistry[snap.leftID]
-	leftSnap := leftNode.snapshotAt(g.currentFork, g.currentRevision)
-
-	leftEnd := currentByte + leftSnap.byteCount
-
-	if targetByte < leftEnd {
-		// Target is in left subtree
-		return g.countLinesBeforeByteInternal(leftNode, leftSnap, targetByte, currentByte)
-	}
-
-	// Target is in right subtree; count all lines in left subtree
-	rightNode := g.nodeRegistry[snap.rightID]
-	rightSnap := rightNode.snapshotAt(g.currentFork, g.currentRevision)
-
-	return leftSnap.lineCount + g.countLinesBeforeByteInternal(rightNode, rightSnap, targetByte, leftEnd)
-}
-
 // Mutation operations
 
 func (g *Garland) insertBytesAt(c *Cursor, pos int64, data []byte, decorations []RelativeDecoration, insertBefore bool) (ChangeResult, error) {
+	decorations = storedRelativeDecorations(decorations)
 	if len(data) == 0 && len(decorations) == 0 {
 		return ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}, nil
 	}
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	if c.removed.Load() {
+		return ChangeResult{}, ErrCursorNotFound // removed while the op waited for the lock
+	}
 
 	// Validate position
 	if pos < 0 || pos > g.totalBytes {
 		return ChangeResult{}, ErrInvalidPosition
 	}
+	if err := c.editableLocked(pos, pos); err != nil {
+		return ChangeResult{}, err
+	}
 
 	// Coalescing: does this insert continue the active typing run?
 	// The decision is consumed by recordMutation; the deferred clear
 	// keeps a failed mutation from leaking it into the next op.
 	amend := g.coalesceDecideLocked(coalesceInsert, pos, int64(len(data)))
 	defer func() { g.coalescePending = coalescePending{} }()
+	defer g.noteOpLocked(ReplayRecord{Op: replayInsert, Pos: pos, Data: data, Decorations: decorations, Before: insertBefore})()
 
 	// Record cursor positions BEFORE any changes (for undo history).
 	// Skipped in transactions (recorded at TransactionStart) and for
@@ -3880,25 +4147,29 @@ func (g *Garland) insertBytesAt(c *Cursor, pos int64, data []byte, decorations [
 		return ChangeResult{}, ErrInvalidPosition
 	}
 
-	interiorDecs, endDecs := splitEndDecorations(decorations, int64(len(data)))
-	newRootID, err := g.insertInternal(g.root, rootSnap, pos, 0, data, interiorDecs, insertBefore)
+	// A keystroke continuing a typing streak appends to the streak's
+	// leaf instead of rebuilding the leaf it lands in.
+	newRootID, typed, err := g.typeIntoLeafLocked(pos, data, decorations)
 	if err != nil {
 		return ChangeResult{}, err
 	}
+	interiorDecs, endDecs := splitEndDecorations(decorations, int64(len(data)))
+	if !typed {
+		newRootID, err = g.insertInternal(g.root, rootSnap, pos, 0, data, interiorDecs, insertBefore)
+		if err != nil {
+			return ChangeResult{}, err
+		}
+	}
 
 	// Update tree root
 	g.root = g.nodeRegistry[newRootID]
 	g.addEndDecorations(endDecs, pos)
+	g.noteTypingLocked(pos, data, decorations)
 
 	// Calculate deltas for counts
 	insertedBytes := int64(len(data))
-	insertedRunes := int64(len([]rune(string(data))))
-	insertedLines := int64(0)
-	for _, b := range data {
-		if b == '\n' {
-			insertedLines++
-		}
-	}
+	insertedRunes := countRunes(data)
+	insertedLines := countNewlines(data)
 
 	// Update counts
 	g.totalBytes += insertedBytes
@@ -3912,6 +4183,8 @@ func (g *Garland) insertBytesAt(c *Cursor, pos int64, data []byte, decorations [
 			cursor.adjustForMutation(pos, insertedBytes, insertedRunes, insertedLines, insertBefore)
 		}
 	}
+	g.shiftEphemeralLocked(pos, 0, insertedBytes, insertBefore)
+	g.journalSpliceLocked(pos, 0, data)
 
 	// Handle versioning
 	return g.recordMutation(), nil
@@ -3928,6 +4201,9 @@ func (g *Garland) deleteBytesAt(c *Cursor, pos int64, length int64, includeLineD
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	if c.removed.Load() {
+		return nil, ChangeResult{}, ErrCursorNotFound // removed while the op waited for the lock
+	}
 
 	// Validate position
 	if pos < 0 || pos >= g.totalBytes {
@@ -3939,10 +4215,14 @@ func (g *Garland) deleteBytesAt(c *Cursor, pos int64, length int64, includeLineD
 	if pos+length > g.totalBytes {
 		length = g.totalBytes - pos
 	}
+	if err := c.editableLocked(pos, pos+length); err != nil {
+		return nil, ChangeResult{}, err
+	}
 
 	// Coalescing: does this delete continue the active deletion run?
 	amend := g.coalesceDecideLocked(coalesceDelete, pos, length)
 	defer func() { g.coalescePending = coalescePending{} }()
+	defer g.noteOpLocked(ReplayRecord{Op: replayDelete, Pos: pos, Length: length, IncludeLine: includeLineDecorations})()
 
 	// Record cursor positions BEFORE any changes (for undo history).
 	// Skipped in transactions and for amending ops (see insertBytesAt).
@@ -3958,13 +4238,8 @@ func (g *Garland) deleteBytesAt(c *Cursor, pos int64, length int64, includeLineD
 
 	// Calculate what we're deleting
 	deletedBytes := int64(len(deletedData))
-	deletedRunes := int64(len([]rune(string(deletedData))))
-	deletedLines := int64(0)
-	for _, b := range deletedData {
-		if b == '\n' {
-			deletedLines++
-		}
-	}
+	deletedRunes := countRunes(deletedData)
+	deletedLines := countNewlines(deletedData)
 
 	// Perform the deletion
 	deletedDecs, newRootID, err := g.deleteRange(pos, length)
@@ -3986,7 +4261,7 @@ func (g *Garland) deleteBytesAt(c *Cursor, pos int64, length int64, includeLineD
 	// deleteRange dropped them from their leaves - re-home each at the
 	// deletion point (right-anchored placement).
 	for _, d := range deletedDecs {
-		if newRootID, err := g.addDecorationInternal(d.Key, pos); err == nil {
+		if newRootID, err := g.addDecorationInternal(d.Key, pos, d.Gravity); err == nil {
 			g.root = g.nodeRegistry[newRootID]
 		}
 	}
@@ -4006,14 +4281,13 @@ func (g *Garland) deleteBytesAt(c *Cursor, pos int64, length int64, includeLineD
 			}
 		}
 	}
+	g.shiftEphemeralLocked(pos, length, 0, false)
+	g.journalSpliceLocked(pos, deletedBytes)
 
 	// Convert absolute decorations to relative
 	relDecs := make([]RelativeDecoration, len(deletedDecs))
 	for i, d := range deletedDecs {
-		relDecs[i] = RelativeDecoration{
-			Key:      d.Key,
-			Position: d.Position - pos,
-		}
+		relDecs[i] = reportRelativeDecoration(d, pos)
 	}
 
 	// Handle versioning
@@ -4032,8 +4306,12 @@ func (g *Garland) overwriteBytesAt(c *Cursor, pos int64, length int64, newData [
 // - insertBefore: if true, displaced decorations consolidate to end; if false, to start
 // Returns the original decorations from the overwritten range with their original relative positions.
 func (g *Garland) overwriteBytesAtInternal(c *Cursor, pos int64, length int64, newData []byte, decorationsToAdd []RelativeDecoration, insertBefore bool) ([]RelativeDecoration, ChangeResult, error) {
+	decorationsToAdd = storedRelativeDecorations(decorationsToAdd)
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	if c.removed.Load() {
+		return nil, ChangeResult{}, ErrCursorNotFound // removed while the op waited for the lock
+	}
 
 	// Handle edge case: if length is 0 and newData is empty, nothing to do
 	if length == 0 && len(newData) == 0 {
@@ -4044,12 +4322,16 @@ func (g *Garland) overwriteBytesAtInternal(c *Cursor, pos int64, length int64, n
 	if pos < 0 || pos > g.totalBytes {
 		return nil, ChangeResult{}, ErrInvalidPosition
 	}
+	if err := c.editableLocked(pos, min(pos+length, g.totalBytes)); err != nil {
+		return nil, ChangeResult{}, err
+	}
 
 	// Coalescing: does this overwrite continue the active overwrite run?
 	// The run tracks its OWN written span, so the decision keys on the
 	// written length (len(newData)), not the deleted length.
 	amend := g.coalesceDecideLocked(coalesceOverwrite, pos, int64(len(newData)))
 	defer func() { g.coalescePending = coalescePending{} }()
+	defer g.noteOpLocked(ReplayRecord{Op: replayOverwrite, Pos: pos, Length: length, Data: newData, Decorations: decorationsToAdd, Before: insertBefore})()
 
 	// Record cursor positions BEFORE any changes (for undo history).
 	// Skipped in transactions and for amending ops (the run's revision
@@ -4087,13 +4369,8 @@ func (g *Garland) overwriteBytesAtInternal(c *Cursor, pos int64, length int64, n
 
 	// Calculate deleted counts
 	deletedBytes := int64(len(deletedData))
-	deletedRunes := int64(len([]rune(string(deletedData))))
-	deletedLines := int64(0)
-	for _, b := range deletedData {
-		if b == '\n' {
-			deletedLines++
-		}
-	}
+	deletedRunes := countRunes(deletedData)
+	deletedLines := countNewlines(deletedData)
 
 	// Build the decorations for the new content:
 	// 1. Start with explicitly provided decorations
@@ -4117,6 +4394,7 @@ func (g *Garland) overwriteBytesAtInternal(c *Cursor, pos int64, length int64, n
 		allDecorations = append(allDecorations, RelativeDecoration{
 			Key:      d.Key,
 			Position: consolidatePos,
+			Gravity:  d.Gravity,
 		})
 	}
 
@@ -4152,7 +4430,7 @@ func (g *Garland) overwriteBytesAtInternal(c *Cursor, pos int64, length int64, n
 			if oldRootID, removed, err := g.removeDecorationDirect(d.Key); err == nil && removed {
 				g.root = g.nodeRegistry[oldRootID]
 			}
-			if newRootID, err := g.addDecorationInternal(d.Key, pos); err == nil {
+			if newRootID, err := g.addDecorationInternal(d.Key, pos, d.Gravity); err == nil {
 				g.root = g.nodeRegistry[newRootID]
 			}
 		}
@@ -4160,13 +4438,8 @@ func (g *Garland) overwriteBytesAtInternal(c *Cursor, pos int64, length int64, n
 
 	// Calculate inserted counts
 	insertedBytes := int64(len(newData))
-	insertedRunes := int64(len([]rune(string(newData))))
-	insertedLines := int64(0)
-	for _, b := range newData {
-		if b == '\n' {
-			insertedLines++
-		}
-	}
+	insertedRunes := countRunes(newData)
+	insertedLines := countNewlines(newData)
 
 	// Update counts with net change
 	g.totalBytes += insertedBytes - deletedBytes
@@ -4201,14 +4474,13 @@ func (g *Garland) overwriteBytesAtInternal(c *Cursor, pos int64, length int64, n
 		cursor.line, cursor.lineRune, _ = g.byteToLineRuneInternalUnlocked(cursor.bytePos)
 		cursor.lineRuneDirty = false
 	}
+	g.shiftEphemeralLocked(pos, length, insertedBytes, insertBefore)
+	g.journalSpliceLocked(pos, deletedBytes, newData)
 
 	// Convert absolute decorations to relative (original positions before deletion)
 	relDecs := make([]RelativeDecoration, len(deletedDecs))
 	for i, d := range deletedDecs {
-		relDecs[i] = RelativeDecoration{
-			Key:      d.Key,
-			Position: d.Position - pos,
-		}
+		relDecs[i] = reportRelativeDecoration(d, pos)
 	}
 
 	// Handle versioning
@@ -4240,7 +4512,7 @@ func splitEndDecorations(decs []RelativeDecoration, n int64) (interior, end []Re
 // landing, updating the root as it goes. See splitEndDecorations.
 func (g *Garland) addEndDecorations(end []RelativeDecoration, landing int64) {
 	for _, d := range end {
-		if newRootID, err := g.addDecorationInternal(d.Key, landing+d.Position); err == nil {
+		if newRootID, err := g.addDecorationInternal(d.Key, landing+d.Position, d.Gravity); err == nil {
 			g.root = g.nodeRegistry[newRootID]
 		}
 	}
@@ -4266,6 +4538,9 @@ type CopyResult struct {
 func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int64, insertBefore bool) (MoveResult, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	if c.removed.Load() {
+		return MoveResult{}, ErrCursorNotFound // removed while the op waited for the lock
+	}
 
 	// Validate positions
 	if srcStart < 0 || srcEnd < srcStart || srcEnd > g.totalBytes {
@@ -4283,6 +4558,13 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 	if srcStart < dstEnd && dstStart < srcEnd {
 		return MoveResult{}, ErrOverlappingRanges
 	}
+	if err := c.editableLocked(srcStart, srcEnd); err != nil {
+		return MoveResult{}, err
+	}
+	if err := c.editableLocked(dstStart, dstEnd); err != nil {
+		return MoveResult{}, err
+	}
+	defer g.noteOpLocked(ReplayRecord{Op: replayMove, SrcStart: srcStart, SrcEnd: srcEnd, DstStart: dstStart, DstEnd: dstEnd, Before: insertBefore})()
 
 	// Handle edge case: moving zero bytes
 	if srcLen == 0 && dstLen == 0 {
@@ -4316,6 +4598,7 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 		srcRelDecs[i] = RelativeDecoration{
 			Key:      d.Key,
 			Position: d.Position - srcStart,
+			Gravity:  d.Gravity,
 		}
 	}
 
@@ -4370,6 +4653,7 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 				allDecs = append(allDecs, RelativeDecoration{
 					Key:      d.Key,
 					Position: consolidatePos,
+					Gravity:  d.Gravity,
 				})
 			}
 
@@ -4400,7 +4684,7 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 				if oldRootID, removed, err := g.removeDecorationDirect(d.Key); err == nil && removed {
 					g.root = g.nodeRegistry[oldRootID]
 				}
-				if newRootID, err := g.addDecorationInternal(d.Key, adjustedDst); err == nil {
+				if newRootID, err := g.addDecorationInternal(d.Key, adjustedDst, d.Gravity); err == nil {
 					g.root = g.nodeRegistry[newRootID]
 				}
 			}
@@ -4439,6 +4723,7 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 				allDecs = append(allDecs, RelativeDecoration{
 					Key:      d.Key,
 					Position: consolidatePos,
+					Gravity:  d.Gravity,
 				})
 			}
 
@@ -4470,7 +4755,7 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 				if oldRootID, removed, err := g.removeDecorationDirect(d.Key); err == nil && removed {
 					g.root = g.nodeRegistry[oldRootID]
 				}
-				if newRootID, err := g.addDecorationInternal(d.Key, dstStart); err == nil {
+				if newRootID, err := g.addDecorationInternal(d.Key, dstStart, d.Gravity); err == nil {
 					g.root = g.nodeRegistry[newRootID]
 				}
 			}
@@ -4487,6 +4772,9 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 	} else {
 		finalDstStart = dstStart
 	}
+	g.moveEphemeralLocked(srcStart, srcEnd, dstStart, dstEnd, finalDstStart, insertBefore)
+	g.journalSpliceLocked(srcStart, srcLen)
+	g.journalSpliceLocked(finalDstStart, dstLen, srcData)
 
 	// Adjust cursors
 	for _, cursor := range g.cursors {
@@ -4509,10 +4797,7 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 	// Convert destination decorations to relative (original positions)
 	dstRelDecs := make([]RelativeDecoration, len(dstDecs))
 	for i, d := range dstDecs {
-		dstRelDecs[i] = RelativeDecoration{
-			Key:      d.Key,
-			Position: d.Position - dstStart,
-		}
+		dstRelDecs[i] = reportRelativeDecoration(d, dstStart)
 	}
 
 	// Move/Copy rearranges content at TWO sites; per-site delta
@@ -4542,8 +4827,12 @@ func (g *Garland) moveBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 // decorationsToAdd are added to the copied content (relative to copied content start).
 // Decorations in the destination range are consolidated and returned.
 func (g *Garland) copyBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int64, decorationsToAdd []RelativeDecoration, insertBefore bool) (CopyResult, error) {
+	decorationsToAdd = storedRelativeDecorations(decorationsToAdd)
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	if c.removed.Load() {
+		return CopyResult{}, ErrCursorNotFound // removed while the op waited for the lock
+	}
 
 	// Validate positions
 	if srcStart < 0 || srcEnd < srcStart || srcEnd > g.totalBytes {
@@ -4552,6 +4841,10 @@ func (g *Garland) copyBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 	if dstStart < 0 || dstEnd < dstStart || dstEnd > g.totalBytes {
 		return CopyResult{}, ErrInvalidPosition
 	}
+	if err := c.editableLocked(dstStart, dstEnd); err != nil {
+		return CopyResult{}, err
+	}
+	defer g.noteOpLocked(ReplayRecord{Op: replayCopy, SrcStart: srcStart, SrcEnd: srcEnd, DstStart: dstStart, DstEnd: dstEnd, Decorations: decorationsToAdd, Before: insertBefore})()
 
 	srcLen := srcEnd - srcStart
 	dstLen := dstEnd - dstStart
@@ -4608,6 +4901,7 @@ func (g *Garland) copyBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 		allDecs = append(allDecs, RelativeDecoration{
 			Key:      d.Key,
 			Position: consolidatePos,
+			Gravity:  d.Gravity,
 		})
 	}
 
@@ -4641,7 +4935,7 @@ func (g *Garland) copyBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 			if oldRootID, removed, err := g.removeDecorationDirect(d.Key); err == nil && removed {
 				g.root = g.nodeRegistry[oldRootID]
 			}
-			if newRootID, err := g.addDecorationInternal(d.Key, dstStart); err == nil {
+			if newRootID, err := g.addDecorationInternal(d.Key, dstStart, d.Gravity); err == nil {
 				g.root = g.nodeRegistry[newRootID]
 			}
 		}
@@ -4655,6 +4949,8 @@ func (g *Garland) copyBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 	// the replaced content and always shifts; a pure insertion point
 	// (dstLen == 0) is governed by the insertBefore flag.
 	netChange := int64(len(srcData)) - dstLen
+	g.shiftEphemeralLocked(dstStart, dstLen, int64(len(srcData)), insertBefore)
+	g.journalSpliceLocked(dstStart, dstLen, srcData)
 	for _, cursor := range g.cursors {
 		if cursor != c {
 			if cursor.bytePos > dstStart+dstLen ||
@@ -4681,10 +4977,7 @@ func (g *Garland) copyBytesAt(c *Cursor, srcStart, srcEnd, dstStart, dstEnd int6
 	// Convert destination decorations to relative (original positions)
 	dstRelDecs := make([]RelativeDecoration, len(dstDecs))
 	for i, d := range dstDecs {
-		dstRelDecs[i] = RelativeDecoration{
-			Key:      d.Key,
-			Position: d.Position - dstStart,
-		}
+		dstRelDecs[i] = reportRelativeDecoration(d, dstStart)
 	}
 
 	// Move/Copy rearranges content at TWO sites; per-site delta
@@ -4741,6 +5034,7 @@ func (g *Garland) collectDecorationsInRangeRecursive(node *Node, snap *NodeSnaps
 				*result = append(*result, Decoration{
 					Key:      d.Key,
 					Position: absPos,
+					Gravity:  d.Gravity,
 				})
 			}
 		}
@@ -4841,11 +5135,13 @@ func (g *Garland) truncateAt(c *Cursor, pos int64) (ChangeResult, error) {
 func (g *Garland) setCursorFromByte(c *Cursor, pos int64) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	runePos, err := g.byteToRuneInternalUnlocked(pos)
-	if err != nil {
-		return err
-	}
-	line, lineRune, err := g.byteToLineRuneInternalUnlocked(pos)
+	return g.placeCursorLocked(c, c.clampSeekLocked(pos, g.totalBytes))
+}
+
+// placeCursorLocked is setCursorFromByte for a caller already holding
+// the write lock.
+func (g *Garland) placeCursorLocked(c *Cursor, pos int64) error {
+	runePos, line, lineRune, err := g.cursorCoordsLocked(c, pos)
 	if err != nil {
 		return err
 	}
@@ -4857,6 +5153,8 @@ func (g *Garland) setCursorFromByte(c *Cursor, pos int64) error {
 func (g *Garland) setCursorFromRune(c *Cursor, runePos int64) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	runePos = c.clampSeekLocked(runePos, g.totalRunes)
 	pos, err := g.runeToByteInternalUnlocked(runePos)
 	if err != nil {
 		return err
@@ -4873,7 +5171,22 @@ func (g *Garland) setCursorFromRune(c *Cursor, runePos int64) error {
 func (g *Garland) setCursorFromLine(c *Cursor, line, runeInLine int64) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	if c.seekPolicy != SeekPolicyError {
+		var err error
+		if line, runeInLine, err = g.clampSeekLineLocked(c, line, runeInLine); err != nil {
+			return err
+		}
+	}
+	if c.virtualSpace {
+		if handled, err := g.seekVirtualLocked(c, line, runeInLine); handled || err != nil {
+			return err
+		}
+	}
 	pos, err := g.lineRuneToByteInternalUnlocked(line, runeInLine)
+	if err == ErrInvalidPosition && c.seekPolicy == SeekPolicyClampToEOF {
+		pos, err = g.totalBytes, nil // the column ran past the end
+	}
 	if err != nil {
 		return err
 	}
@@ -4898,17 +5211,28 @@ func (g *Garland) setCursorFromLine(c *Cursor, line, runeInLine int64) error {
 // If in a transaction, marks it as having mutations.
 // Otherwise, creates a new revision.
 // If not at HEAD revision, creates a new fork first.
-func (g *Garland) recordMutation() ChangeResult {
+func (g *Garland) recordMutation() (result ChangeResult) {
 	// Consume the coalescing decision (if the op made one). Consuming
 	// here means a decision can never outlive its own mutation.
 	pc := g.coalescePending
 	g.coalescePending = coalescePending{}
+	g.invalidateLeafHints()
+	if g.recorder != nil {
+		defer func() { g.recordOpLocked(pc, result) }()
+	}
 
 	// The buffer is diverging from its source: make sure the emacs
 	// lock (when enabled) is held and the pre-session backup (when
 	// configured) is armed. Nil-checks plus a few bools when idle.
 	g.emacsLockMutatedLocked()
 	g.backupMutatedLocked()
+	g.touchAccess()
+	if g.transaction == nil && len(g.decorationWatches) > 0 {
+		defer g.checkDecorationWatchesLocked()
+	}
+	if g.transaction == nil && len(g.inputEditWatches) > 0 {
+		defer g.checkInputEditWatchesLocked() // runs first: the edit, then the marks it moved
+	}
 
 	if g.transaction != nil {
 		// A transaction is its own (stronger) grouping - any active
@@ -4945,7 +5269,10 @@ func (g *Garland) recordMutation() ChangeResult {
 			g.applyPendingDecorationUpdates(g.currentFork, g.currentRevision)
 			g.coalesceExtendRunLocked(pc)
 			// Cursors' lastFork/lastRevision already name this revision.
+			g.rebalanceAfterMutationLocked()
 			g.kickMaintenance()
+			g.journalLocked()
+			g.gitHistoryLocked()
 			return ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}
 		}
 		// Missing revision info (should not happen): fall through to a
@@ -4973,6 +5300,7 @@ func (g *Garland) recordMutation() ChangeResult {
 		HasChanges:       true,
 		RootID:           g.root.id,
 		StreamKnownBytes: streamKnown(),
+		Time:             g.coalesce.clock(),
 	}
 
 	// Apply pending decoration cache updates with the correct revision
@@ -4992,7 +5320,10 @@ func (g *Garland) recordMutation() ChangeResult {
 		g.coalesce.active = false
 	}
 
+	g.rebalanceAfterMutationLocked()
 	g.kickMaintenance()
+	g.journalLocked()
+	g.gitHistoryLocked()
 
 	return ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}
 }
@@ -5003,9 +5334,11 @@ func (g *Garland) recordMutation() ChangeResult {
 // goroutine per mutation means one full node-registry scan PER
 // KEYSTROKE, each scan growing with the registry.
 func (g *Garland) kickMaintenance() {
-	if g.lib != nil && (g.lib.memorySoftLimit > 0 || g.lib.memoryHardLimit > 0) &&
+	if g.lib != nil && !g.closed && (g.lib.memorySoftLimit > 0 || g.lib.memoryHardLimit > 0) &&
 		atomic.CompareAndSwapInt32(&g.maintenanceInFlight, 0, 1) {
+		g.maintenanceWg.Add(1)
 		go func() {
+			defer g.maintenanceWg.Done()
 			defer atomic.StoreInt32(&g.maintenanceInFlight, 0)
 			g.CheckMemoryPressure()
 		}()
@@ -5023,12 +5356,12 @@ func (g *Garland) recordCursorPositionsInHistory() {
 		// Always update position - cursor may have moved since last record
 		// This captures the position just before the mutation occurs
 		cursor.resolveStaleLineRuneLocked() // history must store real columns
-		cursor.positionHistory[key] = &CursorPosition{
+		cursor.positionHistory[key] = cursor.withAnchor(&CursorPosition{
 			BytePos:  cursor.bytePos,
 			RunePos:  cursor.runePos,
 			Line:     cursor.line,
 			LineRune: cursor.lineRune,
-		}
+		})
 	}
 }
 
@@ -5062,6 +5395,12 @@ func (g *Garland) createForkFromCurrent() {
 // Read operations
 
 func (g *Garland) readBytesAt(pos int64, length int64) ([]byte, error) {
+	return g.readBytesFrom(nil, pos, length)
+}
+
+// readBytesFrom is readBytesAt for a reading cursor, whose leaf hint
+// (when not nil) can spare the descents (see leaf_hint.go).
+func (g *Garland) readBytesFrom(c *Cursor, pos int64, length int64) ([]byte, error) {
 	if pos < 0 {
 		return nil, ErrInvalidPosition
 	}
@@ -5069,13 +5408,18 @@ func (g *Garland) readBytesAt(pos int64, length int64) ([]byte, error) {
 	if length <= 0 {
 		return nil, nil
 	}
+	g.touchAccess()
 
-	// Try read with read lock first (fast path)
-	g.mu.Lock()
+	// Shared lock when the range is resident (see sharedread.go)
+	var hint *leafHint
+	if c != nil {
+		hint = &c.hint
+	}
+	unlock := g.lockForReadHinted(hint, pos, pos+length)
 	totalBytesForRevision := g.calculateTotalBytesUnlocked()
 
 	if pos > totalBytesForRevision {
-		g.mu.Unlock()
+		unlock()
 		return nil, ErrInvalidPosition
 	}
 
@@ -5085,8 +5429,8 @@ func (g *Garland) readBytesAt(pos int64, length int64) ([]byte, error) {
 		readLength = totalBytesForRevision - pos
 	}
 
-	result, err := g.readBytesRangeInternal(pos, readLength)
-	g.mu.Unlock()
+	result, err := g.readBytesRangeHinted(hint, pos, readLength)
+	unlock()
 
 	// If data is not loaded (cold storage), try to thaw and retry
 	if err == ErrDataNotLoaded {
@@ -5134,9 +5478,11 @@ func (g *Garland) readStringAt(pos int64, length int64) (string, error) {
 	if length <= 0 {
 		return "", nil
 	}
+	g.touchAccess()
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.ensureCountsLocked()
 
 	if pos < 0 || pos > g.totalRunes {
 		return "", ErrInvalidPosition
@@ -5166,9 +5512,11 @@ func (g *Garland) readLineAt(line int64) (string, error) {
 	if line < 0 {
 		return "", ErrInvalidPosition
 	}
+	g.touchAccess()
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.ensureCountsLocked()
 
 	// Validate line number
 	if line > g.totalLines {
@@ -5204,6 +5552,12 @@ func (g *Garland) readLineAt(line int64) (string, error) {
 // For revisions created during streaming, this includes the streaming remainder.
 // Caller must hold at least read lock.
 func (g *Garland) readBytesRangeInternal(pos int64, length int64) ([]byte, error) {
+	return g.readBytesRangeHinted(nil, pos, length)
+}
+
+// readBytesRangeHinted is readBytesRangeInternal starting from a
+// cursor's leaf hint, if it applies.
+func (g *Garland) readBytesRangeHinted(hint *leafHint, pos int64, length int64) ([]byte, error) {
 	if length <= 0 {
 		return nil, nil
 	}
@@ -5251,9 +5605,12 @@ func (g *Garland) readBytesRangeInternal(pos int64, length int64) ([]byte, error
 
 	// Read from tree portion
 	for remaining > 0 && currentPos < treeBytes {
-		leafResult, err := g.findLeafByByteUnlocked(currentPos)
-		if err != nil {
-			return nil, err
+		leafResult := hint.lookupLocked(g, currentPos)
+		if leafResult == nil {
+			var err error
+			if leafResult, err = g.findLeafByByteUnlocked(currentPos); err != nil {
+				return nil, err
+			}
 		}
 
 		snap := leafResult.Snapshot
@@ -5354,6 +5711,7 @@ func (g *Garland) findLeafByByteInTree(root *Node, fork ForkID, revision Revisio
 	accumulatedBytes := int64(0)
 
 	for {
+		g.traceVisit()
 		snap := node.snapshotAt(fork, revision)
 		if snap == nil {
 			return nil, ErrInternal
@@ -5436,21 +5794,28 @@ func formatGarlandID(id uint64) string {
 }
 
 // Decorate adds, updates, or removes decorations at absolute positions.
-// All changes are applied as a single revision.
+// All changes are applied as a single revision; a batch rewrites each
+// affected leaf once (see decoration_bulk.go).
 // Pass nil Address in a DecorationEntry to delete that decoration.
 func (g *Garland) Decorate(entries []DecorationEntry) (ChangeResult, error) {
 	if len(entries) == 0 {
 		return ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}, nil
 	}
 	for _, e := range entries {
-		if !ValidDecorationKey(e.Key) {
+		if !ValidDecorationKey(e.Key) || (e.Namespace != "" && !ValidDecorationKey(e.Namespace)) {
 			return ChangeResult{}, ErrInvalidDecorationKey
 		}
 	}
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	defer g.noteOpLocked(ReplayRecord{Op: replayDecorate, Entries: entries})()
+	return g.decorateLocked(entries)
+}
 
+// decorateLocked applies validated entries. Caller must hold the write
+// lock.
+func (g *Garland) decorateLocked(entries []DecorationEntry) (ChangeResult, error) {
 	// Record cursor positions BEFORE any changes (for undo history)
 	// Only if not in transaction (transactions record at TransactionStart)
 	if g.transaction == nil {
@@ -5459,28 +5824,31 @@ func (g *Garland) Decorate(entries []DecorationEntry) (ChangeResult, error) {
 
 	// Separate deletions from additions/updates
 	var deletions []string
-	var additions []struct {
-		key     string
-		bytePos int64
-	}
+	var additions []decorationPlacement
 
 	for _, entry := range entries {
+		key := namespacedKey(entry.Namespace, entry.Key)
 		if entry.Address == nil {
 			// Deletion
-			deletions = append(deletions, entry.Key)
+			deletions = append(deletions, key)
 		} else {
 			// Addition/update - convert address to byte position
 			bytePos, err := g.addressToByteUnlocked(entry.Address)
 			if err != nil {
 				return ChangeResult{}, err
 			}
-			additions = append(additions, struct {
-				key     string
-				bytePos int64
-			}{entry.Key, bytePos})
+			additions = append(additions, decorationPlacement{key, bytePos, anchoredGravity(entry)})
 		}
 	}
 
+	// Batches rewrite each affected leaf once (see decoration_bulk.go)
+	if len(additions) > 1 {
+		if err := g.decorateBulkLocked(deletions, additions); err != nil {
+			return ChangeResult{}, err
+		}
+		return g.recordMutation(), nil
+	}
+
 	// Track whether any changes were made
 	changed := false
 
@@ -5525,9 +5893,8 @@ func (g *Garland) Decorate(entries []DecorationEntry) (ChangeResult, error) {
 		}
 	}
 
-	// Process additions/updates: group by leaf node for efficiency
+	// Process a single addition/update
 	if len(additions) > 0 {
-		// Group additions by their target leaf position
 		for _, add := range additions {
 			// A key is unique document-wide: an UPDATE must remove the
 			// old instance wherever it lives. addDecorationInternal only
@@ -5541,7 +5908,7 @@ func (g *Garland) Decorate(entries []DecorationEntry) (ChangeResult, error) {
 				g.root = g.nodeRegistry[oldRootID]
 				changed = true
 			}
-			newRootID, err := g.addDecorationInternal(add.key, add.bytePos)
+			newRootID, err := g.addDecorationInternal(add.key, add.bytePos, add.gravity)
 			if err != nil {
 				return ChangeResult{}, err
 			}
@@ -5563,7 +5930,13 @@ func (g *Garland) Decorate(entries []DecorationEntry) (ChangeResult, error) {
 func (g *Garland) GetDecorationPosition(key string) (AbsoluteAddress, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	return g.decorationPositionLocked(key)
+}
 
+// decorationPositionLocked is GetDecorationPosition for a stored key
+// (see namespacedKey). Caller must hold the write lock (cache hints
+// are refreshed).
+func (g *Garland) decorationPositionLocked(key string) (AbsoluteAddress, error) {
 	// During a transaction, always search the tree since decorations may
 	// have moved as a side effect of inserts/deletes (cache doesn't
 	// track these movements).
@@ -5705,6 +6078,7 @@ func (g *Garland) findDecorationWithHint(key string, hintOffset int64) (int64, N
 // revision number (which isn't known until after the mutation completes).
 func (g *Garland) updateDecorationCacheForNode(nodeID NodeID, nodeOffset int64, decorations []Decoration) {
 	for _, d := range decorations {
+		g.indexDecorationNamespaceLocked(d.Key)
 		g.pendingDecorationUpdates = append(g.pendingDecorationUpdates, pendingDecorationUpdate{
 			Key:    d.Key,
 			NodeID: nodeID,
@@ -5900,9 +6274,12 @@ func (g *Garland) collectDecorationsInRangeInternal(node *Node, snap *NodeSnapsh
 			absPos := offset + d.Position
 			if absPos >= start && absPos < end {
 				addr := ByteAddress(absPos)
+				ns, key := splitNamespacedKey(d.Key)
 				*result = append(*result, DecorationEntry{
-					Key:     d.Key,
-					Address: &addr,
+					Key:       key,
+					Namespace: ns,
+					Address:   &addr,
+					Gravity:   d.Gravity,
 				})
 			}
 		}
@@ -5929,6 +6306,7 @@ func (g *Garland) GetDecorationsOnLine(line int64) ([]DecorationEntry, error) {
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.ensureCountsLocked()
 
 	if line > g.totalLines {
 		return nil, ErrInvalidPosition
@@ -5954,6 +6332,99 @@ func (g *Garland) GetDecorationsOnLine(line int64) ([]DecorationEntry, error) {
 	return result, nil
 }
 
+// GetDecorationsOnLineRange returns the decorations on lines firstLine
+// through lastLine, grouped by line: result[i] holds line firstLine+i,
+// as GetDecorationsOnLine would return it. lastLine is clamped to the
+// document's last line, as ReadLineRange clamps. The span is found with
+// two descents and collected in one tree pass, which assigns each mark
+// its line from the leaves' line indexes.
+func (g *Garland) GetDecorationsOnLineRange(firstLine, lastLine int64) ([][]DecorationEntry, error) {
+	if firstLine < 0 || lastLine < firstLine {
+		return nil, ErrInvalidPosition
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+
+	if firstLine > g.totalLines {
+		return nil, ErrInvalidPosition
+	}
+	lastLine = min(lastLine, g.totalLines)
+
+	// The span runs from the start of firstLine to the start of the
+	// line after lastLine (the end of the document for the last line).
+	res, err := g.findLeafByLineUnlocked(firstLine, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, end := res.LineByteStart, g.totalBytes
+	if lastLine < g.totalLines {
+		if res, err = g.findLeafByLineUnlocked(lastLine+1, 0); err != nil {
+			return nil, err
+		}
+		end = res.LineByteStart
+	}
+
+	result := make([][]DecorationEntry, lastLine-firstLine+1)
+	rootSnap := g.root.snapshotAt(g.currentFork, g.currentRevision)
+	if rootSnap == nil {
+		return result, nil
+	}
+	g.collectDecorationLinesInternal(g.root, rootSnap, start, end, 0, 0, func(line int64, e DecorationEntry) {
+		if i := line - firstLine; i >= 0 && i < int64(len(result)) {
+			result[i] = append(result[i], e)
+		}
+	})
+	return result, nil
+}
+
+// collectDecorationLinesInternal is collectDecorationsInRangeInternal
+// that also reports each mark's line. lines is the number of newlines
+// before the subtree; inside a leaf, a mark's line is that plus the
+// leaf's line starts at or before it.
+func (g *Garland) collectDecorationLinesInternal(node *Node, snap *NodeSnapshot, start, end, offset, lines int64, emit func(line int64, e DecorationEntry)) {
+	if snap == nil {
+		return
+	}
+	if offset+snap.byteCount < start || offset >= end {
+		return
+	}
+	g.traceVisit()
+
+	if snap.isLeaf {
+		for _, d := range snap.decorations {
+			absPos := offset + d.Position
+			if absPos < start || absPos >= end {
+				continue
+			}
+			// lineStarts[0] is the leaf's own start, not a line start.
+			after := snap.lineStarts
+			if len(after) > 0 {
+				after = after[1:]
+			}
+			n := sort.Search(len(after), func(i int) bool { return after[i].ByteOffset > d.Position })
+			addr := ByteAddress(absPos)
+			ns, key := splitNamespacedKey(d.Key)
+			emit(lines+int64(n), DecorationEntry{
+				Key:       key,
+				Namespace: ns,
+				Address:   &addr,
+				Gravity:   d.Gravity,
+			})
+		}
+		return
+	}
+
+	leftNode := g.nodeRegistry[snap.leftID]
+	leftSnap := leftNode.snapshotAt(g.currentFork, g.currentRevision)
+	g.collectDecorationLinesInternal(leftNode, leftSnap, start, end, offset, lines, emit)
+
+	rightNode := g.nodeRegistry[snap.rightID]
+	rightSnap := rightNode.snapshotAt(g.currentFork, g.currentRevision)
+	g.collectDecorationLinesInternal(rightNode, rightSnap, start, end, offset+leftSnap.byteCount, lines+leftSnap.lineCount, emit)
+}
+
 // findLineEndUnlocked finds the byte position of the end of the line.
 // Caller must hold at least a read lock.
 func (g *Garland) findLineEndUnlocked(lineStart int64) int64 {
@@ -5991,24 +6462,10 @@ func (g *Garland) findLineEndUnlocked(lineStart int64) int64 {
 // If fs is nil, uses the Garland's source filesystem.
 func (g *Garland) DumpDecorations(fs FileSystemInterface, path string) error {
 	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	rootSnap := g.root.snapshotAt(g.currentFork, g.currentRevision)
-	if rootSnap == nil {
-		return nil
-	}
-
-	// Collect all decorations
-	var decorations []DecorationEntry
-	g.collectDecorationsInRangeInternal(g.root, rootSnap, 0, g.totalBytes+1, 0, &decorations)
-
-	// Build INI content
-	var content string
-	content = "[decorations]\n"
-	for _, d := range decorations {
-		if d.Address != nil {
-			content += d.Key + "=" + formatInt64(d.Address.Byte) + "\n"
-		}
+	decorations, err := g.decorationsAtLocked(g.liveStateLocked())
+	g.mu.Unlock()
+	if err != nil {
+		return err
 	}
 
 	// Use provided fs or default to sourceFS
@@ -6018,7 +6475,7 @@ func (g *Garland) DumpDecorations(fs FileSystemInterface, path string) error {
 	}
 
 	// Write to file
-	return targetFS.WriteFile(path, []byte(content))
+	return targetFS.WriteFile(path, formatDecorationsINI(decorations))
 }
 
 // formatInt64 converts an int64 to a string.
@@ -6055,17 +6512,22 @@ func (g *Garland) addressToByteUnlocked(addr *AbsoluteAddress) (int64, error) {
 		return addr.Byte, nil
 
 	case RuneMode:
+		g.ensureCountsLocked()
 		if addr.Rune < 0 || addr.Rune > g.totalRunes {
 			return 0, ErrInvalidPosition
 		}
 		return g.runeToByteUnlocked(addr.Rune)
 
 	case LineRuneMode:
+		g.ensureCountsLocked()
 		if addr.Line < 0 || addr.Line > g.totalLines {
 			return 0, ErrInvalidPosition
 		}
 		return g.lineRuneToByteUnlocked(addr.Line, addr.LineRune)
 
+	case EOFMode:
+		return g.totalBytes, nil
+
 	default:
 		return 0, ErrInvalidPosition
 	}
@@ -6307,7 +6769,7 @@ func (g *Garland) removeDecorationsInternal(node *Node, snap *NodeSnapshot, offs
 
 // addDecorationInternal adds a decoration at the given byte position.
 // Returns the new root node ID.
-func (g *Garland) addDecorationInternal(key string, bytePos int64) (NodeID, error) {
+func (g *Garland) addDecorationInternal(key string, bytePos int64, gravity Gravity) (NodeID, error) {
 	// Find the leaf containing this position
 	leafResult, err := g.findLeafByByteUnlocked(bytePos)
 	if err != nil {
@@ -6318,6 +6780,7 @@ func (g *Garland) addDecorationInternal(key string, bytePos int64) (NodeID, erro
 	newDec := Decoration{
 		Key:      key,
 		Position: leafResult.ByteOffset,
+		Gravity:  gravity,
 	}
 
 	// Build new decorations list - update existing or add new
@@ -6347,6 +6810,7 @@ func (g *Garland) addDecorationInternal(key string, bytePos int64) (NodeID, erro
 	// Queue cache update to be applied when recordMutation is called
 	// Note: Offset is the absolute byte position where the leaf starts (LeafByteStart),
 	// not the relative position within the leaf (ByteOffset)
+	g.indexDecorationNamespaceLocked(key)
 	g.pendingDecorationUpdates = append(g.pendingDecorationUpdates, pendingDecorationUpdate{
 		Key:    key,
 		NodeID: newLeaf.id,
@@ -6572,11 +7036,12 @@ func (g *Garland) LoadDecorationsFromString(content string) error {
 }
 
 // parseDecorationINI parses INI format decoration content.
-// Returns decoration entries from the [decorations] section.
+// Returns decoration entries from the [decorations] section, read per
+// the version in the [garland] header (see decoration_ini.go).
 // Unknown sections are silently ignored for forward compatibility.
 func parseDecorationINI(content string) ([]DecorationEntry, error) {
-	var entries []DecorationEntry
-	inDecorationsSection := false
+	var doc iniDocument
+	section := ""
 
 	lines := splitLines(content)
 	for _, line := range lines {
@@ -6598,31 +7063,32 @@ func parseDecorationINI(content string) ([]DecorationEntry, error) {
 
 		// Check for section header
 		if line[0] == '[' {
-			sectionName := parseSectionHeader(line)
-			inDecorationsSection = (sectionName == "decorations")
+			section = parseSectionHeader(line)
+			if section == "garland" && doc.header == nil {
+				doc.header = make(map[string]string)
+			}
 			continue
 		}
 
-		// Parse key=value if in decorations section
-		if inDecorationsSection {
-			key, value, ok := parseKeyValue(line)
-			if ok {
-				bytePos, err := parseInt64(value)
-				if err != nil {
-					// Skip malformed entries silently for robustness
-					continue
-				}
-				addr := ByteAddress(bytePos)
-				entries = append(entries, DecorationEntry{
-					Key:     key,
-					Address: &addr,
-				})
+		key, value, ok := parseKeyValue(line)
+		if !ok {
+			continue
+		}
+		switch section {
+		case "garland":
+			doc.header[key] = value
+		case "decorations":
+			doc.decorations = append(doc.decorations, [2]string{key, value})
+		case "gravity":
+			if doc.gravity == nil {
+				doc.gravity = make(map[string]string)
 			}
+			doc.gravity[key] = value
 		}
 		// Unknown sections are silently ignored
 	}
 
-	return entries, nil
+	return decodeDecorationINI(doc)
 }
 
 // splitLines splits content into lines, handling various line endings.
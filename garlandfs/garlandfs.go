@@ -0,0 +1,195 @@
+// Package garlandfs exposes a Garland's content as an io/fs file system.
+//
+// DESIGN: templating engines, static analysers and archivers take an
+// fs.FS, and handing them an unsaved buffer used to mean writing a temp
+// file first. New wraps a Garland as a one-file FS instead: the root
+// directory holds a single file whose content is the live buffer.
+//
+//   - The file is named after the source path's base name, or "buffer"
+//     for a Garland with no source (see FS.Name).
+//   - Each Open takes a SnapshotView of the current revision, so one
+//     open file reads a consistent text however the buffer is edited
+//     meanwhile; Close releases it. Open fails while a transaction is
+//     pending or the initial load is still streaming, as Snapshot does.
+//   - Files are read-only and implement io.ReaderAt and io.Seeker on
+//     top of fs.File.
+package garlandfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/phroun/garland"
+)
+
+// FS is a read-only file system holding one file: a Garland's content.
+type FS struct {
+	g    *garland.Garland
+	name string
+}
+
+// New returns a file system over g's current revision.
+func New(g *garland.Garland) *FS {
+	name := "buffer"
+	if path := g.SourcePath(); path != "" {
+		name = filepath.Base(path)
+	}
+	return &FS{g: g, name: name}
+}
+
+// Name returns the name of the file holding the content.
+func (fsys *FS) Name() string { return fsys.name }
+
+// Open opens the content file or the root directory ".".
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	switch name {
+	case ".":
+		return &dir{fsys: fsys}, nil
+	case fsys.name:
+		view, err := fsys.g.Snapshot()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &File{name: name, view: view}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// File is an open content file, pinned to the revision current when it
+// was opened.
+type File struct {
+	name   string
+	view   *garland.SnapshotView
+	offset int64
+	closed bool
+}
+
+// Stat returns the file's info.
+func (f *File) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return fileInfo{name: f.name, size: f.view.ByteCount()}, nil
+}
+
+// Read reads from the current offset and advances it.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.readAt(p, f.offset, "read")
+	f.offset += int64(n)
+	return n, err
+}
+
+// ReadAt reads len(p) bytes at off without moving the offset.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	n, err := f.readAt(p, off, "readat")
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *File) readAt(p []byte, off int64, op string) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if off >= f.view.ByteCount() {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	data, err := f.view.ReadBytes(off, int64(len(p)))
+	if err != nil {
+		return 0, &fs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	return copy(p, data), nil
+}
+
+// Seek sets the offset for the next Read, as io.Seeker.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.view.ByteCount()
+	case io.SeekStart:
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close releases the file's snapshot.
+func (f *File) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	f.view.Release()
+	return nil
+}
+
+// dir is the open root directory.
+type dir struct {
+	fsys *FS
+	read bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return fileInfo{name: ".", dir: true}, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDir lists the content file once, as fs.ReadDirFile.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.read {
+		if n > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	d.read = true
+	info := fileInfo{name: d.fsys.name, size: d.fsys.g.ByteCount().Value}
+	return []fs.DirEntry{fs.FileInfoToDirEntry(info)}, nil
+}
+
+// fileInfo describes the content file or the root directory.
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
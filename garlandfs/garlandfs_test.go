@@ -0,0 +1,83 @@
+package garlandfs
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/phroun/garland"
+)
+
+func openGarland(t *testing.T, content string) *garland.Garland {
+	t.Helper()
+	lib, err := garland.Init(garland.LibraryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := lib.Open(garland.FileOptions{DataString: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestFS(t *testing.T) {
+	g := openGarland(t, "package main\n\nfunc main() {}\n")
+	fsys := New(g)
+	if fsys.Name() != "buffer" {
+		t.Fatalf("Name() = %q, want %q", fsys.Name(), "buffer")
+	}
+	if err := fstest.TestFS(fsys, "buffer"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(fsys, "buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "package main\n\nfunc main() {}\n" {
+		t.Fatalf("ReadFile = %q", data)
+	}
+	if _, err := fsys.Open("other"); err == nil {
+		t.Fatal("Open of a missing name should fail")
+	}
+}
+
+// TestFileSnapshot: an open file keeps reading the revision it was
+// opened at; ReadAt and Seek work on it.
+func TestFileSnapshot(t *testing.T) {
+	g := openGarland(t, "Hello World")
+	fsys := New(g)
+	f, err := fsys.Open("buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	c := g.NewCursor()
+	if _, err := c.InsertString(">> ", nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	file := f.(*File)
+	buf := make([]byte, 5)
+	if n, err := file.ReadAt(buf, 6); err != nil || string(buf[:n]) != "World" {
+		t.Fatalf("ReadAt = %q, %v; want %q", buf[:n], err, "World")
+	}
+	if n, err := file.ReadAt(buf, 8); err != io.EOF || string(buf[:n]) != "rld" {
+		t.Fatalf("ReadAt short = %q, %v; want %q, EOF", buf[:n], err, "rld")
+	}
+	if pos, err := file.Seek(-5, io.SeekEnd); err != nil || pos != 6 {
+		t.Fatalf("Seek = %d, %v; want 6", pos, err)
+	}
+	rest, err := io.ReadAll(file)
+	if err != nil || string(rest) != "World" {
+		t.Fatalf("read after Seek = %q, %v", rest, err)
+	}
+
+	data, err := fs.ReadFile(fsys, "buffer")
+	if err != nil || string(data) != ">> Hello World" {
+		t.Fatalf("fresh open = %q, %v; want the edited text", data, err)
+	}
+}
@@ -0,0 +1,206 @@
+// Package garlandlsp converts between Garland byte offsets and Language
+// Server Protocol positions, and applies LSP content changes.
+//
+// DESIGN: every language-server integration needs the same glue. LSP
+// addresses text as (line, character), where character counts code
+// units of the negotiated position encoding - UTF-16 unless client and
+// server agreed otherwise - while a Garland addresses bytes. A
+// Converter binds a Garland to an encoding and translates Position and
+// Range values both ways; ApplyChanges plays a didChange notification's
+// content changes as one revision.
+//
+//   - Lines are the Garland's lines. A character past the end of its
+//     line means the line's end (before "\n" or "\r\n"), and a line past
+//     the last means the end of the document, as the protocol asks.
+//   - A character inside a rune (the second half of a surrogate pair in
+//     UTF-16) rounds down to the rune's start: a conversion never
+//     splits a rune.
+//   - Content changes apply in order, each against the text the
+//     previous one left (the protocol's rule), inside one transaction:
+//     the notification is one undo step, and a change that fails rolls
+//     back those before it. A change without a range replaces the whole
+//     document.
+package garlandlsp
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/phroun/garland"
+)
+
+// Encoding is an LSP position encoding (PositionEncodingKind).
+type Encoding string
+
+const (
+	UTF8  Encoding = "utf-8"
+	UTF16 Encoding = "utf-16" // the protocol default
+	UTF32 Encoding = "utf-32"
+)
+
+// Position is an LSP position: 0-based line and character offset in
+// the encoding's code units.
+type Position struct {
+	Line      uint32 `json:"line"`
+	Character uint32 `json:"character"`
+}
+
+// Range is an LSP range, End exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// TextDocumentContentChangeEvent is one change of a didChange
+// notification. A nil Range replaces the whole document.
+type TextDocumentContentChangeEvent struct {
+	Range       *Range  `json:"range,omitempty"`
+	RangeLength *uint32 `json:"rangeLength,omitempty"` // deprecated by LSP; ignored
+	Text        string  `json:"text"`
+}
+
+// Converter translates positions for one Garland in one encoding.
+type Converter struct {
+	g   *garland.Garland
+	enc Encoding
+}
+
+// New returns a Converter for g. An empty encoding means UTF-16.
+func New(g *garland.Garland, enc Encoding) *Converter {
+	if enc == "" {
+		enc = UTF16
+	}
+	return &Converter{g: g, enc: enc}
+}
+
+// Encoding returns the converter's position encoding.
+func (c *Converter) Encoding() Encoding { return c.enc }
+
+// units returns how many code units r takes in the encoding.
+func (c *Converter) units(r rune, size int) int {
+	switch c.enc {
+	case UTF8:
+		return size
+	case UTF32:
+		return 1
+	}
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// lineText returns the start of line and its text without the line
+// terminator; ok is false past the last line.
+func (c *Converter) lineText(line int64) (start int64, text string, ok bool, err error) {
+	lines, err := c.g.ReadLineRange(line, line)
+	if err == garland.ErrInvalidPosition {
+		return 0, "", false, nil
+	}
+	if err != nil || len(lines) == 0 {
+		return 0, "", false, err
+	}
+	if start, err = c.g.LineRuneToByte(line, 0); err != nil {
+		return 0, "", false, err
+	}
+	text = strings.TrimSuffix(strings.TrimSuffix(lines[0], "\n"), "\r")
+	return start, text, true, nil
+}
+
+// Position returns the LSP position of byte offset.
+func (c *Converter) Position(offset int64) (Position, error) {
+	line, _, err := c.g.ByteToLineRune(offset)
+	if err != nil {
+		return Position{}, err
+	}
+	start, text, _, err := c.lineText(line)
+	if err != nil {
+		return Position{}, err
+	}
+	prefix := text[:min(int(offset-start), len(text))]
+	n := 0
+	for i := 0; i < len(prefix); {
+		r, size := utf8.DecodeRuneInString(prefix[i:])
+		n += c.units(r, size)
+		i += size
+	}
+	return Position{Line: uint32(line), Character: uint32(n)}, nil
+}
+
+// Offset returns the byte offset of an LSP position, clamped as the
+// protocol asks (see the package comment).
+func (c *Converter) Offset(pos Position) (int64, error) {
+	start, text, ok, err := c.lineText(int64(pos.Line))
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return c.g.ByteCount().Value, nil
+	}
+	n, i := 0, 0
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if n+c.units(r, size) > int(pos.Character) {
+			break
+		}
+		n += c.units(r, size)
+		i += size
+	}
+	return start + int64(i), nil
+}
+
+// Range returns the LSP range of bytes [start, end).
+func (c *Converter) Range(start, end int64) (Range, error) {
+	s, err := c.Position(start)
+	if err != nil {
+		return Range{}, err
+	}
+	e, err := c.Position(end)
+	if err != nil {
+		return Range{}, err
+	}
+	return Range{Start: s, End: e}, nil
+}
+
+// Offsets returns the byte range of an LSP range.
+func (c *Converter) Offsets(r Range) (start, end int64, err error) {
+	if start, err = c.Offset(r.Start); err != nil {
+		return 0, 0, err
+	}
+	if end, err = c.Offset(r.End); err != nil {
+		return 0, 0, err
+	}
+	return start, max(start, end), nil
+}
+
+// ApplyChanges applies a didChange notification's content changes, in
+// order, as one revision named name.
+func (c *Converter) ApplyChanges(name string, changes []TextDocumentContentChangeEvent) (garland.ChangeResult, error) {
+	g := c.g
+	if err := g.TransactionStart(name); err != nil {
+		return garland.ChangeResult{}, err
+	}
+	cur := g.NewEphemeralCursor()
+	defer g.RemoveCursor(cur)
+
+	fail := func(err error) (garland.ChangeResult, error) {
+		g.TransactionRollback()
+		return garland.ChangeResult{}, err
+	}
+	for _, ch := range changes {
+		start, end := int64(0), g.ByteCount().Value
+		if ch.Range != nil {
+			var err error
+			if start, end, err = c.Offsets(*ch.Range); err != nil {
+				return fail(err)
+			}
+		}
+		if err := cur.SeekByte(start); err != nil {
+			return fail(err)
+		}
+		if _, _, err := cur.OverwriteBytes(end-start, []byte(ch.Text)); err != nil {
+			return fail(err)
+		}
+	}
+	return g.TransactionCommit()
+}
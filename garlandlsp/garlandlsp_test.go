@@ -0,0 +1,129 @@
+package garlandlsp
+
+import (
+	"testing"
+
+	"github.com/phroun/garland"
+)
+
+func openGarland(t *testing.T, content string) *garland.Garland {
+	t.Helper()
+	lib, err := garland.Init(garland.LibraryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := lib.Open(garland.FileOptions{DataString: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestConvertPositions(t *testing.T) {
+	// "😀" is 4 bytes, 2 UTF-16 units, 1 rune; "é" is 2 bytes, 1 unit.
+	g := openGarland(t, "a😀é=1\r\nxyz\n")
+	byteOff := int64(len("a😀é")) // before "="
+
+	for _, tc := range []struct {
+		enc  Encoding
+		char uint32
+	}{{UTF8, 7}, {UTF16, 4}, {UTF32, 3}} {
+		c := New(g, tc.enc)
+		pos, err := c.Position(byteOff)
+		if err != nil || pos != (Position{0, tc.char}) {
+			t.Errorf("%s: Position = %+v, %v; want 0:%d", tc.enc, pos, err, tc.char)
+		}
+		if off, err := c.Offset(pos); err != nil || off != byteOff {
+			t.Errorf("%s: Offset = %d, %v; want %d", tc.enc, off, err, byteOff)
+		}
+	}
+
+	c := New(g, "")
+	if c.Encoding() != UTF16 {
+		t.Fatalf("default encoding = %q", c.Encoding())
+	}
+	// Inside the surrogate pair rounds down to the emoji's start.
+	if off, _ := c.Offset(Position{0, 2}); off != 1 {
+		t.Errorf("mid-surrogate Offset = %d, want 1", off)
+	}
+	// Past the line's end: before "\r\n". Past the last line: the end.
+	if off, _ := c.Offset(Position{0, 99}); off != int64(len("a😀é=1")) {
+		t.Errorf("past line end Offset = %d", off)
+	}
+	if off, _ := c.Offset(Position{9, 0}); off != g.ByteCount().Value {
+		t.Errorf("past last line Offset = %d", off)
+	}
+	r, err := c.Range(int64(len("a😀é=1\r\n")), int64(len("a😀é=1\r\nxy")))
+	if err != nil || r != (Range{Position{1, 0}, Position{1, 2}}) {
+		t.Errorf("Range = %+v, %v", r, err)
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	g := openGarland(t, "hello 😀 world\nbye\n")
+	c := New(g, UTF16)
+
+	res, err := c.ApplyChanges("didChange", []TextDocumentContentChangeEvent{
+		{Range: &Range{Position{0, 9}, Position{0, 14}}, Text: "there"},
+		{Range: &Range{Position{1, 0}, Position{1, 0}}, Text: "good"},
+		{Range: &Range{Position{0, 0}, Position{0, 5}}, Text: "hi"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Revision != 1 {
+		t.Errorf("revision = %d, want one revision for the notification", res.Revision)
+	}
+	lines, _ := g.ReadLineRange(0, 1)
+	if lines[0] != "hi 😀 there\n" || lines[1] != "goodbye\n" {
+		t.Fatalf("after changes: %q", lines)
+	}
+
+	if _, err := c.ApplyChanges("full", []TextDocumentContentChangeEvent{{Text: "new"}}); err != nil {
+		t.Fatal(err)
+	}
+	if lines, _ := g.ReadLineRange(0, 0); len(lines) != 1 || lines[0] != "new" {
+		t.Fatalf("after full replace: %q", lines)
+	}
+}
+
+func TestMapper(t *testing.T) {
+	g := openGarland(t, "package p\n\nvar s = \"😀x\"\n")
+	m := NewMapper("file:///p.go", g, UTF16)
+	x := len("package p\n\nvar s = \"😀") // the "x"
+
+	pos, err := m.OffsetPosition(x)
+	if err != nil || pos != (Position{2, 11}) {
+		t.Errorf("OffsetPosition = %+v, %v", pos, err)
+	}
+	if off, err := m.PositionOffset(pos); err != nil || off != x {
+		t.Errorf("PositionOffset = %d, %v", off, err)
+	}
+	loc, err := m.OffsetLocation(x, x+1)
+	if err != nil || loc != (Location{"file:///p.go", Range{Position{2, 11}, Position{2, 12}}}) {
+		t.Errorf("OffsetLocation = %+v, %v", loc, err)
+	}
+	if s, e, err := m.RangeOffsets(loc.Range); err != nil || s != x || e != x+1 {
+		t.Errorf("RangeOffsets = %d, %d, %v", s, e, err)
+	}
+	if line, col, err := m.LineCol8(x); err != nil || line != 3 || col != 14 {
+		t.Errorf("LineCol8 = %d:%d, %v", line, col, err)
+	}
+	if _, err := m.OffsetPosition(m.Len() + 1); err != garland.ErrInvalidPosition {
+		t.Errorf("OffsetPosition past the end: %v", err)
+	}
+
+	// No cached content: the mapper follows edits.
+	if _, err := m.Converter().ApplyChanges("edit", []TextDocumentContentChangeEvent{
+		{Range: &Range{Position{0, 8}, Position{0, 9}}, Text: "main"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := m.Slice(0, 12); err != nil || string(b) != "package main" {
+		t.Errorf("Slice = %q, %v", b, err)
+	}
+	if b, _ := m.Content(); len(b) != m.Len() {
+		t.Errorf("Content is %d bytes, Len %d", len(b), m.Len())
+	}
+}
@@ -0,0 +1,149 @@
+package garlandlsp
+
+import (
+	"io"
+
+	"github.com/phroun/garland"
+)
+
+// mapper.go - a drop-in for gopls-style column mappers.
+//
+// DESIGN: Go editor tooling written against gopls' protocol.Mapper (and
+// the tools modelled on it) holds the whole file as a []byte and asks
+// the mapper for OffsetPosition, PositionOffset, OffsetRange and so on,
+// with int offsets. Mapper gives the same method set over a Garland, so
+// such code switches its backing store by changing the constructor and
+// dropping its copy of the content: the conversions are the
+// Converter's, done against the live tree.
+//
+//   - Offsets are ints, as in the API being replaced; the conversions
+//     and their clamping rules are Converter's (see the package
+//     comment). An offset outside [0, Len] is an error
+//     (garland.ErrInvalidPosition), as it is for gopls.
+//   - Content, Len and Slice stand in for the []byte field: Content
+//     copies the whole document and is meant for the callers that
+//     really need it (a parser); Slice reads just a range. The Mapper
+//     is also an io.ReaderAt.
+//   - Nothing is cached: every call reads the current revision, so a
+//     Mapper stays right across edits, where a gopls Mapper has to be
+//     rebuilt.
+
+// Location is an LSP location: a range in a document.
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// Mapper converts between int byte offsets and LSP positions for one
+// document, in the shape of gopls' protocol.Mapper.
+type Mapper struct {
+	URI string // the document's URI, used in Locations
+	c   *Converter
+}
+
+// NewMapper returns a Mapper for g. An empty encoding means UTF-16.
+func NewMapper(uri string, g *garland.Garland, enc Encoding) *Mapper {
+	return &Mapper{URI: uri, c: New(g, enc)}
+}
+
+// Converter returns the Converter the Mapper is built on.
+func (m *Mapper) Converter() *Converter { return m.c }
+
+// Len returns the document's length in bytes.
+func (m *Mapper) Len() int { return int(m.c.g.ByteCount().Value) }
+
+// Content returns a copy of the whole document.
+func (m *Mapper) Content() ([]byte, error) {
+	return m.Slice(0, m.Len())
+}
+
+// Slice returns a copy of bytes [start, end).
+func (m *Mapper) Slice(start, end int) ([]byte, error) {
+	if err := m.check(start); err != nil {
+		return nil, err
+	}
+	if err := m.check(end); err != nil || end < start {
+		return nil, garland.ErrInvalidPosition
+	}
+	buf := make([]byte, end-start)
+	n, err := m.c.g.ReadAt(buf, int64(start))
+	if err == io.EOF && n == len(buf) {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+// ReadAt reads len(p) bytes at off, as io.ReaderAt.
+func (m *Mapper) ReadAt(p []byte, off int64) (int, error) {
+	return m.c.g.ReadAt(p, off)
+}
+
+// check returns ErrInvalidPosition for an offset outside [0, Len].
+func (m *Mapper) check(offset int) error {
+	if offset < 0 || offset > m.Len() {
+		return garland.ErrInvalidPosition
+	}
+	return nil
+}
+
+// OffsetPosition returns the position of a byte offset.
+func (m *Mapper) OffsetPosition(offset int) (Position, error) {
+	if err := m.check(offset); err != nil {
+		return Position{}, err
+	}
+	return m.c.Position(int64(offset))
+}
+
+// OffsetRange returns the range of bytes [start, end).
+func (m *Mapper) OffsetRange(start, end int) (Range, error) {
+	if err := m.check(start); err != nil {
+		return Range{}, err
+	}
+	if err := m.check(end); err != nil || end < start {
+		return Range{}, garland.ErrInvalidPosition
+	}
+	return m.c.Range(int64(start), int64(end))
+}
+
+// OffsetLocation returns the location of bytes [start, end).
+func (m *Mapper) OffsetLocation(start, end int) (Location, error) {
+	r, err := m.OffsetRange(start, end)
+	if err != nil {
+		return Location{}, err
+	}
+	return Location{URI: m.URI, Range: r}, nil
+}
+
+// PositionOffset returns the byte offset of a position.
+func (m *Mapper) PositionOffset(p Position) (int, error) {
+	off, err := m.c.Offset(p)
+	return int(off), err
+}
+
+// RangeOffsets returns the byte offsets of a range.
+func (m *Mapper) RangeOffsets(r Range) (start, end int, err error) {
+	s, e, err := m.c.Offsets(r)
+	return int(s), int(e), err
+}
+
+// RangeLocation returns the location of a range in this document.
+func (m *Mapper) RangeLocation(r Range) Location {
+	return Location{URI: m.URI, Range: r}
+}
+
+// LineCol8 returns the 1-based line and 1-based UTF-8 column of a byte
+// offset, the form compilers and go/token report.
+func (m *Mapper) LineCol8(offset int) (line, col int, err error) {
+	if err := m.check(offset); err != nil {
+		return 0, 0, err
+	}
+	l, _, err := m.c.g.ByteToLineRune(int64(offset))
+	if err != nil {
+		return 0, 0, err
+	}
+	start, err := m.c.g.LineRuneToByte(l, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(l) + 1, offset - int(start) + 1, nil
+}
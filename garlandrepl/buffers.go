@@ -0,0 +1,133 @@
+package garlandrepl
+
+import (
+	"strconv"
+
+	"github.com/phroun/garland"
+)
+
+// buffer is one open document. The shown buffer's Garland and cursor
+// are r.garland and r.currentCursor; the others keep their cursor here.
+type buffer struct {
+	g      *garland.Garland
+	name   string        // the file path, or "(new)"
+	cursor string        // the buffer's current cursor while another is shown
+	stop   chan struct{} // closed with the buffer to end its stream feed
+}
+
+// close closes the buffer's Garland and ends its stream feed, if any.
+func (b *buffer) close() {
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+	b.g.Close()
+}
+
+// showBuffer makes buffer i the one commands act on, remembering the
+// shown buffer's cursor.
+func (r *REPL) showBuffer(i int) {
+	if r.garland != nil {
+		r.buffers[r.current].cursor = r.currentCursor
+	}
+	r.current = i
+	b := r.buffers[i]
+	r.garland, r.currentCursor = b.g, b.cursor
+}
+
+// addBuffer opens g as a new buffer, with a fresh "default" cursor,
+// and shows it.
+func (r *REPL) addBuffer(g *garland.Garland, name string) {
+	c := g.NewCursor()
+	c.SetName("default")
+	r.buffers = append(r.buffers, &buffer{g: g, name: name, cursor: "default"})
+	r.showBuffer(len(r.buffers) - 1)
+}
+
+// replaceBuffer closes the shown buffer's Garland and puts g in its
+// place, or adds g when nothing is open.
+func (r *REPL) replaceBuffer(g *garland.Garland, name string) {
+	if r.garland == nil {
+		r.addBuffer(g, name)
+		return
+	}
+	b := r.buffers[r.current]
+	b.close()
+	b.g, b.name = g, name
+	c := g.NewCursor()
+	c.SetName("default")
+	r.garland, r.currentCursor = g, "default"
+}
+
+// closeBuffer closes the shown buffer and shows the one before it (the
+// next, for the first), if any.
+func (r *REPL) closeBuffer() {
+	r.buffers[r.current].close()
+	r.buffers = append(r.buffers[:r.current], r.buffers[r.current+1:]...)
+	r.garland, r.currentCursor = nil, ""
+	if len(r.buffers) == 0 {
+		r.current = 0
+		return
+	}
+	r.showBuffer(max(r.current-1, 0))
+}
+
+// closeAll closes every buffer.
+func (r *REPL) closeAll() {
+	for _, b := range r.buffers {
+		b.close()
+	}
+	r.buffers, r.current = nil, 0
+	r.garland, r.currentCursor = nil, ""
+}
+
+// cmdBuffers lists the open buffers, numbered from 1.
+func (r *REPL) cmdBuffers() {
+	if len(r.buffers) == 0 {
+		r.println("No buffers open")
+		return
+	}
+	var list []map[string]any
+	for i, b := range r.buffers {
+		marker := "  "
+		if i == r.current {
+			marker = "> "
+		}
+		r.printf("%s%d: %s (%d bytes, fork=%d, rev=%d)\n", marker, i+1, b.name,
+			b.g.ByteCount().Value, b.g.CurrentFork(), b.g.CurrentRevision())
+		list = append(list, map[string]any{
+			"buffer": i + 1, "name": b.name, "bytes": b.g.ByteCount().Value, "current": i == r.current,
+		})
+	}
+	r.set("buffers", list)
+}
+
+// cmdBuffer switches to buffer n (1-based), or shows which is current.
+func (r *REPL) cmdBuffer(args []string) {
+	if len(args) == 0 {
+		if len(r.buffers) == 0 {
+			r.errorln("No buffers open")
+			return
+		}
+		r.printf("Buffer %d: %s\n", r.current+1, r.buffers[r.current].name)
+		r.set("buffer", r.current+1)
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(r.buffers) {
+		r.errorf("Error: no buffer %s (%d open)\n", args[0], len(r.buffers))
+		return
+	}
+	r.showBuffer(n - 1)
+	r.printf("Switched to buffer %d: %s\n", n, r.buffers[n-1].name)
+	r.set("buffer", n)
+}
+
+// bufferNumbers returns the open buffers' numbers, for completion.
+func (r *REPL) bufferNumbers() []string {
+	var ns []string
+	for i := range r.buffers {
+		ns = append(ns, strconv.Itoa(i+1))
+	}
+	return ns
+}
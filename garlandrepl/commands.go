@@ -0,0 +1,160 @@
+package garlandrepl
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/phroun/garland"
+)
+
+// ErrCommandExists is returned by Register for a name already taken by
+// a registered command.
+var ErrCommandExists = errors.New("command already registered")
+
+// Command is a command added to the shell (see the package comment).
+type Command struct {
+	Name  string // what the user types (case-insensitive, no blanks)
+	Usage string // the usage line for help, e.g. "stats [n]"
+	Help  string // one-line description for help
+
+	// Run performs the command. A returned error is reported as
+	// "Error: ..." and fails the command.
+	Run func(r *REPL, args []string) error
+
+	// Complete, if set, offers the words the argument after args may
+	// be, for tab completion; the shell keeps those the typed prefix
+	// matches.
+	Complete func(r *REPL, args []string) []string
+}
+
+// Register adds a command to the shell.
+func (r *REPL) Register(c Command) error {
+	name := strings.ToLower(c.Name)
+	if name == "" || strings.ContainsAny(name, " \t") || c.Run == nil {
+		return errors.New("command needs a single-word name and a Run function")
+	}
+	if _, ok := r.commands[name]; ok {
+		return ErrCommandExists
+	}
+	r.commands[name] = c
+	return nil
+}
+
+// runRegistered runs c on the command line input.
+func (r *REPL) runRegistered(c Command, input string) {
+	rest := strings.TrimLeft(input, " \t")
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		rest = rest[i:]
+	} else {
+		rest = ""
+	}
+	args, err := splitArgs(rest)
+	if err != nil {
+		r.errorf("Error: %v\n", err)
+		if c.Usage != "" {
+			r.errorf("Usage: %s\n", c.Usage)
+		}
+		return
+	}
+	if err := c.Run(r, args); err != nil {
+		r.errorf("Error: %v\n", err)
+	}
+}
+
+// printRegisteredHelp lists the registered commands after the built-in
+// help.
+func (r *REPL) printRegisteredHelp() {
+	if len(r.commands) == 0 {
+		return
+	}
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.println("REGISTERED COMMANDS:")
+	for _, name := range names {
+		c := r.commands[name]
+		usage := c.Usage
+		if usage == "" {
+			usage = name
+		}
+		r.printf("  %-25s %s\n", usage, c.Help)
+	}
+	r.println()
+}
+
+// splitArgs splits a command line on blanks, keeping quoted arguments
+// whole (see the package comment).
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '"' || ch == '\'':
+			quote := ch
+			inArg = true
+			for i++; ; i++ {
+				if i >= len(s) {
+					return nil, errors.New("unterminated quote")
+				}
+				if s[i] == quote {
+					break
+				}
+				if quote == '"' && s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+					i++
+				}
+				cur.WriteByte(s[i])
+			}
+		case ch == ' ' || ch == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			inArg = true
+			cur.WriteByte(ch)
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// Library returns the shell's Library.
+func (r *REPL) Library() *garland.Library { return r.lib }
+
+// Garland returns the current buffer's Garland, or nil.
+func (r *REPL) Garland() *garland.Garland { return r.garland }
+
+// Cursor returns the current cursor, or nil.
+func (r *REPL) Cursor() *garland.Cursor { return r.cursor() }
+
+// Adopt makes g the current buffer's Garland, closing the previous
+// one, with a fresh "default" cursor - what new does.
+func (r *REPL) Adopt(g *garland.Garland) {
+	r.replaceBuffer(g, "(adopted)")
+}
+
+// AddBuffer opens g in a new buffer, with a fresh "default" cursor,
+// and switches to it - what open does.
+func (r *REPL) AddBuffer(g *garland.Garland, name string) {
+	r.addBuffer(g, name)
+}
+
+// Printf writes command output.
+func (r *REPL) Printf(format string, a ...any) { r.printf(format, a...) }
+
+// Println writes command output.
+func (r *REPL) Println(a ...any) { r.println(a...) }
+
+// Errorf writes output and marks the command as failed.
+func (r *REPL) Errorf(format string, a ...any) { r.errorf(format, a...) }
+
+// Set records a structured result for --json mode (a no-op otherwise).
+func (r *REPL) Set(key string, value any) { r.set(key, value) }
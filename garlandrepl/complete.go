@@ -0,0 +1,197 @@
+package garlandrepl
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// builtinCommands are the names handleCommand accepts.
+var builtinCommands = []string{
+	"help", "quit", "exit", "source", "macro", "alias", "unalias", "set",
+	"new", "open", "close", "buffers", "buffer", "status", "save", "saveas", "rebase",
+	"cursor", "seek", "relseek", "word", "linestart", "lineend",
+	"read", "readline",
+	"insert", "insert-", "overwrite", "move", "move-", "copy", "copy-",
+	"truncate", "delete", "delete+", "backdelete",
+	"mark", "select", "yank", "put", "put-",
+	"dump", "tree", "trace",
+	"tx", "transaction", "undoseek", "revisions", "log", "diff", "fork", "prune",
+	"divergences", "version",
+	"decorate", "undecorate", "decorations", "decoration",
+	"dumpdecorations", "loaddecorations",
+	"chill", "thaw", "thawrange", "convert",
+	"find", "findall", "findnext", "findregex", "findregexall", "findnextregex",
+	"match", "replace", "replaceall", "replacecount",
+	"replaceregex", "replaceregexall", "replaceregexcount",
+	"count", "countregex",
+	"ready", "isready", "stream", "watch",
+	"memory", "memchill", "rebalance", "snapshots",
+	"checkpoint", "region", "cursormode",
+}
+
+// completers offer the arguments of the built-in commands: given the
+// arguments before the one being typed, the words it may be.
+var completers = map[string]func(r *REPL, args []string) []string{
+	"seek":        firstOf("byte", "rune", "line"),
+	"relseek":     firstOf("bytes", "runes"),
+	"read":        firstOf("bytes", "string"),
+	"delete":      firstOf("bytes", "runes"),
+	"delete+":     firstOf("bytes", "runes"),
+	"backdelete":  firstOf("bytes", "runes"),
+	"tx":          firstOf("start", "commit", "rollback"),
+	"transaction": firstOf("start", "commit", "rollback"),
+	"chill":       firstOf("inactive", "history", "unused", "all"),
+	"convert":     firstOf("byte", "rune", "line"),
+	"isready":     firstOf("byte", "rune", "line"),
+	"region":      firstOf("begin"),
+	"cursormode":  firstOf("human", "process"),
+	"buffer":      upTo(1, (*REPL).bufferNumbers),
+	"unalias":     upTo(1, (*REPL).aliasNames),
+	"set":         firstOf(settingNames...),
+	"macro": func(r *REPL, args []string) []string {
+		switch {
+		case len(args) == 0:
+			return []string{"record", "stop", "play", "list"}
+		case len(args) == 1 && args[0] == "play":
+			return r.macroNames()
+		}
+		return nil
+	},
+	"cursor": func(r *REPL, args []string) []string {
+		switch {
+		case len(args) == 0:
+			return append([]string{"list", "delete"}, r.cursorNames()...)
+		case len(args) == 1 && args[0] == "delete":
+			return r.cursorNames()
+		}
+		return nil
+	},
+	"fork": func(r *REPL, args []string) []string {
+		switch {
+		case len(args) == 0:
+			return append([]string{"list", "delete"}, r.forkIDs()...)
+		case len(args) == 1 && args[0] == "delete":
+			return r.forkIDs()
+		}
+		return nil
+	},
+	"undoseek":    upTo(1, (*REPL).revisionIDs),
+	"prune":       upTo(1, (*REPL).revisionIDs),
+	"thaw":        upTo(2, (*REPL).revisionIDs),
+	"divergences": upTo(2, (*REPL).revisionIDs),
+	"diff":        upTo(2, (*REPL).revisionIDs),
+	"log":         firstOf("-p"),
+	"mark":        firstOf("clear"),
+	"trace":       firstOf("on", "off"),
+	"yank":        firstOf("-x"),
+	"decorate":    upTo(1, (*REPL).decorationKeys),
+	"undecorate":  upTo(1, (*REPL).decorationKeys),
+	"decoration":  upTo(1, (*REPL).decorationKeys),
+}
+
+// firstOf completes a command's first argument from words.
+func firstOf(words ...string) func(*REPL, []string) []string {
+	return upTo(1, func(*REPL) []string { return words })
+}
+
+// upTo completes a command's first n arguments from list.
+func upTo(n int, list func(*REPL) []string) func(*REPL, []string) []string {
+	return func(r *REPL, args []string) []string {
+		if len(args) >= n {
+			return nil
+		}
+		return list(r)
+	}
+}
+
+// cursorNames returns the named cursors of the open Garland.
+func (r *REPL) cursorNames() []string {
+	if r.garland == nil {
+		return nil
+	}
+	var names []string
+	for _, info := range r.namedCursors() {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+// forkIDs returns the open Garland's live forks.
+func (r *REPL) forkIDs() []string {
+	if r.garland == nil {
+		return nil
+	}
+	forks := r.garland.ListForks()
+	sort.Slice(forks, func(i, j int) bool { return forks[i].ID < forks[j].ID })
+	var ids []string
+	for _, info := range forks {
+		if !info.Deleted {
+			ids = append(ids, strconv.FormatUint(uint64(info.ID), 10))
+		}
+	}
+	return ids
+}
+
+// revisionIDs returns the unpruned revisions of the current fork.
+func (r *REPL) revisionIDs() []string {
+	if r.garland == nil {
+		return nil
+	}
+	info, err := r.garland.GetForkInfo(r.garland.CurrentFork())
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for rev := info.PrunedUpTo; rev <= info.HighestRevision; rev++ {
+		ids = append(ids, strconv.FormatUint(uint64(rev), 10))
+	}
+	return ids
+}
+
+// decorationKeys returns the keys decorating the open Garland.
+func (r *REPL) decorationKeys() []string {
+	if r.garland == nil {
+		return nil
+	}
+	keys, _ := r.garland.ListDecorationKeys("")
+	return keys
+}
+
+// complete returns the words that can replace the one ending line (the
+// text before the cursor), and where that word starts. The first word
+// is a command name; later words are offered by the command's
+// completer, or its Command.Complete for a registered one.
+func (r *REPL) complete(line string) (start int, words []string) {
+	start = strings.LastIndexAny(line, " \t") + 1
+	prefix := line[start:]
+	fields := strings.Fields(line[:start])
+
+	var all []string
+	if len(fields) == 0 {
+		all = append(all, builtinCommands...)
+		for name := range r.commands {
+			all = append(all, name)
+		}
+		all = append(all, r.aliasNames()...)
+		sort.Strings(all)
+	} else {
+		name := strings.ToLower(fields[0])
+		if c, ok := r.commands[name]; ok {
+			if c.Complete != nil {
+				all = c.Complete(r, fields[1:])
+			}
+		} else if f := completers[name]; f != nil {
+			all = f(r, fields[1:])
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, w := range all {
+		if strings.HasPrefix(w, prefix) && !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return start, words
+}
@@ -0,0 +1,294 @@
+package garlandrepl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/phroun/garland"
+)
+
+// Config is what a garlandrc file sets up for a session, so testers
+// don't retype it every time. In the file, one entry per line:
+//
+//	set <name> <value>      an open default or library option (settingNames)
+//	alias <name> <command>  <name> runs <command>, followed by its arguments
+//	<anything else>         a command run at startup, in file order
+//
+// Blank lines and lines starting with # are skipped. Sizes take a K,
+// M or G suffix (powers of 1024).
+type Config struct {
+	// Library is for garland.Init: memory limits and cold storage are
+	// fixed when the library is created, so the REPL only shows them.
+	Library garland.LibraryOptions
+
+	// Open holds the defaults new, open and stream apply.
+	Open garland.FileOptions
+
+	Aliases map[string]string // command line an alias runs, by lower-case name
+	Startup []string          // commands Run and RunScript run first
+}
+
+// settingNames are the names set accepts, in the order set lists
+// them. The library ones only take effect from a garlandrc file.
+var settingNames = []string{
+	"maxleafsize", "readybytes", "readylines",
+	"softlimit", "hardlimit", "chillbudget", "coldstorage",
+}
+
+// librarySettings are the settings that configure garland.Init.
+var librarySettings = map[string]bool{
+	"softlimit": true, "hardlimit": true, "chillbudget": true, "coldstorage": true,
+}
+
+// LoadConfig reads the garlandrc file at path. A missing file is an
+// empty Config, not an error.
+func LoadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	return ParseConfig(f, path)
+}
+
+// ParseConfig parses a garlandrc file read from in; name (the file's,
+// for messages) and the line number prefix any error.
+func ParseConfig(in io.Reader, name string) (Config, error) {
+	var c Config
+	sc := bufio.NewScanner(in)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		var err error
+		switch strings.ToLower(word) {
+		case "set":
+			key, value, _ := strings.Cut(rest, " ")
+			err = c.set(strings.ToLower(key), strings.TrimSpace(value))
+		case "alias":
+			err = c.alias(rest)
+		default:
+			c.Startup = append(c.Startup, line)
+		}
+		if err != nil {
+			return Config{}, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+	}
+	return c, sc.Err()
+}
+
+// set sets one option.
+func (c *Config) set(key, value string) error {
+	if value == "" {
+		return fmt.Errorf("set %s: missing value", key)
+	}
+	if key == "coldstorage" {
+		c.Library.ColdStoragePath = value
+		return nil
+	}
+	n, err := parseSize(value)
+	if err != nil {
+		return fmt.Errorf("set %s: invalid value %q", key, value)
+	}
+	switch key {
+	case "maxleafsize":
+		c.Open.MaxLeafSize = n
+	case "readybytes":
+		c.Open.ReadyBytes = n
+	case "readylines":
+		c.Open.ReadyLines = n
+	case "softlimit":
+		c.Library.MemorySoftLimit = n
+	case "hardlimit":
+		c.Library.MemoryHardLimit = n
+	case "chillbudget":
+		c.Library.ChillBudgetPerTick = int(n)
+	default:
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	return nil
+}
+
+// setting returns an option's value as set shows it.
+func (c *Config) setting(key string) string {
+	var n int64
+	switch key {
+	case "coldstorage":
+		return c.Library.ColdStoragePath
+	case "maxleafsize":
+		n = c.Open.MaxLeafSize
+	case "readybytes":
+		n = c.Open.ReadyBytes
+	case "readylines":
+		n = c.Open.ReadyLines
+	case "softlimit":
+		n = c.Library.MemorySoftLimit
+	case "hardlimit":
+		n = c.Library.MemoryHardLimit
+	case "chillbudget":
+		n = int64(c.Library.ChillBudgetPerTick)
+	}
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// alias defines an alias from "<name> <command line>".
+func (c *Config) alias(spec string) error {
+	name, line, _ := strings.Cut(spec, " ")
+	line = strings.TrimSpace(line)
+	if name == "" || line == "" {
+		return fmt.Errorf("usage: alias <name> <command>")
+	}
+	if c.Aliases == nil {
+		c.Aliases = make(map[string]string)
+	}
+	c.Aliases[strings.ToLower(name)] = line
+	return nil
+}
+
+// parseSize parses a non-negative count with an optional K, M or G
+// suffix.
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return n * mult, nil
+}
+
+// expandAlias replaces an alias at the start of input with the command
+// line it stands for. Expansion happens once, so an alias may wrap the
+// command it is named after.
+func (r *REPL) expandAlias(input string) string {
+	input = strings.TrimSpace(input)
+	word, rest, _ := strings.Cut(input, " ")
+	line, ok := r.config.Aliases[strings.ToLower(word)]
+	if !ok {
+		return input
+	}
+	if rest == "" {
+		return line
+	}
+	return line + " " + rest
+}
+
+// runStartup runs the configured startup commands, returning false if
+// one quit the session. In JSON mode they run quietly, so a client
+// gets one response per command it sent.
+func (r *REPL) runStartup() bool {
+	if r.jsonOut {
+		r.jsonOut, r.out = false, io.Discard
+		defer func() { r.jsonOut, r.out = true, r.stdout }()
+	}
+	for _, line := range r.config.Startup {
+		if !r.runCommand(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// cmdAlias lists the aliases, or defines one: alias <name> <command>.
+func (r *REPL) cmdAlias(args []string) {
+	if len(args) == 0 {
+		names := r.aliasNames()
+		if len(names) == 0 {
+			r.println("No aliases defined")
+		}
+		for _, name := range names {
+			r.printf("  %s = %s\n", name, r.config.Aliases[name])
+		}
+		r.set("aliases", r.config.Aliases)
+		return
+	}
+	if err := r.config.alias(strings.Join(args, " ")); err != nil {
+		r.errorln("Usage: alias <name> <command> | alias")
+		return
+	}
+	r.printf("Alias '%s' defined\n", strings.ToLower(args[0]))
+}
+
+// cmdUnalias removes an alias.
+func (r *REPL) cmdUnalias(args []string) {
+	if len(args) != 1 {
+		r.errorln("Usage: unalias <name>")
+		return
+	}
+	name := strings.ToLower(args[0])
+	if _, ok := r.config.Aliases[name]; !ok {
+		r.errorf("Error: no alias '%s'\n", name)
+		return
+	}
+	delete(r.config.Aliases, name)
+	r.printf("Alias '%s' removed\n", name)
+}
+
+// cmdSet lists the settings, or changes an open default: set <name>
+// <value>. Library settings can only be shown.
+func (r *REPL) cmdSet(args []string) {
+	if len(args) == 0 {
+		values := make(map[string]string)
+		for _, key := range settingNames {
+			v := r.config.setting(key)
+			values[key] = v
+			if v == "" {
+				v = "(default)"
+			}
+			r.printf("  %-12s %s\n", key, v)
+		}
+		r.set("settings", values)
+		return
+	}
+	if len(args) != 2 {
+		r.errorln("Usage: set <name> <value> | set")
+		return
+	}
+	key := strings.ToLower(args[0])
+	if librarySettings[key] {
+		r.errorf("Error: %s applies when the library starts; set it in ~/.garlandrc\n", key)
+		return
+	}
+	if err := r.config.set(key, args[1]); err != nil {
+		r.errorf("Error: %v\n", err)
+		return
+	}
+	r.printf("%s = %s\n", key, r.config.setting(key))
+}
+
+// aliasNames returns the defined aliases, sorted.
+func (r *REPL) aliasNames() []string {
+	var names []string
+	for name := range r.config.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,3795 @@
+// Package garlandrepl is the interactive Garland shell behind
+// cmd/garland-repl, as a library, so downstream applications can run
+// it with commands of their own.
+//
+// DESIGN: garland-repl is the harness people reach for to poke at a
+// document - seek, insert, undo, dump the tree. An application built
+// on garland wants the same harness plus a few commands for its own
+// layer (its decoration schema, its file format), without forking the
+// shell. New runs the shell over any reader and writer; Register adds
+// a Command, from the embedding program or from a Go plugin the
+// garland-repl binary loads (-plugin).
+//
+//   - A command is a name, a usage line, a one-line help text and a
+//     handler. The handler gets the REPL - the open Garland, the
+//     current cursor, output - and the arguments: the command line
+//     split on blanks, with "double" or 'single' quoted arguments kept
+//     whole (quotes removed, \" and \\ unescaped inside double quotes).
+//   - Output goes through Printf / Println and failures through Errorf
+//     or a returned error, so custom commands answer in --json mode
+//     exactly as built-in ones do; Set adds structured results there.
+//   - Names are case-insensitive and unique among registered commands
+//     (ErrCommandExists). A registered command takes precedence over a
+//     built-in of the same name, so a harness can wrap one (an "open"
+//     that applies its own options). help lists registered commands
+//     after the built-in ones. A command's Complete, if set, offers its
+//     arguments to tab completion.
+//   - RunScript (garland-repl -script) and the source command run a
+//     file of commands, one per line, skipping blanks and # comments,
+//     and stop at the first that fails unless KeepGoing is set, so a
+//     regression scenario can live in a script whose exit code says
+//     whether it still passes.
+//   - Options.Config carries what a garlandrc file (LoadConfig; cmd's
+//     ~/.garlandrc) sets: defaults new, open and stream apply
+//     (MaxLeafSize, ready thresholds), aliases, and commands run before
+//     the first one read. Library settings (memory limits, cold
+//     storage) go to garland.Init, so the shell only shows them.
+//   - With Options.Remote the built-in commands drive a garlandrpc
+//     session (cmd/garland-server, or an application serving its own
+//     documents) over its JSON-RPC protocol instead of lib: the core
+//     ones - documents, cursors, reads, edits, search, decorations,
+//     transactions, undo and forks - map to server methods, and call
+//     sends any method as is. docs lists the documents the server
+//     publishes and attach drives one, so a live garland inside
+//     another program can be inspected; the rest are the ones opened
+//     over the connection.
+package garlandrepl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/phroun/garland"
+)
+
+// REPL holds the state of the interactive session
+type REPL struct {
+	lib           *garland.Library
+	garland       *garland.Garland // the shown buffer's
+	currentCursor string           // name of current cursor
+	buffers       []*buffer        // open documents, in opening order
+	current       int              // index of the shown buffer
+	reader        *bufio.Reader
+	editor        *lineEditor // line editing, when In is a terminal
+	termFd        int         // the terminal the editor reads
+	stdout        io.Writer
+	commands      map[string]Command  // registered commands, by lower-case name
+	keepGoing     bool                // scripts run past failed commands
+	sourceDepth   int                 // source files and macros being run
+	macros        map[string][]string // recorded command lines, by name
+	recording     string              // macro being recorded, or ""
+	recorded      []string            // its command lines so far
+	register      register            // what yank took and put inserts
+	remote        *remoteConn         // the garland-server session, if any
+	config        Config              // open defaults, aliases and startup commands
+	tracing       bool                // report each command's tree work
+
+	// Output. Commands write through printf/println/print and report
+	// failures through errorf/errorln. In JSON mode (--json or
+	// --porcelain) out is a per-command buffer and each command ends
+	// with one JSON object on stdout instead (see runCommand).
+	out     io.Writer
+	jsonOut bool
+	errMsg  string         // first error the current command reported
+	data    map[string]any // structured results of the current command
+}
+
+func (r *REPL) printf(format string, a ...any) { fmt.Fprintf(r.out, format, a...) }
+func (r *REPL) println(a ...any)               { fmt.Fprintln(r.out, a...) }
+func (r *REPL) print(a ...any)                 { fmt.Fprint(r.out, a...) }
+
+// errorf prints like printf and marks the command as failed.
+func (r *REPL) errorf(format string, a ...any) { r.fail(fmt.Sprintf(format, a...)) }
+
+// errorln prints like println and marks the command as failed.
+func (r *REPL) errorln(a ...any) { r.fail(fmt.Sprintln(a...)) }
+
+func (r *REPL) fail(msg string) {
+	io.WriteString(r.out, msg)
+	if r.errMsg == "" {
+		r.errMsg = strings.TrimSpace(msg)
+	}
+}
+
+// set records a structured result for JSON mode; a no-op otherwise.
+func (r *REPL) set(key string, value any) {
+	if r.data != nil {
+		r.data[key] = value
+	}
+}
+
+// response is the JSON-mode reply to one command.
+type response struct {
+	Status string         `json:"status"` // "ok" or "error"
+	Data   map[string]any `json:"data"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// runCommand runs one command line. In JSON mode it captures the
+// output and writes the command's response object.
+func (r *REPL) runCommand(input string) bool {
+	if !r.jsonOut {
+		r.errMsg = ""
+		cont := r.tracedCommand(input)
+		r.record(input)
+		return cont
+	}
+	var buf bytes.Buffer
+	r.out, r.errMsg, r.data = &buf, "", map[string]any{}
+	cont := r.tracedCommand(input)
+	r.record(input)
+
+	resp := response{Status: "ok", Data: r.data, Error: r.errMsg}
+	if r.errMsg != "" {
+		resp.Status = "error"
+	}
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if buf.Len() == 0 {
+		lines = []string{}
+	}
+	resp.Data["output"] = lines
+	if state := r.state(); state != nil {
+		resp.Data["state"] = state
+	}
+	r.out, r.data = r.stdout, nil
+	json.NewEncoder(r.stdout).Encode(resp)
+	return cont
+}
+
+// state summarizes the open garland and current cursor for JSON mode
+// (nil when nothing is open).
+func (r *REPL) state() map[string]any {
+	g := r.garland
+	if g == nil {
+		return nil
+	}
+	state := map[string]any{
+		"bytes":         g.ByteCount().Value,
+		"runes":         g.RuneCount().Value,
+		"lines":         g.LineCount().Value,
+		"complete":      g.IsComplete(),
+		"fork":          g.CurrentFork(),
+		"revision":      g.CurrentRevision(),
+		"inTransaction": g.InTransaction(),
+		"buffer":        r.current + 1,
+	}
+	if c := r.cursor(); c != nil {
+		pos := c.Position()
+		state["cursor"] = map[string]any{
+			"name": r.currentCursor, "byte": pos.BytePos, "rune": pos.RunePos,
+			"line": pos.Line, "lineRune": pos.LineRune,
+		}
+	}
+	return state
+}
+
+// cursor returns the currently selected cursor
+func (r *REPL) cursor() *garland.Cursor {
+	if r.garland == nil {
+		return nil
+	}
+	c, _ := r.garland.FindCursor(r.currentCursor)
+	return c
+}
+
+// namedCursors returns the cursors the session created (the named ones).
+func (r *REPL) namedCursors() []garland.CursorInfo {
+	var named []garland.CursorInfo
+	for _, info := range r.garland.ListCursors() {
+		if info.Name != "" {
+			named = append(named, info)
+		}
+	}
+	return named
+}
+
+// newNamedCursor creates a cursor labeled name.
+func (r *REPL) newNamedCursor(name string) *garland.Cursor {
+	c := r.garland.NewCursor()
+	c.SetName(name)
+	return c
+}
+
+// stripQuotes removes surrounding quotes from a string if present
+func stripQuotes(s string) string {
+	if len(s) >= 2 {
+		if (s[0] == '"' && s[len(s)-1] == '"') || (s[0] == '\'' && s[len(s)-1] == '\'') {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
+
+// Options configures a REPL.
+type Options struct {
+	In   io.Reader // commands, one per line (required)
+	Out  io.Writer // output (required)
+	JSON bool      // answer each command with one JSON object (--json)
+
+	// HistoryFile keeps the commands typed at a terminal across
+	// sessions ("" keeps them for this session only). It is not used
+	// when In is not a terminal, or in JSON mode.
+	HistoryFile string
+
+	// KeepGoing makes RunScript and source run the commands after one
+	// that fails (--keep-going); the first failure is still reported.
+	KeepGoing bool
+
+	// Remote, if set, is a connection to a garlandrpc server
+	// (garland-server, or an application's own): the built-in
+	// commands drive a session there instead of lib (garland-repl
+	// --connect).
+	Remote io.ReadWriter
+
+	// Config holds open defaults, aliases and startup commands, as
+	// read from a garlandrc file (LoadConfig).
+	Config Config
+}
+
+// New returns a shell over lib reading from opts.In. When opts.In is a
+// terminal, Run reads it with line editing, history (arrows, Ctrl-R)
+// and tab completion.
+func New(lib *garland.Library, opts Options) *REPL {
+	r := &REPL{
+		lib:       lib,
+		reader:    bufio.NewReader(opts.In),
+		stdout:    opts.Out,
+		out:       opts.Out,
+		jsonOut:   opts.JSON,
+		keepGoing: opts.KeepGoing,
+		commands:  make(map[string]Command),
+		macros:    make(map[string][]string),
+		config:    opts.Config,
+	}
+	r.config.Aliases = make(map[string]string)
+	for name, line := range opts.Config.Aliases {
+		r.config.Aliases[name] = line
+	}
+	if opts.Remote != nil {
+		r.remote = &remoteConn{in: bufio.NewReader(opts.Remote), out: opts.Remote, cursor: remoteCursor}
+	}
+	if f, ok := opts.In.(*os.File); ok && !opts.JSON {
+		if restore, err := makeRaw(int(f.Fd())); err == nil {
+			restore()
+			r.editor = newLineEditor(f, opts.Out, opts.HistoryFile)
+			r.editor.complete = r.complete
+			r.termFd = int(f.Fd())
+		}
+	}
+	return r
+}
+
+// Run runs the configured startup commands, then reads and runs
+// commands until quit or the end of input, and closes every buffer.
+func (r *REPL) Run() {
+	if !r.jsonOut {
+		r.println("Garland REPL - Interactive Text Editor Demo")
+		r.println("Type 'help' for available commands, 'quit' to exit")
+		r.println()
+	}
+
+	if !r.runStartup() {
+		r.closeAll()
+		return
+	}
+	for {
+		input, err := r.readInput()
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			if !r.jsonOut {
+				r.println("\nGoodbye!")
+			}
+			break
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+
+		if !r.runCommand(input) {
+			break
+		}
+	}
+
+	r.closeAll()
+}
+
+// prompt is shown before each interactive command.
+const prompt = "\x1b[1;97mgarland>\x1b[0m "
+
+// readInput reads the next command line, through the line editor when
+// there is one.
+func (r *REPL) readInput() (string, error) {
+	if r.editor != nil {
+		if restore, err := makeRaw(r.termFd); err == nil {
+			defer restore()
+			return r.editor.readLine(prompt)
+		}
+	}
+	if !r.jsonOut {
+		r.print(prompt)
+	}
+	return r.reader.ReadString('\n')
+}
+
+func (r *REPL) handleCommand(input string) bool {
+	input = r.expandAlias(input)
+	parts := strings.Fields(input)
+	if len(parts) == 0 {
+		return true
+	}
+
+	cmd := strings.ToLower(parts[0])
+	args := parts[1:]
+
+	if c, ok := r.commands[cmd]; ok {
+		r.runRegistered(c, input)
+		return true
+	}
+	if r.remote != nil {
+		return r.handleRemote(cmd, args)
+	}
+
+	switch cmd {
+	case "help":
+		r.printHelp()
+
+	case "quit", "exit":
+		r.println("Goodbye!")
+		return false
+
+	case "source":
+		return r.cmdSource(args)
+
+	case "alias":
+		r.cmdAlias(args)
+
+	case "unalias":
+		r.cmdUnalias(args)
+
+	case "set":
+		r.cmdSet(args)
+
+	case "trace":
+		r.cmdTrace(args)
+
+	case "new":
+		r.cmdNew(args)
+
+	case "open":
+		r.cmdOpen(args)
+
+	case "close":
+		r.cmdClose()
+
+	case "buffers":
+		r.cmdBuffers()
+
+	case "macro":
+		return r.cmdMacro(args)
+
+	case "buffer":
+		r.cmdBuffer(args)
+
+	case "status":
+		r.cmdStatus()
+
+	case "cursor":
+		r.cmdCursor(args)
+
+	case "seek":
+		r.cmdSeek(args)
+
+	case "relseek":
+		r.cmdRelSeek(args)
+
+	case "word":
+		r.cmdWord(args)
+
+	case "linestart":
+		r.cmdLineStart()
+
+	case "lineend":
+		r.cmdLineEnd()
+
+	case "read":
+		r.cmdRead(args)
+
+	case "readline":
+		r.cmdReadLine()
+
+	case "insert":
+		r.cmdInsert(args, false)
+
+	case "insert-":
+		r.cmdInsert(args, true)
+
+	case "overwrite":
+		r.cmdOverwrite(args)
+
+	case "move":
+		r.cmdMove(args, false)
+
+	case "move-":
+		r.cmdMove(args, true)
+
+	case "copy":
+		r.cmdCopy(args, false)
+
+	case "copy-":
+		r.cmdCopy(args, true)
+
+	case "truncate":
+		r.cmdTruncate()
+
+	case "mark":
+		r.cmdMark(args)
+
+	case "select":
+		r.cmdSelect(args)
+
+	case "yank":
+		r.cmdYank(args)
+
+	case "put":
+		r.cmdPut(args, false)
+
+	case "put-":
+		r.cmdPut(args, true)
+
+	case "delete":
+		r.cmdDelete(args, false)
+
+	case "delete+":
+		r.cmdDelete(args, true)
+
+	case "backdelete":
+		r.cmdBackDelete(args)
+
+	case "dump":
+		r.cmdDump()
+
+	case "tree":
+		r.cmdTree()
+
+	case "tx", "transaction":
+		r.cmdTransaction(args)
+
+	case "undoseek":
+		r.cmdUndoSeek(args)
+
+	case "revisions":
+		r.cmdRevisions()
+
+	case "diff":
+		r.cmdDiff(args)
+
+	case "log":
+		r.cmdLog(args)
+
+	case "fork":
+		r.cmdFork(args)
+
+	case "prune":
+		r.cmdPrune(args)
+
+	case "version":
+		r.cmdVersion()
+
+	case "decorate":
+		r.cmdDecorate(args)
+
+	case "undecorate":
+		r.cmdUndecorate(args)
+
+	case "decorations":
+		r.cmdDecorations(args)
+
+	case "decoration":
+		r.cmdGetDecoration(args)
+
+	case "save":
+		r.cmdSave()
+
+	case "saveas":
+		r.cmdSaveAs(args)
+
+	case "rebase":
+		r.cmdRebase(args)
+
+	case "chill":
+		r.cmdChill(args)
+
+	case "thaw":
+		r.cmdThaw(args)
+
+	case "thawrange":
+		r.cmdThawRange(args)
+
+	case "convert":
+		r.cmdConvert(args)
+
+	case "divergences":
+		r.cmdDivergences(args)
+
+	case "dumpdecorations":
+		r.cmdDumpDecorations(args)
+
+	case "loaddecorations":
+		r.cmdLoadDecorations(args)
+
+	// Search commands
+	case "find":
+		r.cmdFind(args)
+
+	case "findall":
+		r.cmdFindAll(args)
+
+	case "findnext":
+		r.cmdFindNext(args)
+
+	case "findregex":
+		r.cmdFindRegex(args)
+
+	case "findregexall":
+		r.cmdFindRegexAll(args)
+
+	case "findnextregex":
+		r.cmdFindNextRegex(args)
+
+	case "match":
+		r.cmdMatch(args)
+
+	case "replace":
+		r.cmdReplace(args)
+
+	case "replaceall":
+		r.cmdReplaceAll(args)
+
+	case "replacecount":
+		r.cmdReplaceCount(args)
+
+	case "replaceregex":
+		r.cmdReplaceRegex(args)
+
+	case "replaceregexall":
+		r.cmdReplaceRegexAll(args)
+
+	case "replaceregexcount":
+		r.cmdReplaceRegexCount(args)
+
+	case "count":
+		r.cmdCount(args)
+
+	case "countregex":
+		r.cmdCountRegex(args)
+
+	case "ready":
+		r.cmdReady()
+
+	case "isready":
+		r.cmdIsReady(args)
+
+	case "stream":
+		r.cmdStream(args)
+
+	case "watch":
+		r.cmdWatch(args)
+
+	// Memory management commands
+	case "memory":
+		r.cmdMemory()
+
+	case "memchill":
+		r.cmdMemChill(args)
+
+	case "rebalance":
+		r.cmdRebalance()
+
+	case "snapshots":
+		r.cmdSnapshots()
+
+	// Optimized region commands
+	case "checkpoint":
+		r.cmdCheckpoint()
+
+	case "region":
+		r.cmdRegion(args)
+
+	case "cursormode":
+		r.cmdCursorMode(args)
+
+	default:
+		r.errorf("Unknown command: %s. Type 'help' for available commands.\n", cmd)
+	}
+
+	return true
+}
+
+func (r *REPL) printHelp() {
+	help := `
+Available Commands:
+-------------------
+
+FILE OPERATIONS:
+  new                       Create a new empty garland
+  new "text"                Create a new garland with the given text content
+                            (new replaces the current buffer's document)
+  open <filepath>           Open a file from disk in a new buffer
+  save                      Save to original file path
+  saveas <filepath>         Save to a new file path
+  close                     Close the current garland (and its buffer)
+  buffers                   List open buffers
+  buffer <n>                Switch to buffer n
+  status                    Show current garland status
+
+CURSOR OPERATIONS:
+  cursor                    Show current cursor position
+  cursor <name>             Switch to (or create) a named cursor
+  cursor list               List all cursors and their positions
+  cursor delete <name>      Delete a cursor
+  seek byte <pos>           Move cursor to byte position
+  seek rune <pos>           Move cursor to rune position
+  seek line <line> <rune>   Move cursor to line:rune position
+  relseek bytes <delta>     Move cursor relative (+ forward, - backward)
+  relseek runes <delta>     Move cursor relative by runes
+  word <n>                  Move by n words (negative = backward)
+  linestart                 Move to start of current line
+  lineend                   Move to end of current line
+
+READ OPERATIONS:
+  read bytes <length>       Read bytes from cursor position (advances cursor)
+  read string <length>      Read runes from cursor position (advances cursor)
+  readline                  Read the entire line at cursor position
+
+EDIT OPERATIONS:
+  insert "text"             Insert text at cursor position (advances cursor)
+  insert "text", key=5      Insert with decoration at byte offset 5 in content
+  insert- "text"            Insert BEFORE existing content at position
+  overwrite <len> "text"    Replace <len> bytes at cursor with <text>
+  move <src1> <src2> <dst1> [dst2]    Move bytes [src1,src2) to [dst1,dst2)
+  move- <src1> <src2> <dst1> [dst2]   Move with decorations consolidated to end
+  copy <src1> <src2> <dst1> [dst2]    Copy bytes [src1,src2) to [dst1,dst2)
+  copy- <src1> <src2> <dst1> [dst2]   Copy with decorations consolidated to end
+  truncate                  Delete from cursor to end of file
+  delete bytes <length>     Delete bytes forward from cursor position
+  delete runes <length>     Delete runes forward from cursor position
+  delete+ bytes <length>    Delete bytes including line-anchored decorations
+  delete+ runes <length>    Delete runes including line-anchored decorations
+  backdelete bytes <len>    Delete bytes backward (like backspace)
+  backdelete runes <len>    Delete runes backward (like backspace)
+
+String arguments use quotes to allow spaces: insert "hello world"
+Escape sequences: \n (newline), \t (tab), \" (quote), \\ (backslash)
+Move/Copy: All addresses are original document positions. If dst2 omitted, dst2=dst1.
+
+SELECTION AND REGISTER:
+  mark                      Set the selection anchor at the cursor
+  mark clear                Clear the selection anchor
+  select <start> <end>      Select bytes [start, end) (anchor at start, cursor at end)
+  select                    Show the current selection
+  yank                      Copy the selection into the register
+  yank -x                   Cut the selection, with its decorations, into the register
+  put                       Insert the register at the cursor (advances cursor)
+  put-                      Insert the register BEFORE existing content at position
+
+The register is shared by all buffers. Decorations cut with yank -x are
+re-anchored by the next put only, so yank -x then put is a move.
+
+INSPECTION:
+  dump                      Dump all content
+  tree                      Show tree structure
+  trace on|off              After each command, show the tree work it did: nodes
+                            visited and created, snapshots copied, chills,
+                            thaws, rotations and rebuilds
+
+VERSION CONTROL:
+  tx start <name>           Start a transaction with optional name
+  tx commit                 Commit the current transaction
+  tx rollback               Rollback the current transaction
+  undoseek <revision>       Seek to a specific revision in current fork
+  revisions                 List revisions in current fork
+  log [-p] [count]          Newest revisions with what each changed (-p: with diffs)
+  diff <revA> [revB]        Show changes between revisions (revB: current)
+                            (diff and log take -U <n> for context lines, default 3)
+  fork                      Show current fork info
+  fork list                 List all forks
+  fork <id>                 Switch to a different fork
+  fork delete <id>          Delete a fork (soft-delete, keeps data for child forks)
+  prune <revision>          Prune history before revision (current fork)
+  divergences               List fork divergence points for entire history
+  divergences <from> <to>   List fork divergences in revision range
+  version                   Show current fork and revision
+
+NOTE: Forks are created automatically when you edit from a non-HEAD revision.
+      Use 'fork <id>' to navigate between existing forks.
+
+DECORATIONS:
+  decorate <key>            Add decoration at cursor position
+  decorate k=byte <pos>     Add decoration at byte position
+  decorate k=rune <pos>     Add decoration at rune position
+  decorate k=line <l>:<r>   Add decoration at line:rune position
+  decorate k=nil            Remove decoration (same as undecorate)
+  decorate a=byte 5, b=line 1:0   Multiple decorations at once
+  undecorate <key>          Remove a decoration
+  decorations               List all decorations in the file
+  decorations <line>        List decorations on a specific line
+  decoration <key>          Get the position of a specific decoration
+  dumpdecorations <path>    Export all decorations to INI file
+  loaddecorations <path>    Load decorations from INI file
+
+STORAGE TIERS:
+  chill inactive            Chill data from inactive forks
+  chill history             Chill old undo history (keep last 10 revisions)
+  chill unused              Chill data not used at current revision
+  chill all                 Chill all data to cold storage
+  thaw                      Thaw all data for current fork (caution: large files)
+  thaw <start> <end>        Thaw specific revision range (caution: large files)
+  thawrange <start> <end>   Thaw specific byte range (RAM-safe for large files)
+
+POSITION CONVERSION:
+  convert byte <pos>        Convert byte position to rune/line
+  convert rune <pos>        Convert rune position to byte/line
+  convert line <l> <r>      Convert line:rune position to byte/rune
+
+SEARCH & REPLACE:
+  find "needle" [flags]     Find first occurrence from cursor
+  findall "needle" [flags]  Find all occurrences
+  findnext "needle" [flags] Find next and move cursor to it
+  findregex "pattern" [flags]    Find first regex match
+  findregexall "pattern" [flags] Find all regex matches
+  findnextregex "pattern" [flags] Find next regex match, move cursor
+  match "pattern" [flags]   Check if regex matches at cursor position
+  replace "needle" "repl" [flags]    Replace first occurrence
+  replaceall "needle" "repl" [flags] Replace all occurrences
+  replacecount "needle" "repl" <n> [flags] Replace up to n occurrences
+  replaceregex "pattern" "repl" [flags]    Replace first regex match
+  replaceregexall "pattern" "repl" [flags] Replace all regex matches
+  replaceregexcount "pattern" "repl" <n> [flags] Replace up to n regex matches
+  count "needle" [flags]    Count occurrences
+  countregex "pattern" [flags] Count regex matches
+
+Search flags: -i (case insensitive), -w (whole word), -b (backward)
+Regex flags: -i (case insensitive), -b (backward)
+Regex replacement supports $1, $2, etc. for capture groups.
+
+STREAMING/LAZY LOADING:
+  ready                     Show loading status (complete, bytes/runes/lines loaded)
+  isready byte <pos>        Check if byte position is ready (non-blocking)
+  isready rune <pos>        Check if rune position is ready (non-blocking)
+  isready line <line>       Check if line is ready (non-blocking)
+  stream <file> [chunk] [ms]  Open a file as a streaming source in a new buffer,
+                            fed chunk bytes (4096) every ms milliseconds (10)
+  watch [interval-ms]       Refresh a loading status line (default every 250ms)
+                            until loading completes or Ctrl-C
+
+Note: During streaming input (via DataChannel), these commands let you check
+if a position is available before seeking. Seek operations block by default
+until data arrives. Use isready to guard against blocking.
+
+MEMORY MANAGEMENT:
+  memory                    Show current memory usage statistics
+  memchill [count]          Incrementally chill LRU nodes (default: 5 nodes)
+  rebalance                 Force tree rebalancing (use sparingly)
+  snapshots                 Show snapshot statistics by fork/revision
+
+Note: Memory management is automatic when soft/hard limits are configured in
+LibraryOptions. These commands allow manual intervention for debugging.
+
+OPTIMIZED REGIONS:
+  checkpoint                Commit all active cursor regions to tree
+  region                    Show current cursor's region info
+  region begin <s> <e>      Create region from byte s to e for current cursor
+  cursormode                Show current cursor mode
+  cursormode human          Auto-create regions on edit (default)
+  cursormode process        Use explicit transactions, no auto-regions
+
+Note: Optimized regions batch rapid edits in memory before committing to the
+rope tree. Human cursors auto-manage regions; process cursors require explicit
+transactions. Region serial numbers help track lifecycle for debugging.
+
+OTHER:
+  help                      Show this help message
+  source <file>             Run the commands in a file, stopping at the first error
+  macro record <name>       Record the commands that follow (those that succeed)
+  macro stop                Stop recording
+  macro play <name> [n]     Run a macro n times (default 1), stopping at the first error
+  macro list                List recorded macros
+  alias <name> <command>    Make <name> run <command> (alias alone lists them)
+  unalias <name>            Remove an alias
+  set                       Show open defaults and library settings
+  set <name> <value>        Change an open default (maxleafsize, readybytes,
+                            readylines; sizes take K, M or G)
+  quit, exit                Exit the REPL
+`
+	r.println(help)
+	r.printRegisteredHelp()
+}
+
+func (r *REPL) cmdNew(args []string) {
+	// Parse content - either quoted string or empty for new empty garland
+	var content string
+	if len(args) > 0 {
+		input := strings.Join(args, " ")
+		parsed, _, err := r.parseQuotedString(input)
+		if err != nil {
+			r.errorf("Error: %v\n", err)
+			r.errorln("Usage: new \"text content\" or new (for empty)")
+			return
+		}
+		content = parsed
+	}
+
+	opts := r.config.Open
+	opts.DataString = content
+	g, err := r.lib.Open(opts)
+	if err != nil {
+		r.errorf("Error creating garland: %v\n", err)
+		return
+	}
+
+	r.replaceBuffer(g, "(new)")
+	r.printf("Created new garland with %d bytes\n", g.ByteCount().Value)
+}
+
+func (r *REPL) cmdOpen(args []string) {
+	if len(args) < 1 {
+		r.errorln("Usage: open <filepath>")
+		return
+	}
+
+	path := strings.Join(args, " ")
+
+	opts := r.config.Open
+	opts.FilePath = path
+	g, err := r.lib.Open(opts)
+	if err != nil {
+		r.errorf("Error opening file: %v\n", err)
+		return
+	}
+
+	r.addBuffer(g, path)
+	r.printf("Opened %s (%d bytes) as buffer %d\n", path, g.ByteCount().Value, len(r.buffers))
+}
+
+func (r *REPL) cmdClose() {
+	if r.garland == nil {
+		r.errorln("No garland is open")
+		return
+	}
+
+	r.closeBuffer()
+	r.println("Garland closed")
+	if r.garland != nil {
+		r.printf("Switched to buffer %d: %s\n", r.current+1, r.buffers[r.current].name)
+	}
+}
+
+func (r *REPL) cmdStatus() {
+	if r.garland == nil {
+		r.errorln("No garland is open. Use 'new <text>' to create one.")
+		return
+	}
+
+	g := r.garland
+	byteCount := g.ByteCount()
+	runeCount := g.RuneCount()
+	lineCount := g.LineCount()
+
+	r.println("Garland Status:")
+	r.printf("  Bytes: %d (complete: %v)\n", byteCount.Value, byteCount.Complete)
+	r.printf("  Runes: %d (complete: %v)\n", runeCount.Value, runeCount.Complete)
+	r.printf("  Lines: %d (complete: %v)\n", lineCount.Value, lineCount.Complete)
+	r.printf("  Fork: %d, Revision: %d\n", g.CurrentFork(), g.CurrentRevision())
+	r.printf("  In Transaction: %v (depth: %d)\n", g.InTransaction(), g.TransactionDepth())
+
+	if cursor := r.cursor(); cursor != nil {
+		line, lineRune := cursor.LinePos()
+		r.printf("  Cursor '%s': byte=%d, rune=%d, line=%d:%d\n",
+			r.currentCursor, cursor.BytePos(), cursor.RunePos(), line, lineRune)
+		r.printf("  Total cursors: %d\n", len(r.namedCursors()))
+	}
+}
+
+func (r *REPL) cmdCursor(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	// Handle subcommands: cursor, cursor <name>, cursor list, cursor delete <name>
+	if len(args) >= 1 {
+		subcmd := strings.ToLower(args[0])
+
+		if subcmd == "list" {
+			r.println("Cursors:")
+			for _, info := range r.namedCursors() {
+				name, c := info.Name, info.Cursor
+				marker := "  "
+				if name == r.currentCursor {
+					marker = "> "
+				}
+				line, lineRune := c.LinePos()
+				regionInfo := "region=none"
+				if c.HasOptimizedRegion() {
+					regionInfo = fmt.Sprintf("region=#%d", c.OptimizedRegionSerial())
+				}
+				modeStr := "human"
+				if c.Mode() == garland.CursorModeProcess {
+					modeStr = "process"
+				}
+				r.printf("%s%s: byte=%d, rune=%d, line=%d:%d, mode=%s, %s\n",
+					marker, name, c.BytePos(), c.RunePos(), line, lineRune, modeStr, regionInfo)
+			}
+			return
+		}
+
+		if subcmd == "delete" {
+			if len(args) < 2 {
+				r.errorln("Usage: cursor delete <name>")
+				return
+			}
+			name := args[1]
+			if name == "default" {
+				r.errorln("Cannot delete the default cursor")
+				return
+			}
+			c, err := r.garland.FindCursor(name)
+			if err != nil {
+				r.errorf("Cursor '%s' not found\n", name)
+				return
+			}
+			r.garland.RemoveCursor(c)
+			if r.currentCursor == name {
+				r.currentCursor = "default"
+			}
+			r.printf("Deleted cursor '%s'\n", name)
+			return
+		}
+
+		// Switch to or create a cursor by name
+		name := args[0]
+		if _, err := r.garland.FindCursor(name); err != nil {
+			// Create new cursor
+			r.newNamedCursor(name)
+			r.printf("Created new cursor '%s'\n", name)
+		}
+		r.currentCursor = name
+		r.printf("Switched to cursor '%s'\n", name)
+	}
+
+	// Show current cursor info
+	cursor := r.cursor()
+	line, lineRune := cursor.LinePos()
+	r.printf("Cursor '%s' Position:\n", r.currentCursor)
+	r.printf("  Byte:     %d\n", cursor.BytePos())
+	r.printf("  Rune:     %d\n", cursor.RunePos())
+	r.printf("  Line:     %d\n", line)
+	r.printf("  LineRune: %d\n", lineRune)
+	r.printf("  Ready:    %v\n", cursor.IsReady())
+	modeStr := "human"
+	if cursor.Mode() == garland.CursorModeProcess {
+		modeStr = "process"
+	}
+	r.printf("  Mode:     %s\n", modeStr)
+	if cursor.HasOptimizedRegion() {
+		serial := cursor.OptimizedRegionSerial()
+		start, end, _ := cursor.OptimizedRegionBounds()
+		graceStart, graceEnd, _ := cursor.OptimizedRegionGraceWindow()
+		r.printf("  Region:   serial=%d, bytes=[%d,%d), grace=[%d,%d)\n",
+			serial, start, end, graceStart, graceEnd)
+	} else {
+		r.printf("  Region:   none\n")
+	}
+}
+
+func (r *REPL) cmdSeek(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: seek byte|rune|line <pos> [<rune>]")
+		return
+	}
+
+	cursor := r.cursor()
+	mode := strings.ToLower(args[0])
+	pos, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid position: %v\n", err)
+		return
+	}
+
+	switch mode {
+	case "byte":
+		err = cursor.SeekByte(pos)
+	case "rune":
+		err = cursor.SeekRune(pos)
+	case "line":
+		runeInLine := int64(0)
+		if len(args) >= 3 {
+			runeInLine, err = strconv.ParseInt(args[2], 10, 64)
+			if err != nil {
+				r.errorf("Invalid rune position: %v\n", err)
+				return
+			}
+		}
+		err = cursor.SeekLine(pos, runeInLine)
+	default:
+		r.errorln("Unknown seek mode. Use: byte, rune, or line")
+		return
+	}
+
+	if err != nil {
+		r.errorf("Seek error: %v\n", err)
+		return
+	}
+
+	line, lineRune := cursor.LinePos()
+	r.printf("Cursor moved to byte=%d, rune=%d, line=%d:%d\n",
+		cursor.BytePos(), cursor.RunePos(), line, lineRune)
+}
+
+func (r *REPL) cmdRelSeek(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: relseek bytes|runes <delta>")
+		r.println("  delta can be positive (forward) or negative (backward)")
+		return
+	}
+
+	cursor := r.cursor()
+	mode := strings.ToLower(args[0])
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid delta: %v\n", err)
+		return
+	}
+
+	switch mode {
+	case "bytes":
+		err = cursor.SeekRelativeBytes(delta)
+	case "runes":
+		err = cursor.SeekRelativeRunes(delta)
+	default:
+		r.errorln("Unknown relseek mode. Use: bytes or runes")
+		return
+	}
+
+	if err != nil {
+		r.errorf("RelSeek error: %v\n", err)
+		return
+	}
+
+	line, lineRune := cursor.LinePos()
+	r.printf("Cursor moved to byte=%d, rune=%d, line=%d:%d\n",
+		cursor.BytePos(), cursor.RunePos(), line, lineRune)
+}
+
+func (r *REPL) cmdWord(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: word <count>")
+		r.println("  count can be positive (forward) or negative (backward)")
+		return
+	}
+
+	cursor := r.cursor()
+	count, err := strconv.Atoi(args[0])
+	if err != nil {
+		r.errorf("Invalid count: %v\n", err)
+		return
+	}
+
+	moved, err := cursor.SeekByWord(count)
+	if err != nil {
+		r.errorf("Word seek error: %v\n", err)
+		return
+	}
+
+	line, lineRune := cursor.LinePos()
+	r.printf("Moved %d word(s), cursor at byte=%d, rune=%d, line=%d:%d\n",
+		moved, cursor.BytePos(), cursor.RunePos(), line, lineRune)
+}
+
+func (r *REPL) cmdLineStart() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	cursor := r.cursor()
+	err := cursor.SeekLineStart()
+	if err != nil {
+		r.errorf("LineStart error: %v\n", err)
+		return
+	}
+
+	line, lineRune := cursor.LinePos()
+	r.printf("Cursor moved to byte=%d, rune=%d, line=%d:%d\n",
+		cursor.BytePos(), cursor.RunePos(), line, lineRune)
+}
+
+func (r *REPL) cmdLineEnd() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	cursor := r.cursor()
+	err := cursor.SeekLineEnd()
+	if err != nil {
+		r.errorf("LineEnd error: %v\n", err)
+		return
+	}
+
+	line, lineRune := cursor.LinePos()
+	r.printf("Cursor moved to byte=%d, rune=%d, line=%d:%d\n",
+		cursor.BytePos(), cursor.RunePos(), line, lineRune)
+}
+
+func (r *REPL) cmdRead(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: read bytes|string <length>")
+		return
+	}
+
+	cursor := r.cursor()
+	mode := strings.ToLower(args[0])
+	length, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid length: %v\n", err)
+		return
+	}
+
+	switch mode {
+	case "bytes":
+		data, err := cursor.ReadBytes(length)
+		if err != nil {
+			r.errorf("Read error: %v\n", err)
+			return
+		}
+		r.set("text", string(data))
+		r.printf("Read %d bytes: %q\n", len(data), string(data))
+		r.printf("Hex: %x\n", data)
+
+	case "string":
+		data, err := cursor.ReadString(length)
+		if err != nil {
+			r.errorf("Read error: %v\n", err)
+			return
+		}
+		r.set("text", data)
+		r.printf("Read %d runes: %q\n", len([]rune(data)), data)
+
+	default:
+		r.errorln("Unknown read mode. Use: bytes or string")
+	}
+}
+
+func (r *REPL) cmdReadLine() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	cursor := r.cursor()
+	data, err := cursor.ReadLine()
+	if err != nil {
+		r.errorf("Read error: %v\n", err)
+		return
+	}
+	r.set("text", data)
+	r.printf("Line content: %q\n", data)
+}
+
+func (r *REPL) cmdInsert(args []string, insertBefore bool) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	fullInput := strings.Join(args, " ")
+	if fullInput == "" {
+		r.errorln("Usage: insert \"text\"")
+		r.println("       insert \"text\", key=5, key2=10  (with decorations at byte offsets)")
+		r.println("       insert- \"text\"  (insert before existing content)")
+		return
+	}
+
+	// Parse quoted string and optional decorations
+	text, remainder, err := r.parseQuotedString(fullInput)
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	// Parse optional decorations after the string
+	var decorations []garland.RelativeDecoration
+	if remainder != "" {
+		// Remainder should start with a comma (or just have decorations)
+		remainder = strings.TrimSpace(remainder)
+		if strings.HasPrefix(remainder, ",") {
+			remainder = strings.TrimSpace(remainder[1:])
+		}
+		if remainder != "" {
+			decorations, err = r.parseRelativeDecorations(remainder)
+			if err != nil {
+				r.errorf("Decoration parse error: %v\n", err)
+				return
+			}
+		}
+	}
+
+	cursor := r.cursor()
+	result, err := cursor.InsertString(text, decorations, insertBefore)
+	if err != nil {
+		r.errorf("Insert error: %v\n", err)
+		return
+	}
+	beforeStr := ""
+	if insertBefore {
+		beforeStr = " (before)"
+	}
+	decStr := ""
+	if len(decorations) > 0 {
+		decStr = fmt.Sprintf(" with %d decoration(s)", len(decorations))
+	}
+	r.printf("Inserted %d bytes%s%s. Now at fork=%d, revision=%d\n",
+		len(text), beforeStr, decStr, result.Fork, result.Revision)
+}
+
+// parseQuotedString extracts a quoted string and returns the content and remainder
+func (r *REPL) parseQuotedString(input string) (string, string, error) {
+	input = strings.TrimSpace(input)
+	if len(input) == 0 {
+		return "", "", fmt.Errorf("empty input")
+	}
+
+	if input[0] != '"' {
+		return "", "", fmt.Errorf("expected quoted string (starting with \")")
+	}
+
+	// Parse the quoted string, handling escapes
+	var result []byte
+	i := 1
+	for i < len(input) {
+		if input[i] == '\\' && i+1 < len(input) {
+			// Handle escape sequences
+			switch input[i+1] {
+			case 'n':
+				result = append(result, '\n')
+			case 't':
+				result = append(result, '\t')
+			case '"':
+				result = append(result, '"')
+			case '\\':
+				result = append(result, '\\')
+			default:
+				// Unknown escape, keep as-is
+				result = append(result, input[i], input[i+1])
+			}
+			i += 2
+		} else if input[i] == '"' {
+			// End of string
+			remainder := strings.TrimSpace(input[i+1:])
+			return string(result), remainder, nil
+		} else {
+			result = append(result, input[i])
+			i++
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated string (missing closing \")")
+}
+
+// parseRelativeDecorations parses decoration specs relative to inserted content
+// Format: key=5, key2=10  (byte offsets within the inserted content)
+func (r *REPL) parseRelativeDecorations(input string) ([]garland.RelativeDecoration, error) {
+	parts := strings.Split(input, ",")
+	var decorations []garland.RelativeDecoration
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		idx := strings.Index(part, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid decoration spec: %q (expected key=position)", part)
+		}
+
+		key := strings.TrimSpace(part[:idx])
+		posStr := strings.TrimSpace(part[idx+1:])
+
+		pos, err := strconv.ParseInt(posStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid position for %q: %v", key, err)
+		}
+
+		decorations = append(decorations, garland.RelativeDecoration{
+			Key:      key,
+			Position: pos,
+		})
+	}
+
+	return decorations, nil
+}
+
+func (r *REPL) cmdOverwrite(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: overwrite <length> \"text\"")
+		r.println("  Replaces <length> bytes at cursor with <text>")
+		return
+	}
+
+	length, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		r.errorf("Invalid length: %v\n", err)
+		return
+	}
+
+	// Join remaining args and parse quoted string
+	fullInput := strings.Join(args[1:], " ")
+	text, _, err := r.parseQuotedString(fullInput)
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	_, result, err := cursor.OverwriteBytes(length, []byte(text))
+	if err != nil {
+		r.errorf("Overwrite error: %v\n", err)
+		return
+	}
+	r.printf("Overwrote %d bytes with %d bytes. Now at fork=%d, revision=%d\n",
+		length, len(text), result.Fork, result.Revision)
+}
+
+func (r *REPL) cmdMove(args []string, insertBefore bool) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	// Syntax: move srcStart srcEnd dstStart dstEnd
+	// Or: move srcStart srcEnd dstStart (same as dstStart dstStart - insertion point)
+	if len(args) < 3 {
+		r.errorln("Usage: move <srcStart> <srcEnd> <dstStart> [dstEnd]")
+		r.println("       move- <srcStart> <srcEnd> <dstStart> [dstEnd]")
+		r.println("  Moves bytes [srcStart, srcEnd) to replace [dstStart, dstEnd)")
+		r.println("  If dstEnd omitted, dstEnd = dstStart (insertion point)")
+		r.println("  move- consolidates displaced decorations to end instead of start")
+		r.println("  Source and destination ranges cannot overlap")
+		return
+	}
+
+	srcStart, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		r.errorf("Invalid srcStart: %v\n", err)
+		return
+	}
+
+	srcEnd, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid srcEnd: %v\n", err)
+		return
+	}
+
+	dstStart, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		r.errorf("Invalid dstStart: %v\n", err)
+		return
+	}
+
+	dstEnd := dstStart // Default: insertion point
+	if len(args) >= 4 {
+		dstEnd, err = strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			r.errorf("Invalid dstEnd: %v\n", err)
+			return
+		}
+	}
+
+	cursor := r.cursor()
+	result, err := cursor.MoveBytes(srcStart, srcEnd, dstStart, dstEnd, insertBefore)
+	if err != nil {
+		r.errorf("Move error: %v\n", err)
+		return
+	}
+
+	r.printf("Moved %d bytes from [%d,%d) to [%d,%d). Now at fork=%d, revision=%d\n",
+		srcEnd-srcStart, srcStart, srcEnd, dstStart, dstEnd, result.Fork, result.Revision)
+	if len(result.DisplacedDecorations) > 0 {
+		r.printf("Displaced decorations from destination: %d\n", len(result.DisplacedDecorations))
+		for _, d := range result.DisplacedDecorations {
+			r.printf("  %s @ relative position %d\n", d.Key, d.Position)
+		}
+	}
+}
+
+func (r *REPL) cmdCopy(args []string, insertBefore bool) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	// Syntax: copy srcStart srcEnd dstStart [dstEnd] ["decorations", key=pos, ...]
+	if len(args) < 3 {
+		r.errorln("Usage: copy <srcStart> <srcEnd> <dstStart> [dstEnd]")
+		r.println("       copy- <srcStart> <srcEnd> <dstStart> [dstEnd]")
+		r.println("  Copies bytes [srcStart, srcEnd) to replace [dstStart, dstEnd)")
+		r.println("  If dstEnd omitted, dstEnd = dstStart (insertion point)")
+		r.println("  copy- consolidates displaced decorations to end instead of start")
+		r.println("  Source and destination ranges may overlap")
+		return
+	}
+
+	srcStart, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		r.errorf("Invalid srcStart: %v\n", err)
+		return
+	}
+
+	srcEnd, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid srcEnd: %v\n", err)
+		return
+	}
+
+	dstStart, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		r.errorf("Invalid dstStart: %v\n", err)
+		return
+	}
+
+	dstEnd := dstStart // Default: insertion point
+	if len(args) >= 4 {
+		// Try to parse as number; if fails, might be decoration syntax
+		var parseErr error
+		dstEnd, parseErr = strconv.ParseInt(args[3], 10, 64)
+		if parseErr != nil {
+			dstEnd = dstStart // Keep as insertion point
+		}
+	}
+
+	cursor := r.cursor()
+	result, err := cursor.CopyBytes(srcStart, srcEnd, dstStart, dstEnd, nil, insertBefore)
+	if err != nil {
+		r.errorf("Copy error: %v\n", err)
+		return
+	}
+
+	r.printf("Copied %d bytes from [%d,%d) to [%d,%d). Now at fork=%d, revision=%d\n",
+		srcEnd-srcStart, srcStart, srcEnd, dstStart, dstEnd, result.Fork, result.Revision)
+	if len(result.DisplacedDecorations) > 0 {
+		r.printf("Displaced decorations from destination: %d\n", len(result.DisplacedDecorations))
+		for _, d := range result.DisplacedDecorations {
+			r.printf("  %s @ relative position %d\n", d.Key, d.Position)
+		}
+	}
+}
+
+func (r *REPL) cmdTruncate() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	cursor := r.cursor()
+	result, err := cursor.TruncateToEOF()
+	if err != nil {
+		r.errorf("Truncate error: %v\n", err)
+		return
+	}
+	r.printf("Truncated from cursor to EOF. Now at fork=%d, revision=%d\n",
+		result.Fork, result.Revision)
+	r.printf("File is now %d bytes\n", r.garland.ByteCount().Value)
+}
+
+func (r *REPL) cmdDelete(args []string, includeLineDecorations bool) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: delete bytes|runes <length>")
+		r.println("       delete+ bytes|runes <length>  (includes line-anchored decorations)")
+		return
+	}
+
+	cursor := r.cursor()
+	mode := strings.ToLower(args[0])
+	length, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid length: %v\n", err)
+		return
+	}
+
+	flagStr := ""
+	if includeLineDecorations {
+		flagStr = " (including line decorations)"
+	}
+
+	switch mode {
+	case "bytes":
+		_, result, err := cursor.DeleteBytes(length, includeLineDecorations)
+		if err != nil {
+			r.errorf("Delete error: %v\n", err)
+			return
+		}
+		r.printf("Deleted %d bytes%s. Now at fork=%d, revision=%d\n",
+			length, flagStr, result.Fork, result.Revision)
+
+	case "runes":
+		_, result, err := cursor.DeleteRunes(length, includeLineDecorations)
+		if err != nil {
+			r.errorf("Delete error: %v\n", err)
+			return
+		}
+		r.printf("Deleted %d runes%s. Now at fork=%d, revision=%d\n",
+			length, flagStr, result.Fork, result.Revision)
+
+	default:
+		r.errorln("Unknown delete mode. Use: bytes or runes")
+	}
+}
+
+func (r *REPL) cmdBackDelete(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: backdelete bytes|runes <length>")
+		return
+	}
+
+	cursor := r.cursor()
+	mode := strings.ToLower(args[0])
+	length, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid length: %v\n", err)
+		return
+	}
+
+	switch mode {
+	case "bytes":
+		_, result, err := cursor.BackDeleteBytes(length, false)
+		if err != nil {
+			r.errorf("BackDelete error: %v\n", err)
+			return
+		}
+		line, lineRune := cursor.LinePos()
+		r.printf("Back-deleted %d bytes. Cursor now at byte=%d, line=%d:%d. Fork=%d, revision=%d\n",
+			length, cursor.BytePos(), line, lineRune, result.Fork, result.Revision)
+
+	case "runes":
+		_, result, err := cursor.BackDeleteRunes(length, false)
+		if err != nil {
+			r.errorf("BackDelete error: %v\n", err)
+			return
+		}
+		line, lineRune := cursor.LinePos()
+		r.printf("Back-deleted %d runes. Cursor now at byte=%d, line=%d:%d. Fork=%d, revision=%d\n",
+			length, cursor.BytePos(), line, lineRune, result.Fork, result.Revision)
+
+	default:
+		r.errorln("Unknown backdelete mode. Use: bytes or runes")
+	}
+}
+
+func (r *REPL) cmdDump() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	cursor := r.cursor()
+
+	// Save cursor position
+	savedPos := cursor.BytePos()
+
+	// Collect cursor positions BEFORE reading (reading advances cursors)
+	type markerInfo struct {
+		pos      int64
+		name     string
+		isCursor bool // true = cursor, false = decoration
+	}
+	var markers []markerInfo
+
+	for _, info := range r.namedCursors() {
+		markers = append(markers, markerInfo{pos: info.Position.BytePos, name: info.Name, isCursor: true})
+	}
+
+	// Collect decoration positions (use byteCount+1 to include EOF decorations)
+	byteCount := r.garland.ByteCount().Value
+	decorations, _ := r.garland.GetDecorationsInByteRange(0, byteCount+1)
+	for _, dec := range decorations {
+		if dec.Address != nil {
+			markers = append(markers, markerInfo{pos: dec.Address.Byte, name: dec.Key, isCursor: false})
+		}
+	}
+
+	// Sort all markers by position
+	sort.Slice(markers, func(i, j int) bool {
+		if markers[i].pos != markers[j].pos {
+			return markers[i].pos < markers[j].pos
+		}
+		// Cursors before decorations at same position
+		return markers[i].isCursor && !markers[j].isCursor
+	})
+
+	// Read all content
+	cursor.SeekByte(0)
+	data, err := cursor.ReadBytes(byteCount)
+	if err != nil {
+		r.errorf("Read error: %v\n", err)
+		return
+	}
+
+	// Build output with markers inserted at their positions
+	// ANSI: \x1b[1;32m = bold green (cursors), \x1b[2;31m = dark red (decorations), \x1b[0m = reset
+	var output strings.Builder
+	dataStr := string(data)
+	lastPos := int64(0)
+
+	// Group markers at the same position
+	for i := 0; i < len(markers); {
+		pos := markers[i].pos
+
+		// Output text from last position to this marker position
+		if pos > lastPos && lastPos < int64(len(dataStr)) {
+			endPos := pos
+			if endPos > int64(len(dataStr)) {
+				endPos = int64(len(dataStr))
+			}
+			output.WriteString(dataStr[lastPos:endPos])
+		}
+
+		// Collect all cursors and decorations at this position
+		var cursorsHere []string
+		var decorationsHere []string
+		for i < len(markers) && markers[i].pos == pos {
+			if markers[i].isCursor {
+				cursorsHere = append(cursorsHere, markers[i].name)
+			} else {
+				decorationsHere = append(decorationsHere, markers[i].name)
+			}
+			i++
+		}
+
+		// Output cursor marker(s) - bold green with parentheses
+		if len(cursorsHere) > 0 {
+			output.WriteString("\x1b[1;32m(")
+			output.WriteString(strings.Join(cursorsHere, ","))
+			output.WriteString(")\x1b[0m")
+		}
+
+		// Output decoration marker(s) - red foreground with asterisks
+		if len(decorationsHere) > 0 {
+			output.WriteString("\x1b[0;31m*")
+			output.WriteString(strings.Join(decorationsHere, ","))
+			output.WriteString("*\x1b[0m")
+		}
+
+		lastPos = pos
+	}
+
+	// Output remaining text after last marker
+	if lastPos < int64(len(dataStr)) {
+		output.WriteString(dataStr[lastPos:])
+	}
+
+	r.println("Content:")
+	r.println("--------")
+	r.printf("%s\n", output.String())
+	r.println("--------")
+	r.printf("Total: %d bytes, %d runes, %d lines\n",
+		r.garland.ByteCount().Value,
+		r.garland.RuneCount().Value,
+		r.garland.LineCount().Value)
+
+	// Restore cursor position
+	cursor.SeekByte(savedPos)
+}
+
+func (r *REPL) cmdTree() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	treeInfo := r.garland.GetTreeInfo()
+	if treeInfo == nil {
+		r.println("No tree structure available")
+		return
+	}
+
+	r.printf("Tree structure (fork=%d, rev=%d):\n",
+		r.garland.CurrentFork(), r.garland.CurrentRevision())
+	r.println()
+	r.printTreeNode(treeInfo, "", true)
+}
+
+// printTreeNode recursively prints a tree node with line-drawing characters
+func (r *REPL) printTreeNode(node *garland.TreeNodeInfo, prefix string, isLast bool) {
+	if node == nil {
+		return
+	}
+
+	// Line drawing characters (UTF-8)
+	// ├── for non-last children
+	// └── for last child
+	// │   for continuation
+	connector := "├── "
+	if isLast {
+		connector = "└── "
+	}
+
+	// Build node description
+	var desc string
+	storageLabel := storageStateString(node.Storage)
+
+	if node.IsLeaf {
+		if node.DataPreview != "" {
+			desc = fmt.Sprintf("LEAF[%d] %dB %dR %dL [%s] \"%s\"",
+				node.NodeID, node.ByteCount, node.RuneCount, node.LineCount,
+				storageLabel, node.DataPreview)
+		} else {
+			desc = fmt.Sprintf("LEAF[%d] %dB %dR %dL [%s] (empty/cold)",
+				node.NodeID, node.ByteCount, node.RuneCount, node.LineCount,
+				storageLabel)
+		}
+	} else {
+		desc = fmt.Sprintf("NODE[%d] %dB %dR %dL",
+			node.NodeID, node.ByteCount, node.RuneCount, node.LineCount)
+	}
+
+	r.printf("%s%s%s\n", prefix, connector, desc)
+
+	// Determine child prefix
+	childPrefix := prefix
+	if isLast {
+		childPrefix += "    "
+	} else {
+		childPrefix += "│   "
+	}
+
+	// Print children
+	for i, child := range node.Children {
+		isChildLast := (i == len(node.Children)-1)
+		r.printTreeNode(child, childPrefix, isChildLast)
+	}
+}
+
+// storageStateString returns a short label for a storage state
+func storageStateString(s garland.StorageState) string {
+	switch s {
+	case garland.StorageMemory:
+		return "mem"
+	case garland.StorageWarm:
+		return "warm"
+	case garland.StorageCold:
+		return "cold"
+	case garland.StoragePlaceholder:
+		return "placeholder"
+	default:
+		return "?"
+	}
+}
+
+func (r *REPL) cmdTransaction(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: tx start [name] | tx commit | tx rollback")
+		return
+	}
+
+	subcmd := strings.ToLower(args[0])
+	switch subcmd {
+	case "start":
+		name := ""
+		if len(args) > 1 {
+			name = strings.Join(args[1:], " ")
+		}
+		err := r.garland.TransactionStart(name)
+		if err != nil {
+			r.errorf("Transaction start error: %v\n", err)
+			return
+		}
+		r.printf("Transaction started (depth=%d, name=%q)\n",
+			r.garland.TransactionDepth(), name)
+
+	case "commit":
+		result, err := r.garland.TransactionCommit()
+		if err != nil {
+			r.errorf("Transaction commit error: %v\n", err)
+			return
+		}
+		r.printf("Transaction committed. Now at fork=%d, revision=%d\n",
+			result.Fork, result.Revision)
+
+	case "rollback":
+		err := r.garland.TransactionRollback()
+		if err != nil {
+			r.errorf("Transaction rollback error: %v\n", err)
+			return
+		}
+		r.printf("Transaction rolled back. Now at fork=%d, revision=%d\n",
+			r.garland.CurrentFork(), r.garland.CurrentRevision())
+
+	default:
+		r.errorln("Unknown transaction command. Use: start, commit, or rollback")
+	}
+}
+
+func (r *REPL) cmdUndoSeek(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	g := r.garland
+
+	if len(args) < 1 {
+		r.errorln("Usage: undoseek <revision>")
+		r.printf("Current revision: %d\n", g.CurrentRevision())
+		// Show revision range
+		forkInfo, err := g.GetForkInfo(g.CurrentFork())
+		if err == nil {
+			r.printf("Valid range: 0 to %d (highest in this fork)\n", forkInfo.HighestRevision)
+		}
+		return
+	}
+
+	rev, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		r.errorf("Invalid revision number: %v\n", err)
+		return
+	}
+
+	prevFork := g.CurrentFork()
+	prevRev := g.CurrentRevision()
+
+	err = g.UndoSeek(garland.RevisionID(rev))
+	if err != nil {
+		r.errorf("UndoSeek error: %v\n", err)
+		return
+	}
+
+	r.printf("Moved from fork=%d/rev=%d to fork=%d/rev=%d\n",
+		prevFork, prevRev, g.CurrentFork(), g.CurrentRevision())
+	r.printf("Content is now %d bytes\n", g.ByteCount().Value)
+
+	// Show cursor position update
+	if cursor := r.cursor(); cursor != nil {
+		line, lineRune := cursor.LinePos()
+		r.printf("Cursor '%s' now at: byte=%d, line=%d:%d\n",
+			r.currentCursor, cursor.BytePos(), line, lineRune)
+	}
+
+	// Warn about fork creation on edit
+	forkInfo, err := g.GetForkInfo(g.CurrentFork())
+	if err == nil && g.CurrentRevision() < forkInfo.HighestRevision {
+		r.println("Note: Editing from here will create a new fork!")
+	}
+}
+
+func (r *REPL) cmdRevisions() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	g := r.garland
+	currentRev := g.CurrentRevision()
+	currentFork := g.CurrentFork()
+
+	// Get fork info to know the highest revision
+	forkInfo, err := g.GetForkInfo(currentFork)
+	if err != nil {
+		r.errorf("Error getting fork info: %v\n", err)
+		return
+	}
+
+	highestRev := forkInfo.HighestRevision
+
+	r.printf("Fork %d - Revisions (0 to %d):\n", currentFork, highestRev)
+
+	// Get revision range (0 to highest)
+	revisions, err := g.GetRevisionRange(0, highestRev)
+	if err != nil {
+		r.errorf("Error getting revisions: %v\n", err)
+		return
+	}
+
+	if len(revisions) == 0 {
+		r.println("  (no recorded revisions yet)")
+		r.printf("  Current position: revision %d\n", currentRev)
+		return
+	}
+
+	for _, info := range revisions {
+		marker := "  "
+		if info.Revision == currentRev {
+			marker = "> "
+		}
+		changes := ""
+		if info.HasChanges {
+			changes = " [has changes]"
+		}
+		name := info.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		r.printf("%s%d: %s%s\n", marker, info.Revision, name, changes)
+	}
+
+	if currentRev < highestRev {
+		r.printf("\nNote: Not at HEAD (current=%d, HEAD=%d). Editing will create a new fork.\n",
+			currentRev, highestRev)
+	}
+}
+
+func (r *REPL) cmdFork(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	g := r.garland
+
+	// Handle subcommands: fork, fork list, fork <id>, fork delete <id>
+	if len(args) >= 1 {
+		subcmd := strings.ToLower(args[0])
+
+		if subcmd == "list" {
+			// List all forks
+			forks := g.ListForks()
+			currentFork := g.CurrentFork()
+
+			r.printf("Forks (%d total):\n", len(forks))
+			for _, info := range forks {
+				marker := "  "
+				if info.ID == currentFork {
+					marker = "> "
+				}
+				parentInfo := ""
+				if info.ParentFork != info.ID {
+					parentInfo = fmt.Sprintf(" (parent: fork=%d@rev=%d)", info.ParentFork, info.ParentRevision)
+				}
+				prunedInfo := ""
+				if info.PrunedUpTo > 0 {
+					prunedInfo = fmt.Sprintf(" [pruned<%d]", info.PrunedUpTo)
+				}
+				deletedInfo := ""
+				if info.Deleted {
+					deletedInfo = " [DELETED]"
+				}
+				r.printf("%s%d: highest revision %d%s%s%s\n", marker, info.ID, info.HighestRevision, parentInfo, prunedInfo, deletedInfo)
+			}
+			return
+		}
+
+		if subcmd == "delete" {
+			if len(args) < 2 {
+				r.errorln("Usage: fork delete <fork_id>")
+				r.println("  Soft-deletes a fork (cannot switch to it anymore)")
+				r.println("  Cannot delete current fork")
+				r.printf("Current fork: %d\n", g.CurrentFork())
+				return
+			}
+
+			forkID, err := strconv.ParseUint(args[1], 10, 64)
+			if err != nil {
+				r.errorf("Invalid fork ID: %v\n", err)
+				return
+			}
+
+			err = g.DeleteFork(garland.ForkID(forkID))
+			if err != nil {
+				r.errorf("Fork delete error: %v\n", err)
+				return
+			}
+
+			r.printf("Fork %d deleted\n", forkID)
+			return
+		}
+
+		// Switch to fork by ID
+		forkID, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			r.errorf("Invalid fork ID or subcommand: %s\n", args[0])
+			r.errorln("Usage: fork [list | <id> | delete <id>]")
+			return
+		}
+
+		prevFork := g.CurrentFork()
+		prevRev := g.CurrentRevision()
+
+		err = g.ForkSeek(garland.ForkID(forkID))
+		if err != nil {
+			r.errorf("Fork switch error: %v\n", err)
+			return
+		}
+
+		r.printf("Switched from fork=%d/rev=%d to fork=%d/rev=%d\n",
+			prevFork, prevRev, g.CurrentFork(), g.CurrentRevision())
+		r.printf("Content is now %d bytes\n", g.ByteCount().Value)
+
+		// Show cursor position update
+		if cursor := r.cursor(); cursor != nil {
+			line, lineRune := cursor.LinePos()
+			r.printf("Cursor '%s' now at: byte=%d, line=%d:%d\n",
+				r.currentCursor, cursor.BytePos(), line, lineRune)
+		}
+		return
+	}
+
+	// No args - show current fork info
+	currentFork := g.CurrentFork()
+	info, err := g.GetForkInfo(currentFork)
+	if err != nil {
+		r.errorf("Error getting fork info: %v\n", err)
+		return
+	}
+
+	r.printf("Current Fork: %d\n", info.ID)
+	r.printf("  Highest Revision: %d\n", info.HighestRevision)
+	r.printf("  Current Revision: %d\n", g.CurrentRevision())
+	if info.ParentFork != info.ID {
+		r.printf("  Parent: fork=%d@rev=%d\n", info.ParentFork, info.ParentRevision)
+	}
+	if info.PrunedUpTo > 0 {
+		r.printf("  Pruned up to: %d\n", info.PrunedUpTo)
+	}
+	r.println("\nUse 'fork list' to see all forks.")
+}
+
+func (r *REPL) cmdPrune(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	g := r.garland
+
+	if len(args) < 1 {
+		r.errorln("Usage: prune <keep_from_revision>")
+		r.println("  Removes revision history before keep_from_revision in current fork")
+		r.println("  Revisions >= keep_from_revision are kept")
+		forkInfo, err := g.GetForkInfo(g.CurrentFork())
+		if err == nil {
+			r.printf("Current fork: %d (revision %d, pruned up to %d)\n",
+				g.CurrentFork(), g.CurrentRevision(), forkInfo.PrunedUpTo)
+		}
+		return
+	}
+
+	keepFrom, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		r.errorf("Invalid revision: %v\n", err)
+		return
+	}
+
+	err = g.Prune(garland.RevisionID(keepFrom))
+	if err != nil {
+		r.errorf("Prune error: %v\n", err)
+		return
+	}
+
+	forkInfo, _ := g.GetForkInfo(g.CurrentFork())
+	r.printf("Fork %d pruned: revisions before %d removed\n", g.CurrentFork(), forkInfo.PrunedUpTo)
+}
+
+func (r *REPL) cmdVersion() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	g := r.garland
+	r.printf("Current Fork: %d\n", g.CurrentFork())
+	r.printf("Current Revision: %d\n", g.CurrentRevision())
+
+	// Show revision info if available
+	info, err := g.GetRevisionInfo(g.CurrentRevision())
+	if err == nil && info != nil {
+		r.printf("Revision Name: %q\n", info.Name)
+		r.printf("Has Changes: %v\n", info.HasChanges)
+	}
+}
+
+func (r *REPL) ensureGarland() bool {
+	if r.garland == nil {
+		r.errorln("No garland is open. Use 'new <text>' to create one.")
+		return false
+	}
+	return true
+}
+
+func (r *REPL) cmdDecorate(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: decorate <key>                    - at cursor position")
+		r.println("       decorate key=byte <pos>           - at byte position")
+		r.println("       decorate key=rune <pos>           - at rune position")
+		r.println("       decorate key=line <line>:<rune>   - at line:rune position")
+		r.println("       decorate key=nil                  - remove decoration")
+		r.println("       decorate k1=byte 5, k2=line 1:0   - multiple decorations")
+		return
+	}
+
+	// Join args and split by comma to handle multiple decorations
+	fullInput := strings.Join(args, " ")
+	parts := strings.Split(fullInput, ",")
+
+	var entries []garland.DecorationEntry
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		entry, desc, err := r.parseDecorationSpec(part)
+		if err != nil {
+			r.errorf("Error parsing '%s': %v\n", part, err)
+			return
+		}
+		entries = append(entries, entry)
+		r.printf("  %s: %s\n", entry.Key, desc)
+	}
+
+	if len(entries) == 0 {
+		r.errorln("No decorations specified")
+		return
+	}
+
+	result, err := r.garland.Decorate(entries)
+	if err != nil {
+		r.errorf("Decorate error: %v\n", err)
+		return
+	}
+
+	r.printf("Applied %d decoration(s). Fork=%d, revision=%d\n",
+		len(entries), result.Fork, result.Revision)
+}
+
+// parseDecorationSpec parses a decoration specification like "key=byte 120" or "key" (cursor pos)
+func (r *REPL) parseDecorationSpec(spec string) (garland.DecorationEntry, string, error) {
+	// Check for key=value format
+	if idx := strings.Index(spec, "="); idx > 0 {
+		key := stripQuotes(strings.TrimSpace(spec[:idx]))
+		value := strings.TrimSpace(spec[idx+1:])
+
+		// Handle nil (deletion)
+		if value == "nil" {
+			return garland.DecorationEntry{Key: key, Address: nil}, "removed", nil
+		}
+
+		// Parse address type and value
+		valueParts := strings.Fields(value)
+		if len(valueParts) < 2 {
+			return garland.DecorationEntry{}, "", fmt.Errorf("expected 'type position', got %q", value)
+		}
+
+		addrType := strings.ToLower(valueParts[0])
+		posStr := valueParts[1]
+
+		switch addrType {
+		case "byte":
+			pos, err := strconv.ParseInt(posStr, 10, 64)
+			if err != nil {
+				return garland.DecorationEntry{}, "", fmt.Errorf("invalid byte position: %v", err)
+			}
+			return garland.DecorationEntry{
+				Key:     key,
+				Address: &garland.AbsoluteAddress{Mode: garland.ByteMode, Byte: pos},
+			}, fmt.Sprintf("byte %d", pos), nil
+
+		case "rune":
+			pos, err := strconv.ParseInt(posStr, 10, 64)
+			if err != nil {
+				return garland.DecorationEntry{}, "", fmt.Errorf("invalid rune position: %v", err)
+			}
+			return garland.DecorationEntry{
+				Key:     key,
+				Address: &garland.AbsoluteAddress{Mode: garland.RuneMode, Rune: pos},
+			}, fmt.Sprintf("rune %d", pos), nil
+
+		case "line":
+			// Parse line:rune format
+			lineParts := strings.Split(posStr, ":")
+			if len(lineParts) != 2 {
+				return garland.DecorationEntry{}, "", fmt.Errorf("line position must be 'line:rune', got %q", posStr)
+			}
+			line, err := strconv.ParseInt(lineParts[0], 10, 64)
+			if err != nil {
+				return garland.DecorationEntry{}, "", fmt.Errorf("invalid line number: %v", err)
+			}
+			runeInLine, err := strconv.ParseInt(lineParts[1], 10, 64)
+			if err != nil {
+				return garland.DecorationEntry{}, "", fmt.Errorf("invalid rune in line: %v", err)
+			}
+			return garland.DecorationEntry{
+				Key:     key,
+				Address: &garland.AbsoluteAddress{Mode: garland.LineRuneMode, Line: line, LineRune: runeInLine},
+			}, fmt.Sprintf("line %d:%d", line, runeInLine), nil
+
+		default:
+			return garland.DecorationEntry{}, "", fmt.Errorf("unknown address type %q (use byte, rune, or line)", addrType)
+		}
+	}
+
+	// Simple form: just key, use cursor position
+	key := stripQuotes(spec)
+	cursor := r.cursor()
+	bytePos := cursor.BytePos()
+
+	return garland.DecorationEntry{
+		Key:     key,
+		Address: &garland.AbsoluteAddress{Mode: garland.ByteMode, Byte: bytePos},
+	}, fmt.Sprintf("byte %d (cursor)", bytePos), nil
+}
+
+func (r *REPL) cmdUndecorate(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: undecorate <key>")
+		r.println("  Removes the decoration with the given key")
+		return
+	}
+
+	key := stripQuotes(args[0])
+
+	entry := garland.DecorationEntry{
+		Key:     key,
+		Address: nil, // nil address means delete
+	}
+
+	result, err := r.garland.Decorate([]garland.DecorationEntry{entry})
+	if err != nil {
+		r.errorf("Undecorate error: %v\n", err)
+		return
+	}
+
+	r.printf("Removed decoration '%s'. Fork=%d, revision=%d\n",
+		key, result.Fork, result.Revision)
+}
+
+func (r *REPL) cmdDecorations(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	// If a line number is provided, show decorations on that line
+	if len(args) >= 1 {
+		line, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			r.errorf("Invalid line number: %v\n", err)
+			return
+		}
+
+		decs, err := r.garland.GetDecorationsOnLine(line)
+		if err != nil {
+			r.errorf("Error getting decorations: %v\n", err)
+			return
+		}
+
+		if len(decs) == 0 {
+			r.printf("No decorations on line %d\n", line)
+			return
+		}
+
+		r.printf("Decorations on line %d:\n", line)
+		for _, dec := range decs {
+			r.printf("  '%s' at byte %d\n", dec.Key, dec.Address.Byte)
+		}
+		return
+	}
+
+	// Otherwise show all decorations in the file (use byteCount+1 to include EOF decorations)
+	byteCount := r.garland.ByteCount().Value
+	decs, err := r.garland.GetDecorationsInByteRange(0, byteCount+1)
+	if err != nil {
+		r.errorf("Error getting decorations: %v\n", err)
+		return
+	}
+
+	if len(decs) == 0 {
+		r.println("No decorations in file")
+		return
+	}
+
+	r.printf("Decorations (%d total):\n", len(decs))
+	for _, dec := range decs {
+		r.printf("  '%s' at byte %d\n", dec.Key, dec.Address.Byte)
+	}
+}
+
+func (r *REPL) cmdGetDecoration(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: decoration <key>")
+		r.println("  Gets the position of a specific decoration")
+		return
+	}
+
+	key := stripQuotes(args[0])
+
+	addr, err := r.garland.GetDecorationPosition(key)
+	if err != nil {
+		if err == garland.ErrDecorationNotFound {
+			r.errorf("Decoration '%s' not found\n", key)
+		} else {
+			r.errorf("Error getting decoration: %v\n", err)
+		}
+		return
+	}
+
+	r.set("address", map[string]any{"mode": int(addr.Mode), "byte": addr.Byte, "rune": addr.Rune, "line": addr.Line, "lineRune": addr.LineRune})
+	r.printf("Decoration '%s' is at:\n", key)
+	switch addr.Mode {
+	case garland.ByteMode:
+		r.printf("  Byte: %d\n", addr.Byte)
+	case garland.RuneMode:
+		r.printf("  Rune: %d\n", addr.Rune)
+	case garland.LineRuneMode:
+		r.printf("  Line: %d:%d\n", addr.Line, addr.LineRune)
+	}
+}
+
+func (r *REPL) cmdSave() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	report, err := r.garland.Save()
+	if err != nil {
+		r.errorf("Save error: %v\n", err)
+		return
+	}
+	r.printScarWarnings(report)
+
+	r.println("File saved")
+}
+
+func (r *REPL) cmdRebase(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+	var report garland.RebaseReport
+	var err error
+	if len(args) > 0 {
+		report, err = r.garland.RebaseOnFile(nil, strings.Join(args, " "))
+	} else {
+		report, err = r.garland.RebaseOnSource()
+	}
+	if err != nil {
+		r.errorf("Rebase error: %v\n", err)
+		return
+	}
+	if report.NoChange {
+		r.println("Rebase: buffer already matches the file (no change)")
+	} else {
+		r.printf("Rebase: %d bytes kept (%d blocks), %d bytes adopted, size %d -> %d\n",
+			report.BytesKept, report.BlocksKept, report.BytesAdopted,
+			report.OldSize, report.NewSize)
+		r.printf("  'keep your version': undoseek %d\n", report.PreviousRevision)
+	}
+	if report.BlocksHealed > 0 {
+		r.printf("  %d previously lost blocks healed from the file\n", report.BlocksHealed)
+	}
+	for _, reg := range report.Adopted {
+		r.printf("  adopted [%d..%d)\n", reg.Offset, reg.Offset+reg.Length)
+	}
+}
+
+func (r *REPL) printScarWarnings(report garland.SaveReport) {
+	for _, ev := range report.Integrity {
+		r.printf("INTEGRITY [%s]: block at offset %d (%d bytes, file offset %d)\n",
+			ev.Kind, ev.BufferOffset, ev.Length, ev.FileOffset)
+		if ev.Detail != "" {
+			r.printf("  %s\n", ev.Detail)
+		}
+	}
+	for _, s := range report.Scars {
+		r.printf("WARNING: lost block at offset %d (%d bytes) written as scar", s.Offset, s.Length)
+		if s.Appended {
+			r.printf(" (marker appended at end of file)")
+		}
+		r.println()
+		if s.Reason != "" {
+			r.printf("  reason: %s\n", s.Reason)
+		}
+		r.printf("  marker: %s\n", s.Marker)
+	}
+}
+
+func (r *REPL) cmdSaveAs(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: saveas <filepath>")
+		return
+	}
+
+	path := strings.Join(args, " ")
+	report, err := r.garland.SaveAs(nil, path)
+	if err != nil {
+		r.errorf("SaveAs error: %v\n", err)
+		return
+	}
+	r.printScarWarnings(report)
+
+	r.printf("File saved to %s\n", path)
+}
+
+func (r *REPL) cmdChill(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: chill inactive|history|unused|all")
+		r.println("  inactive  - Chill data from inactive forks")
+		r.println("  history   - Chill old undo history (keep last 10 revisions)")
+		r.println("  unused    - Chill data not used at current revision")
+		r.println("  all       - Chill all data to cold storage")
+		return
+	}
+
+	var level garland.ChillLevel
+	levelName := strings.ToLower(args[0])
+	switch levelName {
+	case "inactive":
+		level = garland.ChillInactiveForks
+	case "history":
+		level = garland.ChillOldHistory
+	case "unused":
+		level = garland.ChillUnusedData
+	case "all":
+		level = garland.ChillEverything
+	default:
+		r.errorf("Unknown chill level: %s\n", levelName)
+		r.println("Use: inactive, history, unused, or all")
+		return
+	}
+
+	err := r.garland.Chill(level)
+	if err != nil {
+		r.errorf("Chill error: %v\n", err)
+		return
+	}
+
+	r.printf("Chilled data with level: %s\n", levelName)
+}
+
+func (r *REPL) cmdThaw(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) == 0 {
+		// Thaw all for current fork
+		err := r.garland.Thaw()
+		if err != nil {
+			r.errorf("Thaw error: %v\n", err)
+			return
+		}
+		r.println("Thawed all data for current fork")
+		return
+	}
+
+	if len(args) >= 2 {
+		// Thaw specific revision range
+		startRev, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			r.errorf("Invalid start revision: %v\n", err)
+			return
+		}
+		endRev, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			r.errorf("Invalid end revision: %v\n", err)
+			return
+		}
+
+		err = r.garland.ThawRevision(garland.RevisionID(startRev), garland.RevisionID(endRev))
+		if err != nil {
+			r.errorf("ThawRevision error: %v\n", err)
+			return
+		}
+		r.printf("Thawed revisions %d to %d\n", startRev, endRev)
+		return
+	}
+
+	r.errorln("Usage: thaw              - Thaw all data for current fork")
+	r.println("       thaw <start> <end> - Thaw specific revision range")
+}
+
+func (r *REPL) cmdThawRange(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: thawrange <start_byte> <end_byte>")
+		r.println("  Thaws only the nodes covering the specified byte range")
+		r.println("  This is RAM-safe for large files")
+		return
+	}
+
+	startByte, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		r.errorf("Invalid start byte: %v\n", err)
+		return
+	}
+	endByte, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid end byte: %v\n", err)
+		return
+	}
+
+	err = r.garland.ThawRange(startByte, endByte)
+	if err != nil {
+		r.errorf("ThawRange error: %v\n", err)
+		return
+	}
+
+	r.printf("Thawed byte range %d to %d\n", startByte, endByte)
+}
+
+func (r *REPL) cmdConvert(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: convert byte <pos>         - Convert byte to rune/line")
+		r.println("       convert rune <pos>         - Convert rune to byte/line")
+		r.println("       convert line <line> <rune> - Convert line:rune to byte/rune")
+		return
+	}
+
+	mode := strings.ToLower(args[0])
+
+	switch mode {
+	case "byte":
+		pos, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			r.errorf("Invalid byte position: %v\n", err)
+			return
+		}
+
+		runePos, err := r.garland.ByteToRune(pos)
+		if err != nil {
+			r.errorf("Error converting: %v\n", err)
+			return
+		}
+
+		line, lineRune, err := r.garland.ByteToLineRune(pos)
+		if err != nil {
+			r.errorf("Error converting: %v\n", err)
+			return
+		}
+
+		r.printf("Byte %d =\n", pos)
+		r.printf("  Rune: %d\n", runePos)
+		r.printf("  Line: %d:%d\n", line, lineRune)
+
+	case "rune":
+		pos, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			r.errorf("Invalid rune position: %v\n", err)
+			return
+		}
+
+		bytePos, err := r.garland.RuneToByte(pos)
+		if err != nil {
+			r.errorf("Error converting: %v\n", err)
+			return
+		}
+
+		line, lineRune, err := r.garland.ByteToLineRune(bytePos)
+		if err != nil {
+			r.errorf("Error converting: %v\n", err)
+			return
+		}
+
+		r.printf("Rune %d =\n", pos)
+		r.printf("  Byte: %d\n", bytePos)
+		r.printf("  Line: %d:%d\n", line, lineRune)
+
+	case "line":
+		if len(args) < 3 {
+			r.errorln("Usage: convert line <line> <rune>")
+			return
+		}
+		line, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			r.errorf("Invalid line number: %v\n", err)
+			return
+		}
+		runeInLine, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			r.errorf("Invalid rune position: %v\n", err)
+			return
+		}
+
+		bytePos, err := r.garland.LineRuneToByte(line, runeInLine)
+		if err != nil {
+			r.errorf("Error converting: %v\n", err)
+			return
+		}
+
+		runePos, err := r.garland.ByteToRune(bytePos)
+		if err != nil {
+			r.errorf("Error converting: %v\n", err)
+			return
+		}
+
+		r.printf("Line %d:%d =\n", line, runeInLine)
+		r.printf("  Byte: %d\n", bytePos)
+		r.printf("  Rune: %d\n", runePos)
+
+	default:
+		r.errorln("Unknown mode. Use: byte, rune, or line")
+	}
+}
+
+func (r *REPL) cmdDivergences(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	g := r.garland
+	forkInfo, err := g.GetForkInfo(g.CurrentFork())
+	if err != nil {
+		r.errorf("Error getting fork info: %v\n", err)
+		return
+	}
+
+	// Default to full revision range
+	startRev := garland.RevisionID(0)
+	endRev := forkInfo.HighestRevision
+
+	// Parse optional revision range
+	if len(args) >= 2 {
+		start, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			r.errorf("Invalid start revision: %v\n", err)
+			return
+		}
+		end, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			r.errorf("Invalid end revision: %v\n", err)
+			return
+		}
+		startRev = garland.RevisionID(start)
+		endRev = garland.RevisionID(end)
+	}
+
+	divergences, err := g.FindForksBetween(startRev, endRev)
+	if err != nil {
+		r.errorf("Error finding divergences: %v\n", err)
+		return
+	}
+
+	if len(divergences) == 0 {
+		r.printf("No fork divergences in revisions %d to %d\n", startRev, endRev)
+		return
+	}
+
+	r.printf("Fork divergences in revisions %d to %d:\n", startRev, endRev)
+	for _, d := range divergences {
+		dirStr := "branched into"
+		if d.Direction == garland.BranchedFrom {
+			dirStr = "branched from"
+		}
+		r.printf("  Revision %d: %s fork %d\n", d.DivergenceRev, dirStr, d.Fork)
+	}
+}
+
+func (r *REPL) cmdDumpDecorations(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: dumpdecorations <filepath>")
+		r.println("  Exports all decorations to an INI file")
+		return
+	}
+
+	path := strings.Join(args, " ")
+	err := r.garland.DumpDecorations(nil, path)
+	if err != nil {
+		r.errorf("DumpDecorations error: %v\n", err)
+		return
+	}
+
+	r.printf("Decorations exported to %s\n", path)
+}
+
+func (r *REPL) cmdLoadDecorations(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: loaddecorations <filepath>")
+		r.println("  Loads decorations from an INI file")
+		r.println("  Format: [decorations] section with key=byteposition entries")
+		return
+	}
+
+	path := strings.Join(args, " ")
+	err := r.garland.LoadDecorations(nil, path)
+	if err != nil {
+		r.errorf("LoadDecorations error: %v\n", err)
+		return
+	}
+
+	r.printf("Decorations loaded from %s\n", path)
+}
+
+// parseSearchFlags parses flags from args: -i (case insensitive), -w (whole word), -b (backward)
+// matchData is a search match as JSON-mode data.
+func matchData(m garland.SearchResult) map[string]any {
+	return map[string]any{"start": m.ByteStart, "end": m.ByteEnd, "text": m.Match}
+}
+
+func matchesData(matches []garland.SearchResult) []map[string]any {
+	out := make([]map[string]any, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, matchData(m))
+	}
+	return out
+}
+
+func parseSearchFlags(args []string) (garland.SearchOptions, []string) {
+	opts := garland.SearchOptions{
+		CaseSensitive: true, // Default to case sensitive
+		WholeWord:     false,
+		Backward:      false,
+	}
+
+	var remaining []string
+	for _, arg := range args {
+		switch arg {
+		case "-i":
+			opts.CaseSensitive = false
+		case "-w":
+			opts.WholeWord = true
+		case "-b":
+			opts.Backward = true
+		default:
+			remaining = append(remaining, arg)
+		}
+	}
+	return opts, remaining
+}
+
+// parseRegexFlags parses flags from args: -i (case insensitive), -b (backward)
+func parseRegexFlags(args []string) (garland.RegexOptions, []string) {
+	opts := garland.RegexOptions{
+		CaseInsensitive: false,
+		Backward:        false,
+	}
+
+	var remaining []string
+	for _, arg := range args {
+		switch arg {
+		case "-i":
+			opts.CaseInsensitive = true
+		case "-b":
+			opts.Backward = true
+		default:
+			remaining = append(remaining, arg)
+		}
+	}
+	return opts, remaining
+}
+
+func (r *REPL) cmdFind(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: find \"needle\" [-i] [-w] [-b]")
+		r.println("  -i: case insensitive")
+		r.println("  -w: whole word only")
+		r.println("  -b: search backward")
+		return
+	}
+
+	opts, remaining := parseSearchFlags(args)
+	if len(remaining) < 1 {
+		r.errorln("Usage: find \"needle\" [flags]")
+		return
+	}
+
+	needle, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	match, err := cursor.FindString(needle, opts)
+	if err != nil {
+		r.errorf("Find error: %v\n", err)
+		return
+	}
+
+	if match == nil {
+		r.println("No match found")
+		return
+	}
+
+	r.set("match", matchData(*match))
+	r.printf("Found at byte %d-%d: %q\n", match.ByteStart, match.ByteEnd, match.Match)
+}
+
+func (r *REPL) cmdFindAll(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: findall \"needle\" [-i] [-w] [-b]")
+		return
+	}
+
+	opts, remaining := parseSearchFlags(args)
+	if len(remaining) < 1 {
+		r.errorln("Usage: findall \"needle\" [flags]")
+		return
+	}
+
+	needle, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	matches, err := cursor.FindStringAll(needle, opts)
+	if err != nil {
+		r.errorf("Find error: %v\n", err)
+		return
+	}
+
+	if len(matches) == 0 {
+		r.println("No matches found")
+		return
+	}
+
+	r.set("matches", matchesData(matches))
+	r.printf("Found %d matches:\n", len(matches))
+	for i, match := range matches {
+		r.printf("  %d. byte %d-%d: %q\n", i+1, match.ByteStart, match.ByteEnd, match.Match)
+	}
+}
+
+func (r *REPL) cmdFindNext(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: findnext \"needle\" [-i] [-w] [-b]")
+		return
+	}
+
+	opts, remaining := parseSearchFlags(args)
+	if len(remaining) < 1 {
+		r.errorln("Usage: findnext \"needle\" [flags]")
+		return
+	}
+
+	needle, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	match, err := cursor.FindNext(needle, opts)
+	if err != nil {
+		r.errorf("Find error: %v\n", err)
+		return
+	}
+
+	if match == nil {
+		r.println("No match found")
+		return
+	}
+
+	line, lineRune := cursor.LinePos()
+	r.set("match", matchData(*match))
+	r.printf("Found at byte %d-%d: %q\n", match.ByteStart, match.ByteEnd, match.Match)
+	r.printf("Cursor moved to byte=%d, line=%d:%d\n", cursor.BytePos(), line, lineRune)
+}
+
+func (r *REPL) cmdFindRegex(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: findregex \"pattern\" [-i] [-b]")
+		r.println("  -i: case insensitive")
+		r.println("  -b: search backward")
+		return
+	}
+
+	opts, remaining := parseRegexFlags(args)
+	if len(remaining) < 1 {
+		r.errorln("Usage: findregex \"pattern\" [flags]")
+		return
+	}
+
+	pattern, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	match, err := cursor.FindRegex(pattern, opts)
+	if err != nil {
+		r.errorf("Find error: %v\n", err)
+		return
+	}
+
+	if match == nil {
+		r.println("No match found")
+		return
+	}
+
+	r.set("match", matchData(*match))
+	r.printf("Found at byte %d-%d: %q\n", match.ByteStart, match.ByteEnd, match.Match)
+}
+
+func (r *REPL) cmdFindRegexAll(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: findregexall \"pattern\" [-i] [-b]")
+		return
+	}
+
+	opts, remaining := parseRegexFlags(args)
+	if len(remaining) < 1 {
+		r.errorln("Usage: findregexall \"pattern\" [flags]")
+		return
+	}
+
+	pattern, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	matches, err := cursor.FindRegexAll(pattern, opts)
+	if err != nil {
+		r.errorf("Find error: %v\n", err)
+		return
+	}
+
+	if len(matches) == 0 {
+		r.println("No matches found")
+		return
+	}
+
+	r.set("matches", matchesData(matches))
+	r.printf("Found %d matches:\n", len(matches))
+	for i, match := range matches {
+		r.printf("  %d. byte %d-%d: %q\n", i+1, match.ByteStart, match.ByteEnd, match.Match)
+	}
+}
+
+func (r *REPL) cmdFindNextRegex(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: findnextregex \"pattern\" [-i] [-b]")
+		return
+	}
+
+	opts, remaining := parseRegexFlags(args)
+	if len(remaining) < 1 {
+		r.errorln("Usage: findnextregex \"pattern\" [flags]")
+		return
+	}
+
+	pattern, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	match, err := cursor.FindNextRegex(pattern, opts)
+	if err != nil {
+		r.errorf("Find error: %v\n", err)
+		return
+	}
+
+	if match == nil {
+		r.println("No match found")
+		return
+	}
+
+	line, lineRune := cursor.LinePos()
+	r.set("match", matchData(*match))
+	r.printf("Found at byte %d-%d: %q\n", match.ByteStart, match.ByteEnd, match.Match)
+	r.printf("Cursor moved to byte=%d, line=%d:%d\n", cursor.BytePos(), line, lineRune)
+}
+
+func (r *REPL) cmdMatch(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: match \"pattern\" [-i]")
+		r.println("  Checks if regex matches at current cursor position")
+		return
+	}
+
+	caseInsensitive := false
+	var remaining []string
+	for _, arg := range args {
+		if arg == "-i" {
+			caseInsensitive = true
+		} else {
+			remaining = append(remaining, arg)
+		}
+	}
+
+	if len(remaining) < 1 {
+		r.errorln("Usage: match \"pattern\" [-i]")
+		return
+	}
+
+	pattern, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	matches, result, err := cursor.MatchRegex(pattern, caseInsensitive)
+	if err != nil {
+		r.errorf("Match error: %v\n", err)
+		return
+	}
+
+	if !matches {
+		r.println("No match at cursor position")
+		return
+	}
+
+	r.printf("Match found: %q (bytes %d-%d)\n", result.Match, result.ByteStart, result.ByteEnd)
+}
+
+func (r *REPL) cmdReplace(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: replace \"needle\" \"replacement\" [-i] [-w] [-b]")
+		return
+	}
+
+	opts, remaining := parseSearchFlags(args)
+	if len(remaining) < 2 {
+		r.errorln("Usage: replace \"needle\" \"replacement\" [flags]")
+		return
+	}
+
+	fullInput := strings.Join(remaining, " ")
+	needle, remainder, err := r.parseQuotedString(fullInput)
+	if err != nil {
+		r.errorf("Parse error for needle: %v\n", err)
+		return
+	}
+
+	replacement, _, err := r.parseQuotedString(strings.TrimSpace(remainder))
+	if err != nil {
+		r.errorf("Parse error for replacement: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	replaced, result, err := cursor.ReplaceString(needle, replacement, opts)
+	if err != nil {
+		r.errorf("Replace error: %v\n", err)
+		return
+	}
+
+	if !replaced {
+		r.println("No match found")
+		return
+	}
+
+	r.printf("Replaced 1 occurrence. Fork=%d, revision=%d\n", result.Fork, result.Revision)
+}
+
+func (r *REPL) cmdReplaceAll(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: replaceall \"needle\" \"replacement\" [-i] [-w] [-b]")
+		return
+	}
+
+	opts, remaining := parseSearchFlags(args)
+	if len(remaining) < 2 {
+		r.errorln("Usage: replaceall \"needle\" \"replacement\" [flags]")
+		return
+	}
+
+	fullInput := strings.Join(remaining, " ")
+	needle, remainder, err := r.parseQuotedString(fullInput)
+	if err != nil {
+		r.errorf("Parse error for needle: %v\n", err)
+		return
+	}
+
+	replacement, _, err := r.parseQuotedString(strings.TrimSpace(remainder))
+	if err != nil {
+		r.errorf("Parse error for replacement: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	count, result, err := cursor.ReplaceStringAll(needle, replacement, opts)
+	if err != nil {
+		r.errorf("Replace error: %v\n", err)
+		return
+	}
+
+	if count == 0 {
+		r.println("No matches found")
+		return
+	}
+
+	r.printf("Replaced %d occurrences. Fork=%d, revision=%d\n", count, result.Fork, result.Revision)
+}
+
+func (r *REPL) cmdReplaceCount(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 3 {
+		r.errorln("Usage: replacecount \"needle\" \"replacement\" <count> [-i] [-w] [-b]")
+		return
+	}
+
+	opts, remaining := parseSearchFlags(args)
+	if len(remaining) < 3 {
+		r.errorln("Usage: replacecount \"needle\" \"replacement\" <count> [flags]")
+		return
+	}
+
+	fullInput := strings.Join(remaining, " ")
+	needle, remainder, err := r.parseQuotedString(fullInput)
+	if err != nil {
+		r.errorf("Parse error for needle: %v\n", err)
+		return
+	}
+
+	remainder = strings.TrimSpace(remainder)
+	replacement, remainder, err := r.parseQuotedString(remainder)
+	if err != nil {
+		r.errorf("Parse error for replacement: %v\n", err)
+		return
+	}
+
+	remainder = strings.TrimSpace(remainder)
+	count, err := strconv.Atoi(strings.Fields(remainder)[0])
+	if err != nil {
+		r.errorf("Invalid count: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	replaced, result, err := cursor.ReplaceStringCount(needle, replacement, count, opts)
+	if err != nil {
+		r.errorf("Replace error: %v\n", err)
+		return
+	}
+
+	if replaced == 0 {
+		r.println("No matches found")
+		return
+	}
+
+	r.printf("Replaced %d occurrences. Fork=%d, revision=%d\n", replaced, result.Fork, result.Revision)
+}
+
+func (r *REPL) cmdReplaceRegex(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: replaceregex \"pattern\" \"replacement\" [-i] [-b]")
+		r.println("  Replacement can use $1, $2, etc. for capture groups")
+		return
+	}
+
+	opts, remaining := parseRegexFlags(args)
+	if len(remaining) < 2 {
+		r.errorln("Usage: replaceregex \"pattern\" \"replacement\" [flags]")
+		return
+	}
+
+	fullInput := strings.Join(remaining, " ")
+	pattern, remainder, err := r.parseQuotedString(fullInput)
+	if err != nil {
+		r.errorf("Parse error for pattern: %v\n", err)
+		return
+	}
+
+	replacement, _, err := r.parseQuotedString(strings.TrimSpace(remainder))
+	if err != nil {
+		r.errorf("Parse error for replacement: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	replaced, result, err := cursor.ReplaceRegex(pattern, replacement, opts)
+	if err != nil {
+		r.errorf("Replace error: %v\n", err)
+		return
+	}
+
+	if !replaced {
+		r.println("No match found")
+		return
+	}
+
+	r.printf("Replaced 1 occurrence. Fork=%d, revision=%d\n", result.Fork, result.Revision)
+}
+
+func (r *REPL) cmdReplaceRegexAll(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: replaceregexall \"pattern\" \"replacement\" [-i] [-b]")
+		return
+	}
+
+	opts, remaining := parseRegexFlags(args)
+	if len(remaining) < 2 {
+		r.errorln("Usage: replaceregexall \"pattern\" \"replacement\" [flags]")
+		return
+	}
+
+	fullInput := strings.Join(remaining, " ")
+	pattern, remainder, err := r.parseQuotedString(fullInput)
+	if err != nil {
+		r.errorf("Parse error for pattern: %v\n", err)
+		return
+	}
+
+	replacement, _, err := r.parseQuotedString(strings.TrimSpace(remainder))
+	if err != nil {
+		r.errorf("Parse error for replacement: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	count, result, err := cursor.ReplaceRegexAll(pattern, replacement, opts)
+	if err != nil {
+		r.errorf("Replace error: %v\n", err)
+		return
+	}
+
+	if count == 0 {
+		r.println("No matches found")
+		return
+	}
+
+	r.printf("Replaced %d occurrences. Fork=%d, revision=%d\n", count, result.Fork, result.Revision)
+}
+
+func (r *REPL) cmdReplaceRegexCount(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 3 {
+		r.errorln("Usage: replaceregexcount \"pattern\" \"replacement\" <count> [-i] [-b]")
+		return
+	}
+
+	opts, remaining := parseRegexFlags(args)
+	if len(remaining) < 3 {
+		r.errorln("Usage: replaceregexcount \"pattern\" \"replacement\" <count> [flags]")
+		return
+	}
+
+	fullInput := strings.Join(remaining, " ")
+	pattern, remainder, err := r.parseQuotedString(fullInput)
+	if err != nil {
+		r.errorf("Parse error for pattern: %v\n", err)
+		return
+	}
+
+	remainder = strings.TrimSpace(remainder)
+	replacement, remainder, err := r.parseQuotedString(remainder)
+	if err != nil {
+		r.errorf("Parse error for replacement: %v\n", err)
+		return
+	}
+
+	remainder = strings.TrimSpace(remainder)
+	count, err := strconv.Atoi(strings.Fields(remainder)[0])
+	if err != nil {
+		r.errorf("Invalid count: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	replaced, result, err := cursor.ReplaceRegexCount(pattern, replacement, count, opts)
+	if err != nil {
+		r.errorf("Replace error: %v\n", err)
+		return
+	}
+
+	if replaced == 0 {
+		r.println("No matches found")
+		return
+	}
+
+	r.printf("Replaced %d occurrences. Fork=%d, revision=%d\n", replaced, result.Fork, result.Revision)
+}
+
+func (r *REPL) cmdCount(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: count \"needle\" [-i] [-w]")
+		return
+	}
+
+	opts, remaining := parseSearchFlags(args)
+	if len(remaining) < 1 {
+		r.errorln("Usage: count \"needle\" [flags]")
+		return
+	}
+
+	needle, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	count, err := cursor.CountString(needle, opts)
+	if err != nil {
+		r.errorf("Count error: %v\n", err)
+		return
+	}
+
+	r.set("count", count)
+	r.printf("Found %d occurrences\n", count)
+}
+
+func (r *REPL) cmdCountRegex(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 1 {
+		r.errorln("Usage: countregex \"pattern\" [-i]")
+		return
+	}
+
+	caseInsensitive := false
+	var remaining []string
+	for _, arg := range args {
+		if arg == "-i" {
+			caseInsensitive = true
+		} else {
+			remaining = append(remaining, arg)
+		}
+	}
+
+	if len(remaining) < 1 {
+		r.errorln("Usage: countregex \"pattern\" [-i]")
+		return
+	}
+
+	pattern, _, err := r.parseQuotedString(strings.Join(remaining, " "))
+	if err != nil {
+		r.errorf("Parse error: %v\n", err)
+		return
+	}
+
+	cursor := r.cursor()
+	count, err := cursor.CountRegex(pattern, caseInsensitive)
+	if err != nil {
+		r.errorf("Count error: %v\n", err)
+		return
+	}
+
+	r.set("count", count)
+	r.printf("Found %d matches\n", count)
+}
+
+func (r *REPL) cmdReady() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	g := r.garland
+	byteCount := g.ByteCount()
+	runeCount := g.RuneCount()
+	lineCount := g.LineCount()
+
+	completeStr := "complete"
+	if !byteCount.Complete {
+		completeStr = "streaming"
+	}
+
+	r.printf("Loading Status: %s\n", completeStr)
+	r.printf("  Bytes loaded: %d\n", byteCount.Value)
+	r.printf("  Runes loaded: %d\n", runeCount.Value)
+	r.printf("  Lines loaded: %d\n", lineCount.Value)
+
+	if !byteCount.Complete {
+		r.println("\nDuring streaming, seek operations will block until data arrives.")
+		r.println("Use 'isready' to check if a position is available without blocking.")
+	}
+}
+
+func (r *REPL) cmdIsReady(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if len(args) < 2 {
+		r.errorln("Usage: isready byte <pos>   - Check if byte position is ready")
+		r.println("       isready rune <pos>   - Check if rune position is ready")
+		r.println("       isready line <line>  - Check if line is ready")
+		return
+	}
+
+	mode := strings.ToLower(args[0])
+	pos, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		r.errorf("Invalid position: %v\n", err)
+		return
+	}
+
+	g := r.garland
+	var ready bool
+
+	switch mode {
+	case "byte":
+		ready = g.IsByteReady(pos)
+		if ready {
+			r.printf("Byte position %d is ready\n", pos)
+		} else {
+			r.printf("Byte position %d is NOT ready (still streaming)\n", pos)
+		}
+
+	case "rune":
+		ready = g.IsRuneReady(pos)
+		if ready {
+			r.printf("Rune position %d is ready\n", pos)
+		} else {
+			r.printf("Rune position %d is NOT ready (still streaming)\n", pos)
+		}
+
+	case "line":
+		ready = g.IsLineReady(pos)
+		if ready {
+			r.printf("Line %d is ready\n", pos)
+		} else {
+			r.printf("Line %d is NOT ready (still streaming)\n", pos)
+		}
+
+	default:
+		r.errorln("Unknown mode. Use: byte, rune, or line")
+	}
+}
+
+func (r *REPL) cmdMemory() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	stats := r.garland.MemoryUsage()
+
+	r.println("Memory Usage Statistics:")
+	r.printf("  In-memory bytes:    %d\n", stats.MemoryBytes)
+	r.printf("  In-memory leaves:   %d\n", stats.InMemoryLeaves)
+	r.printf("  Cold storage leaves: %d\n", stats.ColdStoredLeaves)
+	r.printf("  Warm storage leaves: %d\n", stats.WarmStoredLeaves)
+	if stats.PlaceholderLeaves > 0 {
+		r.printf("  Lost leaves:        %d (%d bytes)\n", stats.PlaceholderLeaves, stats.PlaceholderBytes)
+	}
+	r.printf("  Bytes by tier:      memory %d, warm %d, cold %d\n",
+		stats.InMemoryLeafBytes, stats.WarmLeafBytes, stats.ColdLeafBytes)
+	r.printf("  Cold storage used:  %d bytes\n", stats.ColdBytes)
+	if stats.ColdQuota > 0 {
+		r.printf("  Cold storage quota: %d bytes\n", stats.ColdQuota)
+	}
+	r.printf("  Tier traffic:       %d chills, %d warm evictions, %d thaws, %d warm reads\n",
+		stats.Chills, stats.WarmEvictions, stats.Thaws, stats.WarmReads)
+	r.printf("  Cache hits:         %d (%.1f%% hit rate)\n", stats.CacheHits, stats.CacheHitRate*100)
+
+	if stats.SoftLimit > 0 {
+		r.printf("  Soft limit:         %d bytes\n", stats.SoftLimit)
+		if stats.MemoryBytes > stats.SoftLimit {
+			r.println("  Status: OVER soft limit (background chilling active)")
+		}
+	} else {
+		r.println("  Soft limit:         (disabled)")
+	}
+
+	if stats.HardLimit > 0 {
+		r.printf("  Hard limit:         %d bytes\n", stats.HardLimit)
+		if stats.MemoryBytes > stats.HardLimit {
+			r.println("  Status: OVER hard limit (immediate chilling triggered)")
+		}
+	} else {
+		r.println("  Hard limit:         (disabled)")
+	}
+
+	// Check tree balance
+	if r.garland.NeedsRebalancing() {
+		r.println("  Tree status:        Needs rebalancing")
+	} else {
+		r.println("  Tree status:        Balanced")
+	}
+
+	// Show node manipulation count (useful for determining when to rebalance)
+	r.printf("  Node manipulations: %d (since last rebalance)\n", r.garland.NodeManipulations())
+}
+
+func (r *REPL) cmdMemChill(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	budget := 5 // default
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			r.errorln("Usage: memchill [count]")
+			r.println("  count: number of nodes to chill (default: 5)")
+			return
+		}
+		budget = n
+	}
+
+	stats := r.lib.IncrementalChill(budget)
+
+	if stats.NodesChilled > 0 {
+		r.printf("Chilled %d nodes, freed %d bytes\n", stats.NodesChilled, stats.BytesChilled)
+	} else {
+		r.println("No nodes chilled (none eligible or cold storage not configured)")
+	}
+}
+
+func (r *REPL) cmdRebalance() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	if !r.garland.NeedsRebalancing() {
+		r.println("Tree is already balanced, no rebalancing needed")
+		return
+	}
+
+	stats := r.garland.ForceRebalance()
+
+	if stats.RotationsPerformed == -1 {
+		r.println("Tree was rebuilt (full rebalance)")
+	} else if stats.RotationsPerformed > 0 {
+		r.printf("Performed %d rotations\n", stats.RotationsPerformed)
+	} else {
+		r.println("Rebalancing complete")
+	}
+}
+
+func (r *REPL) cmdSnapshots() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	stats := r.garland.GetSnapshotStats()
+
+	r.printf("Snapshot Statistics:\n")
+	r.printf("  Total snapshots: %d\n", stats.TotalSnapshots)
+
+	if len(stats.ByFork) > 0 {
+		r.printf("\nBy Fork:\n")
+		for forkID, count := range stats.ByFork {
+			forkInfo, _ := r.garland.GetForkInfo(forkID)
+			status := ""
+			if forkInfo != nil {
+				if forkInfo.Deleted {
+					status = " [DELETED]"
+				}
+				if forkInfo.PrunedUpTo > 0 {
+					status += fmt.Sprintf(" [pruned<%d]", forkInfo.PrunedUpTo)
+				}
+			}
+			r.printf("  Fork %d: %d snapshots%s\n", forkID, count, status)
+		}
+	}
+}
+
+// Optimized region commands
+
+func (r *REPL) cmdCheckpoint() {
+	if !r.ensureGarland() {
+		return
+	}
+
+	err := r.garland.Checkpoint()
+	if err != nil {
+		r.errorf("Checkpoint error: %v\n", err)
+		return
+	}
+
+	r.println("Checkpoint completed - all active regions committed")
+}
+
+func (r *REPL) cmdRegion(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	cursor := r.cursor()
+	if cursor == nil {
+		r.errorln("No cursor available")
+		return
+	}
+
+	if len(args) == 0 {
+		// Show current region info
+		if cursor.HasOptimizedRegion() {
+			serial := cursor.OptimizedRegionSerial()
+			start, end, _ := cursor.OptimizedRegionBounds()
+			graceStart, graceEnd, _ := cursor.OptimizedRegionGraceWindow()
+			r.printf("Region #%d:\n", serial)
+			r.printf("  Content: bytes [%d, %d) (%d bytes)\n", start, end, end-start)
+			r.printf("  Grace:   bytes [%d, %d) (%d bytes)\n", graceStart, graceEnd, graceEnd-graceStart)
+		} else {
+			r.println("No active region for current cursor")
+		}
+		return
+	}
+
+	subcmd := strings.ToLower(args[0])
+	switch subcmd {
+	case "begin":
+		if len(args) < 3 {
+			r.errorln("Usage: region begin <startByte> <endByte>")
+			return
+		}
+		startByte, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			r.errorf("Invalid start byte: %v\n", err)
+			return
+		}
+		endByte, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			r.errorf("Invalid end byte: %v\n", err)
+			return
+		}
+		err = cursor.BeginOptimizedRegion(startByte, endByte)
+		if err != nil {
+			r.errorf("Region begin error: %v\n", err)
+			return
+		}
+		serial := cursor.OptimizedRegionSerial()
+		start, end, _ := cursor.OptimizedRegionBounds()
+		graceStart, graceEnd, _ := cursor.OptimizedRegionGraceWindow()
+		r.printf("Created region #%d: content=[%d,%d), grace=[%d,%d)\n",
+			serial, start, end, graceStart, graceEnd)
+
+	default:
+		r.errorln("Usage: region | region begin <startByte> <endByte>")
+	}
+}
+
+func (r *REPL) cmdCursorMode(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+
+	cursor := r.cursor()
+	if cursor == nil {
+		r.errorln("No cursor available")
+		return
+	}
+
+	if len(args) == 0 {
+		// Show current mode
+		modeStr := "human"
+		if cursor.Mode() == garland.CursorModeProcess {
+			modeStr = "process"
+		}
+		r.printf("Current cursor mode: %s\n", modeStr)
+		return
+	}
+
+	mode := strings.ToLower(args[0])
+	switch mode {
+	case "human":
+		cursor.SetMode(garland.CursorModeHuman)
+		r.println("Cursor mode set to 'human' (auto-creates regions on edit)")
+	case "process":
+		cursor.SetMode(garland.CursorModeProcess)
+		r.println("Cursor mode set to 'process' (uses explicit transactions)")
+	default:
+		r.errorln("Usage: cursormode [human|process]")
+	}
+}
+
+// Ensure utf8 is used (for future unicode-aware operations)
+var _ = utf8.RuneCountInString
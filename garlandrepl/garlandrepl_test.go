@@ -0,0 +1,571 @@
+package garlandrepl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phroun/garland"
+	"github.com/phroun/garland/garlandrpc"
+)
+
+func runScript(t *testing.T, json bool, script string, cmds ...Command) string {
+	t.Helper()
+	lib, err := garland.Init(garland.LibraryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	r := New(lib, Options{In: strings.NewReader(script), Out: &out, JSON: json})
+	for _, c := range cmds {
+		if err := r.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Run()
+	return out.String()
+}
+
+func TestRegisteredCommand(t *testing.T) {
+	var got []string
+	echo := Command{
+		Name: "Echo", Usage: "echo <args...>", Help: "Print the arguments",
+		Run: func(r *REPL, args []string) error {
+			got = args
+			r.Printf("%d bytes\n", r.Garland().ByteCount().Value)
+			return nil
+		},
+	}
+	out := runScript(t, false, "new \"abc\"\nECHO one \"two three\" 'f\"our' \"a\\\"b\"\nhelp\n", echo)
+	if want := []string{"one", "two three", `f"our`, `a"b`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+	if !strings.Contains(out, "3 bytes") || !strings.Contains(out, "echo <args...>") {
+		t.Errorf("output missing the command's result or help:\n%s", out)
+	}
+
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	r := New(lib, Options{In: strings.NewReader(""), Out: &bytes.Buffer{}})
+	r.Register(echo)
+	if err := r.Register(Command{Name: "echo", Run: echo.Run}); !errors.Is(err, ErrCommandExists) {
+		t.Errorf("duplicate Register = %v", err)
+	}
+}
+
+func TestRegisteredCommandJSON(t *testing.T) {
+	fail := Command{Name: "fail", Run: func(r *REPL, args []string) error { return errors.New("nope") }}
+	count := Command{Name: "count", Run: func(r *REPL, args []string) error {
+		r.Set("args", len(args))
+		return nil
+	}}
+	out := runScript(t, true, "count a b\nfail\ncount \"open\n", fail, count)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("%d responses, want 3:\n%s", len(lines), out)
+	}
+	var resp []map[string]any
+	for _, line := range lines {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatal(err)
+		}
+		resp = append(resp, m)
+	}
+	if resp[0]["status"] != "ok" || resp[0]["data"].(map[string]any)["args"] != 2.0 {
+		t.Errorf("count: %s", lines[0])
+	}
+	if resp[1]["status"] != "error" || !strings.Contains(resp[1]["error"].(string), "nope") {
+		t.Errorf("fail: %s", lines[1])
+	}
+	if resp[2]["status"] != "error" || !strings.Contains(resp[2]["error"].(string), "unterminated") {
+		t.Errorf("unterminated quote: %s", lines[2])
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	script := "# a scenario\nnew \"abc\"\n\nbogus\ndump\n"
+
+	var out bytes.Buffer
+	err := New(lib, Options{Out: &out}).RunScript(strings.NewReader(script), "s.repl")
+	if err == nil || !strings.Contains(err.Error(), "s.repl:4:") || !strings.Contains(err.Error(), "Unknown command") {
+		t.Errorf("RunScript error = %v", err)
+	}
+	if strings.Contains(out.String(), "garland>") || strings.Contains(out.String(), "abc\n") {
+		t.Errorf("ran past the failure or prompted:\n%s", out.String())
+	}
+
+	out.Reset()
+	err = New(lib, Options{Out: &out, KeepGoing: true}).RunScript(strings.NewReader(script), "s.repl")
+	if err == nil || !strings.Contains(out.String(), "abc") {
+		t.Errorf("KeepGoing: error %v, output:\n%s", err, out.String())
+	}
+
+	if err := New(lib, Options{Out: &out}).RunScript(strings.NewReader("new \"a\"\nquit\nbogus\n"), "q"); err != nil {
+		t.Errorf("script ending in quit: %v", err)
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	inner := filepath.Join(dir, "inner.repl")
+	os.WriteFile(inner, []byte("insert \"xyz\"\nbogus\ninsert \"never\"\n"), 0o644)
+
+	out := runScript(t, true, "new \"a\"\nsource "+inner+"\ndump\n")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("%d responses, want 3:\n%s", len(lines), out)
+	}
+	var resp map[string]any
+	json.Unmarshal([]byte(lines[1]), &resp)
+	if resp["status"] != "error" || !strings.Contains(resp["error"].(string), "inner.repl:2:") {
+		t.Errorf("source: %s", lines[1])
+	}
+	if !strings.Contains(lines[2], "xyz") || strings.Contains(lines[2], "never") {
+		t.Errorf("dump after source: %s", lines[2])
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	hist := filepath.Join(t.TempDir(), "history")
+	os.WriteFile(hist, []byte("new \"abc\"\ndump\n"), 0o644)
+
+	keys := strings.Join([]string{
+		"sxek\x1b[D\x1b[D\x7fe\x05 4\r", // left, left, backspace, Ctrl-E: "seek 4"
+		"\x1b[A\x1b[A\x1b[A\r",          // three entries back: "new \"abc\""
+		"\x12du\r",                      // Ctrl-R: "dump"
+		"xyz\x01\x0b\x03",               // Ctrl-A, Ctrl-K, Ctrl-C
+		"one two\x17\r",                 // Ctrl-W: "one "
+	}, "")
+	var out bytes.Buffer
+	e := newLineEditor(strings.NewReader(keys), &out, hist)
+	var got []string
+	for {
+		line, err := e.readLine("> ")
+		if err == io.EOF {
+			break
+		}
+		if err == errInterrupted {
+			line = "^C"
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, line)
+	}
+	if want := []string{"seek 4", `new "abc"`, "dump", "^C", "one "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+
+	data, _ := os.ReadFile(hist)
+	if want := "new \"abc\"\ndump\nseek 4\nnew \"abc\"\ndump\none\n"; string(data) != want {
+		t.Errorf("history file = %q, want %q", data, want)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	r := New(lib, Options{In: strings.NewReader(""), Out: &bytes.Buffer{}})
+	r.Register(Command{Name: "stats", Run: func(*REPL, []string) error { return nil },
+		Complete: func(r *REPL, args []string) []string { return []string{"lines", "bytes"} }})
+	for _, cmd := range []string{`new "hello"`, "decorate alpha=byte 1", "decorate beta=byte 2", "cursor other", "insert \"!\""} {
+		r.runCommand(cmd)
+	}
+
+	tests := []struct {
+		line  string
+		start int
+		want  []string
+	}{
+		{"fin", 0, []string{"find", "findall", "findnext", "findnextregex", "findregex", "findregexall"}},
+		{"st", 0, []string{"stats", "status", "stream"}},
+		{"seek l", 5, []string{"line"}},
+		{"seek line ", 10, nil},
+		{"cursor ", 7, []string{"list", "delete", "default", "other"}},
+		{"cursor delete o", 14, []string{"other"}},
+		{"undecorate ", 11, []string{"alpha", "beta"}},
+		{"undoseek ", 9, []string{"0", "1", "2", "3"}},
+		{"fork ", 5, []string{"list", "delete", "0"}},
+		{"stats b", 6, []string{"bytes"}},
+	}
+	for _, tt := range tests {
+		start, got := r.complete(tt.line)
+		if start != tt.start || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("complete(%q) = %d, %q; want %d, %q", tt.line, start, got, tt.start, tt.want)
+		}
+	}
+
+	// Every name completed is one the shell runs.
+	for _, name := range builtinCommands {
+		var out bytes.Buffer
+		New(lib, Options{Out: &out}).handleCommand(name)
+		if strings.Contains(out.String(), "Unknown command") {
+			t.Errorf("builtin %q is not a command", name)
+		}
+	}
+
+	var out bytes.Buffer
+	e := newLineEditor(strings.NewReader("undec\t\tb\t\rcur\t de\t\r"), &out, "")
+	e.complete = r.complete
+	for _, want := range []string{"undecorate beta ", "cursor de"} {
+		if line, err := e.readLine("> "); line != want || err != nil {
+			t.Errorf("readLine = %q, %v; want %q", line, err, want)
+		}
+	}
+}
+
+func TestBuffers(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	os.WriteFile(a, []byte("alpha"), 0o644)
+	os.WriteFile(b, []byte("bravo!"), 0o644)
+
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	var out bytes.Buffer
+	r := New(lib, Options{Out: &out})
+	for _, cmd := range []string{"open " + a, "cursor second", "open " + b, "buffer 1"} {
+		r.runCommand(cmd)
+	}
+	if len(r.buffers) != 2 || r.Garland().ByteCount().Value != 5 || r.currentCursor != "second" {
+		t.Fatalf("after switching back: %d buffers, %d bytes, cursor %q\n%s",
+			len(r.buffers), r.Garland().ByteCount().Value, r.currentCursor, out.String())
+	}
+
+	out.Reset()
+	r.runCommand("buffers")
+	if !strings.Contains(out.String(), "> 1: "+a) || !strings.Contains(out.String(), "  2: "+b+" (6 bytes") {
+		t.Errorf("buffers:\n%s", out.String())
+	}
+
+	r.runCommand(`new "x"`) // replaces buffer 1
+	r.runCommand("close")
+	if len(r.buffers) != 1 || r.Garland().ByteCount().Value != 6 || r.currentCursor != "default" {
+		t.Errorf("after close: %d buffers, %d bytes, cursor %q", len(r.buffers), r.Garland().ByteCount().Value, r.currentCursor)
+	}
+	r.errMsg = ""
+	r.runCommand("buffer 2")
+	if r.errMsg == "" {
+		t.Error("buffer 2 of 1 did not fail")
+	}
+	r.closeAll()
+}
+
+func TestMacro(t *testing.T) {
+	script := strings.Join([]string{
+		`new "ab"`,
+		"macro record grow",
+		`insert "x"`,
+		"bogus",
+		"backdelete bytes 1",
+		`insert "yz"`,
+		"macro stop",
+		"macro play grow 1000",
+		"macro list",
+		"macro play nope",
+		"status",
+	}, "\n") + "\n"
+	out := runScript(t, true, script)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var resp []map[string]any
+	for _, line := range lines {
+		var m map[string]any
+		json.Unmarshal([]byte(line), &m)
+		resp = append(resp, m)
+	}
+	if d := resp[6]["data"].(map[string]any); d["commands"] != 3.0 {
+		t.Errorf("macro stop: %s", lines[6])
+	}
+	if resp[7]["status"] != "ok" {
+		t.Errorf("macro play: %s", lines[7])
+	}
+	if resp[9]["status"] != "error" {
+		t.Errorf("playing a missing macro: %s", lines[9])
+	}
+	// "ab" + "yz" from recording, then 1000 more "yz".
+	state := resp[10]["data"].(map[string]any)["state"].(map[string]any)
+	if state["bytes"] != 2.0+2*1001 {
+		t.Errorf("bytes after playback = %v", state["bytes"])
+	}
+
+	out = runScript(t, false, "new \"q\"\nmacro record inner\ninsert \"a\"\nmacro stop\n"+
+		"macro record outer\nmacro play inner\nseek byte 0\nmacro stop\nmacro play outer 3\ndump\n")
+	if !strings.Contains(out, "Recorded macro 'outer' (2 commands)") || !strings.Contains(out, "aaaaaq") {
+		t.Errorf("a macro playing a macro:\n%s", out)
+	}
+}
+
+func TestDiffAndLog(t *testing.T) {
+	out := runScript(t, false, strings.Join([]string{
+		`new "one\ntwo\nthree\n"`,
+		"seek line 1 0",
+		`insert "2 "`,
+		"seek line 2 0",
+		"delete bytes 6",
+		"diff -U 0 0 2",
+		"diff 1 1",
+		"log -p 2",
+	}, "\n")+"\n")
+	for _, want := range []string{
+		"\x1b[31m-three", "\x1b[32m+2 two", "\x1b[31m-two",
+		"Revisions 1 and 1 have the same content",
+		"revision 2  ", "@2:0 -6 +0 bytes", "revision 1  ", "@1:0 -0 +2 bytes",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "revision 0  ") {
+		t.Errorf("log 2 listed revision 0:\n%s", out)
+	}
+}
+
+func TestSelectionRegister(t *testing.T) {
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	var out bytes.Buffer
+	r := New(lib, Options{Out: &out})
+	text := func() string {
+		data := make([]byte, r.Garland().ByteCount().Value)
+		r.Garland().ReadAt(data, 0)
+		return string(data)
+	}
+	for _, cmd := range []string{
+		`new "hello world"`,
+		"decorate k=byte 7",
+		"select 6 11",
+		"yank -x",
+		"seek byte 0",
+		"put",
+		`insert " "`,
+	} {
+		r.runCommand(cmd)
+	}
+	if got := text(); got != "world hello " {
+		t.Fatalf("after cut and put: %q\n%s", got, out.String())
+	}
+	if pos, _ := r.Garland().GetDecorationPosition("k"); pos.Byte != 1 {
+		t.Errorf("decoration moved to %d, want 1", pos.Byte)
+	}
+
+	// A copy made with mark leaves the decoration where it is.
+	r.runCommand("seek byte 0")
+	r.runCommand("mark")
+	r.runCommand("seek byte 5")
+	r.runCommand("yank")
+	if _, _, ok := r.Cursor().SelectionRange(); ok {
+		t.Error("yank left the anchor set")
+	}
+	r.runCommand("seek byte 12")
+	r.runCommand("put")
+	if got := text(); got != "world hello world" {
+		t.Errorf("after yank and put: %q", got)
+	}
+	if pos, _ := r.Garland().GetDecorationPosition("k"); pos.Byte != 1 {
+		t.Errorf("copy moved the decoration to %d", pos.Byte)
+	}
+	r.errMsg = ""
+	r.runCommand("yank")
+	if r.errMsg == "" {
+		t.Error("yank without a selection did not fail")
+	}
+	r.closeAll()
+}
+
+func TestStreamWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.txt")
+	os.WriteFile(path, bytes.Repeat([]byte("0123456789\n"), 200), 0o644)
+
+	out := runScript(t, false, "stream "+path+" 100 1\nwatch 2\nready\n")
+	if !strings.Contains(out, "Streaming "+path+" as buffer 1") {
+		t.Errorf("stream:\n%s", out)
+	}
+	if !strings.Contains(out, "[complete] 2200 bytes, 2200 runes, 200 lines; ready") {
+		t.Errorf("watch did not run to completion:\n%s", out)
+	}
+
+	// Closing a buffer mid-stream stops its feed.
+	runScript(t, false, "stream "+path+" 1 50\nclose\n")
+}
+
+func TestRemote(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	var methods []string
+	var params []map[string]any
+	go func() {
+		results := map[string]any{
+			"open":            map[string]any{"doc": 1},
+			"insert":          map[string]any{"fork": 0, "revision": 1},
+			"cursor.position": map[string]any{"byte": 0, "rune": 0, "line": 0, "column": 0},
+			"read":            map[string]any{"text": "hi"},
+			"cursor.seek":     map[string]any{"byte": 2, "rune": 2, "line": 0, "column": 2},
+			"find":            []any{map[string]any{"start": 0, "end": 2, "text": "hi"}},
+		}
+		sc := bufio.NewScanner(server)
+		for sc.Scan() {
+			var req struct {
+				ID     int
+				Method string
+				Params map[string]any
+			}
+			json.Unmarshal(sc.Bytes(), &req)
+			methods, params = append(methods, req.Method), append(params, req.Params)
+			resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+			if res, ok := results[req.Method]; ok {
+				resp["result"] = res
+			} else {
+				resp["error"] = map[string]any{"code": -32000, "message": "unknown method " + req.Method}
+			}
+			b, _ := json.Marshal(resp)
+			server.Write(append(b, '\n'))
+		}
+	}()
+
+	lib, err := garland.Init(garland.LibraryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	script := "insert \"x\"\nnew \"hi\"\ninsert- \"a\\tb\"\nread bytes 2\nfind \"HI\" -i\nbogus\n"
+	r := New(lib, Options{In: strings.NewReader(script), Out: &out, Remote: client})
+	r.Run()
+	got := out.String()
+
+	for _, want := range []string{
+		"no document is open",
+		"Opened remote document 1",
+		"Inserted 3 bytes. Now at fork=0, revision=1",
+		`Read 2 bytes: "hi"`,
+		`Match at [0, 2): "hi"`,
+		"Unknown command: bogus",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	if want := []string{"open", "insert", "cursor.position", "read", "cursor.seek", "find"}; !reflect.DeepEqual(methods, want) {
+		t.Fatalf("methods = %q, want %q", methods, want)
+	}
+	if p := params[1]; p["doc"] != 1.0 || p["cursor"] != "main" || p["text"] != "a\tb" || p["before"] != true {
+		t.Errorf("insert params = %v", p)
+	}
+	if p := params[4]; p["byte"] != 2.0 {
+		t.Errorf("read did not advance the cursor: %v", p)
+	}
+	if p := params[5]; p["caseSensitive"] != false || p["all"] != false {
+		t.Errorf("find params = %v", p)
+	}
+}
+
+func TestRemoteAttach(t *testing.T) {
+	lib, _ := garland.Init(garland.LibraryOptions{})
+	live, _ := lib.Open(garland.FileOptions{DataString: "live text"})
+	defer live.Close()
+	srv := garlandrpc.NewServer(lib)
+	srv.Publish("app", live)
+	client, server := net.Pipe()
+	go srv.Serve(server, server)
+	defer client.Close()
+
+	var out bytes.Buffer
+	script := "docs\nattach app\nseek byte 4\ninsert \"ly\"\nnew \"own\"\nbuffer 1\ncursor\nclose\nattach ghost\n"
+	New(lib, Options{In: strings.NewReader(script), Out: &out, Remote: client}).Run()
+	got := out.String()
+	for _, want := range []string{
+		"app                  9 bytes, 0 lines",
+		"Attached to 'app' as remote document 1 (cursor 'remote-1')",
+		"Inserted 2 bytes",
+		"Opened remote document 2",
+		"Cursor 'remote-1': byte=6",
+		"Remote document closed",
+		`no published document "ghost"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	// The edit landed in the application's garland, and detaching left
+	// it open with only its own cursors.
+	buf := make([]byte, 32)
+	n, _ := live.ReadAt(buf, 0)
+	if string(buf[:n]) != "lively text" || len(live.CursorsInOrder()) != 0 {
+		t.Errorf("live document %q with %d cursors", buf[:n], len(live.CursorsInOrder()))
+	}
+}
+
+func TestConfig(t *testing.T) {
+	rc := "# settings\nset maxleafsize 1K\nset softlimit 64M\nalias ins insert\nalias hi insert \"hi \"\nnew \"abc\"\n"
+	cfg, err := ParseConfig(strings.NewReader(rc), "rc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Open.MaxLeafSize != 1024 || cfg.Library.MemorySoftLimit != 64<<20 {
+		t.Errorf("settings: leaf %d, soft limit %d", cfg.Open.MaxLeafSize, cfg.Library.MemorySoftLimit)
+	}
+	if want := []string{`new "abc"`}; !reflect.DeepEqual(cfg.Startup, want) {
+		t.Errorf("startup = %q, want %q", cfg.Startup, want)
+	}
+	if _, err := ParseConfig(strings.NewReader("\nset bogus 1\n"), "rc"); err == nil || !strings.HasPrefix(err.Error(), "rc:2:") {
+		t.Errorf("unknown setting: %v", err)
+	}
+	if cfg, err := LoadConfig(filepath.Join(t.TempDir(), "missing")); err != nil || cfg.Startup != nil {
+		t.Errorf("missing file: %+v, %v", cfg, err)
+	}
+
+	lib, err := garland.Init(cfg.Library)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	script := "HI\nins \"x\"\nalias\nunalias ins\nins \"y\"\nset softlimit 1M\nset maxleafsize 2K\nset\n"
+	r := New(lib, Options{In: strings.NewReader(script), Out: &out, Config: cfg})
+	r.Run()
+	got := out.String()
+	for _, want := range []string{
+		"Created new garland with 3 bytes",
+		"Inserted 3 bytes",
+		"Inserted 1 bytes",
+		`  hi = insert "hi "`,
+		"Unknown command: ins",
+		"softlimit applies when the library starts",
+		"maxleafsize = 2048",
+		"  softlimit    67108864",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	if _, ok := cfg.Aliases["ins"]; !ok {
+		t.Error("unalias changed the caller's Config")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	out := runScript(t, false, "new \"hello world\"\ntrace on\nseek byte 5\ninsert \",\"\ntrace off\nseek byte 0\n")
+	if !strings.Contains(out, "Trace is on") || !strings.Contains(out, "Trace is off") {
+		t.Errorf("trace on/off:\n%s", out)
+	}
+	if n := strings.Count(out, "trace: "); n != 2 {
+		t.Errorf("%d trace lines, want 2:\n%s", n, out)
+	}
+	if !strings.Contains(out, "nodes visited, 0 created, 0 snapshots copied") {
+		t.Errorf("seek trace:\n%s", out)
+	}
+
+	out = runScript(t, true, "new \"abc\"\ntrace on\ninsert \"x\"\n")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var resp struct{ Data map[string]any }
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &resp); err != nil {
+		t.Fatal(err)
+	}
+	trace, ok := resp.Data["trace"].(map[string]any)
+	if !ok || trace["created"].(float64) == 0 {
+		t.Errorf("insert trace data: %v", resp.Data["trace"])
+	}
+}
@@ -0,0 +1,173 @@
+package garlandrepl
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/phroun/garland"
+)
+
+// defaultContext is how many unchanged lines diff shows around changes.
+const defaultContext = 3
+
+// parseContextFlag strips a leading -U <n> from args, returning the
+// context line count (defaultContext without the flag).
+func parseContextFlag(args []string) (int, []string, error) {
+	if len(args) < 2 || args[0] != "-U" {
+		return defaultContext, args, nil
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		return 0, nil, strconv.ErrSyntax
+	}
+	return n, args[2:], nil
+}
+
+// parseRevision parses a revision number argument.
+func parseRevision(s string) (garland.RevisionID, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	return garland.RevisionID(n), err
+}
+
+// cmdDiff shows the change between two revisions of the current fork's
+// lineage as a colored unified diff: diff [-U n] <revA> [revB], revB
+// being the current revision when omitted.
+func (r *REPL) cmdDiff(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+	ctx, args, err := parseContextFlag(args)
+	if err != nil || len(args) < 1 || len(args) > 2 {
+		r.errorln("Usage: diff [-U <context>] <revA> [revB]")
+		return
+	}
+	from, err := parseRevision(args[0])
+	if err != nil {
+		r.errorf("Error: invalid revision: %s\n", args[0])
+		return
+	}
+	to := r.garland.CurrentRevision()
+	if len(args) == 2 {
+		if to, err = parseRevision(args[1]); err != nil {
+			r.errorf("Error: invalid revision: %s\n", args[1])
+			return
+		}
+	}
+	text, err := r.renderDiff(from, to, ctx)
+	if err != nil {
+		r.errorf("Error: %v\n", err)
+		return
+	}
+	if text == "" {
+		r.printf("Revisions %d and %d have the same content\n", from, to)
+	} else {
+		r.print(text)
+	}
+	r.set("changed", text != "")
+}
+
+// renderDiff renders the diff from one revision to another.
+func (r *REPL) renderDiff(from, to garland.RevisionID, ctx int) (string, error) {
+	var buf bytes.Buffer
+	err := r.garland.RenderRevisionDiff(&buf, from, to, garland.DiffRenderOptions{ContextLines: ctx})
+	return buf.String(), err
+}
+
+// cmdLog lists the newest revisions of the current fork's lineage, each
+// with what its edits changed: log [-p] [-U n] [count]. -p adds each
+// revision's diff against the one before it.
+func (r *REPL) cmdLog(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+	patch := len(args) > 0 && args[0] == "-p"
+	if patch {
+		args = args[1:]
+	}
+	ctx, args, err := parseContextFlag(args)
+	count := 10
+	if err == nil && len(args) == 1 {
+		count, err = strconv.Atoi(args[0])
+	}
+	if err != nil || len(args) > 1 || count < 1 {
+		r.errorln("Usage: log [-p] [-U <context>] [count]")
+		return
+	}
+
+	g := r.garland
+	forkInfo, err := g.GetForkInfo(g.CurrentFork())
+	if err != nil {
+		r.errorf("Error getting fork info: %v\n", err)
+		return
+	}
+	first := forkInfo.PrunedUpTo
+	if span := garland.RevisionID(count - 1); forkInfo.HighestRevision-first > span {
+		first = forkInfo.HighestRevision - span
+	}
+	revisions, err := g.GetRevisionRange(first, forkInfo.HighestRevision)
+	if err != nil {
+		r.errorf("Error getting revisions: %v\n", err)
+		return
+	}
+
+	current := g.CurrentRevision()
+	var list []map[string]any
+	for i := len(revisions) - 1; i >= 0; i-- {
+		info := revisions[i]
+		marker := "  "
+		if info.Revision == current {
+			marker = "> "
+		}
+		name := info.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		when := ""
+		if !info.Time.IsZero() {
+			when = info.Time.Format("2006-01-02 15:04:05") + "  "
+		}
+		summary := r.editSummary(info.Revision)
+		r.printf("%srevision %d  %s%s%s\n", marker, info.Revision, when, name, summary)
+		list = append(list, map[string]any{"revision": info.Revision, "name": info.Name, "summary": strings.TrimSpace(summary)})
+
+		if patch && info.Revision > forkInfo.PrunedUpTo {
+			text, err := r.renderDiff(info.Revision-1, info.Revision, ctx)
+			if err != nil {
+				r.errorf("Error: %v\n", err)
+				return
+			}
+			r.print(text)
+			r.println()
+		}
+	}
+	r.set("revisions", list)
+}
+
+// editSummary describes what revision rev changed from the one before
+// it: where it starts, how many bytes went and came, and in how many
+// places.
+func (r *REPL) editSummary(rev garland.RevisionID) string {
+	if rev == 0 {
+		return ""
+	}
+	edits, err := r.garland.InputEditsBetween(rev-1, rev)
+	if err != nil {
+		return ""
+	}
+	if len(edits) == 0 {
+		return "  (no change)"
+	}
+	var gone, came int64
+	for _, e := range edits {
+		gone += e.OldEndByte - e.StartByte
+		came += e.NewEndByte - e.StartByte
+	}
+	e := edits[0]
+	summary := fmt.Sprintf("  @%d:%d -%d +%d bytes", e.StartPoint.Row, e.StartPoint.Column, gone, came)
+	if len(edits) > 1 {
+		summary += fmt.Sprintf(" in %d places", len(edits))
+	}
+	return summary
+}
@@ -0,0 +1,370 @@
+package garlandrepl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxHistory is how many commands the history keeps, in memory and in
+// the history file.
+const maxHistory = 1000
+
+// errInterrupted is readLine's result for Ctrl-C; the shell drops the
+// line and prompts again.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads command lines from a terminal with readline-style
+// editing: cursor motion, history recall on the arrow keys, and
+// incremental reverse search on Ctrl-R, and completion on Tab. It expects the terminal in raw
+// mode (see makeRaw) and draws the prompt itself.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  []string
+	histFile string // appended to as commands are entered; "" for none
+
+	// complete, if set, is Tab: the words that can replace the one
+	// ending line, and where it starts.
+	complete func(line string) (start int, words []string)
+}
+
+// newLineEditor returns an editor over in and out, with the history in
+// histFile loaded.
+func newLineEditor(in io.Reader, out io.Writer, histFile string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(in), out: out, histFile: histFile}
+	e.loadHistory()
+	return e
+}
+
+// loadHistory reads the history file, keeping its last maxHistory
+// lines. A missing or unreadable file is an empty history.
+func (e *lineEditor) loadHistory() {
+	if e.histFile == "" {
+		return
+	}
+	data, err := os.ReadFile(e.histFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+		e.saveHistory()
+	}
+}
+
+// saveHistory rewrites the history file with the in-memory history.
+func (e *lineEditor) saveHistory() {
+	os.WriteFile(e.histFile, []byte(strings.Join(e.history, "\n")+"\n"), 0o600)
+}
+
+// addHistory records an entered line, skipping a repeat of the last.
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+		if e.histFile != "" {
+			e.saveHistory()
+		}
+		return
+	}
+	if e.histFile == "" {
+		return
+	}
+	if f, err := os.OpenFile(e.histFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600); err == nil {
+		fmt.Fprintln(f, line)
+		f.Close()
+	}
+}
+
+// Keys readLine acts on, after escape sequences are decoded.
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyCtrlG     = 0x07
+	keyBackspace = 0x08
+	keyCtrlK     = 0x0b
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlR     = 0x12
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEscape    = 0x1b
+	keyDel       = 0x7f
+)
+
+// Decoded escape sequences, above every rune.
+const (
+	keyUp rune = unicode.MaxRune + 1 + iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// readKey returns the next key, decoding the terminal's escape
+// sequences for the arrow and editing keys.
+func (e *lineEditor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+	if e.in.Buffered() == 0 {
+		return keyEscape, nil // a lone Esc
+	}
+	intro, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if intro != '[' && intro != 'O' {
+		return keyUnknown, nil
+	}
+	var param []rune
+	for {
+		c, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if c >= '0' && c <= '9' || c == ';' {
+			param = append(param, c)
+			continue
+		}
+		switch {
+		case c == 'A':
+			return keyUp, nil
+		case c == 'B':
+			return keyDown, nil
+		case c == 'C':
+			return keyRight, nil
+		case c == 'D':
+			return keyLeft, nil
+		case c == 'H':
+			return keyHome, nil
+		case c == 'F':
+			return keyEnd, nil
+		case c == '~':
+			switch string(param) {
+			case "1", "7":
+				return keyHome, nil
+			case "4", "8":
+				return keyEnd, nil
+			case "3":
+				return keyDelete, nil
+			}
+		}
+		return keyUnknown, nil
+	}
+}
+
+// readLine prompts and reads one line. Ctrl-C gives errInterrupted,
+// and Ctrl-D on an empty line io.EOF.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	var line []rune
+	pos := 0
+	hist := len(e.history) // history entry shown; len for the new line
+	var saved []rune       // the new line, while browsing history
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	recall := func(i int) {
+		if hist == len(e.history) {
+			saved = line
+		}
+		hist = i
+		if i == len(e.history) {
+			line = saved
+		} else {
+			line = []rune(e.history[i])
+		}
+		pos = len(line)
+	}
+
+	redraw()
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		if key == keyCtrlR {
+			if key, err = e.search(&line, &pos); err != nil {
+				return "", err
+			}
+			hist = len(e.history)
+			if key == keyUnknown {
+				redraw()
+				continue
+			}
+		}
+		switch key {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			s := string(line)
+			e.addHistory(strings.TrimSpace(s))
+			return s, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos:pos], line[pos+1:]...)
+			}
+		case keyDelete:
+			if pos < len(line) {
+				line = append(line[:pos:pos], line[pos+1:]...)
+			}
+		case keyBackspace, keyDel:
+			if pos > 0 {
+				line = append(line[:pos-1:pos-1], line[pos:]...)
+				pos--
+			}
+		case keyLeft, keyCtrlB:
+			pos = max(pos-1, 0)
+		case keyRight, keyCtrlF:
+			pos = min(pos+1, len(line))
+		case keyHome, keyCtrlA:
+			pos = 0
+		case keyEnd, keyCtrlE:
+			pos = len(line)
+		case keyCtrlK:
+			line = line[:pos]
+		case keyCtrlU:
+			line, pos = line[pos:], 0
+		case keyCtrlW:
+			i := pos
+			for i > 0 && line[i-1] == ' ' {
+				i--
+			}
+			for i > 0 && line[i-1] != ' ' {
+				i--
+			}
+			line, pos = append(line[:i:i], line[pos:]...), i
+		case '\t':
+			if e.complete == nil {
+				line = append(line[:pos], append([]rune{key}, line[pos:]...)...)
+				pos++
+				break
+			}
+			line, pos = e.completeAt(line, pos)
+		case keyUp, keyCtrlP:
+			if hist > 0 {
+				recall(hist - 1)
+			}
+		case keyDown, keyCtrlN:
+			if hist < len(e.history) {
+				recall(hist + 1)
+			}
+		default:
+			if unicode.IsPrint(key) {
+				line = append(line[:pos], append([]rune{key}, line[pos:]...)...)
+				pos++
+			}
+		}
+		redraw()
+	}
+}
+
+// completeAt completes the word before pos: a single match replaces
+// it, several extend it to their common prefix or, when that adds
+// nothing, are listed below the prompt.
+func (e *lineEditor) completeAt(line []rune, pos int) ([]rune, int) {
+	start, words := e.complete(string(line[:pos]))
+	prefix := []rune(string(line[:pos])[start:])
+	at := pos - len(prefix)
+	var repl string
+	switch len(words) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+		return line, pos
+	case 1:
+		repl = words[0] + " "
+	default:
+		repl = words[0]
+		for _, w := range words[1:] {
+			for !strings.HasPrefix(w, repl) {
+				_, n := utf8.DecodeLastRuneInString(repl)
+				repl = repl[:len(repl)-n]
+			}
+		}
+		if len([]rune(repl)) <= len(prefix) {
+			fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(words, "  "))
+			return line, pos
+		}
+	}
+	r := []rune(repl)
+	return append(append(append([]rune{}, line[:at]...), r...), line[pos:]...), at + len(r)
+}
+
+// search runs a Ctrl-R reverse incremental search through the history,
+// leaving the match in line. It returns the key that ended the search
+// for readLine to act on - Enter runs the match, a motion key starts
+// editing it - or keyUnknown when the key was consumed: Esc keeps the
+// match, Ctrl-G and Ctrl-C restore the line.
+func (e *lineEditor) search(line *[]rune, pos *int) (rune, error) {
+	orig := *line
+	var query []rune
+	at := len(e.history) // the matching entry; len for none yet
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				at, *line = i, []rune(e.history[i])
+				*pos = len(*line)
+				return
+			}
+		}
+	}
+	for {
+		fmt.Fprintf(e.out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), string(*line))
+		key, err := e.readKey()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case key == keyCtrlR:
+			find(at - 1)
+		case key == keyBackspace || key == keyDel:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history) - 1)
+			}
+		case key == keyCtrlG || key == keyCtrlC:
+			*line = orig
+			*pos = len(orig)
+			return keyUnknown, nil
+		case key == keyEscape:
+			return keyUnknown, nil
+		case key > unicode.MaxRune || key < ' ':
+			return key, nil
+		default:
+			query = append(query, key)
+			find(min(at, len(e.history)-1))
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package garlandrepl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// record adds a top-level command line to the macro being recorded,
+// unless it failed or is macro record or stop.
+func (r *REPL) record(input string) {
+	if r.recording == "" || r.errMsg != "" {
+		return
+	}
+	if f := strings.Fields(strings.ToLower(input)); len(f) > 0 && f[0] == "macro" && (len(f) < 2 || f[1] != "play") {
+		return
+	}
+	r.recorded = append(r.recorded, input)
+}
+
+// cmdMacro records and plays back command sequences. It returns false
+// when a played macro quit the session.
+func (r *REPL) cmdMacro(args []string) bool {
+	if len(args) == 0 {
+		r.errorln("Usage: macro record <name> | macro stop | macro play <name> [count] | macro list")
+		return true
+	}
+	switch strings.ToLower(args[0]) {
+	case "record":
+		if len(args) != 2 {
+			r.errorln("Usage: macro record <name>")
+			return true
+		}
+		if r.recording != "" {
+			r.errorf("Error: already recording macro '%s'\n", r.recording)
+			return true
+		}
+		r.recording, r.recorded = args[1], nil
+		r.printf("Recording macro '%s' (macro stop to finish)\n", args[1])
+
+	case "stop":
+		if r.recording == "" {
+			r.errorln("Error: not recording a macro")
+			return true
+		}
+		r.macros[r.recording] = r.recorded
+		r.printf("Recorded macro '%s' (%d commands)\n", r.recording, len(r.recorded))
+		r.set("commands", len(r.recorded))
+		r.recording, r.recorded = "", nil
+
+	case "play":
+		return r.playMacro(args[1:])
+
+	case "list":
+		names := r.macroNames()
+		if len(names) == 0 {
+			r.println("No macros recorded")
+		}
+		for _, name := range names {
+			r.printf("  %s (%d commands)\n", name, len(r.macros[name]))
+		}
+		r.set("macros", names)
+
+	default:
+		r.errorf("Unknown macro subcommand: %s\n", args[0])
+	}
+	return true
+}
+
+// playMacro runs a macro count times, stopping at the first command
+// that fails unless KeepGoing.
+func (r *REPL) playMacro(args []string) bool {
+	if len(args) < 1 || len(args) > 2 {
+		r.errorln("Usage: macro play <name> [count]")
+		return true
+	}
+	name := args[0]
+	lines, ok := r.macros[name]
+	if !ok {
+		r.errorf("Error: no macro '%s'\n", name)
+		return true
+	}
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			r.errorf("Error: invalid count: %s\n", args[1])
+			return true
+		}
+		count = n
+	}
+	if r.sourceDepth >= maxSourceDepth {
+		r.errorln("Error: source or macro play nested too deeply")
+		return true
+	}
+
+	script := strings.Join(lines, "\n")
+	r.sourceDepth++
+	defer func() { r.sourceDepth-- }()
+	var firstErr error
+	for i := range count {
+		quit, err := r.execScript(strings.NewReader(script), "macro "+name, r.handleCommand)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("pass %d: %w", i+1, err)
+		}
+		if quit {
+			return false
+		}
+		if firstErr != nil && !r.keepGoing {
+			break
+		}
+	}
+	if firstErr != nil {
+		r.errMsg = firstErr.Error() // a later command may have cleared it
+		return true
+	}
+	r.printf("Played macro '%s' %d times\n", name, count)
+	return true
+}
+
+// macroNames returns the recorded macros' names, sorted.
+func (r *REPL) macroNames() []string {
+	names := make([]string, 0, len(r.macros))
+	for name := range r.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,509 @@
+package garlandrepl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// remoteCursor is the cursor every server document opens with.
+const remoteCursor = "main"
+
+// remoteConn is a connection to a garland-server (garlandrpc) session.
+// Its documents are the ones opened or attached over it - the server
+// scopes handles to the connection - the current one addressed by
+// handle and its cursor by name.
+type remoteConn struct {
+	in      *bufio.Reader
+	out     io.Writer
+	next    int            // last request id
+	doc     int            // current document handle; 0 for none
+	cursor  string         // current cursor
+	cursors map[int]string // each document's last cursor
+}
+
+// switchTo makes doc current with cursor, remembering the cursor of
+// the document left.
+func (c *remoteConn) switchTo(doc int, cursor string) {
+	if c.cursors == nil {
+		c.cursors = make(map[int]string)
+	}
+	if c.doc != 0 {
+		c.cursors[c.doc] = c.cursor
+	}
+	c.doc, c.cursor = doc, cursor
+}
+
+// remoteError is an error response from the server.
+type remoteError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *remoteError) Error() string { return e.Message }
+
+// call sends one request and decodes its result into result (which may
+// be nil).
+func (c *remoteConn) call(method string, params map[string]any, result any) error {
+	c.next++
+	req, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": c.next, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	if _, err := c.out.Write(append(req, '\n')); err != nil {
+		return err
+	}
+	line, err := c.in.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("connection: %w", err)
+	}
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *remoteError    `json:"error"`
+	}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return fmt.Errorf("bad response: %w", err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result != nil {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
+
+// docCall calls a method on the current document and, unless params
+// names one, the current cursor.
+func (c *remoteConn) docCall(method string, params map[string]any, result any) error {
+	if c.doc == 0 {
+		return fmt.Errorf("no document is open (use new, open or attach)")
+	}
+	if params == nil {
+		params = map[string]any{}
+	}
+	params["doc"] = c.doc
+	if _, ok := params["cursor"]; !ok {
+		params["cursor"] = c.cursor
+	}
+	return c.call(method, params, result)
+}
+
+// remoteVersion is an editing method's result.
+type remoteVersion struct {
+	Fork     uint64 `json:"fork"`
+	Revision uint64 `json:"revision"`
+}
+
+// handleRemote runs a built-in command against the server: the core
+// commands translate to server methods, and call sends any method.
+func (r *REPL) handleRemote(cmd string, args []string) bool {
+	c := r.remote
+	fail := func(err error) { r.errorf("Error: %v\n", err) }
+	edited := func(what string, v remoteVersion) {
+		r.printf("%s. Now at fork=%d, revision=%d\n", what, v.Fork, v.Revision)
+		r.set("fork", v.Fork)
+		r.set("revision", v.Revision)
+	}
+	rest := strings.TrimSpace(strings.Join(args, " "))
+
+	switch cmd {
+	case "help":
+		r.print(remoteHelp)
+		r.printRegisteredHelp()
+
+	case "quit", "exit":
+		r.println("Goodbye!")
+		return false
+
+	case "new", "open":
+		params := map[string]any{"path": rest}
+		if cmd == "new" {
+			text, _, err := r.parseQuotedString(rest)
+			if err != nil {
+				r.errorln("Usage: new \"text content\"")
+				return true
+			}
+			params = map[string]any{"text": text}
+		}
+		var res struct{ Doc int }
+		if err := c.call("open", params, &res); err != nil {
+			fail(err)
+			return true
+		}
+		c.switchTo(res.Doc, remoteCursor)
+		r.printf("Opened remote document %d\n", res.Doc)
+		r.set("doc", res.Doc)
+
+	case "docs":
+		var docs []struct {
+			Name           string
+			Bytes, Lines   int64
+			Fork, Revision uint64
+		}
+		if err := c.call("list", nil, &docs); err != nil {
+			fail(err)
+			return true
+		}
+		if len(docs) == 0 {
+			r.println("No published documents")
+		}
+		for _, d := range docs {
+			r.printf("  %-20s %d bytes, %d lines (fork=%d, revision=%d)\n", d.Name, d.Bytes, d.Lines, d.Fork, d.Revision)
+		}
+		r.set("docs", docs)
+
+	case "attach":
+		if rest == "" {
+			r.errorln("Usage: attach <name>")
+			return true
+		}
+		var res struct {
+			Doc    int
+			Cursor string
+		}
+		if err := c.call("attach", map[string]any{"name": rest}, &res); err != nil {
+			fail(err)
+			return true
+		}
+		c.switchTo(res.Doc, res.Cursor)
+		r.printf("Attached to '%s' as remote document %d (cursor '%s')\n", rest, res.Doc, res.Cursor)
+		r.set("doc", res.Doc)
+		r.set("cursor", res.Cursor)
+
+	case "buffer":
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 1 {
+			r.errorln("Usage: buffer <doc>")
+			return true
+		}
+		cursor, ok := c.cursors[n]
+		if !ok {
+			cursor = remoteCursor
+		}
+		c.switchTo(n, cursor)
+		r.printf("Switched to remote document %d\n", n)
+
+	case "close":
+		if err := c.docCall("close", nil, nil); err != nil {
+			fail(err)
+			return true
+		}
+		delete(c.cursors, c.doc)
+		c.doc = 0
+		r.println("Remote document closed")
+
+	case "save":
+		var res struct{ Scars int }
+		if err := c.docCall("save", nil, &res); err != nil {
+			fail(err)
+			return true
+		}
+		r.printf("Saved (%d scars)\n", res.Scars)
+
+	case "status":
+		var info map[string]any
+		if err := c.docCall("info", nil, &info); err != nil {
+			fail(err)
+			return true
+		}
+		r.printf("Remote document %d:\n", c.doc)
+		r.printf("  Bytes: %v, Runes: %v, Lines: %v (complete: %v)\n", info["bytes"], info["runes"], info["lines"], info["complete"])
+		r.printf("  Fork: %v, Revision: %v\n", info["fork"], info["revision"])
+		for k, v := range info {
+			r.set(k, v)
+		}
+
+	case "cursor":
+		if rest != "" {
+			if err := c.docCall("cursor.new", map[string]any{"cursor": rest}, nil); err != nil && !strings.Contains(err.Error(), "exists") {
+				fail(err)
+				return true
+			}
+			c.cursor = rest
+		}
+		pos, err := r.remotePosition()
+		if err != nil {
+			fail(err)
+			return true
+		}
+		r.printf("Cursor '%s': byte=%d, rune=%d, line=%d:%d\n", c.cursor, pos["byte"], pos["rune"], pos["line"], pos["column"])
+
+	case "seek":
+		if len(args) < 2 {
+			r.errorln("Usage: seek byte|rune <pos> | seek line <line> <rune>")
+			return true
+		}
+		params := map[string]any{}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		switch {
+		case err != nil:
+		case args[0] == "byte" || args[0] == "rune":
+			params[args[0]] = n
+		case args[0] == "line" && len(args) == 3:
+			params["line"] = n
+			params["column"], err = strconv.ParseInt(args[2], 10, 64)
+		default:
+			err = fmt.Errorf("unknown seek mode: %s", args[0])
+		}
+		var pos map[string]int64
+		if err == nil {
+			err = c.docCall("cursor.seek", params, &pos)
+		}
+		if err != nil {
+			fail(err)
+			return true
+		}
+		r.printf("Cursor moved to byte=%d, rune=%d, line=%d:%d\n", pos["byte"], pos["rune"], pos["line"], pos["column"])
+
+	case "read":
+		if len(args) != 2 || args[0] != "bytes" {
+			r.errorln("Usage: read bytes <length>")
+			return true
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fail(err)
+			return true
+		}
+		pos, err := r.remotePosition()
+		if err != nil {
+			fail(err)
+			return true
+		}
+		var res struct{ Text string }
+		if err := c.docCall("read", map[string]any{"start": pos["byte"], "length": n}, &res); err != nil {
+			fail(err)
+			return true
+		}
+		if err := c.docCall("cursor.seek", map[string]any{"byte": pos["byte"] + int64(len(res.Text))}, nil); err != nil {
+			fail(err)
+			return true
+		}
+		r.printf("Read %d bytes: %q\n", len(res.Text), res.Text)
+		r.set("text", res.Text)
+
+	case "dump":
+		var info struct{ Bytes int64 }
+		var res struct{ Text string }
+		err := c.docCall("info", nil, &info)
+		if err == nil {
+			err = c.docCall("read", map[string]any{"start": 0, "length": info.Bytes}, &res)
+		}
+		if err != nil {
+			fail(err)
+			return true
+		}
+		r.println("Content:")
+		r.println("--------")
+		r.println(res.Text)
+		r.println("--------")
+		r.set("text", res.Text)
+
+	case "insert", "insert-":
+		text, _, err := r.parseQuotedString(rest)
+		if err != nil {
+			r.errorf("Parse error: %v\n", err)
+			return true
+		}
+		var v remoteVersion
+		if err := c.docCall("insert", map[string]any{"text": text, "before": cmd == "insert-"}, &v); err != nil {
+			fail(err)
+			return true
+		}
+		edited(fmt.Sprintf("Inserted %d bytes", len(text)), v)
+
+	case "delete":
+		if len(args) != 2 || args[0] != "bytes" {
+			r.errorln("Usage: delete bytes <length>")
+			return true
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		var v remoteVersion
+		if err == nil {
+			err = c.docCall("delete", map[string]any{"length": n}, &v)
+		}
+		if err != nil {
+			fail(err)
+			return true
+		}
+		edited(fmt.Sprintf("Deleted %d bytes", n), v)
+
+	case "overwrite":
+		if len(args) < 2 {
+			r.errorln("Usage: overwrite <len> \"text\"")
+			return true
+		}
+		n, err := strconv.ParseInt(args[0], 10, 64)
+		var text string
+		if err == nil {
+			text, _, err = r.parseQuotedString(strings.Join(args[1:], " "))
+		}
+		var v remoteVersion
+		if err == nil {
+			err = c.docCall("overwrite", map[string]any{"length": n, "text": text}, &v)
+		}
+		if err != nil {
+			fail(err)
+			return true
+		}
+		edited(fmt.Sprintf("Overwrote %d bytes with %d bytes", n, len(text)), v)
+
+	case "find", "findall", "findregex", "findregexall":
+		opts, rest := parseSearchFlags(args)
+		pattern, _, err := r.parseQuotedString(strings.Join(rest, " "))
+		if err != nil {
+			r.errorf("Usage: %s \"pattern\" [-i] [-w] [-b]\n", cmd)
+			return true
+		}
+		var matches []struct {
+			Start, End int64
+			Text       string
+		}
+		if err := c.docCall("find", map[string]any{
+			"pattern": pattern, "regex": strings.Contains(cmd, "regex"), "all": strings.HasSuffix(cmd, "all"),
+			"caseSensitive": opts.CaseSensitive, "wholeWord": opts.WholeWord, "backward": opts.Backward,
+		}, &matches); err != nil {
+			fail(err)
+			return true
+		}
+		if len(matches) == 0 {
+			r.println("Not found")
+		}
+		for _, m := range matches {
+			r.printf("Match at [%d, %d): %q\n", m.Start, m.End, m.Text)
+		}
+		r.set("count", len(matches))
+
+	case "decorate", "undecorate":
+		var entries []map[string]any
+		for _, spec := range strings.Split(rest, ",") {
+			key, at, _ := strings.Cut(strings.TrimSpace(spec), "=")
+			entry := map[string]any{"key": key}
+			if cmd == "decorate" && at != "nil" {
+				pos, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(at, "byte ")), 10, 64)
+				if err != nil || key == "" {
+					r.errorln("Usage: decorate key=byte <pos>[, key2=byte <pos>] | decorate key=nil")
+					return true
+				}
+				entry["byte"] = pos
+			}
+			entries = append(entries, entry)
+		}
+		var v remoteVersion
+		if err := c.docCall("decorate", map[string]any{"entries": entries}, &v); err != nil {
+			fail(err)
+			return true
+		}
+		edited(fmt.Sprintf("Applied %d decoration(s)", len(entries)), v)
+
+	case "decoration":
+		var res struct{ Byte int64 }
+		if err := c.docCall("decoration", map[string]any{"key": rest}, &res); err != nil {
+			fail(err)
+			return true
+		}
+		r.printf("Decoration '%s' at byte %d\n", rest, res.Byte)
+		r.set("byte", res.Byte)
+
+	case "tx", "transaction":
+		sub := ""
+		if len(args) > 0 {
+			sub = args[0]
+		}
+		var err error
+		switch sub {
+		case "start":
+			err = c.docCall("transaction.start", map[string]any{"name": strings.Join(args[1:], " ")}, nil)
+		case "commit":
+			var v remoteVersion
+			if err = c.docCall("transaction.commit", nil, &v); err == nil {
+				edited("Transaction committed", v)
+				return true
+			}
+		case "rollback":
+			err = c.docCall("transaction.rollback", nil, nil)
+		default:
+			r.errorln("Usage: tx start [name] | tx commit | tx rollback")
+			return true
+		}
+		if err != nil {
+			fail(err)
+			return true
+		}
+		r.printf("Transaction %s\n", map[string]string{"start": "started", "rollback": "rolled back"}[sub])
+
+	case "undoseek", "fork":
+		n, err := strconv.ParseUint(rest, 10, 64)
+		if err == nil && cmd == "undoseek" {
+			err = c.docCall("undoSeek", map[string]any{"revision": n}, nil)
+		} else if err == nil {
+			err = c.docCall("forkSeek", map[string]any{"fork": n}, nil)
+		}
+		if err != nil {
+			fail(err)
+			return true
+		}
+		r.printf("Now at %s %d\n", map[string]string{"undoseek": "revision", "fork": "fork"}[cmd], n)
+
+	case "call":
+		method, params, _ := strings.Cut(rest, " ")
+		var p map[string]any
+		if strings.TrimSpace(params) != "" {
+			if err := json.Unmarshal([]byte(params), &p); err != nil {
+				r.errorf("Error: params must be a JSON object: %v\n", err)
+				return true
+			}
+		}
+		var res json.RawMessage
+		if err := c.call(method, p, &res); err != nil {
+			fail(err)
+			return true
+		}
+		r.println(string(res))
+		r.set("result", res)
+
+	default:
+		r.errorf("Unknown command: %s. Type 'help' for the commands available remotely.\n", cmd)
+	}
+	return true
+}
+
+// remotePosition returns the current cursor's position.
+func (r *REPL) remotePosition() (map[string]int64, error) {
+	var pos map[string]int64
+	err := r.remote.docCall("cursor.position", nil, &pos)
+	return pos, err
+}
+
+const remoteHelp = `
+Remote Commands (connected to garland-server):
+----------------------------------------------
+  docs                      List the documents the server publishes
+  attach <name>             Attach to a published document (with a cursor of its own)
+  new "text"                Open a remote document with the given content
+  open <filepath>           Open a file (a path on the server) as a remote document
+  buffer <doc>              Switch to remote document <doc>
+  close                     Close the current remote document (detach if attached)
+  save                      Save the current remote document
+  status                    Show counts and version
+  cursor [name]             Show the cursor; with a name, switch to (or create) it
+  seek byte|rune <pos>      Move the cursor
+  seek line <line> <rune>   Move the cursor to line:rune
+  read bytes <length>       Read from the cursor (advances cursor)
+  dump                      Show the whole content
+  insert "text"             Insert at the cursor (insert- inserts before)
+  delete bytes <length>     Delete forward from the cursor
+  overwrite <len> "text"    Replace <len> bytes at the cursor
+  find "x" [-i -w -b]       Find (also findall, findregex, findregexall)
+  decorate k=byte <pos>     Set decorations (k=nil, or undecorate k, removes)
+  decoration <key>          Show a decoration's position
+  tx start [name] | tx commit | tx rollback
+  undoseek <revision>       Seek to a revision
+  fork <id>                 Switch fork
+  call <method> [json]      Send any server method with JSON params
+  help, quit, exit
+`
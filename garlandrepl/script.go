@@ -0,0 +1,85 @@
+package garlandrepl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxSourceDepth bounds source files and macros running one another.
+const maxSourceDepth = 16
+
+// RunScript runs the commands in in non-interactively - no banner, no
+// prompt - after the configured startup commands, then closes every
+// buffer. Blank lines and lines starting
+// with # are skipped. It stops at quit and, unless Options.KeepGoing,
+// at the first command that fails; the error names that command by
+// name (the script's, for messages) and line.
+func (r *REPL) RunScript(in io.Reader, name string) error {
+	if !r.runStartup() {
+		r.closeAll()
+		return nil
+	}
+	_, err := r.execScript(in, name, r.runCommand)
+	r.closeAll()
+	return err
+}
+
+// execScript runs in's commands through run, one per line, and returns
+// the first failure; quit is true when a command ended the session.
+func (r *REPL) execScript(in io.Reader, name string, run func(string) bool) (quit bool, err error) {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		input := strings.TrimSpace(sc.Text())
+		if input == "" || input[0] == '#' {
+			continue
+		}
+		r.errMsg = ""
+		cont := run(input)
+		if r.errMsg != "" && err == nil {
+			err = fmt.Errorf("%s:%d: %s", name, n, r.errMsg)
+		}
+		if !cont {
+			return true, err
+		}
+		if err != nil && !r.keepGoing {
+			return false, err
+		}
+	}
+	if serr := sc.Err(); serr != nil && err == nil {
+		err = fmt.Errorf("%s: %w", name, serr)
+	}
+	return false, err
+}
+
+// cmdSource runs the commands in a file as one command, which fails
+// with the first of them that does. It returns false when the file
+// quit the session.
+func (r *REPL) cmdSource(args []string) bool {
+	if len(args) != 1 {
+		r.errorln("Usage: source <file>")
+		return true
+	}
+	if r.sourceDepth >= maxSourceDepth {
+		r.errorln("Error: source or macro play nested too deeply")
+		return true
+	}
+	path := stripQuotes(args[0])
+	f, err := os.Open(path)
+	if err != nil {
+		r.errorf("Error: %v\n", err)
+		return true
+	}
+	defer f.Close()
+
+	r.sourceDepth++
+	quit, err := r.execScript(f, path, r.handleCommand)
+	r.sourceDepth--
+	if err != nil {
+		r.errMsg = err.Error() // a later command may have cleared it
+	}
+	return !quit
+}
@@ -0,0 +1,157 @@
+package garlandrepl
+
+import (
+	"strconv"
+
+	"github.com/phroun/garland"
+)
+
+// register is the yank buffer put inserts. It belongs to the session,
+// not a buffer, so text yanked in one document can be put in another.
+type register struct {
+	data []byte
+	// decorations cut along with data, relative to its start; the
+	// next put re-anchors them, so yank -x then put is a move.
+	decorations []garland.RelativeDecoration
+}
+
+// cmdMark drops the current cursor's selection anchor where it stands
+// (mark) or removes it (mark clear).
+func (r *REPL) cmdMark(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+	c := r.cursor()
+	if len(args) == 1 && args[0] == "clear" {
+		c.ClearAnchor()
+		r.println("Anchor cleared")
+		return
+	}
+	if len(args) != 0 {
+		r.errorln("Usage: mark | mark clear")
+		return
+	}
+	if err := c.SetAnchor(); err != nil {
+		r.errorf("Error: %v\n", err)
+		return
+	}
+	r.printf("Anchor set at byte %d\n", c.BytePos())
+}
+
+// cmdSelect selects bytes [start, end) - the anchor at start, the
+// cursor at end - or, without arguments, shows the selection.
+func (r *REPL) cmdSelect(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+	c := r.cursor()
+	switch len(args) {
+	case 0:
+	case 2:
+		start, err1 := strconv.ParseInt(args[0], 10, 64)
+		end, err2 := strconv.ParseInt(args[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			r.errorln("Usage: select <start> <end>")
+			return
+		}
+		if err := c.SeekByte(start); err != nil {
+			r.errorf("Error: %v\n", err)
+			return
+		}
+		c.SetAnchor()
+		if err := c.SeekByte(end); err != nil {
+			c.ClearAnchor()
+			r.errorf("Error: %v\n", err)
+			return
+		}
+	default:
+		r.errorln("Usage: select <start> <end>")
+		return
+	}
+
+	start, end, ok := c.SelectionRange()
+	if !ok {
+		r.println("No selection (use mark or select <start> <end>)")
+		return
+	}
+	text, err := c.SelectedText()
+	if err != nil {
+		r.errorf("Error: %v\n", err)
+		return
+	}
+	r.printf("Selection [%d, %d) (%d bytes): %q\n", start, end, end-start, text)
+	r.set("start", start)
+	r.set("end", end)
+	r.set("text", string(text))
+}
+
+// cmdYank copies the selection into the register (yank) or cuts it
+// (yank -x), carrying the decorations inside it along. The anchor is
+// cleared either way.
+func (r *REPL) cmdYank(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+	cut := len(args) == 1 && args[0] == "-x"
+	if len(args) > 0 && !cut {
+		r.errorln("Usage: yank [-x]")
+		return
+	}
+	c := r.cursor()
+	start, end, ok := c.SelectionRange()
+	if !ok {
+		r.errorf("Error: %v\n", garland.ErrNoSelection)
+		return
+	}
+	text, err := c.SelectedText()
+	if err != nil {
+		r.errorf("Error: %v\n", err)
+		return
+	}
+	reg := register{data: text}
+	if cut {
+		if err := c.SeekByte(start); err != nil {
+			r.errorf("Error: %v\n", err)
+			return
+		}
+		decs, result, err := c.DeleteBytes(end-start, false)
+		if err != nil {
+			r.errorf("Cut error: %v\n", err)
+			return
+		}
+		reg.decorations = decs
+		r.printf("Cut %d bytes (%d decoration(s)). Now at fork=%d, revision=%d\n",
+			len(text), len(decs), result.Fork, result.Revision)
+	} else {
+		r.printf("Yanked %d bytes\n", len(text))
+	}
+	c.ClearAnchor()
+	r.register = reg
+	r.set("bytes", len(text))
+}
+
+// cmdPut inserts the register at the cursor, before existing content
+// at the position for put-. Decorations cut with it go to the first
+// put only, since a key can be in one place.
+func (r *REPL) cmdPut(args []string, insertBefore bool) {
+	if !r.ensureGarland() {
+		return
+	}
+	if len(args) != 0 {
+		r.errorln("Usage: put | put-")
+		return
+	}
+	if r.register.data == nil {
+		r.errorln("Error: register is empty (use yank)")
+		return
+	}
+	result, err := r.cursor().InsertBytes(r.register.data, r.register.decorations, insertBefore)
+	if err != nil {
+		r.errorf("Put error: %v\n", err)
+		return
+	}
+	r.printf("Put %d bytes (%d decoration(s)). Now at fork=%d, revision=%d\n",
+		len(r.register.data), len(r.register.decorations), result.Fork, result.Revision)
+	r.register.decorations = nil
+	r.set("bytes", len(r.register.data))
+}
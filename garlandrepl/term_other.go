@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package garlandrepl
+
+import "errors"
+
+// makeRaw reports that line editing is unavailable here (Windows,
+// wasm, plan9); the shell reads plain lines instead.
+func makeRaw(fd int) (restore func(), err error) {
+	return nil, errors.New("line editing not supported on this platform")
+}
@@ -0,0 +1,59 @@
+package garlandrepl
+
+import "github.com/phroun/garland"
+
+// cmdTrace turns trace mode on or off, or shows whether it is on.
+// While it is on, each command is followed by the tree work it did in
+// the buffer it started in (see tracedCommand).
+func (r *REPL) cmdTrace(args []string) {
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "on":
+		r.tracing = true
+	case len(args) == 1 && args[0] == "off":
+		r.tracing = false
+		for _, b := range r.buffers {
+			b.g.SetTracing(false)
+		}
+	default:
+		r.errorln("Usage: trace [on|off]")
+		return
+	}
+	if r.tracing {
+		r.println("Trace is on")
+	} else {
+		r.println("Trace is off")
+	}
+	r.set("trace", r.tracing)
+}
+
+// tracedCommand runs a command and, in trace mode, reports the tree
+// work it did: nodes visited and created, snapshots copied, chills,
+// thaws and rebalancing.
+func (r *REPL) tracedCommand(input string) bool {
+	g := r.garland
+	if !r.tracing || g == nil {
+		return r.handleCommand(input)
+	}
+	if !g.Tracing() {
+		g.SetTracing(true)
+	}
+	before := g.TreeCounts()
+	cont := r.handleCommand(input)
+	if !r.tracing {
+		return cont
+	}
+	c := g.TreeCounts().Sub(before)
+	r.printf("trace: %d nodes visited, %d created, %d snapshots copied, %d chills, %d thaws, %d rotations, %d rebuilds\n",
+		c.NodesVisited, c.NodesCreated, c.SnapshotsCopied, c.Chills, c.Thaws, c.Rotations, c.Rebuilds)
+	r.set("trace", traceData(c))
+	return cont
+}
+
+// traceData is a command's tree work as JSON-mode data.
+func traceData(c garland.TreeCounts) map[string]int64 {
+	return map[string]int64{
+		"visited": c.NodesVisited, "created": c.NodesCreated, "snapshots": c.SnapshotsCopied,
+		"chills": c.Chills, "thaws": c.Thaws, "rotations": c.Rotations, "rebuilds": c.Rebuilds,
+	}
+}
@@ -0,0 +1,156 @@
+package garlandrepl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/phroun/garland"
+)
+
+// cmdStream opens a file as a streaming source in a new buffer: a
+// goroutine feeds it through a DataChannel, chunk bytes every delay,
+// so the loading machinery can be watched (see cmdWatch).
+func (r *REPL) cmdStream(args []string) {
+	if len(args) < 1 || len(args) > 3 {
+		r.errorln("Usage: stream <filepath> [chunk-bytes] [delay-ms]")
+		return
+	}
+	chunk, delay := 4096, 10*time.Millisecond
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			r.errorf("Error: invalid chunk size: %s\n", args[1])
+			return
+		}
+		chunk = n
+	}
+	if len(args) > 2 {
+		ms, err := strconv.Atoi(args[2])
+		if err != nil || ms < 0 {
+			r.errorf("Error: invalid delay: %s\n", args[2])
+			return
+		}
+		delay = time.Duration(ms) * time.Millisecond
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		r.errorf("Error opening file: %v\n", err)
+		return
+	}
+
+	ch := make(chan []byte)
+	opts := r.config.Open
+	opts.DataChannel = ch
+	g, err := r.lib.Open(opts)
+	if err != nil {
+		f.Close()
+		r.errorf("Error creating garland: %v\n", err)
+		return
+	}
+	stop := make(chan struct{})
+	go feedStream(f, ch, chunk, delay, stop)
+	r.addBuffer(g, args[0]+" (stream)")
+	r.buffers[r.current].stop = stop
+	r.printf("Streaming %s as buffer %d (%d bytes every %v)\n", args[0], len(r.buffers), chunk, delay)
+}
+
+// feedStream sends f to ch in chunks, then closes both; closing stop
+// (the buffer was closed) ends it early.
+func feedStream(f *os.File, ch chan<- []byte, chunk int, delay time.Duration, stop <-chan struct{}) {
+	defer f.Close()
+	defer close(ch)
+	for {
+		buf := make([]byte, chunk)
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			select {
+			case ch <- buf[:n]:
+			case <-stop:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// cmdWatch redraws a loading status line for the current buffer every
+// interval (250ms by default) until loading completes or Ctrl-C. At a
+// terminal the line is rewritten in place; otherwise each refresh is a
+// line of its own.
+func (r *REPL) cmdWatch(args []string) {
+	if !r.ensureGarland() {
+		return
+	}
+	interval := 250 * time.Millisecond
+	if len(args) > 0 {
+		ms, err := strconv.Atoi(args[0])
+		if err != nil || ms < 1 {
+			r.errorln("Usage: watch [interval-ms]")
+			return
+		}
+		interval = time.Duration(ms) * time.Millisecond
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	g := r.garland
+	inPlace := r.editor != nil && !r.jsonOut
+loop:
+	for {
+		complete := g.IsComplete()
+		if status := watchStatus(g); inPlace {
+			r.printf("\r%s\x1b[K", status)
+		} else {
+			r.println(status)
+		}
+		if complete {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			break loop
+		}
+	}
+	if inPlace {
+		r.println()
+	}
+	r.set("complete", g.IsComplete())
+	r.set("bytes", g.ByteCount().Value)
+	r.set("lines", g.LineCount().Value)
+}
+
+// watchStatus is one status line for cmdWatch.
+func watchStatus(g *garland.Garland) string {
+	state := "loading"
+	if g.IsComplete() {
+		state = "complete"
+	}
+	ready := "not ready"
+	if g.IsReady() {
+		ready = "ready"
+	}
+	mem := g.MemoryUsage()
+	pressure := ""
+	if mem.UnderPressure {
+		pressure = ", UNDER PRESSURE"
+	}
+	return fmt.Sprintf("[%s] %d bytes, %d runes, %d lines; %s; memory %d bytes (%d leaves in memory, %d cold)%s",
+		state, g.ByteCount().Value, g.RuneCount().Value, g.LineCount().Value, ready,
+		mem.MemoryBytes, mem.InMemoryLeaves, mem.ColdStoredLeaves, pressure)
+}
@@ -0,0 +1,310 @@
+// Package garlandrpc serves Garland as an editing engine over JSON-RPC
+// 2.0, for frontends not written in Go (editor extensions, TUIs in
+// other languages) and for inspecting the documents of a running
+// application (garland-repl -connect).
+//
+// DESIGN: cmd/garland-server is this package over a fresh Library. An
+// application that embeds garland serves its own instead: NewServer
+// over its Library, Publish for each live Garland it wants reachable,
+// then Serve on a pipe or ServeListener on a socket it chose.
+//
+//   - Messages are newline-delimited JSON: one request (or batch
+//     array) per line in, one response per line out.
+//   - A session is one Serve call (one connection). It addresses its
+//     documents by the integer handle "open" or "attach" returns;
+//     handles are the session's own.
+//   - A document the session opened belongs to it, and is closed by
+//     "close" or when the session ends. A published document belongs
+//     to the application: "attach" gives the session a handle and a
+//     cursor of its own, and "close" or the end of the session only
+//     detaches - the session's cursors are removed, the Garland stays
+//     open. Unpublish stops new attachments; sessions already attached
+//     keep their handles, so the application closes a published
+//     Garland only once no client uses it.
+//   - Each session drives its own cursors, so sessions attached to the
+//     same document (and the application itself) do not move each
+//     other's.
+//
+// Methods (params are JSON objects; "cursor" defaults to "main", the
+// cursor every opened document starts with, or on an attached one to
+// the cursor "attach" returned):
+//
+//	list                                            -> [{name, bytes,
+//	                                                    lines, fork, revision}]
+//	attach             {name}                       -> {doc, cursor}
+//	open               {path} or {text}             -> {doc}
+//	close              {doc}
+//	save               {doc}                        -> {scars}
+//	info               {doc}                        -> counts and version
+//	read               {doc, start, length}         -> {text}
+//	cursor.new         {doc, cursor}
+//	cursor.remove      {doc, cursor}
+//	cursor.seek        {doc, cursor, byte | rune | line+column}
+//	cursor.position    {doc, cursor}                -> position
+//	insert             {doc, cursor, text, before?} -> version
+//	delete             {doc, cursor, length}        -> version
+//	overwrite          {doc, cursor, length, text}  -> version
+//	find               {doc, cursor, pattern, regex?, caseSensitive?,
+//	                    wholeWord?, backward?, all?} -> [match]
+//	decorate           {doc, entries: [{key, namespace?, byte?,
+//	                    gravity?}]}                 -> version
+//	decoration         {doc, key, namespace?}       -> {byte}
+//	transaction.start  {doc, name?}
+//	transaction.commit {doc}                        -> version
+//	transaction.rollback {doc}
+//	undoSeek           {doc, revision}
+//	forkSeek           {doc, fork}
+//
+// A decoration entry without "byte" deletes the mark. Garland errors
+// are returned with code -32000 and the error text as the message.
+package garlandrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/phroun/garland"
+)
+
+// ErrPublished is returned by Publish for a name already in use.
+var ErrPublished = errors.New("name already published")
+
+// Server serves sessions over one Library and the Garlands published
+// to it. Its methods are safe for concurrent use.
+type Server struct {
+	lib *garland.Library
+
+	mu        sync.Mutex
+	published map[string]*garland.Garland
+	attached  int // attachments made, for naming their cursors
+}
+
+// NewServer returns a server whose sessions open documents in lib. lib
+// may be nil for a server that only serves published documents ("open"
+// then fails).
+func NewServer(lib *garland.Library) *Server {
+	return &Server{lib: lib, published: make(map[string]*garland.Garland)}
+}
+
+// Publish makes g reachable by every session under name ("list",
+// "attach"). It returns ErrPublished if name is taken.
+func (s *Server) Publish(name string, g *garland.Garland) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.published[name]; ok {
+		return fmt.Errorf("%w: %q", ErrPublished, name)
+	}
+	s.published[name] = g
+	return nil
+}
+
+// Unpublish withdraws name; sessions attached to it keep their handles.
+func (s *Server) Unpublish(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.published, name)
+}
+
+// lookup returns the Garland published under name, or nil.
+func (s *Server) lookup(name string) *garland.Garland {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.published[name]
+}
+
+// names returns the published names, sorted.
+func (s *Server) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.published))
+	for name := range s.published {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nextAttachment numbers an attachment.
+func (s *Server) nextAttachment() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attached++
+	return s.attached
+}
+
+// Serve runs one session until r ends, then closes the documents it
+// opened and detaches from the published ones.
+func (s *Server) Serve(r io.Reader, w io.Writer) {
+	ss := &session{srv: s, docs: make(map[int]*document)}
+	defer ss.end()
+	in := bufio.NewReader(r)
+	enc := json.NewEncoder(w)
+	for {
+		line, err := in.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if out := ss.handle(line); out != nil {
+				if enc.Encode(out) != nil {
+					return
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ServeListener serves each connection ln accepts as a session, until
+// ln is closed; it returns the error that ended Accept. Sessions under
+// way keep running.
+func (s *Server) ServeListener(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			s.Serve(conn, conn)
+		}()
+	}
+}
+
+// JSON-RPC error codes.
+const (
+	codeParse          = -32700
+	codeInvalidRequest = -32600
+	codeNoMethod       = -32601
+	codeInvalidParams  = -32602
+	codeGarland        = -32000
+)
+
+// defaultCursor is the cursor every opened document starts with.
+const defaultCursor = "main"
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// session is one client's documents.
+type session struct {
+	srv  *Server
+	docs map[int]*document
+	next int
+}
+
+// document is a session's handle on a Garland.
+type document struct {
+	g         *garland.Garland
+	published string            // name attached to; "" when the session opened g
+	cursor    string            // the cursor methods default to
+	cursors   []*garland.Cursor // created on a published g, removed on detach
+}
+
+// add gives d the session's next handle.
+func (s *session) add(d *document) int {
+	s.next++
+	s.docs[s.next] = d
+	return s.next
+}
+
+// release ends the session's hold on d: an opened document is closed,
+// a published one detached.
+func (s *session) release(d *document) error {
+	if d.published == "" {
+		return d.g.Close()
+	}
+	for _, c := range d.cursors {
+		d.g.RemoveCursor(c) // may already be gone (cursor.remove)
+	}
+	d.cursors = nil
+	return nil
+}
+
+// end releases every document the session holds.
+func (s *session) end() {
+	for id, d := range s.docs {
+		s.release(d)
+		delete(s.docs, id)
+	}
+}
+
+// call runs one request; nil means a notification (no response).
+func (s *session) call(req request) *response {
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{Code: codeInvalidRequest, Message: "invalid request"}
+		return resp
+	}
+	fn := methods[req.Method]
+	if fn == nil {
+		resp.Error = &rpcError{Code: codeNoMethod, Message: "method not found: " + req.Method}
+	} else if result, err := fn(s, req.Params); err != nil {
+		var re *rpcError
+		if !errors.As(err, &re) {
+			re = &rpcError{Code: codeGarland, Message: err.Error()}
+		}
+		resp.Error = re
+	} else if result == nil {
+		resp.Result = json.RawMessage("null") // success always carries a result
+	} else {
+		resp.Result = result
+	}
+	if req.ID == nil {
+		return nil
+	}
+	return resp
+}
+
+// handle runs one line - a request or a batch - and returns what to
+// send back (nil for nothing).
+func (s *session) handle(line []byte) any {
+	if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []request
+		if err := json.Unmarshal(trimmed, &batch); err != nil || len(batch) == 0 {
+			return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParse, Message: "parse error"}}
+		}
+		var out []*response
+		for _, req := range batch {
+			if resp := s.call(req); resp != nil {
+				out = append(out, resp)
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	}
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParse, Message: "parse error"}}
+	}
+	if resp := s.call(req); resp != nil {
+		return resp
+	}
+	return nil
+}
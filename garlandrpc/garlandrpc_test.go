@@ -0,0 +1,396 @@
+package garlandrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/phroun/garland"
+)
+
+// client drives one serve session over a pair of pipes.
+type client struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *bufio.Reader
+	done chan struct{}
+}
+
+func newClient(t *testing.T, lib *garland.Library) *client {
+	t.Helper()
+	return serverClient(t, NewServer(lib))
+}
+
+// serverClient starts a session on srv.
+func serverClient(t *testing.T, srv *Server) *client {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan struct{})}
+	go func() {
+		srv.Serve(inR, outW)
+		outW.Close()
+		close(c.done)
+	}()
+	t.Cleanup(c.close)
+	return c
+}
+
+// close ends the session and waits for serve to return.
+func (c *client) close() {
+	c.in.Close()
+	<-c.done
+}
+
+// send writes one line.
+func (c *client) send(line string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.in, line+"\n"); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// recv reads one response line into v.
+func (c *client) recv(v any) {
+	c.t.Helper()
+	line, err := c.out.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := json.Unmarshal(line, v); err != nil {
+		c.t.Fatalf("%s: %v", line, err)
+	}
+}
+
+// testResponse is a response as a client decodes it.
+type testResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// call sends a request and returns its response.
+func (c *client) call(line string) testResponse {
+	c.t.Helper()
+	c.send(line)
+	var r testResponse
+	c.recv(&r)
+	return r
+}
+
+// ok calls and decodes the result into v (when non-nil), failing on
+// an error response.
+func (c *client) ok(line string, v any) {
+	c.t.Helper()
+	r := c.call(line)
+	if r.Error != nil {
+		c.t.Fatalf("%s: error %d %s", line, r.Error.Code, r.Error.Message)
+	}
+	if v != nil {
+		if err := json.Unmarshal(r.Result, v); err != nil {
+			c.t.Fatalf("%s: result %s: %v", line, r.Result, err)
+		}
+	}
+}
+
+func newLib(t *testing.T) *garland.Library {
+	t.Helper()
+	lib, err := garland.Init(garland.LibraryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lib
+}
+
+func TestServeSingleRequests(t *testing.T) {
+	c := newClient(t, newLib(t))
+
+	var opened struct{ Doc int }
+	c.ok(`{"jsonrpc":"2.0","id":1,"method":"open","params":{"text":"hello world"}}`, &opened)
+	if opened.Doc != 1 {
+		t.Fatalf("doc handle %d, want 1", opened.Doc)
+	}
+	var pos map[string]int64
+	c.ok(`{"jsonrpc":"2.0","id":2,"method":"cursor.seek","params":{"doc":1,"byte":5}}`, &pos)
+	if pos["byte"] != 5 || pos["column"] != 5 {
+		t.Errorf("seek: %v", pos)
+	}
+	var v version
+	c.ok(`{"jsonrpc":"2.0","id":3,"method":"insert","params":{"doc":1,"text":","}}`, &v)
+	if v.Revision != 1 {
+		t.Errorf("insert: %+v", v)
+	}
+	var read struct{ Text string }
+	c.ok(`{"jsonrpc":"2.0","id":"r","method":"read","params":{"doc":1,"start":0,"length":100}}`, &read)
+	if read.Text != "hello, world" {
+		t.Errorf("read %q", read.Text)
+	}
+	var found []map[string]any
+	c.ok(`{"jsonrpc":"2.0","id":4,"method":"find","params":{"doc":1,"pattern":"o","all":true}}`, &found)
+	if len(found) != 2 {
+		t.Errorf("find all: %v", found)
+	}
+
+	// A result-less success still carries "result": null, and the id
+	// comes back as sent.
+	r := c.call(`{"jsonrpc":"2.0","id":"tx","method":"transaction.start","params":{"doc":1}}`)
+	if r.Error != nil || string(r.Result) != "null" || string(r.ID) != `"tx"` {
+		t.Errorf("transaction.start: %+v", r)
+	}
+	c.ok(`{"jsonrpc":"2.0","id":5,"method":"transaction.rollback","params":{"doc":1}}`, nil)
+}
+
+func TestServeNotifications(t *testing.T) {
+	c := newClient(t, newLib(t))
+	c.ok(`{"jsonrpc":"2.0","id":1,"method":"open","params":{"text":"abc"}}`, nil)
+
+	// Notifications (no id) run but answer nothing - even on error. The
+	// next response is the next request's.
+	c.send(`{"jsonrpc":"2.0","method":"insert","params":{"doc":1,"text":"x"}}`)
+	c.send(`{"jsonrpc":"2.0","method":"no.such.method"}`)
+	var read struct{ Text string }
+	r := c.call(`{"jsonrpc":"2.0","id":7,"method":"read","params":{"doc":1,"start":0,"length":10}}`)
+	if string(r.ID) != "7" {
+		t.Fatalf("response to a notification: %+v", r)
+	}
+	json.Unmarshal(r.Result, &read)
+	if read.Text != "xabc" {
+		t.Errorf("notification did not run: %q", read.Text)
+	}
+}
+
+func TestServeBatch(t *testing.T) {
+	c := newClient(t, newLib(t))
+	c.ok(`{"jsonrpc":"2.0","id":1,"method":"open","params":{"text":"abc"}}`, nil)
+
+	c.send(`[{"jsonrpc":"2.0","id":1,"method":"insert","params":{"doc":1,"text":"1"}},` +
+		`{"jsonrpc":"2.0","method":"insert","params":{"doc":1,"text":"2"}},` +
+		`{"jsonrpc":"2.0","id":2,"method":"nope"},` +
+		`{"jsonrpc":"2.0","id":3,"method":"read","params":{"doc":1,"start":0,"length":10}}]`)
+	var batch []testResponse
+	c.recv(&batch)
+	if len(batch) != 3 {
+		t.Fatalf("batch of 4 with one notification answered %d", len(batch))
+	}
+	if string(batch[0].ID) != "1" || batch[0].Error != nil {
+		t.Errorf("first: %+v", batch[0])
+	}
+	if batch[1].Error == nil || batch[1].Error.Code != codeNoMethod {
+		t.Errorf("second: %+v", batch[1])
+	}
+	var read struct{ Text string }
+	json.Unmarshal(batch[2].Result, &read)
+	if read.Text != "12abc" {
+		t.Errorf("batch ran out of order: %q", read.Text)
+	}
+
+	// A batch of notifications answers nothing at all.
+	c.send(`[{"jsonrpc":"2.0","method":"insert","params":{"doc":1,"text":"3"}}]`)
+	if r := c.call(`{"jsonrpc":"2.0","id":9,"method":"info","params":{"doc":1}}`); string(r.ID) != "9" {
+		t.Errorf("notification batch was answered: %+v", r)
+	}
+}
+
+func TestServeErrorCodes(t *testing.T) {
+	c := newClient(t, newLib(t))
+	c.ok(`{"jsonrpc":"2.0","id":1,"method":"open","params":{"text":"abc"}}`, nil)
+
+	for _, tc := range []struct {
+		line string
+		code int
+	}{
+		{`{not json`, codeParse},
+		{`[]`, codeParse},
+		{`[{not json}]`, codeParse},
+		{`{"id":1,"method":"info"}`, codeInvalidRequest},
+		{`{"jsonrpc":"2.0","id":1}`, codeInvalidRequest},
+		{`{"jsonrpc":"2.0","id":1,"method":"nope"}`, codeNoMethod},
+		{`{"jsonrpc":"2.0","id":1,"method":"info","params":{"doc":"one"}}`, codeInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"info","params":{"doc":2}}`, codeInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"cursor.seek","params":{"doc":1}}`, codeInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"cursor.new","params":{"doc":1,"cursor":"main"}}`, codeInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"decorate","params":{"doc":1,"entries":[{"key":"k","gravity":"up"}]}}`, codeInvalidParams},
+		{`{"jsonrpc":"2.0","id":1,"method":"cursor.seek","params":{"doc":1,"byte":99}}`, codeGarland},
+		{`{"jsonrpc":"2.0","id":1,"method":"decoration","params":{"doc":1,"key":"missing"}}`, codeGarland},
+		{`{"jsonrpc":"2.0","id":1,"method":"insert","params":{"doc":1,"cursor":"ghost","text":"x"}}`, codeGarland},
+	} {
+		r := c.call(tc.line)
+		if r.Error == nil || r.Error.Code != tc.code {
+			t.Errorf("%s: got %+v, want code %d", tc.line, r.Error, tc.code)
+		}
+		if tc.code == codeParse && string(r.ID) != "null" {
+			t.Errorf("%s: parse error id %s, want null", tc.line, r.ID)
+		}
+	}
+}
+
+func TestServeSessionsOwnTheirDocuments(t *testing.T) {
+	srv := NewServer(newLib(t))
+	a, b := serverClient(t, srv), serverClient(t, srv)
+
+	var doc struct{ Doc int }
+	a.ok(`{"jsonrpc":"2.0","id":1,"method":"open","params":{"text":"from a"}}`, nil)
+	a.ok(`{"jsonrpc":"2.0","id":2,"method":"open","params":{"text":"a again"}}`, &doc)
+	if doc.Doc != 2 {
+		t.Fatalf("second handle %d", doc.Doc)
+	}
+	b.ok(`{"jsonrpc":"2.0","id":1,"method":"open","params":{"text":"from b"}}`, &doc)
+	if doc.Doc != 1 {
+		t.Fatalf("handles are per session: b got %d", doc.Doc)
+	}
+
+	// The same handle names each session's own document; another
+	// session's handles do not resolve.
+	var read struct{ Text string }
+	b.ok(`{"jsonrpc":"2.0","id":2,"method":"read","params":{"doc":1,"start":0,"length":10}}`, &read)
+	if read.Text != "from b" {
+		t.Errorf("b's doc 1 reads %q", read.Text)
+	}
+	if r := b.call(`{"jsonrpc":"2.0","id":3,"method":"info","params":{"doc":2}}`); r.Error == nil || r.Error.Code != codeInvalidParams {
+		t.Errorf("b reached a's doc 2: %+v", r)
+	}
+
+	// Closing frees the handle; ending a session leaves the other's
+	// documents alone.
+	a.ok(`{"jsonrpc":"2.0","id":3,"method":"close","params":{"doc":1}}`, nil)
+	if r := a.call(`{"jsonrpc":"2.0","id":4,"method":"info","params":{"doc":1}}`); r.Error == nil {
+		t.Error("closed handle still resolves")
+	}
+	a.close()
+	b.ok(`{"jsonrpc":"2.0","id":4,"method":"read","params":{"doc":1,"start":0,"length":10}}`, &read)
+	if read.Text != "from b" {
+		t.Errorf("after a ended, b's doc reads %q", read.Text)
+	}
+}
+
+// appDoc is a document the application itself opened.
+func appDoc(t *testing.T, lib *garland.Library, text string) *garland.Garland {
+	t.Helper()
+	g, err := lib.Open(garland.FileOptions{DataString: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestPublishedDocuments(t *testing.T) {
+	lib := newLib(t)
+	notes, todo := appDoc(t, lib, "hello"), appDoc(t, lib, "one\ntwo\n")
+	appCursor := notes.NewCursor()
+	srv := NewServer(lib)
+	srv.Publish("todo", todo)
+	srv.Publish("notes", notes)
+	if err := srv.Publish("notes", todo); !errors.Is(err, ErrPublished) {
+		t.Errorf("second Publish of a name: %v", err)
+	}
+
+	a, b := serverClient(t, srv), serverClient(t, srv)
+	var list []map[string]any
+	a.ok(`{"jsonrpc":"2.0","id":1,"method":"list"}`, &list)
+	if len(list) != 2 || list[0]["name"] != "notes" || list[0]["bytes"] != 5.0 || list[1]["lines"] != 2.0 {
+		t.Fatalf("list: %v", list)
+	}
+	if r := a.call(`{"jsonrpc":"2.0","id":2,"method":"attach","params":{"name":"nope"}}`); r.Error == nil || r.Error.Code != codeInvalidParams {
+		t.Errorf("attach to an unknown name: %+v", r)
+	}
+
+	// Each attachment drives a cursor of its own, which methods default
+	// to; edits land in the application's Garland.
+	var att, batt struct {
+		Doc    int
+		Cursor string
+	}
+	a.ok(`{"jsonrpc":"2.0","id":3,"method":"attach","params":{"name":"notes"}}`, &att)
+	b.ok(`{"jsonrpc":"2.0","id":1,"method":"attach","params":{"name":"notes"}}`, &batt)
+	if att.Doc != 1 || batt.Doc != 1 || att.Cursor == batt.Cursor || att.Cursor == "" {
+		t.Fatalf("attachments: %+v, %+v", att, batt)
+	}
+	a.ok(`{"jsonrpc":"2.0","id":4,"method":"cursor.seek","params":{"doc":1,"byte":5}}`, nil)
+	a.ok(`{"jsonrpc":"2.0","id":5,"method":"insert","params":{"doc":1,"text":" world"}}`, nil)
+	var read struct{ Text string }
+	b.ok(`{"jsonrpc":"2.0","id":2,"method":"read","params":{"doc":1,"start":0,"length":20}}`, &read)
+	if read.Text != "hello world" {
+		t.Errorf("b reads %q", read.Text)
+	}
+	var pos map[string]int64
+	b.ok(`{"jsonrpc":"2.0","id":3,"method":"cursor.position","params":{"doc":1}}`, &pos)
+	if pos["byte"] != 0 || appCursor.BytePos() != 0 {
+		t.Errorf("a's seek moved b's cursor (%v) or the application's (%d)", pos, appCursor.BytePos())
+	}
+	b.ok(`{"jsonrpc":"2.0","id":4,"method":"cursor.new","params":{"doc":1,"cursor":"b-extra"}}`, nil)
+	if n := len(notes.CursorsInOrder()); n != 4 {
+		t.Fatalf("%d cursors on the document, want 4", n)
+	}
+
+	// Closing detaches: the session's cursors go, the document stays
+	// open. So does ending the session.
+	a.ok(`{"jsonrpc":"2.0","id":6,"method":"close","params":{"doc":1}}`, nil)
+	if notes.ByteCount().Value != 11 || len(notes.CursorsInOrder()) != 3 {
+		t.Errorf("after close: %d bytes, %d cursors", notes.ByteCount().Value, len(notes.CursorsInOrder()))
+	}
+	b.close()
+	if n := len(notes.CursorsInOrder()); n != 1 {
+		t.Errorf("after b ended: %d cursors, want the application's only", n)
+	}
+	if _, err := appCursor.InsertString("!", nil, false); err != nil {
+		t.Errorf("application's document unusable after detaching: %v", err)
+	}
+
+	// Unpublished names are gone for new attachments; held handles work.
+	a.ok(`{"jsonrpc":"2.0","id":7,"method":"attach","params":{"name":"todo"}}`, &att)
+	srv.Unpublish("todo")
+	a.ok(`{"jsonrpc":"2.0","id":8,"method":"list"}`, &list)
+	if len(list) != 1 {
+		t.Errorf("list after Unpublish: %v", list)
+	}
+	if r := a.call(`{"jsonrpc":"2.0","id":9,"method":"attach","params":{"name":"todo"}}`); r.Error == nil {
+		t.Error("attached to an unpublished name")
+	}
+	a.ok(`{"jsonrpc":"2.0","id":10,"method":"info","params":{"doc":2}}`, nil)
+}
+
+func TestPublishOnlyServer(t *testing.T) {
+	srv := NewServer(nil)
+	srv.Publish("doc", appDoc(t, newLib(t), "x"))
+	c := serverClient(t, srv)
+	if r := c.call(`{"jsonrpc":"2.0","id":1,"method":"open","params":{"text":"new"}}`); r.Error == nil || r.Error.Code != codeGarland {
+		t.Errorf("open without a library: %+v", r)
+	}
+	c.ok(`{"jsonrpc":"2.0","id":2,"method":"attach","params":{"name":"doc"}}`, nil)
+}
+
+func TestServeListener(t *testing.T) {
+	lib := newLib(t)
+	srv := NewServer(lib)
+	srv.Publish("live", appDoc(t, lib, "served"))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no loopback:", err)
+	}
+	done := make(chan error)
+	go func() { done <- srv.ServeListener(ln) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, `{"jsonrpc":"2.0","id":1,"method":"list"}`+"\n")
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r struct{ Result []map[string]any }
+	if json.Unmarshal(line, &r); len(r.Result) != 1 || r.Result[0]["name"] != "live" {
+		t.Errorf("list over TCP: %s", line)
+	}
+
+	ln.Close()
+	if err := <-done; err == nil {
+		t.Error("ServeListener returned nil after the listener closed")
+	}
+}
@@ -0,0 +1,457 @@
+package garlandrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/phroun/garland"
+)
+
+// docParams is embedded by every method's params.
+type docParams struct {
+	Doc    int    `json:"doc"`
+	Cursor string `json:"cursor"`
+}
+
+// version is the result of an editing method.
+type version struct {
+	Fork     garland.ForkID     `json:"fork"`
+	Revision garland.RevisionID `json:"revision"`
+}
+
+func versionOf(r garland.ChangeResult) version {
+	return version{Fork: r.Fork, Revision: r.Revision}
+}
+
+// handler runs one method with its raw params.
+type handler func(s *session, params json.RawMessage) (any, error)
+
+var methods map[string]handler
+
+func init() {
+	methods = map[string]handler{
+		"list":                 (*session).list,
+		"attach":               (*session).attach,
+		"open":                 (*session).open,
+		"close":                withDoc((*session).close),
+		"save":                 withDoc((*session).save),
+		"info":                 withDoc((*session).info),
+		"read":                 withDoc((*session).read),
+		"cursor.new":           withDoc((*session).cursorNew),
+		"cursor.remove":        withCursor((*session).cursorRemove),
+		"cursor.seek":          withCursor((*session).cursorSeek),
+		"cursor.position":      withCursor((*session).cursorPosition),
+		"insert":               withCursor((*session).insert),
+		"delete":               withCursor((*session).delete),
+		"overwrite":            withCursor((*session).overwrite),
+		"find":                 withCursor((*session).find),
+		"decorate":             withDoc((*session).decorate),
+		"decoration":           withDoc((*session).decoration),
+		"transaction.start":    withDoc((*session).transactionStart),
+		"transaction.commit":   withDoc((*session).transactionCommit),
+		"transaction.rollback": withDoc((*session).transactionRollback),
+		"undoSeek":             withDoc((*session).undoSeek),
+		"forkSeek":             withDoc((*session).forkSeek),
+	}
+}
+
+// invalidParams reports params that do not decode.
+func invalidParams(err error) error {
+	return &rpcError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// withDoc resolves the "doc" handle before calling fn.
+func withDoc(fn func(s *session, g *garland.Garland, raw json.RawMessage) (any, error)) handler {
+	return func(s *session, raw json.RawMessage) (any, error) {
+		var p docParams
+		if err := decode(raw, &p); err != nil {
+			return nil, err
+		}
+		d := s.docs[p.Doc]
+		if d == nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("no document %d", p.Doc)}
+		}
+		return fn(s, d.g, raw)
+	}
+}
+
+// withCursor resolves the "doc" handle and "cursor" name before
+// calling fn.
+func withCursor(fn func(s *session, g *garland.Garland, c *garland.Cursor, raw json.RawMessage) (any, error)) handler {
+	return withDoc(func(s *session, g *garland.Garland, raw json.RawMessage) (any, error) {
+		var p docParams
+		decode(raw, &p) // checked by withDoc
+		if p.Cursor == "" {
+			p.Cursor = s.docs[p.Doc].cursor
+		}
+		c, err := g.FindCursor(p.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		return fn(s, g, c, raw)
+	})
+}
+
+// decode unmarshals params into v.
+func decode(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		raw = []byte("{}")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return invalidParams(err)
+	}
+	return nil
+}
+
+func (s *session) list(raw json.RawMessage) (any, error) {
+	out := []map[string]any{}
+	for _, name := range s.srv.names() {
+		g := s.srv.lookup(name)
+		if g == nil {
+			continue // unpublished meanwhile
+		}
+		out = append(out, map[string]any{
+			"name":     name,
+			"bytes":    g.ByteCount().Value,
+			"lines":    g.LineCount().Value,
+			"fork":     g.CurrentFork(),
+			"revision": g.CurrentRevision(),
+		})
+	}
+	return out, nil
+}
+
+func (s *session) attach(raw json.RawMessage) (any, error) {
+	var p struct {
+		Name string `json:"name"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	g := s.srv.lookup(p.Name)
+	if g == nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("no published document %q", p.Name)}
+	}
+	// A cursor of the session's own, named apart from the application's
+	name := ""
+	for name == "" {
+		name = fmt.Sprintf("remote-%d", s.srv.nextAttachment())
+		if _, err := g.FindCursor(name); err == nil {
+			name = ""
+		}
+	}
+	c := g.NewCursor()
+	c.SetName(name)
+	doc := s.add(&document{g: g, published: p.Name, cursor: name, cursors: []*garland.Cursor{c}})
+	return map[string]any{"doc": doc, "cursor": name}, nil
+}
+
+func (s *session) open(raw json.RawMessage) (any, error) {
+	var p struct {
+		Path string  `json:"path"`
+		Text *string `json:"text"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	if s.srv.lib == nil {
+		return nil, &rpcError{Code: codeGarland, Message: "this server only serves published documents"}
+	}
+	opts := garland.FileOptions{FilePath: p.Path}
+	if p.Text != nil {
+		opts = garland.FileOptions{DataString: *p.Text}
+	}
+	g, err := s.srv.lib.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	g.NewCursor().SetName(defaultCursor)
+	return map[string]int{"doc": s.add(&document{g: g, cursor: defaultCursor})}, nil
+}
+
+func (s *session) close(g *garland.Garland, raw json.RawMessage) (any, error) {
+	var p docParams
+	decode(raw, &p) // checked by withDoc
+	d := s.docs[p.Doc]
+	delete(s.docs, p.Doc)
+	return nil, s.release(d)
+}
+
+func (s *session) save(g *garland.Garland, raw json.RawMessage) (any, error) {
+	report, err := g.Save()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"scars": len(report.Scars)}, nil
+}
+
+func (s *session) info(g *garland.Garland, raw json.RawMessage) (any, error) {
+	return map[string]any{
+		"bytes":    g.ByteCount().Value,
+		"runes":    g.RuneCount().Value,
+		"lines":    g.LineCount().Value,
+		"complete": g.IsComplete(),
+		"fork":     g.CurrentFork(),
+		"revision": g.CurrentRevision(),
+	}, nil
+}
+
+func (s *session) read(g *garland.Garland, raw json.RawMessage) (any, error) {
+	var p struct {
+		Start  int64 `json:"start"`
+		Length int64 `json:"length"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.Length < 0 {
+		return nil, garland.ErrInvalidPosition
+	}
+	buf := make([]byte, min(p.Length, max(g.ByteCount().Value-p.Start, 0)))
+	n, err := g.ReadAt(buf, p.Start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return map[string]string{"text": string(buf[:n])}, nil
+}
+
+func (s *session) cursorNew(g *garland.Garland, raw json.RawMessage) (any, error) {
+	var p docParams
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.Cursor == "" {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "cursor name required"}
+	}
+	if _, err := g.FindCursor(p.Cursor); err == nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("cursor %q exists", p.Cursor)}
+	}
+	c := g.NewCursor()
+	c.SetName(p.Cursor)
+	if d := s.docs[p.Doc]; d.published != "" {
+		d.cursors = append(d.cursors, c)
+	}
+	return nil, nil
+}
+
+func (s *session) cursorRemove(g *garland.Garland, c *garland.Cursor, raw json.RawMessage) (any, error) {
+	return nil, g.RemoveCursor(c)
+}
+
+func (s *session) cursorSeek(g *garland.Garland, c *garland.Cursor, raw json.RawMessage) (any, error) {
+	var p struct {
+		Byte   *int64 `json:"byte"`
+		Rune   *int64 `json:"rune"`
+		Line   *int64 `json:"line"`
+		Column int64  `json:"column"` // runes into the line
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	var err error
+	switch {
+	case p.Byte != nil:
+		err = c.SeekByte(*p.Byte)
+	case p.Rune != nil:
+		err = c.SeekRune(*p.Rune)
+	case p.Line != nil:
+		err = c.SeekLine(*p.Line, p.Column)
+	default:
+		return nil, &rpcError{Code: codeInvalidParams, Message: "byte, rune or line required"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.cursorPosition(g, c, raw)
+}
+
+func (s *session) cursorPosition(g *garland.Garland, c *garland.Cursor, raw json.RawMessage) (any, error) {
+	pos := c.Position()
+	return map[string]int64{"byte": pos.BytePos, "rune": pos.RunePos, "line": pos.Line, "column": pos.LineRune}, nil
+}
+
+func (s *session) insert(g *garland.Garland, c *garland.Cursor, raw json.RawMessage) (any, error) {
+	var p struct {
+		Text   string `json:"text"`
+		Before bool   `json:"before"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	r, err := c.InsertString(p.Text, nil, p.Before)
+	if err != nil {
+		return nil, err
+	}
+	return versionOf(r), nil
+}
+
+func (s *session) delete(g *garland.Garland, c *garland.Cursor, raw json.RawMessage) (any, error) {
+	var p struct {
+		Length int64 `json:"length"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	_, r, err := c.DeleteBytes(p.Length, false)
+	if err != nil {
+		return nil, err
+	}
+	return versionOf(r), nil
+}
+
+func (s *session) overwrite(g *garland.Garland, c *garland.Cursor, raw json.RawMessage) (any, error) {
+	var p struct {
+		Length int64  `json:"length"`
+		Text   string `json:"text"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	_, r, err := c.OverwriteBytes(p.Length, []byte(p.Text))
+	if err != nil {
+		return nil, err
+	}
+	return versionOf(r), nil
+}
+
+func (s *session) find(g *garland.Garland, c *garland.Cursor, raw json.RawMessage) (any, error) {
+	var p struct {
+		Pattern       string `json:"pattern"`
+		Regex         bool   `json:"regex"`
+		CaseSensitive bool   `json:"caseSensitive"`
+		WholeWord     bool   `json:"wholeWord"`
+		Backward      bool   `json:"backward"`
+		All           bool   `json:"all"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	var matches []garland.SearchResult
+	var err error
+	if p.Regex {
+		opts := garland.RegexOptions{CaseInsensitive: !p.CaseSensitive, Backward: p.Backward}
+		if p.All {
+			matches, err = c.FindRegexAll(p.Pattern, opts)
+		} else {
+			var m *garland.SearchResult
+			if m, err = c.FindRegex(p.Pattern, opts); m != nil {
+				matches = append(matches, *m)
+			}
+		}
+	} else {
+		opts := garland.SearchOptions{CaseSensitive: p.CaseSensitive, WholeWord: p.WholeWord, Backward: p.Backward}
+		if p.All {
+			matches, err = c.FindStringAll(p.Pattern, opts)
+		} else {
+			var m *garland.SearchResult
+			if m, err = c.FindString(p.Pattern, opts); m != nil {
+				matches = append(matches, *m)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]map[string]any, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, map[string]any{"start": m.ByteStart, "end": m.ByteEnd, "text": m.Match})
+	}
+	return out, nil
+}
+
+// gravities are the JSON spellings of decoration gravity.
+var gravities = map[string]garland.Gravity{
+	"":      garland.GravityDefault,
+	"left":  garland.GravityLeft,
+	"right": garland.GravityRight,
+}
+
+func (s *session) decorate(g *garland.Garland, raw json.RawMessage) (any, error) {
+	var p struct {
+		Entries []struct {
+			Key       string `json:"key"`
+			Namespace string `json:"namespace"`
+			Byte      *int64 `json:"byte"`
+			Gravity   string `json:"gravity"`
+		} `json:"entries"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	entries := make([]garland.DecorationEntry, 0, len(p.Entries))
+	for _, e := range p.Entries {
+		gravity, ok := gravities[e.Gravity]
+		if !ok {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown gravity %q", e.Gravity)}
+		}
+		entry := garland.DecorationEntry{Key: e.Key, Namespace: e.Namespace, Gravity: gravity}
+		if e.Byte != nil {
+			addr := garland.ByteAddress(*e.Byte)
+			entry.Address = &addr
+		}
+		entries = append(entries, entry)
+	}
+	r, err := g.Decorate(entries)
+	if err != nil {
+		return nil, err
+	}
+	return versionOf(r), nil
+}
+
+func (s *session) decoration(g *garland.Garland, raw json.RawMessage) (any, error) {
+	var p struct {
+		Key       string `json:"key"`
+		Namespace string `json:"namespace"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	addr, err := g.GetDecorationPositionIn(p.Namespace, p.Key)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{"byte": addr.Byte}, nil
+}
+
+func (s *session) transactionStart(g *garland.Garland, raw json.RawMessage) (any, error) {
+	var p struct {
+		Name string `json:"name"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	return nil, g.TransactionStart(p.Name)
+}
+
+func (s *session) transactionCommit(g *garland.Garland, raw json.RawMessage) (any, error) {
+	r, err := g.TransactionCommit()
+	if err != nil {
+		return nil, err
+	}
+	return versionOf(r), nil
+}
+
+func (s *session) transactionRollback(g *garland.Garland, raw json.RawMessage) (any, error) {
+	return nil, g.TransactionRollback()
+}
+
+func (s *session) undoSeek(g *garland.Garland, raw json.RawMessage) (any, error) {
+	var p struct {
+		Revision garland.RevisionID `json:"revision"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	return nil, g.UndoSeek(p.Revision)
+}
+
+func (s *session) forkSeek(g *garland.Garland, raw json.RawMessage) (any, error) {
+	var p struct {
+		Fork garland.ForkID `json:"fork"`
+	}
+	if err := decode(raw, &p); err != nil {
+		return nil, err
+	}
+	return nil, g.ForkSeek(p.Fork)
+}
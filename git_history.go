@@ -0,0 +1,306 @@
+package garland
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// git_history.go - revision history as a git object store.
+//
+// DESIGN: FileOptions.GitHistory names a bare git repository that
+// receives every revision as a commit, so an editing session can be
+// browsed, diffed and bisected with ordinary git tooling (git log -p,
+// gitk, a forge). The objects are written directly in git's loose
+// format - zlib-compressed "type size\x00body", named by SHA-1 - so no
+// git binary or library is involved.
+//
+//   - A revision is a commit of a one-entry tree: the document under
+//     the source's base name ("content" for other sources). Its parent
+//     is the revision before it in the lineage, and its author and
+//     committer time is RevisionInfo.Time. The message is the
+//     revision's transaction name (or "Revision N"), with
+//     Garland-Fork and Garland-Revision trailers.
+//   - One branch per fork, refs/heads/fork-N, at the fork's newest
+//     revision; HEAD names fork-0. A fork's branch shares its parent
+//     fork's commits up to the fork point, so git shows the undo tree
+//     as branches. Undo and fork seeks move no branch.
+//   - Git's object model is the dedup: a revision whose content some
+//     other revision already had reuses that blob (and tree), and an
+//     object already on disk is not written again.
+//   - Commits are written by the same commit hook as the journal: a
+//     mutation outside a transaction, a transaction commit, a history
+//     seek. A coalescing amend replaces its revision's commit (same
+//     parent) and moves the branch to the replacement. A streaming
+//     load is committed at the first commit after it completes.
+//   - Each revision stores the whole document as a blob, so this is
+//     meant for documents of editor size, not multi-gigabyte logs.
+//   - An existing repository is extended, not reset: the session's
+//     first commit has fork-0's previous tip as its parent, so sessions
+//     over the same file chain into one history. Other fork branches
+//     from an earlier session are overwritten when this session
+//     creates the same fork number.
+//   - A write failure never fails the edit: commits stop and
+//     GitHistoryError reports why.
+
+// gitCommit is a revision's commit, remembered so later revisions can
+// name it as parent and an amended revision can be recommitted.
+type gitCommit struct {
+	root   NodeID // the revision's root when committed
+	hash   string
+	parent string
+}
+
+// gitHistoryState writes one garland's revisions into a bare repository.
+type gitHistoryState struct {
+	fs   FileSystemInterface
+	dir  string
+	name string // the tree entry name
+
+	commits map[ForkRevision]gitCommit // keyed by owning fork
+	synced  map[ForkID]RevisionID      // first revision to re-check per fork
+	refs    map[ForkID]string          // branch tips written
+	written map[string]bool            // objects known to be on disk
+	base    string                     // fork-0's tip before this session
+
+	err error // first write failure; commits stop
+}
+
+// initGitHistoryLocked opens (creating if needed) the repository at dir
+// and commits the content as loaded. Caller must hold the write lock
+// (or own the unpublished garland).
+func (g *Garland) initGitHistoryLocked(dir string) {
+	fs := g.sourceFS
+	if fs == nil {
+		fs = g.lib.defaultFS
+	}
+	name := "content"
+	if g.sourcePath != "" {
+		name = filepath.Base(g.sourcePath)
+	}
+	gs := &gitHistoryState{
+		fs:      fs,
+		dir:     dir,
+		name:    name,
+		commits: make(map[ForkRevision]gitCommit),
+		synced:  make(map[ForkID]RevisionID),
+		refs:    make(map[ForkID]string),
+		written: make(map[string]bool),
+	}
+	g.gitHistory = gs
+	if gs.err = gs.initRepo(); gs.err != nil {
+		return
+	}
+	g.gitHistoryLocked()
+}
+
+// initRepo lays out a bare repository unless one is there, and reads
+// fork-0's existing tip.
+func (gs *gitHistoryState) initRepo() error {
+	for _, d := range []string{"objects", "refs/heads", "refs/tags"} {
+		if err := gs.fs.MkdirAll(path.Join(gs.dir, d)); err != nil {
+			return err
+		}
+	}
+	if meta, err := gs.fs.Stat(path.Join(gs.dir, "HEAD")); err != nil && err != ErrNotSupported {
+		return err
+	} else if err != nil || !meta.Exists {
+		if err := gs.fs.WriteFile(path.Join(gs.dir, "HEAD"), []byte("ref: refs/heads/fork-0\n")); err != nil {
+			return err
+		}
+		config := "[core]\n\trepositoryformatversion = 0\n\tfilemode = true\n\tbare = true\n"
+		if err := gs.fs.WriteFile(path.Join(gs.dir, "config"), []byte(config)); err != nil {
+			return err
+		}
+	}
+	if tip, err := gs.fs.ReadFile(path.Join(gs.dir, gitBranch(0))); err == nil {
+		if h := strings.TrimSpace(string(tip)); len(h) == 2*sha1.Size {
+			gs.base = h
+		}
+	}
+	return nil
+}
+
+// gitBranch is a fork's ref path.
+func gitBranch(fork ForkID) string {
+	return fmt.Sprintf("refs/heads/fork-%d", fork)
+}
+
+// gitHistoryLocked commits the current fork's revisions that have no
+// commit yet (or were amended since) and moves its branch. It is the
+// commit hook beside journalLocked. Caller must hold the write lock.
+func (g *Garland) gitHistoryLocked() {
+	gs := g.gitHistory
+	if gs == nil || gs.err != nil || g.transaction != nil {
+		return
+	}
+	if g.loader != nil && !g.loader.eofReached {
+		return
+	}
+	fork := g.currentFork
+	forkInfo, ok := g.forks[fork]
+	if !ok {
+		return
+	}
+
+	start := forkInfo.PrunedUpTo
+	if s, ok := gs.synced[fork]; ok {
+		start = max(start, s)
+	} else if fork != 0 {
+		if _, ok := gs.commits[ForkRevision{g.owningForkLocked(forkInfo.ParentRevision), forkInfo.ParentRevision}]; ok {
+			start = max(start, forkInfo.ParentRevision)
+		}
+	}
+
+	tip := ""
+	if start > 0 {
+		if c, ok := gs.commits[ForkRevision{g.owningForkLocked(start - 1), start - 1}]; ok {
+			tip = c.hash
+		}
+	}
+	for rev := start; rev <= forkInfo.HighestRevision; rev++ {
+		info := g.findRevisionInfo(fork, rev)
+		if info == nil || info.Revision != rev {
+			continue
+		}
+		key := ForkRevision{g.owningForkLocked(rev), rev}
+		if c, ok := gs.commits[key]; ok && c.root == info.RootID {
+			tip = c.hash
+			continue
+		}
+		st, ok := g.stateAtLocked(fork, rev)
+		if !ok {
+			continue // not held any more
+		}
+		parent := tip
+		if c, ok := gs.commits[key]; ok {
+			parent = c.parent // an amended revision keeps its place
+		} else if parent == "" && rev == 0 {
+			parent = gs.base
+		}
+		var content []byte
+		err := g.withStateLocked(st, func() error {
+			var err error
+			content, err = g.readBytesRangeInternal(0, g.totalBytes)
+			return err
+		})
+		if err == nil {
+			tip, err = gs.commit(content, parent, key.Fork, info)
+		}
+		if err != nil {
+			gs.err = err
+			return
+		}
+		gs.commits[key] = gitCommit{root: info.RootID, hash: tip, parent: parent}
+	}
+	gs.synced[fork] = forkInfo.HighestRevision
+
+	if tip != "" && gs.refs[fork] != tip {
+		if gs.err = gs.writeRef(fork, tip); gs.err == nil {
+			gs.refs[fork] = tip
+		}
+	}
+}
+
+// commit writes the blob, tree and commit for one revision and returns
+// the commit's hash.
+func (gs *gitHistoryState) commit(content []byte, parent string, fork ForkID, info *RevisionInfo) (string, error) {
+	blob, err := gs.writeObject("blob", content)
+	if err != nil {
+		return "", err
+	}
+	raw, _ := hex.DecodeString(blob)
+	tree, err := gs.writeObject("tree", append([]byte("100644 "+gs.name+"\x00"), raw...))
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "tree %s\n", tree)
+	if parent != "" {
+		fmt.Fprintf(&b, "parent %s\n", parent)
+	}
+	when := fmt.Sprintf("%d +0000", info.Time.Unix())
+	fmt.Fprintf(&b, "author garland <garland> %s\ncommitter garland <garland> %s\n\n", when, when)
+	subject := info.Name
+	if subject == "" {
+		subject = fmt.Sprintf("Revision %d", info.Revision)
+	}
+	fmt.Fprintf(&b, "%s\n\nGarland-Fork: %d\nGarland-Revision: %d\n", subject, fork, info.Revision)
+	return gs.writeObject("commit", b.Bytes())
+}
+
+// writeObject stores a loose object unless it exists, returning its
+// hash. The file is written beside its final name and renamed into
+// place, so a reader never sees a torn object.
+func (gs *gitHistoryState) writeObject(kind string, body []byte) (string, error) {
+	header := fmt.Sprintf("%s %d\x00", kind, len(body))
+	h := sha1.New()
+	h.Write([]byte(header))
+	h.Write(body)
+	hash := hex.EncodeToString(h.Sum(nil))
+	if gs.written[hash] {
+		return hash, nil
+	}
+
+	dir := path.Join(gs.dir, "objects", hash[:2])
+	name := path.Join(dir, hash[2:])
+	if meta, err := gs.fs.Stat(name); err == nil && meta.Exists {
+		gs.written[hash] = true
+		return hash, nil
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte(header))
+	zw.Write(body)
+	zw.Close()
+	if err := gs.fs.MkdirAll(dir); err != nil {
+		return "", err
+	}
+	if err := gs.fs.WriteFile(name+".tmp", z.Bytes()); err != nil {
+		return "", err
+	}
+	if err := gs.fs.Rename(name+".tmp", name); err != nil {
+		return "", err
+	}
+	gs.written[hash] = true
+	return hash, nil
+}
+
+// writeRef points fork's branch at hash.
+func (gs *gitHistoryState) writeRef(fork ForkID, hash string) error {
+	name := path.Join(gs.dir, gitBranch(fork))
+	if err := gs.fs.WriteFile(name+".lock", []byte(hash+"\n")); err != nil {
+		return err
+	}
+	return gs.fs.Rename(name+".lock", name)
+}
+
+// GitHistoryError reports why commits to the git history repository
+// stopped, or nil while they work (or it is not enabled).
+func (g *Garland) GitHistoryError() error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.gitHistory == nil {
+		return nil
+	}
+	return g.gitHistory.err
+}
+
+// GitHistoryCommit returns the hash of the commit recording revision rev
+// of the current fork's lineage, or "" when it has none (git history
+// not enabled, the revision pruned before it was committed, or still
+// inside a transaction).
+func (g *Garland) GitHistoryCommit(rev RevisionID) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.gitHistory == nil {
+		return ""
+	}
+	return g.gitHistory.commits[ForkRevision{g.owningForkLocked(rev), rev}].hash
+}
@@ -0,0 +1,145 @@
+package garland
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitObject reads and inflates a loose object.
+func gitObject(t *testing.T, dir, hash string) (kind string, body []byte) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "objects", hash[:2], hash[2:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(zr)
+	header, body, _ := bytes.Cut(raw, []byte{0})
+	kind, _, _ = strings.Cut(string(header), " ")
+	return kind, body
+}
+
+// gitLog follows first parents from a branch tip, returning each
+// commit's subject and document content, newest first.
+func gitLog(t *testing.T, dir, branch string) (subjects, contents []string) {
+	t.Helper()
+	tip, err := os.ReadFile(filepath.Join(dir, "refs", "heads", branch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := strings.TrimSpace(string(tip))
+	for hash != "" {
+		kind, body := gitObject(t, dir, hash)
+		if kind != "commit" {
+			t.Fatalf("%s is a %s", hash, kind)
+		}
+		headers, msg, _ := strings.Cut(string(body), "\n\n")
+		subject, _, _ := strings.Cut(msg, "\n")
+		subjects = append(subjects, subject)
+		hash = ""
+		for _, line := range strings.Split(headers, "\n") {
+			if tree, ok := strings.CutPrefix(line, "tree "); ok {
+				_, entry := gitObject(t, dir, tree)
+				_, ref, _ := bytes.Cut(entry, []byte{0})
+				_, blob := gitObject(t, dir, hex.EncodeToString(ref))
+				contents = append(contents, string(blob))
+			}
+			if parent, ok := strings.CutPrefix(line, "parent "); ok && hash == "" {
+				hash = parent
+			}
+		}
+	}
+	return subjects, contents
+}
+
+func TestGitHistoryCommitsRevisions(t *testing.T) {
+	repo := filepath.Join(t.TempDir(), "history.git")
+	lib, _ := Init(LibraryOptions{})
+	g, err := lib.Open(FileOptions{DataString: "one\n", GitHistory: repo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	c := g.NewCursor()
+	c.SeekByte(4)
+	c.InsertString("two\n", nil, true)
+	g.TransactionStart("add three")
+	c.InsertString("thr", nil, true)
+	c.InsertString("ee\n", nil, true)
+	g.TransactionCommit()
+
+	subjects, contents := gitLog(t, repo, "fork-0")
+	if want := []string{"add three", "Revision 1", "(initial)"}; strings.Join(subjects, "|") != strings.Join(want, "|") {
+		t.Errorf("subjects = %q, want %q", subjects, want)
+	}
+	if want := []string{"one\ntwo\nthree\n", "one\ntwo\n", "one\n"}; strings.Join(contents, "|") != strings.Join(want, "|") {
+		t.Errorf("contents = %q, want %q", contents, want)
+	}
+	if head, _ := os.ReadFile(filepath.Join(repo, "HEAD")); string(head) != "ref: refs/heads/fork-0\n" {
+		t.Errorf("HEAD = %q", head)
+	}
+
+	// An edit after undo forks: the new branch shares fork 0's history
+	// up to the fork point, and fork 0's branch stays where it was.
+	tip0, _ := os.ReadFile(filepath.Join(repo, "refs", "heads", "fork-0"))
+	g.UndoSeek(1)
+	c.SeekByte(0)
+	c.InsertString("zero\n", nil, true)
+	_, contents = gitLog(t, repo, "fork-1")
+	if want := []string{"zero\none\ntwo\n", "one\ntwo\n", "one\n"}; strings.Join(contents, "|") != strings.Join(want, "|") {
+		t.Errorf("fork-1 contents = %q, want %q", contents, want)
+	}
+	if tip, _ := os.ReadFile(filepath.Join(repo, "refs", "heads", "fork-0")); !bytes.Equal(tip, tip0) {
+		t.Errorf("fork-0 moved from %s to %s", tip0, tip)
+	}
+	if g.GitHistoryCommit(1) == "" || g.GitHistoryError() != nil {
+		t.Errorf("commit for revision 1 = %q, err = %v", g.GitHistoryCommit(1), g.GitHistoryError())
+	}
+}
+
+func TestGitHistoryDedupAndSessions(t *testing.T) {
+	repo := filepath.Join(t.TempDir(), "history.git")
+	lib, _ := Init(LibraryOptions{})
+	g, err := lib.Open(FileOptions{DataString: "same\n", GitHistory: repo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := g.NewCursor()
+	c.InsertString("x", nil, true)
+	c.SeekByte(0)
+	c.DeleteBytes(1, false) // back to the revision 0 content
+	g.Close()
+
+	// Three commits, but revisions 0 and 2 share one blob and tree.
+	objects := 0
+	filepath.Walk(filepath.Join(repo, "objects"), func(_ string, info os.FileInfo, _ error) error {
+		if !info.IsDir() {
+			objects++
+		}
+		return nil
+	})
+	if objects != 3+2+2 {
+		t.Errorf("%d objects, want 7 (3 commits, 2 trees, 2 blobs)", objects)
+	}
+
+	// A second session over the same repository continues fork 0.
+	g2, err := lib.Open(FileOptions{DataString: "same\n", GitHistory: repo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close()
+	g2.NewCursor().InsertString("!", nil, true)
+	_, contents := gitLog(t, repo, "fork-0")
+	if want := []string{"!same\n", "same\n", "same\n", "xsame\n", "same\n"}; strings.Join(contents, "|") != strings.Join(want, "|") {
+		t.Errorf("contents = %q, want %q", contents, want)
+	}
+}
@@ -0,0 +1,248 @@
+package garland
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// hex_view.go - the document as a hex dump, for hex editors.
+//
+// DESIGN: a hex editor shows bytes in fixed-width rows - offset, hex
+// cells, printable column - and edits them a nibble at a time. The
+// arithmetic is simple but every frontend redoes it (and the
+// read-modify-write of a half byte, which is where they get the end of
+// the document wrong). This file gives the three pieces:
+//
+//   - HexLayout is the row grid: byte offset <-> (row, column) for a
+//     number of bytes per row. Rows start at multiples of the row width
+//     from offset 0, whatever range is being shown.
+//   - A HexReader walks a byte range row by row, as structured HexRows
+//     (Next) or as the formatted text of `hexdump -C` (Read, an
+//     io.Reader): "00000010  48 65 6c 6c 6f 0a ...  |Hello.|". A range
+//     that starts or ends mid-row leaves those cells blank, so rows stay
+//     on the grid. Each row is read from the live revision when it is
+//     produced; a reader over a document being edited shows the text of
+//     the moment, row by row.
+//   - OverwriteNibble and OverwriteHex replace half bytes at a cursor,
+//     keeping the other half: one read and one overwrite, one revision.
+//     At the end of the document they extend it, the missing half
+//     being zero, as typing past the end of a hex editor does. Like
+//     OverwriteBytes they leave the cursor where it is.
+//   - The read and the overwrite are two steps; concurrent writers
+//     should serialize through SubmitEdit.
+
+// HexLayout is a fixed-width row grid over byte offsets.
+type HexLayout struct {
+	BytesPerRow int64 // below 1 means 16
+}
+
+func (l HexLayout) width() int64 {
+	if l.BytesPerRow < 1 {
+		return 16
+	}
+	return l.BytesPerRow
+}
+
+// RowCol returns the row and column of a byte offset.
+func (l HexLayout) RowCol(offset int64) (row, col int64) {
+	w := l.width()
+	return offset / w, offset % w
+}
+
+// Offset returns the byte offset of a row and column.
+func (l HexLayout) Offset(row, col int64) int64 {
+	return row*l.width() + col
+}
+
+// RowCount returns the rows needed to show size bytes.
+func (l HexLayout) RowCount(size int64) int64 {
+	w := l.width()
+	return (size + w - 1) / w
+}
+
+// HexDumpOptions controls a HexReader's rows.
+type HexDumpOptions struct {
+	Layout    HexLayout
+	Group     int  // bytes per cell group, separated by an extra space; below 1 means 8
+	Uppercase bool // A-F rather than a-f
+	NoText    bool // omit the |printable| column
+}
+
+// HexRow is one row of a hex dump.
+type HexRow struct {
+	Offset int64  // byte offset of the row's first cell
+	Skip   int    // leading cells before the range (blank)
+	Bytes  []byte // the row's bytes within the range
+	Text   string // the formatted row, without a newline
+}
+
+// HexReader produces the rows of a hex dump of a byte range.
+type HexReader struct {
+	g          *Garland
+	opts       HexDumpOptions
+	next, end  int64
+	pending    []byte // formatted output not yet returned by Read
+	pendingErr error
+}
+
+// NewHexReader returns a reader over bytes [start, end); end is clamped
+// to the document when Next reaches it, and end < 0 means the end of
+// the document.
+func (g *Garland) NewHexReader(start, end int64, opts HexDumpOptions) *HexReader {
+	if end < 0 {
+		end = 1<<63 - 1
+	}
+	return &HexReader{g: g, opts: opts, next: max(start, 0), end: end}
+}
+
+// Next returns the next row, or io.EOF after the last.
+func (h *HexReader) Next() (HexRow, error) {
+	end := min(h.end, h.g.ByteCount().Value)
+	if h.next >= end {
+		return HexRow{}, io.EOF
+	}
+	l := h.opts.Layout
+	row, col := l.RowCol(h.next)
+	rowStart := l.Offset(row, 0)
+	n := min(l.width()-col, end-h.next)
+	data := make([]byte, n)
+	got, err := h.g.ReadAt(data, h.next)
+	if err != nil && err != io.EOF {
+		return HexRow{}, err
+	}
+	data = data[:got]
+	h.next += n
+	r := HexRow{Offset: rowStart, Skip: int(col), Bytes: data}
+	r.Text = h.format(r)
+	return r, nil
+}
+
+// format lays out a row's text.
+func (h *HexReader) format(r HexRow) string {
+	group := h.opts.Group
+	if group < 1 {
+		group = 8
+	}
+	digits, offset := "0123456789abcdef", "%08x "
+	if h.opts.Uppercase {
+		digits, offset = "0123456789ABCDEF", "%08X "
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, offset, r.Offset)
+	width := int(h.opts.Layout.width())
+	for i := range width {
+		if i%group == 0 {
+			b.WriteByte(' ')
+		}
+		if j := i - r.Skip; j >= 0 && j < len(r.Bytes) {
+			c := r.Bytes[j]
+			b.WriteByte(digits[c>>4])
+			b.WriteByte(digits[c&0xf])
+			b.WriteByte(' ')
+		} else {
+			b.WriteString("   ")
+		}
+	}
+	if !h.opts.NoText {
+		b.WriteString(" |")
+		b.WriteString(strings.Repeat(" ", r.Skip))
+		for _, c := range r.Bytes {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('|')
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// Read reads the formatted dump, one row per line, as io.Reader.
+func (h *HexReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(h.pending) == 0 {
+			if h.pendingErr != nil {
+				break
+			}
+			row, err := h.Next()
+			if err != nil {
+				h.pendingErr = err
+				break
+			}
+			h.pending = []byte(row.Text + "\n")
+		}
+		c := copy(p[n:], h.pending)
+		h.pending = h.pending[c:]
+		n += c
+	}
+	if n == 0 && h.pendingErr != nil {
+		return 0, h.pendingErr
+	}
+	return n, nil
+}
+
+// OverwriteNibble replaces the high (low false) or low half of the byte
+// at the cursor with value (0-15). At the end of the document it
+// appends a byte whose other half is zero. The cursor does not move.
+func (c *Cursor) OverwriteNibble(low bool, value byte) (ChangeResult, error) {
+	if value > 0xf {
+		return ChangeResult{}, ErrInvalidHex
+	}
+	return c.overwriteNibbles([]byte{value}, low)
+}
+
+// OverwriteHex replaces nibbles from the high half of the byte at the
+// cursor with the hex digits (case-insensitive): "4a6" overwrites one
+// byte and the high half of the next. Past the end of the document it
+// appends. The cursor does not move.
+func (c *Cursor) OverwriteHex(digits string) (ChangeResult, error) {
+	nibbles := make([]byte, len(digits))
+	for i := range len(digits) {
+		switch d := digits[i]; {
+		case d >= '0' && d <= '9':
+			nibbles[i] = d - '0'
+		case d >= 'a' && d <= 'f':
+			nibbles[i] = d - 'a' + 10
+		case d >= 'A' && d <= 'F':
+			nibbles[i] = d - 'A' + 10
+		default:
+			return ChangeResult{}, ErrInvalidHex
+		}
+	}
+	return c.overwriteNibbles(nibbles, false)
+}
+
+// overwriteNibbles writes nibbles from the cursor's byte, starting with
+// its low half when low is set.
+func (c *Cursor) overwriteNibbles(nibbles []byte, low bool) (ChangeResult, error) {
+	if c.detached() {
+		return ChangeResult{}, ErrCursorNotFound
+	}
+	g := c.garland
+	pos := c.BytePos()
+	if len(nibbles) == 0 {
+		return ChangeResult{Fork: g.CurrentFork(), Revision: g.CurrentRevision()}, nil
+	}
+	first := 0
+	if low {
+		first = 1
+	}
+	data := make([]byte, (first+len(nibbles)+1)/2)
+	old, err := c.PeekBytes(int64(len(data)))
+	if err != nil {
+		return ChangeResult{}, err
+	}
+	copy(data, old)
+	for i, v := range nibbles {
+		k := first + i
+		if k%2 == 0 {
+			data[k/2] = v<<4 | data[k/2]&0x0f
+		} else {
+			data[k/2] = data[k/2]&0xf0 | v
+		}
+	}
+	_, res, err := g.overwriteBytesAt(c, pos, int64(len(old)), data)
+	return res, err
+}
@@ -0,0 +1,83 @@
+package garland
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHexReader(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "Hello, hex world!\n\x00\xff"})
+	defer g.Close()
+
+	l := HexLayout{BytesPerRow: 8}
+	if row, col := l.RowCol(19); row != 2 || col != 3 || l.Offset(row, col) != 19 || l.RowCount(20) != 3 {
+		t.Errorf("layout: RowCol(19) = %d,%d, RowCount(20) = %d", row, col, l.RowCount(20))
+	}
+
+	dump, err := io.ReadAll(g.NewHexReader(0, -1, HexDumpOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "00000000  48 65 6c 6c 6f 2c 20 68  65 78 20 77 6f 72 6c 64  |Hello, hex world|\n" +
+		"00000010  21 0a 00 ff                                       |!...|\n"
+	if string(dump) != want {
+		t.Errorf("dump =\n%s\nwant\n%s", dump, want)
+	}
+
+	// A range off the grid: blank leading cells, rows stay aligned.
+	h := g.NewHexReader(6, 13, HexDumpOptions{Layout: l, Group: 4, Uppercase: true})
+	var rows []string
+	for {
+		r, err := h.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, r.Text)
+	}
+	if got := strings.Join(rows, "\n"); got != "00000000                     20 68  |       h|\n"+
+		"00000008  65 78 20 77  6F           |ex wo|" {
+		t.Errorf("range rows =\n%s", got)
+	}
+}
+
+func TestOverwriteNibbles(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataBytes: []byte{0x12, 0x34}})
+	defer g.Close()
+	c := g.NewCursor()
+
+	steps := []struct {
+		pos  int64
+		do   func() (ChangeResult, error)
+		want string
+	}{
+		{0, func() (ChangeResult, error) { return c.OverwriteNibble(false, 0xa) }, "\xa2\x34"},
+		{1, func() (ChangeResult, error) { return c.OverwriteNibble(true, 0xf) }, "\xa2\x3f"},
+		{1, func() (ChangeResult, error) { return c.OverwriteHex("bEe") }, "\xa2\xbe\xe0"},
+		{3, func() (ChangeResult, error) { return c.OverwriteNibble(true, 7) }, "\xa2\xbe\xe0\x07"},
+	}
+	for i, s := range steps {
+		c.SeekByte(s.pos)
+		rev := g.CurrentRevision()
+		if _, err := s.do(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got := readAll(t, g); got != s.want {
+			t.Errorf("step %d: %q, want %q", i, got, s.want)
+		}
+		if g.CurrentRevision() != rev+1 || c.BytePos() != s.pos {
+			t.Errorf("step %d: revision %d -> %d, cursor %d", i, rev, g.CurrentRevision(), c.BytePos())
+		}
+	}
+	if _, err := c.OverwriteHex("0g"); err != ErrInvalidHex {
+		t.Errorf("bad digit: %v", err)
+	}
+	if _, err := c.OverwriteNibble(false, 16); err != ErrInvalidHex {
+		t.Errorf("bad nibble: %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package garland
+
+import (
+	"reflect"
+	"sync"
+)
+
+// highlight.go - syntax highlighting layers.
+//
+// DESIGN: every editor re-implements the same loop: tokenize lines,
+// carry a lexer state (open comment, string delimiter) from one line
+// to the next, throw away what an edit touched, and re-run only until
+// the state converges again. A HighlightLayer is that loop, driven by
+// a caller-supplied tokenizer.
+//
+//   - Tokens are cached per line, outside the tree: a highlight pass
+//     must never be a revision, an undo step, or a node rewrite (the
+//     same reasoning as ephemeral decorations). Token offsets are kept
+//     relative to their line, so lines an edit did not touch stay valid
+//     wherever the edit moved them.
+//   - Invalidation is by version, not by hook: the layer remembers the
+//     treeState it tokenized and, on the next query, compares it with
+//     the live one using the shared-subtree walk the OT diff uses. Only
+//     lines overlapping the leaves that differ are dropped, so undo,
+//     redo, ForkSeek and transactions are all just "another version".
+//     If the remembered version is gone (pruned), everything is dropped.
+//   - Re-tokenizing is lazy: nothing runs at edit time. A query walks
+//     forward from the first invalid line up to the lines it needs; a
+//     kept line whose entry state equals the state now reaching it is
+//     reused as is, so a local edit costs one or two lines unless it
+//     changes the state (typing "/*" re-tokenizes down to the query).
+//   - The tokenizer runs with the Garland locked and must not call back
+//     into it. HighlightState values are compared with ==, so they
+//     should be comparable (strings, ints, small structs); a state of
+//     an uncomparable type never matches, which is correct but slow.
+
+// HighlightToken is one classified span. From a tokenizer, offsets are
+// relative to the start of the line; from a query they are absolute.
+type HighlightToken struct {
+	Start int64
+	End   int64
+	Class string
+}
+
+// HighlightState is the tokenizer's carry-over from one line to the
+// next. It should be comparable with ==.
+type HighlightState interface{}
+
+// HighlightTokenizer classifies one line (including its newline, if
+// any) given the state left by the previous line, and returns the
+// line's tokens and the state for the next line.
+type HighlightTokenizer func(line []byte, state HighlightState) ([]HighlightToken, HighlightState)
+
+// highlightLine is the cached result of tokenizing one line.
+type highlightLine struct {
+	tokens []HighlightToken // line-relative
+	entry  HighlightState
+	exit   HighlightState
+}
+
+// HighlightLayer caches a tokenizer's output for a Garland and keeps
+// it in step with edits. Create one with NewHighlightLayer.
+type HighlightLayer struct {
+	g        *Garland
+	tokenize HighlightTokenizer
+	initial  HighlightState
+
+	mu    sync.Mutex
+	seen  treeState        // the version lines were tokenized against
+	lines []*highlightLine // one per line of seen; nil = not tokenized
+	valid int              // lines[:valid] are known to be current
+}
+
+// NewHighlightLayer returns a highlight layer running tokenize over
+// the document, starting the first line in state initial. Nothing is
+// tokenized until the layer is queried.
+func (g *Garland) NewHighlightLayer(tokenize HighlightTokenizer, initial HighlightState) *HighlightLayer {
+	return &HighlightLayer{g: g, tokenize: tokenize, initial: initial}
+}
+
+// sameHighlightState reports whether two tokenizer states are equal,
+// treating uncomparable states as different.
+func sameHighlightState(a, b HighlightState) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	ta := reflect.TypeOf(a)
+	return ta == reflect.TypeOf(b) && ta.Comparable() && a == b
+}
+
+// syncLocked brings the line cache to the live version, dropping the
+// lines that overlap what changed. Caller must hold h.mu and g.mu.
+func (h *HighlightLayer) syncLocked() {
+	g := h.g
+	g.ensureCountsLocked()
+	live := g.liveStateLocked()
+	prev := h.seen
+	old, now := prev.rootSnap(), live.rootSnap()
+	h.seen = live
+	lineCount := int(g.totalLines + 1)
+	if old == now && len(h.lines) == lineCount {
+		return
+	}
+	if old == nil || now == nil {
+		h.lines, h.valid = make([]*highlightLine, lineCount), 0
+		return
+	}
+
+	shorter := min(old.byteCount, now.byteCount)
+	pre, _, err := sharedRun(
+		newDiffWalker(g, prev, false), newDiffWalker(g, live, false), shorter)
+	var suf int64
+	if err == nil {
+		suf, _, err = sharedRun(
+			newDiffWalker(g, prev, true), newDiffWalker(g, live, true), shorter-pre)
+	}
+	var firstLine, tailLine int64
+	if err == nil {
+		firstLine, _, err = g.byteToLineRuneInternalUnlocked(pre)
+	}
+	if err == nil && suf > 0 {
+		tailLine, _, err = g.byteToLineRuneInternalUnlocked(now.byteCount - suf)
+	}
+	if err != nil {
+		h.lines, h.valid = make([]*highlightLine, lineCount), 0
+		return
+	}
+
+	// Lines before the one holding the first difference are unchanged;
+	// so are the lines wholly after the one holding the start of the
+	// shared suffix, which keep their content under new numbers.
+	lines := make([]*highlightLine, lineCount)
+	copy(lines, h.lines[:min(int(firstLine), len(h.lines))])
+	if suf > 0 {
+		delta := lineCount - len(h.lines)
+		for i := int(tailLine) + 1; i < lineCount; i++ {
+			if j := i - delta; j >= 0 && j < len(h.lines) {
+				lines[i] = h.lines[j]
+			}
+		}
+	}
+	h.lines, h.valid = lines, min(h.valid, int(firstLine))
+}
+
+// lineBoundsLocked returns the byte range of line (newline included).
+// Caller must hold g.mu.
+func (h *HighlightLayer) lineBoundsLocked(line int64) (int64, int64, error) {
+	g := h.g
+	start, err := g.lineRuneToByteUnlocked(line, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	if line == g.totalLines {
+		return start, g.totalBytes, nil
+	}
+	end, err := g.lineRuneToByteUnlocked(line+1, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// ensureLocked tokenizes forward from the first invalid line through
+// line upTo. Caller must hold h.mu and the g.mu write lock.
+func (h *HighlightLayer) ensureLocked(upTo int) error {
+	for h.valid <= upTo {
+		i := h.valid
+		entry := h.initial
+		if i > 0 {
+			entry = h.lines[i-1].exit
+		}
+		if l := h.lines[i]; l == nil || !sameHighlightState(l.entry, entry) {
+			start, end, err := h.lineBoundsLocked(int64(i))
+			if err != nil {
+				return err
+			}
+			text, err := h.g.readBytesRangeInternal(start, end-start)
+			if err != nil {
+				return err
+			}
+			tokens, exit := h.tokenize(text, entry)
+			h.lines[i] = &highlightLine{tokens: clampHighlightTokens(tokens, end-start), entry: entry, exit: exit}
+		}
+		h.valid++
+	}
+	return nil
+}
+
+// clampHighlightTokens drops empty spans and trims spans to the line.
+func clampHighlightTokens(tokens []HighlightToken, length int64) []HighlightToken {
+	out := tokens[:0:0]
+	for _, t := range tokens {
+		t.Start, t.End = max(t.Start, 0), min(t.End, length)
+		if t.Start < t.End {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// LineTokens returns the tokens of line, with absolute byte offsets,
+// tokenizing whatever is needed to reach it.
+func (h *HighlightLayer) LineTokens(line int64) ([]HighlightToken, error) {
+	return h.tokensIn(line, line, 0, -1)
+}
+
+// TokensInByteRange returns the tokens overlapping [start, end), with
+// absolute byte offsets, in document order.
+func (h *HighlightLayer) TokensInByteRange(start, end int64) ([]HighlightToken, error) {
+	if start < 0 || end < start {
+		return nil, ErrInvalidPosition
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	g := h.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+
+	if end > g.totalBytes {
+		return nil, ErrInvalidPosition
+	}
+	first, _, err := g.byteToLineRuneInternalUnlocked(start)
+	if err != nil {
+		return nil, err
+	}
+	last, _, err := g.byteToLineRuneInternalUnlocked(max(end-1, start))
+	if err != nil {
+		return nil, err
+	}
+	return h.tokensInLocked(first, last, start, end)
+}
+
+// tokensIn locks and collects the tokens of lines [first, last].
+func (h *HighlightLayer) tokensIn(first, last, start, end int64) ([]HighlightToken, error) {
+	if first < 0 {
+		return nil, ErrInvalidPosition
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.g.mu.Lock()
+	defer h.g.mu.Unlock()
+	h.g.ensureCountsLocked()
+	if last > h.g.totalLines {
+		return nil, ErrInvalidPosition
+	}
+	return h.tokensInLocked(first, last, start, end)
+}
+
+// tokensInLocked collects the absolute tokens of lines [first, last]
+// that overlap [start, end) (end < 0: no byte limit). Caller must hold
+// h.mu and the g.mu write lock.
+func (h *HighlightLayer) tokensInLocked(first, last, start, end int64) ([]HighlightToken, error) {
+	h.syncLocked()
+	if err := h.ensureLocked(int(last)); err != nil {
+		return nil, err
+	}
+	var out []HighlightToken
+	for line := first; line <= last; line++ {
+		lineStart, _, err := h.lineBoundsLocked(line)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range h.lines[line].tokens {
+			t.Start += lineStart
+			t.End += lineStart
+			if end < 0 || t.End > start && t.Start < end {
+				out = append(out, t)
+			}
+		}
+	}
+	return out, nil
+}
+
+// Reset drops every cached line, for when the tokenizer's rules change
+// (a new language mode, a setting that alters classification).
+func (h *HighlightLayer) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lines, h.valid = nil, 0
+	h.seen = treeState{}
+}
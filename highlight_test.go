@@ -0,0 +1,132 @@
+package garland
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// commentTokenizer classifies words as "word", or "comment" inside
+// /* ... */ (which may span lines), and counts the lines it is run on.
+func commentTokenizer(calls *int) HighlightTokenizer {
+	return func(line []byte, state HighlightState) ([]HighlightToken, HighlightState) {
+		*calls++
+		inComment := state == "comment"
+		var tokens []HighlightToken
+		for i := 0; i < len(line); {
+			switch {
+			case !inComment && bytes.HasPrefix(line[i:], []byte("/*")):
+				inComment = true
+				i += 2
+			case inComment && bytes.HasPrefix(line[i:], []byte("*/")):
+				inComment = false
+				i += 2
+			case line[i] == ' ' || line[i] == '\n':
+				i++
+			default:
+				j := i
+				for j < len(line) && line[j] != ' ' && line[j] != '\n' {
+					j++
+				}
+				class := "word"
+				if inComment {
+					class = "comment"
+				}
+				tokens = append(tokens, HighlightToken{Start: int64(i), End: int64(j), Class: class})
+				i = j
+			}
+		}
+		if inComment {
+			return tokens, "comment"
+		}
+		return tokens, ""
+	}
+}
+
+func TestHighlightLayerRetokenizesOnlyWhatChanged(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&text, "line%02d alpha beta\n", i)
+	}
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: text.String(), MaxLeafSize: 32})
+	defer g.Close()
+
+	calls := 0
+	h := g.NewHighlightLayer(commentTokenizer(&calls), "")
+	if _, err := h.LineTokens(39); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 40 {
+		t.Fatalf("first query tokenized %d lines, want 40", calls)
+	}
+
+	// A local edit re-tokenizes the touched lines only.
+	c := g.NewCursor()
+	c.SeekLine(20, 0)
+	c.InsertString("new ", nil, true)
+	calls = 0
+	tokens, _ := h.LineTokens(39)
+	if calls == 0 || calls > 3 {
+		t.Errorf("local edit re-tokenized %d lines", calls)
+	}
+	if len(tokens) != 3 || tokens[0].Start != g.ByteCount().Value-18 {
+		t.Errorf("line 39 tokens %+v", tokens)
+	}
+	if tokens, _ := h.LineTokens(20); len(tokens) != 4 || tokens[0].Class != "word" {
+		t.Errorf("edited line tokens %+v", tokens)
+	}
+
+	// Opening a comment changes the state, so the lines below follow.
+	rev := g.CurrentRevision()
+	c.SeekLine(10, 0)
+	c.InsertString("/* ", nil, true)
+	if tokens, _ := h.LineTokens(30); tokens[0].Class != "comment" {
+		t.Errorf("after /*: line 30 is %+v", tokens)
+	}
+
+	// Undo is just another version.
+	g.UndoSeek(rev)
+	calls = 0
+	if tokens, _ := h.LineTokens(30); tokens[0].Class != "word" {
+		t.Errorf("after undo: line 30 is %+v", tokens)
+	}
+	if calls == 0 || calls > 25 {
+		t.Errorf("undo re-tokenized %d lines", calls)
+	}
+}
+
+func TestHighlightLayerIsLazyAndRangeQueries(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "a b\nc /* d\ne */ f\ng", MaxLeafSize: 4})
+	defer g.Close()
+
+	calls := 0
+	h := g.NewHighlightLayer(commentTokenizer(&calls), "")
+	if tokens, _ := h.LineTokens(0); len(tokens) != 2 || calls != 1 {
+		t.Errorf("line 0: %+v after %d calls", tokens, calls)
+	}
+
+	tokens, err := h.TokensInByteRange(5, 14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, fmt.Sprintf("%d-%d:%s", tok.Start, tok.End, tok.Class))
+	}
+	if strings.Join(got, " ") != "9-10:comment 11-12:comment" {
+		t.Errorf("range tokens %v", got)
+	}
+	if _, err := h.LineTokens(4); err != ErrInvalidPosition {
+		t.Errorf("line past end: err = %v", err)
+	}
+
+	calls = 0
+	h.Reset()
+	h.LineTokens(3)
+	if calls != 4 {
+		t.Errorf("after Reset tokenized %d lines, want 4", calls)
+	}
+}
@@ -0,0 +1,94 @@
+package garland
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func decodeHistory(t *testing.T, data []byte) []HistoryRecord {
+	t.Helper()
+	var records []HistoryRecord
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var rec HistoryRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestExportHistoryJSONL(t *testing.T) {
+	g, c := openWithRevisions(t, []string{"one\n", "two\n"}) // revs 1..2
+	if err := g.TransactionStart("replace"); err != nil {
+		t.Fatal(err)
+	}
+	c.SeekByte(0)
+	c.OverwriteBytes(3, []byte("REV"))
+	if _, err := g.TransactionCommit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := g.ExportHistoryJSONL(&buf, HistoryExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	records := decodeHistory(t, buf.Bytes())
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4:\n%s", len(records), buf.String())
+	}
+	first := records[0]
+	if first.Revision != 0 || first.Bytes != 13 || first.Lines != 1 || first.BytesInserted != 0 {
+		t.Errorf("baseline = %+v", first)
+	}
+	if r := records[1]; r.BytesInserted != 4 || r.LinesInserted != 1 || r.BytesDeleted != 0 || r.Bytes != 17 || r.Lines != 2 {
+		t.Errorf("rev 1 = %+v", r)
+	}
+	if r := records[3]; r.Name != "replace" || r.BytesInserted != 3 || r.BytesDeleted != 3 || r.LinesInserted != 0 || r.Time.IsZero() {
+		t.Errorf("rev 3 = %+v", r)
+	}
+	for _, r := range records {
+		if r.Patch != nil {
+			t.Errorf("rev %d has a patch without Patches", r.Revision)
+		}
+	}
+}
+
+func TestExportHistoryJSONLPatchesAcrossFork(t *testing.T) {
+	g, c := openWithRevisions(t, []string{"one\n", "two\n"}) // revs 1..2
+	if err := g.UndoSeek(1); err != nil {
+		t.Fatal(err)
+	}
+	c.SeekByte(0)
+	if _, err := c.InsertString(">", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	fork := g.CurrentFork()
+
+	var buf bytes.Buffer
+	if err := g.ExportHistoryJSONL(&buf, HistoryExportOptions{Patches: true}); err != nil {
+		t.Fatal(err)
+	}
+	records := decodeHistory(t, buf.Bytes())
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3:\n%s", len(records), buf.String())
+	}
+	if records[1].Fork != 0 || records[2].Fork != fork {
+		t.Errorf("forks = %d, %d; want 0, %d", records[1].Fork, records[2].Fork, fork)
+	}
+
+	// Replaying the patches from the baseline reproduces the text.
+	text := "rev0 content\n"
+	for _, r := range records[1:] {
+		var err error
+		if text, err = r.Patch.ApplyToString(text); err != nil {
+			t.Fatalf("rev %d: %v", r.Revision, err)
+		}
+	}
+	if want := readAll(t, g); text != want {
+		t.Errorf("replayed %q, want %q", text, want)
+	}
+}
@@ -0,0 +1,243 @@
+package garland
+
+import "bytes"
+
+// input_edit.go - edits in the shape incremental parsers consume.
+//
+// DESIGN: tree-sitter and parsers modelled on it re-parse incrementally
+// when told what changed as (start_byte, old_end_byte, new_end_byte)
+// plus the same three positions as (row, column) points. InputEdit is
+// that record, and it is derived from revisions exactly as OpsBetween
+// derives OT operations (ot.go): the trees are compared, skipping the
+// subtrees they share, so the cost is what the edit touched.
+//
+//   - InputEditsBetween gives the edits between two revisions of the
+//     current fork; WatchInputEdits calls back with the edits at every
+//     settled state, with the timing and delivery rules of decoration
+//     watches (decoration_watch.go): each edit outside a transaction,
+//     a commit, UndoSeek / ForkSeek; callbacks run outside the lock, in
+//     order, shortly after the change.
+//   - A version change yields one edit per changed span, in document
+//     order, each in the coordinates the ones before it leave - the
+//     order a parser applies them in. A transaction touching several
+//     places is several edits.
+//   - Rows are 0-based lines and columns are BYTES from the line start,
+//     as tree-sitter counts them.
+//   - Should the previously reported version no longer be resolvable
+//     (pruned away), the watch reports the whole document as replaced:
+//     a full re-parse, never a wrong incremental one.
+//   - Growth of a streaming load is not an edit; parse once the load
+//     completes.
+
+// TextPoint is a position as a 0-based row and a byte column.
+type TextPoint struct {
+	Row    int64
+	Column int64
+}
+
+// InputEdit describes one change for an incremental parser: the bytes
+// [StartByte, OldEndByte) became [StartByte, NewEndByte).
+type InputEdit struct {
+	StartByte   int64
+	OldEndByte  int64
+	NewEndByte  int64
+	StartPoint  TextPoint
+	OldEndPoint TextPoint
+	NewEndPoint TextPoint
+}
+
+// inputEditWatch is one registered WatchInputEdits callback.
+type inputEditWatch struct {
+	fn func(InputEdit)
+}
+
+// inputEditBaseline is the version the input-edit watches last heard
+// about, with its length and end point for the whole-document fallback.
+type inputEditBaseline struct {
+	st    treeState
+	bytes int64
+	end   TextPoint
+}
+
+// advancePoint returns p moved over data.
+func advancePoint(p TextPoint, data []byte) TextPoint {
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		return TextPoint{Row: p.Row + int64(bytes.Count(data, []byte{'\n'})), Column: int64(len(data) - i - 1)}
+	}
+	return TextPoint{Row: p.Row, Column: p.Column + int64(len(data))}
+}
+
+// pointAtLocked returns the point of byte pos in the live version.
+// Caller must hold the write lock.
+func (g *Garland) pointAtLocked(pos int64) (TextPoint, error) {
+	g.ensureCountsLocked()
+	line, _, err := g.byteToLineRuneInternalUnlocked(pos)
+	if err != nil {
+		return TextPoint{}, err
+	}
+	res, err := g.findLeafByLineUnlocked(line, 0)
+	if err != nil {
+		return TextPoint{}, err
+	}
+	return TextPoint{Row: line, Column: pos - res.LineByteStart}, nil
+}
+
+// inputEditsLocked derives the edits from version a to version b, one
+// per changed span, in the order a parser applies them: each in the
+// coordinates the edits before it leave. Caller must hold the write
+// lock.
+func (g *Garland) inputEditsLocked(a, b treeState) ([]InputEdit, error) {
+	spans, err := g.diffSpansLocked(a, b)
+	if err != nil || len(spans) == 0 {
+		return nil, err
+	}
+	// Up to each edit's start the partly edited text is b's, so its
+	// point is b's.
+	edits := make([]InputEdit, 0, len(spans))
+	err = g.withStateLocked(b, func() error {
+		shift := int64(0)
+		for _, span := range spans {
+			start := span.start + shift
+			point, err := g.pointAtLocked(start)
+			if err != nil {
+				return err
+			}
+			edits = append(edits, InputEdit{
+				StartByte:   start,
+				OldEndByte:  start + int64(len(span.deleted)),
+				NewEndByte:  start + int64(len(span.inserted)),
+				StartPoint:  point,
+				OldEndPoint: advancePoint(point, span.deleted),
+				NewEndPoint: advancePoint(point, span.inserted),
+			})
+			shift += int64(len(span.inserted) - len(span.deleted))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
+// inputEditLocked derives one edit covering every change from version a
+// to version b, for callers that invalidate a range; ok is false when
+// they hold the same text. Caller must hold the write lock.
+func (g *Garland) inputEditLocked(a, b treeState) (edit InputEdit, ok bool, err error) {
+	edits, err := g.inputEditsLocked(a, b)
+	if err != nil || len(edits) == 0 {
+		return InputEdit{}, false, err
+	}
+	first, last := edits[0], edits[len(edits)-1]
+	edit = InputEdit{
+		StartByte:   first.StartByte,
+		OldEndByte:  last.OldEndByte,
+		NewEndByte:  last.NewEndByte,
+		StartPoint:  first.StartPoint,
+		OldEndPoint: last.OldEndPoint,
+		NewEndPoint: last.NewEndPoint,
+	}
+	if len(edits) == 1 {
+		return edit, true, nil
+	}
+	// The last edit's old end is in partly edited coordinates; map it
+	// back to a's.
+	for _, e := range edits[:len(edits)-1] {
+		edit.OldEndByte -= e.NewEndByte - e.OldEndByte
+	}
+	if err := g.withStateLocked(a, func() error {
+		edit.OldEndPoint, err = g.pointAtLocked(edit.OldEndByte)
+		return err
+	}); err != nil {
+		return InputEdit{}, false, err
+	}
+	return edit, true, nil
+}
+
+// InputEditsBetween returns the edits turning revision from of the
+// current fork into revision to: one per changed span, in order, each
+// in the coordinates the ones before it leave (none when their text is
+// the same).
+func (g *Garland) InputEditsBetween(from, to RevisionID) ([]InputEdit, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.transaction != nil {
+		return nil, ErrTransactionPending
+	}
+	if g.loader != nil && !g.loader.eofReached {
+		return nil, ErrNotReady
+	}
+	a, err := g.revisionStateLocked(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := g.revisionStateLocked(to)
+	if err != nil {
+		return nil, err
+	}
+	return g.inputEditsLocked(a, b)
+}
+
+// inputEditBaselineLocked captures the live version. Caller must hold
+// the write lock.
+func (g *Garland) inputEditBaselineLocked() inputEditBaseline {
+	end, _ := g.pointAtLocked(g.totalBytes)
+	return inputEditBaseline{st: g.liveStateLocked(), bytes: g.totalBytes, end: end}
+}
+
+// checkInputEditWatchesLocked queues the edit from the last reported
+// version to the live one for every watch. Caller must hold the write
+// lock.
+func (g *Garland) checkInputEditWatchesLocked() {
+	if len(g.inputEditWatches) == 0 {
+		return
+	}
+	last := g.inputEditLast
+	g.inputEditLast = g.inputEditBaselineLocked()
+	edits, err := g.inputEditsLocked(last.st, g.inputEditLast.st)
+	if err != nil {
+		edits = []InputEdit{{
+			OldEndByte:  last.bytes,
+			NewEndByte:  g.inputEditLast.bytes,
+			OldEndPoint: last.end,
+			NewEndPoint: g.inputEditLast.end,
+		}}
+	}
+	if len(edits) == 0 {
+		return
+	}
+	events := make([]func(), 0, len(g.inputEditWatches))
+	for _, w := range g.inputEditWatches {
+		fn := w.fn
+		events = append(events, func() {
+			for _, edit := range edits {
+				fn(edit)
+			}
+		})
+	}
+	g.watchQueue.push(events)
+}
+
+// WatchInputEdits calls fn with the edits at each settled state (see the
+// file comment). It returns a function that cancels the watch.
+func (g *Garland) WatchInputEdits(fn func(InputEdit)) func() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.inputEditWatches) == 0 {
+		g.inputEditLast = g.inputEditBaselineLocked()
+	}
+	w := &inputEditWatch{fn: fn}
+	g.inputEditWatches = append(g.inputEditWatches, w)
+
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for i, other := range g.inputEditWatches {
+			if other == w {
+				g.inputEditWatches = append(g.inputEditWatches[:i:i], g.inputEditWatches[i+1:]...)
+				break
+			}
+		}
+	}
+}
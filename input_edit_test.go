@@ -0,0 +1,130 @@
+package garland
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInputEditsBetween(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "func a() {\n\treturn\n}\n", MaxLeafSize: 8})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekLine(1, 1)
+	c.OverwriteBytes(6, []byte("x := 1\n\tx++"))
+
+	edits, err := g.InputEditsBetween(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := InputEdit{
+		StartByte: 12, OldEndByte: 18, NewEndByte: 23,
+		StartPoint:  TextPoint{Row: 1, Column: 1},
+		OldEndPoint: TextPoint{Row: 1, Column: 7},
+		NewEndPoint: TextPoint{Row: 2, Column: 4},
+	}
+	if len(edits) != 1 || edits[0] != want {
+		t.Fatalf("edits = %+v, want [%+v]", edits, want)
+	}
+
+	// Undoing is the reverse edit.
+	edits, _ = g.InputEditsBetween(1, 0)
+	if len(edits) != 1 || edits[0].OldEndByte != 23 || edits[0].NewEndPoint != (TextPoint{Row: 1, Column: 7}) {
+		t.Fatalf("reverse edits = %+v", edits)
+	}
+	if edits, _ := g.InputEditsBetween(1, 1); len(edits) != 0 {
+		t.Fatalf("same revision: %+v, want none", edits)
+	}
+}
+
+func TestInputEditsSeveralPlaces(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&text, "line %02d\n", i)
+	}
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: text.String(), MaxLeafSize: 16})
+	defer g.Close()
+
+	g.TransactionStart("two places")
+	c := g.NewCursor()
+	c.SeekByte(240) // line 30
+	c.DeleteBytes(5, false)
+	c.SeekByte(13)
+	c.InsertString("new ", nil, true)
+	g.TransactionCommit()
+
+	// One edit per place, the second in the coordinates the first leaves.
+	edits, err := g.InputEditsBetween(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InputEdit{{
+		StartByte: 13, OldEndByte: 13, NewEndByte: 17,
+		StartPoint:  TextPoint{Row: 1, Column: 5},
+		OldEndPoint: TextPoint{Row: 1, Column: 5},
+		NewEndPoint: TextPoint{Row: 1, Column: 9},
+	}, {
+		StartByte: 244, OldEndByte: 249, NewEndByte: 244,
+		StartPoint:  TextPoint{Row: 30, Column: 0},
+		OldEndPoint: TextPoint{Row: 30, Column: 5},
+		NewEndPoint: TextPoint{Row: 30, Column: 0},
+	}}
+	if len(edits) != 2 || edits[0] != want[0] || edits[1] != want[1] {
+		t.Fatalf("edits = %+v, want %+v", edits, want)
+	}
+}
+
+func TestWatchInputEdits(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "ab\ncd\n"})
+	defer g.Close()
+
+	ch := make(chan InputEdit, 16)
+	cancel := g.WatchInputEdits(func(e InputEdit) { ch <- e })
+	next := func() InputEdit {
+		t.Helper()
+		select {
+		case e := <-ch:
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for an edit")
+		}
+		return InputEdit{}
+	}
+
+	c := g.NewCursor()
+	c.SeekByte(4)
+	c.InsertString("X\n", nil, false)
+	if e := next(); e.StartByte != 4 || e.OldEndByte != 4 || e.NewEndByte != 6 ||
+		e.StartPoint != (TextPoint{1, 1}) || e.NewEndPoint != (TextPoint{2, 0}) {
+		t.Fatalf("insert edit = %+v", e)
+	}
+
+	// A transaction is reported once, at commit.
+	g.TransactionStart("two")
+	c.SeekByte(0)
+	c.DeleteBytes(1, false)
+	c.SeekByte(6)
+	c.InsertString("!", nil, false)
+	g.TransactionCommit()
+	if e := next(); e.StartByte != 0 || e.OldEndByte != 7 || e.NewEndByte != 7 {
+		t.Fatalf("transaction edit = %+v", e)
+	}
+
+	g.UndoSeek(0)
+	if e := next(); e.StartByte != 0 || e.OldEndByte != 7 || e.NewEndByte != 5 {
+		t.Fatalf("undo edit = %+v", e)
+	}
+
+	cancel()
+	c.InsertString("z", nil, false)
+	select {
+	case e := <-ch:
+		t.Fatalf("edit %+v after cancel", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,321 @@
+package garland
+
+import (
+	"fmt"
+	"sort"
+)
+
+// invariants.go - exported consistency checker for tests and fuzzing.
+//
+// CheckInvariants walks every revision the garland can still resolve
+// and verifies the structural promises the rest of the library relies
+// on, reporting each broken one instead of stopping at the first:
+//
+//   - Reachability: every revision's root, and every child an internal
+//     node names, exists in the registry and resolves a snapshot at
+//     that revision.
+//   - Weights: an internal node's byte/rune/line counts (and its
+//     runes-after-last-newline) are those of its children; a resident
+//     leaf's counts and line index are those of its bytes.
+//   - Decorations: every leaf decoration has a valid key and sits
+//     within the leaf (0 <= offset <= length).
+//   - Live state: the current root is the current revision's root
+//     (outside a transaction), the cached totals are the root's
+//     counts, and cursors lie within the document.
+//   - Fork metadata: every fork has a known parent, branched at a
+//     revision the parent has, and no revision is recorded past its
+//     fork's highest.
+//
+// Subtrees shared between revisions are checked once. Leaves whose
+// bytes are not resident (warm, cold, placeholder) have their counts
+// checked against their parents only - CheckInvariants never performs
+// I/O. It takes the write lock and is meant for tests, fuzzers and
+// debugging, not hot paths: the cost is the size of all reachable
+// history.
+
+// InvariantViolation describes one broken invariant.
+type InvariantViolation struct {
+	// Kind names the invariant: "reachability", "weights", "leaf",
+	// "decoration", "live", "fork" or "cursor".
+	Kind string
+
+	// Fork and Revision locate the version where it was found; Node is
+	// the node involved (0 when none).
+	Fork     ForkID
+	Revision RevisionID
+	Node     NodeID
+
+	Detail string
+}
+
+// String formats the violation for test output.
+func (v InvariantViolation) String() string {
+	return fmt.Sprintf("%s (fork %d, rev %d, node %d): %s", v.Kind, v.Fork, v.Revision, v.Node, v.Detail)
+}
+
+// invariantChecker accumulates violations for one CheckInvariants run.
+type invariantChecker struct {
+	g          *Garland
+	violations []InvariantViolation
+	seen       map[*NodeSnapshot]bool
+}
+
+func (ic *invariantChecker) fail(kind string, fork ForkID, rev RevisionID, node NodeID, format string, args ...any) {
+	ic.violations = append(ic.violations, InvariantViolation{
+		Kind: kind, Fork: fork, Revision: rev, Node: node,
+		Detail: fmt.Sprintf(format, args...),
+	})
+}
+
+// CheckInvariants verifies the tree, history and cursor invariants
+// and returns every violation found; nil means the garland is sound.
+func (g *Garland) CheckInvariants() []InvariantViolation {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ic := &invariantChecker{
+		g:    g,
+		seen: make(map[*NodeSnapshot]bool),
+	}
+	ic.checkForks()
+
+	// Every recorded revision, in a stable order for readable output.
+	keys := make([]ForkRevision, 0, len(g.revisionInfo))
+	for k := range g.revisionInfo {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Fork != keys[j].Fork {
+			return keys[i].Fork < keys[j].Fork
+		}
+		return keys[i].Revision < keys[j].Revision
+	})
+	for _, k := range keys {
+		info := g.revisionInfo[k]
+		if info.Revision != k.Revision {
+			ic.fail("fork", k.Fork, k.Revision, 0, "revision info records revision %d", info.Revision)
+		}
+		root := g.nodeRegistry[info.RootID]
+		if root == nil {
+			ic.fail("reachability", k.Fork, k.Revision, info.RootID, "root not in registry")
+			continue
+		}
+		ic.checkNode(root, k.Fork, k.Revision)
+	}
+
+	ic.checkLive()
+	return ic.violations
+}
+
+// checkNode verifies the subtree under node at (fork, rev) and returns
+// its snapshot (nil if it does not resolve). A snapshot already checked
+// is not descended again: the tree is persistent, so a shared snapshot
+// heads the same subtree wherever it appears.
+func (ic *invariantChecker) checkNode(node *Node, fork ForkID, rev RevisionID) *NodeSnapshot {
+	snap := node.snapshotAt(fork, rev)
+	if snap == nil {
+		ic.fail("reachability", fork, rev, node.id, "no snapshot at this revision")
+		return nil
+	}
+	if ic.seen[snap] {
+		return snap
+	}
+	ic.seen[snap] = true
+	if snap.isLeaf {
+		ic.checkLeaf(snap, fork, rev, node.id)
+		return snap
+	}
+
+	var kids [2]*NodeSnapshot
+	for i, id := range [2]NodeID{snap.leftID, snap.rightID} {
+		child := ic.g.nodeRegistry[id]
+		if child == nil {
+			ic.fail("reachability", fork, rev, node.id, "child %d not in registry", id)
+			return snap
+		}
+		if kids[i] = ic.checkNode(child, fork, rev); kids[i] == nil {
+			return snap
+		}
+	}
+
+	l, r := kids[0], kids[1]
+	after := l.runesAfterLastNewline + r.runeCount
+	if r.lineCount > 0 {
+		after = r.runesAfterLastNewline
+	}
+	if snap.byteCount != l.byteCount+r.byteCount || snap.runeCount != l.runeCount+r.runeCount ||
+		snap.lineCount != l.lineCount+r.lineCount || snap.runesAfterLastNewline != after {
+		ic.fail("weights", fork, rev, node.id,
+			"bytes/runes/lines/tail %d/%d/%d/%d, children sum to %d/%d/%d/%d",
+			snap.byteCount, snap.runeCount, snap.lineCount, snap.runesAfterLastNewline,
+			l.byteCount+r.byteCount, l.runeCount+r.runeCount, l.lineCount+r.lineCount, after)
+	}
+	if snap.uncounted != (l.uncounted || r.uncounted) {
+		ic.fail("weights", fork, rev, node.id, "uncounted %v, children %v/%v", snap.uncounted, l.uncounted, r.uncounted)
+	}
+	if snap.decorationCount != l.decorationCount+r.decorationCount {
+		ic.fail("weights", fork, rev, node.id, "%d decorations, children sum to %d",
+			snap.decorationCount, l.decorationCount+r.decorationCount)
+	}
+	if !sameNamespaceCounts(snap.namespaceCounts, mergeNamespaceCounts(l.namespaceCounts, r.namespaceCounts)) {
+		ic.fail("weights", fork, rev, node.id, "namespace counts %v, children sum to %v",
+			snap.namespaceCounts, mergeNamespaceCounts(l.namespaceCounts, r.namespaceCounts))
+	}
+	return snap
+}
+
+// checkLeaf verifies a leaf's decorations and, when its bytes are
+// resident, its counts and line index.
+func (ic *invariantChecker) checkLeaf(snap *NodeSnapshot, fork ForkID, rev RevisionID, id NodeID) {
+	for _, d := range snap.decorations {
+		if !validStoredDecorationKey(d.Key) {
+			ic.fail("decoration", fork, rev, id, "invalid key %q", d.Key)
+		}
+		if d.Position < 0 || d.Position > snap.byteCount {
+			ic.fail("decoration", fork, rev, id, "%q at offset %d outside leaf of %d bytes", d.Key, d.Position, snap.byteCount)
+		}
+	}
+	if snap.decorations != nil && int64(len(snap.decorations)) != snap.decorationCount {
+		ic.fail("decoration", fork, rev, id, "leaf counts %d decorations, holds %d", snap.decorationCount, len(snap.decorations))
+	}
+	if want := createLeafSnapshot(nil, snap.decorations, -1).namespaceCounts; snap.decorations != nil && !sameNamespaceCounts(snap.namespaceCounts, want) {
+		ic.fail("decoration", fork, rev, id, "leaf namespace counts %v, holds %v", snap.namespaceCounts, want)
+	}
+
+	if snap.storageState != StorageMemory || snap.data == nil {
+		if snap.storageState == StorageMemory && snap.byteCount != 0 {
+			ic.fail("leaf", fork, rev, id, "resident leaf of %d bytes has no data", snap.byteCount)
+		}
+		return
+	}
+	want := createLeafSnapshot(snap.data, nil, -1)
+	if snap.uncounted {
+		// Only the byte weight exists until the index is built.
+		if snap.byteCount != want.byteCount {
+			ic.fail("leaf", fork, rev, id, "uncounted leaf weighs %d bytes, data has %d", snap.byteCount, want.byteCount)
+		}
+		return
+	}
+	if snap.byteCount != want.byteCount || snap.runeCount != want.runeCount ||
+		snap.lineCount != want.lineCount || snap.runesAfterLastNewline != want.runesAfterLastNewline {
+		ic.fail("leaf", fork, rev, id,
+			"bytes/runes/lines/tail %d/%d/%d/%d, data has %d/%d/%d/%d",
+			snap.byteCount, snap.runeCount, snap.lineCount, snap.runesAfterLastNewline,
+			want.byteCount, want.runeCount, want.lineCount, want.runesAfterLastNewline)
+		return
+	}
+	if snap.lineStarts == nil {
+		return // dropped to save memory; rebuilt on demand
+	}
+	if len(snap.lineStarts) != len(want.lineStarts) {
+		ic.fail("leaf", fork, rev, id, "line index has %d entries, data has %d", len(snap.lineStarts), len(want.lineStarts))
+		return
+	}
+	for i, ls := range snap.lineStarts {
+		if ls != want.lineStarts[i] {
+			ic.fail("leaf", fork, rev, id, "line index entry %d is %+v, data says %+v", i, ls, want.lineStarts[i])
+			return
+		}
+	}
+}
+
+// checkForks verifies fork metadata and the current coordinates.
+func (ic *invariantChecker) checkForks() {
+	g := ic.g
+	if g.forks[0] == nil {
+		ic.fail("fork", 0, 0, 0, "fork 0 missing")
+	}
+	for id, f := range g.forks {
+		if f.ID != id {
+			ic.fail("fork", id, 0, 0, "fork info records ID %d", f.ID)
+		}
+		if id == 0 {
+			continue
+		}
+		parent := g.forks[f.ParentFork]
+		switch {
+		case parent == nil:
+			ic.fail("fork", id, 0, 0, "parent fork %d missing", f.ParentFork)
+		case f.ParentRevision > parent.HighestRevision:
+			ic.fail("fork", id, 0, 0, "branched at revision %d, parent's highest is %d", f.ParentRevision, parent.HighestRevision)
+		}
+		if f.HighestRevision < f.ParentRevision {
+			ic.fail("fork", id, 0, 0, "highest revision %d precedes branch point %d", f.HighestRevision, f.ParentRevision)
+		}
+	}
+	for k := range g.revisionInfo {
+		f := g.forks[k.Fork]
+		if f == nil {
+			ic.fail("fork", k.Fork, k.Revision, 0, "revision recorded for unknown fork")
+		} else if k.Revision > f.HighestRevision {
+			ic.fail("fork", k.Fork, k.Revision, 0, "revision past the fork's highest (%d)", f.HighestRevision)
+		}
+	}
+	if f := g.forks[g.currentFork]; f == nil {
+		ic.fail("live", g.currentFork, g.currentRevision, 0, "current fork missing")
+	} else if g.currentRevision > f.HighestRevision && g.transaction == nil {
+		ic.fail("live", g.currentFork, g.currentRevision, 0, "current revision past the fork's highest (%d)", f.HighestRevision)
+	}
+}
+
+// checkLive verifies the live root, cached totals and cursors.
+func (ic *invariantChecker) checkLive() {
+	g := ic.g
+	fork, rev := g.currentFork, g.currentRevision
+	if g.root == nil {
+		ic.fail("live", fork, rev, 0, "no root")
+		return
+	}
+	if g.transaction == nil {
+		if info := g.findRevisionInfo(fork, rev); info == nil || info.Revision != rev {
+			ic.fail("live", fork, rev, g.root.id, "current revision has no revision info")
+		} else if info.RootID != g.root.id {
+			ic.fail("live", fork, rev, g.root.id, "live root differs from the revision's root %d", info.RootID)
+		}
+	}
+	snap := ic.checkNode(g.root, fork, rev)
+	if snap == nil {
+		return
+	}
+	deferred := g.countsDeferred.Load() // rune and line totals are placeholders
+	if g.totalBytes != snap.byteCount || !deferred && (g.totalRunes != snap.runeCount || g.totalLines != snap.lineCount) {
+		ic.fail("live", fork, rev, g.root.id, "totals %d/%d/%d, root counts %d/%d/%d",
+			g.totalBytes, g.totalRunes, g.totalLines, snap.byteCount, snap.runeCount, snap.lineCount)
+	}
+	for i, c := range g.cursors {
+		if c.bytePos < 0 || c.bytePos > snap.byteCount {
+			ic.fail("cursor", fork, rev, 0, "cursor %d at byte %d of %d", i, c.bytePos, snap.byteCount)
+		}
+		if c.anchor != nil && (c.anchor.pos < 0 || c.anchor.pos > snap.byteCount) {
+			ic.fail("cursor", fork, rev, 0, "cursor %d anchored at byte %d of %d", i, c.anchor.pos, snap.byteCount)
+		}
+		if r := c.restrict; r != nil && (r.start.pos < 0 || r.end.pos > snap.byteCount) {
+			ic.fail("cursor", fork, rev, 0, "cursor %d restricted to [%d, %d) of %d", i, r.start.pos, r.end.pos, snap.byteCount)
+		}
+	}
+	for key, m := range g.ephemeral {
+		if m.pos < 0 || m.pos > snap.byteCount {
+			ic.fail("decoration", fork, rev, 0, "ephemeral %q at byte %d of %d", key, m.pos, snap.byteCount)
+		}
+	}
+	for source, records := range g.diagnostics {
+		for _, r := range records {
+			if r.start.pos < 0 || r.end.pos > snap.byteCount {
+				ic.fail("decoration", fork, rev, 0, "diagnostic from %q at [%d, %d) of %d", source, r.start.pos, r.end.pos, snap.byteCount)
+			}
+		}
+	}
+}
+
+// sameNamespaceCounts reports whether two namespaceCounts maps agree.
+func sameNamespaceCounts(a, b map[string]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ns, n := range a {
+		if b[ns] != n {
+			return false
+		}
+	}
+	return true
+}
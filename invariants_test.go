@@ -0,0 +1,64 @@
+package garland
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestCheckInvariantsOnEditedHistory(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("héllo\nwörld ", 30), MaxLeafSize: 16})
+	defer g.Close()
+
+	rng := rand.New(rand.NewSource(3))
+	c := g.NewCursor()
+	for i := 0; i < 200; i++ {
+		n := g.RuneCount().Value
+		c.SeekRune(rng.Int63n(n + 1))
+		switch rng.Intn(5) {
+		case 0:
+			c.DeleteRunes(min(n-c.RunePos(), rng.Int63n(9)), false)
+		case 1:
+			g.UndoSeek(g.CurrentRevision() / 2) // the next edit forks
+		case 2:
+			g.Decorate([]DecorationEntry{{Key: "m" + string(rune('a'+i%26)), Address: &AbsoluteAddress{Mode: ByteMode, Byte: c.BytePos()}}})
+		default:
+			c.InsertString("ab\nc", nil, true)
+		}
+		if v := g.CheckInvariants(); v != nil {
+			t.Fatalf("step %d: %v", i, v)
+		}
+	}
+	g.Prune(g.CurrentRevision() / 2)
+	if v := g.CheckInvariants(); v != nil {
+		t.Fatalf("after prune: %v", v)
+	}
+}
+
+func TestCheckInvariantsReportsCorruption(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "one\ntwo\nthree\nfour\n", MaxLeafSize: 8})
+	defer g.Close()
+
+	leaf := g.root
+	for {
+		snap := leaf.snapshotAt(g.currentFork, g.currentRevision)
+		if snap.isLeaf {
+			snap.runeCount++
+			snap.decorations = append(snap.decorations, Decoration{Key: "bad", Position: snap.byteCount + 5})
+			break
+		}
+		leaf = g.nodeRegistry[snap.leftID]
+	}
+
+	kinds := map[string]bool{}
+	for _, v := range g.CheckInvariants() {
+		kinds[v.Kind] = true
+	}
+	for _, want := range []string{"leaf", "weights", "decoration"} {
+		if !kinds[want] {
+			t.Errorf("no %q violation reported (got %v)", want, kinds)
+		}
+	}
+}
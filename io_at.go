@@ -0,0 +1,97 @@
+package garland
+
+import (
+	"context"
+	"io"
+)
+
+// io_at.go - io.ReaderAt and io.WriterAt over the live buffer.
+//
+// DESIGN: zip readers, binary parsers and similar offset-based
+// consumers take an io.ReaderAt (and sometimes write back through an
+// io.WriterAt). The Garland itself is the ReaderAt: ReadAt reads the
+// current revision at any offset, without a cursor.
+//
+//   - ReadAt follows the io.ReaderAt contract: while a source is still
+//     streaming in it waits for the requested range (or the end) rather
+//     than returning short, and a read that reaches the end returns
+//     io.EOF with the bytes it got.
+//   - Writing is opt-in: NewWriterAt returns a WriterAt holding its own
+//     ephemeral process-mode cursor, and each WriteAt is one
+//     OverwriteBytes - a revision of its own (or part of an enclosing
+//     transaction or coalescing run, like any overwrite). A write that
+//     runs past the end extends the document; one that starts past the
+//     end is refused with ErrInvalidPosition, since a rope has no holes
+//     to leave.
+//   - Close the WriterAt to drop its cursor.
+
+// ReadAt reads len(p) bytes at byte offset off of the current revision,
+// as io.ReaderAt. It waits for a streaming load to reach the range.
+func (g *Garland) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidPosition
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := eofIsFine(g.waitForBytePosition(context.Background(), off+int64(len(p)), -1)); err != nil {
+		return 0, err
+	}
+	if off >= g.ByteCount().Value {
+		return 0, io.EOF
+	}
+	data, err := g.readBytesAt(off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriterAt writes into a Garland at byte offsets, as io.WriterAt. Each
+// write overwrites in place; see NewWriterAt.
+type WriterAt struct {
+	c *Cursor
+}
+
+// NewWriterAt returns a WriterAt over g. Close it when done.
+func (g *Garland) NewWriterAt() *WriterAt {
+	c := g.NewEphemeralCursor()
+	c.SetMode(CursorModeProcess)
+	return &WriterAt{c: c}
+}
+
+// WriteAt overwrites len(p) bytes at byte offset off, extending the
+// document when the write runs past its end. Returns ErrInvalidPosition
+// if off is past the end.
+func (w *WriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if w.c.detached() {
+		return 0, ErrCursorNotFound
+	}
+	if off < 0 {
+		return 0, ErrInvalidPosition
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	g := w.c.garland
+	if err := eofIsFine(g.waitForBytePosition(context.Background(), off+int64(len(p)), -1)); err != nil {
+		return 0, err
+	}
+	if _, _, err := g.overwriteBytesAt(w.c, off, int64(len(p)), p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close removes the WriterAt's cursor. Writes after Close return
+// ErrCursorNotFound.
+func (w *WriterAt) Close() error {
+	if w.c.detached() {
+		return nil
+	}
+	return w.c.garland.RemoveCursor(w.c)
+}
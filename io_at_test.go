@@ -0,0 +1,71 @@
+package garland
+
+import (
+	"io"
+	"testing"
+)
+
+func TestGarlandReadAt(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, err := lib.Open(FileOptions{DataString: "Hello World"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	buf := make([]byte, 5)
+	if n, err := g.ReadAt(buf, 6); err != nil || string(buf[:n]) != "World" {
+		t.Fatalf("ReadAt = %q, %v; want %q", buf[:n], err, "World")
+	}
+	if n, err := g.ReadAt(buf, 9); err != io.EOF || string(buf[:n]) != "ld" {
+		t.Fatalf("ReadAt at end = %q, %v; want %q, EOF", buf[:n], err, "ld")
+	}
+	if n, err := g.ReadAt(buf, 11); err != io.EOF || n != 0 {
+		t.Fatalf("ReadAt past end = %d, %v; want 0, EOF", n, err)
+	}
+	if _, err := g.ReadAt(buf, -1); err != ErrInvalidPosition {
+		t.Fatalf("ReadAt(-1) err = %v, want ErrInvalidPosition", err)
+	}
+
+	// Offset-based consumers work through it unchanged.
+	data, err := io.ReadAll(io.NewSectionReader(g, 0, 5))
+	if err != nil || string(data) != "Hello" {
+		t.Fatalf("SectionReader = %q, %v", data, err)
+	}
+}
+
+func TestWriterAt(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, err := lib.Open(FileOptions{DataString: "Hello World"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	w := g.NewWriterAt()
+	if n, err := w.WriteAt([]byte("THERE"), 6); err != nil || n != 5 {
+		t.Fatalf("WriteAt = %d, %v", n, err)
+	}
+	if got := readAll(t, g); got != "Hello THERE" {
+		t.Fatalf("after overwrite = %q", got)
+	}
+	if g.CurrentRevision() != 1 {
+		t.Fatalf("revision = %d, want 1", g.CurrentRevision())
+	}
+	if _, err := w.WriteAt([]byte("!!"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, g); got != "Hello THER!!" {
+		t.Fatalf("write past the end = %q, want it extended", got)
+	}
+	if _, err := w.WriteAt([]byte("x"), 20); err != ErrInvalidPosition {
+		t.Fatalf("write with a gap err = %v, want ErrInvalidPosition", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteAt([]byte("x"), 0); err != ErrCursorNotFound {
+		t.Fatalf("write after Close err = %v, want ErrCursorNotFound", err)
+	}
+}
@@ -0,0 +1,679 @@
+package garland
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// journal.go - crash-recovery journal for unsaved edits.
+//
+// DESIGN: history lives in memory (and cold storage, which is not
+// meant to outlive the process), so a crash loses everything since the
+// last save. FileOptions.Journal appends each committed change to a
+// sidecar file as it happens; Library.Recover rebuilds the buffer from
+// the source plus that journal.
+//
+//   - A record per content change, written when it commits: a mutation
+//     outside a transaction (including a coalescing amend), a
+//     transaction commit. The edit primitives note each splice (offset,
+//     removed length, inserted bytes) as they apply it, so a record is
+//     the mutations themselves - the edit path never reads the document
+//     back. A transaction's splices wait for its commit and go as one
+//     record; a rollback drops them.
+//   - An undo/fork seek has no splices of its own: they are derived by
+//     diffing the last journaled version against the live one as
+//     OpsBetween does, reading only the leaves that differ, and stored
+//     as the same byte splices. Records are bytes, never runes, so a
+//     byte edit that split a character replays exactly.
+//   - The journal is written only while the buffer holds unsaved
+//     changes: it is created with the first change past a clean point,
+//     and a save (or a rebase / SaveAs adoption - anything after which
+//     buffer and source agree) removes it. Viewing a file never writes
+//     one; Close removes it (a deliberate close is not a crash).
+//   - The first record names the BASE the records apply to. A file
+//     source is identified rather than copied - its size, modification
+//     time and the CRC-32 of its first and last journalSample bytes,
+//     so identifying it costs the same on any file size - and Recover
+//     refuses (ErrJournalMismatch) a file that no longer matches. Other
+//     sources
+//     store the base content itself, streamed out leaf by leaf when
+//     the journal is created.
+//   - Records are appended through the source's filesystem hook and
+//     each carries its own CRC, so a crash mid-append leaves a torn
+//     tail that recovery stops at: everything before it is recovered.
+//     The journal reaches the OS with every record - it survives a
+//     process crash; surviving a power loss is up to the filesystem.
+//   - A journal write failure never fails the edit: journaling stops
+//     and JournalError reports why.
+//   - Recovery replays the records as ONE transaction ("journal
+//     recovery"), so a single undo returns to the file as saved, and
+//     keeps appending to the same journal - a crash during the
+//     recovered session loses nothing either.
+//
+// FORMAT: journalMagic, then records of
+//
+//	uvarint payload length, payload, CRC-32 (IEEE, LE) of the payload
+//
+// where the payload's first byte is its kind:
+//
+//	'B' base:  uvarint 0, uvarint size, varint mtime (unix ns),
+//	           sample CRC-32 (LE), source path                    (file)
+//	           uvarint 1, content                                 (other)
+//	'S' splices: repeated uvarint offset, uvarint removed, uvarint n,
+//	           n inserted bytes - applied in order
+
+// journalMagic identifies a journal (and its format version).
+const journalMagic = "GJL2"
+
+// Journal record kinds.
+const (
+	journalBase   = 'B'
+	journalSplice = 'S'
+)
+
+// Base record forms.
+const (
+	journalBaseFile    = 0
+	journalBaseContent = 1
+)
+
+// journalChunk is the write size for streaming a content base out.
+const journalChunk = 1 << 20
+
+// journalSample is how much of each end of a file base its identity
+// checksums.
+const journalSample = 64 << 10
+
+// journalState tracks the recovery journal for one garland.
+type journalState struct {
+	fs       FileSystemInterface
+	path     string
+	explicit bool // path came from FileOptions.JournalPath
+
+	handle FileHandle // open while a journal is being written
+	base   treeState  // the clean content the journal is relative to
+	last   treeState  // the content the journal reproduces so far
+
+	pending []byte   // 'S' payload of the splices since the last commit
+	queued  [][]byte // committed payloads not yet written (while streaming)
+	stale   bool     // last is behind by a seek not yet derived
+
+	// File bases are identified, not copied.
+	sourcePath string
+	baseID     fileIdent
+
+	replaying bool  // Recover is applying the journal
+	err       error // first write failure; journaling stops
+}
+
+// JournalPathFor returns the default journal location for a source
+// file: ".<name>.garland-journal" in the same directory.
+func JournalPathFor(sourcePath string) string {
+	return filepath.Join(filepath.Dir(sourcePath), "."+filepath.Base(sourcePath)+".garland-journal")
+}
+
+// initJournalLocked enables journaling from the content as loaded.
+// Without an explicit path, only file sources have somewhere to put it.
+// Caller must hold the write lock (or own the unpublished garland).
+func (g *Garland) initJournalLocked(path string) {
+	if path == "" && g.sourcePath == "" {
+		return
+	}
+	fs := g.sourceFS
+	if fs == nil {
+		fs = g.lib.defaultFS
+	}
+	g.journal = &journalState{fs: fs, path: path, explicit: path != ""}
+	g.resetJournalLocked(g.liveStateLocked())
+}
+
+// resetJournalLocked makes base the clean point: the journal restarts
+// (empty) relative to it.
+func (g *Garland) resetJournalLocked(base treeState) {
+	j := g.journal
+	if j.handle != nil {
+		j.fs.Close(j.handle)
+		j.handle = nil
+		_ = j.fs.Remove(j.path)
+	}
+	j.base, j.last = base, base
+	j.pending, j.queued, j.stale = nil, nil, false
+	j.sourcePath = g.sourcePath
+	if !j.explicit {
+		j.path = JournalPathFor(g.sourcePath)
+	}
+	if j.sourcePath != "" {
+		j.baseID, j.err = fileIdentity(j.fs, j.sourcePath)
+	}
+}
+
+// journalSavedLocked is the successful-save hook: base is the content
+// the source now holds. Anything the live buffer has beyond it (edits
+// made during a concurrent save) is journaled straight away.
+func (g *Garland) journalSavedLocked(base treeState) {
+	j := g.journal
+	if j == nil {
+		return
+	}
+	g.resetJournalLocked(base)
+	if j.err == nil && g.liveStateLocked().rootSnap() != base.rootSnap() {
+		j.stale = true
+		g.writeJournalLocked()
+	}
+}
+
+// closeJournalLocked removes the journal (Close).
+func (g *Garland) closeJournalLocked() {
+	j := g.journal
+	if j == nil || j.handle == nil {
+		return
+	}
+	j.fs.Close(j.handle)
+	j.handle = nil
+	_ = j.fs.Remove(j.path)
+}
+
+// journalSpliceLocked notes one applied mutation: at pos, removed
+// bytes gave way to the inserted pieces. It is called by the edit
+// primitives (and region dissolves) once the tree holds the change;
+// the splices go to disk at the next commit. Caller must hold the
+// write lock.
+func (g *Garland) journalSpliceLocked(pos, removed int64, inserted ...[]byte) {
+	j := g.journal
+	if j == nil || j.replaying || j.err != nil || j.stale {
+		return
+	}
+	var n int
+	for _, p := range inserted {
+		n += len(p)
+	}
+	if removed == 0 && n == 0 {
+		return
+	}
+	if j.pending == nil {
+		j.pending = []byte{journalSplice}
+	}
+	j.pending = appendSplice(j.pending, pos, removed, n, inserted...)
+}
+
+// appendSplice encodes one splice of an 'S' payload; n is the inserted
+// pieces' total length.
+func appendSplice(payload []byte, pos, removed int64, n int, inserted ...[]byte) []byte {
+	payload = binary.AppendUvarint(payload, uint64(pos))
+	payload = binary.AppendUvarint(payload, uint64(removed))
+	payload = binary.AppendUvarint(payload, uint64(n))
+	for _, p := range inserted {
+		payload = append(payload, p...)
+	}
+	return payload
+}
+
+// journalLocked commits the splices noted since the last commit as one
+// record. It is the commit hook (recordMutation, TransactionCommit);
+// inside a transaction it waits for the commit. A commit without
+// splices changed no text (a decoration edit) and writes nothing.
+// Caller must hold the write lock.
+func (g *Garland) journalLocked() {
+	j := g.journal
+	if j == nil || j.replaying || j.err != nil || g.transaction != nil {
+		return
+	}
+	if j.pending != nil {
+		j.queued = append(j.queued, j.pending)
+		j.pending = nil
+	}
+	if !j.stale {
+		j.last = g.liveStateLocked()
+	}
+	g.writeJournalLocked()
+}
+
+// journalRollbackLocked drops the splices of a rolled-back transaction.
+func (g *Garland) journalRollbackLocked() {
+	if j := g.journal; j != nil {
+		j.pending = nil
+	}
+}
+
+// journalSeekLocked is the undo/fork seek hook. Splices noted but not
+// committed (a region dissolved since the last commit) were left
+// behind with the tree they edited; the seek's record is derived from
+// the versions instead. Caller must hold the write lock.
+func (g *Garland) journalSeekLocked() {
+	j := g.journal
+	if j == nil || j.replaying || j.err != nil {
+		return
+	}
+	j.pending = nil
+	j.stale = true
+	g.writeJournalLocked()
+}
+
+// writeJournalLocked appends the queued records, deriving a stale
+// seek's first. While streaming it waits for the load to complete.
+func (g *Garland) writeJournalLocked() {
+	j := g.journal
+	if g.loader != nil && !g.loader.eofReached {
+		return
+	}
+	if j.stale {
+		live := g.liveStateLocked()
+		if live.rootSnap() != j.last.rootSnap() {
+			spans, err := g.diffSpansLocked(j.last, live)
+			if err != nil {
+				j.err = err // the last journaled version was pruned
+				return
+			}
+			if len(spans) > 0 {
+				// Span offsets are in the older version; each splice
+				// applies after the ones before it.
+				payload := []byte{journalSplice}
+				var shift int64
+				for _, sp := range spans {
+					payload = appendSplice(payload, sp.start+shift, int64(len(sp.deleted)), len(sp.inserted), sp.inserted)
+					shift += int64(len(sp.inserted) - len(sp.deleted))
+				}
+				j.queued = append(j.queued, payload)
+			}
+		}
+		j.last, j.stale = live, false
+	}
+	if len(j.queued) == 0 {
+		return
+	}
+	if j.handle == nil {
+		if err := g.startJournalLocked(); err != nil {
+			j.err = err
+			return
+		}
+	}
+	var data []byte
+	for _, payload := range j.queued {
+		data = append(data, journalRecord(payload)...)
+	}
+	j.queued = nil
+	if err := j.fs.WriteBytes(j.handle, data); err != nil {
+		j.err = err
+	}
+}
+
+// startJournalLocked creates the journal file with its base record.
+func (g *Garland) startJournalLocked() error {
+	j := g.journal
+	h, err := j.fs.Open(j.path, OpenModeWrite)
+	if err != nil {
+		return err
+	}
+	if err := g.writeJournalBaseLocked(h); err != nil {
+		j.fs.Close(h)
+		_ = j.fs.Remove(j.path)
+		return err
+	}
+	j.handle = h
+	return nil
+}
+
+// writeJournalBaseLocked writes the magic and the base record. A
+// content base is streamed out leaf by leaf, never held whole.
+func (g *Garland) writeJournalBaseLocked(h FileHandle) error {
+	j := g.journal
+	payload := []byte{journalBase}
+	if j.sourcePath != "" {
+		payload = binary.AppendUvarint(payload, journalBaseFile)
+		payload = binary.AppendUvarint(payload, uint64(j.baseID.size))
+		payload = binary.AppendVarint(payload, j.baseID.modTime)
+		payload = binary.LittleEndian.AppendUint32(payload, j.baseID.sampleCRC)
+		payload = append(payload, j.sourcePath...)
+		return j.fs.WriteBytes(h, append([]byte(journalMagic), journalRecord(payload)...))
+	}
+
+	base := j.base
+	if base.rootSnap() == nil {
+		// The clean version is no longer resolvable (pruned): the
+		// journal starts from the live content instead.
+		base = g.liveStateLocked()
+		j.last, j.queued = base, nil
+	}
+	payload = binary.AppendUvarint(payload, journalBaseContent)
+	size := uint64(len(payload)) + uint64(base.rootSnap().byteCount)
+	buf := binary.AppendUvarint([]byte(journalMagic), size)
+	buf = append(buf, payload...)
+	crc := crc32.ChecksumIEEE(payload)
+	w := newDiffWalker(g, base, false)
+	for w.top() != nil {
+		e := w.stack[len(w.stack)-1]
+		if !e.snap.isLeaf {
+			if err := w.expand(); err != nil {
+				return err
+			}
+			continue
+		}
+		w.pop()
+		if err := g.ensureLeafDataResident(e.node, e.snap); err != nil {
+			return err
+		}
+		if e.snap.storageState != StorageMemory || int64(len(e.snap.data)) != e.snap.byteCount {
+			return ErrDataNotLoaded
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, e.snap.data)
+		buf = append(buf, e.snap.data...)
+		if len(buf) >= journalChunk {
+			if err := j.fs.WriteBytes(h, buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	return j.fs.WriteBytes(h, binary.LittleEndian.AppendUint32(buf, crc))
+}
+
+// stateAtLocked resolves an exact fork/revision to a tree version.
+func (g *Garland) stateAtLocked(fork ForkID, rev RevisionID) (treeState, bool) {
+	info := g.findRevisionInfo(fork, rev)
+	if info == nil || info.Revision != rev {
+		return treeState{}, false
+	}
+	root := g.nodeRegistry[info.RootID]
+	if root == nil {
+		return treeState{}, false
+	}
+	return treeState{root: root, fork: fork, rev: rev}, true
+}
+
+// JournalError reports why journaling stopped, or nil while it works
+// (or is not enabled).
+func (g *Garland) JournalError() error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.journal == nil {
+		return nil
+	}
+	return g.journal.err
+}
+
+// journalRecord frames a payload.
+func journalRecord(payload []byte) []byte {
+	rec := binary.AppendUvarint(nil, uint64(len(payload)))
+	rec = append(rec, payload...)
+	return binary.LittleEndian.AppendUint32(rec, crc32.ChecksumIEEE(payload))
+}
+
+// fileIdent identifies a file base without reading all of it.
+type fileIdent struct {
+	size      int64
+	modTime   int64  // unix nanoseconds; 0 when the filesystem has none
+	sampleCRC uint32 // of the first and last journalSample bytes
+}
+
+// fileIdentity reads a file's identity: its size and modification time
+// from the filesystem, and a CRC-32 of at most 2*journalSample bytes.
+func fileIdentity(fs FileSystemInterface, path string) (fileIdent, error) {
+	var id fileIdent
+	if md, err := fs.Stat(path); err == nil && md.Exists {
+		id.modTime = md.ModTime.UnixNano()
+	}
+	h, err := fs.Open(path, OpenModeRead)
+	if err != nil {
+		return id, err
+	}
+	defer fs.Close(h)
+	if id.size, err = fs.FileSize(h); err != nil {
+		return id, err
+	}
+	crc := crc32.NewIEEE()
+	read := func(at, n int64) error {
+		if err := fs.SeekByte(h, at); err != nil {
+			return err
+		}
+		for n > 0 {
+			chunk, err := fs.ReadBytes(h, int(n))
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if len(chunk) == 0 {
+				return io.ErrUnexpectedEOF
+			}
+			crc.Write(chunk)
+			n -= int64(len(chunk))
+		}
+		return nil
+	}
+	head := min(id.size, journalSample)
+	if err := read(0, head); err != nil {
+		return id, err
+	}
+	if tail := min(id.size-head, journalSample); tail > 0 {
+		if err := read(id.size-tail, tail); err != nil {
+			return id, err
+		}
+	}
+	id.sampleCRC = crc.Sum32()
+	return id, nil
+}
+
+// journalContents is a parsed journal.
+type journalContents struct {
+	sourcePath string // file base
+	baseID     fileIdent
+	content    []byte // content base
+
+	records [][]byte // 'S' payloads, in order
+	valid   int64    // length of the intact prefix
+}
+
+// parseJournal reads the intact prefix of a journal: the base record is
+// required; reading stops at the first torn or corrupt record.
+func parseJournal(data []byte) (*journalContents, error) {
+	if !bytes.HasPrefix(data, []byte(journalMagic)) {
+		return nil, ErrCorruptJournal
+	}
+	jc := &journalContents{}
+	off := len(journalMagic)
+	for off < len(data) {
+		n, w := binary.Uvarint(data[off:])
+		if w <= 0 || n > uint64(len(data)-off-w) || uint64(len(data)-off-w)-n < 4 {
+			break
+		}
+		payload := data[off+w : off+w+int(n)]
+		sum := binary.LittleEndian.Uint32(data[off+w+int(n):])
+		if len(payload) == 0 || sum != crc32.ChecksumIEEE(payload) {
+			break
+		}
+		if off == len(journalMagic) {
+			if payload[0] != journalBase || !jc.parseBase(payload[1:]) {
+				return nil, ErrCorruptJournal
+			}
+		} else if payload[0] == journalSplice {
+			jc.records = append(jc.records, payload)
+		} else {
+			break
+		}
+		off += w + int(n) + 4
+	}
+	if off == len(journalMagic) {
+		return nil, ErrCorruptJournal // not even a base record
+	}
+	jc.valid = int64(off)
+	return jc, nil
+}
+
+// parseBase decodes a base record body.
+func (jc *journalContents) parseBase(b []byte) bool {
+	form, w := binary.Uvarint(b)
+	if w <= 0 {
+		return false
+	}
+	b = b[w:]
+	switch form {
+	case journalBaseFile:
+		size, w := binary.Uvarint(b)
+		if w <= 0 {
+			return false
+		}
+		b = b[w:]
+		mtime, w := binary.Varint(b)
+		if w <= 0 || len(b)-w < 4 {
+			return false
+		}
+		jc.baseID = fileIdent{size: int64(size), modTime: mtime, sampleCRC: binary.LittleEndian.Uint32(b[w:])}
+		jc.sourcePath = string(b[w+4:])
+		return jc.sourcePath != ""
+	case journalBaseContent:
+		jc.content = b
+		return true
+	}
+	return false
+}
+
+// Recover reopens a file whose garland crashed with unsaved changes,
+// replaying its journal (FileOptions.Journal) onto it. It fails with
+// ErrNoJournal when there is nothing to recover and ErrJournalMismatch
+// when the file changed since the journal's base.
+func (lib *Library) Recover(path string) (*Garland, error) {
+	return lib.RecoverWith(FileOptions{FilePath: path})
+}
+
+// RecoverWith is Recover with open options. The journal is
+// options.JournalPath, or the default beside options.FilePath; a
+// journal whose base is not a file (JournalPath alone) supplies the
+// base content itself. Journaling stays on for the recovered garland.
+func (lib *Library) RecoverWith(options FileOptions) (*Garland, error) {
+	fs := options.FileSystem
+	if fs == nil {
+		fs = lib.defaultFS
+	}
+	path := options.JournalPath
+	if path == "" {
+		if options.FilePath == "" {
+			return nil, ErrNoDataSource
+		}
+		path = JournalPathFor(options.FilePath)
+	}
+	data, err := fs.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoJournal
+	}
+	if err != nil {
+		return nil, err
+	}
+	jc, err := parseJournal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if jc.sourcePath != "" {
+		if options.FilePath == "" {
+			options.FilePath = jc.sourcePath
+		}
+		id, err := fileIdentity(fs, options.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		if id != jc.baseID {
+			return nil, ErrJournalMismatch
+		}
+	} else {
+		options.FilePath = ""
+		options.DataBytes = append([]byte{}, jc.content...)
+	}
+	options.Journal = true
+	options.JournalPath = path
+
+	g, err := lib.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.replayJournal(jc); err != nil {
+		g.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// replayJournal applies the journal's records as one transaction, then
+// adopts the journal file (trimmed to its intact prefix) to keep
+// appending to.
+func (g *Garland) replayJournal(jc *journalContents) error {
+	g.mu.Lock()
+	j := g.journal
+	j.replaying = true
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		j.replaying = false
+		g.mu.Unlock()
+	}()
+
+	if len(jc.records) > 0 {
+		if err := g.TransactionStart("journal recovery"); err != nil {
+			return err
+		}
+		for _, rec := range jc.records {
+			if err := g.replayJournalRecord(rec); err != nil {
+				g.TransactionRollback()
+				return err
+			}
+		}
+		if _, err := g.TransactionCommit(); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	h, err := j.fs.Open(j.path, OpenModeReadWrite)
+	if err != nil {
+		return err
+	}
+	if err := j.fs.Truncate(h, jc.valid); err != nil {
+		j.fs.Close(h)
+		return err
+	}
+	if err := j.fs.SeekByte(h, jc.valid); err != nil {
+		j.fs.Close(h)
+		return err
+	}
+	j.handle = h
+	j.last = g.liveStateLocked()
+	return nil
+}
+
+// replayJournalRecord applies one 'S' record.
+func (g *Garland) replayJournalRecord(rec []byte) error {
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+	for b := rec[1:]; len(b) > 0; {
+		var v [3]uint64
+		for i := range v {
+			n, w := binary.Uvarint(b)
+			if w <= 0 {
+				return ErrCorruptJournal
+			}
+			v[i], b = n, b[w:]
+		}
+		off, removed, n := int64(v[0]), int64(v[1]), v[2]
+		if n > uint64(len(b)) {
+			return ErrCorruptJournal
+		}
+		data := b[:n]
+		b = b[n:]
+		if err := c.SeekByte(off); err != nil {
+			return err
+		}
+		var err error
+		if removed > 0 {
+			_, _, err = c.OverwriteBytes(removed, data)
+		} else {
+			_, err = c.InsertBytes(data, nil, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
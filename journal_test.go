@@ -0,0 +1,335 @@
+package garland
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// crash abandons g without Close, as a crashed process would, keeping
+// only the journal file it had written.
+func crash(g *Garland) {
+	if j := g.journal; j != nil && j.handle != nil {
+		j.fs.Close(j.handle)
+		j.handle = nil
+	}
+}
+
+func TestJournalRecoversUnsavedEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	base := strings.Repeat("line of text\n", 40)
+	os.WriteFile(path, []byte(base), 0644)
+	lib, _ := Init(LibraryOptions{})
+
+	g, err := lib.Open(FileOptions{FilePath: path, Journal: true, MaxLeafSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(JournalPathFor(path)); !os.IsNotExist(err) {
+		t.Fatal("viewing a file must not write a journal")
+	}
+
+	c := g.NewCursor()
+	c.SeekByte(13)
+	c.InsertString("inserted ", nil, true)
+	g.TransactionStart("batch")
+	c.SeekByte(200)
+	c.DeleteBytes(30, false)
+	c.InsertString("réplaced", nil, true)
+	g.TransactionCommit()
+	c.SeekByte(g.ByteCount().Value)
+	c.InsertString("tail", nil, true)
+	g.UndoSeek(g.CurrentRevision() - 1) // the undo is journaled too
+	want := readAllString(t, g)
+	crash(g)
+
+	r, err := lib.Recover(path)
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if got := readAllString(t, r); got != want {
+		t.Fatalf("recovered %q\nwant %q", got, want)
+	}
+
+	// The recovered session keeps journaling onto the same file.
+	r.NewCursor().InsertString(">>", nil, true)
+	want = readAllString(t, r)
+	crash(r)
+	r2, err := lib.Recover(path)
+	if err != nil {
+		t.Fatalf("second Recover: %v", err)
+	}
+	if got := readAllString(t, r2); got != want {
+		t.Errorf("second recovery %q\nwant %q", got, want)
+	}
+
+	// One undo returns to the file as saved.
+	r2.UndoSeek(r2.CurrentRevision() - 1)
+	if got := readAllString(t, r2); got != base {
+		t.Errorf("undoing the recovery gave %q", got)
+	}
+	r2.Close()
+	if _, err := lib.Recover(path); err != ErrNoJournal {
+		t.Errorf("Recover after Close: err = %v, want ErrNoJournal", err)
+	}
+}
+
+func TestJournalSaveResetsAndMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	os.WriteFile(path, []byte("hello world\n"), 0644)
+	lib, _ := Init(LibraryOptions{})
+
+	g, _ := lib.Open(FileOptions{FilePath: path, Journal: true})
+	c := g.NewCursor()
+	c.InsertString("one ", nil, true)
+	if _, err := os.Stat(JournalPathFor(path)); err != nil {
+		t.Fatalf("journal not written: %v", err)
+	}
+	if _, err := g.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(JournalPathFor(path)); !os.IsNotExist(err) {
+		t.Fatal("a save must remove the journal")
+	}
+
+	c.InsertString("two ", nil, true)
+	crash(g)
+
+	// The file changes behind the journal's back: its edits no longer apply.
+	os.WriteFile(path, []byte("someone else's content\n"), 0644)
+	if _, err := lib.Recover(path); err != ErrJournalMismatch {
+		t.Errorf("Recover over a changed file: err = %v, want ErrJournalMismatch", err)
+	}
+}
+
+func TestJournalTornTailAndContentBase(t *testing.T) {
+	jpath := filepath.Join(t.TempDir(), "scratch.journal")
+	lib, _ := Init(LibraryOptions{})
+
+	g, _ := lib.Open(FileOptions{DataString: "scratch buffer", Journal: true, JournalPath: jpath})
+	c := g.NewCursor()
+	c.SeekByte(7)
+	c.InsertString(" (kept)", nil, true)
+	kept := readAllString(t, g)
+	c.InsertString(" (torn)", nil, true)
+	crash(g)
+
+	// Tear the last record, as a crash mid-append would.
+	data, _ := os.ReadFile(jpath)
+	os.WriteFile(jpath, data[:len(data)-3], 0644)
+
+	r, err := lib.RecoverWith(FileOptions{JournalPath: jpath})
+	if err != nil {
+		t.Fatalf("RecoverWith: %v", err)
+	}
+	defer r.Close()
+	if got := readAllString(t, r); got != kept {
+		t.Errorf("recovered %q, want the intact prefix %q", got, kept)
+	}
+}
+
+// journalEdits edits a chilled document at places far apart: a
+// committed transaction, a rolled-back one, a move, a copy and a mark.
+func journalEdits(t *testing.T, g *Garland) {
+	t.Helper()
+	c := g.NewCursor()
+	g.TransactionStart("spread")
+	c.SeekByte(20)
+	c.InsertString("¡start! ", nil, true)
+	c.SeekByte(15000)
+	c.DeleteBytes(5, false)
+	c.SeekByte(g.ByteCount().Value - 3)
+	c.OverwriteBytes(2, []byte("end"))
+	if _, err := g.TransactionCommit(); err != nil {
+		t.Fatal(err)
+	}
+	g.TransactionStart("dropped")
+	c.SeekByte(100)
+	c.InsertString("never journaled", nil, true)
+	g.TransactionRollback()
+	if _, err := c.MoveBytes(0, 10, 20000, 20000, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CopyBytes(30, 40, 5000, 5002, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	at := ByteAddress(12)
+	if _, err := g.Decorate([]DecorationEntry{{Key: "mark", Address: &at}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalRecordsSplicesWithoutReading(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	os.WriteFile(path, []byte(strings.Repeat("a line of text\n", 2000)), 0644)
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+
+	// The same edits with and without a journal thaw the same leaves:
+	// journaling reads nothing back.
+	var thaws [2]int64
+	var g *Garland
+	for i, journal := range []bool{false, true} {
+		var err error
+		g, err = lib.Open(FileOptions{FilePath: path, MaxLeafSize: 64, Journal: journal})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Chill(ChillEverything); err != nil {
+			t.Fatal(err)
+		}
+		before := g.tierStats.thaws
+		journalEdits(t, g)
+		thaws[i] = g.tierStats.thaws - before
+		if !journal {
+			g.Close()
+		}
+	}
+	if thaws[1] != thaws[0] {
+		t.Errorf("journaled edits thawed %d leaves, unjournaled %d", thaws[1], thaws[0])
+	}
+	want := readAllString(t, g)
+	crash(g)
+
+	// Base, the transaction, the move and the copy: the rollback and the
+	// mark wrote nothing.
+	data, _ := os.ReadFile(JournalPathFor(path))
+	jc, err := parseJournal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jc.records) != 3 {
+		t.Fatalf("%d records, want 3", len(jc.records))
+	}
+	for i, rec := range jc.records {
+		if rec[0] != journalSplice {
+			t.Errorf("record %d is %q, want splices", i, rec[0])
+		}
+	}
+	if n := len(jc.records[0]); n > 64 {
+		t.Errorf("transaction record is %d bytes", n)
+	}
+
+	r, err := lib.Recover(path)
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	defer r.Close()
+	if got := readAllString(t, r); got != want {
+		t.Error("recovered content differs from the crashed buffer")
+	}
+}
+
+// TestJournalRandomUndoForkRecover edits at random - undos and fork
+// seeks that branch the history, transactions, saves, byte deletes
+// that split characters - and recovers after each session.
+func TestJournalRandomUndoForkRecover(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	words := []string{"a", "é", "日本", "hello world ", "x\n", "🙂"}
+	for seed := int64(1); seed <= 150; seed++ {
+		path := filepath.Join(t.TempDir(), "doc.txt")
+		os.WriteFile(path, []byte("the quick brown fox\njumps over\nthe lazy dog\n"), 0644)
+		g, err := lib.Open(FileOptions{FilePath: path, Journal: true, MaxLeafSize: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rng := rand.New(rand.NewSource(seed))
+		c := g.NewCursor()
+		var ops []string
+		for i := 0; i < 50; i++ {
+			if rng.Intn(2) == 0 {
+				c.SeekByte(rng.Int63n(g.ByteCount().Value + 1))
+			}
+			switch k := rng.Intn(12); {
+			case k < 4:
+				c.InsertString(words[rng.Intn(len(words))], nil, true)
+				ops = append(ops, fmt.Sprintf("insert@%d", c.BytePos()))
+			case k < 6:
+				c.DeleteBytes(rng.Int63n(12), false)
+				ops = append(ops, fmt.Sprintf("delete@%d", c.BytePos()))
+			case k == 6:
+				c.OverwriteBytes(rng.Int63n(4), []byte("ov"))
+				ops = append(ops, "overwrite")
+			case k < 9:
+				rev := RevisionID(rng.Int63n(int64(g.CurrentRevision()) + 1))
+				g.UndoSeek(rev)
+				ops = append(ops, fmt.Sprintf("undo %d", rev))
+			case k == 9:
+				forks := g.ListForks()
+				f := forks[rng.Intn(len(forks))].ID
+				g.ForkSeek(f)
+				ops = append(ops, fmt.Sprintf("fork %d", f))
+			case k == 10:
+				g.TransactionStart("tx")
+				c.InsertString("[", nil, true)
+				c.SeekByte(rng.Int63n(g.ByteCount().Value + 1))
+				c.DeleteBytes(2, false)
+				g.TransactionCommit()
+				ops = append(ops, "transaction")
+			default:
+				g.Save()
+				ops = append(ops, "save")
+			}
+		}
+		if err := g.JournalError(); err != nil {
+			t.Fatalf("seed %d: journaling stopped: %v", seed, err)
+		}
+		want := readAllString(t, g)
+		crash(g)
+		if _, err := os.Stat(JournalPathFor(path)); os.IsNotExist(err) {
+			continue // nothing unsaved
+		}
+		r, err := lib.Recover(path)
+		if err != nil {
+			t.Fatalf("seed %d after %v: Recover: %v", seed, ops, err)
+		}
+		if got := readAllString(t, r); got != want {
+			t.Fatalf("seed %d after %v: recovered %q\nwant %q", seed, ops, got, want)
+		}
+		r.Close()
+	}
+}
+
+// readCountingFS counts the bytes read through it.
+type readCountingFS struct {
+	FileSystemInterface
+	read int64
+}
+
+func (r *readCountingFS) ReadBytes(h FileHandle, n int) ([]byte, error) {
+	data, err := r.FileSystemInterface.ReadBytes(h, n)
+	r.read += int64(len(data))
+	return data, err
+}
+
+func TestJournalFileIdentityIsBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.txt")
+	os.WriteFile(path, []byte(strings.Repeat("a line of a large file\n", 200000)), 0644)
+	lib, _ := Init(LibraryOptions{})
+
+	// Journaling adds the identity sample to what opening reads, not
+	// another pass over the file.
+	var read [2]int64
+	for i, journal := range []bool{false, true} {
+		rfs := &readCountingFS{FileSystemInterface: NewLocalFileSystem()}
+		g, err := lib.Open(FileOptions{FilePath: path, FileSystem: rfs, Journal: journal})
+		if err != nil {
+			t.Fatal(err)
+		}
+		read[i] = rfs.read
+		g.Close()
+	}
+	if extra := read[1] - read[0]; extra > 2*journalSample {
+		t.Errorf("journaling read %d more bytes at open, want at most %d", extra, 2*journalSample)
+	}
+
+	id, err := fileIdentity(NewLocalFileSystem(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); id.size != info.Size() || id.modTime != info.ModTime().UnixNano() {
+		t.Errorf("identity %+v, file is %d bytes from %v", id, info.Size(), info.ModTime())
+	}
+}
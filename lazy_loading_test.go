@@ -1,6 +1,7 @@
 package garland
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -540,3 +541,53 @@ func TestReadyAfterModification(t *testing.T) {
 		t.Error("Position 10 should be ready after insert")
 	}
 }
+
+func TestSeekCtxOnStreamingData(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	dataChan := make(chan []byte, 10)
+	g, err := lib.Open(FileOptions{DataChannel: dataChan})
+	if err != nil {
+		t.Fatalf("Failed to create garland: %v", err)
+	}
+	defer g.Close()
+	cursor := g.NewCursor()
+
+	// Cancellation releases a blocked seek with the context's error.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		cancel()
+	}()
+	if err := cursor.SeekByteCtx(ctx, 100); err != context.Canceled {
+		t.Errorf("SeekByteCtx after cancel: got %v, want context.Canceled", err)
+	}
+
+	// A deadline acts as a timeout.
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := cursor.SeekLineCtx(ctx, 3, 0); err != context.DeadlineExceeded {
+		t.Errorf("SeekLineCtx past deadline: got %v, want context.DeadlineExceeded", err)
+	}
+
+	// A read waits for the whole range, then returns it in full.
+	go func() {
+		dataChan <- []byte("hello ")
+		time.Sleep(30 * time.Millisecond)
+		dataChan <- []byte("world\nsecond line")
+		close(dataChan)
+	}()
+	data, err := cursor.ReadBytesCtx(context.Background(), 11)
+	if err != nil || string(data) != "hello world" {
+		t.Errorf("ReadBytesCtx = %q, %v", data, err)
+	}
+
+	// Past EOF is clamped, not an error.
+	cursor.SeekByte(12)
+	s, err := cursor.ReadStringCtx(context.Background(), 100)
+	if err != nil || s != "second line" {
+		t.Errorf("ReadStringCtx = %q, %v", s, err)
+	}
+	if line, err := cursor.ReadLineCtx(context.Background()); err != nil || line != "second line" {
+		t.Errorf("ReadLineCtx = %q, %v", line, err)
+	}
+}
@@ -0,0 +1,110 @@
+package garland
+
+// leaf_hint.go - remembering the leaf a cursor last landed in.
+//
+// DESIGN: positioning a cursor converted its byte position twice (to a
+// rune, then to a line and column), each conversion a root-to-leaf
+// descent, and the line conversion walked the tree a second time to
+// count the lines before the leaf. A cursor that types, or reads a file
+// a few bytes at a time, repeats all of that while staying inside one
+// leaf. Now:
+//
+//   - The descent carries the lines before the leaf down with the
+//     runes before it (LeafSearchResult.LeafLineStart), so one descent
+//     yields every coordinate.
+//   - Each cursor keeps a leafHint: the leaf of its last placement,
+//     with that leaf's absolute byte/rune/line starts. Placing the
+//     cursor again, or reading from it, inside the same leaf and the
+//     same tree skips the descent entirely.
+//
+// A hint is valid while the tree it was taken from is current: the same
+// fork, revision and root node, the same tree generation, the leaf
+// still the node's snapshot there, and its data resident. treeGen moves
+// on every recorded mutation (a transaction edits without a new
+// revision) and whenever counts are rewritten in place (fixCurrent-
+// Aggregates, the deferred recount), so a hint cannot outlive the
+// weights it copied. Anything else - an edit, undo, a chill - fails
+// the check and costs one ordinary descent, which takes a fresh hint.
+//
+// RULING: hints are written only under the write lock (cursor
+// placement). Reads running under the shared lock may consult the
+// reading cursor's hint but never store one, so concurrent readers do
+// not race on it. A stale hint keeps at most one leaf per cursor
+// reachable until the cursor's next placement.
+
+// leafHint is a cursor's cached leaf; see the file comment.
+type leafHint struct {
+	root *Node
+	fork ForkID
+	rev  RevisionID
+	gen  uint64
+	leaf *LeafSearchResult // nil: no hint
+}
+
+// validLocked reports whether h describes the current tree and covers
+// byte pos. Caller holds g.mu (either mode).
+func (h *leafHint) validLocked(g *Garland, pos int64) bool {
+	leaf := h.leaf
+	if leaf == nil || h.gen != g.treeGen || h.root != g.root ||
+		h.fork != g.currentFork || h.rev != g.currentRevision {
+		return false
+	}
+	snap := leaf.Snapshot
+	if pos < leaf.LeafByteStart || pos >= leaf.LeafByteStart+snap.byteCount {
+		return false
+	}
+	return snap.storageState == StorageMemory && snap.data != nil &&
+		leaf.Node.snapshotAt(g.currentFork, g.currentRevision) == snap
+}
+
+// lookupLocked returns the hinted leaf positioned at pos, or nil when
+// the hint does not apply.
+func (h *leafHint) lookupLocked(g *Garland, pos int64) *LeafSearchResult {
+	if h == nil || !h.validLocked(g, pos) {
+		return nil
+	}
+	g.tierStats.hits.Add(1) // as ensureLeafDataResident counts a resident leaf
+	r := *h.leaf
+	r.ByteOffset = pos - r.LeafByteStart
+	r.RuneOffset = byteToRuneOffset(r.Snapshot.data, r.ByteOffset)
+	return &r
+}
+
+// cursorLeafLocked finds the leaf holding byte pos for c: from c's hint
+// when it applies, else by descent, hinting the result. Caller holds
+// the write lock.
+func (g *Garland) cursorLeafLocked(c *Cursor, pos int64) (*LeafSearchResult, error) {
+	if r := c.hint.lookupLocked(g, pos); r != nil {
+		return r, nil
+	}
+	r, err := g.findLeafByByteUnlocked(pos)
+	if err != nil {
+		return nil, err
+	}
+	c.hint = leafHint{root: g.root, fork: g.currentFork, rev: g.currentRevision, gen: g.treeGen, leaf: r}
+	return r, nil
+}
+
+// cursorCoordsLocked converts byte pos to c's other coordinates with at
+// most one descent. Like the conversions it replaces, it answers 0
+// while counting is deferred.
+func (g *Garland) cursorCoordsLocked(c *Cursor, pos int64) (runePos, line, lineRune int64, err error) {
+	if pos == 0 || g.countsDeferred.Load() {
+		return 0, 0, 0, nil
+	}
+	leaf, err := g.cursorLeafLocked(c, pos)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	line, lineRune, err = g.lineRuneInLeafLocked(leaf, pos)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return leaf.LeafRuneStart + leaf.RuneOffset, line, lineRune, nil
+}
+
+// invalidateLeafHints retires every cursor's hint after the current
+// tree's weights were rewritten in place.
+func (g *Garland) invalidateLeafHints() {
+	g.treeGen++
+}
@@ -0,0 +1,135 @@
+package garland
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLeafHintSkipsDescents(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("0123456789\n", 400), MaxLeafSize: 256})
+	defer g.Close()
+	c := g.NewCursor()
+	if err := c.SeekByte(1000); err != nil {
+		t.Fatal(err)
+	}
+	leaf := c.hint.leaf
+	if err := c.SeekByte(leaf.LeafByteStart); err != nil {
+		t.Fatal(err)
+	}
+	end := leaf.LeafByteStart + leaf.Snapshot.byteCount
+	g.SetTracing(true)
+
+	// Reading on inside the leaf the cursor was placed in walks nothing.
+	before := g.TreeCounts()
+	for c.BytePos()+4 < end {
+		if _, err := c.ReadBytes(4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := g.TreeCounts().Sub(before).NodesVisited; n != 0 {
+		t.Errorf("reads within the hinted leaf visited %d nodes", n)
+	}
+
+	// Leaving the leaf costs one descent, after which the hint serves
+	// again.
+	before = g.TreeCounts()
+	if err := c.SeekByte(end + 1); err != nil {
+		t.Fatal(err)
+	}
+	depth := g.TreeCounts().Sub(before).NodesVisited
+	if depth == 0 {
+		t.Fatal("seek past the leaf visited nothing")
+	}
+	before = g.TreeCounts()
+	if err := c.SeekByte(end + 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := g.TreeCounts().Sub(before).NodesVisited; n != 0 {
+		t.Errorf("seek within the new leaf visited %d nodes", n)
+	}
+
+	// Typing: the edit's own path copy, then one descent to place the
+	// cursor - not one per coordinate.
+	before = g.TreeCounts()
+	if err := c.SeekByte(end + 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.InsertString("x", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.InsertString("y", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := g.TreeCounts().Sub(before).NodesVisited; n > 6*depth {
+		t.Errorf("two keystrokes visited %d nodes (depth %d)", n, depth)
+	}
+}
+
+func TestLeafHintStaysCorrect(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("héllo\nwörld\n", 100), MaxLeafSize: 64})
+	defer g.Close()
+	c := g.NewCursor()
+	other := g.NewCursor()
+
+	check := func(step string) {
+		t.Helper()
+		text := readAll(t, g)
+		for i, cur := range []*Cursor{c, other} {
+			for _, pos := range []int64{0, 7, 300, 301, int64(len(text)) / 2, int64(len(text))} {
+				if err := cur.SeekByte(pos); err != nil {
+					t.Fatalf("%s: seek %d: %v", step, pos, err)
+				}
+				prefix := text[:pos]
+				line, col := cur.LinePos()
+				wantLine := int64(strings.Count(prefix, "\n"))
+				wantCol := int64(utf8.RuneCountInString(prefix[strings.LastIndexByte(prefix, '\n')+1:]))
+				if cur.RunePos() != int64(utf8.RuneCountInString(prefix)) || line != wantLine || col != wantCol {
+					t.Fatalf("%s: cursor %d at %d: rune %d line %d:%d, want %d line %d:%d", step, i, pos,
+						cur.RunePos(), line, col, utf8.RuneCountInString(prefix), wantLine, wantCol)
+				}
+				if pos < int64(len(text)) {
+					if b, err := cur.ReadBytes(3); err != nil || string(b) != text[pos:min(pos+3, int64(len(text)))] {
+						t.Fatalf("%s: read at %d: %q %v", step, pos, b, err)
+					}
+				}
+			}
+		}
+	}
+
+	check("fresh")
+	rev := g.CurrentRevision()
+
+	// Another cursor edits the leaf c's hint points into.
+	other.SeekByte(301)
+	if _, err := other.InsertString("ünï\n", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	check("after an edit")
+
+	// Edits inside a transaction keep the revision.
+	if err := g.TransactionStart("t"); err != nil {
+		t.Fatal(err)
+	}
+	c.SeekByte(7)
+	if _, _, err := c.DeleteBytes(5, false); err != nil {
+		t.Fatal(err)
+	}
+	check("in a transaction")
+	if err := g.TransactionRollback(); err != nil {
+		t.Fatal(err)
+	}
+	check("after rollback")
+
+	if err := g.UndoSeek(rev); err != nil {
+		t.Fatal(err)
+	}
+	check("after undo")
+
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatal(err)
+	}
+	check("after chill")
+}
@@ -0,0 +1,193 @@
+package garland
+
+import "strings"
+
+// line_slice.go - the document as a sequence of lines.
+//
+// DESIGN: config editors, TODO apps and similar tools think in lines -
+// "replace line 7", "insert a line before 3" - and would otherwise
+// each rebuild line arithmetic on byte offsets, usually getting the
+// last line wrong. LineSlice presents the document as an indexed
+// sequence of lines on the tree: each call resolves its line's bounds
+// with the same line-index descent ReadLine uses and edits only that
+// line's bytes, so cost does not grow with the document.
+//
+//   - A line is its text WITHOUT the newline. A final newline ends the
+//     last line rather than starting an empty one, so "a\nb\n" and
+//     "a\nb" are both two lines and "" is none - the count a line-based
+//     tool expects, unlike LineCount's count of newlines.
+//   - The document keeps its style: appending to a document without a
+//     final newline adds "\n" + text (still without one), to one with
+//     it adds text + "\n". Deleting the last line of the former takes
+//     the newline before it, and emptying that line gives it one (an
+//     empty line without a newline would be no line at all).
+//   - Line text may not contain '\n' (ErrLineBreak): a line is a line.
+//   - Each mutating call is one revision, made through a private
+//     ephemeral cursor, so marks and other cursors move as with any
+//     edit. The bounds are resolved and the edit applied in two steps;
+//     concurrent writers should serialize through SubmitEdit.
+
+// LineSlice is a line-indexed view of a Garland (see Garland.Lines).
+type LineSlice struct {
+	g *Garland
+}
+
+// Lines returns the line-indexed view of g.
+func (g *Garland) Lines() *LineSlice {
+	return &LineSlice{g: g}
+}
+
+// lineSpan is one line's bytes [start, end), and whether a newline
+// follows end.
+type lineSpan struct {
+	start, end int64
+	terminated bool
+}
+
+// lenLocked returns the number of lines. Caller must hold g.mu.
+func (l *LineSlice) lenLocked() (int64, error) {
+	g := l.g
+	g.ensureCountsLocked()
+	res, err := g.findLeafByLineUnlocked(g.totalLines, 0)
+	if err != nil {
+		return 0, err
+	}
+	if res.LineByteStart < g.totalBytes {
+		return g.totalLines + 1, nil // the last line has no newline
+	}
+	return g.totalLines, nil
+}
+
+// spanLocked returns line i's span, or ErrInvalidPosition when there is
+// no line i. Caller must hold g.mu.
+func (l *LineSlice) spanLocked(i int64) (lineSpan, error) {
+	g := l.g
+	n, err := l.lenLocked()
+	if err != nil {
+		return lineSpan{}, err
+	}
+	if i < 0 || i >= n {
+		return lineSpan{}, ErrInvalidPosition
+	}
+	res, err := g.findLeafByLineUnlocked(i, 0)
+	if err != nil {
+		return lineSpan{}, err
+	}
+	if i == g.totalLines {
+		return lineSpan{start: res.LineByteStart, end: g.totalBytes}, nil
+	}
+	next, err := g.findLeafByLineUnlocked(i+1, 0)
+	if err != nil {
+		return lineSpan{}, err
+	}
+	return lineSpan{start: res.LineByteStart, end: next.LineByteStart - 1, terminated: true}, nil
+}
+
+// span resolves line i under the lock.
+func (l *LineSlice) span(i int64) (lineSpan, error) {
+	l.g.mu.Lock()
+	defer l.g.mu.Unlock()
+	return l.spanLocked(i)
+}
+
+// Len returns the number of lines.
+func (l *LineSlice) Len() int64 {
+	l.g.mu.Lock()
+	defer l.g.mu.Unlock()
+	n, _ := l.lenLocked()
+	return n
+}
+
+// GetLine returns line i without its newline.
+func (l *LineSlice) GetLine(i int64) (string, error) {
+	g := l.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, err := l.spanLocked(i)
+	if err != nil {
+		return "", err
+	}
+	data, err := g.readThawingLocked(s.start, s.end-s.start)
+	return string(data), err
+}
+
+// SetLine replaces the text of line i.
+func (l *LineSlice) SetLine(i int64, text string) (ChangeResult, error) {
+	if strings.Contains(text, "\n") {
+		return ChangeResult{}, ErrLineBreak
+	}
+	s, err := l.span(i)
+	if err != nil {
+		return ChangeResult{}, err
+	}
+	if text == "" && !s.terminated {
+		text = "\n" // an empty last line needs its newline to stay a line
+	}
+	return l.edit(func(c *Cursor) (ChangeResult, error) {
+		_, res, err := l.g.overwriteBytesAt(c, s.start, s.end-s.start, []byte(text))
+		return res, err
+	})
+}
+
+// InsertLine inserts a line so it becomes line i; i == Len appends.
+func (l *LineSlice) InsertLine(i int64, text string) (ChangeResult, error) {
+	if strings.Contains(text, "\n") {
+		return ChangeResult{}, ErrLineBreak
+	}
+	g := l.g
+	g.mu.Lock()
+	n, err := l.lenLocked()
+	var pos int64
+	var data string
+	switch {
+	case err != nil:
+	case i < 0 || i > n:
+		err = ErrInvalidPosition
+	case i < n:
+		var s lineSpan
+		s, err = l.spanLocked(i)
+		pos, data = s.start, text+"\n"
+	case n > g.totalLines:
+		pos, data = g.totalBytes, "\n"+text // keep the missing final newline
+	default:
+		pos, data = g.totalBytes, text+"\n"
+	}
+	g.mu.Unlock()
+	if err != nil {
+		return ChangeResult{}, err
+	}
+	return l.edit(func(c *Cursor) (ChangeResult, error) {
+		return g.insertBytesAt(c, pos, []byte(data), nil, true)
+	})
+}
+
+// AppendLine adds a line at the end.
+func (l *LineSlice) AppendLine(text string) (ChangeResult, error) {
+	return l.InsertLine(l.Len(), text)
+}
+
+// DeleteLine removes line i and its newline.
+func (l *LineSlice) DeleteLine(i int64) (ChangeResult, error) {
+	s, err := l.span(i)
+	if err != nil {
+		return ChangeResult{}, err
+	}
+	start, end := s.start, s.end
+	switch {
+	case s.terminated:
+		end++
+	case start > 0:
+		start-- // the last line, unterminated: take the newline before it
+	}
+	return l.edit(func(c *Cursor) (ChangeResult, error) {
+		_, res, err := l.g.deleteBytesAt(c, start, end-start, false)
+		return res, err
+	})
+}
+
+// edit runs fn with a private ephemeral cursor.
+func (l *LineSlice) edit(fn func(c *Cursor) (ChangeResult, error)) (ChangeResult, error) {
+	c := l.g.NewEphemeralCursor()
+	defer l.g.RemoveCursor(c)
+	return fn(c)
+}
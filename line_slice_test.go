@@ -0,0 +1,75 @@
+package garland
+
+import "testing"
+
+func TestLineSlice(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		n    int64
+	}{{"", 0}, {"a", 1}, {"a\n", 1}, {"a\n\nb", 3}, {"a\n\nb\n", 3}} {
+		lib, _ := Init(LibraryOptions{})
+		g, _ := lib.Open(FileOptions{DataBytes: []byte(tc.text)})
+		if n := g.Lines().Len(); n != tc.n {
+			t.Errorf("Len(%q) = %d, want %d", tc.text, n, tc.n)
+		}
+		g.Close()
+	}
+
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "alpha\nbeta\ngamma"})
+	defer g.Close()
+	l := g.Lines()
+	mark := ByteAddress(8) // inside "beta"
+	g.Decorate([]DecorationEntry{{Key: "m", Address: &mark}})
+
+	steps := []struct {
+		do   func() (ChangeResult, error)
+		want string
+	}{
+		{func() (ChangeResult, error) { return l.SetLine(1, "BETA!") }, "alpha\nBETA!\ngamma"},
+		{func() (ChangeResult, error) { return l.InsertLine(0, "zero") }, "zero\nalpha\nBETA!\ngamma"},
+		{func() (ChangeResult, error) { return l.AppendLine("omega") }, "zero\nalpha\nBETA!\ngamma\nomega"},
+		{func() (ChangeResult, error) { return l.DeleteLine(4) }, "zero\nalpha\nBETA!\ngamma"},
+		{func() (ChangeResult, error) { return l.DeleteLine(1) }, "zero\nBETA!\ngamma"},
+		{func() (ChangeResult, error) { return l.SetLine(2, "") }, "zero\nBETA!\n\n"},
+		{func() (ChangeResult, error) { return l.AppendLine("end") }, "zero\nBETA!\n\nend\n"},
+	}
+	for i, s := range steps {
+		rev := g.CurrentRevision()
+		if _, err := s.do(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got := readAll(t, g); got != s.want {
+			t.Fatalf("step %d: %q, want %q", i, got, s.want)
+		}
+		if g.CurrentRevision() != rev+1 {
+			t.Errorf("step %d: %d revisions, want one", i, g.CurrentRevision()-rev)
+		}
+	}
+	if line, err := l.GetLine(1); err != nil || line != "BETA!" {
+		t.Errorf("GetLine(1) = %q, %v", line, err)
+	}
+	if line, err := l.GetLine(2); err != nil || line != "" {
+		t.Errorf("GetLine(2) = %q, %v", line, err)
+	}
+	if pos, _ := g.GetDecorationPosition("m"); pos.Byte < 5 || pos.Byte > 10 {
+		t.Errorf("mark in the replaced line moved to %d", pos.Byte)
+	}
+}
+
+func TestLineSliceErrors(t *testing.T) {
+	g, _ := openWithRevisions(t, nil) // "rev0 content\n": one line
+	l := g.Lines()
+	if _, err := l.GetLine(1); err != ErrInvalidPosition {
+		t.Errorf("GetLine past the end: %v", err)
+	}
+	if _, err := l.InsertLine(2, "x"); err != ErrInvalidPosition {
+		t.Errorf("InsertLine past the end: %v", err)
+	}
+	if _, err := l.SetLine(0, "two\nlines"); err != ErrLineBreak {
+		t.Errorf("SetLine with a newline: %v", err)
+	}
+	if _, err := l.DeleteLine(0); err != nil || l.Len() != 0 || readAll(t, g) != "" {
+		t.Errorf("deleting the only line: %v, %q", err, readAll(t, g))
+	}
+}
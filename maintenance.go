@@ -2,10 +2,16 @@ package garland
 
 import (
 	"sort"
+	"sync/atomic"
 	"time"
 )
 
 // MemoryStats contains current memory usage statistics.
+//
+// Leaf counts and per-tier byte figures describe the leaves of the
+// CURRENT revision (where the document's data lives right now);
+// MemoryBytes and ColdBytes cover every snapshot, history included.
+// The traffic counters run from Open.
 type MemoryStats struct {
 	MemoryBytes      int64 // bytes of in-memory leaf data
 	SoftLimit        int64 // configured soft limit (0 = disabled)
@@ -14,6 +20,35 @@ type MemoryStats struct {
 	ColdStoredLeaves int   // count of leaves with data in cold storage
 	WarmStoredLeaves int   // count of leaves with data in warm storage
 	UnderPressure    bool  // true if hard limit exceeded and can't reduce
+	ColdBytes        int64 // bytes this garland has stored in cold storage
+	ColdQuota        int64 // configured cold storage quota (0 = unlimited)
+
+	// Per-tier bytes and counts (current revision)
+	InMemoryLeafBytes int64 // content bytes held in memory
+	WarmLeafBytes     int64 // content bytes backed by the source file
+	ColdLeafBytes     int64 // content bytes in cold storage
+	PlaceholderLeaves int   // leaves whose data was lost
+	PlaceholderBytes  int64 // content bytes those leaves stood for
+
+	// Tier traffic since Open
+	Chills        int64   // leaves moved to cold storage
+	WarmEvictions int64   // leaves evicted to warm storage
+	Thaws         int64   // leaves read back from cold storage
+	WarmReads     int64   // leaves read back from the source file
+	CacheHits     int64   // leaf accesses served from memory
+	CacheHitRate  float64 // CacheHits / (CacheHits + Thaws + WarmReads); 0 before any access
+}
+
+// tierCounters counts storage-tier traffic since the garland opened
+// (see MemoryStats). Updated under the garland's write lock, except
+// hits: memory-resident leaves are also reached by read-locked lookups,
+// so that one is atomic.
+type tierCounters struct {
+	chills        int64
+	warmEvictions int64
+	thaws         int64
+	warmReads     int64
+	hits          atomic.Int64
 }
 
 // MaintenanceStats contains statistics from a maintenance run.
@@ -30,10 +65,12 @@ func (g *Garland) MemoryUsage() MemoryStats {
 
 	stats := MemoryStats{
 		MemoryBytes: g.memoryBytes,
+		ColdBytes:   g.coldBytes,
 	}
 	if g.lib != nil {
 		stats.SoftLimit = g.lib.memorySoftLimit
 		stats.HardLimit = g.lib.memoryHardLimit
+		stats.ColdQuota = g.lib.coldQuota.limit
 		g.lib.mu.RLock()
 		stats.UnderPressure = g.lib.memoryPressure
 		g.lib.mu.RUnlock()
@@ -48,13 +85,29 @@ func (g *Garland) MemoryUsage() MemoryStats {
 		switch snap.storageState {
 		case StorageMemory:
 			stats.InMemoryLeaves++
+			stats.InMemoryLeafBytes += snap.byteCount
 		case StorageCold:
 			stats.ColdStoredLeaves++
+			stats.ColdLeafBytes += snap.byteCount
 		case StorageWarm:
 			stats.WarmStoredLeaves++
+			stats.WarmLeafBytes += snap.byteCount
+		case StoragePlaceholder:
+			stats.PlaceholderLeaves++
+			stats.PlaceholderBytes += snap.byteCount
 		}
 	}
 
+	tc := &g.tierStats
+	stats.Chills = tc.chills
+	stats.WarmEvictions = tc.warmEvictions
+	stats.Thaws = tc.thaws
+	stats.WarmReads = tc.warmReads
+	stats.CacheHits = tc.hits.Load()
+	if accesses := stats.CacheHits + tc.thaws + tc.warmReads; accesses > 0 {
+		stats.CacheHitRate = float64(stats.CacheHits) / float64(accesses)
+	}
+
 	return stats
 }
 
@@ -80,6 +133,7 @@ type lruCandidate struct {
 	snap       *NodeSnapshot
 	accessTime time.Time
 	bytes      int64
+	warm       bool // can be evicted to warm storage (costs no cold quota)
 }
 
 // collectLRUCandidates finds all in-memory leaves that could be chilled,
@@ -98,9 +152,10 @@ func (lib *Library) collectLRUCandidates() []lruCandidate {
 			continue
 		}
 
+		hasSource := g.sourceHandle != nil && g.sourceFS != nil
 		for _, node := range g.nodeRegistry {
 			for forkRev, snap := range node.history {
-				if snap.isLeaf && snap.storageState == StorageMemory && len(snap.data) > 0 {
+				if snap.isLeaf && snap.storageState == StorageMemory && len(snap.data) > 0 && !snap.writeBackPending && snap.pins == 0 {
 					candidates = append(candidates, lruCandidate{
 						garland:    g,
 						nodeID:     node.id,
@@ -108,6 +163,7 @@ func (lib *Library) collectLRUCandidates() []lruCandidate {
 						snap:       snap,
 						accessTime: snap.lastAccessTime,
 						bytes:      int64(len(snap.data)),
+						warm:       hasSource && snap.originalFileOffset >= 0,
 					})
 				}
 			}
@@ -115,8 +171,15 @@ func (lib *Library) collectLRUCandidates() []lruCandidate {
 		g.mu.RUnlock()
 	}
 
+	// Near the cold storage quota, leaves that can go to warm storage
+	// come first: evicting them costs no cold storage at all.
+	warmFirst := lib.coldQuota.underPressure()
+
 	// Sort by access time (oldest first - zero time sorts first)
 	sort.Slice(candidates, func(i, j int) bool {
+		if warmFirst && candidates[i].warm != candidates[j].warm {
+			return candidates[i].warm
+		}
 		// Zero time (never accessed) should come first
 		if candidates[i].accessTime.IsZero() && !candidates[j].accessTime.IsZero() {
 			return true
@@ -153,12 +216,12 @@ func (lib *Library) IncrementalChill(budget int) MaintenanceStats {
 
 		// Verify the snapshot is still valid and in memory
 		node := c.garland.nodeRegistry[c.nodeID]
-		if node == nil {
+		if node == nil || c.garland.closed {
 			c.garland.mu.Unlock()
 			continue
 		}
 		snap, ok := node.history[c.forkRev]
-		if !ok || snap.storageState != StorageMemory || len(snap.data) == 0 {
+		if !ok || snap.storageState != StorageMemory || len(snap.data) == 0 || snap.writeBackPending || snap.pins > 0 {
 			c.garland.mu.Unlock()
 			continue
 		}
@@ -189,7 +252,7 @@ func (lib *Library) ChillToTarget() MaintenanceStats {
 	totalStats := MaintenanceStats{}
 
 	for {
-		currentUsage := lib.TotalMemoryUsage()
+		currentUsage := lib.projectedMemoryUsage()
 		if currentUsage <= lib.memorySoftLimit {
 			break
 		}
@@ -245,13 +308,65 @@ func (lib *Library) StopMaintenance() {
 func (lib *Library) runMaintenanceTick() {
 	// Check memory pressure and chill if needed
 	if lib.memorySoftLimit > 0 {
-		currentUsage := lib.TotalMemoryUsage()
+		currentUsage := lib.projectedMemoryUsage()
 		if currentUsage > lib.memorySoftLimit {
 			lib.IncrementalChill(lib.chillBudgetPerTick)
 		}
 	}
 
-	// TODO: Add incremental rebalancing here
+	// Chill documents nobody has looked at for a while
+	if lib.idleChillAfter > 0 {
+		lib.chillIdleGarlands(time.Now())
+	}
+
+	// Amortized rebalancing (RebalanceBackground)
+	if lib.rebalancePolicy.Mode == RebalanceBackground {
+		lib.rebalanceTick()
+	}
+}
+
+// touchAccess records that the document was just used (read, edited,
+// navigated), restarting its IdleChillAfter clock. Lock-free.
+func (g *Garland) touchAccess() {
+	g.lastAccess.Store(time.Now().UnixNano())
+	g.idleChilled.Store(false)
+}
+
+// Touch marks the document as in use without reading it - for an
+// application that shows a buffer (it is on screen, so not idle) while
+// its rendering is served from a cache. Restarts the IdleChillAfter
+// clock.
+func (g *Garland) Touch() {
+	g.touchAccess()
+}
+
+// LastAccess returns when the document was last read, edited,
+// navigated or touched.
+func (g *Garland) LastAccess() time.Time {
+	return time.Unix(0, g.lastAccess.Load())
+}
+
+// chillIdleGarlands runs ChillEverything on every document idle for
+// at least IdleChillAfter, once per idle period. The garlands are
+// collected first so no garland lock is taken under lib.mu.
+func (lib *Library) chillIdleGarlands(now time.Time) {
+	cutoff := now.Add(-lib.idleChillAfter).UnixNano()
+
+	lib.mu.RLock()
+	var idle []*Garland
+	for _, g := range lib.activeGarlands {
+		if !g.idleChilled.Load() && g.lastAccess.Load() <= cutoff {
+			idle = append(idle, g)
+		}
+	}
+	lib.mu.RUnlock()
+
+	for _, g := range idle {
+		// Flag first: an access racing the chill clears it again, and
+		// the document is reconsidered after its next idle period.
+		g.idleChilled.Store(true)
+		g.Chill(ChillEverything)
+	}
 }
 
 // CheckMemoryPressure checks if memory limits are exceeded and performs
@@ -266,7 +381,7 @@ func (g *Garland) CheckMemoryPressure() MaintenanceStats {
 
 	// Check hard limit first (immediate action needed)
 	if g.lib.memoryHardLimit > 0 {
-		currentUsage := g.lib.TotalMemoryUsage()
+		currentUsage := g.lib.projectedMemoryUsage()
 		if currentUsage > g.lib.memoryHardLimit {
 			// Do multiple rounds until under limit or no progress
 			for currentUsage > g.lib.memoryHardLimit {
@@ -280,7 +395,7 @@ func (g *Garland) CheckMemoryPressure() MaintenanceStats {
 				}
 				stats.NodesChilled += s.NodesChilled
 				stats.BytesChilled += s.BytesChilled
-				currentUsage = g.lib.TotalMemoryUsage()
+				currentUsage = g.lib.projectedMemoryUsage()
 			}
 
 			// Clear pressure flag if we got under the limit
@@ -299,7 +414,7 @@ func (g *Garland) CheckMemoryPressure() MaintenanceStats {
 
 	// Check soft limit (opportunistic action)
 	if g.lib.memorySoftLimit > 0 && stats.NodesChilled == 0 {
-		currentUsage := g.lib.TotalMemoryUsage()
+		currentUsage := g.lib.projectedMemoryUsage()
 		if currentUsage > g.lib.memorySoftLimit {
 			s := g.lib.IncrementalChill(g.lib.chillBudgetPerTick)
 			stats.NodesChilled += s.NodesChilled
@@ -422,6 +537,9 @@ func (g *Garland) updateChildReference(parentID, oldChildID, newChildID NodeID)
 		// it (zero) poisons every cross-leaf column conversion that
 		// passes through this node.
 		runesAfterLastNewline: snap.runesAfterLastNewline,
+		decorationCount:       snap.decorationCount,
+		namespaceCounts:       snap.namespaceCounts,
+		uncounted:             snap.uncounted,
 	}
 
 	if snap.leftID == oldChildID {
@@ -460,58 +578,27 @@ func (g *Garland) NeedsRebalancing() bool {
 }
 
 // ForceRebalance performs a full tree rebalance (not incremental).
-// Use sparingly as this can be expensive for large trees.
+// Use sparingly as this can be expensive for large trees; see
+// ForceRebalanceWithin for a time-budgeted variant. Leaves are reused
+// as-is (no data is thawed); only the internal shape is rebuilt.
 func (g *Garland) ForceRebalance() MaintenanceStats {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
 	stats := MaintenanceStats{}
-
-	// Collect all leaf data in order
-	var leaves []*NodeSnapshot
-	g.collectLeafSnapshots(g.root, &leaves)
-
-	if len(leaves) <= 1 {
+	if g.rebalanceBlockedLocked() {
 		return stats
 	}
 
 	// Rebuild as a balanced tree
 	// This is expensive but guarantees balance
-	newRootID := g.rebuildBalanced(leaves, 0, len(leaves))
-	if newRootID != 0 && newRootID != g.root.id {
-		g.root = g.nodeRegistry[newRootID]
+	if g.rebuildLocked(time.Time{}) {
 		stats.RotationsPerformed = -1 // indicates full rebuild
-		g.nodeManipulations = 0       // reset counter after rebalance
 	}
 
 	return stats
 }
 
-// collectLeafSnapshots gathers all leaf snapshots in order for rebalancing.
-func (g *Garland) collectLeafSnapshots(node *Node, leaves *[]*NodeSnapshot) {
-	if node == nil {
-		return
-	}
-
-	snap := node.snapshotAt(g.currentFork, g.currentRevision)
-	if snap == nil {
-		return
-	}
-
-	if snap.isLeaf {
-		*leaves = append(*leaves, snap)
-		return
-	}
-
-	// Internal node - recurse
-	if leftNode := g.nodeRegistry[snap.leftID]; leftNode != nil {
-		g.collectLeafSnapshots(leftNode, leaves)
-	}
-	if rightNode := g.nodeRegistry[snap.rightID]; rightNode != nil {
-		g.collectLeafSnapshots(rightNode, leaves)
-	}
-}
-
 // rebuildBalanced rebuilds a balanced tree from a slice of leaves.
 func (g *Garland) rebuildBalanced(leaves []*NodeSnapshot, start, end int) NodeID {
 	if start >= end {
@@ -559,5 +646,11 @@ func (g *Garland) rebuildBalanced(leaves []*NodeSnapshot, start, end int) NodeID
 // Close properly shuts down a Garland, including stopping maintenance.
 func (lib *Library) Close() error {
 	lib.StopMaintenance()
+	if lib.writeBack != nil {
+		lib.writeBack.stop()
+	}
+	if lib.ownedPack != nil {
+		return lib.ownedPack.Close()
+	}
 	return nil
 }
@@ -3,6 +3,7 @@ package garland
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -89,6 +90,42 @@ func TestMemoryUsageWithColdStorage(t *testing.T) {
 	}
 }
 
+func TestMemoryUsagePerTier(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	content := "Per-tier statistics content."
+	g, _ := lib.Open(FileOptions{DataString: content})
+	defer g.Close()
+
+	n := int64(len(content))
+	if st := g.MemoryUsage(); st.InMemoryLeafBytes != n || st.ColdLeafBytes != 0 {
+		t.Errorf("before chill: memory %d, cold %d; want %d, 0", st.InMemoryLeafBytes, st.ColdLeafBytes, n)
+	}
+
+	g.Chill(ChillEverything)
+	st := g.MemoryUsage()
+	if st.InMemoryLeafBytes != 0 || st.ColdLeafBytes != n {
+		t.Errorf("after chill: memory %d, cold %d; want 0, %d", st.InMemoryLeafBytes, st.ColdLeafBytes, n)
+	}
+	if st.Chills < 1 || st.Thaws != 0 {
+		t.Errorf("after chill: Chills=%d Thaws=%d", st.Chills, st.Thaws)
+	}
+
+	// First read thaws (a miss), the second is served from memory.
+	c := g.NewCursor()
+	c.ReadBytes(4)
+	c.ReadBytes(4)
+	st = g.MemoryUsage()
+	if st.Thaws < 1 || st.CacheHits < 1 {
+		t.Errorf("after reads: Thaws=%d CacheHits=%d", st.Thaws, st.CacheHits)
+	}
+	if st.CacheHitRate <= 0 || st.CacheHitRate >= 1 {
+		t.Errorf("CacheHitRate = %v, want strictly between 0 and 1", st.CacheHitRate)
+	}
+	if st.InMemoryLeafBytes != n {
+		t.Errorf("after thaw: InMemoryLeafBytes = %d, want %d", st.InMemoryLeafBytes, n)
+	}
+}
+
 func TestIncrementalChillLRU(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "garland_test")
 	if err != nil {
@@ -465,3 +502,80 @@ func TestMemoryOnlySkipsChill(t *testing.T) {
 
 	t.Logf("IncrementalChill on MemoryOnly: chilled %d nodes", stats.NodesChilled)
 }
+
+func TestIdleChillAfter(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir(), IdleChillAfter: time.Hour})
+	defer lib.Close()
+
+	idle, _ := lib.Open(FileOptions{DataString: "background buffer"})
+	defer idle.Close()
+	busy, _ := lib.Open(FileOptions{DataString: "foreground buffer"})
+	defer busy.Close()
+
+	// Pretend two hours pass; only the busy buffer is used meanwhile.
+	later := time.Now().Add(2 * time.Hour)
+	busy.lastAccess.Store(later.UnixNano())
+	lib.chillIdleGarlands(later)
+
+	if st := idle.MemoryUsage(); st.InMemoryLeafBytes != 0 || st.ColdLeafBytes == 0 {
+		t.Errorf("idle buffer not chilled: %+v", st)
+	}
+	if st := busy.MemoryUsage(); st.InMemoryLeafBytes == 0 {
+		t.Errorf("busy buffer was chilled: %+v", st)
+	}
+
+	// Chilled once per idle period; an access re-arms it.
+	if !idle.idleChilled.Load() {
+		t.Error("idle buffer should be flagged as chilled")
+	}
+	if d, _ := idle.NewCursor().ReadBytes(10); string(d) != "background" {
+		t.Errorf("read after idle chill = %q", d)
+	}
+	if idle.idleChilled.Load() {
+		t.Error("access should clear the idle flag")
+	}
+	if time.Since(idle.LastAccess()) > time.Minute {
+		t.Errorf("LastAccess = %v, want recent", idle.LastAccess())
+	}
+}
+
+func TestCloseDuringMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc.txt")
+	os.WriteFile(path, []byte(strings.Repeat("some text on a line\n", 500)), 0644)
+	lib, err := Init(LibraryOptions{
+		ColdStoragePath:    filepath.Join(dir, "cold"),
+		MemorySoftLimit:    10,
+		MemoryHardLimit:    100,
+		BackgroundInterval: time.Millisecond,
+		ChillBudgetPerTick: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lib.StopMaintenance()
+
+	// Every edit kicks a pressure check and the worker ticks throughout:
+	// Close must wait them out and leave nothing for them to touch
+	// (run with -race).
+	for i := 0; i < 20; i++ {
+		g, err := lib.Open(FileOptions{FilePath: path, MaxLeafSize: 64})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := g.NewCursor()
+		for j := 0; j < 10; j++ {
+			c.SeekByte(int64(j * 300))
+			c.InsertString("edit ", nil, true)
+		}
+		if err := g.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if g.sourceHandle != nil {
+			t.Fatal("Close left the source handle open")
+		}
+	}
+	if n := len(lib.activeGarlands); n != 0 {
+		t.Errorf("%d garlands still registered", n)
+	}
+}
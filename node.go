@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"time"
-	"unicode/utf8"
 )
 
 // NodeID uniquely identifies a node within a Garland.
@@ -88,6 +87,23 @@ type NodeSnapshot struct {
 	// For internal nodes, this is derived from children.
 	runesAfterLastNewline int64
 
+	// uncounted marks a snapshot whose rune and line weights (and, for
+	// a leaf, lineStarts) have not been computed yet - a leaf loaded
+	// under CountDeferred, or an internal node above one. See
+	// counting.go.
+	uncounted bool
+
+	// decorationCount is the number of decorations in this subtree. It
+	// counts a cold leaf's marks too (their side block still holds
+	// them), so navigation can skip mark-free subtrees without
+	// visiting them (see decoration_nav.go).
+	decorationCount int64
+
+	// namespaceCounts is decorationCount broken down by namespace
+	// (namespaced marks only; nil when there are none). Shared, never
+	// modified, between snapshots that have the same counts.
+	namespaceCounts map[string]int64
+
 	// lineStarts contains the starting positions of each line within this leaf.
 	// Only populated for leaf nodes.
 	lineStarts []LineStart
@@ -95,6 +111,15 @@ type NodeSnapshot struct {
 	// lastAccessTime tracks when this snapshot's data was last accessed.
 	// Used for LRU-based memory management. Zero value means never accessed.
 	lastAccessTime time.Time
+
+	// writeBackPending is set while this snapshot's blocks sit in the
+	// write-behind queue (see writeback.go). The data stays resident
+	// until the backend has accepted it.
+	writeBackPending bool
+
+	// pins counts outstanding zero-copy Pins borrowing this snapshot's
+	// data (see zerocopy.go). A pinned snapshot is never chilled.
+	pins int
 }
 
 // becomePlaceholder marks the snapshot's data as lost, recording why.
@@ -176,6 +201,9 @@ func (n *Node) snapshotAtWithKey(fork ForkID, rev RevisionID) (*NodeSnapshot, Fo
 // setSnapshot sets the node's snapshot for the given fork and revision.
 func (n *Node) setSnapshot(fork ForkID, rev RevisionID, snap *NodeSnapshot) {
 	n.history[ForkRevision{fork, rev}] = snap
+	if g := n.file; g != nil && g.trace.on.Load() {
+		g.trace.snapshots.Add(1)
+	}
 }
 
 // createLeafSnapshot creates a new leaf snapshot with the given data.
@@ -186,16 +214,50 @@ func createLeafSnapshot(data []byte, decorations []Decoration, originalOffset in
 		decorations:        decorations,
 		storageState:       StorageMemory,
 		originalFileOffset: originalOffset,
+		decorationCount:    int64(len(decorations)),
 		lastAccessTime:     time.Now(), // Initialize access time for LRU tracking
 	}
 
-	// Calculate weights
+	for _, d := range decorations {
+		if ns, _ := splitNamespacedKey(d.Key); ns != "" {
+			if snap.namespaceCounts == nil {
+				snap.namespaceCounts = make(map[string]int64)
+			}
+			snap.namespaceCounts[ns]++
+		}
+	}
+
 	snap.byteCount = int64(len(data))
-	snap.runeCount = int64(utf8.RuneCount(data))
+	snap.indexCounts()
+
+	// Hashes are computed LAZILY, at chill time (chillSnapshot /
+	// chillToWarmStorage fill them in before data leaves memory), for
+	// two reasons:
+	//   - SHA-256 over up to 128KB on every leaf rebuild was the
+	//     dominant per-keystroke cost, paid even though most leaves
+	//     are superseded without ever being chilled.
+	//   - An eagerly computed decorationHash used a DIFFERENT encoding
+	//     (computeDecorationHash) than what cold storage writes and
+	//     thaw verifies (encodeDecorations), so any chilled leaf with
+	//     decorations failed verification on thaw and silently dropped
+	//     its marks. With one writer - the chill path - the hash always
+	//     matches the stored encoding.
+
+	return snap
+}
+
+// indexCounts computes a leaf's rune and line weights and its line
+// starts index from its resident data.
+func (snap *NodeSnapshot) indexCounts() {
+	data := snap.data
+	snap.uncounted = false
+	snap.lineCount = 0
 
 	// Count newlines and build line starts index. Hops newline to
 	// newline with IndexByte instead of decoding every rune - this runs
-	// on every leaf rebuild, i.e. on every keystroke.
+	// on every leaf rebuild, i.e. on every keystroke. The rune count is
+	// the sum of the line segments' (see count_kernels.go), so the data
+	// is scanned once.
 	snap.lineStarts = make([]LineStart, 0)
 	snap.lineStarts = append(snap.lineStarts, LineStart{ByteOffset: 0, RuneOffset: 0})
 
@@ -208,7 +270,7 @@ func createLeafSnapshot(data []byte, decorations []Decoration, originalOffset in
 		}
 		nl := prev + i
 		snap.lineCount++
-		runeOffset += int64(utf8.RuneCount(data[prev : nl+1]))
+		runeOffset += countRunes(data[prev : nl+1])
 		if nl+1 < len(data) {
 			snap.lineStarts = append(snap.lineStarts, LineStart{
 				ByteOffset: int64(nl + 1),
@@ -217,6 +279,7 @@ func createLeafSnapshot(data []byte, decorations []Decoration, originalOffset in
 		}
 		prev = nl + 1
 	}
+	snap.runeCount = runeOffset + countRunes(data[prev:])
 
 	// Calculate runes after last newline from lineStarts
 	if snap.lineCount == 0 {
@@ -229,21 +292,6 @@ func createLeafSnapshot(data []byte, decorations []Decoration, originalOffset in
 		// Leaf ends with newline
 		snap.runesAfterLastNewline = 0
 	}
-
-	// Hashes are computed LAZILY, at chill time (chillSnapshot /
-	// chillToWarmStorage fill them in before data leaves memory), for
-	// two reasons:
-	//   - SHA-256 over up to 128KB on every leaf rebuild was the
-	//     dominant per-keystroke cost, paid even though most leaves
-	//     are superseded without ever being chilled.
-	//   - An eagerly computed decorationHash used a DIFFERENT encoding
-	//     (computeDecorationHash) than what cold storage writes and
-	//     thaw verifies (encodeDecorations), so any chilled leaf with
-	//     decorations failed verification on thaw and silently dropped
-	//     its marks. With one writer - the chill path - the hash always
-	//     matches the stored encoding.
-
-	return snap
 }
 
 // createInternalSnapshot creates a new internal (non-leaf) snapshot.
@@ -266,7 +314,29 @@ func createInternalSnapshot(leftID, rightID NodeID, leftSnap, rightSnap *NodeSna
 		runeCount:             leftSnap.runeCount + rightSnap.runeCount,
 		lineCount:             leftSnap.lineCount + rightSnap.lineCount,
 		runesAfterLastNewline: runesAfterLastNewline,
+		decorationCount:       leftSnap.decorationCount + rightSnap.decorationCount,
+		namespaceCounts:       mergeNamespaceCounts(leftSnap.namespaceCounts, rightSnap.namespaceCounts),
+		uncounted:             leftSnap.uncounted || rightSnap.uncounted,
+	}
+}
+
+// mergeNamespaceCounts sums two namespaceCounts maps, sharing one when
+// the other is empty.
+func mergeNamespaceCounts(a, b map[string]int64) map[string]int64 {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
 	}
+	sum := make(map[string]int64, len(a)+len(b))
+	for ns, n := range a {
+		sum[ns] = n
+	}
+	for ns, n := range b {
+		sum[ns] += n
+	}
+	return sum
 }
 
 // IsLeaf returns true if this snapshot represents a leaf node.
@@ -322,10 +392,11 @@ func computeHash(data []byte) []byte {
 // partitionDecorations splits a leaf's decorations around an insert at
 // pos. Marks strictly before pos stay in the left piece; marks
 // strictly after go to the right piece (rebased). A mark EXACTLY at
-// pos is governed by insertBefore: true slides it past the inserted
-// content (right piece), false keeps it at its absolute address, which
-// is the FIRST BYTE OF THE INSERTED CONTENT - returned in boundary so
-// the caller homes it at offset 0 of the middle (inserted) leaf.
+// pos is governed by its Gravity (by insertBefore for GravityDefault):
+// sliding puts it past the inserted content (right piece); staying
+// keeps it at its absolute address, which is the FIRST BYTE OF THE
+// INSERTED CONTENT - returned in boundary so the caller homes it at
+// offset 0 of the middle (inserted) leaf.
 // Storage invariant: a mark never lives at a leaf's end offset (only
 // an EOF mark on the final leaf may), so the left piece never receives
 // boundary marks.
@@ -334,13 +405,12 @@ func partitionDecorations(decorations []Decoration, pos int64, insertBefore bool
 		switch {
 		case d.Position < pos:
 			left = append(left, d)
-		case d.Position == pos && !insertBefore:
-			boundary = append(boundary, Decoration{Key: d.Key, Position: 0})
+		case d.Position == pos && !d.Gravity.slides(insertBefore):
+			d.Position = 0
+			boundary = append(boundary, d)
 		default:
-			right = append(right, Decoration{
-				Key:      d.Key,
-				Position: d.Position - pos,
-			})
+			d.Position -= pos
+			right = append(right, d)
 		}
 	}
 	return
@@ -359,8 +429,9 @@ type ForkInfo struct {
 // RevisionInfo contains metadata about a revision for undo history display.
 type RevisionInfo struct {
 	Revision         RevisionID
-	Name             string // from TransactionStart
-	HasChanges       bool   // true if actual mutations occurred
-	RootID           NodeID // root node ID at this revision (for UndoSeek)
-	StreamKnownBytes int64  // bytes of streaming content known when revision was created (-1 if complete)
+	Name             string    // from TransactionStart
+	HasChanges       bool      // true if actual mutations occurred
+	RootID           NodeID    // root node ID at this revision (for UndoSeek)
+	StreamKnownBytes int64     // bytes of streaming content known when revision was created (-1 if complete)
+	Time             time.Time // when the revision was recorded
 }
@@ -2,7 +2,6 @@ package garland
 
 import (
 	"sync/atomic"
-	"unicode/utf8"
 )
 
 // regionSerialCounter is a global counter for assigning unique serial numbers to regions.
@@ -71,7 +70,7 @@ func (h *OptimizedRegionHandle) ByteCount() int64 {
 func (h *OptimizedRegionHandle) adjustDecorationsForInsert(offset, insertLen int64, insertBefore bool) {
 	for i := range h.decorations {
 		if h.decorations[i].Position > offset ||
-			(h.decorations[i].Position == offset && insertBefore) {
+			(h.decorations[i].Position == offset && h.decorations[i].Gravity.slides(insertBefore)) {
 			h.decorations[i].Position += insertLen
 		}
 	}
@@ -88,6 +87,7 @@ func (h *OptimizedRegionHandle) adjustDecorationsForDelete(offset, deleteLen int
 			kept = append(kept, Decoration{
 				Key:      d.Key,
 				Position: d.Position - deleteLen,
+				Gravity:  d.Gravity,
 			})
 		} else {
 			// Decoration in deleted range
@@ -118,13 +118,8 @@ func NewByteBufferRegion(initialContent []byte) *ByteBufferRegion {
 
 // recalculateCounts updates rune and line counts from the data.
 func (r *ByteBufferRegion) recalculateCounts() {
-	r.runeCount = int64(utf8.RuneCount(r.data))
-	r.lineCount = 0
-	for _, b := range r.data {
-		if b == '\n' {
-			r.lineCount++
-		}
-	}
+	r.runeCount = countRunes(r.data)
+	r.lineCount = countNewlines(r.data)
 }
 
 // ByteCount returns the number of bytes in the region.
@@ -149,13 +144,8 @@ func (r *ByteBufferRegion) InsertBytes(offset int64, data []byte) error {
 	}
 
 	// Count runes and lines in inserted data
-	insertedRunes := int64(utf8.RuneCount(data))
-	insertedLines := int64(0)
-	for _, b := range data {
-		if b == '\n' {
-			insertedLines++
-		}
-	}
+	insertedRunes := countRunes(data)
+	insertedLines := countNewlines(data)
 
 	// Insert into buffer
 	newData := make([]byte, len(r.data)+len(data))
@@ -178,13 +168,8 @@ func (r *ByteBufferRegion) DeleteBytes(offset, length int64) error {
 
 	// Count runes and lines in deleted data
 	deletedData := r.data[offset : offset+length]
-	deletedRunes := int64(utf8.RuneCount(deletedData))
-	deletedLines := int64(0)
-	for _, b := range deletedData {
-		if b == '\n' {
-			deletedLines++
-		}
-	}
+	deletedRunes := countRunes(deletedData)
+	deletedLines := countNewlines(deletedData)
 
 	// Delete from buffer
 	newData := make([]byte, len(r.data)-int(length))
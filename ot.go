@@ -0,0 +1,689 @@
+package garland
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// ot.go - revisions as operational-transform operations.
+//
+// DESIGN: a real-time collaboration layer (a server relaying edits
+// between editors, each holding its own Garland) speaks OPERATIONS:
+// a walk over the document made of retain n / insert text / delete n
+// steps, with BaseLength the document length it applies to and
+// TargetLength the length it leaves. Two concurrent operations on the
+// same base are reconciled with Transform, and a run of operations is
+// folded with Compose. This is the classic model (ot.js and its
+// ports), so a garland-backed editor can talk to existing servers.
+//
+// UNITS are RUNES, not bytes: peers exchange text, and a rune count
+// means the same thing on every peer whatever its encoding quirks.
+//
+// EXPORT: garland does not log edits - a revision is a tree root - so
+// the operation for a revision is DERIVED by comparing its tree with
+// its predecessor's. That is cheap because the trees share structure:
+// subtrees untouched by the edit are the same snapshot objects in
+// both, so one walk over the two trees skips them whole, descending
+// only along the edited spines, and reads just the leaves that differ.
+// Each run of differing leaves is trimmed of common bytes at either
+// end and becomes one insert/delete pair, so a revision made by one
+// mutation yields exactly its edit and a transaction touching several
+// places yields one pair per place, never the text between them.
+// OpsBetween spans any two revisions on the current fork the same way
+// (a peer catching up).
+//
+// IMPORT: ApplyOps plays an operation as ONE revision (inside its own
+// transaction, so it nests in an enclosing one), refusing one whose
+// BaseLength is not the document's rune count (ErrOperationMismatch).
+//
+// Operations are only derived for a fully loaded document, outside a
+// transaction (the live revision may still be rolled back).
+
+// OTOpKind identifies the kind of an operation step.
+type OTOpKind int
+
+const (
+	// OTRetain skips Count runes unchanged.
+	OTRetain OTOpKind = iota
+
+	// OTInsert inserts Text at the current position.
+	OTInsert
+
+	// OTDelete deletes Count runes at the current position.
+	OTDelete
+)
+
+// OTOp is one step of an operation. Count is in runes; for OTInsert it
+// is the rune length of Text.
+type OTOp struct {
+	Kind  OTOpKind
+	Count int64
+	Text  string
+}
+
+// OTOperation is a sequence of steps that together walk a document of
+// BaseLength runes and leave one of TargetLength runes. Build one with
+// Retain, Insert and Delete, which keep it normalized (no empty steps,
+// adjacent steps of a kind merged, an insert always before a delete at
+// the same position).
+type OTOperation struct {
+	Ops          []OTOp
+	BaseLength   int64
+	TargetLength int64
+}
+
+// Retain appends a step skipping n runes.
+func (op *OTOperation) Retain(n int64) *OTOperation {
+	if n <= 0 {
+		return op
+	}
+	op.BaseLength += n
+	op.TargetLength += n
+	if last := len(op.Ops) - 1; last >= 0 && op.Ops[last].Kind == OTRetain {
+		op.Ops[last].Count += n
+		return op
+	}
+	op.Ops = append(op.Ops, OTOp{Kind: OTRetain, Count: n})
+	return op
+}
+
+// Insert appends a step inserting text.
+func (op *OTOperation) Insert(text string) *OTOperation {
+	if text == "" {
+		return op
+	}
+	n := int64(utf8.RuneCountInString(text))
+	op.TargetLength += n
+	last := len(op.Ops) - 1
+	switch {
+	case last >= 0 && op.Ops[last].Kind == OTInsert:
+		op.Ops[last].Text += text
+		op.Ops[last].Count += n
+	case last >= 0 && op.Ops[last].Kind == OTDelete:
+		// Keep inserts ahead of a delete at the same spot.
+		if last > 0 && op.Ops[last-1].Kind == OTInsert {
+			op.Ops[last-1].Text += text
+			op.Ops[last-1].Count += n
+		} else {
+			del := op.Ops[last]
+			op.Ops[last] = OTOp{Kind: OTInsert, Count: n, Text: text}
+			op.Ops = append(op.Ops, del)
+		}
+	default:
+		op.Ops = append(op.Ops, OTOp{Kind: OTInsert, Count: n, Text: text})
+	}
+	return op
+}
+
+// Delete appends a step deleting n runes.
+func (op *OTOperation) Delete(n int64) *OTOperation {
+	if n <= 0 {
+		return op
+	}
+	op.BaseLength += n
+	if last := len(op.Ops) - 1; last >= 0 && op.Ops[last].Kind == OTDelete {
+		op.Ops[last].Count += n
+		return op
+	}
+	op.Ops = append(op.Ops, OTOp{Kind: OTDelete, Count: n})
+	return op
+}
+
+// IsNoop reports whether the operation changes nothing.
+func (op *OTOperation) IsNoop() bool {
+	return len(op.Ops) == 0 || (len(op.Ops) == 1 && op.Ops[0].Kind == OTRetain)
+}
+
+// ApplyToString applies the operation to s, for peers that hold plain
+// text rather than a Garland.
+func (op *OTOperation) ApplyToString(s string) (string, error) {
+	runes := []rune(s)
+	if int64(len(runes)) != op.BaseLength {
+		return "", ErrOperationMismatch
+	}
+	out := make([]rune, 0, op.TargetLength)
+	pos := int64(0)
+	for _, o := range op.Ops {
+		switch o.Kind {
+		case OTRetain:
+			out = append(out, runes[pos:pos+o.Count]...)
+			pos += o.Count
+		case OTInsert:
+			out = append(out, []rune(o.Text)...)
+		case OTDelete:
+			pos += o.Count
+		}
+	}
+	return string(out), nil
+}
+
+// ComposeOps returns the single operation equivalent to applying a and
+// then b. b.BaseLength must equal a.TargetLength.
+func ComposeOps(a, b OTOperation) (OTOperation, error) {
+	var out OTOperation
+	if a.TargetLength != b.BaseLength {
+		return out, ErrOperationMismatch
+	}
+	as, bs := newOTStream(a.Ops), newOTStream(b.Ops)
+	for !as.done() || !bs.done() {
+		if !as.done() && as.op.Kind == OTDelete {
+			out.Delete(as.take(as.op.Count).Count)
+			continue
+		}
+		if !bs.done() && bs.op.Kind == OTInsert {
+			out.Insert(bs.take(bs.op.Count).Text)
+			continue
+		}
+		if as.done() || bs.done() {
+			return OTOperation{}, ErrOperationMismatch
+		}
+		n := min(as.op.Count, bs.op.Count)
+		x, y := as.take(n), bs.take(n)
+		switch {
+		case x.Kind == OTRetain && y.Kind == OTRetain:
+			out.Retain(n)
+		case x.Kind == OTInsert && y.Kind == OTRetain:
+			out.Insert(x.Text)
+		case x.Kind == OTRetain && y.Kind == OTDelete:
+			out.Delete(n)
+		}
+		// insert then delete: the two cancel
+	}
+	return out, nil
+}
+
+// TransformOps takes two operations made concurrently against the same
+// base and returns a' and b' such that applying a then b' equals
+// applying b then a'. When both insert at the same position, a's text
+// goes first.
+func TransformOps(a, b OTOperation) (aPrime, bPrime OTOperation, err error) {
+	if a.BaseLength != b.BaseLength {
+		return aPrime, bPrime, ErrOperationMismatch
+	}
+	as, bs := newOTStream(a.Ops), newOTStream(b.Ops)
+	for !as.done() || !bs.done() {
+		if !as.done() && as.op.Kind == OTInsert {
+			x := as.take(as.op.Count)
+			aPrime.Insert(x.Text)
+			bPrime.Retain(x.Count)
+			continue
+		}
+		if !bs.done() && bs.op.Kind == OTInsert {
+			y := bs.take(bs.op.Count)
+			aPrime.Retain(y.Count)
+			bPrime.Insert(y.Text)
+			continue
+		}
+		if as.done() || bs.done() {
+			return OTOperation{}, OTOperation{}, ErrOperationMismatch
+		}
+		n := min(as.op.Count, bs.op.Count)
+		x, y := as.take(n), bs.take(n)
+		switch {
+		case x.Kind == OTRetain && y.Kind == OTRetain:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case x.Kind == OTDelete && y.Kind == OTRetain:
+			aPrime.Delete(n)
+		case x.Kind == OTRetain && y.Kind == OTDelete:
+			bPrime.Delete(n)
+		}
+		// both delete: already gone on both sides
+	}
+	return aPrime, bPrime, nil
+}
+
+// otStream walks a step list, splitting steps when a caller takes only
+// part of one.
+type otStream struct {
+	ops []OTOp
+	i   int
+	op  OTOp // remainder of ops[i-1]; valid unless done
+	end bool
+}
+
+func newOTStream(ops []OTOp) *otStream {
+	s := &otStream{ops: ops}
+	s.next()
+	return s
+}
+
+func (s *otStream) next() {
+	if s.i >= len(s.ops) {
+		s.end = true
+		return
+	}
+	s.op = s.ops[s.i]
+	s.i++
+}
+
+func (s *otStream) done() bool { return s.end }
+
+// take consumes n runes (at most the current step's Count) and returns
+// them as a step of the current kind.
+func (s *otStream) take(n int64) OTOp {
+	if n >= s.op.Count {
+		got := s.op
+		s.next()
+		return got
+	}
+	got := OTOp{Kind: s.op.Kind, Count: n}
+	s.op.Count -= n
+	if s.op.Kind == OTInsert {
+		split := runeByteOffset(s.op.Text, n)
+		got.Text, s.op.Text = s.op.Text[:split], s.op.Text[split:]
+	}
+	return got
+}
+
+// runeByteOffset returns the byte offset of rune n in s.
+func runeByteOffset(s string, n int64) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+// RevisionOps returns the operation that turns the previous revision
+// of the current fork into revision rev.
+func (g *Garland) RevisionOps(rev RevisionID) (OTOperation, error) {
+	if rev == 0 {
+		return OTOperation{}, ErrRevisionNotFound
+	}
+	return g.OpsBetween(rev-1, rev)
+}
+
+// OpsBetween returns the operation that turns revision from of the
+// current fork into revision to. Either may be the later one.
+func (g *Garland) OpsBetween(from, to RevisionID) (OTOperation, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.transaction != nil {
+		return OTOperation{}, ErrTransactionPending
+	}
+	if g.loader != nil && !g.loader.eofReached {
+		return OTOperation{}, ErrNotReady
+	}
+
+	a, err := g.revisionStateLocked(from)
+	if err != nil {
+		return OTOperation{}, err
+	}
+	b, err := g.revisionStateLocked(to)
+	if err != nil {
+		return OTOperation{}, err
+	}
+	return g.diffStatesLocked(a, b)
+}
+
+// treeState names one version of the tree: a root node and the
+// coordinates its snapshots resolve at.
+type treeState struct {
+	root *Node
+	fork ForkID
+	rev  RevisionID
+}
+
+// liveStateLocked returns the current version.
+func (g *Garland) liveStateLocked() treeState {
+	return treeState{root: g.root, fork: g.currentFork, rev: g.currentRevision}
+}
+
+// revisionStateLocked returns revision rev of the current fork.
+func (g *Garland) revisionStateLocked(rev RevisionID) (treeState, error) {
+	forkInfo, ok := g.forks[g.currentFork]
+	if !ok {
+		return treeState{}, ErrForkNotFound
+	}
+	if rev > forkInfo.HighestRevision || rev < forkInfo.PrunedUpTo {
+		return treeState{}, ErrRevisionNotFound
+	}
+	info := g.findRevisionInfo(g.currentFork, rev)
+	if info == nil || info.Revision != rev {
+		return treeState{}, ErrRevisionNotFound
+	}
+	root := g.nodeRegistry[info.RootID]
+	if root == nil {
+		return treeState{}, ErrRevisionNotFound
+	}
+	return treeState{root: root, fork: g.currentFork, rev: rev}, nil
+}
+
+// rootSnap resolves the state's root snapshot (nil if it is gone).
+func (s treeState) rootSnap() *NodeSnapshot {
+	if s.root == nil {
+		return nil
+	}
+	return s.root.snapshotAt(s.fork, s.rev)
+}
+
+// withStateLocked runs fn with st installed as the live coordinates (as
+// SnapshotView.within does), restoring the live ones after. Caller must
+// hold g.mu.
+func (g *Garland) withStateLocked(st treeState, fn func() error) error {
+	g.ensureCountsLocked() // the saved totals must be real ones
+	if st.rootSnap() == nil {
+		return ErrRevisionNotFound
+	}
+	liveRoot, liveFork, liveRev := g.root, g.currentFork, g.currentRevision
+	bytes, runes, lines := g.totalBytes, g.totalRunes, g.totalLines
+	defer func() {
+		g.root, g.currentFork, g.currentRevision = liveRoot, liveFork, liveRev
+		g.totalBytes, g.totalRunes, g.totalLines = bytes, runes, lines
+	}()
+	g.root, g.currentFork, g.currentRevision = st.root, st.fork, st.rev
+	g.updateCountsFromRoot()
+	return fn()
+}
+
+// diffEntry is a subtree on a diffWalker's stack: its node (leaf data
+// is thawed through it) and its snapshot in the walked version.
+type diffEntry struct {
+	node *Node
+	snap *NodeSnapshot
+}
+
+// diffWalker steps through a tree's subtrees in order (or in reverse),
+// expanding an internal node only when asked, so two versions can be
+// compared subtree by subtree.
+type diffWalker struct {
+	g       *Garland
+	st      treeState
+	stack   []diffEntry
+	reverse bool
+}
+
+// newDiffWalker returns a walker positioned on st's root.
+func newDiffWalker(g *Garland, st treeState, reverse bool) *diffWalker {
+	return &diffWalker{g: g, st: st, stack: []diffEntry{{st.root, st.rootSnap()}}, reverse: reverse}
+}
+
+func (w *diffWalker) top() *NodeSnapshot {
+	if len(w.stack) == 0 {
+		return nil
+	}
+	return w.stack[len(w.stack)-1].snap
+}
+
+func (w *diffWalker) pop() { w.stack = w.stack[:len(w.stack)-1] }
+
+// expand replaces the internal node on top with its children.
+func (w *diffWalker) expand() error {
+	snap := w.top()
+	w.pop()
+	left, right := w.g.nodeRegistry[snap.leftID], w.g.nodeRegistry[snap.rightID]
+	if left == nil || right == nil {
+		return ErrInternal
+	}
+	ls, rs := left.snapshotAt(w.st.fork, w.st.rev), right.snapshotAt(w.st.fork, w.st.rev)
+	if ls == nil || rs == nil {
+		return ErrInternal
+	}
+	if w.reverse {
+		w.stack = append(w.stack, diffEntry{left, ls}, diffEntry{right, rs})
+	} else {
+		w.stack = append(w.stack, diffEntry{right, rs}, diffEntry{left, ls})
+	}
+	return nil
+}
+
+// sharedRun walks a and b in step, skipping subtrees the two versions
+// share (the same snapshot object - the persistent tree shares every
+// subtree an edit did not touch), and returns the bytes and runes
+// skipped before the first difference, up to limit bytes. Only the
+// spine above the difference is expanded.
+func sharedRun(a, b *diffWalker, limit int64) (bytes, runes int64, err error) {
+	for {
+		sa, sb := a.top(), b.top()
+		if sa == nil || sb == nil {
+			return bytes, runes, nil
+		}
+		switch {
+		case sa.byteCount == 0:
+			a.pop()
+		case sb.byteCount == 0:
+			b.pop()
+		case sa == sb && bytes+sa.byteCount <= limit:
+			bytes += sa.byteCount
+			runes += sa.runeCount
+			a.pop()
+			b.pop()
+		case !sa.isLeaf && (sb.isLeaf || sa.byteCount >= sb.byteCount):
+			err = a.expand()
+		case !sb.isLeaf:
+			err = b.expand()
+		default:
+			return bytes, runes, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// diffSpan is one changed span between two versions: at byte start
+// (rune head) of the older, deleted was replaced by inserted.
+type diffSpan struct {
+	start    int64
+	head     int64
+	deleted  []byte
+	inserted []byte
+}
+
+// diffStatesLocked builds the operation from version a to version b.
+func (g *Garland) diffStatesLocked(a, b treeState) (OTOperation, error) {
+	spans, err := g.diffSpansLocked(a, b)
+	if err != nil {
+		return OTOperation{}, err
+	}
+	return spansOp(spans, a.rootSnap().runeCount), nil
+}
+
+// spansOp builds the operation for spans (in order) over a base of
+// baseRunes runes.
+func spansOp(spans []diffSpan, baseRunes int64) OTOperation {
+	var op OTOperation
+	pos := int64(0)
+	for _, s := range spans {
+		del := int64(utf8.RuneCount(s.deleted))
+		op.Retain(s.head - pos)
+		op.Insert(string(s.inserted))
+		op.Delete(del)
+		pos = s.head + del
+	}
+	op.Retain(baseRunes - pos)
+	return op
+}
+
+// diffSpansLocked finds the spans changed from version a to version b,
+// in document order. The two trees are walked in step: shared subtrees
+// are skipped whole, and where they differ only the differing leaves
+// are read (diffRegionLocked), each run trimmed of common bytes.
+func (g *Garland) diffSpansLocked(a, b treeState) ([]diffSpan, error) {
+	g.ensureCountsLocked()
+	if a.rootSnap() == nil || b.rootSnap() == nil {
+		return nil, ErrRevisionNotFound
+	}
+	wa, wb := newDiffWalker(g, a, false), newDiffWalker(g, b, false)
+
+	var spans []diffSpan
+	var at, head int64 // bytes and runes of a behind the walk
+	for {
+		n, r, err := sharedRun(wa, wb, math.MaxInt64)
+		if err != nil {
+			return nil, err
+		}
+		at, head = at+n, head+r
+		if wa.top() == nil && wb.top() == nil {
+			return spans, nil
+		}
+		old, now, err := g.diffRegionLocked(wa, wb)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := trimSpan(at, head, old, now); ok {
+			spans = append(spans, s)
+		}
+		at, head = at+int64(len(old)), head+int64(utf8.RuneCount(old))
+	}
+}
+
+// diffRun is the leaves one walker consumed in a differing region.
+type diffRun struct {
+	leaves []diffEntry
+	offs   []int // offset in data of each leaf
+	data   []byte
+	seen   map[*NodeSnapshot]int // leaf snapshot -> first index in leaves
+}
+
+// consume reads the leaf on top of w into the run.
+func (r *diffRun) consume(g *Garland, w *diffWalker) error {
+	e := w.stack[len(w.stack)-1]
+	w.pop()
+	if err := g.ensureLeafDataResident(e.node, e.snap); err != nil {
+		return err
+	}
+	if e.snap.storageState != StorageMemory || int64(len(e.snap.data)) != e.snap.byteCount {
+		return ErrDataNotLoaded
+	}
+	if _, ok := r.seen[e.snap]; !ok {
+		r.seen[e.snap] = len(r.leaves)
+	}
+	r.leaves = append(r.leaves, e)
+	r.offs = append(r.offs, len(r.data))
+	r.data = append(r.data, e.snap.data...)
+	return nil
+}
+
+// rewind gives w back the leaves consumed from snap on: the other
+// walker has reached snap, so the versions agree again from there.
+func (r *diffRun) rewind(w *diffWalker, snap *NodeSnapshot) {
+	k := r.seen[snap]
+	for i := len(r.leaves) - 1; i >= k; i-- {
+		w.stack = append(w.stack, r.leaves[i])
+		if r.seen[r.leaves[i].snap] >= k {
+			delete(r.seen, r.leaves[i].snap)
+		}
+	}
+	r.data, r.leaves, r.offs = r.data[:r.offs[k]], r.leaves[:k], r.offs[:k]
+}
+
+// diffRegionLocked reads a region where wa and wb differ, returning
+// the bytes of each version up to where the walks meet on a shared
+// subtree again (or the ends). Internal nodes are expanded, never read;
+// leaves are consumed from whichever side has read less, so a walk that
+// overtakes the meeting point does so by about the size of the change,
+// and is rewound to it once the other side arrives.
+func (g *Garland) diffRegionLocked(wa, wb *diffWalker) (old, now []byte, err error) {
+	ra := &diffRun{seen: make(map[*NodeSnapshot]int)}
+	rb := &diffRun{seen: make(map[*NodeSnapshot]int)}
+	for {
+		sa, sb := wa.top(), wb.top()
+		_, aheadB := rb.seen[sa]
+		_, aheadA := ra.seen[sb]
+		switch {
+		case sa != nil && sa.byteCount == 0:
+			wa.pop()
+		case sb != nil && sb.byteCount == 0:
+			wb.pop()
+		case sa == sb:
+			return ra.data, rb.data, nil
+		case sa != nil && aheadB:
+			rb.rewind(wb, sa)
+		case sb != nil && aheadA:
+			ra.rewind(wa, sb)
+		case sa != nil && !sa.isLeaf && (sb == nil || sb.isLeaf || sa.byteCount >= sb.byteCount):
+			err = wa.expand()
+		case sb != nil && !sb.isLeaf:
+			err = wb.expand()
+		case sb == nil || (sa != nil && len(ra.data) < len(rb.data)):
+			err = ra.consume(g, wa)
+		case sa == nil || len(rb.data) < len(ra.data):
+			err = rb.consume(g, wb)
+		default:
+			if err = ra.consume(g, wa); err == nil {
+				err = rb.consume(g, wb)
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// trimSpan makes the span replacing old with now at byte start (rune
+// head), trimmed of common bytes at rune boundaries; ok is false when
+// nothing is left.
+func trimSpan(start, head int64, old, now []byte) (diffSpan, bool) {
+	p := 0
+	for p < len(old) && p < len(now) && old[p] == now[p] {
+		p++
+	}
+	for p > 0 && !(runeStartAt(old, p) && runeStartAt(now, p)) {
+		p--
+	}
+	s := 0
+	for s < len(old)-p && s < len(now)-p && old[len(old)-1-s] == now[len(now)-1-s] {
+		s++
+	}
+	for s > 0 && !(runeStartAt(old, len(old)-s) && runeStartAt(now, len(now)-s)) {
+		s--
+	}
+	span := diffSpan{
+		start:    start + int64(p),
+		head:     head + int64(utf8.RuneCount(old[:p])),
+		deleted:  old[p : len(old)-s],
+		inserted: now[p : len(now)-s],
+	}
+	return span, len(span.deleted) > 0 || len(span.inserted) > 0
+}
+
+// runeStartAt reports whether offset i of d begins a rune (or is its end).
+func runeStartAt(d []byte, i int) bool {
+	return i >= len(d) || utf8.RuneStart(d[i])
+}
+
+// ApplyOps applies op to the document as one revision named name. The
+// operation's BaseLength must be the document's rune count.
+func (g *Garland) ApplyOps(op OTOperation, name string) (ChangeResult, error) {
+	g.ensureCounts()
+	g.mu.RLock()
+	runes := g.totalRunes
+	g.mu.RUnlock()
+	if op.BaseLength != runes {
+		return ChangeResult{}, ErrOperationMismatch
+	}
+
+	if err := g.TransactionStart(name); err != nil {
+		return ChangeResult{}, err
+	}
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+
+	pos := int64(0)
+	for _, o := range op.Ops {
+		var err error
+		switch o.Kind {
+		case OTRetain:
+			pos += o.Count
+		case OTInsert:
+			if err = c.SeekRune(pos); err == nil {
+				_, err = c.InsertString(o.Text, nil, true)
+			}
+			pos += o.Count
+		case OTDelete:
+			if err = c.SeekRune(pos); err == nil {
+				_, _, err = c.DeleteRunes(o.Count, false)
+			}
+		}
+		if err != nil {
+			g.TransactionRollback()
+			return ChangeResult{}, err
+		}
+	}
+	return g.TransactionCommit()
+}
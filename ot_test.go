@@ -0,0 +1,188 @@
+package garland
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func readAllString(t *testing.T, g *Garland) string {
+	t.Helper()
+	data, err := g.NewEphemeralCursor().ReadBytes(g.ByteCount().Value)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(data)
+}
+
+func TestRevisionOpsReplayOnPeer(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	base := strings.Repeat("héllo wörld\n", 20)
+	g, _ := lib.Open(FileOptions{DataString: base, MaxLeafSize: 16})
+	defer g.Close()
+	peer, _ := lib.Open(FileOptions{DataString: base})
+	defer peer.Close()
+
+	c := g.NewCursor()
+	c.SeekRune(13)
+	c.InsertString("→ ", nil, true)
+	c.SeekRune(100)
+	c.DeleteRunes(7, false)
+	c.SeekByte(0)
+	c.OverwriteBytes(1, []byte("H"))
+
+	for rev := RevisionID(1); rev <= g.CurrentRevision(); rev++ {
+		op, err := g.RevisionOps(rev)
+		if err != nil {
+			t.Fatalf("RevisionOps(%d): %v", rev, err)
+		}
+		if len(op.Ops) > 4 {
+			t.Errorf("rev %d: op not minimal: %+v", rev, op.Ops)
+		}
+		if _, err := peer.ApplyOps(op, "remote"); err != nil {
+			t.Fatalf("ApplyOps(rev %d): %v", rev, err)
+		}
+	}
+	if got, want := readAllString(t, peer), readAllString(t, g); got != want {
+		t.Errorf("peer diverged:\n got %q\nwant %q", got, want)
+	}
+
+	// One operation spanning all revisions does the same.
+	all, err := g.OpsBetween(0, g.CurrentRevision())
+	if err != nil {
+		t.Fatalf("OpsBetween: %v", err)
+	}
+	got, err := all.ApplyToString(base)
+	if err != nil || got != readAllString(t, g) {
+		t.Errorf("OpsBetween applied = %q, %v", got, err)
+	}
+	back, _ := g.OpsBetween(g.CurrentRevision(), 0)
+	if got, _ := back.ApplyToString(readAllString(t, g)); got != base {
+		t.Errorf("reverse op gave %q", got)
+	}
+}
+
+func TestTransformAndComposeOps(t *testing.T) {
+	doc := "the cat sat"
+	var a, b OTOperation
+	a.Retain(4).Delete(3).Insert("dog").Retain(4) // cat -> dog
+	b.Retain(8).Insert("has ").Retain(3)          // "has " before "sat"
+
+	ap, bp, err := TransformOps(a, b)
+	if err != nil {
+		t.Fatalf("TransformOps: %v", err)
+	}
+	ab, _ := a.ApplyToString(doc)
+	ab, _ = bp.ApplyToString(ab)
+	ba, _ := b.ApplyToString(doc)
+	ba, _ = ap.ApplyToString(ba)
+	if ab != ba || ab != "the dog has sat" {
+		t.Errorf("diverged: %q vs %q", ab, ba)
+	}
+
+	ab2, err := ComposeOps(a, bp)
+	if err != nil {
+		t.Fatalf("ComposeOps: %v", err)
+	}
+	if got, _ := ab2.ApplyToString(doc); got != ab {
+		t.Errorf("composed = %q, want %q", got, ab)
+	}
+
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "short"})
+	defer g.Close()
+	if _, err := g.ApplyOps(a, "bad"); err != ErrOperationMismatch {
+		t.Errorf("ApplyOps on wrong length: err = %v", err)
+	}
+}
+
+func TestOpsBetweenReadsOnlyChangedLeaves(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	base := strings.Repeat("a line of text\n", 2000)
+	g, err := lib.Open(FileOptions{DataString: base, MaxLeafSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	// One revision touching three places far apart.
+	g.TransactionStart("spread")
+	c := g.NewCursor()
+	c.SeekByte(20)
+	c.InsertString("¡start! ", nil, true)
+	c.SeekByte(15000)
+	c.DeleteBytes(5, false)
+	c.SeekByte(g.ByteCount().Value - 3)
+	c.InsertString("end", nil, true)
+	if _, err := g.TransactionCommit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatal(err)
+	}
+
+	thaws := g.tierStats.thaws
+	op, err := g.RevisionOps(g.CurrentRevision())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := g.tierStats.thaws - thaws; n > 20 {
+		t.Errorf("diff thawed %d leaves of %d bytes", n, len(base))
+	}
+	var inserts, deletes int
+	for _, o := range op.Ops {
+		switch o.Kind {
+		case OTInsert:
+			inserts++
+		case OTDelete:
+			deletes++
+		}
+	}
+	if inserts != 2 || deletes != 1 {
+		t.Errorf("ops = %+v, want one step per place", op.Ops)
+	}
+	if got, err := op.ApplyToString(base); err != nil || got != readAllString(t, g) {
+		t.Errorf("applied = %v", err)
+	}
+}
+
+func TestOpsBetweenRandomEdits(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	base := strings.Repeat("héllo wörld\n", 200)
+	g, _ := lib.Open(FileOptions{DataString: base, MaxLeafSize: 32})
+	defer g.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	texts := []string{base}
+	c := g.NewCursor()
+	for i := 0; i < 60; i++ {
+		if i%3 == 0 {
+			g.TransactionStart("several")
+		}
+		n := g.RuneCount().Value
+		c.SeekRune(rng.Int63n(n + 1))
+		if rng.Intn(2) == 0 {
+			c.InsertString(strings.Repeat("→x", rng.Intn(40)+1), nil, true)
+		} else {
+			c.DeleteRunes(rng.Int63n(min(n, 200))+1, false)
+		}
+		if i%3 == 2 {
+			if _, err := g.TransactionCommit(); err != nil {
+				t.Fatal(err)
+			}
+			texts = append(texts, readAllString(t, g))
+		}
+	}
+
+	for from := range texts {
+		for _, to := range []int{0, from / 2, len(texts) - 1} {
+			op, err := g.OpsBetween(RevisionID(from), RevisionID(to))
+			if err != nil {
+				t.Fatalf("OpsBetween(%d, %d): %v", from, to, err)
+			}
+			if got, err := op.ApplyToString(texts[from]); err != nil || got != texts[to] {
+				t.Fatalf("OpsBetween(%d, %d) applied wrong: %v", from, to, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package garland
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// parallel_build.go - building the initial tree on every core.
+//
+// DESIGN: opening an in-memory source (DataBytes, DataString, a file
+// read whole) builds a balanced tree over it, and nearly all of that
+// work is indexing the leaves - counting runes and newlines and
+// building line starts over every byte (hashes are computed lazily, at
+// chill time, so none are computed here). Done in one recursion it
+// used one core; a multi-gigabyte open waited on it. Now the build
+// runs in three passes:
+//
+//  1. Plan: the same midpoint recursion as before, aligned to rune
+//     boundaries, records the leaf spans in order. It reads one byte
+//     per split, nothing more.
+//  2. Index: the leaf snapshots are built in parallel, GOMAXPROCS
+//     workers taking spans off a shared counter. Each snapshot depends
+//     only on its own bytes.
+//  3. Assemble: the recursion runs again on one goroutine, taking the
+//     leaves in order and creating the nodes.
+//
+// RULING: the result is identical to the serial build's - same shape,
+// same node IDs in the same post-order, same registrations - whatever
+// the worker count or scheduling, because only pass 2 is parallel and
+// it writes nothing but its own slot. IDs, the node registry and the
+// structure-reuse map stay single-threaded; the garland is not yet
+// published, so no lock is involved.
+
+// plannedLeaf is a leaf the plan pass laid out: data[start:end].
+type plannedLeaf struct{ start, end int64 }
+
+// buildBalancedSubtree builds a balanced tree over data, whose first
+// byte is at fileOffset in the source. Returns the node ID and the
+// snapshot for the subtree root.
+func (g *Garland) buildBalancedSubtree(data []byte, fileOffset int64) (NodeID, *NodeSnapshot) {
+	var spans []plannedLeaf
+	g.planBalancedLeaves(data, 0, &spans)
+
+	leaves := make([]*NodeSnapshot, len(spans))
+	index := func(i int) {
+		s := spans[i]
+		leaves[i] = g.newLoadedLeafSnapshot(data[s.start:s.end], fileOffset+s.start)
+	}
+	workers := min(runtime.GOMAXPROCS(0), len(spans))
+	if workers <= 1 {
+		for i := range spans {
+			index(i)
+		}
+	} else {
+		var next atomic.Int64
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					i := int(next.Add(1)) - 1
+					if i >= len(spans) {
+						return
+					}
+					index(i)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	return g.assembleBalancedSubtree(data, &leaves)
+}
+
+// balancedSplit returns where a subtree over data splits, or -1 when
+// data is a single leaf.
+func (g *Garland) balancedSplit(data []byte) int64 {
+	if int64(len(data)) <= g.targetLeafSize {
+		return -1
+	}
+	// Align to rune boundary to avoid splitting UTF-8 characters
+	return int64(alignToRuneBoundary(data, int64(len(data))/2))
+}
+
+// planBalancedLeaves appends the leaf spans of the subtree over data,
+// which starts at offset, in order.
+func (g *Garland) planBalancedLeaves(data []byte, offset int64, spans *[]plannedLeaf) {
+	mid := g.balancedSplit(data)
+	if mid < 0 {
+		*spans = append(*spans, plannedLeaf{offset, offset + int64(len(data))})
+		return
+	}
+	g.planBalancedLeaves(data[:mid], offset, spans)
+	g.planBalancedLeaves(data[mid:], offset+mid, spans)
+}
+
+// assembleBalancedSubtree creates the nodes of the subtree over data,
+// taking its leaf snapshots, in order, off the front of *leaves.
+func (g *Garland) assembleBalancedSubtree(data []byte, leaves *[]*NodeSnapshot) (NodeID, *NodeSnapshot) {
+	mid := g.balancedSplit(data)
+	if mid < 0 {
+		snap := (*leaves)[0]
+		*leaves = (*leaves)[1:]
+		g.nextNodeID++
+		node := newNode(g.nextNodeID, g)
+		g.nodeRegistry[node.id] = node
+		node.setSnapshot(0, 0, snap)
+		return node.id, snap
+	}
+
+	leftID, leftSnap := g.assembleBalancedSubtree(data[:mid], leaves)
+	rightID, rightSnap := g.assembleBalancedSubtree(data[mid:], leaves)
+
+	// Create internal node
+	g.nextNodeID++
+	node := newNode(g.nextNodeID, g)
+	g.nodeRegistry[node.id] = node
+
+	snap := createInternalSnapshot(leftID, rightID, leftSnap, rightSnap)
+	node.setSnapshot(0, 0, snap)
+
+	// Register for structure reuse
+	g.internalNodesByChildren[[2]NodeID{leftID, rightID}] = node.id
+
+	return node.id, snap
+}
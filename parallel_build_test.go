@@ -0,0 +1,45 @@
+package garland
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParallelBuildDeterministic(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	doc := []byte(strings.Repeat("héllo wörld ✓ 𝄞\nplain ascii line\n", 10000))
+
+	open := func(procs int, counting CountingMode) *Garland {
+		t.Helper()
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+		g, err := lib.Open(FileOptions{DataBytes: doc, MaxLeafSize: 1024, Counting: counting})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+
+	for _, counting := range []CountingMode{CountEager, CountDeferred} {
+		serial := open(1, counting)
+		parallel := open(8, counting)
+		if !reflect.DeepEqual(serial.GetTreeInfo(), parallel.GetTreeInfo()) {
+			t.Fatalf("counting %v: parallel build differs from the serial one", counting)
+		}
+		if !reflect.DeepEqual(serial.internalNodesByChildren, parallel.internalNodesByChildren) {
+			t.Fatalf("counting %v: structure-reuse registrations differ", counting)
+		}
+		if v := parallel.CheckInvariants(); v != nil {
+			t.Fatalf("counting %v: %v", counting, v)
+		}
+		if got := readAll(t, parallel); got != string(doc) {
+			t.Fatalf("counting %v: content differs", counting)
+		}
+		if lines := parallel.LineCount().Value; lines != 20000 {
+			t.Fatalf("counting %v: %d lines", counting, lines)
+		}
+		serial.Close()
+		parallel.Close()
+	}
+}
@@ -0,0 +1,87 @@
+package garland
+
+import "bytes"
+
+// read_lines.go - reading a run of lines in one call.
+//
+// DESIGN: a viewport redraw wants the 40-odd lines on screen. Through
+// ReadLine that is one lock round trip and one tree descent per line,
+// plus a second walk to find each line's end. ReadLineRange instead
+// resolves just two line starts - the first line and the one after the
+// last - reads the bytes between them once, and splits on newlines.
+//
+//   - Lines come back as ReadLine returns them: with their newline, the
+//     last line of the document without one.
+//   - The range is inclusive and clamps at the last line, so asking for
+//     a screenful near the end returns what there is; a first line past
+//     the end is ErrInvalidPosition.
+//   - Cold leaves in the range are thawed.
+
+// ReadLineRange returns lines first through last (inclusive), each with
+// its newline, reading the range in one pass. last is clamped to the
+// final line; last < first returns no lines.
+func (g *Garland) ReadLineRange(first, last int64) ([]string, error) {
+	if first < 0 {
+		return nil, ErrInvalidPosition
+	}
+	g.touchAccess()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.readLineRangeLocked(first, last)
+}
+
+// readLineRangeLocked is ReadLineRange under the write lock.
+func (g *Garland) readLineRangeLocked(first, last int64) ([]string, error) {
+	g.ensureCountsLocked()
+	if first > g.totalLines {
+		return nil, ErrInvalidPosition
+	}
+	last = min(last, g.totalLines)
+	if last < first {
+		return nil, nil
+	}
+	res, err := g.findLeafByLineUnlocked(first, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, end := res.LineByteStart, g.totalBytes
+	if last < g.totalLines {
+		if res, err = g.findLeafByLineUnlocked(last+1, 0); err != nil {
+			return nil, err
+		}
+		end = res.LineByteStart
+	}
+	data, err := g.readThawingLocked(start, end-start)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, last-first+1)
+	for int64(len(lines)) <= last-first {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
+	}
+	return lines, nil
+}
+
+// ReadLines returns n lines starting with the cursor's line, each with
+// its newline (fewer at the end of the document). Like ReadLine it does
+// not move the cursor.
+func (c *Cursor) ReadLines(n int64) ([]string, error) {
+	if c.detached() {
+		return nil, ErrCursorNotFound
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	g := c.garland
+	g.touchAccess()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	return g.readLineRangeLocked(c.line, c.line+n-1)
+}
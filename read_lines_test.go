@@ -0,0 +1,59 @@
+package garland
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadLineRange(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "zero\none\n\nthree\nfour"})
+	defer g.Close()
+
+	cases := []struct {
+		first, last int64
+		want        []string
+	}{
+		{0, 0, []string{"zero\n"}},
+		{1, 3, []string{"one\n", "\n", "three\n"}},
+		{3, 99, []string{"three\n", "four"}},
+		{4, 4, []string{"four"}},
+		{2, 1, nil},
+	}
+	for _, tc := range cases {
+		got, err := g.ReadLineRange(tc.first, tc.last)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ReadLineRange(%d, %d) = %q, %v; want %q", tc.first, tc.last, got, err, tc.want)
+		}
+	}
+	if _, err := g.ReadLineRange(5, 6); err != ErrInvalidPosition {
+		t.Errorf("past the end: err = %v", err)
+	}
+
+	// Each line matches ReadLine.
+	c := g.NewCursor()
+	for line := int64(0); line <= 4; line++ {
+		c.SeekLine(line, 0)
+		one, _ := c.ReadLine()
+		got, _ := g.ReadLineRange(line, line)
+		if len(got) != 1 || got[0] != one {
+			t.Errorf("line %d: %q vs ReadLine %q", line, got, one)
+		}
+	}
+}
+
+func TestCursorReadLines(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "a\nb\nc\n"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekLine(1, 1)
+	got, err := c.ReadLines(5)
+	if want := []string{"b\n", "c\n", ""}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadLines = %q, %v; want %q", got, err, want)
+	}
+	if line, col := c.LinePos(); line != 1 || col != 1 {
+		t.Errorf("cursor moved to %d:%d", line, col)
+	}
+}
@@ -0,0 +1,411 @@
+package garland
+
+import (
+	"math/bits"
+	"time"
+)
+
+// rebalance.go - configurable, amortized rebalancing.
+//
+// DESIGN: edits path-copy into the tree without restructuring it, so a
+// long editing session (typing at one spot, repeated appends) lets the
+// tree drift deep on one side and every lookup pays for it. Rebalancing
+// is a full REBUILD of the current revision's tree shape: the leaves
+// are collected in order and paired bottom-up into fresh internal
+// nodes, which yields the optimal depth ceil(log2(leaves)) + 1.
+//
+//   - Only SHAPE changes. Leaf nodes are REUSED (same IDs, same
+//     snapshots - no data is read, so cold and warm leaves stay where
+//     they are, and decoration-cache hints stay valid); only internal
+//     nodes are new. Installing the result re-points the current
+//     revision's RootID, exactly as a coalescing amend does - a
+//     revision's identity is its root, and the content is unchanged.
+//   - The build is AMORTIZED: ForceRebalanceWithin advances it for at
+//     most a time budget and keeps the partial state; the next call
+//     resumes. Any change to the tree in between (an edit, undo, fork
+//     switch) abandons the partial build - its internal nodes are
+//     dropped from the registry - and the next call starts over.
+//   - RebalancePolicy chooses WHEN rebuilds happen on their own: never
+//     (the default - only ForceRebalance and friends), from the
+//     background maintenance tick, or after mutations; in both
+//     automatic modes only once the depth passes a threshold, and the
+//     depth check itself is amortized over CheckEvery tree operations.
+//   - RebalanceStats samples depth and imbalance at every check, so an
+//     embedder can watch drift over time and tune the policy.
+//
+// Never during a transaction (rollback restores a recorded root) or
+// while a streaming load is still building revision 0.
+
+// RebalanceMode selects when rebalancing runs automatically.
+type RebalanceMode int
+
+const (
+	// RebalanceManual: never automatically; the application calls
+	// ForceRebalance / ForceRebalanceWithin. The default.
+	RebalanceManual RebalanceMode = iota
+
+	// RebalanceBackground: the background maintenance tick (requires
+	// BackgroundInterval) rebuilds trees past the depth threshold,
+	// spending at most TickBudget per garland per tick.
+	RebalanceBackground
+
+	// RebalanceOnMutation: mutations check the depth (every CheckEvery
+	// tree operations) and rebuild inline when past the threshold.
+	RebalanceOnMutation
+)
+
+// String returns a human-readable name for the mode.
+func (m RebalanceMode) String() string {
+	switch m {
+	case RebalanceManual:
+		return "manual"
+	case RebalanceBackground:
+		return "background"
+	case RebalanceOnMutation:
+		return "on-mutation"
+	default:
+		return "unknown"
+	}
+}
+
+// RebalancePolicy configures automatic rebalancing
+// (LibraryOptions.Rebalance).
+type RebalancePolicy struct {
+	// Mode selects when rebalancing runs on its own.
+	Mode RebalanceMode
+
+	// DepthThreshold triggers a rebuild once the tree is deeper than
+	// this many levels. 0 means relative to the optimum: a rebuild
+	// triggers when depth exceeds twice the optimal depth plus two.
+	DepthThreshold int
+
+	// CheckEvery amortizes the depth check (a full tree walk): it runs
+	// at most once per this many tree operations. Default 64.
+	CheckEvery int
+
+	// TickBudget bounds the rebuild work per background tick per
+	// garland (RebalanceBackground). Default 5ms.
+	TickBudget time.Duration
+}
+
+// RebalanceSample is one depth measurement.
+type RebalanceSample struct {
+	Time      time.Time
+	Depth     int     // tree depth (levels, root = 1)
+	Leaves    int     // leaf count
+	Imbalance float64 // Depth / optimal depth (1.0 = perfectly balanced)
+}
+
+// RebalanceStats reports a garland's tree shape and rebalancing
+// history.
+type RebalanceStats struct {
+	Policy       RebalancePolicy
+	Depth        int     // current depth
+	OptimalDepth int     // ceil(log2(leaves)) + 1
+	Leaves       int     // current leaf count
+	Imbalance    float64 // Depth / OptimalDepth
+	Rebuilds     int64   // completed rebuilds since Open
+	Abandoned    int64   // partial rebuilds abandoned because the tree changed
+	InProgress   bool    // a partial rebuild is waiting to resume
+	LastRebuild  time.Time
+	Samples      []RebalanceSample // recent depth checks, oldest first
+}
+
+// maxRebalanceSamples bounds the RebalanceStats sample history.
+const maxRebalanceSamples = 64
+
+// rebalanceState is the per-garland rebalancing bookkeeping.
+type rebalanceState struct {
+	build       *rebuildState
+	lastCheck   int64 // nodeManipulations at the last depth check
+	rebuilds    int64
+	abandoned   int64
+	lastRebuild time.Time
+	samples     []RebalanceSample
+}
+
+// rebuildState is a partial bottom-up rebuild.
+type rebuildState struct {
+	fork  ForkID
+	rev   RevisionID
+	manip int64 // nodeManipulations when the build started
+
+	level   []NodeID // level being paired
+	next    []NodeID // next level under construction
+	i       int      // pairing position in level
+	created []NodeID // internal nodes allocated so far
+}
+
+// normalizedPolicy fills in the policy defaults.
+func normalizedPolicy(p RebalancePolicy) RebalancePolicy {
+	if p.CheckEvery <= 0 {
+		p.CheckEvery = 64
+	}
+	if p.TickBudget <= 0 {
+		p.TickBudget = 5 * time.Millisecond
+	}
+	return p
+}
+
+// optimalDepth is the depth of a perfectly balanced tree over n leaves.
+func optimalDepth(leaves int) int {
+	if leaves <= 1 {
+		return 1
+	}
+	return bits.Len(uint(leaves-1)) + 1
+}
+
+// treeShapeLocked measures the current tree: depth and leaf count.
+// Caller must hold at least the read lock.
+func (g *Garland) treeShapeLocked() (depth, leaves int) {
+	if g.root == nil {
+		return 0, 0
+	}
+	var walk func(id NodeID, d int)
+	walk = func(id NodeID, d int) {
+		node := g.nodeRegistry[id]
+		if node == nil {
+			return
+		}
+		snap := node.snapshotAt(g.currentFork, g.currentRevision)
+		if snap == nil {
+			return
+		}
+		if d > depth {
+			depth = d
+		}
+		if snap.isLeaf {
+			leaves++
+			return
+		}
+		walk(snap.leftID, d+1)
+		walk(snap.rightID, d+1)
+	}
+	walk(g.root.id, 1)
+	return depth, leaves
+}
+
+// sampleShapeLocked measures the tree and records a sample.
+// Caller must hold the write lock.
+func (g *Garland) sampleShapeLocked() RebalanceSample {
+	depth, leaves := g.treeShapeLocked()
+	s := RebalanceSample{Time: time.Now(), Depth: depth, Leaves: leaves}
+	if opt := optimalDepth(leaves); opt > 0 {
+		s.Imbalance = float64(depth) / float64(opt)
+	}
+	rs := &g.rebalance
+	rs.samples = append(rs.samples, s)
+	if len(rs.samples) > maxRebalanceSamples {
+		rs.samples = rs.samples[len(rs.samples)-maxRebalanceSamples:]
+	}
+	rs.lastCheck = g.nodeManipulations
+	return s
+}
+
+// overThreshold reports whether a sample calls for a rebuild.
+func overThreshold(p RebalancePolicy, s RebalanceSample) bool {
+	limit := p.DepthThreshold
+	if limit <= 0 {
+		limit = 2*optimalDepth(s.Leaves) + 2
+	}
+	return s.Depth > limit
+}
+
+// rebalanceBlockedLocked reports whether the tree must not be rebuilt
+// right now. Caller must hold at least the read lock.
+func (g *Garland) rebalanceBlockedLocked() bool {
+	return g.transaction != nil || g.root == nil ||
+		(g.loader != nil && !g.loader.eofReached)
+}
+
+// rebuildLocked advances (or starts) the rebuild until it completes or
+// the deadline passes (zero deadline = run to completion). Returns true
+// when a new tree was installed. Caller must hold the write lock.
+func (g *Garland) rebuildLocked(deadline time.Time) bool {
+	rs := &g.rebalance
+	b := rs.build
+	if b != nil && (b.fork != g.currentFork || b.rev != g.currentRevision || b.manip != g.nodeManipulations) {
+		g.abandonRebuildLocked()
+		b = nil
+	}
+	if b == nil {
+		leaves := g.collectLeafNodeIDsLocked()
+		if len(leaves) <= 1 {
+			return false
+		}
+		b = &rebuildState{fork: g.currentFork, rev: g.currentRevision,
+			manip: g.nodeManipulations, level: leaves}
+		rs.build = b
+	}
+
+	const stride = 256 // pairs between deadline checks
+	for steps := 0; ; steps++ {
+		if steps%stride == stride-1 && !deadline.IsZero() && time.Now().After(deadline) {
+			return false
+		}
+		if b.i >= len(b.level) {
+			if len(b.next) == 1 {
+				break
+			}
+			b.level, b.next, b.i = b.next, nil, 0
+			continue
+		}
+		if b.i+1 == len(b.level) {
+			// Odd node out carries up a level unchanged
+			b.next = append(b.next, b.level[b.i])
+			b.i++
+			continue
+		}
+		leftID, rightID := b.level[b.i], b.level[b.i+1]
+		leftSnap := g.nodeRegistry[leftID].snapshotAt(g.currentFork, g.currentRevision)
+		rightSnap := g.nodeRegistry[rightID].snapshotAt(g.currentFork, g.currentRevision)
+		g.nextNodeID++
+		node := newNode(g.nextNodeID, g)
+		node.setSnapshot(g.currentFork, g.currentRevision, createInternalSnapshot(leftID, rightID, leftSnap, rightSnap))
+		g.nodeRegistry[node.id] = node
+		b.created = append(b.created, node.id)
+		b.next = append(b.next, node.id)
+		b.i += 2
+	}
+
+	// Install: the current revision now resolves through the new root.
+	g.root = g.nodeRegistry[b.next[0]]
+	if ri := g.revisionInfo[ForkRevision{g.currentFork, g.currentRevision}]; ri != nil {
+		ri.RootID = g.root.id
+	}
+	rs.build = nil
+	rs.rebuilds++
+	rs.lastRebuild = time.Now()
+	g.nodeManipulations = 0
+	rs.lastCheck = 0
+	return true
+}
+
+// abandonRebuildLocked drops a partial rebuild and the internal nodes
+// it allocated (nothing references them). Caller must hold the write
+// lock.
+func (g *Garland) abandonRebuildLocked() {
+	b := g.rebalance.build
+	if b == nil {
+		return
+	}
+	for _, id := range b.created {
+		delete(g.nodeRegistry, id)
+	}
+	g.rebalance.build = nil
+	g.rebalance.abandoned++
+}
+
+// collectLeafNodeIDsLocked lists the current tree's leaf nodes in
+// order. Caller must hold at least the read lock.
+func (g *Garland) collectLeafNodeIDsLocked() []NodeID {
+	var out []NodeID
+	var walk func(id NodeID)
+	walk = func(id NodeID) {
+		node := g.nodeRegistry[id]
+		if node == nil {
+			return
+		}
+		snap := node.snapshotAt(g.currentFork, g.currentRevision)
+		if snap == nil {
+			return
+		}
+		if snap.isLeaf {
+			out = append(out, id)
+			return
+		}
+		walk(snap.leftID)
+		walk(snap.rightID)
+	}
+	walk(g.root.id)
+	return out
+}
+
+// ForceRebalanceWithin rebuilds the tree into optimal shape, spending
+// at most budget on it. Returns true when the rebuild completed (a
+// balanced tree is installed); false means it ran out of time and will
+// resume on the next call - unless the tree changes first, in which
+// case the partial work is discarded. Returns false immediately during
+// a transaction or an unfinished streaming load.
+func (g *Garland) ForceRebalanceWithin(budget time.Duration) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.rebalanceBlockedLocked() {
+		return false
+	}
+	return g.rebuildLocked(time.Now().Add(budget))
+}
+
+// RebalanceStats reports the tree's current shape and the rebalancing
+// history.
+func (g *Garland) RebalanceStats() RebalanceStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	depth, leaves := g.treeShapeLocked()
+	rs := &g.rebalance
+	st := RebalanceStats{
+		Depth:        depth,
+		Leaves:       leaves,
+		OptimalDepth: optimalDepth(leaves),
+		Rebuilds:     rs.rebuilds,
+		Abandoned:    rs.abandoned,
+		InProgress:   rs.build != nil,
+		LastRebuild:  rs.lastRebuild,
+		Samples:      append([]RebalanceSample(nil), rs.samples...),
+	}
+	if g.lib != nil {
+		st.Policy = g.lib.rebalancePolicy
+	}
+	if st.OptimalDepth > 0 {
+		st.Imbalance = float64(depth) / float64(st.OptimalDepth)
+	}
+	return st
+}
+
+// maybeRebalanceLocked is the automatic hook: when the amortized check
+// is due, sample the depth and rebuild if past the threshold (bounded by
+// deadline; zero = to completion). A rebuild already in progress simply
+// resumes. Caller must hold the write lock.
+func (g *Garland) maybeRebalanceLocked(p RebalancePolicy, deadline time.Time) {
+	if g.rebalanceBlockedLocked() {
+		return
+	}
+	if g.rebalance.build == nil {
+		if g.nodeManipulations-g.rebalance.lastCheck < int64(p.CheckEvery) {
+			return
+		}
+		if !overThreshold(p, g.sampleShapeLocked()) {
+			return
+		}
+	}
+	g.rebuildLocked(deadline)
+}
+
+// rebalanceAfterMutationLocked is the RebalanceOnMutation hook, called
+// as a mutation completes. Caller must hold the write lock.
+func (g *Garland) rebalanceAfterMutationLocked() {
+	if g.lib == nil || g.lib.rebalancePolicy.Mode != RebalanceOnMutation {
+		return
+	}
+	g.maybeRebalanceLocked(g.lib.rebalancePolicy, time.Time{})
+}
+
+// rebalanceTick is the RebalanceBackground hook, run by the maintenance
+// worker for each garland.
+func (lib *Library) rebalanceTick() {
+	p := lib.rebalancePolicy
+	lib.mu.RLock()
+	garlands := make([]*Garland, 0, len(lib.activeGarlands))
+	for _, g := range lib.activeGarlands {
+		garlands = append(garlands, g)
+	}
+	lib.mu.RUnlock()
+
+	for _, g := range garlands {
+		g.mu.Lock()
+		if !g.closed {
+			g.maybeRebalanceLocked(p, time.Now().Add(p.TickBudget))
+		}
+		g.mu.Unlock()
+	}
+}
@@ -0,0 +1,126 @@
+package garland
+
+import (
+	"testing"
+	"time"
+)
+
+// skewTree appends many small inserts at the end, which path-copies
+// without restructuring and drives the tree deep on one side. Callers
+// open with a tiny MaxLeafSize so every insert lands in its own leaf.
+func skewTree(t *testing.T, g *Garland, n int) string {
+	t.Helper()
+	c := g.NewCursor()
+	want := "x"
+	for i := 0; i < n; i++ {
+		c.SeekByte(g.ByteCount().Value)
+		if _, err := c.InsertString("ab", nil, true); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		want += "ab"
+	}
+	return want
+}
+
+func readAll(t *testing.T, g *Garland) string {
+	t.Helper()
+	c := g.NewCursor()
+	data, err := c.ReadBytes(g.ByteCount().Value)
+	if err != nil {
+		t.Fatalf("ReadBytes: %v", err)
+	}
+	return string(data)
+}
+
+func TestForceRebalanceWithinResumes(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "x", MaxLeafSize: 4})
+	defer g.Close()
+
+	want := skewTree(t, g, 300)
+	before := g.RebalanceStats()
+	if before.Depth <= before.OptimalDepth {
+		t.Skipf("tree did not skew (depth %d, optimal %d)", before.Depth, before.OptimalDepth)
+	}
+
+	// A zero budget still makes progress each call and finishes.
+	done := false
+	for i := 0; i < 1000 && !done; i++ {
+		done = g.ForceRebalanceWithin(0)
+	}
+	if !done {
+		t.Fatal("rebuild never completed")
+	}
+
+	after := g.RebalanceStats()
+	if after.Depth != after.OptimalDepth || after.Leaves != before.Leaves {
+		t.Errorf("after rebuild: depth %d (optimal %d), leaves %d (was %d)",
+			after.Depth, after.OptimalDepth, after.Leaves, before.Leaves)
+	}
+	if after.Rebuilds != 1 || after.InProgress {
+		t.Errorf("stats = %+v", after)
+	}
+	if got := readAll(t, g); got != want {
+		t.Errorf("content changed by rebuild")
+	}
+
+	// Undo/redo still resolve the same content.
+	rev := g.CurrentRevision()
+	g.UndoSeek(rev - 1)
+	g.UndoSeek(rev)
+	if got := readAll(t, g); got != want {
+		t.Errorf("content after undo/redo differs")
+	}
+}
+
+func TestForceRebalanceWithinAbandonsOnEdit(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "x", MaxLeafSize: 4})
+	defer g.Close()
+	want := skewTree(t, g, 600)
+
+	if g.ForceRebalanceWithin(0) {
+		t.Skip("rebuild finished in one step; nothing to abandon")
+	}
+	if !g.RebalanceStats().InProgress {
+		t.Fatal("partial rebuild should be in progress")
+	}
+
+	c := g.NewCursor()
+	c.InsertString("!", nil, true)
+	for !g.ForceRebalanceWithin(time.Second) {
+	}
+	st := g.RebalanceStats()
+	if st.Abandoned != 1 || st.Rebuilds != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+	if got := readAll(t, g); got != "!"+want {
+		t.Errorf("content wrong after abandoned rebuild")
+	}
+}
+
+func TestRebalanceOnMutationPolicy(t *testing.T) {
+	lib, _ := Init(LibraryOptions{Rebalance: RebalancePolicy{
+		Mode:           RebalanceOnMutation,
+		DepthThreshold: 8,
+		CheckEvery:     4,
+	}})
+	g, _ := lib.Open(FileOptions{DataString: "x", MaxLeafSize: 4})
+	defer g.Close()
+
+	want := skewTree(t, g, 300)
+	st := g.RebalanceStats()
+	if st.Rebuilds == 0 {
+		t.Errorf("expected automatic rebuilds, stats = %+v", st)
+	}
+	// Checks run every 4 mutations, so depth can overshoot by that much.
+	if st.Depth > 8+4 {
+		t.Errorf("depth %d stayed past threshold", st.Depth)
+	}
+	if len(st.Samples) == 0 || st.Policy.Mode != RebalanceOnMutation {
+		t.Errorf("samples=%d policy=%v", len(st.Samples), st.Policy.Mode)
+	}
+	if got := readAll(t, g); got != want {
+		t.Errorf("content changed by automatic rebuilds")
+	}
+}
@@ -368,6 +368,9 @@ func (g *Garland) rebaseLocked(fs FileSystemInterface, path string) (RebaseRepor
 	for _, cursor := range g.cursors {
 		cursor.bytePos = rebaseMapPos(cursor.bytePos, mapping, size)
 	}
+	g.forEachEphemeralMarkLocked(func(m *ephemeralMark) {
+		m.pos = rebaseMapPos(m.pos, mapping, size)
+	})
 	g.reconcileCursorCoordinates()
 	g.recordMutation()
 
@@ -420,6 +423,7 @@ func (g *Garland) rebaseSourceBookkeeping(fs FileSystemInterface, path string,
 		g.sourcePath = path
 		g.sourceFS = fs
 		g.sourceHandle = handle
+		g.retargetAdvisoryLockLocked(fs, path)
 	} else if g.sourceHandle == nil && ownHandle {
 		g.sourceHandle = handle
 		if g.sourceFS == nil {
@@ -433,6 +437,9 @@ func (g *Garland) rebaseSourceBookkeeping(fs FileSystemInterface, path string,
 	_ = g.captureSourceInfo()
 	// A fresh starting point is a hard edge for undo coalescing too.
 	g.coalesce.active = false
+	// ...and the buffer now agrees with the (possibly new) source, so
+	// the recovery journal restarts from it.
+	g.journalSavedLocked(g.liveStateLocked())
 	// Warm trust restarts clean: every warm block in the new view was
 	// just verified (anchored by hash) against this very file.
 	g.warmVerification = make(map[NodeID]*warmVerificationState)
@@ -4,11 +4,18 @@ package garland
 
 // Checkpoint commits all active optimized regions across all cursors.
 // This creates a single revision containing all pending region changes.
-// Call this to establish an undo point after a burst of edits.
+// It also bakes any undo-coalescing run, so coalesced typing is durable
+// history and the next edit starts a new revision. Call this to
+// establish an undo point at a natural boundary (focus loss, idle).
 func (g *Garland) Checkpoint() error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	return g.checkpointUnlocked()
+	if err := g.checkpointUnlocked(); err != nil {
+		return err
+	}
+	g.coalesce.active = false
+	g.logOpLocked(ReplayRecord{Op: replayBake})
+	return nil
 }
 
 // checkpointUnlocked commits all regions without acquiring the lock.
@@ -87,6 +94,7 @@ func (g *Garland) dissolveRegionUnlocked(cursor *Cursor) error {
 			relDecs[i] = RelativeDecoration{
 				Key:      d.Key,
 				Position: d.Position,
+				Gravity:  d.Gravity,
 			}
 		}
 
@@ -130,6 +138,7 @@ func (g *Garland) deleteFromTreeNoRevision(pos, length int64) ([]Decoration, err
 
 	// Update root
 	g.root = g.nodeRegistry[newRootID]
+	g.journalSpliceLocked(pos, length)
 
 	// Update cursors (shift positions after deletion)
 	for _, c := range g.cursors {
@@ -179,6 +188,7 @@ func (g *Garland) insertIntoTreeNoRevision(pos int64, data []byte, decorations [
 
 	// Update root
 	g.root = g.nodeRegistry[newRootID]
+	g.journalSpliceLocked(pos, 0, data)
 
 	// Update cursors (shift positions after insertion)
 	insertLen := int64(len(data))
@@ -245,6 +255,7 @@ func (g *Garland) createRegionForCursorUnlocked(cursor *Cursor, startByte, endBy
 			decorations = append(decorations, Decoration{
 				Key:      d.Key,
 				Position: d.Position - startByte,
+				Gravity:  d.Gravity,
 			})
 		}
 	}
@@ -0,0 +1,400 @@
+package garland
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+)
+
+// replay.go - deterministic operation recording and replay.
+//
+// DESIGN: tree corruption bugs tend to need a particular history - a
+// particular leaf layout, fork, undo and coalescing sequence - that
+// the reporter cannot describe and the maintainer cannot guess.
+// FileOptions.RecordTo logs every mutation the garland performs, with
+// its arguments and the revision it produced, as JSON lines; Replay
+// feeds such a log to a fresh garland and checks, record by record,
+// that it lands on the same revisions. With ReplayOptions the replay
+// can stop at any record or at the first one after which
+// CheckInvariants fails - bisecting a corruption down to the op that
+// caused it.
+//
+//   - Recording starts at Open, from the content as loaded (stored in
+//     the log, so a replay needs nothing else) and the leaf size, so
+//     the replayed tree has the same shape. Streamed (DataChannel)
+//     sources cannot be recorded.
+//   - Operations are logged at the byte-level primitives every public
+//     edit funnels into (insert, delete, overwrite, move, copy,
+//     decorate), with absolute positions: cursors, searches, rune and
+//     line addressing are resolved before the log sees them, so the
+//     replay needs none of that state. History operations (transaction
+//     start/commit/rollback, undo and fork seeks, prune, fork deletion)
+//     and coalescing controls are logged as called, errors included.
+//   - A mutation made by anything else (rebase, region checkpoints,
+//     save-time scarring) is logged OPAQUE: the complete resulting
+//     content, which the replay installs as one overwrite. The replay
+//     stays faithful; only the op's internals are not reproduced.
+//   - Coalescing decisions depend on time. Each coalescible op logs
+//     the instant it ran and the replay runs the coalescing clock on
+//     those instants, so time-based baking decides exactly as it did.
+//   - Close (or StopRecording) ends the log with the content's length
+//     and CRC-32, which the replay verifies.
+//   - A write failure stops recording (RecordingError reports it); it
+//     never fails the edit being logged.
+
+// Replay record ops.
+const (
+	replayOpen       = "open"
+	replayInsert     = "insert"
+	replayDelete     = "delete"
+	replayOverwrite  = "overwrite"
+	replayMove       = "move"
+	replayCopy       = "copy"
+	replayDecorate   = "decorate"
+	replayOpaque     = "opaque"
+	replayTxStart    = "tx-start"
+	replayTxCommit   = "tx-commit"
+	replayTxRollback = "tx-rollback"
+	replayUndoSeek   = "undo-seek"
+	replayForkSeek   = "fork-seek"
+	replayPrune      = "prune"
+	replayDeleteFork = "delete-fork"
+	replayBake       = "bake"
+	replayCoalescing = "coalescing"
+	replayEnd        = "end"
+)
+
+// ReplayRecord is one line of a replay log.
+type ReplayRecord struct {
+	Seq int64  `json:"seq"`
+	Op  string `json:"op"`
+
+	Pos         int64                `json:"pos,omitempty"`
+	Length      int64                `json:"length,omitempty"`
+	SrcStart    int64                `json:"srcStart,omitempty"`
+	SrcEnd      int64                `json:"srcEnd,omitempty"`
+	DstStart    int64                `json:"dstStart,omitempty"`
+	DstEnd      int64                `json:"dstEnd,omitempty"`
+	Data        []byte               `json:"data,omitempty"`
+	Decorations []RelativeDecoration `json:"decorations,omitempty"`
+	Entries     []DecorationEntry    `json:"entries,omitempty"`
+	Before      bool                 `json:"before,omitempty"`
+	IncludeLine bool                 `json:"includeLine,omitempty"`
+	Enabled     bool                 `json:"enabled,omitempty"`
+	Name        string               `json:"name,omitempty"`
+	Fork        ForkID               `json:"fork,omitempty"`
+	Revision    RevisionID           `json:"revision,omitempty"`
+	Duration    time.Duration        `json:"duration,omitempty"`
+	Checksum    uint32               `json:"checksum,omitempty"`
+
+	// At is when a coalescible op ran (unix nanoseconds; 0 otherwise).
+	At int64 `json:"at,omitempty"`
+
+	// Result is the fork and revision the op produced (or, for history
+	// operations, where the garland stood afterwards); Err its error.
+	Result ChangeResult `json:"result"`
+	Err    string       `json:"err,omitempty"`
+}
+
+// opRecorder writes one garland's replay log.
+type opRecorder struct {
+	mu   sync.Mutex
+	w    *bufio.Writer
+	enc  *json.Encoder
+	seq  int64
+	err  error
+	note *ReplayRecord // arguments of the primitive in progress (g.mu)
+}
+
+// startRecordingLocked begins the log with the content as loaded.
+// Caller owns the unpublished garland.
+func (g *Garland) startRecordingLocked(w io.Writer) {
+	bw := bufio.NewWriter(w)
+	g.recorder = &opRecorder{w: bw, enc: json.NewEncoder(bw)}
+	data, err := g.readBytesRangeInternal(0, g.totalBytes)
+	if err != nil {
+		g.recorder.err = err
+		return
+	}
+	g.recorder.write(ReplayRecord{Op: replayOpen, Data: data, Length: g.maxLeafSize,
+		Result: ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}})
+}
+
+// write appends a record (numbering it) and flushes.
+func (r *opRecorder) write(rec ReplayRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.seq++
+	rec.Seq = r.seq
+	if err := r.enc.Encode(rec); err != nil {
+		r.err = err
+		return
+	}
+	r.err = r.w.Flush()
+}
+
+// noteOpLocked stashes a primitive's arguments for recordMutation,
+// which logs them with the revision produced. Defer the returned func:
+// it drops the note if the op fails before recording. Caller must hold
+// the write lock.
+func (g *Garland) noteOpLocked(rec ReplayRecord) func() {
+	if g.recorder == nil {
+		return func() {}
+	}
+	g.recorder.note = &rec
+	return func() { g.recorder.note = nil }
+}
+
+// recordOpLocked is recordMutation's hook: log the noted primitive, or
+// an opaque record of the whole content. Caller must hold the write
+// lock.
+func (g *Garland) recordOpLocked(pc coalescePending, result ChangeResult) {
+	r := g.recorder
+	var rec ReplayRecord
+	if r.note != nil {
+		rec, r.note = *r.note, nil
+		if pc.valid {
+			rec.At = pc.at.UnixNano()
+		}
+	} else {
+		data, err := g.readBytesRangeInternal(0, g.totalBytes)
+		if err != nil {
+			r.mu.Lock()
+			r.err = err
+			r.mu.Unlock()
+			return
+		}
+		rec = ReplayRecord{Op: replayOpaque, Data: data}
+	}
+	rec.Result = result
+	r.write(rec)
+}
+
+// logOp logs a history or control operation after it ran. The caller
+// must NOT hold g.mu.
+func (g *Garland) logOp(rec ReplayRecord, err error) {
+	if g.recorder == nil {
+		return
+	}
+	g.mu.RLock()
+	if rec.Result == (ChangeResult{}) {
+		rec.Result = ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}
+	}
+	g.mu.RUnlock()
+	if err != nil {
+		rec.Err = err.Error()
+	}
+	g.recorder.write(rec)
+}
+
+// logOpLocked is logOp for callers holding the write lock.
+func (g *Garland) logOpLocked(rec ReplayRecord) {
+	if g.recorder == nil {
+		return
+	}
+	rec.Result = ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}
+	g.recorder.write(rec)
+}
+
+// stopRecordingLocked ends the log with the content's length and CRC.
+func (g *Garland) stopRecordingLocked() error {
+	r := g.recorder
+	if r == nil {
+		return nil
+	}
+	g.recorder = nil
+	if data, err := g.readBytesRangeInternal(0, g.totalBytes); err == nil {
+		r.write(ReplayRecord{Op: replayEnd, Length: int64(len(data)), Checksum: crc32.ChecksumIEEE(data),
+			Result: ChangeResult{Fork: g.currentFork, Revision: g.currentRevision}})
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// StopRecording ends the replay log (FileOptions.RecordTo) and returns
+// the first write error, if any. Close does this implicitly.
+func (g *Garland) StopRecording() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stopRecordingLocked()
+}
+
+// RecordingError reports why recording stopped, or nil while it works
+// (or is not enabled).
+func (g *Garland) RecordingError() error {
+	g.mu.RLock()
+	r := g.recorder
+	g.mu.RUnlock()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReplayOptions controls Replay.
+type ReplayOptions struct {
+	// Until stops after the record with this sequence number (0: run
+	// the whole log).
+	Until int64
+
+	// CheckInvariants runs CheckInvariants after every record and stops
+	// at the first one after which it reports violations.
+	CheckInvariants bool
+}
+
+// ReplayReport describes how far a replay got.
+type ReplayReport struct {
+	// Applied counts the records replayed (the open record included).
+	Applied int64
+
+	// Last is the last record replayed - the diverging one when replay
+	// stopped with ErrReplayDiverged.
+	Last ReplayRecord
+
+	// Divergence says why the replay stopped early; empty otherwise.
+	Divergence string
+
+	// Violations are CheckInvariants' findings after Last.
+	Violations []InvariantViolation
+}
+
+// Replay rebuilds a recorded session (FileOptions.RecordTo) on a fresh
+// garland. It stops with ErrReplayDiverged at the first record whose
+// outcome differs from the log (or, with opts.CheckInvariants, after
+// which the tree is inconsistent), returning the garland as it stands
+// there for inspection. A malformed log fails with ErrReplayLog.
+func (lib *Library) Replay(r io.Reader, opts ReplayOptions) (*Garland, ReplayReport, error) {
+	var report ReplayReport
+	dec := json.NewDecoder(r)
+
+	var open ReplayRecord
+	if err := dec.Decode(&open); err != nil || open.Op != replayOpen {
+		return nil, report, ErrReplayLog
+	}
+	data := open.Data
+	if data == nil {
+		data = []byte{}
+	}
+	g, err := lib.Open(FileOptions{DataBytes: data, MaxLeafSize: open.Length})
+	if err != nil {
+		return nil, report, err
+	}
+	report.Applied, report.Last = 1, open
+
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+	for {
+		if opts.Until > 0 && report.Last.Seq >= opts.Until {
+			return g, report, nil
+		}
+		var rec ReplayRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return g, report, nil
+		} else if err != nil {
+			return g, report, ErrReplayLog
+		}
+		report.Applied++
+		report.Last = rec
+
+		if why := g.replayRecord(c, rec); why != "" {
+			report.Divergence = why
+			return g, report, ErrReplayDiverged
+		}
+		if opts.CheckInvariants {
+			if v := g.CheckInvariants(); v != nil {
+				report.Violations = v
+				report.Divergence = "invariants violated"
+				return g, report, ErrReplayDiverged
+			}
+		}
+	}
+}
+
+// replayRecord applies one record and returns why its outcome differs
+// from the log ("" when it matches).
+func (g *Garland) replayRecord(c *Cursor, rec ReplayRecord) string {
+	if rec.At != 0 {
+		at := time.Unix(0, rec.At)
+		g.mu.Lock()
+		g.coalesce.now = func() time.Time { return at }
+		g.mu.Unlock()
+	}
+
+	var res ChangeResult
+	var err error
+	switch rec.Op {
+	case replayInsert:
+		res, err = g.insertBytesAt(c, rec.Pos, rec.Data, rec.Decorations, rec.Before)
+	case replayDelete:
+		_, res, err = g.deleteBytesAt(c, rec.Pos, rec.Length, rec.IncludeLine)
+	case replayOverwrite:
+		_, res, err = g.overwriteBytesAtInternal(c, rec.Pos, rec.Length, rec.Data, rec.Decorations, rec.Before)
+	case replayMove:
+		var mr MoveResult
+		mr, err = g.moveBytesAt(c, rec.SrcStart, rec.SrcEnd, rec.DstStart, rec.DstEnd, rec.Before)
+		res = mr.ChangeResult
+	case replayCopy:
+		var cr CopyResult
+		cr, err = g.copyBytesAt(c, rec.SrcStart, rec.SrcEnd, rec.DstStart, rec.DstEnd, rec.Decorations, rec.Before)
+		res = cr.ChangeResult
+	case replayDecorate:
+		res, err = g.Decorate(rec.Entries)
+	case replayOpaque:
+		// The original op was a hard coalescing edge.
+		g.Bake()
+		_, res, err = g.overwriteBytesAtInternal(c, 0, g.ByteCount().Value, rec.Data, nil, false)
+	case replayTxStart:
+		err = g.TransactionStart(rec.Name)
+	case replayTxCommit:
+		res, err = g.TransactionCommit()
+	case replayTxRollback:
+		err = g.TransactionRollback()
+	case replayUndoSeek:
+		err = g.UndoSeek(rec.Revision)
+	case replayForkSeek:
+		err = g.ForkSeek(rec.Fork)
+	case replayPrune:
+		err = g.Prune(rec.Revision)
+	case replayDeleteFork:
+		err = g.DeleteFork(rec.Fork)
+	case replayBake:
+		g.Bake()
+	case replayCoalescing:
+		g.SetUndoCoalescing(rec.Enabled, rec.Duration)
+	case replayEnd:
+		g.mu.Lock()
+		data, rerr := g.readBytesRangeInternal(0, g.totalBytes)
+		g.mu.Unlock()
+		if rerr != nil {
+			return rerr.Error()
+		}
+		if int64(len(data)) != rec.Length || crc32.ChecksumIEEE(data) != rec.Checksum {
+			return fmt.Sprintf("final content differs (%d bytes, want %d)", len(data), rec.Length)
+		}
+		res = g.CurrentVersion()
+	default:
+		return fmt.Sprintf("unknown op %q", rec.Op)
+	}
+
+	if (err != nil) != (rec.Err != "") {
+		return fmt.Sprintf("%s: error %v, log says %q", rec.Op, err, rec.Err)
+	}
+	if res == (ChangeResult{}) || err != nil {
+		res = g.CurrentVersion()
+	}
+	if res != rec.Result {
+		return fmt.Sprintf("%s: produced fork %d rev %d, log says fork %d rev %d",
+			rec.Op, res.Fork, res.Revision, rec.Result.Fork, rec.Result.Revision)
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package garland
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordSession plays a mixed editing session into a replay log.
+func recordSession(t *testing.T, lib *Library) (*Garland, *bytes.Buffer) {
+	var log bytes.Buffer
+	g, err := lib.Open(FileOptions{DataString: "alpha beta gamma\ndelta\n", MaxLeafSize: 16, RecordTo: &log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := g.NewCursor()
+
+	// A coalesced typing run, a backspace and a hard edge.
+	g.SetUndoCoalescing(true, time.Hour)
+	c.SeekByte(6)
+	for _, r := range "new " {
+		c.InsertString(string(r), nil, true)
+	}
+	c.SeekByte(c.BytePos() - 1)
+	c.DeleteBytes(1, false)
+	g.Bake()
+
+	g.TransactionStart("batch")
+	c.SeekByte(0)
+	c.OverwriteBytes(5, []byte("ALPHA"))
+	g.Decorate([]DecorationEntry{{Key: "mark", Address: &AbsoluteAddress{Mode: ByteMode, Byte: 3}}})
+	g.TransactionCommit()
+
+	c.MoveBytes(0, 5, 10, 10, false)
+	c.CopyBytes(0, 3, g.ByteCount().Value, g.ByteCount().Value, nil, false)
+
+	// Undo, then edit: a fork. A failing op is logged with its error.
+	g.UndoSeek(g.CurrentRevision() - 2)
+	c.SeekByte(0)
+	c.InsertString("forked: ", nil, true)
+	if err := g.UndoSeek(999); err == nil {
+		t.Fatal("UndoSeek(999) succeeded")
+	}
+	g.ForkSeek(0)
+	return g, &log
+}
+
+func TestReplayReproducesSession(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, log := recordSession(t, lib)
+	g.ForkSeek(1)
+	wantFork := readAllString(t, g)
+	g.ForkSeek(0)
+	want, wantVersion := readAllString(t, g), g.CurrentVersion()
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), `"op":"end"`) {
+		t.Fatal("Close did not end the log")
+	}
+
+	r, report, err := lib.Replay(bytes.NewReader(log.Bytes()), ReplayOptions{CheckInvariants: true})
+	if err != nil {
+		t.Fatalf("Replay: %v (%s) at %+v", err, report.Divergence, report.Last)
+	}
+	defer r.Close()
+	if got := readAllString(t, r); got != want {
+		t.Errorf("replayed %q, want %q", got, want)
+	}
+	if r.CurrentVersion() != wantVersion {
+		t.Errorf("replay ends at %+v, want %+v", r.CurrentVersion(), wantVersion)
+	}
+	if lines := int64(strings.Count(log.String(), "\n")); report.Applied != lines {
+		t.Errorf("applied %d of %d records", report.Applied, lines)
+	}
+
+	// The fork the session undid into is there too.
+	if err := r.ForkSeek(1); err != nil {
+		t.Fatalf("ForkSeek(1): %v", err)
+	}
+	if got := readAllString(t, r); got != wantFork {
+		t.Errorf("fork 1 holds %q, want %q", got, wantFork)
+	}
+}
+
+func TestReplayUntilAndDivergence(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, log := recordSession(t, lib)
+	g.Close()
+	lines := strings.SplitAfter(strings.TrimSuffix(log.String(), "\n"), "\n")
+
+	// Until stops after the first insert: the first typed rune.
+	r, report, err := lib.Replay(strings.NewReader(log.String()), ReplayOptions{Until: 3})
+	if err != nil || report.Last.Seq != 3 || report.Last.Op != replayInsert {
+		t.Fatalf("Until: err %v, last %+v", err, report.Last)
+	}
+	if got := readAllString(t, r); got != "alpha nbeta gamma\ndelta\n" {
+		t.Errorf("replay until 3 gave %q", got)
+	}
+	r.Close()
+
+	// Tamper with a record's outcome: the replay flags that record.
+	var rec ReplayRecord
+	json.Unmarshal([]byte(lines[9]), &rec)
+	rec.Result.Revision += 5
+	tampered, _ := json.Marshal(rec)
+	lines[9] = string(tampered) + "\n"
+	_, report, err = lib.Replay(strings.NewReader(strings.Join(lines, "")), ReplayOptions{})
+	if err != ErrReplayDiverged || report.Last.Seq != rec.Seq || report.Divergence == "" {
+		t.Errorf("tampered log: err %v, stopped at %d (%q), want seq %d", err, report.Last.Seq, report.Divergence, rec.Seq)
+	}
+
+	if _, _, err := lib.Replay(strings.NewReader("not json"), ReplayOptions{}); err != ErrReplayLog {
+		t.Errorf("garbage log: err = %v, want ErrReplayLog", err)
+	}
+}
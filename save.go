@@ -151,13 +151,32 @@ func (g *Garland) SaveWith(opts SaveOptions) (SaveReport, error) {
 		fs = g.lib.defaultFS
 	}
 
-	if opts.Concurrent {
-		return g.saveConcurrent(fs, opts)
+	// Never rewrite a source another process holds the advisory lock on.
+	g.mu.Lock()
+	err := g.checkAdvisoryLockLocked()
+	path := g.sourcePath
+	g.mu.Unlock()
+	if err != nil {
+		return SaveReport{}, err
 	}
 
-	g.mu.Lock()
-	defer g.mu.Unlock()
-	return g.saveInPlace(fs, opts)
+	ev := SaveEvent{Path: path, InPlace: true}
+	if err := g.runPreSaveHooks(ev); err != nil {
+		return SaveReport{}, err
+	}
+
+	var report SaveReport
+	if opts.Concurrent {
+		report, err = g.saveConcurrent(fs, opts)
+	} else {
+		g.mu.Lock()
+		report, err = g.saveInPlace(fs, opts)
+		g.mu.Unlock()
+	}
+	if err == nil {
+		g.runPostSaveHooks(ev, report)
+	}
+	return report, err
 }
 
 func (g *Garland) saveInPlace(fs FileSystemInterface, opts SaveOptions) (SaveReport, error) {
@@ -394,6 +413,7 @@ func (g *Garland) saveInPlace(fs FileSystemInterface, opts SaveOptions) (SaveRep
 	// file it protects has now been overwritten, so it is needed.
 	g.recordSavePointLocked(fs, g.sourcePath, true)
 	g.emacsLockSavedLocked()
+	g.journalSavedLocked(g.liveStateLocked())
 	g.commitBackupLocked()
 
 	report.Integrity = g.drainIntegrityEvents()
@@ -572,6 +592,7 @@ func (g *Garland) scarifyPlaceholders() ([]ScarWarning, error) {
 		ns := createLeafSnapshot(block, j.snap.decorations, -1)
 		ns.storageState = StorageMemory
 		*j.snap = *ns
+		g.journalSpliceLocked(j.off, int64(len(block)), block)
 	}
 
 	// Recompute internal aggregate weights along the whole current
@@ -588,6 +609,7 @@ func (g *Garland) scarifyPlaceholders() ([]ScarWarning, error) {
 		if err != nil {
 			return nil, err
 		}
+		g.journalSpliceLocked(g.totalBytes, 0, appendices)
 		g.root = g.nodeRegistry[newRootID]
 		g.updateCountsFromRoot()
 	}
@@ -634,6 +656,7 @@ func (g *Garland) fixCurrentAggregates() {
 		return snap
 	}
 	fix(g.root.id)
+	g.invalidateLeafHints()
 	g.updateCountsFromRoot()
 }
 
@@ -364,6 +364,11 @@ func (g *Garland) saveConcurrent(fs FileSystemInterface, opts SaveOptions) (Save
 	if g.currentFork == planFork && g.currentRevision == planRev {
 		g.emacsLockSavedLocked()
 	}
+	// The journal restarts from what was written; edits made during
+	// the rewrite are journaled on top of it.
+	if st, ok := g.stateAtLocked(planFork, planRev); ok {
+		g.journalSavedLocked(st)
+	}
 	// The rewrite overwrote the file the backup protects - commit it.
 	g.commitBackupLocked()
 	report.Integrity = g.drainIntegrityEvents()
@@ -0,0 +1,147 @@
+package garland
+
+import "fmt"
+
+// save_hooks.go - pre/post save hooks.
+//
+// DESIGN: editors routinely touch the buffer on its way to disk - strip
+// trailing whitespace, ensure a final newline, stamp a modification
+// time - or refuse to save at all (a linter that must pass, a file
+// that must stay read-only). AddSaveHook registers such steps with the
+// garland so every save path runs them, not only the app's own Save
+// button.
+//
+//   - Pre hooks run first, in registration order, inside ONE
+//     transaction ("save hooks") with an ephemeral cursor. Their edits
+//     are what gets written, and they stay in the buffer as a single
+//     undoable revision - buffer and file agree after the save. A hook
+//     that edits nothing costs nothing: a transaction with no
+//     mutations is rolled back rather than committed, so saving never
+//     bumps the revision by itself.
+//   - Any pre hook returning an error VETOES the save: the transaction
+//     rolls back (every hook's edits are discarded), nothing is
+//     written, and Save returns that error (ErrSaveVetoed is provided
+//     for hooks without a more specific one). A panicking hook vetoes
+//     the same way.
+//   - Post hooks run after a successful write, in registration order,
+//     with the report. They cannot veto; edits they make are ordinary
+//     mutations (the buffer is dirty again).
+//   - Hooks run under the save lock (saves are serialized) but NOT the
+//     buffer lock - they edit through the normal API. They must not
+//     save from inside a hook.
+//   - Pre hooks run after the checks that refuse a save outright (no
+//     source, the advisory lock), so a refused save never applies
+//     them.
+
+// SaveEvent describes the save a hook is part of.
+type SaveEvent struct {
+	// Path is the file being written.
+	Path string
+
+	// InPlace is true when the save overwrites the buffer's source
+	// (Save, or SaveAs onto the source path).
+	InPlace bool
+
+	// Adopt is true for a SaveAs that makes Path the new source.
+	Adopt bool
+}
+
+// SaveHook is a pair of save-pipeline callbacks; either may be nil.
+type SaveHook struct {
+	// Pre edits the content about to be saved through c, inside the
+	// save's hook transaction. A non-nil error vetoes the save.
+	Pre func(g *Garland, c *Cursor, ev SaveEvent) error
+
+	// Post is told about a save that succeeded.
+	Post func(g *Garland, ev SaveEvent, report SaveReport)
+}
+
+// namedSaveHook is a registered hook.
+type namedSaveHook struct {
+	name string
+	hook SaveHook
+}
+
+// AddSaveHook registers hook under name, replacing (in place) a hook
+// already registered under that name.
+func (g *Garland) AddSaveHook(name string, hook SaveHook) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.saveHooks {
+		if g.saveHooks[i].name == name {
+			g.saveHooks[i].hook = hook
+			return
+		}
+	}
+	g.saveHooks = append(g.saveHooks, namedSaveHook{name: name, hook: hook})
+}
+
+// RemoveSaveHook unregisters the hook named name, reporting whether
+// there was one.
+func (g *Garland) RemoveSaveHook(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.saveHooks {
+		if g.saveHooks[i].name == name {
+			g.saveHooks = append(g.saveHooks[:i:i], g.saveHooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// saveHooksSnapshot returns the registered hooks (a copy, so hooks may
+// register or remove hooks while they run).
+func (g *Garland) saveHooksSnapshot() []namedSaveHook {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]namedSaveHook(nil), g.saveHooks...)
+}
+
+// runPreSaveHooks runs the pre hooks in the hook transaction. Caller
+// holds saveMu but not g.mu.
+func (g *Garland) runPreSaveHooks(ev SaveEvent) (err error) {
+	hooks := g.saveHooksSnapshot()
+	pre := false
+	for _, h := range hooks {
+		pre = pre || h.hook.Pre != nil
+	}
+	if !pre {
+		return nil
+	}
+
+	if err := g.TransactionStart("save hooks"); err != nil {
+		return err
+	}
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+	defer func() {
+		if p := recover(); p != nil {
+			g.TransactionRollback()
+			err = fmt.Errorf("garland: save hook panicked: %v", p)
+		}
+	}()
+	for _, h := range hooks {
+		if h.hook.Pre == nil {
+			continue
+		}
+		if err := h.hook.Pre(g, c, ev); err != nil {
+			g.TransactionRollback()
+			return err
+		}
+	}
+	if g.transaction.depth == 1 && !g.transaction.hasMutations {
+		return g.TransactionRollback()
+	}
+	_, err = g.TransactionCommit()
+	return err
+}
+
+// runPostSaveHooks tells the post hooks about a successful save.
+func (g *Garland) runPostSaveHooks(ev SaveEvent, report SaveReport) {
+	for _, h := range g.saveHooksSnapshot() {
+		if h.hook.Post != nil {
+			h.hook.Post(g, ev, report)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package garland
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func bufferText(g *Garland) string {
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+	data, _ := c.ReadBytes(g.ByteCount().Value)
+	return string(data)
+}
+
+// stripTrailingSpace is a typical pre-save hook.
+func stripTrailingSpace(g *Garland, c *Cursor, ev SaveEvent) error {
+	lines := strings.SplitAfter(bufferText(g), "\n")
+	pos := int64(0)
+	for _, line := range lines {
+		body := strings.TrimSuffix(line, "\n")
+		trimmed := strings.TrimRight(body, " \t")
+		if n := int64(len(body) - len(trimmed)); n > 0 {
+			c.SeekByte(pos + int64(len(trimmed)))
+			if _, _, err := c.DeleteBytes(n, false); err != nil {
+				return err
+			}
+		}
+		pos += int64(len(trimmed)) + int64(len(line)-len(body))
+	}
+	return nil
+}
+
+func TestSaveHooksEditAndReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	os.WriteFile(path, []byte("one  \ntwo\t\nthree"), 0644)
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{FilePath: path})
+	defer g.Close()
+
+	var posted []SaveEvent
+	g.AddSaveHook("strip", SaveHook{Pre: stripTrailingSpace})
+	g.AddSaveHook("final-newline", SaveHook{
+		Pre: func(g *Garland, c *Cursor, ev SaveEvent) error {
+			if !strings.HasSuffix(bufferText(g), "\n") {
+				c.SeekByte(g.ByteCount().Value)
+				_, err := c.InsertString("\n", nil, true)
+				return err
+			}
+			return nil
+		},
+		Post: func(g *Garland, ev SaveEvent, report SaveReport) { posted = append(posted, ev) },
+	})
+
+	rev := g.CurrentRevision()
+	if _, err := g.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "one\ntwo\nthree\n" {
+		t.Errorf("saved %q", data)
+	}
+	if readAllString(t, g) != string(data) {
+		t.Error("buffer and file disagree after the hooks' edits")
+	}
+	if g.CurrentRevision() != rev+1 {
+		t.Errorf("hook edits should be one revision: %d -> %d", rev, g.CurrentRevision())
+	}
+	if len(posted) != 1 || !posted[0].InPlace || posted[0].Path != path {
+		t.Errorf("post hook saw %+v", posted)
+	}
+
+	// Nothing left for the hooks to do: saving again adds no revision.
+	rev = g.CurrentRevision()
+	g.Save()
+	if g.CurrentRevision() != rev {
+		t.Errorf("a no-op hook pass created revision %d", g.CurrentRevision())
+	}
+}
+
+func TestSaveHookVeto(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	os.WriteFile(path, []byte("original  \n"), 0644)
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{FilePath: path})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.InsertString("edited ", nil, true)
+	before := readAllString(t, g)
+
+	g.AddSaveHook("strip", SaveHook{Pre: stripTrailingSpace})
+	g.AddSaveHook("lint", SaveHook{
+		Pre: func(g *Garland, c *Cursor, ev SaveEvent) error { return ErrSaveVetoed },
+		Post: func(g *Garland, ev SaveEvent, report SaveReport) {
+			t.Error("post hook ran for a vetoed save")
+		},
+	})
+	if _, err := g.Save(); err != ErrSaveVetoed {
+		t.Fatalf("Save: err = %v, want ErrSaveVetoed", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "original  \n" {
+		t.Errorf("vetoed save wrote %q", data)
+	}
+	if got := readAllString(t, g); got != before {
+		t.Errorf("vetoed hooks' edits kept: %q", got)
+	}
+
+	if !g.RemoveSaveHook("lint") {
+		t.Fatal("RemoveSaveHook: not found")
+	}
+	dest := filepath.Join(t.TempDir(), "copy.txt")
+	if _, err := g.SaveAs(nil, dest); err != nil {
+		t.Fatalf("SaveAs: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "edited original\n" {
+		t.Errorf("SaveAs wrote %q", data)
+	}
+}
@@ -109,15 +109,14 @@ type RegexOptions struct {
 // Returns the first match found, or nil if no match.
 // The cursor is NOT moved by this operation.
 func (c *Cursor) FindString(needle string, opts SearchOptions) (*SearchResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ErrCursorNotFound
 	}
 	if len(needle) == 0 {
 		return nil, nil
 	}
 
-	c.garland.mu.Lock()
-	defer c.garland.mu.Unlock()
+	defer c.garland.lockForScan()()
 
 	return c.garland.findStringInternal(c.bytePos, needle, opts)
 }
@@ -125,15 +124,14 @@ func (c *Cursor) FindString(needle string, opts SearchOptions) (*SearchResult, e
 // FindStringAll finds all occurrences of a string in the document.
 // Returns all matches in document order (or reverse order if Backward).
 func (c *Cursor) FindStringAll(needle string, opts SearchOptions) ([]SearchResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ErrCursorNotFound
 	}
 	if len(needle) == 0 {
 		return nil, nil
 	}
 
-	c.garland.mu.Lock()
-	defer c.garland.mu.Unlock()
+	defer c.garland.lockForScan()()
 
 	return c.garland.findStringAllInternal(needle, opts)
 }
@@ -142,7 +140,7 @@ func (c *Cursor) FindStringAll(needle string, opts SearchOptions) ([]SearchResul
 // Search starts from cursor position.
 // Returns the change result and whether a replacement was made.
 func (c *Cursor) ReplaceString(needle, replacement string, opts SearchOptions) (bool, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return false, ChangeResult{}, ErrCursorNotFound
 	}
 	if len(needle) == 0 {
@@ -173,7 +171,7 @@ func (c *Cursor) ReplaceString(needle, replacement string, opts SearchOptions) (
 // ReplaceStringAll replaces all occurrences of needle with replacement.
 // Returns the number of replacements made.
 func (c *Cursor) ReplaceStringAll(needle, replacement string, opts SearchOptions) (int, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return 0, ChangeResult{}, ErrCursorNotFound
 	}
 	if len(needle) == 0 {
@@ -187,7 +185,7 @@ func (c *Cursor) ReplaceStringAll(needle, replacement string, opts SearchOptions
 // If count is -1, replaces all occurrences.
 // Returns the number of replacements made.
 func (c *Cursor) ReplaceStringCount(needle, replacement string, count int, opts SearchOptions) (int, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return 0, ChangeResult{}, ErrCursorNotFound
 	}
 	if len(needle) == 0 || count == 0 {
@@ -248,7 +246,7 @@ func (c *Cursor) replaceStringCount(needle, replacement string, count int, opts
 // Returns the first match found, or nil if no match.
 // The cursor is NOT moved by this operation.
 func (c *Cursor) FindRegex(pattern string, opts RegexOptions) (*SearchResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ErrCursorNotFound
 	}
 	if len(pattern) == 0 {
@@ -261,15 +259,14 @@ func (c *Cursor) FindRegex(pattern string, opts RegexOptions) (*SearchResult, er
 		return nil, err
 	}
 
-	c.garland.mu.Lock()
-	defer c.garland.mu.Unlock()
+	defer c.garland.lockForScan()()
 
 	return c.garland.findRegexInternal(c.bytePos, re, opts)
 }
 
 // FindRegexAll finds all regex matches in the document.
 func (c *Cursor) FindRegexAll(pattern string, opts RegexOptions) ([]SearchResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return nil, ErrCursorNotFound
 	}
 	if len(pattern) == 0 {
@@ -281,8 +278,7 @@ func (c *Cursor) FindRegexAll(pattern string, opts RegexOptions) ([]SearchResult
 		return nil, err
 	}
 
-	c.garland.mu.Lock()
-	defer c.garland.mu.Unlock()
+	defer c.garland.lockForScan()()
 
 	return c.garland.findRegexAllInternal(re, opts)
 }
@@ -290,7 +286,7 @@ func (c *Cursor) FindRegexAll(pattern string, opts RegexOptions) ([]SearchResult
 // MatchRegex checks if the regex matches at the current cursor position.
 // Returns true if the pattern matches starting exactly at cursor position.
 func (c *Cursor) MatchRegex(pattern string, caseInsensitive bool) (bool, *SearchResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return false, nil, ErrCursorNotFound
 	}
 	if len(pattern) == 0 {
@@ -304,8 +300,7 @@ func (c *Cursor) MatchRegex(pattern string, caseInsensitive bool) (bool, *Search
 		return false, nil, err
 	}
 
-	c.garland.mu.Lock()
-	defer c.garland.mu.Unlock()
+	defer c.garland.lockForScan()()
 
 	// Read from cursor to end (or reasonable chunk)
 	data, err := c.garland.readBytesRangeInternal(c.bytePos, c.garland.totalBytes-c.bytePos)
@@ -328,7 +323,7 @@ func (c *Cursor) MatchRegex(pattern string, caseInsensitive bool) (bool, *Search
 // ReplaceRegex replaces the first regex match with replacement.
 // Replacement can include $1, $2, etc. for capture groups.
 func (c *Cursor) ReplaceRegex(pattern, replacement string, opts RegexOptions) (bool, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return false, ChangeResult{}, ErrCursorNotFound
 	}
 	if len(pattern) == 0 {
@@ -366,7 +361,7 @@ func (c *Cursor) ReplaceRegex(pattern, replacement string, opts RegexOptions) (b
 
 // ReplaceRegexAll replaces all regex matches with replacement.
 func (c *Cursor) ReplaceRegexAll(pattern, replacement string, opts RegexOptions) (int, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return 0, ChangeResult{}, ErrCursorNotFound
 	}
 	if len(pattern) == 0 {
@@ -378,7 +373,7 @@ func (c *Cursor) ReplaceRegexAll(pattern, replacement string, opts RegexOptions)
 
 // ReplaceRegexCount replaces up to count regex matches with replacement.
 func (c *Cursor) ReplaceRegexCount(pattern, replacement string, count int, opts RegexOptions) (int, ChangeResult, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return 0, ChangeResult{}, ErrCursorNotFound
 	}
 	if len(pattern) == 0 || count == 0 {
@@ -486,36 +481,41 @@ func (g *Garland) stringMatchesFrom(startPos int64, needle string, opts SearchOp
 		if err != nil {
 			return nil, err
 		}
-		idx := int64(bytes.Index(data, needleBytes))
-		if idx < 0 {
-			if end == g.totalBytes {
+		// Take every match in this window before reading the next one
+		// (re-reading a window per match made dense needles quadratic).
+		rel := int64(0)
+		for {
+			idx := int64(bytes.Index(data[rel:], needleBytes))
+			if idx < 0 {
 				break
 			}
-			// Next window overlaps by needle length - 1 so a match
-			// spanning the window edge is still seen in full.
-			off = end - nlen + 1
-			continue
-		}
-		st := off + idx
-		if st+nlen > end {
-			// Partial at window edge cannot happen (Index found the
-			// full needle inside data), but keep the invariant clear.
-			off = st
-			continue
+			idx += rel
+			st := off + idx
+			if opts.WholeWord && !g.isWholeWordChunked(st, nlen) {
+				rel = idx + 1
+				continue
+			}
+			out = append(out, SearchResult{
+				ByteStart: st,
+				ByteEnd:   st + nlen,
+				Match:     string(data[idx : idx+nlen]),
+			})
+			if limit > 0 && len(out) >= limit {
+				return out, nil
+			}
+			rel = idx + nlen
 		}
-		if opts.WholeWord && !g.isWholeWordChunked(st, nlen) {
-			off = st + 1
-			continue
+		if end == g.totalBytes {
+			break
 		}
-		out = append(out, SearchResult{
-			ByteStart: st,
-			ByteEnd:   st + nlen,
-			Match:     string(data[idx : idx+nlen]),
-		})
-		if limit > 0 && len(out) >= limit {
-			return out, nil
+		// Next window overlaps by needle length - 1 so a match
+		// spanning the window edge is still seen in full - but never
+		// backs up over a match already taken.
+		next := end - nlen + 1
+		if off+rel > next {
+			next = off + rel
 		}
-		off = st + nlen
+		off = next
 	}
 	return out, nil
 }
@@ -723,15 +723,14 @@ func isWordChar(r rune) bool {
 
 // CountString counts occurrences of needle in the document.
 func (c *Cursor) CountString(needle string, opts SearchOptions) (int, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return 0, ErrCursorNotFound
 	}
 	if len(needle) == 0 {
 		return 0, nil
 	}
 
-	c.garland.mu.Lock()
-	defer c.garland.mu.Unlock()
+	defer c.garland.lockForScan()()
 
 	matches, err := c.garland.findStringAllInternal(needle, opts)
 	if err != nil {
@@ -742,7 +741,7 @@ func (c *Cursor) CountString(needle string, opts SearchOptions) (int, error) {
 
 // CountRegex counts regex matches in the document.
 func (c *Cursor) CountRegex(pattern string, caseInsensitive bool) (int, error) {
-	if c.garland == nil {
+	if c.detached() {
 		return 0, ErrCursorNotFound
 	}
 	if len(pattern) == 0 {
@@ -754,8 +753,7 @@ func (c *Cursor) CountRegex(pattern string, caseInsensitive bool) (int, error) {
 		return 0, err
 	}
 
-	c.garland.mu.Lock()
-	defer c.garland.mu.Unlock()
+	defer c.garland.lockForScan()()
 
 	matches, err := c.garland.findRegexAllInternal(re, RegexOptions{})
 	if err != nil {
@@ -767,19 +765,19 @@ func (c *Cursor) CountRegex(pattern string, caseInsensitive bool) (int, error) {
 // FindNext finds the next occurrence and moves cursor to it.
 // Returns the match or nil if not found.
 func (c *Cursor) FindNext(needle string, opts SearchOptions) (*SearchResult, error) {
-	// Start search from position after cursor (to find "next")
-	searchStart := c.bytePos
-	if !opts.Backward {
-		searchStart = c.bytePos + 1
+	if c.detached() {
+		return nil, ErrCursorNotFound
 	}
 
-	if c.garland == nil {
-		return nil, ErrCursorNotFound
+	// Start search from position after cursor (to find "next")
+	searchStart := c.posByte()
+	if !opts.Backward {
+		searchStart++
 	}
 
-	c.garland.mu.Lock()
+	unlock := c.garland.lockForScan()
 	match, err := c.garland.findStringInternal(searchStart, needle, opts)
-	c.garland.mu.Unlock()
+	unlock()
 
 	if err != nil {
 		return nil, err
@@ -792,13 +790,13 @@ func (c *Cursor) FindNext(needle string, opts SearchOptions) (*SearchResult, err
 
 // FindNextRegex finds the next regex match and moves cursor to it.
 func (c *Cursor) FindNextRegex(pattern string, opts RegexOptions) (*SearchResult, error) {
-	searchStart := c.bytePos
-	if !opts.Backward {
-		searchStart = c.bytePos + 1
+	if c.detached() {
+		return nil, ErrCursorNotFound
 	}
 
-	if c.garland == nil {
-		return nil, ErrCursorNotFound
+	searchStart := c.posByte()
+	if !opts.Backward {
+		searchStart++
 	}
 
 	re, err := compileRegex(pattern, opts.CaseInsensitive)
@@ -806,9 +804,9 @@ func (c *Cursor) FindNextRegex(pattern string, opts RegexOptions) (*SearchResult
 		return nil, err
 	}
 
-	c.garland.mu.Lock()
+	unlock := c.garland.lockForScan()
 	match, err := c.garland.findRegexInternal(searchStart, re, opts)
-	c.garland.mu.Unlock()
+	unlock()
 
 	if err != nil {
 		return nil, err
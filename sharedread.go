@@ -0,0 +1,118 @@
+package garland
+
+import "math"
+
+// sharedread.go - letting readers share the lock.
+//
+// DESIGN: every read helper is written to run under g.mu, and most
+// public reads took the WRITE lock because a read can thaw: finding a
+// chilled leaf pulls its bytes back from cold or warm storage, which
+// writes the snapshot's data and storage state and the memory counters.
+// So two goroutines reading different ends of a large document queued
+// behind each other even when nothing was chilled.
+//
+// RULING: a read that touches only RESIDENT leaves mutates nothing -
+// the resident path of ensureLeafDataResident only bumps the atomic hit
+// counter, and leaf data is immutable - so it may run under the READ
+// lock alongside any number of other such reads. lockForRead checks the
+// leaves covering the range under RLock and keeps it when they are all
+// resident; otherwise it drops it for the write lock and the read runs
+// exclusively, thawing as it always has. Readers that only ever see
+// resident data - the common case for a document being actively worked
+// on - scale with cores; the rare thawing read pays what it did before.
+//
+// The range check is O(log n + leaves in range). Searches check the
+// whole document (they scan it anyway). Reads of a streaming remainder
+// (bytes past the tree of a revision made mid-load) always go
+// exclusive - that path is short-lived and not worth a second set of
+// rules.
+
+// lockForRead locks g.mu for a read of [start, end) at the current
+// revision: shared when every leaf in the range is resident, exclusive
+// otherwise. Call the returned function to unlock.
+func (g *Garland) lockForRead(start, end int64) (unlock func()) {
+	g.mu.RLock()
+	if g.residentRangeLocked(start, end) {
+		return g.mu.RUnlock
+	}
+	g.mu.RUnlock()
+	g.mu.Lock()
+	return g.mu.Unlock
+}
+
+// lockForReadHinted is lockForRead for a read starting in a cursor's
+// hinted leaf (see leaf_hint.go): a range inside a valid hint's leaf
+// is resident without a walk. hint may be nil.
+func (g *Garland) lockForReadHinted(hint *leafHint, start, end int64) (unlock func()) {
+	g.mu.RLock()
+	if hint != nil && hint.validLocked(g, start) && end <= hint.leaf.LeafByteStart+hint.leaf.Snapshot.byteCount {
+		return g.mu.RUnlock
+	}
+	if g.residentRangeLocked(start, end) {
+		return g.mu.RUnlock
+	}
+	g.mu.RUnlock()
+	g.mu.Lock()
+	return g.mu.Unlock
+}
+
+// lockForScan is lockForRead over the whole document, for searches.
+func (g *Garland) lockForScan() (unlock func()) {
+	return g.lockForRead(0, math.MaxInt64)
+}
+
+// residentRangeLocked reports whether every leaf overlapping
+// [start, end) at the current revision has its data in memory, and the
+// range lies within the tree proper. Caller must hold g.mu (either
+// mode).
+func (g *Garland) residentRangeLocked(start, end int64) bool {
+	if g.root == nil {
+		return false
+	}
+	rootSnap := g.root.snapshotAt(g.currentFork, g.currentRevision)
+	if rootSnap == nil {
+		return false
+	}
+	if g.calculateTotalBytesUnlocked() != rootSnap.byteCount {
+		return false // streaming remainder
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > rootSnap.byteCount {
+		end = rootSnap.byteCount
+	}
+	if start >= end {
+		// Empty range: the lookup still lands on the leaf at start.
+		end = start + 1
+	}
+	return g.residentSubtree(rootSnap, 0, start, end)
+}
+
+// residentSubtree is the recursive walk of residentRangeLocked; base is
+// the absolute byte offset of snap's first byte.
+func (g *Garland) residentSubtree(snap *NodeSnapshot, base, start, end int64) bool {
+	if snap.isLeaf {
+		return snap.byteCount == 0 || (snap.storageState == StorageMemory && snap.data != nil)
+	}
+	left := g.nodeRegistry[snap.leftID]
+	right := g.nodeRegistry[snap.rightID]
+	if left == nil || right == nil {
+		return false
+	}
+	leftSnap := left.snapshotAt(g.currentFork, g.currentRevision)
+	rightSnap := right.snapshotAt(g.currentFork, g.currentRevision)
+	if leftSnap == nil || rightSnap == nil {
+		return false
+	}
+	mid := base + leftSnap.byteCount
+	if start < mid && !g.residentSubtree(leftSnap, base, start, end) {
+		return false
+	}
+	// A lookup AT mid descends right (findLeafByByteInternal uses <),
+	// so the right side is in play whenever end passes mid.
+	if end > mid && !g.residentSubtree(rightSnap, mid, start, end) {
+		return false
+	}
+	return true
+}
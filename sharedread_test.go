@@ -0,0 +1,67 @@
+package garland
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResidentReadsShareTheLock(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "shared readers do not queue\n"})
+	defer g.Close()
+
+	c := g.NewEphemeralCursor()
+
+	// Another reader holds the lock in shared mode for the whole test;
+	// reads and searches must still complete.
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	done := make(chan string, 1)
+	go func() {
+		n, _ := c.CountString("e", SearchOptions{CaseSensitive: true})
+		r, _ := g.ByteToRune(7)
+		data, _ := g.readBytesAt(0, 6)
+		if n != 5 || r != 7 {
+			done <- "wrong results"
+			return
+		}
+		done <- string(data)
+	}()
+
+	select {
+	case got := <-done:
+		if got != "shared" {
+			t.Errorf("got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("resident read blocked behind a shared holder")
+	}
+}
+
+func TestChilledRangeReadsExclusively(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	g, _ := lib.Open(FileOptions{DataString: "cold bytes thaw under the write lock"})
+	defer g.Close()
+
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatalf("Chill: %v", err)
+	}
+	g.mu.RLock()
+	resident := g.residentRangeLocked(0, 4)
+	g.mu.RUnlock()
+	if resident {
+		t.Fatal("chilled range reported resident")
+	}
+
+	data, err := g.readBytesAt(0, 4)
+	if err != nil || string(data) != "cold" {
+		t.Fatalf("read = %q, %v", data, err)
+	}
+	g.mu.RLock()
+	resident = g.residentRangeLocked(0, 4)
+	g.mu.RUnlock()
+	if !resident {
+		t.Error("range should be resident after the thawing read")
+	}
+}
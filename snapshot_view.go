@@ -0,0 +1,374 @@
+package garland
+
+// snapshot_view.go - read-only views pinned to one revision.
+//
+// DESIGN: the tree is persistent - an edit path-copies into fresh node
+// IDs and a revision is nothing more than (root node, fork, revision).
+// A SnapshotView captures exactly those three values, so taking one is
+// O(1): no content is copied, and the view keeps resolving the same
+// bytes however far the Garland moves on (edits, undo, fork switches,
+// coalescing amends that re-point the live revision's root).
+//
+// Every read helper resolves through g.root at (currentFork,
+// currentRevision). Rather than duplicate the byte / rune / line walks
+// (and their cross-leaf edge cases) for an arbitrary root, a view
+// BORROWS them: under g.mu it installs its own coordinates, runs the
+// ordinary helper, and restores the live ones before unlocking. Nobody
+// can observe the swap - every other reader and writer needs the same
+// lock - and the helpers only read tree state (thawing a chilled leaf
+// writes the snapshot's own storage fields, which is coordinate-free).
+//
+// RETENTION: while a view is live, its revision is a GC root -
+// garbageCollectSnapshots marks everything reachable from the view's
+// root, and Prune / DeleteFork keep its revisionInfo entry (the
+// streaming-remainder bookkeeping reads it). Release drops the hold;
+// the history is reclaimed by the next Prune or DeleteFork as usual.
+//
+// A view cannot be taken while a transaction is pending (the live root
+// is uncommitted and may be rolled back) or while the initial load is
+// still streaming (revision 0 keeps growing in place).
+
+// SnapshotView is a read-only handle on one fork/revision of a Garland.
+// It is safe to use from any goroutine, concurrently with edits on the
+// Garland it came from.
+type SnapshotView struct {
+	g        *Garland
+	root     *Node
+	fork     ForkID
+	rev      RevisionID
+	bytes    int64
+	runes    int64
+	lines    int64
+	counted  bool // runes and lines are real (see counting.go); guarded by g.mu
+	released bool // guarded by g.mu
+}
+
+// Snapshot returns a read-only view of the current fork and revision.
+// Release it when done so its history can be pruned.
+func (g *Garland) Snapshot() (*SnapshotView, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.transaction != nil {
+		return nil, ErrTransactionPending
+	}
+	if g.loader != nil && !g.loader.eofReached {
+		return nil, ErrNotReady
+	}
+	if g.root == nil {
+		return nil, ErrInternal
+	}
+
+	v := &SnapshotView{
+		g:       g,
+		root:    g.root,
+		fork:    g.currentFork,
+		rev:     g.currentRevision,
+		bytes:   g.calculateTotalBytesUnlocked(),
+		runes:   g.totalRunes,
+		lines:   g.totalLines,
+		counted: !g.countsDeferred.Load(),
+	}
+	if g.views == nil {
+		g.views = make(map[*SnapshotView]struct{})
+	}
+	g.views[v] = struct{}{}
+	return v, nil
+}
+
+// Release ends the view's hold on its revision. Reads after Release
+// return ErrSnapshotReleased. Safe to call more than once.
+func (v *SnapshotView) Release() {
+	g := v.g
+	g.mu.Lock()
+	v.released = true
+	delete(g.views, v)
+	g.mu.Unlock()
+}
+
+// Fork returns the fork the view is pinned to.
+func (v *SnapshotView) Fork() ForkID { return v.fork }
+
+// Revision returns the revision the view is pinned to.
+func (v *SnapshotView) Revision() RevisionID { return v.rev }
+
+// Version returns the view's fork and revision together, as the
+// expected version of a compare-and-edit (see cas_edit.go).
+func (v *SnapshotView) Version() ChangeResult {
+	return ChangeResult{Fork: v.fork, Revision: v.rev}
+}
+
+// ByteCount returns the view's total bytes.
+func (v *SnapshotView) ByteCount() int64 { return v.bytes }
+
+// RuneCount returns the view's total runes.
+func (v *SnapshotView) RuneCount() int64 {
+	runes, _ := v.counts()
+	return runes
+}
+
+// LineCount returns the view's total lines.
+func (v *SnapshotView) LineCount() int64 {
+	_, lines := v.counts()
+	return lines
+}
+
+// counts returns the view's rune and line totals. A view taken while
+// counting was deferred holds placeholders; the first call builds the
+// index and reads the real totals off the view's root.
+func (v *SnapshotView) counts() (runes, lines int64) {
+	g := v.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !v.counted {
+		g.ensureCountsLocked()
+		if snap := v.root.snapshotAt(v.fork, v.rev); snap != nil {
+			v.runes, v.lines = snap.runeCount, snap.lineCount
+		}
+		v.counted = true
+	}
+	return v.runes, v.lines
+}
+
+// within runs fn with the view's coordinates installed as the Garland's
+// current ones, under the write lock. See the file comment.
+func (v *SnapshotView) within(fn func(g *Garland) error) error {
+	g := v.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if v.released {
+		return ErrSnapshotReleased
+	}
+	g.touchAccess()
+
+	root, fork, rev := g.root, g.currentFork, g.currentRevision
+	bytes, runes, lines := g.totalBytes, g.totalRunes, g.totalLines
+	defer func() {
+		g.root, g.currentFork, g.currentRevision = root, fork, rev
+		g.totalBytes, g.totalRunes, g.totalLines = bytes, runes, lines
+	}()
+	g.root, g.currentFork, g.currentRevision = v.root, v.fork, v.rev
+	g.totalBytes, g.totalRunes, g.totalLines = v.bytes, v.runes, v.lines
+
+	return fn(g)
+}
+
+// withinCounted is within for rune- and line-addressed work: the index
+// is built first, while the live coordinates are installed.
+func (v *SnapshotView) withinCounted(fn func(g *Garland) error) error {
+	v.counts()
+	return v.within(fn)
+}
+
+// ReadBytes reads up to length bytes starting at byte position pos.
+func (v *SnapshotView) ReadBytes(pos, length int64) ([]byte, error) {
+	if pos < 0 || pos > v.bytes {
+		return nil, ErrInvalidPosition
+	}
+	if length <= 0 {
+		return nil, nil
+	}
+	if pos+length > v.bytes {
+		length = v.bytes - pos
+	}
+	var data []byte
+	err := v.within(func(g *Garland) error {
+		var err error
+		data, err = g.readBytesRangeInternal(pos, length)
+		return err
+	})
+	return data, err
+}
+
+// ReadString reads up to length runes starting at rune position pos.
+func (v *SnapshotView) ReadString(pos, length int64) (string, error) {
+	if runes, _ := v.counts(); pos < 0 || pos > runes {
+		return "", ErrInvalidPosition
+	}
+	if length <= 0 {
+		return "", nil
+	}
+	var s string
+	err := v.withinCounted(func(g *Garland) error {
+		start, err := g.runeToByteInternalUnlocked(pos)
+		if err != nil {
+			return err
+		}
+		end, err := g.runeToByteInternalUnlocked(pos + length)
+		if err != nil {
+			end = v.bytes // past EOF: clamp
+		}
+		data, err := g.readBytesRangeInternal(start, end-start)
+		s = string(data)
+		return err
+	})
+	return s, err
+}
+
+// ReadLine returns the given line (0-based), including its newline
+// when it has one - the same content Cursor.ReadLine returns.
+func (v *SnapshotView) ReadLine(line int64) (string, error) {
+	if _, lines := v.counts(); line < 0 || line > lines {
+		return "", ErrInvalidPosition
+	}
+	var s string
+	err := v.withinCounted(func(g *Garland) error {
+		res, err := g.findLeafByLineUnlocked(line, 0)
+		if err != nil {
+			return err
+		}
+		start := res.LineByteStart
+		end := g.findLineEnd(start)
+		if end <= start {
+			return nil
+		}
+		data, err := g.readBytesRangeInternal(start, end-start)
+		s = string(data)
+		return err
+	})
+	return s, err
+}
+
+// ByteToRune converts a byte position to a rune position in the view.
+func (v *SnapshotView) ByteToRune(bytePos int64) (int64, error) {
+	if bytePos < 0 {
+		return 0, ErrInvalidPosition
+	}
+	var r int64
+	err := v.withinCounted(func(g *Garland) error {
+		var err error
+		r, err = g.byteToRuneInternalUnlocked(bytePos)
+		return err
+	})
+	return r, err
+}
+
+// RuneToByte converts a rune position to a byte position in the view.
+func (v *SnapshotView) RuneToByte(runePos int64) (int64, error) {
+	if runePos < 0 {
+		return 0, ErrInvalidPosition
+	}
+	var b int64
+	err := v.withinCounted(func(g *Garland) error {
+		var err error
+		b, err = g.runeToByteInternalUnlocked(runePos)
+		return err
+	})
+	return b, err
+}
+
+// ByteToLineRune converts a byte position to a line:rune position in
+// the view.
+func (v *SnapshotView) ByteToLineRune(bytePos int64) (line, runeInLine int64, err error) {
+	if bytePos < 0 {
+		return 0, 0, ErrInvalidPosition
+	}
+	err = v.withinCounted(func(g *Garland) error {
+		var err error
+		line, runeInLine, err = g.byteToLineRuneInternalUnlocked(bytePos)
+		return err
+	})
+	return line, runeInLine, err
+}
+
+// LineRuneToByte converts a line:rune position to a byte position in
+// the view.
+func (v *SnapshotView) LineRuneToByte(line, runeInLine int64) (int64, error) {
+	if line < 0 || runeInLine < 0 {
+		return 0, ErrInvalidPosition
+	}
+	var b int64
+	err := v.withinCounted(func(g *Garland) error {
+		var err error
+		b, err = g.lineRuneToByteInternalUnlocked(line, runeInLine)
+		return err
+	})
+	return b, err
+}
+
+// FindString searches for needle starting at byte position from (or,
+// with opts.Backward, for the last match ending at or before it).
+// Returns nil when there is no match.
+func (v *SnapshotView) FindString(from int64, needle string, opts SearchOptions) (*SearchResult, error) {
+	if len(needle) == 0 {
+		return nil, nil
+	}
+	var res *SearchResult
+	err := v.within(func(g *Garland) error {
+		var err error
+		res, err = g.findStringInternal(from, needle, opts)
+		return err
+	})
+	return res, err
+}
+
+// FindStringAll returns every match of needle in the view, in document
+// order (reverse order if opts.Backward).
+func (v *SnapshotView) FindStringAll(needle string, opts SearchOptions) ([]SearchResult, error) {
+	if len(needle) == 0 {
+		return nil, nil
+	}
+	var res []SearchResult
+	err := v.within(func(g *Garland) error {
+		var err error
+		res, err = g.findStringAllInternal(needle, opts)
+		return err
+	})
+	return res, err
+}
+
+// FindRegex searches for pattern starting at byte position from (or,
+// with opts.Backward, for the last match ending at or before it).
+func (v *SnapshotView) FindRegex(from int64, pattern string, opts RegexOptions) (*SearchResult, error) {
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	re, err := compileRegex(pattern, opts.CaseInsensitive)
+	if err != nil {
+		return nil, err
+	}
+	var res *SearchResult
+	err = v.within(func(g *Garland) error {
+		var err error
+		res, err = g.findRegexInternal(from, re, opts)
+		return err
+	})
+	return res, err
+}
+
+// FindRegexAll returns every match of pattern in the view, in document
+// order (reverse order if opts.Backward).
+func (v *SnapshotView) FindRegexAll(pattern string, opts RegexOptions) ([]SearchResult, error) {
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	re, err := compileRegex(pattern, opts.CaseInsensitive)
+	if err != nil {
+		return nil, err
+	}
+	var res []SearchResult
+	err = v.within(func(g *Garland) error {
+		var err error
+		res, err = g.findRegexAllInternal(re, opts)
+		return err
+	})
+	return res, err
+}
+
+// viewHoldsRevisionLocked reports whether a live view is pinned to
+// forkRev. Caller must hold g.mu.
+func (g *Garland) viewHoldsRevisionLocked(forkRev ForkRevision) bool {
+	for v := range g.views {
+		if v.fork == forkRev.Fork && v.rev == forkRev.Revision {
+			return true
+		}
+	}
+	return false
+}
+
+// markViewSnapshotsInUse adds every live view's tree to a GC mark set.
+func (g *Garland) markViewSnapshotsInUse(inUse map[NodeID]map[ForkRevision]bool) {
+	for v := range g.views {
+		g.markSnapshotsReachableFrom(v.root.id, v.fork, v.rev, inUse)
+	}
+}
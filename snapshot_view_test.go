@@ -0,0 +1,111 @@
+package garland
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSnapshotViewIsPinned(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "alpha\nbeta\ngamma"})
+	defer g.Close()
+
+	v, err := g.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	defer v.Release()
+
+	c := g.NewCursor()
+	c.SeekByte(6)
+	c.InsertString("NEW ", nil, true)
+	c.SeekByte(0)
+	c.DeleteBytes(2, false)
+
+	if d, _ := v.ReadBytes(0, v.ByteCount()); string(d) != "alpha\nbeta\ngamma" {
+		t.Errorf("view content = %q", d)
+	}
+	if d, _ := g.NewCursor().ReadBytes(g.ByteCount().Value); string(d) != "pha\nNEW beta\ngamma" {
+		t.Errorf("live content = %q", d)
+	}
+	if line, _ := v.ReadLine(1); line != "beta\n" {
+		t.Errorf("ReadLine(1) = %q", line)
+	}
+	if s, _ := v.ReadString(6, 4); s != "beta" {
+		t.Errorf("ReadString = %q", s)
+	}
+	if line, col, _ := v.ByteToLineRune(13); line != 2 || col != 2 {
+		t.Errorf("ByteToLineRune(13) = %d:%d, want 2:2", line, col)
+	}
+	if b, _ := v.LineRuneToByte(2, 0); b != 11 {
+		t.Errorf("LineRuneToByte(2,0) = %d, want 11", b)
+	}
+	if r, _ := v.FindString(0, "beta", SearchOptions{CaseSensitive: true}); r == nil || r.ByteStart != 6 {
+		t.Errorf("FindString = %+v", r)
+	}
+	if all, _ := v.FindRegexAll(`a\b`, RegexOptions{}); len(all) != 3 {
+		t.Errorf("FindRegexAll found %d, want 3", len(all))
+	}
+	// The live Garland's coordinates are untouched by view reads.
+	if g.CurrentRevision() != 2 || g.ByteCount().Value != 18 {
+		t.Errorf("live state disturbed: rev %d, bytes %d", g.CurrentRevision(), g.ByteCount().Value)
+	}
+}
+
+func TestSnapshotViewSurvivesPrune(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "one two three"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekByte(3)
+	c.InsertString(" and a half", nil, true)
+	v, _ := g.Snapshot()
+	want := "one and a half two three"
+
+	c.SeekByte(0)
+	c.InsertString(">> ", nil, true)
+	if err := g.Prune(g.CurrentRevision()); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if d, err := v.ReadBytes(0, v.ByteCount()); err != nil || string(d) != want {
+		t.Errorf("after Prune: %q, %v", d, err)
+	}
+
+	v.Release()
+	v.Release()
+	if _, err := v.ReadBytes(0, 1); err != ErrSnapshotReleased {
+		t.Errorf("read after Release: err = %v", err)
+	}
+}
+
+func TestSnapshotViewConcurrentWithEdits(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "The quick brown fox jumps over the lazy dog.\n", MaxLeafSize: 16})
+	defer g.Close()
+
+	v, _ := g.Snapshot()
+	defer v.Release()
+	want, _ := v.ReadBytes(0, v.ByteCount())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c := g.NewCursor()
+		for i := 0; i < 200; i++ {
+			c.SeekByte(int64(i % 40))
+			c.InsertString("x", nil, true)
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		d, err := v.ReadBytes(0, v.ByteCount())
+		if err != nil || string(d) != string(want) {
+			t.Fatalf("iteration %d: %q, %v", i, d, err)
+		}
+		if r, _ := v.FindString(0, "lazy", SearchOptions{CaseSensitive: true}); r == nil || r.ByteStart != 35 {
+			t.Fatalf("iteration %d: FindString = %+v", i, r)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,429 @@
+package garland
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+)
+
+// source_diff.go - what changed since the file on disk.
+//
+// DESIGN: a "modified lines" gutter and a pre-save preview both ask the
+// same question: which lines of the buffer differ from the file at
+// sourcePath? DiffAgainstSource answers it as line hunks (with their
+// byte ranges on both sides); UnifiedDiffAgainstSource writes the same
+// hunks as a unified diff.
+//
+// RAM: neither side is ever held whole. Both are streamed once in
+// chunks, keeping per line only a 64-bit hash and the line's start
+// offset; the diff runs on the hashes. The unified writer re-reads just
+// the lines it prints. (Two different lines hashing alike would be
+// taken as equal - with FNV-64a that is not a practical concern.)
+//
+//   - The buffer side is a SnapshotView of the current revision, so
+//     edits during the diff do not tear it; like Snapshot, the diff is
+//     refused while a transaction is pending or a load still streams.
+//     The file side is read under saveMu, so a save cannot rewrite it
+//     midway.
+//   - A line includes its newline; a last line without one differs
+//     from the same text with one.
+//   - Common leading and trailing lines are trimmed, then the middle is
+//     diffed with Myers' algorithm. A middle needing more than
+//     diffMaxEdits line edits is reported as one hunk covering all of
+//     it: bounded time and memory over a minimal script for files that
+//     are mostly different anyway.
+//   - Line numbers are 0-based like the rest of the API; the unified
+//     output uses the conventional 1-based ones.
+
+// diffMaxEdits bounds the Myers search (see the file comment).
+const diffMaxEdits = 1024
+
+// diffChunk is the streaming read size for both sides.
+const diffChunk = 128 << 10
+
+// DiffHunk is one changed range between the source file (Old) and the
+// current revision (New). A zero line count is a pure insertion or
+// deletion, positioned before line OldLine / NewLine.
+type DiffHunk struct {
+	OldLine, OldLines int64 // source file lines [OldLine, OldLine+OldLines)
+	NewLine, NewLines int64 // current revision lines [NewLine, NewLine+NewLines)
+	OldStart, OldEnd  int64 // the source range in bytes
+	NewStart, NewEnd  int64 // the current revision range in bytes
+}
+
+// lineIndex is one side of a diff: a hash per line, and the line start
+// offsets with the total length appended (len(hashes)+1 entries).
+type lineIndex struct {
+	hashes []uint64
+	offs   []int64
+}
+
+// lineIndexer builds a lineIndex from a stream of chunks.
+type lineIndexer struct {
+	idx  lineIndex
+	h    hash.Hash64
+	pos  int64
+	open bool
+}
+
+func newLineIndexer() *lineIndexer {
+	return &lineIndexer{idx: lineIndex{offs: []int64{0}}, h: fnv.New64a()}
+}
+
+func (li *lineIndexer) write(data []byte) {
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			li.h.Write(data)
+			li.pos += int64(len(data))
+			li.open = true
+			return
+		}
+		li.h.Write(data[:i+1])
+		li.pos += int64(i + 1)
+		li.endLine()
+		data = data[i+1:]
+	}
+}
+
+func (li *lineIndexer) endLine() {
+	li.idx.hashes = append(li.idx.hashes, li.h.Sum64())
+	li.h.Reset()
+	li.idx.offs = append(li.idx.offs, li.pos)
+	li.open = false
+}
+
+func (li *lineIndexer) finish() lineIndex {
+	if li.open {
+		li.endLine()
+	}
+	return li.idx
+}
+
+// sourceDiff is a computed diff with both sides still readable.
+type sourceDiff struct {
+	path     string
+	old, new lineIndex
+	hunks    []DiffHunk
+	readOld  func(pos, length int64) ([]byte, error)
+	readNew  func(pos, length int64) ([]byte, error)
+	newState treeState // the version readNew reads (decoration overlays)
+}
+
+// DiffAgainstSource returns the hunks in which the current revision
+// differs from the file at the source path, in document order. No
+// hunks means the buffer matches the file. Returns ErrNoDataSource
+// when there is no source path.
+func (g *Garland) DiffAgainstSource() ([]DiffHunk, error) {
+	var hunks []DiffHunk
+	err := g.withSourceDiff(func(d *sourceDiff) error {
+		hunks = d.hunks
+		return nil
+	})
+	return hunks, err
+}
+
+// UnifiedDiffAgainstSource writes the differences between the file at
+// the source path and the current revision to w as a unified diff with
+// contextLines lines of context. Nothing is written when they match.
+func (g *Garland) UnifiedDiffAgainstSource(w io.Writer, contextLines int) error {
+	if contextLines < 0 {
+		contextLines = 0
+	}
+	return g.withSourceDiff(func(d *sourceDiff) error {
+		return d.writeUnified(w, int64(contextLines))
+	})
+}
+
+// withSourceDiff diffs the source file against a snapshot of the
+// current revision and calls fn while both can still be read. Caller
+// must NOT hold g.mu.
+func (g *Garland) withSourceDiff(fn func(d *sourceDiff) error) error {
+	g.saveMu.Lock()
+	defer g.saveMu.Unlock()
+
+	g.mu.RLock()
+	path, fs := g.sourcePath, g.sourceFS
+	g.mu.RUnlock()
+	if path == "" {
+		return ErrNoDataSource
+	}
+	if fs == nil {
+		fs = g.lib.defaultFS
+	}
+
+	view, err := g.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer view.Release()
+	handle, err := fs.Open(path, OpenModeRead)
+	if err != nil {
+		return err
+	}
+	defer fs.Close(handle)
+
+	d := &sourceDiff{
+		path:     path,
+		newState: treeState{root: view.root, fork: view.fork, rev: view.rev},
+		readNew: func(pos, length int64) ([]byte, error) {
+			return view.ReadBytes(pos, length)
+		},
+		readOld: func(pos, length int64) ([]byte, error) {
+			if err := fs.SeekByte(handle, pos); err != nil {
+				return nil, err
+			}
+			var out []byte
+			for int64(len(out)) < length {
+				data, err := fs.ReadBytes(handle, int(min(length-int64(len(out)), diffChunk)))
+				out = append(out, data...)
+				if err == io.EOF || len(data) == 0 {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		},
+	}
+
+	if d.old, err = indexFileLines(fs, handle); err != nil {
+		return err
+	}
+	li := newLineIndexer()
+	for pos := int64(0); pos < view.ByteCount(); pos += diffChunk {
+		data, err := view.ReadBytes(pos, diffChunk)
+		if err != nil {
+			return err
+		}
+		li.write(data)
+	}
+	d.new = li.finish()
+	d.hunks = diffLineIndexes(d.old, d.new)
+	return fn(d)
+}
+
+// indexFileLines streams a file from its start into a lineIndex.
+func indexFileLines(fs FileSystemInterface, handle FileHandle) (lineIndex, error) {
+	if err := fs.SeekByte(handle, 0); err != nil {
+		return lineIndex{}, err
+	}
+	li := newLineIndexer()
+	for {
+		data, err := fs.ReadBytes(handle, diffChunk)
+		li.write(data)
+		if err == io.EOF || fs.IsEOF(handle) {
+			break
+		}
+		if err != nil {
+			return lineIndex{}, err
+		}
+		if len(data) == 0 {
+			break // defensive: no progress and no EOF signal
+		}
+	}
+	return li.finish(), nil
+}
+
+// diffLineIndexes returns the hunks turning old into new.
+func diffLineIndexes(old, new lineIndex) []DiffHunk {
+	a, b := old.hashes, new.hashes
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	a, b = a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	spans, ok := myersSpans(a, b, diffMaxEdits)
+	if !ok {
+		spans = [][4]int{{0, len(a), 0, len(b)}}
+	}
+	hunks := make([]DiffHunk, 0, len(spans))
+	for _, s := range spans {
+		oLo, oHi, nLo, nHi := int64(pre+s[0]), int64(pre+s[1]), int64(pre+s[2]), int64(pre+s[3])
+		hunks = append(hunks, DiffHunk{
+			OldLine: oLo, OldLines: oHi - oLo,
+			NewLine: nLo, NewLines: nHi - nLo,
+			OldStart: old.offs[oLo], OldEnd: old.offs[oHi],
+			NewStart: new.offs[nLo], NewEnd: new.offs[nHi],
+		})
+	}
+	return hunks
+}
+
+// myersSpans diffs a against b with Myers' O(ND) algorithm and returns
+// the changed spans as {aLo, aHi, bLo, bHi}. ok is false when the
+// script would need more than maxD edits.
+func myersSpans(a, b []uint64, maxD int) (spans [][4]int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil, true
+	}
+	off := maxD + 1
+	v := make([]int, 2*maxD+3)
+	// trace[d] is v as round d found it: k in [-(d-1), d-1], stored
+	// from index 0.
+	var trace [][]int
+	for d := 0; d <= maxD && d <= n+m; d++ {
+		if d > 0 {
+			trace = append(trace, append([]int(nil), v[off-d+1:off+d]...))
+		} else {
+			trace = append(trace, nil)
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return myersBacktrack(trace, n, m), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// myersBacktrack walks the trace back from (n, m) and groups the edits
+// into spans.
+func myersBacktrack(trace [][]int, n, m int) [][4]int {
+	delA := make([]bool, n)
+	insB := make([]bool, m)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		get := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var pk int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := get(pk)
+		py := px - pk
+		for x > px && y > py {
+			x--
+			y--
+		}
+		if pk == k+1 {
+			insB[py] = true
+		} else {
+			delA[px] = true
+		}
+		x, y = px, py
+	}
+
+	var spans [][4]int
+	i, j := 0, 0
+	for i < n || j < m {
+		if i < n && j < m && !delA[i] && !insB[j] {
+			i++
+			j++
+			continue
+		}
+		s := [4]int{i, i, j, j}
+		for (i < n && delA[i]) || (j < m && insB[j]) {
+			if i < n && delA[i] {
+				i++
+			}
+			if j < m && insB[j] {
+				j++
+			}
+		}
+		s[1], s[3] = i, j
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+// writeUnified writes the hunks as a unified diff.
+func (d *sourceDiff) writeUnified(w io.Writer, ctx int64) error {
+	if len(d.hunks) == 0 {
+		return nil
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "--- %s\n+++ %s (buffer)\n", d.path, d.path)
+	err := d.eachGroup(ctx, func(oLo, oHi, nLo, nHi int64, hunks []DiffHunk) error {
+		fmt.Fprintf(bw, "@@ -%s +%s @@\n", unifiedRange(oLo, oHi-oLo), unifiedRange(nLo, nHi-nLo))
+		o := oLo
+		for _, h := range hunks {
+			if err := d.emit(bw, ' ', d.readOld, d.old, o, h.OldLine); err != nil {
+				return err
+			}
+			if err := d.emit(bw, '-', d.readOld, d.old, h.OldLine, h.OldLine+h.OldLines); err != nil {
+				return err
+			}
+			if err := d.emit(bw, '+', d.readNew, d.new, h.NewLine, h.NewLine+h.NewLines); err != nil {
+				return err
+			}
+			o = h.OldLine + h.OldLines
+		}
+		return d.emit(bw, ' ', d.readOld, d.old, o, oHi)
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// eachGroup calls fn for each run of hunks whose ctx lines of context
+// would touch, with the old and new line ranges the run displays.
+func (d *sourceDiff) eachGroup(ctx int64, fn func(oLo, oHi, nLo, nHi int64, hunks []DiffHunk) error) error {
+	oldLines, newLines := int64(len(d.old.hashes)), int64(len(d.new.hashes))
+	for i := 0; i < len(d.hunks); {
+		j := i + 1
+		for j < len(d.hunks) && d.hunks[j].OldLine-(d.hunks[j-1].OldLine+d.hunks[j-1].OldLines) <= 2*ctx {
+			j++
+		}
+		first, last := d.hunks[i], d.hunks[j-1]
+		oLo := max(first.OldLine-ctx, 0)
+		nLo := first.NewLine - (first.OldLine - oLo)
+		oHi := min(last.OldLine+last.OldLines+ctx, oldLines)
+		nHi := min(last.NewLine+last.NewLines+ctx, newLines)
+		if err := fn(oLo, oHi, nLo, nHi, d.hunks[i:j]); err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
+
+// emit writes lines [lo, hi) of one side, each prefixed with tag.
+func (d *sourceDiff) emit(w *bufio.Writer, tag byte, read func(pos, length int64) ([]byte, error), idx lineIndex, lo, hi int64) error {
+	for l := lo; l < hi; l++ {
+		line, err := read(idx.offs[l], idx.offs[l+1]-idx.offs[l])
+		if err != nil {
+			return err
+		}
+		w.WriteByte(tag)
+		w.Write(line)
+		if n := len(line); n == 0 || line[n-1] != '\n' {
+			w.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	return nil
+}
+
+// unifiedRange formats a 0-based line range as a unified diff "l,s".
+func unifiedRange(start, count int64) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
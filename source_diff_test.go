@@ -0,0 +1,88 @@
+package garland
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openSourceFile(t *testing.T, content string) (*Garland, *Cursor) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lib, _ := Init(LibraryOptions{})
+	g, err := lib.Open(FileOptions{FilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g, g.NewCursor()
+}
+
+func TestDiffAgainstSource(t *testing.T) {
+	g, c := openSourceFile(t, "one\ntwo\nthree\nfour\nfive\n")
+
+	if hunks, err := g.DiffAgainstSource(); err != nil || len(hunks) != 0 {
+		t.Fatalf("unmodified: hunks = %v, err = %v; want none", hunks, err)
+	}
+
+	// Change line 1, insert a line before line 4, delete the last line.
+	c.SeekByte(4)
+	c.OverwriteBytes(3, []byte("TWO"))
+	c.SeekLine(3, 0)
+	c.InsertString("new\n", nil, false)
+	c.SeekLine(5, 0)
+	c.DeleteBytes(5, false)
+	if got := readAll(t, g); got != "one\nTWO\nthree\nnew\nfour\n" {
+		t.Fatalf("setup: %q", got)
+	}
+
+	hunks, err := g.DiffAgainstSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DiffHunk{
+		{OldLine: 1, OldLines: 1, NewLine: 1, NewLines: 1, OldStart: 4, OldEnd: 8, NewStart: 4, NewEnd: 8},
+		{OldLine: 3, OldLines: 0, NewLine: 3, NewLines: 1, OldStart: 14, OldEnd: 14, NewStart: 14, NewEnd: 18},
+		{OldLine: 4, OldLines: 1, NewLine: 5, NewLines: 0, OldStart: 19, OldEnd: 24, NewStart: 23, NewEnd: 23},
+	}
+	if len(hunks) != len(want) {
+		t.Fatalf("hunks = %+v, want %+v", hunks, want)
+	}
+	for i := range want {
+		if hunks[i] != want[i] {
+			t.Errorf("hunk %d = %+v, want %+v", i, hunks[i], want[i])
+		}
+	}
+
+	lib, _ := Init(LibraryOptions{})
+	mem, _ := lib.Open(FileOptions{DataString: "no file"})
+	defer mem.Close()
+	if _, err := mem.DiffAgainstSource(); err != ErrNoDataSource {
+		t.Fatalf("no source err = %v, want ErrNoDataSource", err)
+	}
+}
+
+func TestUnifiedDiffAgainstSource(t *testing.T) {
+	g, c := openSourceFile(t, "a\nb\nc\nd\ne\nf\ng\nh\ni\nj")
+
+	c.SeekLine(1, 0)
+	c.OverwriteBytes(1, []byte("B"))
+	c.SeekEnd()
+	c.InsertString("\n", nil, false)
+
+	var sb strings.Builder
+	if err := g.UnifiedDiffAgainstSource(&sb, 1); err != nil {
+		t.Fatal(err)
+	}
+	path := g.SourcePath()
+	want := "--- " + path + "\n+++ " + path + " (buffer)\n" +
+		"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n" +
+		"@@ -9,2 +9,2 @@\n i\n-j\n\\ No newline at end of file\n+j\n"
+	if sb.String() != want {
+		t.Fatalf("unified diff:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
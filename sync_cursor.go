@@ -0,0 +1,236 @@
+package garland
+
+import (
+	"context"
+	"sync"
+)
+
+// sync_cursor.go - a cursor shared between goroutines.
+//
+// DESIGN: every cursor field is read and written under g.mu, so a
+// single call on a Cursor never tears its position. But most cursor
+// operations are two steps - read the position, then act there and
+// move: ReadBytes reads at the position and then advances,
+// SeekRelativeBytes adds to the position it just read, InsertString
+// inserts at the position and then moves past the insert. Two
+// goroutines driving the same Cursor (the UI moving the caret while a
+// worker reads from it) interleave those steps: a read returns data
+// from one place and advances from another, a relative seek is applied
+// twice to the same base.
+//
+// RULING: Cursor stays unsynchronized across calls - almost every
+// cursor has one owner and should not pay for a second lock. A cursor
+// that must be shared goes behind a SyncCursor, which holds its own
+// mutex for the whole of each operation, so every call lands as a unit
+// against the others on the same SyncCursor. Do runs a caller's
+// sequence (seek, read, insert ...) under that mutex, for compound
+// steps of your own.
+//
+// The SyncCursor mutex is taken before g.mu, never inside it; blocking
+// operations (seeks waiting on a streaming load) hold it while they
+// wait, so use the Ctx variants to keep a stalled wait cancelable.
+
+// SyncCursor wraps a Cursor for use from several goroutines. Each
+// method is the Cursor method of the same name, run under the
+// SyncCursor's mutex.
+type SyncCursor struct {
+	mu sync.Mutex
+	c  *Cursor
+}
+
+// NewSyncCursor wraps c. Once wrapped, c should only be used through
+// the SyncCursor (or inside Do).
+func NewSyncCursor(c *Cursor) *SyncCursor {
+	return &SyncCursor{c: c}
+}
+
+// NewSyncCursor creates a new cursor at position 0 and wraps it.
+func (g *Garland) NewSyncCursor() *SyncCursor {
+	return NewSyncCursor(g.NewCursor())
+}
+
+// Do runs fn with the underlying cursor while holding the SyncCursor's
+// mutex, so the whole sequence is atomic with respect to other users of
+// this SyncCursor. fn must not call methods of the same SyncCursor.
+func (s *SyncCursor) Do(fn func(c *Cursor) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.c)
+}
+
+// Position returns the cursor's position in all coordinate systems.
+func (s *SyncCursor) Position() CursorPosition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Position()
+}
+
+// BytePos returns the cursor's absolute byte position.
+func (s *SyncCursor) BytePos() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.BytePos()
+}
+
+// RunePos returns the cursor's absolute rune position.
+func (s *SyncCursor) RunePos() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.RunePos()
+}
+
+// LinePos returns the cursor's line and rune-within-line position.
+func (s *SyncCursor) LinePos() (line, runeInLine int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.LinePos()
+}
+
+// SeekByte moves the cursor to an absolute byte position.
+func (s *SyncCursor) SeekByte(pos int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekByte(pos)
+}
+
+// SeekByteCtx moves the cursor to an absolute byte position, waiting
+// during lazy loading until it is available or ctx is done.
+func (s *SyncCursor) SeekByteCtx(ctx context.Context, pos int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekByteCtx(ctx, pos)
+}
+
+// SeekRune moves the cursor to an absolute rune position.
+func (s *SyncCursor) SeekRune(pos int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekRune(pos)
+}
+
+// SeekLine moves the cursor to a line and rune-within-line position.
+func (s *SyncCursor) SeekLine(line, runeInLine int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekLine(line, runeInLine)
+}
+
+// SeekRelativeBytes moves the cursor relative to its byte position.
+func (s *SyncCursor) SeekRelativeBytes(delta int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekRelativeBytes(delta)
+}
+
+// SeekRelativeRunes moves the cursor relative to its rune position.
+func (s *SyncCursor) SeekRelativeRunes(delta int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekRelativeRunes(delta)
+}
+
+// SeekByWord moves the cursor by n words (WordStyleSimple).
+func (s *SyncCursor) SeekByWord(n int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekByWord(n)
+}
+
+// SeekLineStart moves the cursor to the beginning of its line.
+func (s *SyncCursor) SeekLineStart() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekLineStart()
+}
+
+// SeekLineEnd moves the cursor to the end of its line.
+func (s *SyncCursor) SeekLineEnd() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.SeekLineEnd()
+}
+
+// ReadBytes reads length bytes at the cursor and advances past them.
+func (s *SyncCursor) ReadBytes(length int64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.ReadBytes(length)
+}
+
+// ReadBytesCtx is ReadBytes, first waiting until the range is loaded or
+// ctx is done.
+func (s *SyncCursor) ReadBytesCtx(ctx context.Context, length int64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.ReadBytesCtx(ctx, length)
+}
+
+// ReadString reads length runes at the cursor and advances past them.
+func (s *SyncCursor) ReadString(length int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.ReadString(length)
+}
+
+// ReadLine reads the cursor's line without moving the cursor.
+func (s *SyncCursor) ReadLine() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.ReadLine()
+}
+
+// InsertBytes inserts data at the cursor and advances past it.
+func (s *SyncCursor) InsertBytes(data []byte, decorations []RelativeDecoration, insertBefore bool) (ChangeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.InsertBytes(data, decorations, insertBefore)
+}
+
+// InsertString inserts data at the cursor and advances past it.
+func (s *SyncCursor) InsertString(data string, decorations []RelativeDecoration, insertBefore bool) (ChangeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.InsertString(data, decorations, insertBefore)
+}
+
+// DeleteBytes deletes length bytes at the cursor.
+func (s *SyncCursor) DeleteBytes(length int64, includeLineDecorations bool) ([]RelativeDecoration, ChangeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.DeleteBytes(length, includeLineDecorations)
+}
+
+// DeleteRunes deletes length runes at the cursor.
+func (s *SyncCursor) DeleteRunes(length int64, includeLineDecorations bool) ([]RelativeDecoration, ChangeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.DeleteRunes(length, includeLineDecorations)
+}
+
+// BackDeleteBytes deletes length bytes before the cursor.
+func (s *SyncCursor) BackDeleteBytes(length int64, includeLineDecorations bool) ([]RelativeDecoration, ChangeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.BackDeleteBytes(length, includeLineDecorations)
+}
+
+// BackDeleteRunes deletes length runes before the cursor.
+func (s *SyncCursor) BackDeleteRunes(length int64, includeLineDecorations bool) ([]RelativeDecoration, ChangeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.BackDeleteRunes(length, includeLineDecorations)
+}
+
+// FindNext finds the next occurrence of needle and moves to it.
+func (s *SyncCursor) FindNext(needle string, opts SearchOptions) (*SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.FindNext(needle, opts)
+}
+
+// FindNextRegex finds the next match of pattern and moves to it.
+func (s *SyncCursor) FindNextRegex(pattern string, opts RegexOptions) (*SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.FindNextRegex(pattern, opts)
+}
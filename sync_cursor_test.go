@@ -0,0 +1,73 @@
+package garland
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSyncCursorReadsDoNotTear(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("abcd", 200), MaxLeafSize: 16})
+	defer g.Close()
+
+	s := g.NewSyncCursor()
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				// Each read starts on a 4-byte boundary and advances 4, so
+				// an untorn read is always "abcd".
+				data, err := s.ReadBytes(4)
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				if string(data) != "abcd" {
+					errs <- "torn read " + string(data)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Fatal(e)
+	}
+	if pos := s.BytePos(); pos != 800 {
+		t.Errorf("BytePos = %d, want 800", pos)
+	}
+}
+
+func TestSyncCursorDo(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "\n"})
+	defer g.Close()
+
+	s := g.NewSyncCursor()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				s.Do(func(c *Cursor) error {
+					c.SeekByte(0)
+					c.InsertString("[", nil, true)
+					_, err := c.InsertString("]", nil, true)
+					return err
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, _ := g.NewCursor().ReadBytes(g.ByteCount().Value)
+	if got := strings.TrimSuffix(string(data), "\n"); got != strings.Repeat("[]", 100) {
+		t.Errorf("content = %q", got)
+	}
+}
@@ -0,0 +1,109 @@
+package garland
+
+import "sync/atomic"
+
+// tracing.go - counting the tree work operations do, for teaching and
+// for checking that an optimization actually takes effect.
+//
+// DESIGN: SetTracing(true) starts counting from zero and TreeCounts
+// reads the counts so far, so a caller brackets an operation with two
+// TreeCounts calls and subtracts (the REPL's trace mode does, per
+// command).
+//   - Most counts already exist as cumulative counters: node IDs are
+//     handed out in sequence (nextNodeID), chills and thaws are kept
+//     for MemoryUsage (tierStats), rebuilds for RebalanceStats. Tracing
+//     only records their values when it starts.
+//   - The rest are counted only while tracing is on, behind one atomic
+//     flag: nodes a descent passes through (searches run under the read
+//     lock, so these are atomic), snapshots recorded on nodes (each
+//     path-copy of an edit records one per new node), and rotations.
+//   - Chills include warm evictions and thaws include warm reads; both
+//     move a leaf between memory and storage.
+
+// TreeCounts counts the tree work done since tracing began.
+type TreeCounts struct {
+	NodesVisited    int64 // nodes descents to a leaf passed through
+	NodesCreated    int64 // node IDs allocated
+	SnapshotsCopied int64 // node snapshots recorded (copy-on-write)
+	Chills          int64 // leaves moved to cold or warm storage
+	Thaws           int64 // leaves read back from cold or warm storage
+	Rotations       int64 // rebalancing rotations
+	Rebuilds        int64 // completed rebalancing rebuilds
+}
+
+// Sub returns the counts accumulated between before and c.
+func (c TreeCounts) Sub(before TreeCounts) TreeCounts {
+	return TreeCounts{
+		NodesVisited:    c.NodesVisited - before.NodesVisited,
+		NodesCreated:    c.NodesCreated - before.NodesCreated,
+		SnapshotsCopied: c.SnapshotsCopied - before.SnapshotsCopied,
+		Chills:          c.Chills - before.Chills,
+		Thaws:           c.Thaws - before.Thaws,
+		Rotations:       c.Rotations - before.Rotations,
+		Rebuilds:        c.Rebuilds - before.Rebuilds,
+	}
+}
+
+// treeTrace is a Garland's tracing state.
+type treeTrace struct {
+	on        atomic.Bool
+	visited   atomic.Int64
+	snapshots atomic.Int64
+	rotations atomic.Int64
+	base      TreeCounts // the cumulative counters when tracing began
+}
+
+// SetTracing turns counting tree work on (from zero) or off.
+func (g *Garland) SetTracing(on bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	t := &g.trace
+	if on {
+		t.visited.Store(0)
+		t.snapshots.Store(0)
+		t.rotations.Store(0)
+		t.base = g.cumulativeCountsLocked()
+	}
+	t.on.Store(on)
+}
+
+// Tracing reports whether tree work is being counted.
+func (g *Garland) Tracing() bool {
+	return g.trace.on.Load()
+}
+
+// TreeCounts returns the tree work counted since tracing began; zero
+// counts when tracing is off.
+func (g *Garland) TreeCounts() TreeCounts {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	t := &g.trace
+	if !t.on.Load() {
+		return TreeCounts{}
+	}
+	c := g.cumulativeCountsLocked().Sub(t.base)
+	c.NodesVisited = t.visited.Load()
+	c.SnapshotsCopied = t.snapshots.Load()
+	c.Rotations = t.rotations.Load()
+	return c
+}
+
+// cumulativeCountsLocked returns the counters tracing reads as deltas.
+func (g *Garland) cumulativeCountsLocked() TreeCounts {
+	tc := &g.tierStats
+	return TreeCounts{
+		NodesCreated: int64(g.nextNodeID),
+		Chills:       tc.chills + tc.warmEvictions,
+		Thaws:        tc.thaws + tc.warmReads,
+		Rebuilds:     g.rebalance.rebuilds,
+	}
+}
+
+// traceVisit counts a node a descent passed through.
+func (g *Garland) traceVisit() {
+	if g.trace.on.Load() {
+		g.trace.visited.Add(1)
+	}
+}
@@ -0,0 +1,55 @@
+package garland
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTreeCounts(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	g, _ := lib.Open(FileOptions{DataString: strings.Repeat("0123456789", 100), MaxLeafSize: 64})
+	defer g.Close()
+	c := g.NewCursor()
+
+	if g.Tracing() || g.TreeCounts() != (TreeCounts{}) {
+		t.Fatal("tracing is on before SetTracing")
+	}
+	g.SetTracing(true)
+
+	before := g.TreeCounts()
+	if err := c.SeekByte(500); err != nil {
+		t.Fatal(err)
+	}
+	seek := g.TreeCounts().Sub(before)
+	if seek.NodesVisited < 3 || seek.NodesCreated != 0 || seek.SnapshotsCopied != 0 {
+		t.Errorf("seek counted %+v", seek)
+	}
+
+	before = g.TreeCounts()
+	if _, err := c.InsertString("x", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	insert := g.TreeCounts().Sub(before)
+	if insert.NodesCreated == 0 || insert.SnapshotsCopied < insert.NodesCreated {
+		t.Errorf("insert counted %+v", insert)
+	}
+
+	before = g.TreeCounts()
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatal(err)
+	}
+	c.SeekByte(0)
+	if _, err := c.ReadBytes(10); err != nil {
+		t.Fatal(err)
+	}
+	tiers := g.TreeCounts().Sub(before)
+	if tiers.Chills == 0 || tiers.Thaws == 0 {
+		t.Errorf("chill and read counted %+v", tiers)
+	}
+
+	g.SetTracing(false)
+	c.SeekByte(900)
+	if got := g.TreeCounts(); got != (TreeCounts{}) {
+		t.Errorf("counts after tracing stopped: %+v", got)
+	}
+}
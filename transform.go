@@ -0,0 +1,119 @@
+package garland
+
+import "context"
+
+// transform.go - streaming a range through a text transformer.
+//
+// DESIGN: normalization (NFC/NFD), case folding and charset conversion
+// are golang.org/x/text transformers: a Transform(dst, src, atEOF)
+// state machine that consumes source bytes and produces output in
+// whatever buffers it is given. TransformRange pushes a byte range
+// through one in bounded chunks and writes the result back over the
+// range as one revision, so converting a huge file never holds it, or
+// its converted copy, whole.
+//
+//   - Transformer is declared here with the x/text method set, so any
+//     transform.Transformer (and transform.Chain of them) is accepted
+//     as is, without this package importing x/text. Its short-buffer
+//     errors (transform.ErrShortDst / ErrShortSrc) are recognised by
+//     their messages for the same reason.
+//   - The range is rewritten in place as the transformer goes: each
+//     step replaces the source bytes it consumed with the bytes it
+//     produced, through one OverwriteBytes on an ephemeral process-mode
+//     cursor. A mark inside the range therefore stays near the text it
+//     was on rather than collapsing to the range's start.
+//   - Everything happens in one transaction named "transform" (nested
+//     in the caller's, if any); any transformer error rolls it back and
+//     is returned as is.
+//   - The range is in bytes; a streaming load is waited for up to end.
+
+// transformChunk is the read and initial output buffer size.
+const transformChunk = 32 << 10
+
+// Transformer is the method set of golang.org/x/text/transform's
+// Transformer (see the file comment).
+type Transformer interface {
+	Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error)
+	Reset()
+}
+
+// Messages of transform.ErrShortDst and transform.ErrShortSrc.
+const (
+	transformShortDst = "transform: short destination buffer"
+	transformShortSrc = "transform: short source buffer"
+)
+
+// TransformRange replaces bytes [start, end) with their transformation
+// by t, as one revision. Returns ErrInvalidPosition for a range outside
+// the document.
+func (g *Garland) TransformRange(start, end int64, t Transformer) (ChangeResult, error) {
+	if start < 0 || end < start {
+		return ChangeResult{}, ErrInvalidPosition
+	}
+	if err := eofIsFine(g.waitForBytePosition(context.Background(), end, -1)); err != nil {
+		return ChangeResult{}, err
+	}
+	if end > g.ByteCount().Value {
+		return ChangeResult{}, ErrInvalidPosition
+	}
+
+	if err := g.TransactionStart("transform"); err != nil {
+		return ChangeResult{}, err
+	}
+	c := g.NewEphemeralCursor()
+	defer g.RemoveCursor(c)
+	c.SetMode(CursorModeProcess)
+	if err := g.transformInto(c, start, end, t); err != nil {
+		g.TransactionRollback()
+		return ChangeResult{}, err
+	}
+	return g.TransactionCommit()
+}
+
+// transformInto runs t over [start, end), rewriting through c. Live
+// bytes [w, w+len(src)) are the source read but not yet consumed, and
+// srcEnd is the live end of the unread source.
+func (g *Garland) transformInto(c *Cursor, start, end int64, t Transformer) error {
+	t.Reset()
+	w, srcEnd := start, end
+	var src []byte
+	dst := make([]byte, transformChunk)
+	for {
+		if want := int64(max(transformChunk, 2*len(src))); int64(len(src)) < want && w+int64(len(src)) < srcEnd {
+			n := min(want-int64(len(src)), srcEnd-w-int64(len(src)))
+			more, err := g.readBytesAt(w+int64(len(src)), n)
+			if err != nil {
+				return err
+			}
+			src = append(src, more...)
+		}
+		atEOF := w+int64(len(src)) == srcEnd
+
+		nDst, nSrc, err := t.Transform(dst, src, atEOF)
+		if nDst > 0 || nSrc > 0 {
+			if _, _, err := g.overwriteBytesAt(c, w, int64(nSrc), dst[:nDst]); err != nil {
+				return err
+			}
+			w += int64(nDst)
+			srcEnd += int64(nDst - nSrc)
+			src = src[nSrc:]
+		}
+
+		switch {
+		case err == nil:
+			if atEOF && len(src) == 0 {
+				return nil
+			}
+		case err.Error() == transformShortDst:
+			if nDst == 0 && nSrc == 0 {
+				dst = make([]byte, 2*len(dst))
+			}
+		case err.Error() == transformShortSrc:
+			if atEOF {
+				return err // the transformer wants input that does not exist
+			}
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package garland
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Stand-ins for x/text's short-buffer errors (matched by message).
+var (
+	errShortDst = errors.New("transform: short destination buffer")
+	errShortSrc = errors.New("transform: short source buffer")
+)
+
+// doubler writes every byte twice, so output outgrows any dst sized like
+// its src.
+type doubler struct{}
+
+func (doubler) Reset() {}
+
+func (doubler) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if nDst+2 > len(dst) {
+			return nDst, nSrc, errShortDst
+		}
+		dst[nDst], dst[nDst+1] = src[nSrc], src[nSrc]
+		nDst += 2
+		nSrc++
+	}
+	return nDst, nSrc, nil
+}
+
+// crlf folds "\r\n" to "\n"; a trailing '\r' needs the next byte.
+type crlf struct{}
+
+func (crlf) Reset() {}
+
+func (crlf) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if nDst >= len(dst) {
+			return nDst, nSrc, errShortDst
+		}
+		b := src[nSrc]
+		if b == '\r' {
+			if nSrc+1 == len(src) && !atEOF {
+				return nDst, nSrc, errShortSrc
+			}
+			if nSrc+1 < len(src) && src[nSrc+1] == '\n' {
+				nSrc++
+				b = '\n'
+			}
+		}
+		dst[nDst] = b
+		nDst++
+		nSrc++
+	}
+	return nDst, nSrc, nil
+}
+
+func TestTransformRange(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	// Long enough for several chunks, with a "\r\n" straddling the
+	// first chunk boundary.
+	line := strings.Repeat("x", transformChunk-1) + "\r\n"
+	text := "head|" + strings.Repeat(line, 3) + "|tail"
+	g, err := lib.Open(FileOptions{DataString: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	addr := ByteAddress(int64(len(text)) - 2)
+	if _, err := g.Decorate([]DecorationEntry{{Key: "end", Address: &addr}}); err != nil {
+		t.Fatal(err)
+	}
+	rev := g.CurrentRevision()
+
+	start, end := int64(5), int64(len(text)-5)
+	if _, err := g.TransformRange(start, end, crlf{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "head|" + strings.ReplaceAll(strings.Repeat(line, 3), "\r\n", "\n") + "|tail"
+	if got := readAll(t, g); got != want {
+		t.Fatalf("crlf: len %d, want len %d", len(got), len(want))
+	}
+	if g.CurrentRevision() != rev+1 {
+		t.Errorf("revision = %d, want one new revision %d", g.CurrentRevision(), rev+1)
+	}
+	if pos, err := g.GetDecorationPosition("end"); err != nil || pos.Byte != int64(len(want))-2 {
+		t.Errorf("mark after the range = %v, %v; want byte %d", pos, err, len(want)-2)
+	}
+
+	if _, err := g.TransformRange(0, 4, doubler{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, g); !strings.HasPrefix(got, "hheeaadd|") {
+		t.Errorf("doubler: got prefix %q", got[:12])
+	}
+}
+
+func TestTransformRangeErrors(t *testing.T) {
+	g, _ := openWithRevisions(t, nil)
+	if _, err := g.TransformRange(3, 100, crlf{}); err != ErrInvalidPosition {
+		t.Errorf("past end: err = %v, want ErrInvalidPosition", err)
+	}
+	rev := g.CurrentRevision()
+	boom := errors.New("boom")
+	if _, err := g.TransformRange(0, 4, failing{boom}); err != boom {
+		t.Errorf("err = %v, want the transformer's", err)
+	}
+	if got := readAll(t, g); got != "rev0 content\n" || g.CurrentRevision() != rev {
+		t.Errorf("failed transform left %q at revision %d", got, g.CurrentRevision())
+	}
+}
+
+// failing consumes one byte, then fails.
+type failing struct{ err error }
+
+func (failing) Reset() {}
+
+func (f failing) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	dst[0] = '!'
+	return 1, 1, f.err
+}
@@ -10,6 +10,7 @@ type LeafSearchResult struct {
 	RuneOffset            int64         // rune offset from start of this leaf to target
 	LeafByteStart         int64         // absolute byte position where this leaf starts
 	LeafRuneStart         int64         // absolute rune position where this leaf starts
+	LeafLineStart         int64         // newlines before this leaf starts
 	RunesOnLineBeforeLeaf int64         // runes on current line before this leaf starts
 }
 
@@ -47,12 +48,13 @@ func (g *Garland) findLeafByByteUnlocked(pos int64) (*LeafSearchResult, error) {
 		return nil, ErrInvalidPosition
 	}
 
-	return g.findLeafByByteInternal(g.root, rootSnap, pos, 0, 0, 0)
+	return g.findLeafByByteInternal(g.root, rootSnap, pos, 0, 0, 0, 0)
 }
 
 // findLeafByByteInternal is the recursive implementation of findLeafByByte.
 // runesOnLine tracks runes on the current line before the start of the subtree we're descending into.
-func (g *Garland) findLeafByByteInternal(node *Node, snap *NodeSnapshot, pos int64, byteStart int64, runeStart int64, runesOnLine int64) (*LeafSearchResult, error) {
+func (g *Garland) findLeafByByteInternal(node *Node, snap *NodeSnapshot, pos int64, byteStart int64, runeStart int64, lineStart int64, runesOnLine int64) (*LeafSearchResult, error) {
+	g.traceVisit()
 	if snap.isLeaf {
 		// Consumers of a leaf search read snap.data (starting with the
 		// rune-offset conversion right below); a chilled leaf must be
@@ -67,6 +69,7 @@ func (g *Garland) findLeafByByteInternal(node *Node, snap *NodeSnapshot, pos int
 			RuneOffset:            byteToRuneOffset(snap.data, pos),
 			LeafByteStart:         byteStart,
 			LeafRuneStart:         runeStart,
+			LeafLineStart:         lineStart,
 			RunesOnLineBeforeLeaf: runesOnLine,
 		}, nil
 	}
@@ -86,7 +89,7 @@ func (g *Garland) findLeafByByteInternal(node *Node, snap *NodeSnapshot, pos int
 	// This ensures proper leaf boundary handling when reading across leaves
 	if pos < leftSnap.byteCount {
 		// Target is in left subtree - runesOnLine stays the same
-		return g.findLeafByByteInternal(leftNode, leftSnap, pos, byteStart, runeStart, runesOnLine)
+		return g.findLeafByByteInternal(leftNode, leftSnap, pos, byteStart, runeStart, lineStart, runesOnLine)
 	}
 
 	// Target is in right subtree
@@ -116,6 +119,7 @@ func (g *Garland) findLeafByByteInternal(node *Node, snap *NodeSnapshot, pos int
 		pos-leftSnap.byteCount,
 		byteStart+leftSnap.byteCount,
 		runeStart+leftSnap.runeCount,
+		lineStart+leftSnap.lineCount,
 		newRunesOnLine,
 	)
 }
@@ -137,6 +141,7 @@ func (g *Garland) findLeafByRuneUnlocked(pos int64) (*LeafSearchResult, error) {
 	if pos < 0 {
 		return nil, ErrInvalidPosition
 	}
+	g.ensureCountsLocked()
 
 	if g.root == nil {
 		return nil, ErrInvalidPosition
@@ -158,6 +163,7 @@ func (g *Garland) findLeafByRuneUnlocked(pos int64) (*LeafSearchResult, error) {
 // findLeafByRuneInternal is the recursive implementation of findLeafByRune.
 // runesOnLine tracks runes on the current line before the start of the subtree we're descending into.
 func (g *Garland) findLeafByRuneInternal(node *Node, snap *NodeSnapshot, pos int64, byteStart int64, runeStart int64, runesOnLine int64) (*LeafSearchResult, error) {
+	g.traceVisit()
 	if snap.isLeaf {
 		if err := g.ensureLeafDataResident(node, snap); err != nil {
 			return nil, err
@@ -246,6 +252,7 @@ func (g *Garland) findLeafByLineUnlocked(line, runeInLine int64) (*LineSearchRes
 	if line < 0 || runeInLine < 0 {
 		return nil, ErrInvalidPosition
 	}
+	g.ensureCountsLocked()
 
 	if g.root == nil {
 		return nil, ErrInvalidPosition
@@ -277,6 +284,7 @@ func (g *Garland) findLeafByLineInternal(
 	lineStart int64,
 	runesOnLine int64,
 ) (*LineSearchResult, error) {
+	g.traceVisit()
 	if snap.isLeaf {
 		if err := g.ensureLeafDataResident(node, snap); err != nil {
 			return nil, err
@@ -444,8 +452,10 @@ func (g *Garland) splitLeaf(node *Node, snap *NodeSnapshot, bytePos int64) (Node
 
 	// Partition decorations (decorations at exact split point go to the
 	// right leaf - a pure split keeps every mark in the leaf that
-	// contains its byte; insertBefore=true yields no boundary marks)
-	leftDecs, _, rightDecs := partitionDecorations(snap.decorations, splitPos, true)
+	// contains its byte; boundary marks are GravityLeft ones, already
+	// rebased to offset 0 of the right leaf)
+	leftDecs, boundaryDecs, rightDecs := partitionDecorations(snap.decorations, splitPos, true)
+	rightDecs = append(boundaryDecs, rightDecs...)
 
 	// Create left leaf
 	g.nextNodeID++
@@ -559,7 +569,9 @@ func (g *Garland) insertInternal(
 	// Navigation depends on insertBefore flag when at exact boundary:
 	// - insertBefore=false: go RIGHT (insert at start of right subtree, decorations stay)
 	// - insertBefore=true: go LEFT (insert at end of left subtree, pushing right content)
-	if insertPos < leftEnd || (insertPos == leftEnd && insertBefore) {
+	//   unless a GravityLeft mark sits at the boundary (offset 0 of the
+	//   right subtree): going right lets the leaf split keep it in place.
+	if insertPos < leftEnd || (insertPos == leftEnd && insertBefore && !g.leftGravityAtStart(snap.rightID)) {
 		// Insert into left subtree
 		newLeftID, err := g.insertInternal(leftNode, leftSnap, insertPos, offset, data, decorations, insertBefore)
 		if err != nil {
@@ -590,6 +602,32 @@ func (g *Garland) insertInternal(
 	return g.concatenate(snap.leftID, newRightID)
 }
 
+// leftGravityAtStart reports whether the subtree under id has a
+// GravityLeft mark at its first byte (offset 0 of its leftmost leaf).
+// O(depth); only consulted at exact leaf boundaries.
+func (g *Garland) leftGravityAtStart(id NodeID) bool {
+	for {
+		node := g.nodeRegistry[id]
+		if node == nil {
+			return false
+		}
+		snap := node.snapshotAt(g.currentFork, g.currentRevision)
+		if snap == nil {
+			return false
+		}
+		if !snap.isLeaf {
+			id = snap.leftID
+			continue
+		}
+		for _, d := range snap.decorations {
+			if d.Position == 0 && d.Gravity == GravityLeft {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // insertIntoLeaf handles insertion within a leaf node.
 // Returns the ID of the new subtree (which may be a single leaf or internal nodes).
 // absoluteOffset is the byte offset where this leaf starts in the document.
@@ -607,6 +645,7 @@ func (g *Garland) insertIntoLeaf(
 		absoluteDecs[i] = Decoration{
 			Key:      rd.Key,
 			Position: rd.Position,
+			Gravity:  rd.Gravity,
 		}
 	}
 
@@ -650,10 +689,12 @@ func (g *Garland) insertIntoLeaf(
 		combDecs := make([]Decoration, 0, len(leftDecs)+len(absoluteDecs)+len(rightDecs))
 		combDecs = append(combDecs, leftDecs...)
 		for _, d := range absoluteDecs {
-			combDecs = append(combDecs, Decoration{Key: d.Key, Position: d.Position + mid})
+			d.Position += mid
+			combDecs = append(combDecs, d)
 		}
 		for _, d := range rightDecs {
-			combDecs = append(combDecs, Decoration{Key: d.Key, Position: d.Position + mid + int64(len(data))})
+			d.Position += mid + int64(len(data))
+			combDecs = append(combDecs, d)
 		}
 
 		if combinedLen <= g.maxLeafSize {
@@ -677,7 +718,8 @@ func (g *Garland) insertIntoLeaf(
 			if d.Position < sp {
 				firstDecs = append(firstDecs, d)
 			} else {
-				secondDecs = append(secondDecs, Decoration{Key: d.Key, Position: d.Position - sp})
+				d.Position -= sp
+				secondDecs = append(secondDecs, d)
 			}
 		}
 		g.nextNodeID++
@@ -831,6 +873,7 @@ func (g *Garland) deleteRangeInternal(
 				*deletedDecs = append(*deletedDecs, Decoration{
 					Key:      d.Key,
 					Position: d.Position + nodeStart, // absolute position
+					Gravity:  d.Gravity,
 				})
 			}
 		}
@@ -853,6 +896,7 @@ func (g *Garland) deleteRangeInternal(
 				newDecs = append(newDecs, Decoration{
 					Key:      d.Key,
 					Position: d.Position - (localEnd - localStart),
+					Gravity:  d.Gravity,
 				})
 			}
 		}
@@ -912,9 +956,9 @@ func byteToRuneOffset(data []byte, byteOffset int64) int64 {
 		return 0
 	}
 	if byteOffset >= int64(len(data)) {
-		return int64(utf8.RuneCount(data))
+		return countRunes(data)
 	}
-	return int64(utf8.RuneCount(data[:byteOffset]))
+	return countRunes(data[:byteOffset])
 }
 
 // runeToByteOffset converts a rune offset to a byte offset within data.
@@ -1025,6 +1069,10 @@ func (g *Garland) rotateRight(nodeID NodeID) NodeID {
 		return nodeID
 	}
 
+	if g.trace.on.Load() {
+		g.trace.rotations.Add(1)
+	}
+
 	// Left's right child becomes node's new left child
 	// Left becomes new parent
 	newRightID, _ := g.concatenate(leftSnap.rightID, snap.rightID)
@@ -1049,6 +1097,10 @@ func (g *Garland) rotateLeft(nodeID NodeID) NodeID {
 		return nodeID
 	}
 
+	if g.trace.on.Load() {
+		g.trace.rotations.Add(1)
+	}
+
 	// Right's left child becomes node's new right child
 	// Right becomes new parent
 	newLeftID, _ := g.concatenate(snap.leftID, rightSnap.leftID)
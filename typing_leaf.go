@@ -0,0 +1,231 @@
+package garland
+
+import (
+	"bytes"
+	"time"
+	"unicode/utf8"
+)
+
+// typing_leaf.go - amortized O(1) keystrokes inside a typing streak.
+//
+// DESIGN: an insert rebuilds the leaf it lands in. insertIntoLeaf's
+// COALESCE step keeps the tree's shape stable by copying the whole
+// leaf (left + keystroke + right) into a fresh one, so every keystroke
+// copies and re-indexes up to 2*MaxLeafSize bytes - with the 128KB
+// default, a quarter megabyte per character typed. A typing streak
+// (each insert landing where the previous one ended) now grows a leaf
+// of its own instead:
+//
+//   - The second adjacent insert of a streak splits the leaf it lands
+//     in ONCE, into [left][T][right]. T holds the keystroke and becomes
+//     the streak's leaf.
+//   - Each further keystroke appends to T's buffer, which was allocated
+//     with spare capacity (append doubles it), and indexes only the
+//     appended bytes: the counts add up and the line starts extend (see
+//     extendLocked). The new leaf is path-copied to the root as any
+//     edit is. The cost per character is the path copy plus amortized
+//     O(1) bytes - independent of the leaf size.
+//
+// Revision semantics are untouched: insertBytesAt still records the
+// mutation, coalesces the run, moves cursors and marks, and every
+// keystroke yields an ordinary immutable snapshot. Older snapshots of
+// T share its buffer but only ever see a full-slice-capped prefix of
+// it, and bytes past the newest snapshot's length belong to no
+// snapshot, so appending into them is invisible to every revision.
+// There is nothing to flush at a checkpoint.
+//
+// RULING: the streak continues only while the tree is EXACTLY the one
+// its last keystroke produced (same root node) and the insert lands at
+// that keystroke's end. Any other edit, undo, rebalance or rollback
+// moves the root and silently ends the streak; the next insert goes
+// the ordinary way. Only plain text takes the fast path: no
+// decorations on the insert or on the leaf it splits (so no mark sits
+// at the streak's end, where gravity would have to decide), valid
+// UTF-8 of at most typingMaxInsert bytes (so counts of the appended
+// pieces add up), never while counts are deferred, and never past
+// MaxLeafSize - a streak that fills T starts over in the next one.
+
+// typingMaxInsert bounds an insert the typing streak takes: a
+// keystroke, an autocompleted word, not a paste.
+const typingMaxInsert = 64
+
+// typingInitialCap is the capacity a streak's buffer starts with.
+const typingInitialCap = 256
+
+// typingLeaf is the open typing streak; see the file comment.
+type typingLeaf struct {
+	root *Node // tree the streak's last insert produced; nil: no streak
+	end  int64 // where the next insert must land to continue it
+
+	// The streak's leaf; nil node while the streak is only a candidate
+	// (one eligible insert seen, no leaf of its own yet).
+	node  *Node
+	snap  *NodeSnapshot
+	start int64       // absolute byte start of the leaf
+	buf   []byte      // the leaf's data; spare capacity is unshared
+	lines []LineStart // the leaf's line starts; likewise
+}
+
+// typingEligible reports whether an insert may take part in a streak.
+func typingEligible(data []byte, decorations []RelativeDecoration) bool {
+	return len(data) > 0 && len(data) <= typingMaxInsert && len(decorations) == 0 && utf8.Valid(data)
+}
+
+// typeIntoLeafLocked performs the insert as the next keystroke of the
+// open streak when it is one, returning the new root. typed is false
+// when the insert must take the ordinary path (the streak, if any, is
+// dropped). Caller holds the write lock.
+func (g *Garland) typeIntoLeafLocked(pos int64, data []byte, decorations []RelativeDecoration) (root NodeID, typed bool, err error) {
+	st := &g.typing
+	if st.root == nil || st.root != g.root || pos != st.end ||
+		!typingEligible(data, decorations) || g.countsDeferred.Load() {
+		g.typing = typingLeaf{}
+		return 0, false, nil
+	}
+	if st.node == nil {
+		return g.openTypingLeafLocked(pos, data)
+	}
+	if int64(len(st.buf)+len(data)) > g.maxLeafSize || st.snap.data == nil ||
+		st.node.snapshotAt(g.currentFork, g.currentRevision) != st.snap {
+		g.typing = typingLeaf{}
+		return 0, false, nil
+	}
+	leaf := g.newTypingNodeLocked(st.extendLocked(data))
+	root, err = g.rebuildFromLeaf(&LeafSearchResult{LeafByteStart: st.start}, leaf.id)
+	if err != nil {
+		g.typing = typingLeaf{}
+		return 0, false, err
+	}
+	st.node = leaf
+	return root, true, nil
+}
+
+// noteTypingLocked records where a completed insert leaves the streak:
+// continued (or begun as a candidate) at its end, or ended. Called
+// with the new root installed.
+func (g *Garland) noteTypingLocked(pos int64, data []byte, decorations []RelativeDecoration) {
+	if !typingEligible(data, decorations) {
+		g.typing = typingLeaf{}
+		return
+	}
+	g.typing.root = g.root
+	g.typing.end = pos + int64(len(data))
+}
+
+// openTypingLeafLocked gives the streak its own leaf: the leaf holding
+// pos is split there around a new leaf holding data.
+func (g *Garland) openTypingLeafLocked(pos int64, data []byte) (NodeID, bool, error) {
+	g.typing = typingLeaf{}
+	r, err := g.findLeafByByteUnlocked(pos)
+	if err != nil {
+		return 0, false, err
+	}
+	snap := r.Snapshot
+	k := r.ByteOffset
+	if len(snap.decorations) > 0 || (k < snap.byteCount && !utf8.RuneStart(snap.data[k])) {
+		return 0, false, nil
+	}
+
+	st := typingLeaf{start: r.LeafByteStart + k, buf: make([]byte, 0, max(typingInitialCap, 2*len(data)))}
+	t := g.newTypingNodeLocked(st.extendLocked(data))
+	subtree := t.id
+	if k > 0 {
+		left := g.newTypingNodeLocked(createLeafSnapshot(snap.data[:k:k], nil, snap.originalFileOffset))
+		if subtree, err = g.concatenate(left.id, subtree); err != nil {
+			return 0, false, err
+		}
+	}
+	right := r.Node
+	if k > 0 && k < snap.byteCount {
+		orig := int64(-1)
+		if snap.originalFileOffset >= 0 {
+			orig = snap.originalFileOffset + k
+		}
+		right = g.newTypingNodeLocked(createLeafSnapshot(snap.data[k:], nil, orig))
+	}
+	if k == 0 || k < snap.byteCount {
+		// At k == 0 (the empty EOF leaf included) the leaf itself
+		// follows T unchanged.
+		if subtree, err = g.concatenate(subtree, right.id); err != nil {
+			return 0, false, err
+		}
+	}
+	root, err := g.rebuildFromLeaf(r, subtree)
+	if err != nil {
+		return 0, false, err
+	}
+	st.node = t
+	g.typing = st
+	return root, true, nil
+}
+
+// newTypingNodeLocked registers a new leaf node holding snap at the
+// current revision.
+func (g *Garland) newTypingNodeLocked(snap *NodeSnapshot) *Node {
+	g.nextNodeID++
+	g.nodeManipulations++
+	n := newNode(g.nextNodeID, g)
+	g.nodeRegistry[n.id] = n
+	n.setSnapshot(g.currentFork, g.currentRevision, snap)
+	return n
+}
+
+// extendLocked appends data to the streak's buffer and returns the
+// leaf snapshot of the result, indexing only the appended bytes. The
+// fields match createLeafSnapshot's over the same data (indexCounts'
+// rules: a line start for every newline not at the very end). data is
+// valid UTF-8, so its runes count on their own.
+func (st *typingLeaf) extendLocked(data []byte) *NodeSnapshot {
+	n := len(st.buf)
+	var runes, lines int64
+	if prev := st.snap; prev != nil {
+		runes, lines = prev.runeCount, prev.lineCount
+	}
+	st.buf = append(st.buf, data...)
+	size := len(st.buf)
+
+	ls := st.lines
+	if len(ls) == 0 {
+		ls = append(ls, LineStart{ByteOffset: 0, RuneOffset: 0})
+	}
+	if n > 0 && st.buf[n-1] == '\n' {
+		// The old last byte ended a line; now a line follows it.
+		ls = append(ls, LineStart{ByteOffset: int64(n), RuneOffset: runes})
+	}
+	prev := 0
+	for {
+		i := bytes.IndexByte(data[prev:], '\n')
+		if i < 0 {
+			break
+		}
+		nl := prev + i
+		lines++
+		runes += countRunes(data[prev : nl+1])
+		if n+nl+1 < size {
+			ls = append(ls, LineStart{ByteOffset: int64(n + nl + 1), RuneOffset: runes})
+		}
+		prev = nl + 1
+	}
+	runes += countRunes(data[prev:])
+	st.lines = ls
+
+	snap := &NodeSnapshot{
+		isLeaf:             true,
+		data:               st.buf[:size:size],
+		storageState:       StorageMemory,
+		originalFileOffset: -1,
+		byteCount:          int64(size),
+		runeCount:          runes,
+		lineCount:          lines,
+		lineStarts:         ls[:len(ls):len(ls)],
+		lastAccessTime:     time.Now(),
+	}
+	switch {
+	case lines == 0:
+		snap.runesAfterLastNewline = runes
+	case int(lines) < len(ls):
+		snap.runesAfterLastNewline = runes - ls[lines].RuneOffset
+	}
+	st.snap = snap
+	return snap
+}
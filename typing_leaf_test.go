@@ -0,0 +1,143 @@
+package garland
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTypingLeafIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pieces := []string{"a", "bc", "\n", "é", "✓\n", "x\ny\n", "𝄞", "\n\n"}
+	for run := 0; run < 50; run++ {
+		st := typingLeaf{buf: make([]byte, 0, 4)} // tiny: appends reallocate
+		var want string
+		var snaps []*NodeSnapshot
+		var wants []string
+		for k := 0; k < 40; k++ {
+			p := pieces[rng.Intn(len(pieces))]
+			want += p
+			snap := st.extendLocked([]byte(p))
+			ref := createLeafSnapshot([]byte(want), nil, -1)
+			if string(snap.data) != want || snap.byteCount != ref.byteCount || snap.runeCount != ref.runeCount ||
+				snap.lineCount != ref.lineCount || snap.runesAfterLastNewline != ref.runesAfterLastNewline ||
+				!reflect.DeepEqual(snap.lineStarts, ref.lineStarts) {
+				t.Fatalf("%q: got %d/%d/%d/%d %v, want %d/%d/%d/%d %v", want,
+					snap.byteCount, snap.runeCount, snap.lineCount, snap.runesAfterLastNewline, snap.lineStarts,
+					ref.byteCount, ref.runeCount, ref.lineCount, ref.runesAfterLastNewline, ref.lineStarts)
+			}
+			snaps = append(snaps, snap)
+			wants = append(wants, want)
+		}
+		// Appending never shows through an earlier snapshot.
+		for i, s := range snaps {
+			if string(s.data) != wants[i] || len(s.lineStarts) != len(createLeafSnapshot(s.data, nil, -1).lineStarts) {
+				t.Fatalf("snapshot %d changed: %q, want %q", i, s.data, wants[i])
+			}
+		}
+	}
+}
+
+func TestTypingLeafStreak(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	doc := strings.Repeat("héllo\nwörld\n", 60)
+	g, _ := lib.Open(FileOptions{DataString: doc, MaxLeafSize: 256})
+	defer g.Close()
+	c := g.NewCursor()
+	want := doc
+
+	typeAt := func(pos int64, text string) {
+		t.Helper()
+		if err := c.SeekByte(pos); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range text {
+			if _, err := c.InsertString(string(r), nil, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want = want[:pos] + text + want[pos:]
+	}
+	check := func(step string) {
+		t.Helper()
+		if got := readAll(t, g); got != want {
+			t.Fatalf("%s: content differs\n got %q\nwant %q", step, got, want)
+		}
+		if v := g.CheckInvariants(); v != nil {
+			t.Fatalf("%s: %v", step, v)
+		}
+		prefix := want[:c.BytePos()]
+		line, col := c.LinePos()
+		if line != int64(strings.Count(prefix, "\n")) ||
+			col != int64(utf8.RuneCountInString(prefix[strings.LastIndexByte(prefix, '\n')+1:])) {
+			t.Fatalf("%s: cursor at %d:%d", step, line, col)
+		}
+	}
+
+	// Mid-leaf, mid-line, and at the very end (the EOF leaf).
+	typeAt(301, "typed ✓ text\nmore")
+	if g.typing.node == nil {
+		t.Fatal("the streak did not get a leaf of its own")
+	}
+	check("mid-document")
+	rev := g.CurrentRevision()
+	typeAt(int64(len(want)), "tail\n")
+	check("at the end")
+
+	// A streak longer than MaxLeafSize starts over in a fresh leaf.
+	typeAt(40, strings.Repeat("0123456789\n", 30))
+	check("past MaxLeafSize")
+
+	// A decoration moves the root: the streak ends, typing still lands.
+	pos := c.BytePos()
+	addr := ByteAddress(pos)
+	if _, err := g.Decorate([]DecorationEntry{{Key: "m", Address: &addr}}); err != nil {
+		t.Fatal(err)
+	}
+	if g.typing.root == g.root {
+		t.Fatal("the streak survived a decoration")
+	}
+	typeAt(pos, "ab")
+	check("after a decoration")
+	if got, err := g.GetDecorationPosition("m"); err != nil || got.Byte != pos {
+		t.Fatalf("mark at %v (%v), want it to stay at %d", got.Byte, err, pos)
+	}
+
+	// A rolled-back transaction discards its keystrokes.
+	before := want
+	if err := g.TransactionStart("t"); err != nil {
+		t.Fatal(err)
+	}
+	typeAt(10, "rolled back")
+	if err := g.TransactionRollback(); err != nil {
+		t.Fatal(err)
+	}
+	want = before
+	check("after rollback")
+	typeAt(10, "kept")
+	check("typing after rollback")
+
+	// Earlier revisions still read as they were typed.
+	final, head := want, g.CurrentRevision()
+	if err := g.UndoSeek(rev); err != nil {
+		t.Fatal(err)
+	}
+	want = strings.Repeat("héllo\nwörld\n", 60)
+	want = want[:301] + "typed ✓ text\nmore" + want[301:]
+	c.SeekByte(0)
+	check("after undo")
+	if err := g.UndoSeek(head); err != nil {
+		t.Fatal(err)
+	}
+	want = final
+	check("after redo")
+
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatal(err)
+	}
+	check("after chill")
+	typeAt(c.BytePos(), "thawed")
+	check("typing after chill")
+}
@@ -0,0 +1,277 @@
+package garland
+
+import (
+	"strings"
+	"sync"
+)
+
+// viewport.go - a screenful of lines for terminal frontends.
+//
+// DESIGN: every TUI over a text buffer (tcell, bubbletea, a raw VT
+// loop) rebuilds the same layer: which line is at the top, how lines
+// fold into rows of the window's width, and which rows an edit made
+// stale so only those are redrawn. A Viewport is that layer, bound to
+// one Garland.
+//
+//   - Rows lays out the window from the top line: each document line
+//     becomes one row, cut at the width (truncate), or as many rows as
+//     it needs (Wrap, breaking before the rune that would overflow).
+//     Columns are display cells as visual.go counts them - tabs to the
+//     next stop, wide runes two cells - and a row's Text has its tabs
+//     expanded to spaces, so it can be drawn cell by cell as is.
+//   - The rows Rows returns are what the frontend is assumed to show.
+//     Damage compares that version with the live one - the InputEdit
+//     the two differ by, derived as WatchInputEdits derives it - and
+//     returns the screen rows that are now stale. It does not consume
+//     anything: call it before Rows in each frame, redraw the rows it
+//     names from Rows' result.
+//   - An edit that keeps the line count redraws just the rows of the
+//     lines it touched (with Wrap, only if those lines still fold into
+//     as many rows); one that adds or removes lines redraws from its
+//     first row down. An edit wholly above the window moves the top
+//     line with the text it shows, so nothing on screen is stale.
+//     Several revisions between frames are one wider edit.
+//   - Scrolling, resizing, a version the viewport cannot compare with
+//     (pruned away) and the first frame damage the whole window.
+//   - Lines are 0-based and the last line is the one after the final
+//     newline, as LineCount counts them.
+
+// ViewportOptions controls a Viewport's layout.
+type ViewportOptions struct {
+	Wrap     bool  // fold long lines into several rows (otherwise cut them)
+	TabWidth int64 // tab stop spacing; below 2 a tab is one cell
+}
+
+// ViewRow is one screen row of a Viewport.
+type ViewRow struct {
+	Line      int64  // document line
+	StartByte int64  // document byte of the row's first rune
+	EndByte   int64  // document byte after the row's last rune (newline excluded)
+	Text      string // the row's text, tabs expanded to spaces
+	Wrapped   bool   // continues the line of the row above (Wrap)
+}
+
+// DamageRegion is a run of screen rows [FromRow, ToRow) to redraw.
+type DamageRegion struct {
+	FromRow, ToRow int
+}
+
+// Viewport is a window of rows onto a Garland. It is safe for use from
+// several goroutines.
+type Viewport struct {
+	g    *Garland
+	opts ViewportOptions
+
+	mu            sync.Mutex
+	top           int64
+	width, height int
+	shown         treeState // the version layout reflects
+	layout        []ViewRow // the rows Rows last returned
+	full          bool      // the whole window is stale
+}
+
+// NewViewport returns a width x height viewport at the top of the
+// document. Sizes below 1 are taken as 1.
+func (g *Garland) NewViewport(width, height int, opts ViewportOptions) *Viewport {
+	return &Viewport{g: g, opts: opts, width: max(width, 1), height: max(height, 1), full: true}
+}
+
+// Size returns the viewport's width and height.
+func (v *Viewport) Size() (width, height int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.width, v.height
+}
+
+// SetSize resizes the viewport (sizes below 1 are taken as 1).
+func (v *Viewport) SetSize(width, height int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	width, height = max(width, 1), max(height, 1)
+	if width != v.width || height != v.height {
+		v.width, v.height, v.full = width, height, true
+	}
+}
+
+// Top returns the first line shown.
+func (v *Viewport) Top() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.top
+}
+
+// SetTop scrolls so line is the first shown, clamped to the document.
+func (v *Viewport) SetTop(line int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.g.ensureCounts()
+	v.g.mu.RLock()
+	line = min(max(line, 0), v.g.totalLines)
+	v.g.mu.RUnlock()
+	if line != v.top {
+		v.top, v.full = line, true
+	}
+}
+
+// ScrollBy moves the top line by n (negative scrolls up).
+func (v *Viewport) ScrollBy(n int64) {
+	v.SetTop(v.Top() + n)
+}
+
+// Rows lays out the window against the live version and returns its
+// rows, top to bottom; a document shorter than the window gives fewer
+// rows than its height.
+func (v *Viewport) Rows() ([]ViewRow, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	g := v.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+
+	live := g.liveStateLocked()
+	if edit, changed, ok := v.pendingLocked(live); ok && changed && edit.OldEndPoint.Row < v.top {
+		v.top += edit.NewEndPoint.Row - edit.OldEndPoint.Row
+	}
+	v.top = min(v.top, g.totalLines)
+
+	lines, err := g.readLineRangeLocked(v.top, v.top+int64(v.height)-1)
+	if err != nil {
+		return nil, err
+	}
+	res, err := g.findLeafByLineUnlocked(v.top, 0)
+	if err != nil {
+		return nil, err
+	}
+	pos := res.LineByteStart
+	var rows []ViewRow
+	for i, text := range lines {
+		rows = append(rows, v.layoutLine(v.top+int64(i), pos, strings.TrimSuffix(text, "\n"))...)
+		pos += int64(len(text))
+		if len(rows) >= v.height {
+			rows = rows[:v.height]
+			break
+		}
+	}
+	v.shown, v.layout, v.full = live, rows, false
+	return rows, nil
+}
+
+// layoutLine folds (or cuts) one line, starting at byte pos, into rows.
+func (v *Viewport) layoutLine(line, pos int64, text string) []ViewRow {
+	width := int64(v.width)
+	row := ViewRow{Line: line, StartByte: pos, EndByte: pos}
+	var rows []ViewRow
+	var b strings.Builder
+	var col, rowStart int64 // line columns: where the rune goes, where the row began
+	for i, r := range text {
+		next := visualAdvance(col, r, v.opts.TabWidth)
+		if next-rowStart > width && row.EndByte > row.StartByte {
+			if !v.opts.Wrap {
+				break
+			}
+			row.Text = b.String()
+			rows = append(rows, row)
+			row = ViewRow{Line: line, StartByte: pos + int64(i), EndByte: pos + int64(i), Wrapped: true}
+			b.Reset()
+			rowStart = col
+		}
+		if r == '\t' {
+			b.WriteString(strings.Repeat(" ", int(min(next-col, width))))
+		} else {
+			b.WriteRune(r)
+		}
+		col = next
+		row.EndByte = pos + int64(i+len(string(r)))
+	}
+	row.Text = b.String()
+	return append(rows, row)
+}
+
+// Damage returns the screen rows the live version has made stale since
+// the rows Rows last returned (see the file comment), in order; none
+// when the screen is current.
+func (v *Viewport) Damage() []DamageRegion {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	g := v.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	all := []DamageRegion{{0, v.height}}
+	if v.full {
+		return all
+	}
+	edit, changed, ok := v.pendingLocked(g.liveStateLocked())
+	if !ok {
+		return all
+	}
+	if !changed {
+		return nil
+	}
+	if edit.OldEndPoint.Row < v.top {
+		return nil // above the window: Rows moves the top with the text
+	}
+
+	// The first row of the first touched line (0 when the edit starts
+	// above the window).
+	from := len(v.layout)
+	for i, row := range v.layout {
+		if row.Line >= edit.StartPoint.Row {
+			from = i
+			break
+		}
+	}
+	if from == len(v.layout) && len(v.layout) == v.height {
+		return nil // below the window
+	}
+	if edit.NewEndPoint.Row != edit.OldEndPoint.Row {
+		return []DamageRegion{{from, v.height}}
+	}
+
+	to := from
+	for to < len(v.layout) && v.layout[to].Line <= edit.NewEndPoint.Row {
+		to++
+	}
+	if v.opts.Wrap && !v.sameFoldLocked(from, to) {
+		return []DamageRegion{{from, v.height}}
+	}
+	if to == from {
+		return nil
+	}
+	return []DamageRegion{{from, to}}
+}
+
+// pendingLocked returns the edit from the shown version to live, with
+// changed false when their text is the same; ok is false when there is
+// nothing to compare with. Caller must hold v.mu and the g.mu write
+// lock.
+func (v *Viewport) pendingLocked(live treeState) (edit InputEdit, changed, ok bool) {
+	if v.shown.root == nil {
+		return InputEdit{}, false, false
+	}
+	edit, changed, err := v.g.inputEditLocked(v.shown, live)
+	return edit, changed, err == nil
+}
+
+// sameFoldLocked reports whether the lines shown in layout rows
+// [from, to) still fold into as many rows. Caller must hold v.mu and
+// the g.mu write lock.
+func (v *Viewport) sameFoldLocked(from, to int) bool {
+	if from == to {
+		return true
+	}
+	first, last := v.layout[from].Line, v.layout[to-1].Line
+	if to == len(v.layout) {
+		return false // the last line may continue below the window
+	}
+	lines, err := v.g.readLineRangeLocked(first, last)
+	if err != nil {
+		return false
+	}
+	rows := 0
+	for i, text := range lines {
+		rows += len(v.layoutLine(first+int64(i), 0, strings.TrimSuffix(text, "\n")))
+	}
+	return rows == to-from
+}
@@ -0,0 +1,109 @@
+package garland
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func rowTexts(t *testing.T, v *Viewport) []string {
+	t.Helper()
+	rows, err := v.Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, r := range rows {
+		texts = append(texts, r.Text)
+	}
+	return texts
+}
+
+func TestViewportLayout(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "ab\tc\n0123456789\n漢字漢字\nend"})
+	defer g.Close()
+
+	v := g.NewViewport(6, 10, ViewportOptions{TabWidth: 4})
+	if got, want := rowTexts(t, v), []string{"ab  c", "012345", "漢字漢", "end"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("truncated = %q, want %q", got, want)
+	}
+
+	v = g.NewViewport(4, 10, ViewportOptions{Wrap: true, TabWidth: 4})
+	rows, _ := v.Rows()
+	var got []string
+	for _, r := range rows {
+		got = append(got, fmt.Sprintf("%d:%d-%d:%q:%v", r.Line, r.StartByte, r.EndByte, r.Text, r.Wrapped))
+	}
+	want := []string{
+		`0:0-3:"ab  ":false`, `0:3-4:"c":true`,
+		`1:5-9:"0123":false`, `1:9-13:"4567":true`, `1:13-15:"89":true`,
+		`2:16-22:"漢字":false`, `2:22-28:"漢字":true`,
+		`3:29-32:"end":false`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrapped =\n%q\nwant\n%q", got, want)
+	}
+
+	v.SetSize(4, 3)
+	v.SetTop(1)
+	if got, want := rowTexts(t, v), []string{"0123", "4567", "89"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("from line 1 = %q, want %q", got, want)
+	}
+}
+
+func TestViewportDamage(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	var lines []string
+	for i := range 20 {
+		lines = append(lines, fmt.Sprintf("line %02d", i))
+	}
+	g, _ := lib.Open(FileOptions{DataString: strings.Join(lines, "\n")})
+	defer g.Close()
+	c := g.NewCursor()
+
+	v := g.NewViewport(20, 5, ViewportOptions{})
+	if d := v.Damage(); !reflect.DeepEqual(d, []DamageRegion{{0, 5}}) {
+		t.Errorf("first frame damage = %v", d)
+	}
+	v.SetTop(10)
+	v.Rows()
+	if d := v.Damage(); d != nil {
+		t.Errorf("current screen damage = %v", d)
+	}
+
+	// Same line count: only the touched line.
+	c.SeekLine(12, 0)
+	c.InsertString("X", nil, true)
+	if d := v.Damage(); !reflect.DeepEqual(d, []DamageRegion{{2, 3}}) {
+		t.Errorf("in-line edit damage = %v", d)
+	}
+	v.Rows()
+
+	// A new line: from its row down.
+	c.InsertString("\n", nil, true)
+	if d := v.Damage(); !reflect.DeepEqual(d, []DamageRegion{{2, 5}}) {
+		t.Errorf("newline damage = %v", d)
+	}
+	v.Rows()
+
+	// Lines removed above the window: nothing stale, the top follows.
+	c.SeekLine(0, 0)
+	c.DeleteBytes(16, false) // lines 0 and 1
+	if d := v.Damage(); d != nil {
+		t.Errorf("edit above damage = %v", d)
+	}
+	if got := rowTexts(t, v); v.Top() != 8 || got[0] != "line 10" {
+		t.Errorf("after edit above: top %d, rows %q", v.Top(), got)
+	}
+
+	// Below the window, and decoration-only changes: nothing.
+	c.SeekLine(18, 0)
+	c.InsertString("\n\n", nil, true)
+	addr := ByteAddress(3)
+	g.Decorate([]DecorationEntry{{Key: "m", Address: &addr}})
+	if d := v.Damage(); d != nil {
+		t.Errorf("edit below damage = %v", d)
+	}
+}
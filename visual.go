@@ -0,0 +1,204 @@
+package garland
+
+import "unicode"
+
+// visual.go - display columns: tab stops and wide runes.
+//
+// DESIGN: a terminal frontend draws text in cells, and the cell a rune
+// starts in is not its rune index: a tab runs to the next tab stop, an
+// East Asian wide or fullwidth rune (CJK, Hangul, most emoji) takes two
+// cells, and a combining mark takes none, drawing over the cell before
+// it. Every caret, selection and hit-test on such a frontend needs that
+// mapping, so it lives here once, and everything that counts display
+// columns - VisualColumn and VisualColumnToByte, the cursor's VisualPos
+// and SeekVisualColumn, SeekLineDeltaVisual's goal column - goes
+// through visualAdvance.
+//
+//   - Widths follow the Unicode East Asian Width property (W and F are
+//     2), with nonspacing and enclosing marks and the zero-width
+//     space/joiners at 0; everything else is 1. The table is compiled
+//     in (the module has no dependencies); ambiguous-width runes count
+//     as narrow, as terminals in non-CJK locales draw them.
+//   - Columns are per line and start at 0. A tab advances to the next
+//     multiple of tabWidth; a tabWidth below 2 counts it as one column.
+//   - Mapping a column back to a byte lands on the start of the rune
+//     that covers the column, so a column inside a tab or a wide rune
+//     resolves to that rune, never past it; a column beyond the line's
+//     end resolves to the end (before the newline).
+
+// wideRunes are the East Asian Wide and Fullwidth ranges.
+var wideRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1}, {0x231a, 0x231b, 1}, {0x2329, 0x232a, 1},
+		{0x23e9, 0x23ec, 1}, {0x23f0, 0x23f0, 1}, {0x23f3, 0x23f3, 1},
+		{0x25fd, 0x25fe, 1}, {0x2614, 0x2615, 1}, {0x2648, 0x2653, 1},
+		{0x267f, 0x267f, 1}, {0x2693, 0x2693, 1}, {0x26a1, 0x26a1, 1},
+		{0x26aa, 0x26ab, 1}, {0x26bd, 0x26be, 1}, {0x26c4, 0x26c5, 1},
+		{0x26ce, 0x26ce, 1}, {0x26d4, 0x26d4, 1}, {0x26ea, 0x26ea, 1},
+		{0x26f2, 0x26f3, 1}, {0x26f5, 0x26f5, 1}, {0x26fa, 0x26fa, 1},
+		{0x26fd, 0x26fd, 1}, {0x2705, 0x2705, 1}, {0x270a, 0x270b, 1},
+		{0x2728, 0x2728, 1}, {0x274c, 0x274c, 1}, {0x274e, 0x274e, 1},
+		{0x2753, 0x2755, 1}, {0x2757, 0x2757, 1}, {0x2795, 0x2797, 1},
+		{0x27b0, 0x27b0, 1}, {0x27bf, 0x27bf, 1}, {0x2b1b, 0x2b1c, 1},
+		{0x2b50, 0x2b50, 1}, {0x2b55, 0x2b55, 1}, {0x2e80, 0x303e, 1},
+		{0x3041, 0x33ff, 1}, {0x3400, 0x4dbf, 1}, {0x4e00, 0xa4cf, 1},
+		{0xa960, 0xa97f, 1}, {0xac00, 0xd7a3, 1}, {0xf900, 0xfaff, 1},
+		{0xfe10, 0xfe19, 1}, {0xfe30, 0xfe6f, 1}, {0xff00, 0xff60, 1},
+		{0xffe0, 0xffe6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16fe0, 0x16fe4, 1}, {0x17000, 0x18aff, 1}, {0x1b000, 0x1b2ff, 1},
+		{0x1f004, 0x1f004, 1}, {0x1f0cf, 0x1f0cf, 1}, {0x1f18e, 0x1f18e, 1},
+		{0x1f191, 0x1f19a, 1}, {0x1f200, 0x1f202, 1}, {0x1f210, 0x1f23b, 1},
+		{0x1f240, 0x1f248, 1}, {0x1f250, 0x1f251, 1}, {0x1f260, 0x1f265, 1},
+		{0x1f300, 0x1f320, 1}, {0x1f32d, 0x1f335, 1}, {0x1f337, 0x1f37c, 1},
+		{0x1f37e, 0x1f393, 1}, {0x1f3a0, 0x1f3ca, 1}, {0x1f3cf, 0x1f3d3, 1},
+		{0x1f3e0, 0x1f3f0, 1}, {0x1f3f4, 0x1f3f4, 1}, {0x1f3f8, 0x1f43e, 1},
+		{0x1f440, 0x1f440, 1}, {0x1f442, 0x1f4fc, 1}, {0x1f4ff, 0x1f53d, 1},
+		{0x1f54b, 0x1f54e, 1}, {0x1f550, 0x1f567, 1}, {0x1f57a, 0x1f57a, 1},
+		{0x1f595, 0x1f596, 1}, {0x1f5a4, 0x1f5a4, 1}, {0x1f5fb, 0x1f64f, 1},
+		{0x1f680, 0x1f6c5, 1}, {0x1f6cc, 0x1f6cc, 1}, {0x1f6d0, 0x1f6d2, 1},
+		{0x1f6d5, 0x1f6d7, 1}, {0x1f6eb, 0x1f6ec, 1}, {0x1f6f4, 0x1f6fc, 1},
+		{0x1f7e0, 0x1f7eb, 1}, {0x1f90c, 0x1f93a, 1}, {0x1f93c, 0x1f945, 1},
+		{0x1f947, 0x1f9ff, 1}, {0x1fa70, 0x1faff, 1}, {0x20000, 0x2fffd, 1},
+		{0x30000, 0x3fffd, 1},
+	},
+}
+
+// runeWidth returns how many display cells r takes (a tab aside).
+func runeWidth(r rune) int64 {
+	switch {
+	case r < 0x300:
+		return 1 // Latin, the common case
+	case r >= 0x200b && r <= 0x200d, unicode.In(r, unicode.Mn, unicode.Me):
+		return 0
+	case unicode.Is(wideRunes, r):
+		return 2
+	}
+	return 1
+}
+
+// visualAdvance returns the display column after rune r drawn at col.
+func visualAdvance(col int64, r rune, tabWidth int64) int64 {
+	if r == '\t' {
+		if tabWidth > 1 {
+			return (col/tabWidth + 1) * tabWidth
+		}
+		return col + 1
+	}
+	return col + runeWidth(r)
+}
+
+// visualWidth returns the display width of text.
+func visualWidth(text []byte, tabWidth int64) int64 {
+	var col int64
+	for _, r := range string(text) {
+		col = visualAdvance(col, r, tabWidth)
+	}
+	return col
+}
+
+// visualOffset returns the byte offset in text of the rune covering
+// display column col (len(text) past the end), with the column and rune
+// index that rune starts at.
+func visualOffset(text []byte, col, tabWidth int64) (offset int, at, runes int64) {
+	for i, r := range string(text) {
+		next := visualAdvance(at, r, tabWidth)
+		if next > col {
+			return i, at, runes
+		}
+		at = next
+		runes++
+	}
+	return len(text), at, runes
+}
+
+// VisualColumn returns the line of a byte position and its display
+// column there, with tabs to multiples of tabWidth and wide runes two
+// columns.
+func (g *Garland) VisualColumn(bytePos, tabWidth int64) (line, col int64, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	if bytePos < 0 || bytePos > g.totalBytes {
+		return 0, 0, ErrInvalidPosition
+	}
+	line, _, err = g.byteToLineRuneInternalUnlocked(bytePos)
+	if err != nil {
+		return 0, 0, err
+	}
+	start, text, err := g.lineTextLocked(line)
+	if err != nil {
+		return 0, 0, err
+	}
+	return line, visualWidth(text[:bytePos-start], tabWidth), nil
+}
+
+// VisualColumnToByte returns the byte position of display column col on
+// line: the start of the rune covering it, or the line's end when col
+// lies beyond it.
+func (g *Garland) VisualColumnToByte(line, col, tabWidth int64) (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	if line < 0 || line > g.totalLines {
+		return 0, ErrInvalidPosition
+	}
+	start, text, err := g.lineTextLocked(line)
+	if err != nil {
+		return 0, err
+	}
+	offset, _, _ := visualOffset(text, col, tabWidth)
+	return start + int64(offset), nil
+}
+
+// VisualPos returns the cursor's line and display column, counting any
+// virtual columns (see VisualColumn).
+func (c *Cursor) VisualPos(tabWidth int64) (line, col int64, err error) {
+	if c.detached() {
+		return 0, 0, ErrCursorNotFound
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	c.resolveStaleLineRuneLocked()
+	start, text, err := g.lineTextLocked(c.line)
+	if err != nil {
+		return 0, 0, err
+	}
+	return c.line, visualWidth(text[:c.bytePos-start], tabWidth) + c.virtualCol, nil
+}
+
+// SeekVisualColumn moves the cursor to display column col of its line:
+// onto the rune covering the column, or to the line's end when col lies
+// beyond it (in virtual space there, when enabled).
+func (c *Cursor) SeekVisualColumn(col, tabWidth int64) error {
+	if c.detached() {
+		return ErrCursorNotFound
+	}
+	if col < 0 {
+		return ErrInvalidPosition
+	}
+	g := c.garland
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ensureCountsLocked()
+	c.resolveStaleLineRuneLocked()
+	line := c.line
+	start, text, err := g.lineTextLocked(line)
+	if err != nil {
+		return err
+	}
+	offset, at, runes := visualOffset(text, col, tabWidth)
+	pos := start + int64(offset)
+	runePos, err := g.byteToRuneInternalUnlocked(pos)
+	if err != nil {
+		return err
+	}
+	c.updatePosition(pos, runePos, line, runes)
+	if c.virtualSpace && offset == len(text) {
+		c.virtualCol = col - at
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package garland
+
+import "testing"
+
+func TestVisualColumnConversions(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	// "日本" is two wide runes; "é" is e plus a combining accent.
+	g, _ := lib.Open(FileOptions{DataString: "a\t日本éx\nsecond"})
+	defer g.Close()
+
+	want := []struct{ pos, col int64 }{
+		{0, 0}, {1, 1}, {2, 4}, {5, 6}, {8, 8}, {9, 9}, {11, 9}, {12, 10},
+	}
+	for _, w := range want {
+		if line, col, err := g.VisualColumn(w.pos, 4); err != nil || line != 0 || col != w.col {
+			t.Errorf("VisualColumn(%d) = %d:%d, %v; want 0:%d", w.pos, line, col, err, w.col)
+		}
+	}
+	back := []struct{ col, pos int64 }{
+		{0, 0}, {2, 1}, {4, 2}, {5, 2}, {6, 5}, {8, 8}, {9, 11}, {10, 12}, {40, 12},
+	}
+	for _, b := range back {
+		if pos, err := g.VisualColumnToByte(0, b.col, 4); err != nil || pos != b.pos {
+			t.Errorf("VisualColumnToByte(0, %d) = %d, %v; want %d", b.col, pos, err, b.pos)
+		}
+	}
+	if line, col, _ := g.VisualColumn(16, 4); line != 1 || col != 3 {
+		t.Errorf("second line: %d:%d", line, col)
+	}
+}
+
+func TestCursorVisualPos(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "\t漢字z\nab"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	if err := c.SeekVisualColumn(11, 8); err != nil {
+		t.Fatal(err)
+	}
+	if line, col, _ := c.VisualPos(8); line != 0 || col != 10 || c.BytePos() != 4 {
+		t.Errorf("inside a wide rune: %d:%d byte %d, want 0:10 byte 4", line, col, c.BytePos())
+	}
+	c.SeekLine(1, 0)
+	c.SetVirtualSpace(true)
+	c.SeekVisualColumn(5, 8)
+	if line, col, _ := c.VisualPos(8); line != 1 || col != 5 || c.VirtualColumn() != 3 {
+		t.Errorf("virtual: %d:%d virtual %d", line, col, c.VirtualColumn())
+	}
+
+	// Vertical motion keeps display columns across wide runes.
+	c.SetVirtualSpace(false)
+	c.SeekLine(1, 2)
+	c.SeekLineDeltaVisual(-1, 8)
+	if line, col, _ := c.VisualPos(8); line != 0 || col != 0 {
+		t.Errorf("up from 1:2 lands at %d:%d, want 0:0 (inside the tab)", line, col)
+	}
+}
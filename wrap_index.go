@@ -0,0 +1,323 @@
+package garland
+
+import (
+	"strings"
+	"sync"
+)
+
+// wrap_index.go - logical lines <-> soft-wrapped visual rows.
+//
+// DESIGN: a word-wrapping editor needs, all the time, how many screen
+// rows the document takes (scrollbar, page down) and which row a line
+// and column land on (caret, mouse). Both depend on every line's
+// wrapping, which is too slow to recompute per keystroke on a large
+// document and wrong the moment it is cached naively. A WrapIndex
+// caches each line's row breaks and drops only the entries an edit
+// touched.
+//
+//   - Lines wrap at word boundaries: a row breaks after the last blank
+//     that fits, or, in a word longer than the row, before the rune
+//     that would overflow. Columns are display cells as visual.go
+//     counts them (tab stops from the line's start, wide runes two
+//     cells), the same as Viewport's.
+//   - With Markdown set, the rows a list item or block quote continues
+//     onto are indented to its text - the width of the leading blanks
+//     and markers ("- ", "12. ", "> ") - the hanging indent Markdown
+//     renderers draw. Each line is laid out on its own, so this stays
+//     incremental (a fence's code lines wrap like any other).
+//   - Invalidation is pulled, as Viewport's damage is: each call derives
+//     the InputEdit from the version the index reflects to the live one
+//     and splices fresh, unknown entries over the lines it touched.
+//     Several revisions between calls are one wider edit; a version the
+//     index cannot compare with (pruned away), or new options, clear it.
+//   - Unknown lines are laid out when a call needs them - VisualRowCount
+//     needs all of them, the conversions those up to their line - so
+//     the cost after an edit is the touched lines, plus an integer scan
+//     over the cached counts.
+//   - Lines are 0-based and the last line is the one after the final
+//     newline, as LineCount counts them; an empty line is one row.
+
+// WrapOptions controls how a WrapIndex wraps lines.
+type WrapOptions struct {
+	Width    int64 // row width in display cells; below 1 means 1
+	TabWidth int64 // tab stop spacing; below 2 a tab is one cell
+	Markdown bool  // hanging indent for list items and block quotes
+}
+
+// wrapRow is where a visual row starts within its line.
+type wrapRow struct {
+	byteOff int64 // byte offset in the line
+	col     int64 // display column in the line
+}
+
+// wrapLine is one line's cached layout; nil rows means not laid out.
+type wrapLine struct {
+	rows   []wrapRow
+	width  int64 // display width of the whole line
+	indent int64 // continuation rows' indent
+}
+
+// WrapIndex maps a Garland's lines to soft-wrapped rows. It is safe for
+// use from several goroutines.
+type WrapIndex struct {
+	g *Garland
+
+	mu    sync.Mutex
+	opts  WrapOptions
+	state treeState  // the version lines reflects
+	lines []wrapLine // one per document line
+}
+
+// NewWrapIndex returns a wrap index over g.
+func (g *Garland) NewWrapIndex(opts WrapOptions) *WrapIndex {
+	opts.Width = max(opts.Width, 1)
+	return &WrapIndex{g: g, opts: opts}
+}
+
+// Options returns the index's options.
+func (w *WrapIndex) Options() WrapOptions {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.opts
+}
+
+// SetOptions changes the wrapping (a new width on resize); every line
+// is laid out again as needed.
+func (w *WrapIndex) SetOptions(opts WrapOptions) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	opts.Width = max(opts.Width, 1)
+	if opts != w.opts {
+		w.opts, w.lines = opts, nil
+	}
+}
+
+// VisualRowCount returns the number of rows the whole document takes.
+func (w *WrapIndex) VisualRowCount() (int64, error) {
+	var n int64
+	err := w.do(func() error {
+		if err := w.layoutLocked(0, int64(len(w.lines))-1); err != nil {
+			return err
+		}
+		for _, l := range w.lines {
+			n += int64(len(l.rows))
+		}
+		return nil
+	})
+	return n, err
+}
+
+// LineRows returns the number of rows line takes.
+func (w *WrapIndex) LineRows(line int64) (int64, error) {
+	var n int64
+	err := w.do(func() error {
+		if line < 0 || line >= int64(len(w.lines)) {
+			return ErrInvalidPosition
+		}
+		if err := w.layoutLocked(line, line); err != nil {
+			return err
+		}
+		n = int64(len(w.lines[line].rows))
+		return nil
+	})
+	return n, err
+}
+
+// LogicalToVisual returns the row, and the column in that row, of
+// display column col of line. A column past the line's end is on its
+// last row.
+func (w *WrapIndex) LogicalToVisual(line, col int64) (row, rowCol int64, err error) {
+	err = w.do(func() error {
+		if line < 0 || line >= int64(len(w.lines)) || col < 0 {
+			return ErrInvalidPosition
+		}
+		if err := w.layoutLocked(0, line); err != nil {
+			return err
+		}
+		for _, l := range w.lines[:line] {
+			row += int64(len(l.rows))
+		}
+		l := w.lines[line]
+		i := len(l.rows) - 1
+		for i > 0 && l.rows[i].col > col {
+			i--
+		}
+		row += int64(i)
+		rowCol = col - l.rows[i].col
+		if i > 0 {
+			rowCol += l.indent
+		}
+		return nil
+	})
+	return row, rowCol, err
+}
+
+// VisualToLogical returns the line and display column that row and
+// rowCol show. A column past the row's end (or inside a hanging
+// indent) clamps to the row's text; a row past the last is
+// ErrInvalidPosition.
+func (w *WrapIndex) VisualToLogical(row, rowCol int64) (line, col int64, err error) {
+	err = w.do(func() error {
+		if row < 0 || rowCol < 0 {
+			return ErrInvalidPosition
+		}
+		for line = 0; line < int64(len(w.lines)); line++ {
+			if err := w.layoutLocked(line, line); err != nil {
+				return err
+			}
+			l := w.lines[line]
+			if row >= int64(len(l.rows)) {
+				row -= int64(len(l.rows))
+				continue
+			}
+			r := l.rows[row]
+			if row > 0 {
+				rowCol = max(rowCol-l.indent, 0)
+			}
+			end := l.width
+			if row+1 < int64(len(l.rows)) {
+				end = l.rows[row+1].col - 1 // the last cell of the row
+			}
+			col = min(r.col+rowCol, max(end, r.col))
+			return nil
+		}
+		return ErrInvalidPosition
+	})
+	return line, col, err
+}
+
+// do brings the index up to the live version and runs fn, with w.mu and
+// the g.mu write lock held.
+func (w *WrapIndex) do(fn func() error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g := w.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	w.syncLocked()
+	return fn()
+}
+
+// syncLocked drops the entries of lines changed since the version the
+// index reflects. Caller must hold w.mu and the g.mu write lock.
+func (w *WrapIndex) syncLocked() {
+	g := w.g
+	g.ensureCountsLocked()
+	live := g.liveStateLocked()
+	n := int(g.totalLines + 1)
+	if w.lines != nil && w.state.root != nil {
+		edit, changed, err := g.inputEditLocked(w.state, live)
+		switch {
+		case err != nil:
+			w.lines = nil
+		case changed:
+			from, to := int(edit.StartPoint.Row), int(edit.OldEndPoint.Row)+1
+			fresh := make([]wrapLine, edit.NewEndPoint.Row-edit.StartPoint.Row+1)
+			if to <= len(w.lines) {
+				w.lines = append(w.lines[:from:from], append(fresh, w.lines[to:]...)...)
+			} else {
+				w.lines = nil
+			}
+		}
+	}
+	if len(w.lines) != n {
+		w.lines = make([]wrapLine, n) // first use, or out of step: start over
+	}
+	w.state = live
+}
+
+// layoutLocked lays out the unknown lines among [first, last]. Caller
+// must hold w.mu and the g.mu write lock.
+func (w *WrapIndex) layoutLocked(first, last int64) error {
+	const chunk = 1024 // lines read at once
+	for first <= last {
+		if w.lines[first].rows != nil {
+			first++
+			continue
+		}
+		end := first
+		for end < last && end-first < chunk-1 && w.lines[end+1].rows == nil {
+			end++
+		}
+		texts, err := w.g.readLineRangeLocked(first, end)
+		if err != nil {
+			return err
+		}
+		for i, text := range texts {
+			w.lines[first+int64(i)] = w.layoutLine(strings.TrimSuffix(text, "\n"))
+		}
+		first = end + 1
+	}
+	return nil
+}
+
+// layoutLine breaks one line's text into rows.
+func (w *WrapIndex) layoutLine(text string) wrapLine {
+	l := wrapLine{rows: []wrapRow{{}}}
+	if w.opts.Markdown {
+		l.indent = markdownIndent(text, w.opts.TabWidth)
+		if l.indent >= w.opts.Width {
+			l.indent = 0
+		}
+	}
+	var col int64
+	row := &l.rows[0]
+	room := w.opts.Width
+	brk := wrapRow{byteOff: -1} // the last break opportunity in the row
+	for i, r := range text {
+		next := visualAdvance(col, r, w.opts.TabWidth)
+		if next-row.col > room && col > row.col {
+			start := wrapRow{byteOff: int64(i), col: col}
+			if brk.byteOff > row.byteOff && next-brk.col <= w.opts.Width-l.indent {
+				start = brk
+			}
+			l.rows = append(l.rows, start)
+			row = &l.rows[len(l.rows)-1]
+			room = w.opts.Width - l.indent
+			brk = wrapRow{byteOff: -1}
+		}
+		if r == ' ' || r == '\t' {
+			brk = wrapRow{byteOff: int64(i + 1), col: next}
+		}
+		col = next
+	}
+	l.width = col
+	return l
+}
+
+// markdownIndent returns the display width of a line's leading blanks
+// and list or block-quote markers.
+func markdownIndent(text string, tabWidth int64) int64 {
+	i := 0
+	for i < len(text) {
+		j := i
+		for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+			j++
+		}
+		k := j
+		switch {
+		case k < len(text) && strings.IndexByte("-*+", text[k]) >= 0:
+			k++
+		case k < len(text) && text[k] == '>':
+			k++
+			if k < len(text) && text[k] == ' ' {
+				k++
+			}
+			i = k
+			continue
+		default:
+			for k < len(text) && text[k] >= '0' && text[k] <= '9' {
+				k++
+			}
+			if k == j || k == len(text) || (text[k] != '.' && text[k] != ')') {
+				return visualWidth([]byte(text[:i]), tabWidth)
+			}
+			k++
+		}
+		if k >= len(text) || text[k] != ' ' {
+			break // "-foo", "*emphasis*": not a marker
+		}
+		i = k + 1
+	}
+	return visualWidth([]byte(text[:i]), tabWidth)
+}
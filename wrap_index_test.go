@@ -0,0 +1,79 @@
+package garland
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrapIndexLayout(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "the quick brown fox\n\nabcdefghijkl\n- list item text"})
+	defer g.Close()
+
+	w := g.NewWrapIndex(WrapOptions{Width: 10, Markdown: true})
+	rows := func() []int64 {
+		var got []int64
+		for line := range int64(4) {
+			n, err := w.LineRows(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, n)
+		}
+		return got
+	}
+	if got, want := rows(), []int64{2, 1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("line rows = %v, want %v", got, want)
+	}
+	if n, _ := w.VisualRowCount(); n != 8 {
+		t.Errorf("VisualRowCount = %d, want 8", n)
+	}
+
+	// "the quick " | "brown fox": column 12 ("o") is row 1, column 2.
+	if row, col, _ := w.LogicalToVisual(0, 12); row != 1 || col != 2 {
+		t.Errorf("LogicalToVisual(0, 12) = %d, %d", row, col)
+	}
+	if line, col, _ := w.VisualToLogical(1, 2); line != 0 || col != 12 {
+		t.Errorf("VisualToLogical(1, 2) = %d, %d", line, col)
+	}
+	// "- list " | "  item " | "  text": the hanging indent.
+	if row, col, _ := w.LogicalToVisual(3, 7); row != 6 || col != 2 {
+		t.Errorf("LogicalToVisual(3, 7) = %d, %d", row, col)
+	}
+	if line, col, _ := w.VisualToLogical(6, 0); line != 3 || col != 7 {
+		t.Errorf("VisualToLogical(6, 0) = %d, %d", line, col)
+	}
+	if _, _, err := w.VisualToLogical(8, 0); err != ErrInvalidPosition {
+		t.Errorf("row past the end: %v", err)
+	}
+}
+
+func TestWrapIndexEdits(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "aaaa\nbbbb\ncccc"})
+	defer g.Close()
+	c := g.NewCursor()
+
+	w := g.NewWrapIndex(WrapOptions{Width: 4})
+	if n, _ := w.VisualRowCount(); n != 3 {
+		t.Fatalf("VisualRowCount = %d, want 3", n)
+	}
+
+	c.SeekLine(1, 4)
+	c.InsertString("bbbb", nil, true)
+	if n, _ := w.VisualRowCount(); n != 4 {
+		t.Errorf("after lengthening a line: %d rows, want 4", n)
+	}
+	c.InsertString("\nxx\n", nil, true)
+	if n, _ := w.VisualRowCount(); n != 6 {
+		t.Errorf("after adding lines: %d rows, want 6", n)
+	}
+	if line, col, _ := w.VisualToLogical(3, 1); line != 2 || col != 1 {
+		t.Errorf("VisualToLogical(3, 1) = %d, %d", line, col)
+	}
+
+	w.SetOptions(WrapOptions{Width: 20})
+	if n, _ := w.VisualRowCount(); n != 5 {
+		t.Errorf("after widening: %d rows, want 5", n)
+	}
+}
@@ -0,0 +1,279 @@
+package garland
+
+import "sync"
+
+// writeback.go - asynchronous write-behind for cold storage.
+//
+// DESIGN: chillSnapshot normally calls ColdStorageInterface.Set inline,
+// on the mutation / maintenance path, while holding the garland lock.
+// With a slow backend (network storage, a busy disk) every chill is a
+// latency spike for whoever triggered it. When
+// LibraryOptions.ColdWriteBackQueue is set, chillSnapshot instead hands
+// the block to a library-wide worker goroutine through a BOUNDED queue
+// and returns at once.
+//
+// DURABILITY BARRIER: a snapshot does NOT become StorageCold when its
+// write is queued. It stays StorageMemory - data resident, readable,
+// and counted in memory usage - with writeBackPending set. Only after
+// the backend has accepted every block (data and decorations) does the
+// worker take the garland lock and perform the transition: drop the
+// data, flip to StorageCold, release the memory. So there is never a
+// moment where the only copy of a block sits in a queue; a failed write
+// simply leaves the snapshot in memory (a later chill may retry).
+//
+// BACKPRESSURE: the queue never blocks the chill path (it runs under
+// the garland lock, and the worker needs that lock to finish a job).
+// When the queue is full, chillSnapshot falls back to the synchronous
+// write - latency degrades to the old behaviour, never worse.
+//
+// Memory-limit accounting: bytes still in flight will be released
+// shortly, so the limit checks (ChillToTarget, CheckMemoryPressure, the
+// maintenance tick) subtract them rather than chilling further leaves
+// to cover memory that is already on its way out.
+
+// ColdWriteBackStats reports the write-behind queue's standing.
+type ColdWriteBackStats struct {
+	Enabled       bool  // a write-behind queue is configured
+	Pending       int   // blocks queued or being written
+	PendingBytes  int64 // leaf bytes those blocks will release
+	Written       int64 // blocks written and transitioned to cold
+	Failed        int64 // blocks whose write failed (left in memory)
+	SyncFallbacks int64 // chills written inline because the queue was full
+}
+
+// writeBackJob is one snapshot on its way to cold storage. data is the
+// snapshot's own slice (snapshots are immutable, so it is shared, not
+// copied); decs is the encoded decoration block, nil when there are
+// none.
+type writeBackJob struct {
+	g       *Garland
+	nodeID  NodeID
+	forkRev ForkRevision
+	snap    *NodeSnapshot
+	data    []byte
+	decs    []byte
+	prev    int64 // quota charge replaced by this write (for refunds)
+}
+
+// writeBackQueue is the library-wide write-behind worker.
+type writeBackQueue struct {
+	backend ColdStorageInterface
+	jobs    chan writeBackJob
+
+	mu           sync.Mutex
+	idle         *sync.Cond // signalled whenever pending drops
+	pending      int
+	pendingBytes int64
+	written      int64
+	failed       int64
+	fallbacks    int64
+	firstErr     error // first failure since the last flush
+	closed       bool  // stop ran; every chill is synchronous again
+
+	wg sync.WaitGroup
+}
+
+// newWriteBackQueue creates the queue and starts its worker.
+func newWriteBackQueue(backend ColdStorageInterface, depth int) *writeBackQueue {
+	q := &writeBackQueue{
+		backend: backend,
+		jobs:    make(chan writeBackJob, depth),
+	}
+	q.idle = sync.NewCond(&q.mu)
+	q.wg.Add(1)
+	go q.run()
+	return q
+}
+
+// enqueue offers a job to the worker without blocking. Returns false
+// when the queue is full (the caller writes synchronously instead).
+func (q *writeBackQueue) enqueue(job writeBackJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- job:
+		q.pending++
+		q.pendingBytes += int64(len(job.data))
+		return true
+	default:
+		q.fallbacks++
+		return false
+	}
+}
+
+// run is the worker goroutine: write each block, then complete the
+// transition under the owning garland's lock.
+func (q *writeBackQueue) run() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		blockName := formatBlockName(job.nodeID, job.forkRev)
+		err := q.backend.Set(job.g.id, blockName, job.data)
+		if err == nil && job.decs != nil {
+			err = q.backend.Set(job.g.id, blockName+".dec", job.decs)
+		}
+
+		job.g.mu.Lock()
+		job.g.completeWriteBackLocked(job, err)
+		job.g.mu.Unlock()
+
+		q.mu.Lock()
+		q.pending--
+		q.pendingBytes -= int64(len(job.data))
+		if err != nil {
+			q.failed++
+			if q.firstErr == nil {
+				q.firstErr = err
+			}
+		} else {
+			q.written++
+		}
+		q.idle.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+// flush waits until every queued block has been written (or failed)
+// and returns the first failure since the previous flush.
+func (q *writeBackQueue) flush() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.pending > 0 {
+		q.idle.Wait()
+	}
+	err := q.firstErr
+	q.firstErr = nil
+	return err
+}
+
+// inFlightBytes reports the leaf bytes queued for release.
+func (q *writeBackQueue) inFlightBytes() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pendingBytes
+}
+
+// stop drains the queue and ends the worker. Later chills fall back
+// to synchronous writes.
+func (q *writeBackQueue) stop() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.jobs)
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// enqueueWriteBackLocked hands a snapshot (and its encoded decoration
+// block, nil if none) to the write-behind worker. Returns false when
+// write-behind is disabled or the queue is full; the caller then
+// performs the synchronous write. Caller must hold the write lock.
+func (g *Garland) enqueueWriteBackLocked(nodeID NodeID, forkRev ForkRevision, snap *NodeSnapshot, decs []byte, prevCharge int64) bool {
+	q := g.lib.writeBack
+	if q == nil {
+		return false
+	}
+	job := writeBackJob{g: g, nodeID: nodeID, forkRev: forkRev, snap: snap,
+		data: snap.data, decs: decs, prev: prevCharge}
+	if !q.enqueue(job) {
+		return false
+	}
+	snap.writeBackPending = true
+	return true
+}
+
+// completeWriteBackLocked is the durability barrier: the blocks are in
+// the backend, so the snapshot may now drop its data and become cold.
+// Skipped when the snapshot moved on meanwhile (lost, replaced data);
+// on a failed write the snapshot simply stays in memory and the quota
+// charge is refunded, and blocks whose charge was released while they
+// were queued are deleted (see coldquota.go). Caller must hold the
+// write lock.
+func (g *Garland) completeWriteBackLocked(job writeBackJob, err error) {
+	blockName := formatBlockName(job.nodeID, job.forkRev)
+	if err != nil {
+		g.refundColdLocked(blockName, job.prev)
+	} else if _, charged := g.coldCharges[blockName]; !charged {
+		// Released while queued (GC dropped the snapshot, or Close):
+		// nothing will ever read these blocks
+		job.snap.writeBackPending = false
+		g.deleteColdBlocksLocked(blockName)
+		if g.coldClosed {
+			_ = g.lib.coldStorageBackend.DeleteFolder(g.id)
+		}
+		return
+	}
+	snap := job.snap
+	if !snap.writeBackPending {
+		return
+	}
+	snap.writeBackPending = false
+	if err != nil || snap.storageState != StorageMemory || !sameBacking(snap.data, job.data) {
+		return
+	}
+	snap.data = nil
+	if job.decs != nil {
+		snap.decorations = nil
+	}
+	snap.storageState = StorageCold
+	g.updateMemoryTracking(-int64(len(job.data)))
+	g.tierStats.chills++
+}
+
+// sameBacking reports whether two slices are the same view of the same
+// array (a snapshot whose data was replaced while its write was queued
+// must not be evicted on the strength of the OLD block).
+func sameBacking(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return len(a) == 0 || &a[0] == &b[0]
+}
+
+// FlushColdWrites is the explicit durability barrier for the
+// write-behind queue: it waits until every queued block has reached
+// cold storage (or failed) and returns the first write failure since
+// the previous flush. A no-op returning nil when write-behind is not
+// configured. Must not be called while holding a garland's lock (the
+// worker needs it to finish each block).
+func (lib *Library) FlushColdWrites() error {
+	if lib.writeBack == nil {
+		return nil
+	}
+	return lib.writeBack.flush()
+}
+
+// ColdWriteBackStats reports the write-behind queue's current standing.
+func (lib *Library) ColdWriteBackStats() ColdWriteBackStats {
+	q := lib.writeBack
+	if q == nil {
+		return ColdWriteBackStats{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return ColdWriteBackStats{
+		Enabled:       true,
+		Pending:       q.pending,
+		PendingBytes:  q.pendingBytes,
+		Written:       q.written,
+		Failed:        q.failed,
+		SyncFallbacks: q.fallbacks,
+	}
+}
+
+// projectedMemoryUsage is TotalMemoryUsage minus the bytes the
+// write-behind queue is about to release - the figure the memory-limit
+// checks compare against, so in-flight chills are not chilled for
+// twice.
+func (lib *Library) projectedMemoryUsage() int64 {
+	total := lib.TotalMemoryUsage()
+	if lib.writeBack != nil {
+		total -= lib.writeBack.inFlightBytes()
+	}
+	return total
+}
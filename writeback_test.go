@@ -0,0 +1,188 @@
+package garland
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// gatedColdStorage wraps a backend; Set blocks until the gate opens and
+// can be told to fail.
+type gatedColdStorage struct {
+	inner ColdStorageInterface
+	gate  chan struct{}
+
+	mu   sync.Mutex
+	fail bool
+	sets int
+}
+
+func (s *gatedColdStorage) Set(folder, block string, data []byte) error {
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sets++
+	if s.fail {
+		return errors.New("backend unavailable")
+	}
+	return s.inner.Set(folder, block, data)
+}
+
+func (s *gatedColdStorage) Get(folder, block string) ([]byte, error) {
+	return s.inner.Get(folder, block)
+}
+
+func (s *gatedColdStorage) Delete(folder, block string) error {
+	return s.inner.Delete(folder, block)
+}
+
+func (s *gatedColdStorage) DeleteFolder(folder string) error {
+	return s.inner.DeleteFolder(folder)
+}
+
+func countLeavesByState(g *Garland) (mem, cold, pending int) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, node := range g.nodeRegistry {
+		for _, snap := range node.history {
+			if !snap.isLeaf || snap.byteCount == 0 {
+				continue
+			}
+			if snap.writeBackPending {
+				pending++
+			}
+			switch snap.storageState {
+			case StorageMemory:
+				mem++
+			case StorageCold:
+				cold++
+			}
+		}
+	}
+	return
+}
+
+func TestWriteBackDefersColdTransition(t *testing.T) {
+	backend := &gatedColdStorage{
+		inner: newFSColdStorage(&localFileSystem{}, t.TempDir()),
+		gate:  make(chan struct{}),
+	}
+	lib, _ := Init(LibraryOptions{ColdStorageBackend: backend, ColdWriteBackQueue: 16})
+	defer lib.Close()
+
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatalf("Chill: %v", err)
+	}
+
+	// Writes are stalled: nothing may be cold yet, and the data must
+	// still be readable from memory.
+	mem, cold, pending := countLeavesByState(g)
+	if cold != 0 || pending == 0 || mem != pending {
+		t.Fatalf("before flush: mem=%d cold=%d pending=%d", mem, cold, pending)
+	}
+	if got := g.MemoryUsage().MemoryBytes; got != 11 {
+		t.Errorf("MemoryBytes before flush = %d, want 11", got)
+	}
+	data, err := g.NewCursor().ReadBytes(11)
+	if err != nil || string(data) != "Hello World" {
+		t.Errorf("read during pending write: %q, %v", data, err)
+	}
+	if st := lib.ColdWriteBackStats(); !st.Enabled || st.Pending != pending {
+		t.Errorf("stats before flush = %+v", st)
+	}
+
+	close(backend.gate)
+	if err := lib.FlushColdWrites(); err != nil {
+		t.Fatalf("FlushColdWrites: %v", err)
+	}
+
+	mem, cold, pending = countLeavesByState(g)
+	if mem != 0 || pending != 0 || cold == 0 {
+		t.Errorf("after flush: mem=%d cold=%d pending=%d", mem, cold, pending)
+	}
+	if got := g.MemoryUsage().MemoryBytes; got != 0 {
+		t.Errorf("MemoryBytes after flush = %d, want 0", got)
+	}
+
+	// Cold data thaws back intact.
+	data, err = g.NewCursor().ReadBytes(11)
+	if err != nil || string(data) != "Hello World" {
+		t.Errorf("read after flush: %q, %v", data, err)
+	}
+}
+
+func TestWriteBackFailureKeepsDataResident(t *testing.T) {
+	backend := &gatedColdStorage{
+		inner: newFSColdStorage(&localFileSystem{}, t.TempDir()),
+		gate:  make(chan struct{}),
+		fail:  true,
+	}
+	close(backend.gate)
+	lib, _ := Init(LibraryOptions{ColdStorageBackend: backend, ColdWriteBackQueue: 16})
+	defer lib.Close()
+
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+
+	g.Chill(ChillEverything)
+	if err := lib.FlushColdWrites(); err == nil {
+		t.Error("FlushColdWrites should report the failed write")
+	}
+
+	mem, cold, pending := countLeavesByState(g)
+	if cold != 0 || pending != 0 || mem == 0 {
+		t.Errorf("after failed write: mem=%d cold=%d pending=%d", mem, cold, pending)
+	}
+	if st := lib.ColdWriteBackStats(); st.Failed == 0 {
+		t.Errorf("stats = %+v, want Failed > 0", st)
+	}
+	data, _ := g.NewCursor().ReadBytes(11)
+	if string(data) != "Hello World" {
+		t.Errorf("read after failed write: %q", data)
+	}
+}
+
+func TestWriteBackQueueFullFallsBackToSync(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir(), ColdWriteBackQueue: 1})
+	defer lib.Close()
+
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+
+	// Build up several leaves so one chill pass overflows the queue.
+	c := g.NewCursor()
+	for i := 0; i < 5; i++ {
+		c.SeekByte(0)
+		c.InsertString("x", nil, true)
+	}
+
+	// Stop the worker from draining by holding the garland lock while
+	// chilling: the first job occupies the queue slot, later ones must
+	// be written inline.
+	g.mu.Lock()
+	for _, node := range g.nodeRegistry {
+		for forkRev, snap := range node.history {
+			if snap.isLeaf && snap.storageState == StorageMemory && len(snap.data) > 0 {
+				if err := g.chillSnapshot(node.id, forkRev, snap); err != nil {
+					g.mu.Unlock()
+					t.Fatalf("chillSnapshot: %v", err)
+				}
+			}
+		}
+	}
+	g.mu.Unlock()
+
+	if err := lib.FlushColdWrites(); err != nil {
+		t.Fatalf("FlushColdWrites: %v", err)
+	}
+	if st := lib.ColdWriteBackStats(); st.SyncFallbacks == 0 {
+		t.Errorf("stats = %+v, want SyncFallbacks > 0", st)
+	}
+	data, _ := g.NewCursor().ReadBytes(16)
+	if string(data) != "xxxxxHello World" {
+		t.Errorf("content = %q", data)
+	}
+}
@@ -0,0 +1,164 @@
+package garland
+
+// zerocopy.go - pinned zero-copy reads.
+//
+// DESIGN: ReadBytes copies - correct, but a rendering pipeline that
+// pulls the visible window every frame re-copies megabytes per second
+// just to be safe against concurrent eviction. ReadBytesZeroCopy hands
+// out the leaves' OWN byte slices instead, plus a Pin that keeps those
+// leaves resident until it is released.
+//
+// WHAT THE PIN PROTECTS: leaf data is immutable - an edit builds new
+// snapshots, it never writes into an existing leaf's array - so a
+// borrowed slice never changes under the caller, pinned or not. What
+// the pin prevents is EVICTION: a pinned leaf is never chilled (to cold
+// or warm storage), so memory accounting stays honest (the bytes the
+// caller holds are the bytes MemoryUsage counts, not a second thawed
+// copy) and the next frame's read of the same window is a hit.
+//
+// RULES for the caller:
+//   - Never modify a borrowed slice; it is shared with the document's
+//     history.
+//   - Release every Pin (Release is idempotent). An unreleased pin only
+//     costs memory - it never blocks edits, saves or undo.
+//   - Bytes past the tree (the not-yet-merged tail of a streaming
+//     load) are returned as a private copy; they need no pin.
+
+// Pin holds leaves resident for the slices returned by a zero-copy
+// read. Release it when the slices are no longer needed.
+type Pin struct {
+	g     *Garland
+	snaps []*NodeSnapshot
+}
+
+// Release unpins the leaves; they become eligible for chilling again.
+// Safe to call more than once, and on a nil Pin.
+func (p *Pin) Release() {
+	if p == nil || p.g == nil {
+		return
+	}
+	g := p.g
+	g.mu.Lock()
+	for _, snap := range p.snaps {
+		snap.pins--
+	}
+	g.mu.Unlock()
+	p.g = nil
+	p.snaps = nil
+}
+
+// ReadBytesZeroCopy reads up to length bytes at the cursor position
+// without copying: the result is the sequence of borrowed leaf slices
+// covering the range, in order, and a Pin keeping those leaves
+// resident. The caller must not modify the slices and must Release the
+// pin. After reading, the cursor advances past the data (as ReadBytes).
+func (c *Cursor) ReadBytesZeroCopy(length int64) ([][]byte, *Pin, error) {
+	if c.detached() {
+		return nil, nil, ErrCursorNotFound
+	}
+	chunks, pin, err := c.garland.readBytesZeroCopyAt(c.posByte(), length)
+	if err != nil {
+		return nil, nil, err
+	}
+	var n int64
+	for _, chunk := range chunks {
+		n += int64(len(chunk))
+	}
+	if err := c.SeekByte(c.posByte() + n); err != nil {
+		pin.Release()
+		return nil, nil, err
+	}
+	return chunks, pin, nil
+}
+
+// readBytesZeroCopyAt is the garland side of ReadBytesZeroCopy. Cold
+// leaves are thawed first (as readBytesAt does), then the range is
+// collected and pinned under one hold of the lock.
+func (g *Garland) readBytesZeroCopyAt(pos, length int64) ([][]byte, *Pin, error) {
+	if pos < 0 {
+		return nil, nil, ErrInvalidPosition
+	}
+	if length <= 0 {
+		return nil, &Pin{}, nil
+	}
+	g.touchAccess()
+
+	g.mu.Lock()
+	total := g.calculateTotalBytesUnlocked()
+	if pos > total {
+		g.mu.Unlock()
+		return nil, nil, ErrInvalidPosition
+	}
+	if pos+length > total {
+		length = total - pos
+	}
+	chunks, pin, err := g.collectPinnedRangeLocked(pos, length)
+	g.mu.Unlock()
+
+	if err == ErrDataNotLoaded {
+		if thawErr := g.ThawRange(pos, pos+length); thawErr != nil {
+			return nil, nil, thawErr
+		}
+		g.mu.Lock()
+		chunks, pin, err = g.collectPinnedRangeLocked(pos, length)
+		g.mu.Unlock()
+	}
+	return chunks, pin, err
+}
+
+// collectPinnedRangeLocked gathers the leaf slices covering
+// [pos, pos+length) and pins their snapshots. Nothing is pinned when it
+// fails (ErrDataNotLoaded: a leaf is not resident). Caller must hold
+// the write lock.
+func (g *Garland) collectPinnedRangeLocked(pos, length int64) ([][]byte, *Pin, error) {
+	rootSnap := g.root.snapshotAt(g.currentFork, g.currentRevision)
+	if rootSnap == nil {
+		return nil, nil, ErrInternal
+	}
+	treeBytes := rootSnap.byteCount
+
+	var chunks [][]byte
+	var snaps []*NodeSnapshot
+	remaining := length
+	cur := pos
+	for remaining > 0 && cur < treeBytes {
+		leaf, err := g.findLeafByByteUnlocked(cur)
+		if err != nil {
+			return nil, nil, err
+		}
+		snap := leaf.Snapshot
+		if snap.storageState != StorageMemory || snap.data == nil {
+			return nil, nil, ErrDataNotLoaded
+		}
+		n := snap.byteCount - leaf.ByteOffset
+		if n > remaining {
+			n = remaining
+		}
+		if n <= 0 {
+			break
+		}
+		chunks = append(chunks, snap.data[leaf.ByteOffset:leaf.ByteOffset+n:leaf.ByteOffset+n])
+		snaps = append(snaps, snap)
+		g.touchSnapshot(snap)
+		g.tierStats.hits.Add(1)
+		remaining -= n
+		cur += n
+	}
+
+	// Past the tree: the streaming remainder, copied (readBytesRange-
+	// Internal handles the revision bookkeeping for it).
+	if remaining > 0 {
+		tail, err := g.readBytesRangeInternal(cur, remaining)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tail) > 0 {
+			chunks = append(chunks, tail)
+		}
+	}
+
+	for _, snap := range snaps {
+		snap.pins++
+	}
+	return chunks, &Pin{g: g, snaps: snaps}, nil
+}
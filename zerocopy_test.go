@@ -0,0 +1,100 @@
+package garland
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestReadBytesZeroCopyPinsLeaves(t *testing.T) {
+	lib, _ := Init(LibraryOptions{ColdStoragePath: t.TempDir()})
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	c.SeekByte(6)
+	c.InsertString("Big ", nil, true) // several leaves
+	c.SeekByte(0)
+
+	chunks, pin, err := c.ReadBytesZeroCopy(100)
+	if err != nil {
+		t.Fatalf("ReadBytesZeroCopy: %v", err)
+	}
+	if got := string(bytes.Join(chunks, nil)); got != "Hello Big World" {
+		t.Fatalf("content = %q", got)
+	}
+	if c.BytePos() != 15 {
+		t.Errorf("cursor after read = %d, want 15", c.BytePos())
+	}
+
+	// Pinned leaves survive even ChillEverything.
+	g.Chill(ChillEverything)
+	if st := g.MemoryUsage(); st.InMemoryLeafBytes != 15 {
+		t.Errorf("pinned leaves were chilled: %+v", st)
+	}
+	if got := string(bytes.Join(chunks, nil)); got != "Hello Big World" {
+		t.Errorf("borrowed content changed: %q", got)
+	}
+
+	pin.Release()
+	pin.Release() // idempotent
+
+	g.Chill(ChillEverything)
+	if st := g.MemoryUsage(); st.InMemoryLeafBytes != 0 {
+		t.Errorf("after Release, leaves should chill: %+v", st)
+	}
+
+	// A read over cold data thaws, then borrows.
+	c.SeekByte(0)
+	chunks, pin, err = c.ReadBytesZeroCopy(5)
+	if err != nil || string(bytes.Join(chunks, nil)) != "Hello" {
+		t.Errorf("read over cold data: %q, %v", bytes.Join(chunks, nil), err)
+	}
+	pin.Release()
+}
+
+func TestReadBytesZeroCopyBorrowsLeafData(t *testing.T) {
+	lib, _ := Init(LibraryOptions{})
+	g, _ := lib.Open(FileOptions{DataString: "abcdef"})
+	defer g.Close()
+
+	c := g.NewCursor()
+	chunks, pin, err := c.ReadBytesZeroCopy(6)
+	if err != nil || len(chunks) != 1 {
+		t.Fatalf("chunks=%d err=%v", len(chunks), err)
+	}
+	defer pin.Release()
+
+	leaf, _ := g.findLeafByByteUnlocked(0)
+	if &chunks[0][0] != &leaf.Snapshot.data[0] {
+		t.Error("ReadBytesZeroCopy copied instead of borrowing")
+	}
+	// Capacity is clipped: appending cannot scribble on the leaf.
+	if cap(chunks[0]) != len(chunks[0]) {
+		t.Errorf("cap = %d, want %d", cap(chunks[0]), len(chunks[0]))
+	}
+}
+
+func TestReadBytesZeroCopyReportsThawFailure(t *testing.T) {
+	dir := t.TempDir()
+	lib, _ := Init(LibraryOptions{ColdStoragePath: dir})
+	g, _ := lib.Open(FileOptions{DataString: "Hello World"})
+	defer g.Close()
+	if err := g.Chill(ChillEverything); err != nil {
+		t.Fatal(err)
+	}
+	// Lose the cold copy: the read reports the thaw's failure, not the
+	// not-loaded condition that called for the thaw.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	c := g.NewCursor()
+	_, pin, err := c.ReadBytesZeroCopy(5)
+	if err == nil || err == ErrDataNotLoaded || pin != nil {
+		t.Fatalf("read over lost cold data: pin %v, err %v", pin, err)
+	}
+	if c.BytePos() != 0 {
+		t.Errorf("failed read moved the cursor to %d", c.BytePos())
+	}
+}